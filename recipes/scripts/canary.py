@@ -0,0 +1,21 @@
+import logging
+
+from sdk.incident import Incident
+from sdk.recipe import Recipe, RecipeStatus
+
+logger = logging.getLogger(__name__)
+
+
+def handler(incident: Incident, recipe: Recipe):
+    """No-op Recipe run by the canary self-test of the Reconciler."""
+    logger.info("Running canary self-test for incident %s", incident.uuid)
+    recipe.results.log("Canary self-test")
+    recipe.results.status = RecipeStatus.SUCCESSFUL
+
+
+def main():
+    Recipe("canary", handler).run()
+
+
+if __name__ == "__main__":
+    main()
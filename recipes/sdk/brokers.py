@@ -0,0 +1,31 @@
+import asyncio
+import logging
+
+logger = logging.getLogger(__name__)
+
+
+def publish_to_nats(address: str, subject: str, payload: str):
+    """Publish recipe results to a NATS JetStream subject."""
+    import nats
+
+    async def publish():
+        nc = await nats.connect(address)
+        try:
+            js = nc.jetstream()
+            await js.publish(subject, payload.encode())
+        finally:
+            await nc.close()
+
+    asyncio.run(publish())
+
+
+def publish_to_kafka(address: str, topic: str, key: str, payload: str):
+    """Publish recipe results to a Kafka topic, keyed by incident."""
+    from kafka import KafkaProducer
+
+    producer = KafkaProducer(bootstrap_servers=address.split(","))
+    try:
+        producer.send(topic, key=key.encode(), value=payload.encode())
+        producer.flush()
+    finally:
+        producer.close()
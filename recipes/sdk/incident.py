@@ -31,6 +31,16 @@ class Incident:
     def data(self):
         return self._data
 
+    @property
+    def node_problems(self):
+        """Problems reported on the node of a node-related alert, if known."""
+        return self._data.get("nodeProblems", [])
+
+    @property
+    def params(self):
+        """Parameters of the recipe, rendered from the alert by the Reconciler."""
+        return self._data.get("params", {})
+
     @classmethod
     def from_dict(cls, d: dict):
         """Create an Incident from a dictionary."""
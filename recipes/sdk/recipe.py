@@ -2,11 +2,13 @@ import argparse
 import functools
 import json
 import logging
+import os
 from enum import Enum
 
 import redis
 from tenacity import retry, stop_after_attempt, wait_exponential
 
+from sdk.brokers import publish_to_kafka, publish_to_nats
 from sdk.errors import IncidentParsingError
 from sdk.incident import Incident
 from sdk.services import DataAggregator
@@ -25,6 +27,9 @@ class RecipeStatus(Enum):
 class RecipeResults:
     """Euphrosyne Reconciler Recipe Results."""
 
+    # Version of the schema the results are published with
+    SCHEMA = "results/v1"
+
     def __init__(
         self,
         incident: str = None,
@@ -34,6 +39,7 @@ class RecipeResults:
         analysis: str = None,
         json: str = None,
         links: list[str] = None,
+        actionable: bool = None,
     ):
         self.incident = incident or ""
         self.name = name or ""
@@ -44,6 +50,9 @@ class RecipeResults:
             "json": json or "",
             "links": links or [],
         }
+        # Results that do not say whether they call for action are considered actionable
+        if actionable is not None:
+            self.results["actionable"] = actionable
 
     @property
     def status(self):
@@ -77,6 +86,14 @@ class RecipeResults:
         """Add an action to the recipe results."""
         self.results["actions"].append(action)
 
+    @property
+    def actionable(self):
+        return self.results.get("actionable", True)
+
+    @actionable.setter
+    def actionable(self, value: bool):
+        self.results["actionable"] = value
+
     @property
     def analysis(self):
         return self.results["analysis"]
@@ -93,12 +110,13 @@ class RecipeResults:
     def from_dict(cls, d):
         """Create a RecipeResults object from a dictionary."""
         status = RecipeStatus(d.get("status", RecipeStatus.UNKNOWN.value))
-        params = {k: v for k, v in d.items() if k != "status"}
+        params = {k: v for k, v in d.items() if k not in ("status", "schema")}
         return cls(status=status, **params)
 
     def to_dict(self):
         """Convert the recipe results to a dictionary."""
         return {
+            "schema": self.SCHEMA,
             "incident": self.incident,
             "name": self.name,
             "status": self.status.value,
@@ -120,6 +138,9 @@ class Recipe:
 
     REDIS_ADDRESS = "localhost:6379"
     DATA_FILE_PATH = "/app/data.json"
+    TERMINATION_MESSAGE_PATH = "/dev/termination-log"
+    # Kubernetes truncates termination messages longer than 4096 bytes
+    TERMINATION_MESSAGE_LIMIT = 4096
 
     def __init__(self, name, handler):
         self._name = name
@@ -193,6 +214,54 @@ class Recipe:
             self.results.status = RecipeStatus.FAILED
             raise
 
+    @property
+    def trace_context(self) -> dict:
+        """Trace context passed by the Reconciler, for recipes to continue its trace.
+
+        The carrier can be passed to `opentelemetry.propagate.extract`.
+        """
+        return {
+            key: os.environ[key.upper()]
+            for key in ("traceparent", "tracestate")
+            if key.upper() in os.environ
+        }
+
+    def _termination_message(self):
+        """Serialise the recipe results to fit in the termination message of the container.
+
+        Results that are too large are trimmed, dropping the JSON output first and then
+        truncating the analysis.
+        """
+        message = str(self.results)
+        if len(message.encode()) <= self.TERMINATION_MESSAGE_LIMIT:
+            return message
+
+        trimmed = self.results.to_dict()
+        trimmed["results"] = dict(trimmed["results"], json="")
+        message = json.dumps(trimmed)
+        excess = len(message.encode()) - self.TERMINATION_MESSAGE_LIMIT
+        if excess > 0:
+            analysis = trimmed["results"]["analysis"].encode()
+            analysis = analysis[: max(len(analysis) - excess - 3, 0)].decode(errors="ignore")
+            trimmed["results"]["analysis"] = f"{analysis}..."
+            message = json.dumps(trimmed)
+        return message
+
+    def _write_termination_message(self):
+        """Write the recipe results to the termination message of the container.
+
+        The Reconciler falls back to reading the termination message if the results could not be
+        delivered through the result broker. Returns whether the message was written.
+        """
+        path = os.environ.get("TERMINATION_MESSAGE_PATH", self.TERMINATION_MESSAGE_PATH)
+        try:
+            with open(path, "w") as f:
+                f.write(self._termination_message())
+        except OSError as e:
+            logger.warning("Failed to write termination message to %s: %s", path, e)
+            return False
+        return True
+
     @retry(
         wait=wait_exponential(multiplier=2, min=1, max=10),
         stop=stop_after_attempt(3),
@@ -207,10 +276,32 @@ class Recipe:
             self.results.status = RecipeStatus.FAILED
             raise
 
+    @retry(
+        wait=wait_exponential(multiplier=2, min=1, max=10),
+        stop=stop_after_attempt(3),
+        reraise=True,
+    )
+    def _publish_results_to_broker(self, broker: str, incident: Incident):
+        """Publish recipe results to the broker configured by the Reconciler."""
+        address = os.environ["RESULT_BROKER_ADDRESS"]
+        topic = os.environ["RESULT_TOPIC"]
+        key = os.environ.get("RESULT_KEY", incident.uuid)
+        try:
+            if broker == "nats":
+                publish_to_nats(address, topic, str(self.results))
+            elif broker == "kafka":
+                publish_to_kafka(address, topic, key, str(self.results))
+            else:
+                raise ValueError(f"Unsupported result broker '{broker}'")
+        except Exception:
+            logger.error("Failed to publish results to %s at %s", broker, address)
+            self.results.status = RecipeStatus.FAILED
+            raise
+
     @_parse_input_data
     def run(self, incident: Incident, cli_config: dict):
         """Run the recipe."""
-        self._connect_to_redis(cli_config["redis_address"])
+        broker = os.environ.get("RESULT_BROKER", "redis")
         self.aggregator = DataAggregator(cli_config["aggregator_address"])
         self.results.incident = incident.uuid
         try:
@@ -219,4 +310,16 @@ class Recipe:
             logger.error("An error occurred while running the recipe: %s", e)
             self.results.status = RecipeStatus.FAILED
             raise
-        self._publish_results(self._get_redis_channel(incident))
+
+        # Keep a copy of the results, for the Reconciler to fall back to if publishing fails
+        fallback = self._write_termination_message()
+        try:
+            if broker == "redis":
+                self._connect_to_redis(cli_config["redis_address"])
+                self._publish_results(self._get_redis_channel(incident))
+            else:
+                self._publish_results_to_broker(broker, incident)
+        except Exception:
+            if not fallback:
+                raise
+            logger.warning("Failed to publish results, falling back to the termination message")
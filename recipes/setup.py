@@ -11,12 +11,15 @@ setup(
     ],
     entry_points={
         "console_scripts": [
+            "canary = scripts.canary:main",
             "dummy = scripts.dummy:main",
             "http-errors = scripts.http_errors:main",
             "jira = scripts.jira:main",
         ],
     },
     extras_require={
+        "kafka": ["kafka-python"],
+        "nats": ["nats-py"],
         "dev": [
             "black",
             "codespell",
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Acknowledgement states of incidents.
+const (
+	AckStateUnacked  = "unacked"
+	AckStateAcked    = "acked"
+	AckStateResolved = "resolved"
+)
+
+// Sources of the acknowledgement updates.
+const (
+	APIAckSource     = "api"
+	ChatOpsAckSource = "chatops"
+)
+
+// Maximum age of the ChatOps callbacks, rejecting replayed requests.
+const chatOpsCallbackMaxAge = 5 * time.Minute
+
+// Acknowledgement tracks whether the people handling an incident are aware of it.
+type Acknowledgement struct {
+	State     string     `json:"state"`
+	User      string     `json:"user,omitempty"`
+	UpdatedAt *time.Time `json:"updatedAt,omitempty"`
+}
+
+// Whether to hold back the notifications of alerts whose incident is acknowledged.
+var suppressAckedNotifications bool
+
+// Commands of the ChatOps callbacks, along with the state they set.
+var ackCommands = map[string]string{
+	"ack":     AckStateAcked,
+	"resolve": AckStateResolved,
+	"unack":   AckStateUnacked,
+}
+
+// Mentions of the bot in the messages of Teams outgoing webhooks.
+var teamsMention = regexp.MustCompile(`<at>.*?</at>`)
+
+// Check whether the provided acknowledgement state is supported.
+func isValidAckState(state string) bool {
+	return state == AckStateUnacked || state == AckStateAcked || state == AckStateResolved
+}
+
+// Set the acknowledgement of an incident, returning the updated incident.
+func (ir *IncidentRegistry) SetAck(uuid string, ack Acknowledgement) (*Incident, bool) {
+	ir.mutex.RLock()
+	_, ok := ir.incidents[uuid]
+	ir.mutex.RUnlock()
+	// Incidents that are only persisted are held in memory as well
+	if !ok {
+		ir.Restore(uuid)
+	}
+
+	var updated *Incident
+	ir.Update(uuid, func(incident *Incident) {
+		incident.Ack = ack
+		updated = copyIncident(incident)
+	})
+	return updated, updated != nil
+}
+
+// Record the fingerprint of the alert of an incident, so that later executions of the alert are
+// matched with it.
+func (ir *IncidentRegistry) SetFingerprint(uuid string, fingerprint string) {
+	ir.Update(uuid, func(incident *Incident) {
+		incident.Fingerprint = fingerprint
+	})
+}
+
+// Update the acknowledgement of an incident, announcing it on the thread of the incident.
+func acknowledgeIncident(uuid string, state string, user string, source string) (*Incident, bool) {
+	now := time.Now().UTC()
+	ack := Acknowledgement{State: state, User: user, UpdatedAt: &now}
+	incident, ok := incidentRegistry.SetAck(uuid, ack)
+	if !ok {
+		return nil, false
+	}
+	auditLog.Record(AuditAckUpdated, uuid, map[string]interface{}{
+		"state": state, "user": user, "source": source,
+	})
+	ackUpdates.WithLabelValues(state, source).Inc()
+	replyToIncidentThread(uuid, ackThreadReply(ack))
+	return incident, true
+}
+
+// Format an acknowledgement update as a reply to the thread of its incident.
+func ackThreadReply(ack Acknowledgement) string {
+	user := ack.User
+	if user == "" {
+		user = "unknown user"
+	}
+	switch ack.State {
+	case AckStateAcked:
+		return fmt.Sprintf("Incident acknowledged by %s", user)
+	case AckStateResolved:
+		return fmt.Sprintf("Incident marked as resolved by %s", user)
+	}
+	return fmt.Sprintf("Incident unacknowledged by %s", user)
+}
+
+// Return the acknowledged incident holding back the notifications of an incident, i.e. the
+// incident itself or an earlier incident of the same alert, if the suppression is enabled.
+func ackedIncident(uuid string) (string, bool) {
+	if !suppressAckedNotifications {
+		return "", false
+	}
+	incident, ok := incidentRegistry.Get(uuid)
+	if !ok {
+		return "", false
+	}
+	if incident.Ack.State == AckStateAcked {
+		return uuid, true
+	}
+	if incident.Fingerprint == "" {
+		return "", false
+	}
+	for _, other := range incidentRegistry.List() {
+		if other.Fingerprint == incident.Fingerprint && other.Ack.State == AckStateAcked {
+			return other.UUID, true
+		}
+	}
+	return "", false
+}
+
+// Check whether a notification of an incident is held back, as its alert is acknowledged.
+func notificationSuppressed(uuid string, kind string) bool {
+	acked, ok := ackedIncident(uuid)
+	if !ok {
+		return false
+	}
+	logger.Info(
+		"Notification suppressed for acknowledged alert",
+		zap.String("uuid", uuid),
+		zap.String("acked", acked),
+		zap.String("kind", kind),
+	)
+	ackedNotificationsSuppressed.WithLabelValues(kind).Inc()
+	return true
+}
+
+// Handle request to update the acknowledgement of an incident.
+func handleAckRequest(c *gin.Context) {
+	var request struct {
+		State string `json:"state"`
+		User  string `json:"user"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		logger.Error("Failed to parse JSON", zap.Error(err))
+		respondProblem(
+			c, http.StatusBadRequest, InvalidRequestProblem, "Invalid JSON for acknowledgement",
+		)
+		return
+	}
+	if !isValidAckState(request.State) {
+		respondProblem(
+			c, http.StatusBadRequest, InvalidRequestProblem,
+			fmt.Sprintf("Unsupported acknowledgement state '%s'", request.State),
+		)
+		return
+	}
+
+	incident, ok := acknowledgeIncident(
+		c.Param("uuid"), request.State, request.User, APIAckSource,
+	)
+	if !ok {
+		respondProblem(c, http.StatusNotFound, IncidentNotFoundProblem, "")
+		return
+	}
+	c.JSON(http.StatusOK, incident)
+}
+
+// Handle a callback of the ChatOps provider, i.e. a Slack slash command or a Teams outgoing
+// webhook, acknowledging an incident with a command like "ack <incident>".
+func handleChatOpsCallback(c *gin.Context, config *Config) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err == nil {
+		err = verifyChatOpsCallback(c.Request.Header, body, config, time.Now())
+	}
+	if err != nil {
+		logger.Warn(
+			"Rejecting unauthenticated ChatOps callback",
+			zap.String("provider", config.ChatOpsProvider),
+			zap.String("remoteAddr", c.ClientIP()),
+			zap.Error(err),
+		)
+		authFailures.WithLabelValues("chatops", config.ChatOpsProvider).Inc()
+		respondProblem(c, http.StatusUnauthorized, UnauthorizedProblem, "")
+		return
+	}
+
+	text, user := parseChatOpsCallback(config.ChatOpsProvider, body)
+	reply := runAckCommand(text, user)
+	// Replies are shown in the channel the command was sent from
+	if config.ChatOpsProvider == TeamsChatOpsProvider {
+		c.JSON(http.StatusOK, gin.H{"type": "message", "text": reply})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"response_type": "in_channel", "text": reply})
+}
+
+// Verify the signature of a ChatOps callback with the signing secret of the provider.
+func verifyChatOpsCallback(header http.Header, body []byte, config *Config, now time.Time) error {
+	if config.ChatOpsProvider == TeamsChatOpsProvider {
+		signature, ok := strings.CutPrefix(header.Get("Authorization"), "HMAC ")
+		if !ok {
+			return fmt.Errorf("Missing HMAC authorization")
+		}
+		expected, err := base64.StdEncoding.DecodeString(signature)
+		if err != nil {
+			return fmt.Errorf("Invalid HMAC authorization: %w", err)
+		}
+		key, _ := base64.StdEncoding.DecodeString(config.ChatOpsSigningSecret)
+		mac := hmac.New(sha256.New, key)
+		mac.Write(body)
+		if !hmac.Equal(mac.Sum(nil), expected) {
+			return fmt.Errorf("Invalid HMAC authorization")
+		}
+		return nil
+	}
+
+	timestamp := header.Get("X-Slack-Request-Timestamp")
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("Invalid request timestamp '%s'", timestamp)
+	}
+	age := now.Sub(time.Unix(seconds, 0))
+	if age > chatOpsCallbackMaxAge || age < -chatOpsCallbackMaxAge {
+		return fmt.Errorf("Request timestamp '%s' is out of date", timestamp)
+	}
+	signature, ok := strings.CutPrefix(header.Get("X-Slack-Signature"), "v0=")
+	expected, err := hex.DecodeString(signature)
+	if !ok || err != nil {
+		return fmt.Errorf("Invalid X-Slack-Signature header")
+	}
+	mac := hmac.New(sha256.New, []byte(config.ChatOpsSigningSecret))
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+	if !hmac.Equal(mac.Sum(nil), expected) {
+		return fmt.Errorf("Invalid X-Slack-Signature header")
+	}
+	return nil
+}
+
+// Extract the text of a ChatOps callback along with the user who sent it.
+func parseChatOpsCallback(provider string, body []byte) (string, string) {
+	if provider == TeamsChatOpsProvider {
+		var activity struct {
+			Text string `json:"text"`
+			From struct {
+				Name string `json:"name"`
+			} `json:"from"`
+		}
+		_ = json.Unmarshal(body, &activity)
+		return teamsMention.ReplaceAllString(activity.Text, ""), activity.From.Name
+	}
+	form, _ := url.ParseQuery(string(body))
+	return form.Get("text"), form.Get("user_name")
+}
+
+// Run an acknowledgement command sent through ChatOps, returning the reply to the user.
+func runAckCommand(text string, user string) string {
+	fields := strings.Fields(text)
+	if len(fields) != 2 {
+		return "Usage: ack|resolve|unack <incident>"
+	}
+	state, ok := ackCommands[strings.ToLower(fields[0])]
+	if !ok {
+		return fmt.Sprintf("Unknown command '%s', expected ack, resolve or unack", fields[0])
+	}
+	uuid := fields[1]
+	incident, ok := acknowledgeIncident(uuid, state, user, ChatOpsAckSource)
+	if !ok {
+		return fmt.Sprintf("Incident '%s' not found", uuid)
+	}
+	return fmt.Sprintf("%s (incident '%s')", ackThreadReply(incident.Ack), uuid)
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that the acknowledgement of incidents is updated through the API.
+func TestAckRequest(t *testing.T) {
+	incidentRegistry.Register("ack-incident", Alert)
+
+	router := gin.New()
+	router.PUT("/incidents/:uuid/ack", handleAckRequest)
+
+	tests := []struct {
+		name   string
+		uuid   string
+		body   string
+		status int
+		state  string
+	}{
+		{
+			name:   "Acked",
+			uuid:   "ack-incident",
+			body:   `{"state": "acked", "user": "alice"}`,
+			status: http.StatusOK,
+			state:  AckStateAcked,
+		},
+		{
+			name:   "Resolved",
+			uuid:   "ack-incident",
+			body:   `{"state": "resolved", "user": "alice"}`,
+			status: http.StatusOK,
+			state:  AckStateResolved,
+		},
+		{
+			name:   "UnsupportedState",
+			uuid:   "ack-incident",
+			body:   `{"state": "snoozed"}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "InvalidJSON",
+			uuid:   "ack-incident",
+			body:   `{"state":`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "NotFound",
+			uuid:   "unknown-incident",
+			body:   `{"state": "acked"}`,
+			status: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(
+				http.MethodPut, "/incidents/"+tt.uuid+"/ack", strings.NewReader(tt.body),
+			))
+			assert.Equal(t, tt.status, recorder.Code)
+			if tt.status != http.StatusOK {
+				return
+			}
+			var incident Incident
+			assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &incident))
+			assert.Equal(t, tt.state, incident.Ack.State)
+			assert.Equal(t, "alice", incident.Ack.User)
+			assert.NotNil(t, incident.Ack.UpdatedAt)
+		})
+	}
+}
+
+// Test that the callbacks of the ChatOps providers are verified with their signing secret.
+func TestVerifyChatOpsCallback(t *testing.T) {
+	now := time.Now()
+	body := []byte("text=ack+01HQ3Z5N2E8Y6V4C1X0W9T7R5P&user_name=alice")
+	slack := &Config{ChatOpsProvider: SlackChatOpsProvider, ChatOpsSigningSecret: "s3cr3t"}
+	slackHeader := func(timestamp time.Time, secret string) http.Header {
+		ts := strconv.FormatInt(timestamp.Unix(), 10)
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte("v0:" + ts + ":"))
+		mac.Write(body)
+		return http.Header{
+			"X-Slack-Request-Timestamp": {ts},
+			"X-Slack-Signature":         {"v0=" + hex.EncodeToString(mac.Sum(nil))},
+		}
+	}
+	teamsSecret := base64.StdEncoding.EncodeToString([]byte("t3ams"))
+	teams := &Config{ChatOpsProvider: TeamsChatOpsProvider, ChatOpsSigningSecret: teamsSecret}
+	teamsHeader := func(key string) http.Header {
+		mac := hmac.New(sha256.New, []byte(key))
+		mac.Write(body)
+		return http.Header{
+			"Authorization": {"HMAC " + base64.StdEncoding.EncodeToString(mac.Sum(nil))},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		config *Config
+		header http.Header
+		err    string
+	}{
+		{name: "Slack", config: slack, header: slackHeader(now, "s3cr3t")},
+		{
+			name:   "SlackInvalidSignature",
+			config: slack,
+			header: slackHeader(now, "wrong"),
+			err:    "Invalid X-Slack-Signature header",
+		},
+		{
+			name:   "SlackReplayed",
+			config: slack,
+			header: slackHeader(now.Add(-10*time.Minute), "s3cr3t"),
+			err:    "is out of date",
+		},
+		{
+			name:   "SlackMissingTimestamp",
+			config: slack,
+			header: http.Header{},
+			err:    "Invalid request timestamp",
+		},
+		{name: "Teams", config: teams, header: teamsHeader("t3ams")},
+		{
+			name:   "TeamsInvalidSignature",
+			config: teams,
+			header: teamsHeader("wrong"),
+			err:    "Invalid HMAC authorization",
+		},
+		{
+			name:   "TeamsMissingSignature",
+			config: teams,
+			header: http.Header{},
+			err:    "Missing HMAC authorization",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyChatOpsCallback(tt.header, body, tt.config, now)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			assert.Nil(t, err)
+		})
+	}
+}
+
+// Test that incidents are acknowledged with the commands of the ChatOps callbacks.
+func TestChatOpsAckCommand(t *testing.T) {
+	incidentRegistry.Register("chatops-ack-incident", Alert)
+
+	slackBody := url.Values{"text": {"ack chatops-ack-incident"}, "user_name": {"alice"}}.Encode()
+	text, user := parseChatOpsCallback(SlackChatOpsProvider, []byte(slackBody))
+	assert.Equal(t, "ack chatops-ack-incident", text)
+	assert.Equal(t, "alice", user)
+
+	teamsBody := `{
+		"text": "<at>Euphrosyne</at> resolve chatops-ack-incident", "from": {"name": "Bob"}
+	}`
+	text, user = parseChatOpsCallback(TeamsChatOpsProvider, []byte(teamsBody))
+	assert.Equal(t, " resolve chatops-ack-incident", text)
+	assert.Equal(t, "Bob", user)
+
+	tests := []struct {
+		name     string
+		text     string
+		expected string
+		state    string
+	}{
+		{
+			name:     "Ack",
+			text:     "ack chatops-ack-incident",
+			expected: "Incident acknowledged by alice (incident 'chatops-ack-incident')",
+			state:    AckStateAcked,
+		},
+		{
+			name:     "Unack",
+			text:     "UNACK chatops-ack-incident",
+			expected: "Incident unacknowledged by alice (incident 'chatops-ack-incident')",
+			state:    AckStateUnacked,
+		},
+		{
+			name:     "Usage",
+			text:     "ack",
+			expected: "Usage: ack|resolve|unack <incident>",
+			state:    AckStateUnacked,
+		},
+		{
+			name:     "UnknownCommand",
+			text:     "snooze chatops-ack-incident",
+			expected: "Unknown command 'snooze', expected ack, resolve or unack",
+			state:    AckStateUnacked,
+		},
+		{
+			name:     "NotFound",
+			text:     "ack unknown-incident",
+			expected: "Incident 'unknown-incident' not found",
+			state:    AckStateUnacked,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, runAckCommand(tt.text, "alice"))
+			incident, ok := incidentRegistry.Get("chatops-ack-incident")
+			assert.True(t, ok)
+			assert.Equal(t, tt.state, incident.Ack.State)
+		})
+	}
+}
+
+// Test that the notifications of an alert are held back while one of its incidents is acked.
+func TestAckedIncident(t *testing.T) {
+	registry := incidentRegistry
+	defer func() {
+		incidentRegistry = registry
+		suppressAckedNotifications = false
+	}()
+	incidentRegistry = NewIncidentRegistry(MemoryIncidentStore, time.Hour)
+
+	for _, uuid := range []string{"first", "repeat", "other"} {
+		incidentRegistry.Register(uuid, Alert)
+	}
+	incidentRegistry.SetFingerprint("first", "disk-full")
+	incidentRegistry.SetFingerprint("repeat", "disk-full")
+	incidentRegistry.SetFingerprint("other", "node-down")
+	acknowledgeIncident("first", AckStateAcked, "alice", APIAckSource)
+
+	// Notifications are only held back if the suppression is enabled
+	_, ok := ackedIncident("repeat")
+	assert.False(t, ok)
+
+	suppressAckedNotifications = true
+	acked, ok := ackedIncident("first")
+	assert.True(t, ok)
+	assert.Equal(t, "first", acked)
+	acked, ok = ackedIncident("repeat")
+	assert.True(t, ok)
+	assert.Equal(t, "first", acked)
+	_, ok = ackedIncident("other")
+	assert.False(t, ok)
+
+	// Resolved incidents no longer hold back the notifications of their alert
+	acknowledgeIncident("first", AckStateResolved, "alice", APIAckSource)
+	_, ok = ackedIncident("repeat")
+	assert.False(t, ok)
+}
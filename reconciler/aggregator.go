@@ -0,0 +1,434 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Supported sinks for the analysis of incidents.
+const (
+	WebexSink   = "webex"
+	HTTPSink    = "http"
+	SlackSink   = "slack"
+	JiraSink    = "jira"
+	WebhookSink = "webhook"
+)
+
+// Destinations of the templated payloads of the sinks.
+const (
+	SlackSinkDestination   = "slack"
+	JiraSinkDestination    = "jira"
+	WebhookSinkDestination = "webhook"
+)
+
+// Time allowed for a single delivery attempt to a sink.
+const sinkTimeout = 10 * time.Second
+
+// Delay before retrying a failed delivery, doubled on every attempt.
+var sinkRetryBackoff = time.Second
+
+// Aggregator delivers the analysis of an incident to a destination, e.g. the Webex Bot or a
+// ticketing system.
+type Aggregator interface {
+	Name() string
+	Deliver(ctx context.Context, message IncidentBotMessage, incident *Incident) error
+}
+
+// AggregationPipeline delivers the analysis of incidents to every enabled sink. Sinks are
+// delivered to concurrently, each retrying on its own and guarded by a circuit breaker, so that a
+// flaky destination does not hold back the others.
+type AggregationPipeline struct {
+	sinks []*pipelineSink
+}
+
+// pipelineSink is an aggregator along with its delivery policy.
+type pipelineSink struct {
+	Aggregator
+	retries int
+	breaker *CircuitBreaker
+	// Whether the sink is only delivered to when the analysis calls for action
+	actionableOnly bool
+}
+
+var aggregationPipeline = &AggregationPipeline{}
+
+// Check whether the provided sink is supported.
+func isValidSink(sink string) bool {
+	switch sink {
+	case WebexSink, HTTPSink, SlackSink, JiraSink, WebhookSink:
+		return true
+	}
+	return false
+}
+
+// Return the sinks enabled in the configuration.
+func enabledSinks(config *Config) []string {
+	return splitSinks(config.Sinks)
+}
+
+// Split a comma-separated list of sinks.
+func splitSinks(list string) []string {
+	var sinks []string
+	for _, sink := range strings.Split(list, ",") {
+		sink = strings.TrimSpace(sink)
+		if sink != "" {
+			sinks = append(sinks, sink)
+		}
+	}
+	return sinks
+}
+
+// Check that the enabled sinks are supported and configured, along with their delivery policy.
+func validateSinks(config *Config) error {
+	sinks := enabledSinks(config)
+	for i, sink := range sinks {
+		if !isValidSink(sink) {
+			return fmt.Errorf("Unsupported sink '%s'", sink)
+		}
+		if slices.Contains(sinks[:i], sink) {
+			return fmt.Errorf("Sink '%s' is enabled more than once", sink)
+		}
+	}
+	required := map[string]map[string]string{
+		HTTPSink:    {"--http-sink-url": config.HTTPSinkURL},
+		SlackSink:   {"--slack-webhook-url": config.SlackWebhookURL},
+		WebhookSink: {"--webhook-sink-url": config.WebhookSinkURL},
+		JiraSink: {
+			"--jira-url":     config.JiraURL,
+			"--jira-project": config.JiraProject,
+			"--jira-user":    config.JiraUser,
+			"--jira-token":   config.JiraToken,
+		},
+	}
+	for _, sink := range sinks {
+		for flag, value := range required[sink] {
+			if value == "" {
+				return fmt.Errorf("The %s sink requires %s", sink, flag)
+			}
+		}
+	}
+	for _, sink := range splitSinks(config.ActionableSinks) {
+		if !slices.Contains(sinks, sink) {
+			return fmt.Errorf("Actionable sink '%s' is not enabled", sink)
+		}
+	}
+	if config.SinkRetries < 0 {
+		return fmt.Errorf("The number of sink retries cannot be negative")
+	}
+	if config.SinkFailureThreshold <= 0 || config.SinkCooldown <= 0 {
+		return fmt.Errorf("The sink failure threshold and cooldown must be positive")
+	}
+	return nil
+}
+
+// Initialise the pipeline delivering to the sinks enabled in the configuration.
+func NewAggregationPipeline(config *Config) *AggregationPipeline {
+	pipeline := &AggregationPipeline{}
+	for _, sink := range enabledSinks(config) {
+		var aggregator Aggregator
+		switch sink {
+		case WebexSink:
+			aggregator = &webexAggregator{address: config.WebexBotAddress}
+		case HTTPSink:
+			aggregator = &httpAggregator{url: config.HTTPSinkURL}
+		case SlackSink:
+			aggregator = &slackAggregator{url: config.SlackWebhookURL}
+		case JiraSink:
+			aggregator = &jiraAggregator{
+				url:       strings.TrimSuffix(config.JiraURL, "/"),
+				project:   config.JiraProject,
+				issueType: config.JiraIssueType,
+				user:      config.JiraUser,
+				token:     config.JiraToken,
+			}
+		case WebhookSink:
+			aggregator = &webhookAggregator{url: config.WebhookSinkURL}
+		default:
+			continue
+		}
+		added := pipeline.Add(aggregator, config.SinkRetries, NewCircuitBreaker(
+			config.SinkFailureThreshold, config.SinkCooldown,
+		))
+		added.actionableOnly = slices.Contains(splitSinks(config.ActionableSinks), sink)
+	}
+	return pipeline
+}
+
+// Add a sink to the pipeline, retrying failed deliveries up to the given number of times.
+func (p *AggregationPipeline) Add(
+	aggregator Aggregator, retries int, breaker *CircuitBreaker,
+) *pipelineSink {
+	sink := &pipelineSink{Aggregator: aggregator, retries: retries, breaker: breaker}
+	p.sinks = append(p.sinks, sink)
+	return sink
+}
+
+// Deliver the analysis of an incident to every sink, returning the errors of the sinks that could
+// not be delivered to.
+func (p *AggregationPipeline) Deliver(ctx context.Context, message IncidentBotMessage) error {
+	incident, _ := incidentRegistry.Get(message.UUID)
+
+	errs := make([]error, len(p.sinks))
+	var wg sync.WaitGroup
+	for i, sink := range p.sinks {
+		wg.Add(1)
+		go func(i int, sink *pipelineSink) {
+			defer wg.Done()
+			if err := sink.deliver(ctx, message, incident); err != nil {
+				errs[i] = fmt.Errorf("Sink '%s': %w", sink.Name(), err)
+			}
+		}(i, sink)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// Deliver to the sink, retrying with an exponential backoff, unless its circuit is open.
+func (s *pipelineSink) deliver(
+	ctx context.Context, message IncidentBotMessage, incident *Incident,
+) error {
+	// Sinks paging responders are spared the informational analyses
+	if s.actionableOnly && !message.Actionable {
+		sinkDeliveries.WithLabelValues(s.Name(), "informational").Inc()
+		return nil
+	}
+	if !s.breaker.Allow(time.Now()) {
+		sinkDeliveries.WithLabelValues(s.Name(), "skipped").Inc()
+		return errCircuitOpen
+	}
+
+	backoff := sinkRetryBackoff
+	var err error
+	for attempt := 0; attempt <= s.retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+			}
+			backoff *= 2
+		}
+		if ctx.Err() != nil {
+			err = ctx.Err()
+			break
+		}
+		attemptCtx, cancel := context.WithTimeout(ctx, sinkTimeout)
+		err = s.Deliver(attemptCtx, message, incident)
+		cancel()
+		if err == nil {
+			break
+		}
+		logger.Warn(
+			"Failed to deliver incident analysis",
+			zap.String("sink", s.Name()),
+			zap.String("uuid", message.UUID),
+			zap.Int("attempt", attempt+1),
+			zap.Error(err),
+		)
+	}
+
+	if err != nil {
+		if s.breaker.Failure(time.Now()) {
+			logger.Warn("Sink circuit opened", zap.String("sink", s.Name()))
+		}
+		sinkDeliveries.WithLabelValues(s.Name(), "failed").Inc()
+	} else {
+		s.breaker.Success()
+		sinkDeliveries.WithLabelValues(s.Name(), "delivered").Inc()
+	}
+	sinkCircuitOpen.WithLabelValues(s.Name()).Set(boolToFloat(s.breaker.Open(time.Now())))
+	return err
+}
+
+// Post a JSON payload to a sink.
+func postToSink(ctx context.Context, url string, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Unexpected response status: %s", resp.Status)
+	}
+	return nil
+}
+
+// Render the payload of a sink, using the template configured for its destination if one exists
+// or the default payload of the sink otherwise.
+func renderSinkPayload(
+	destination string, defaultPayload interface{}, message IncidentBotMessage, incident *Incident,
+) ([]byte, error) {
+	if _, ok := messageTemplates.Get(destination); ok {
+		return renderMessage(destination, message, incident)
+	}
+	return json.Marshal(defaultPayload)
+}
+
+// Format the analysis of an incident as plain text, along with the suggested actions.
+func incidentSummaryText(message IncidentBotMessage) string {
+	return fmt.Sprintf(
+		"Incident %s: %s\n%s",
+		message.UUID, strings.TrimSpace(message.Analysis), incidentThreadReply(message),
+	)
+}
+
+// webexAggregator posts the analysis to the Webex Bot.
+type webexAggregator struct {
+	address string
+}
+
+func (a *webexAggregator) Name() string {
+	return WebexSink
+}
+
+func (a *webexAggregator) Deliver(
+	ctx context.Context, message IncidentBotMessage, incident *Incident,
+) error {
+	// Render the message using the configured template
+	jsonData, err := renderMessage(WebexAnalysisDestination, message, incident)
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/api/analysis", a.address)
+	return postToSink(ctx, url, jsonData)
+}
+
+// httpAggregator posts the analysis to an HTTP aggregator, along with the record of the incident.
+type httpAggregator struct {
+	url string
+}
+
+// HTTPSinkPayload is the payload posted to HTTP aggregators.
+type HTTPSinkPayload struct {
+	Message  IncidentBotMessage `json:"message"`
+	Incident *Incident          `json:"incident,omitempty"`
+}
+
+func (a *httpAggregator) Name() string {
+	return HTTPSink
+}
+
+func (a *httpAggregator) Deliver(
+	ctx context.Context, message IncidentBotMessage, incident *Incident,
+) error {
+	payload, err := json.Marshal(HTTPSinkPayload{Message: message, Incident: incident})
+	if err != nil {
+		return err
+	}
+	return postToSink(ctx, a.url, payload)
+}
+
+// slackAggregator posts the analysis to a Slack channel through an incoming webhook.
+type slackAggregator struct {
+	url string
+}
+
+func (a *slackAggregator) Name() string {
+	return SlackSink
+}
+
+func (a *slackAggregator) Deliver(
+	ctx context.Context, message IncidentBotMessage, incident *Incident,
+) error {
+	payload, err := renderSinkPayload(
+		SlackSinkDestination, map[string]string{"text": incidentSummaryText(message)},
+		message, incident,
+	)
+	if err != nil {
+		return err
+	}
+	return postToSink(ctx, a.url, payload)
+}
+
+// jiraAggregator creates a Jira issue for the analysis of each incident.
+type jiraAggregator struct {
+	url       string
+	project   string
+	issueType string
+	user      string
+	token     string
+}
+
+func (a *jiraAggregator) Name() string {
+	return JiraSink
+}
+
+func (a *jiraAggregator) Deliver(
+	ctx context.Context, message IncidentBotMessage, incident *Incident,
+) error {
+	fields := map[string]interface{}{
+		"project":     map[string]string{"key": a.project},
+		"issuetype":   map[string]string{"name": a.issueType},
+		"summary":     fmt.Sprintf("Euphrosyne incident %s", message.UUID),
+		"description": incidentSummaryText(message),
+	}
+	payload, err := renderSinkPayload(
+		JiraSinkDestination, map[string]interface{}{"fields": fields}, message, incident,
+	)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodPost, a.url+"/rest/api/2/issue", bytes.NewReader(payload),
+	)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(a.user, a.token)
+	resp, err := httpc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Unexpected response status: %s", resp.Status)
+	}
+
+	var issue struct {
+		Key string `json:"key"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&issue); err == nil && issue.Key != "" {
+		logger.Info(
+			"Created Jira issue", zap.String("uuid", message.UUID), zap.String("issue", issue.Key),
+		)
+	}
+	return nil
+}
+
+// webhookAggregator posts the analysis to a generic webhook, rendering the payload with the
+// template of the webhook destination.
+type webhookAggregator struct {
+	url string
+}
+
+func (a *webhookAggregator) Name() string {
+	return WebhookSink
+}
+
+func (a *webhookAggregator) Deliver(
+	ctx context.Context, message IncidentBotMessage, incident *Incident,
+) error {
+	payload, err := renderMessage(WebhookSinkDestination, message, incident)
+	if err != nil {
+		return err
+	}
+	return postToSink(ctx, a.url, payload)
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that the enabled sinks are checked for support and for their required settings.
+func TestValidateSinks(t *testing.T) {
+	policy := Config{SinkRetries: 2, SinkFailureThreshold: 5, SinkCooldown: time.Minute}
+	tests := []struct {
+		name   string
+		update func(config *Config)
+		valid  bool
+	}{
+		{
+			name:   "Webex",
+			update: func(config *Config) { config.Sinks = "webex" },
+			valid:  true,
+		},
+		{
+			name:   "No sinks",
+			update: func(config *Config) { config.Sinks = "" },
+			valid:  true,
+		},
+		{
+			name: "Multiple sinks",
+			update: func(config *Config) {
+				config.Sinks = "webex, slack, jira"
+				config.SlackWebhookURL = "https://hooks.slack.com/services/T/B/X"
+				config.JiraURL = "https://jira.example.com"
+				config.JiraProject = "OPS"
+				config.JiraUser = "euphrosyne"
+				config.JiraToken = "token"
+			},
+			valid: true,
+		},
+		{
+			name:   "Unsupported sink",
+			update: func(config *Config) { config.Sinks = "pager" },
+		},
+		{
+			name:   "Duplicate sink",
+			update: func(config *Config) { config.Sinks = "webex,webex" },
+		},
+		{
+			name:   "Missing URL",
+			update: func(config *Config) { config.Sinks = "http" },
+		},
+		{
+			name: "Missing Jira token",
+			update: func(config *Config) {
+				config.Sinks = "jira"
+				config.JiraURL = "https://jira.example.com"
+				config.JiraProject = "OPS"
+				config.JiraUser = "euphrosyne"
+			},
+		},
+		{
+			name: "Actionable sink",
+			update: func(config *Config) {
+				config.Sinks = "webex,slack"
+				config.SlackWebhookURL = "https://hooks.slack.com/services/T/B/X"
+				config.ActionableSinks = "slack"
+			},
+			valid: true,
+		},
+		{
+			name: "Actionable sink not enabled",
+			update: func(config *Config) {
+				config.Sinks = "webex"
+				config.ActionableSinks = "slack"
+			},
+		},
+		{
+			name:   "Negative retries",
+			update: func(config *Config) { config.SinkRetries = -1 },
+		},
+		{
+			name:   "No failure threshold",
+			update: func(config *Config) { config.SinkFailureThreshold = 0 },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := policy
+			tt.update(&config)
+			err := validateSinks(&config)
+			assert.Equal(t, tt.valid, err == nil, err)
+		})
+	}
+}
+
+// Test that the analysis of an incident is delivered to every sink in its own format.
+func TestAggregationPipelineDeliver(t *testing.T) {
+	received := make(map[string][]byte)
+	var user, token string
+	var mutex sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mutex.Lock()
+		defer mutex.Unlock()
+		received[r.URL.Path] = body
+		if r.URL.Path == "/jira/rest/api/2/issue" {
+			user, token, _ = r.BasicAuth()
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"key": "OPS-1"}`))
+		}
+	}))
+	defer server.Close()
+	httpc = server.Client()
+
+	templates, err := parseMessageTemplates(map[string]string{
+		WebhookSinkDestination: `{"incident": {{ .Message.UUID | quote }}}`,
+	})
+	assert.Nil(t, err)
+	messageTemplates.templates = templates
+	defer func() { messageTemplates.templates = nil }()
+
+	pipeline := NewAggregationPipeline(&Config{
+		Sinks:                "webex,http,slack,jira,webhook",
+		WebexBotAddress:      server.URL + "/webex",
+		HTTPSinkURL:          server.URL + "/http",
+		SlackWebhookURL:      server.URL + "/slack",
+		JiraURL:              server.URL + "/jira/",
+		JiraProject:          "OPS",
+		JiraIssueType:        "Task",
+		JiraUser:             "euphrosyne",
+		JiraToken:            "secret",
+		WebhookSinkURL:       server.URL + "/webhook",
+		SinkFailureThreshold: 5,
+		SinkCooldown:         time.Minute,
+	})
+	message := IncidentBotMessage{
+		UUID: "sink-incident", Analysis: "Disk full", Actions: []string{}, Actionable: true,
+	}
+	assert.Nil(t, pipeline.Deliver(context.Background(), message))
+
+	assert.JSONEq(
+		t, `{"uuid": "sink-incident", "analysis": "Disk full", "actions": [], "actionable": true}`,
+		string(received["/webex/api/analysis"]),
+	)
+	var payload HTTPSinkPayload
+	assert.Nil(t, json.Unmarshal(received["/http"], &payload))
+	assert.Equal(t, message, payload.Message)
+	var slackPayload map[string]string
+	assert.Nil(t, json.Unmarshal(received["/slack"], &slackPayload))
+	assert.Equal(
+		t, "Incident sink-incident: Disk full\nInvestigation completed, no actions suggested",
+		slackPayload["text"],
+	)
+	var issue struct {
+		Fields map[string]interface{} `json:"fields"`
+	}
+	assert.Nil(t, json.Unmarshal(received["/jira/rest/api/2/issue"], &issue))
+	assert.Equal(t, map[string]interface{}{"key": "OPS"}, issue.Fields["project"])
+	assert.Equal(t, map[string]interface{}{"name": "Task"}, issue.Fields["issuetype"])
+	assert.Equal(t, "Euphrosyne incident sink-incident", issue.Fields["summary"])
+	assert.Equal(t, "euphrosyne", user)
+	assert.Equal(t, "secret", token)
+	assert.JSONEq(t, `{"incident": "sink-incident"}`, string(received["/webhook"]))
+}
+
+// fakeAggregator records its deliveries, failing them if requested.
+type fakeAggregator struct {
+	name       string
+	fail       bool
+	deliveries atomic.Int32
+}
+
+func (a *fakeAggregator) Name() string {
+	return a.name
+}
+
+func (a *fakeAggregator) Deliver(context.Context, IncidentBotMessage, *Incident) error {
+	a.deliveries.Add(1)
+	if a.fail {
+		return assert.AnError
+	}
+	return nil
+}
+
+// Test that a failing sink is retried and then skipped once its circuit opens, without affecting
+// the other sinks.
+func TestAggregationPipelineIsolation(t *testing.T) {
+	defaultBackoff := sinkRetryBackoff
+	sinkRetryBackoff = time.Millisecond
+	defer func() { sinkRetryBackoff = defaultBackoff }()
+
+	healthy := &fakeAggregator{name: "healthy"}
+	flaky := &fakeAggregator{name: "flaky", fail: true}
+	pipeline := &AggregationPipeline{}
+	pipeline.Add(healthy, 2, NewCircuitBreaker(1, time.Minute))
+	pipeline.Add(flaky, 2, NewCircuitBreaker(1, time.Minute))
+
+	message := IncidentBotMessage{UUID: "isolated-incident"}
+	err := pipeline.Deliver(context.Background(), message)
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.ErrorContains(t, err, "Sink 'flaky'")
+	assert.Equal(t, int32(1), healthy.deliveries.Load())
+	assert.Equal(t, int32(3), flaky.deliveries.Load())
+
+	// The circuit of the flaky sink is now open
+	err = pipeline.Deliver(context.Background(), message)
+	assert.ErrorIs(t, err, errCircuitOpen)
+	assert.Equal(t, int32(2), healthy.deliveries.Load())
+	assert.Equal(t, int32(3), flaky.deliveries.Load())
+}
+
+// Test that the sinks only paging on actionable outcomes skip informational analyses.
+func TestAggregationPipelineActionableOnly(t *testing.T) {
+	all := &fakeAggregator{name: "all"}
+	paging := &fakeAggregator{name: "paging"}
+	pipeline := &AggregationPipeline{}
+	pipeline.Add(all, 0, NewCircuitBreaker(1, time.Minute))
+	pipeline.Add(paging, 0, NewCircuitBreaker(1, time.Minute)).actionableOnly = true
+
+	message := IncidentBotMessage{UUID: "informational-incident"}
+	assert.Nil(t, pipeline.Deliver(context.Background(), message))
+	assert.Equal(t, int32(1), all.deliveries.Load())
+	assert.Equal(t, int32(0), paging.deliveries.Load())
+
+	message.Actionable = true
+	assert.Nil(t, pipeline.Deliver(context.Background(), message))
+	assert.Equal(t, int32(2), all.deliveries.Load())
+	assert.Equal(t, int32(1), paging.deliveries.Load())
+}
@@ -1,36 +1,209 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 	"go.uber.org/zap"
 )
 
 func StartAlertHandler(config *Config) {
 	router := gin.Default()
-	router.POST("/webhook", func(ctx *gin.Context) { handleWebhook(ctx, config) })
+	router.Use(traceRequests())
+	router.POST(
+		"/webhook",
+		authenticate(config, "webhook", config.WebhookAuth),
+		requireLeader(),
+		checkDraining(),
+		checkIntake(),
+		func(ctx *gin.Context) { handleWebhook(ctx, config) },
+	)
+	router.POST(
+		"/webhook/batch",
+		authenticate(config, "webhook", config.WebhookAuth),
+		requireLeader(),
+		checkDraining(),
+		checkIntake(),
+		func(ctx *gin.Context) { handleBatchWebhook(ctx, config) },
+	)
+	// Any other request is served by the configured routes
+	router.NoRoute(requestRoutes.Handle)
 
-	if err := router.Run(":8080"); err != nil {
+	if err := runRouter(router, ":8080", config); err != nil {
 		logger.Error("Failed to start server", zap.Error(err))
 	}
 }
 
 func handleWebhook(c *gin.Context, config *Config) {
-	var alertData map[string]interface{}
+	body, err := c.GetRawData()
+	if err != nil {
+		logger.Error("Failed to read request body", zap.Error(err))
+		respondProblem(c, http.StatusBadRequest, InvalidRequestProblem, "Invalid request body")
+		return
+	}
+
+	alerts, problem := parseAlertPayload(body, config, requestAuthModes(c, config.WebhookAuth))
+	if problem != nil {
+		respondWithProblem(c, *problem)
+		return
+	}
+
+	uuids := []string{}
+	suppressed := []string{}
+	rejected := 0
+	for _, alertData := range alerts {
+		switch outcome, uuid, _ := admitAlert(c, alertData, config); outcome {
+		case AlertAccepted:
+			uuids = append(uuids, uuid)
+		case AlertSuppressed:
+			suppressed = append(suppressed, uuid)
+		case AlertRejected:
+			rejected++
+		}
+	}
+
+	// Resolved alerts run the verification recipes of their incidents, if any
+	verifications := []string{}
+	if config.PayloadSchema == AlertmanagerPayloadSchema {
+		resolved, _ := splitResolvedAlertmanagerPayload(body)
+		for _, alertData := range resolved {
+			if uuid, ok := submitVerification(c.Request.Context(), alertData, config); ok {
+				verifications = append(verifications, uuid)
+			}
+		}
+	}
 
-	if err := c.BindJSON(&alertData); err != nil {
-		logger.Error("Failed to parse JSON", zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
+	// Let the sender retry the rejected alerts, while reporting the ones that were accepted
+	if rejected > 0 {
+		problem := newProblem(
+			http.StatusTooManyRequests, QueueFullProblem,
+			fmt.Sprintf("%d of %d alert(s) rejected, retry later", rejected, len(alerts)),
+		)
+		problem.Extensions = map[string]interface{}{
+			"incidents":     uuids,
+			"suppressed":    suppressed,
+			"verifications": verifications,
+		}
+		respondWithProblem(c, problem)
 		return
 	}
 
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Alert received and processed",
+		"incidents":     uuids,
+		"suppressed":    suppressed,
+		"verifications": verifications,
+	})
+}
+
+// Outcomes of the alerts received on the webhook.
+const (
+	AlertAccepted   = "accepted"
+	AlertSuppressed = "suppressed"
+	AlertRejected   = "rejected"
+)
+
+// Split a webhook payload into its alerts, validating the inline recipe and the overrides defined
+// alongside them, which apply to each alert. Returns the problem to reject the payload with, if
+// any.
+func parseAlertPayload(
+	body []byte, config *Config, authModes string,
+) ([]map[string]interface{}, *Problem) {
+	alerts, err := splitAlertPayload(body, config)
+	if err != nil {
+		logger.Error(
+			"Failed to parse alert payload",
+			zap.String("schema", config.PayloadSchema),
+			zap.Error(err),
+		)
+		problem := newProblem(http.StatusBadRequest, InvalidAlertProblem, err.Error())
+		return nil, &problem
+	}
+
+	var payload map[string]interface{}
+	_ = json.Unmarshal(body, &payload)
+	if problem := validateInlineRecipe(payload, config, authModes, Alert); problem != nil {
+		return nil, problem
+	}
+	if problem := validateOverrides(payload, config, authModes); problem != nil {
+		return nil, problem
+	}
+	// Inline recipes and overrides defined alongside the alerts apply to each of them
+	for _, field := range []string{inlineRecipeField, overridesField} {
+		if spec, ok := payload[field]; ok {
+			for _, alertData := range alerts {
+				alertData[field] = spec
+			}
+		}
+	}
+	return alerts, nil
+}
+
+// Assign an alert a UUID and submit it for execution, unless it is a duplicate or in cooldown.
+// Returns the outcome of the alert along with the UUID of its incident, which is the active
+// incident for suppressed alerts, or the error the alert was rejected with.
+func admitAlert(
+	c *gin.Context, alertData map[string]interface{}, config *Config,
+) (string, string, error) {
 	// Log the alert data
-	alertData["uuid"] = uuid.New().String()
+	alertData["uuid"] = newExecutionID(c.Request.Context())
+	if route, ok := requestRoute(c); ok {
+		alertData[routeField] = route.Match()
+	}
 	logger.Info("Alert received", zap.Any("alert", alertData))
+	alertsReceived.Inc()
+	observeAlertSchema(alertData, config)
+
+	if activeUUID, ok := checkDedup(alertData, config); ok {
+		return AlertSuppressed, activeUUID, nil
+	}
+	if activeUUID, ok := checkCooldown(alertData, config); ok {
+		dedups.Release(alertData["uuid"].(string))
+		return AlertSuppressed, activeUUID, nil
+	}
+
+	uuid := alertData["uuid"].(string)
+	if err := executionQueue.Submit(c.Request.Context(), &alertData, Alert); err != nil {
+		logger.Warn("Rejecting alert", zap.String("uuid", uuid), zap.Error(err))
+		dedups.Release(uuid)
+		cooldowns.Release(uuid)
+		return AlertRejected, "", err
+	}
+	if config.PayloadSchema == AlertmanagerPayloadSchema {
+		trackFiringAlert(alertData, config)
+	}
+	return AlertAccepted, uuid, nil
+}
+
+// Check whether an alert is in cooldown according to its routing rule. Suppressed occurrences are
+// attached to the active incident, whose UUID is returned.
+func checkCooldown(alertData map[string]interface{}, config *Config) (string, bool) {
+	rc, err := getRecipeCatalog(config.ReconcilerNamespace)
+	if err != nil {
+		return "", false
+	}
+
+	labels := alertLabels(alertData)
+	rule, ok := rc.RoutingRule(labels["alertname"])
+	if !ok || rule.Cooldown.Duration == 0 {
+		return "", false
+	}
 
-	go StartRecipeExecutor(c, config, &alertData, Alert)
+	activeUUID, inCooldown := cooldowns.Check(
+		cooldownKey(rule, labels), rule.Cooldown.Duration, alertData["uuid"].(string),
+	)
+	if !inCooldown {
+		return "", false
+	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Alert received and processed"})
+	logger.Info(
+		"Alert suppressed during cooldown",
+		zap.String("alertname", rule.Alertname),
+		zap.String("incident", activeUUID),
+	)
+	alertsSuppressed.WithLabelValues(rule.Alertname).Inc()
+	incidentRegistry.RecordSuppressed(activeUUID)
+	return activeUUID, true
 }
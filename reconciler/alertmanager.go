@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Supported schemas for the payloads received on the webhook.
+const (
+	RawPayloadSchema          = "raw"
+	AlertmanagerPayloadSchema = "alertmanager"
+	CustomPayloadSchema       = "custom"
+)
+
+const alertStatusResolved = "resolved"
+
+// Fields of the alerts set by the Reconciler alone, which are dropped from received alerts.
+var reservedAlertFields = []string{
+	nodeProblemsField, nodeProblemRecipesField, verificationField, scheduledRunField, routeField,
+}
+
+// AlertmanagerPayload represents the webhook payload sent by Prometheus Alertmanager.
+type AlertmanagerPayload struct {
+	Version           string              `json:"version"`
+	GroupKey          string              `json:"groupKey"`
+	TruncatedAlerts   int                 `json:"truncatedAlerts"`
+	Status            string              `json:"status"`
+	Receiver          string              `json:"receiver"`
+	GroupLabels       map[string]string   `json:"groupLabels"`
+	CommonLabels      map[string]string   `json:"commonLabels"`
+	CommonAnnotations map[string]string   `json:"commonAnnotations"`
+	ExternalURL       string              `json:"externalURL"`
+	Alerts            []AlertmanagerAlert `json:"alerts"`
+}
+
+// AlertmanagerAlert represents a single alert in an Alertmanager webhook payload.
+type AlertmanagerAlert struct {
+	Status       string            `json:"status"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+}
+
+// Check whether the provided payload schema is supported.
+func isValidPayloadSchema(schema string) bool {
+	switch schema {
+	case RawPayloadSchema, AlertmanagerPayloadSchema, CustomPayloadSchema:
+		return true
+	}
+	return false
+}
+
+// Split an incoming webhook payload into the alert data for each reconciler run, according to
+// the configured payload schema.
+func splitAlertPayload(body []byte, config *Config) ([]map[string]interface{}, error) {
+	var alerts []map[string]interface{}
+	var err error
+	switch config.PayloadSchema {
+	case AlertmanagerPayloadSchema:
+		alerts, err = splitAlertmanagerPayload(body)
+	case CustomPayloadSchema:
+		alerts, err = splitCustomPayload(body, config.PayloadAlertsField)
+	default:
+		var alertData map[string]interface{}
+		err = json.Unmarshal(body, &alertData)
+		alerts = []map[string]interface{}{alertData}
+	}
+	if err != nil {
+		return nil, err
+	}
+	stripReservedFields(alerts)
+	return alerts, nil
+}
+
+// Drop the reserved fields from the alerts received on the webhook. These fields select the
+// recipes of the alerts the Reconciler raises itself, so senders must not be able to set them.
+func stripReservedFields(alerts []map[string]interface{}) {
+	for _, alertData := range alerts {
+		for _, field := range reservedAlertFields {
+			if _, ok := alertData[field]; ok {
+				logger.Warn("Dropping reserved field from alert", zap.String("field", field))
+				delete(alertData, field)
+			}
+		}
+	}
+}
+
+// Fan out an Alertmanager payload into one alert data object per firing alert. Resolved alerts
+// are skipped, since there is nothing left to reconcile.
+func splitAlertmanagerPayload(body []byte) ([]map[string]interface{}, error) {
+	var payload AlertmanagerPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	if len(payload.Alerts) == 0 {
+		return nil, fmt.Errorf("Alertmanager payload contains no alerts")
+	}
+	return alertmanagerAlerts(payload, false)
+}
+
+// Fan out the resolved alerts of an Alertmanager payload into one alert data object per alert.
+func splitResolvedAlertmanagerPayload(body []byte) ([]map[string]interface{}, error) {
+	var payload AlertmanagerPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+	return alertmanagerAlerts(payload, true)
+}
+
+// Build the alert data of either the firing or the resolved alerts of an Alertmanager payload.
+func alertmanagerAlerts(
+	payload AlertmanagerPayload, resolved bool,
+) ([]map[string]interface{}, error) {
+	var alerts []map[string]interface{}
+	for _, alert := range payload.Alerts {
+		if (alert.Status == alertStatusResolved) != resolved {
+			continue
+		}
+		alertData, err := toMap(alertmanagerAlertData(payload, alert))
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, alertData)
+	}
+	return alerts, nil
+}
+
+// Build the payload for a single alert, preserving the group level information.
+func alertmanagerAlertData(
+	payload AlertmanagerPayload, alert AlertmanagerAlert,
+) AlertmanagerPayload {
+	alertPayload := payload
+	alertPayload.Status = alert.Status
+	alertPayload.TruncatedAlerts = 0
+	alertPayload.Alerts = []AlertmanagerAlert{alert}
+	return alertPayload
+}
+
+// Fan out a payload into one alert data object per item found under the configured field. Any
+// other top-level fields are copied to each of the resulting objects.
+func splitCustomPayload(body []byte, alertsField string) ([]map[string]interface{}, error) {
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, err
+	}
+
+	value, ok := lookupField(payload, alertsField)
+	if !ok {
+		return nil, fmt.Errorf("Payload field '%s' is missing", alertsField)
+	}
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Payload field '%s' is not a list", alertsField)
+	}
+
+	var alerts []map[string]interface{}
+	for _, item := range items {
+		alertData := make(map[string]interface{}, len(payload))
+		for k, v := range payload {
+			alertData[k] = v
+		}
+		if err := setField(alertData, alertsField, []interface{}{item}); err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, alertData)
+	}
+	return alerts, nil
+}
+
+// Look up a dot-separated field in a JSON object.
+func lookupField(data map[string]interface{}, field string) (interface{}, bool) {
+	var value interface{} = data
+	for _, key := range strings.Split(field, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		value, ok = object[key]
+		if !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// Set a dot-separated field in a JSON object, copying any intermediate objects so that the
+// original data is left untouched.
+func setField(data map[string]interface{}, field string, value interface{}) error {
+	keys := strings.Split(field, ".")
+	object := data
+	for _, key := range keys[:len(keys)-1] {
+		child, ok := object[key].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("Payload field '%s' is not a JSON object", key)
+		}
+		childCopy := make(map[string]interface{}, len(child))
+		for k, v := range child {
+			childCopy[k] = v
+		}
+		object[key] = childCopy
+		object = childCopy
+	}
+	object[keys[len(keys)-1]] = value
+	return nil
+}
+
+// Convert a struct into a generic JSON object.
+func toMap(v interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Extract the labels of an alert, looking at the first alert of Alertmanager-like payloads and
+// falling back to top-level labels.
+func alertLabels(data map[string]interface{}) map[string]string {
+	labels := make(map[string]string)
+	for _, field := range []string{"commonLabels", "labels"} {
+		if value, ok := data[field].(map[string]interface{}); ok {
+			copyStringValues(labels, value)
+		}
+	}
+	if alerts, ok := data["alerts"].([]interface{}); ok && len(alerts) > 0 {
+		if alert, ok := alerts[0].(map[string]interface{}); ok {
+			if value, ok := alert["labels"].(map[string]interface{}); ok {
+				copyStringValues(labels, value)
+			}
+		}
+	}
+	return labels
+}
+
+// Copy the string values of a JSON object into a map.
+func copyStringValues(dst map[string]string, src map[string]interface{}) {
+	for k, v := range src {
+		if s, ok := v.(string); ok {
+			dst[k] = s
+		}
+	}
+}
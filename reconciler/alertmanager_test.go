@@ -0,0 +1,181 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var alertmanagerPayload = `{
+	"version": "4",
+	"groupKey": "{}:{alertname=\"HighErrorRate\"}",
+	"status": "firing",
+	"receiver": "euphrosyne",
+	"groupLabels": {"alertname": "HighErrorRate"},
+	"commonLabels": {"alertname": "HighErrorRate", "severity": "critical"},
+	"commonAnnotations": {"summary": "High error rate"},
+	"externalURL": "http://alertmanager:9093",
+	"alerts": [
+		{
+			"status": "firing",
+			"labels": {"alertname": "HighErrorRate", "pod": "web-1"},
+			"fingerprint": "a1"
+		},
+		{
+			"status": "resolved",
+			"labels": {"alertname": "HighErrorRate", "pod": "web-2"},
+			"fingerprint": "a2"
+		},
+		{
+			"status": "firing",
+			"labels": {"alertname": "HighErrorRate", "pod": "web-3"},
+			"fingerprint": "a3"
+		}
+	]
+}`
+
+// Test that webhook payloads are split according to the configured schema.
+func TestSplitAlertPayload(t *testing.T) {
+	testCases := []struct {
+		name          string
+		config        Config
+		body          string
+		expectedCount int
+		expectError   bool
+	}{
+		{
+			name:          "RawPayload",
+			config:        Config{PayloadSchema: RawPayloadSchema},
+			body:          alertmanagerPayload,
+			expectedCount: 1,
+		},
+		{
+			name:          "AlertmanagerPayload",
+			config:        Config{PayloadSchema: AlertmanagerPayloadSchema},
+			body:          alertmanagerPayload,
+			expectedCount: 2,
+		},
+		{
+			name:        "AlertmanagerPayloadWithoutAlerts",
+			config:      Config{PayloadSchema: AlertmanagerPayloadSchema},
+			body:        `{"status": "firing", "alerts": []}`,
+			expectError: true,
+		},
+		{
+			name: "CustomPayload",
+			config: Config{
+				PayloadSchema:      CustomPayloadSchema,
+				PayloadAlertsField: "event.items",
+			},
+			body:          `{"source": "x", "event": {"items": [{"id": 1}, {"id": 2}]}}`,
+			expectedCount: 2,
+		},
+		{
+			name: "CustomPayloadMissingField",
+			config: Config{
+				PayloadSchema:      CustomPayloadSchema,
+				PayloadAlertsField: "alerts",
+			},
+			body:        `{"source": "x"}`,
+			expectError: true,
+		},
+		{
+			name:        "InvalidJSON",
+			config:      Config{PayloadSchema: RawPayloadSchema},
+			body:        `{`,
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			alerts, err := splitAlertPayload([]byte(tc.body), &tc.config)
+			if tc.expectError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedCount, len(alerts))
+		})
+	}
+}
+
+// Test that fanned out Alertmanager alerts keep the group level information.
+func TestSplitAlertmanagerPayload(t *testing.T) {
+	alerts, err := splitAlertmanagerPayload([]byte(alertmanagerPayload))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(alerts))
+
+	for i, pod := range []string{"web-1", "web-3"} {
+		assert.Equal(t, "firing", alerts[i]["status"])
+		assert.Equal(
+			t, map[string]interface{}{"alertname": "HighErrorRate"}, alerts[i]["groupLabels"],
+		)
+		assert.Equal(
+			t, map[string]interface{}{"summary": "High error rate"}, alerts[i]["commonAnnotations"],
+		)
+
+		items := alerts[i]["alerts"].([]interface{})
+		assert.Equal(t, 1, len(items))
+		labels := items[0].(map[string]interface{})["labels"].(map[string]interface{})
+		assert.Equal(t, pod, labels["pod"])
+	}
+}
+
+// Test that the resolved Alertmanager alerts are fanned out separately.
+func TestSplitResolvedAlertmanagerPayload(t *testing.T) {
+	alerts, err := splitResolvedAlertmanagerPayload([]byte(alertmanagerPayload))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(alerts))
+	assert.Equal(t, "resolved", alerts[0]["status"])
+	assert.Equal(t, "web-2", alertLabels(alerts[0])["pod"])
+}
+
+// Test that the custom payload items are copied without altering the original payload.
+func TestSplitCustomPayload(t *testing.T) {
+	body := `{"source": "x", "event": {"items": [{"id": 1}, {"id": 2}]}}`
+	alerts, err := splitCustomPayload([]byte(body), "event.items")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(alerts))
+
+	for i, id := range []float64{1, 2} {
+		assert.Equal(t, "x", alerts[i]["source"])
+		items, ok := lookupField(alerts[i], "event.items")
+		assert.True(t, ok)
+		assert.Equal(t, []interface{}{map[string]interface{}{"id": id}}, items)
+	}
+}
+
+// Test that the fields reserved to the Reconciler are dropped from received alerts, whatever the
+// payload schema.
+func TestSplitAlertPayloadReservedFields(t *testing.T) {
+	testCases := []struct {
+		name  string
+		field string
+		value string
+	}{
+		{"NodeProblems", nodeProblemsField, `[{"type": "KernelDeadlock"}]`},
+		{"NodeProblemRecipes", nodeProblemRecipesField, `["drain-node"]`},
+		{"Verification", verificationField, `{"incident": "x", "recipes": ["smoke-test"]}`},
+		{"ScheduledRun", scheduledRunField, `{"recipe": "capacity"}`},
+		{"Route", routeField, `{"name": "remediation", "recipes": ["restart-pod"]}`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			payloads := map[string]string{
+				RawPayloadSchema: `{"alertname": "HighErrorRate", "` + tc.field + `": ` +
+					tc.value + `}`,
+				CustomPayloadSchema: `{"` + tc.field + `": ` + tc.value +
+					`, "alerts": [{"alertname": "HighErrorRate"}]}`,
+			}
+			for schema, body := range payloads {
+				config := &Config{PayloadSchema: schema, PayloadAlertsField: "alerts"}
+				alerts, err := splitAlertPayload([]byte(body), config)
+				assert.NoError(t, err)
+				assert.Equal(t, 1, len(alerts))
+				assert.NotContains(t, alerts[0], tc.field, schema)
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+const approvalKeyPrefix = "euphrosyne:approval:"
+
+// How long approval records are kept after they expire.
+const approvalRetention = 24 * time.Hour
+
+// Approval states.
+const (
+	ApprovalStatePending  = "pending"
+	ApprovalStateApproved = "approved"
+	ApprovalStateDenied   = "denied"
+	ApprovalStateExpired  = "expired"
+)
+
+var (
+	errApprovalNotFound = errors.New("Approval not found")
+	errApprovalDecided  = errors.New("Approval has already been decided")
+)
+
+// Replace an approval record only if it has not changed since it was read.
+var compareAndSetScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	redis.call("SET", KEYS[1], ARGV[2], "KEEPTTL")
+	return 1
+end
+return 0
+`)
+
+// Approval tracks the decision on the action recipes requested for an incident.
+type Approval struct {
+	UUID        string     `json:"uuid"`
+	State       string     `json:"state"`
+	Actions     []string   `json:"actions"`
+	RequestedAt time.Time  `json:"requestedAt"`
+	ExpiresAt   time.Time  `json:"expiresAt"`
+	DecidedAt   *time.Time `json:"decidedAt,omitempty"`
+	DecidedBy   string     `json:"decidedBy,omitempty"`
+	Reason      string     `json:"reason,omitempty"`
+}
+
+// Request approval for the actions of an incident and wait for a decision, until the approval
+// window expires. Returns whether the actions were approved.
+func awaitApproval(ctx context.Context, config *Config, data *map[string]interface{}) bool {
+	uuid := (*data)["uuid"].(string)
+
+	actions, err := parseActionData(data)
+	if err != nil {
+		logger.Error("Failed to parse actions", zap.Error(err))
+		return false
+	}
+	actionNames := make([]string, 0, len(actions))
+	for _, action := range actions {
+		actionNames = append(actionNames, action.Name)
+	}
+
+	// Subscribe before publishing the record, so that no decision can be missed
+	pubsub := rdb.Subscribe(ctx, approvalKeyPrefix+uuid)
+	defer pubsub.Close()
+	if _, err := pubsub.Receive(ctx); err != nil {
+		logger.Error("Failed to subscribe to approval channel", zap.Error(err))
+		return false
+	}
+
+	window := config.ApprovalTimeout
+	now := time.Now().UTC()
+	approval := &Approval{
+		UUID:        uuid,
+		State:       ApprovalStatePending,
+		Actions:     actionNames,
+		RequestedAt: now,
+		ExpiresAt:   now.Add(window),
+	}
+	if err := saveApproval(ctx, approval, window+approvalRetention); err != nil {
+		logger.Error("Failed to store approval request", zap.Error(err))
+		return false
+	}
+	incidentRegistry.ApprovalUpdated(uuid, approval)
+	logger.Info(
+		"Waiting for approval of actions",
+		zap.String("uuid", uuid),
+		zap.Strings("actions", actionNames),
+		zap.Duration("window", window),
+	)
+
+	if config.ApprovalWebhook != "" {
+		if err := postApprovalRequest(config.ApprovalWebhook, approval); err != nil {
+			logger.Error("Failed to post approval request", zap.Error(err))
+		}
+	}
+
+	timeout := time.NewTimer(window)
+	defer timeout.Stop()
+	select {
+	case <-pubsub.Channel():
+	case <-ctx.Done():
+		logger.Info("Execution cancelled while awaiting approval", zap.String("uuid", uuid))
+		return false
+	case <-timeout.C:
+		_, err := decideApproval(ctx, uuid, ApprovalStateExpired, "", "Approval window expired")
+		if err != nil && !errors.Is(err, errApprovalDecided) {
+			logger.Error("Failed to expire approval", zap.Error(err))
+		}
+	}
+
+	approval, err = loadApproval(ctx, uuid)
+	if err != nil {
+		logger.Error("Failed to load approval", zap.Error(err))
+		return false
+	}
+	logger.Info(
+		"Approval decided",
+		zap.String("uuid", uuid),
+		zap.String("state", approval.State),
+		zap.String("decidedBy", approval.DecidedBy),
+	)
+	return approval.State == ApprovalStateApproved
+}
+
+// Record a decision on a pending approval and notify the reconciler waiting for it.
+func decideApproval(
+	ctx context.Context, uuid string, state string, user string, reason string,
+) (*Approval, error) {
+	key := approvalKeyPrefix + uuid
+	current, err := rdb.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return nil, errApprovalNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var approval Approval
+	if err := json.Unmarshal([]byte(current), &approval); err != nil {
+		return nil, err
+	}
+	if approval.State != ApprovalStatePending {
+		return &approval, errApprovalDecided
+	}
+
+	now := time.Now().UTC()
+	approval.State = state
+	approval.DecidedAt = &now
+	approval.DecidedBy = user
+	approval.Reason = reason
+	updated, err := json.Marshal(approval)
+	if err != nil {
+		return nil, err
+	}
+
+	swapped, err := compareAndSetScript.Run(ctx, rdb, []string{key}, current, updated).Int()
+	if err != nil {
+		return nil, err
+	}
+	if swapped == 0 {
+		return nil, errApprovalDecided
+	}
+
+	incidentRegistry.ApprovalUpdated(uuid, &approval)
+	if err := rdb.Publish(ctx, key, state).Err(); err != nil {
+		return nil, err
+	}
+	return &approval, nil
+}
+
+// Store an approval record in Redis.
+func saveApproval(ctx context.Context, approval *Approval, ttl time.Duration) error {
+	data, err := json.Marshal(approval)
+	if err != nil {
+		return err
+	}
+	return rdb.Set(ctx, approvalKeyPrefix+approval.UUID, data, ttl).Err()
+}
+
+// Load an approval record from Redis.
+func loadApproval(ctx context.Context, uuid string) (*Approval, error) {
+	data, err := rdb.Get(ctx, approvalKeyPrefix+uuid).Bytes()
+	if err == redis.Nil {
+		return nil, errApprovalNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var approval Approval
+	if err := json.Unmarshal(data, &approval); err != nil {
+		return nil, err
+	}
+	return &approval, nil
+}
+
+// Post an approval request to the configured webhook (e.g. a Slack incoming webhook).
+func postApprovalRequest(url string, approval *Approval) error {
+	incidentRegistry.RecordMessage(approval.UUID, ApprovalDestination, approval)
+	incident, _ := incidentRegistry.Get(approval.UUID)
+
+	// Render the message using the configured template
+	jsonData, err := renderMessage(ApprovalDestination, approval, incident)
+	if err != nil {
+		return err
+	}
+
+	resp, err := httpc.Post(url, "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Unexpected response status: %s", resp.Status)
+	}
+	return nil
+}
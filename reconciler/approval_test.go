@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that action recipes only run once approved, and that approvals expire.
+func TestAwaitApproval(t *testing.T) {
+	tests := []struct {
+		name     string
+		uuid     string
+		decision string
+		expected bool
+	}{
+		{name: "Approved", uuid: "approval-1", decision: ApprovalStateApproved, expected: true},
+		{name: "Denied", uuid: "approval-2", decision: ApprovalStateDenied, expected: false},
+		{name: "Expired", uuid: "approval-3", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			config := &Config{ApprovalTimeout: time.Second}
+			data := map[string]interface{}{
+				"uuid": tt.uuid,
+				"actions": []interface{}{
+					map[string]interface{}{"name": "jira", "data": map[string]interface{}{}},
+				},
+			}
+			incidentRegistry.Register(tt.uuid, Actions)
+			defer rdb.Del(ctx, approvalKeyPrefix+tt.uuid)
+
+			result := make(chan bool)
+			go func() { result <- awaitApproval(ctx, config, &data) }()
+
+			assert.Eventually(t, func() bool {
+				incident, ok := incidentRegistry.Get(tt.uuid)
+				return ok && incident.State == IncidentStatePendingApproval
+			}, time.Second, 10*time.Millisecond)
+
+			if tt.decision != "" {
+				approval, err := decideApproval(ctx, tt.uuid, tt.decision, "jdoe", "")
+				assert.Nil(t, err)
+				assert.Equal(t, []string{"jira"}, approval.Actions)
+			}
+			assert.Equal(t, tt.expected, <-result)
+
+			// Decisions are final
+			_, err := decideApproval(ctx, tt.uuid, ApprovalStateApproved, "jdoe", "")
+			assert.ErrorIs(t, err, errApprovalDecided)
+
+			incident, _ := incidentRegistry.Get(tt.uuid)
+			if tt.decision != "" {
+				assert.Equal(t, tt.decision, incident.Approval.State)
+			} else {
+				assert.Equal(t, ApprovalStateExpired, incident.Approval.State)
+			}
+		})
+	}
+
+	_, err := decideApproval(context.Background(), "approval-4", ApprovalStateApproved, "", "")
+	assert.ErrorIs(t, err, errApprovalNotFound)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Actions recorded in the audit log.
+const (
+	AuditIncidentRegistered   = "incident.registered"
+	AuditIncidentCompleted    = "incident.completed"
+	AuditIncidentCancelled    = "incident.cancelled"
+	AuditIncidentFailed       = "incident.failed"
+	AuditIncidentClosed       = "incident.closed"
+	AuditRecipeLaunched       = "recipe.launched"
+	AuditRecipeFailed         = "recipe.failed"
+	AuditRecipeFinished       = "recipe.finished"
+	AuditRecipesTimedOut      = "recipes.timedOut"
+	AuditCleanupFinished      = "cleanup.finished"
+	AuditCatalogLoaded        = "catalog.loaded"
+	AuditApprovalUpdated      = "approval.updated"
+	AuditExecutionRecovered   = "execution.recovered"
+	AuditLegalHoldPlaced      = "legalHold.placed"
+	AuditLegalHoldReleased    = "legalHold.released"
+	AuditAckUpdated           = "ack.updated"
+	AuditDebugSessionCreated  = "debugSession.created"
+	AuditDebugSessionDeleted  = "debugSession.deleted"
+	AuditComplianceViolated   = "compliance.violated"
+	AuditBatchCleanupFinished = "batchCleanup.finished"
+)
+
+// Maximum number of audit events kept in memory until they are exported.
+const maxAuditEvents = 10000
+
+// AuditEvent records an action taken by the reconciler.
+type AuditEvent struct {
+	Timestamp time.Time              `json:"timestamp"`
+	Action    string                 `json:"action"`
+	Incident  string                 `json:"incident,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+// AuditLog collects the audit events of the reconciler, until they are drained by the exporter.
+type AuditLog struct {
+	mutex   sync.Mutex
+	events  []AuditEvent
+	dropped int
+}
+
+var auditLog = &AuditLog{}
+
+// Record an audit event.
+func (al *AuditLog) Record(action string, incident string, details map[string]interface{}) {
+	event := AuditEvent{
+		Timestamp: time.Now().UTC(),
+		Action:    action,
+		Incident:  incident,
+		Details:   details,
+	}
+	logger.Info(
+		"Audit event",
+		zap.String("action", action),
+		zap.String("incident", incident),
+		zap.Any("details", details),
+	)
+
+	// Events of incidents are also streamed to the clients following their progress, and
+	// recorded as Kubernetes Events and emitted as CloudEvents if enabled
+	if incident != "" {
+		incidentStreams.Publish(event)
+		if incidentEvents != nil {
+			incidentEvents.Record(event)
+		}
+		if cloudEvents != nil {
+			cloudEvents.Emit(event)
+		}
+	}
+
+	al.mutex.Lock()
+	defer al.mutex.Unlock()
+	if len(al.events) >= maxAuditEvents {
+		al.events = al.events[1:]
+		al.dropped++
+	}
+	al.events = append(al.events, event)
+}
+
+// Remove and return all the collected audit events, along with the number of events that were
+// dropped because the buffer was full.
+func (al *AuditLog) Drain() ([]AuditEvent, int) {
+	al.mutex.Lock()
+	defer al.mutex.Unlock()
+	events, dropped := al.events, al.dropped
+	al.events, al.dropped = nil, 0
+	return events, dropped
+}
+
+// Put back events that could not be exported, so that they are retried on the next export.
+func (al *AuditLog) Restore(events []AuditEvent) {
+	al.mutex.Lock()
+	defer al.mutex.Unlock()
+	al.events = append(events, al.events...)
+	if overflow := len(al.events) - maxAuditEvents; overflow > 0 {
+		al.events = al.events[overflow:]
+		al.dropped += overflow
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Supported authentication modes for the endpoints of the reconciler.
+const (
+	TokenAuthMode = "token"
+	HMACAuthMode  = "hmac"
+	MTLSAuthMode  = "mtls"
+)
+
+// Header carrying the HMAC signature of the request body.
+const signatureHeader = "X-Signature"
+
+// Key of the gin context holding the identity a request was authenticated as, and the identity of
+// unauthenticated requests.
+const (
+	identityContextKey = "identity"
+	anonymousIdentity  = "anonymous"
+)
+
+// Parse a comma-separated list of authentication modes.
+func parseAuthModes(modes string) ([]string, error) {
+	var authModes []string
+	for _, mode := range strings.Split(modes, ",") {
+		mode = strings.TrimSpace(mode)
+		switch mode {
+		case "":
+			continue
+		case TokenAuthMode, HMACAuthMode, MTLSAuthMode:
+			authModes = append(authModes, mode)
+		default:
+			return nil, fmt.Errorf("Unsupported authentication mode '%s'", mode)
+		}
+	}
+	return authModes, nil
+}
+
+// Check that the settings required by the authentication modes of an endpoint are provided.
+func validateAuthModes(modes string, config *Config) error {
+	authModes, err := parseAuthModes(modes)
+	if err != nil {
+		return err
+	}
+	for _, mode := range authModes {
+		switch {
+		case mode == TokenAuthMode && config.AuthToken == "":
+			return fmt.Errorf("An authentication token is required for '%s'", mode)
+		case mode == HMACAuthMode && config.HMACSecret == "":
+			return fmt.Errorf("An HMAC secret is required for '%s'", mode)
+		case mode == MTLSAuthMode && (config.TLSCert == "" || config.TLSClientCA == ""):
+			return fmt.Errorf("A TLS certificate and a client CA are required for '%s'", mode)
+		}
+	}
+	return nil
+}
+
+// Authenticate the requests to an endpoint with each of the configured modes, rejecting the ones
+// that fail any of them before they are handled.
+func authenticate(config *Config, endpoint string, modes string) gin.HandlerFunc {
+	// The modes are validated along with the rest of the configuration
+	authModes, _ := parseAuthModes(modes)
+	return func(c *gin.Context) {
+		for _, mode := range authModes {
+			if err := checkAuthMode(c, config, mode); err != nil {
+				logger.Warn(
+					"Rejecting unauthenticated request",
+					zap.String("endpoint", endpoint),
+					zap.String("mode", mode),
+					zap.String("remoteAddr", c.ClientIP()),
+					zap.Error(err),
+				)
+				authFailures.WithLabelValues(endpoint, mode).Inc()
+				respondProblem(c, http.StatusUnauthorized, UnauthorizedProblem, "")
+				return
+			}
+		}
+		if identity := authIdentity(c, authModes); identity != "" {
+			c.Set(identityContextKey, identity)
+		}
+		c.Next()
+	}
+}
+
+// Identify the client an authenticated request was sent by, i.e. the common name of its verified
+// client certificate or, as shared secrets do not tell clients apart, the mode it passed.
+func authIdentity(c *gin.Context, authModes []string) string {
+	if c.Request.TLS != nil && len(c.Request.TLS.VerifiedChains) > 0 {
+		if name := c.Request.TLS.VerifiedChains[0][0].Subject.CommonName; name != "" {
+			return name
+		}
+	}
+	if len(authModes) > 0 {
+		return authModes[0]
+	}
+	return ""
+}
+
+// Return the identity a request was authenticated as, for the audit trail.
+func requestIdentity(c *gin.Context) string {
+	if identity := c.GetString(identityContextKey); identity != "" {
+		return identity
+	}
+	return anonymousIdentity
+}
+
+// Check that a request carries the expected token with the Bearer scheme. No token is valid when
+// none is expected.
+func validBearerToken(c *gin.Context, expected string) bool {
+	token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	return ok && expected != "" &&
+		subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
+
+// Check a request against a single authentication mode.
+func checkAuthMode(c *gin.Context, config *Config, mode string) error {
+	switch mode {
+	case TokenAuthMode:
+		if !validBearerToken(c, config.AuthToken) {
+			return fmt.Errorf("Invalid bearer token")
+		}
+	case HMACAuthMode:
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			return err
+		}
+		// Restore the body for the handler
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		if !validSignature(c.GetHeader(signatureHeader), body, config.HMACSecret) {
+			return fmt.Errorf("Invalid %s header", signatureHeader)
+		}
+	case MTLSAuthMode:
+		if c.Request.TLS == nil || len(c.Request.TLS.VerifiedChains) == 0 {
+			return fmt.Errorf("No verified client certificate")
+		}
+	}
+	return nil
+}
+
+// Verify the HMAC-SHA256 signature of a request body, optionally prefixed with the algorithm
+// (e.g. "sha256=<hex>").
+func validSignature(signature string, body []byte, secret string) bool {
+	signature = strings.TrimPrefix(signature, "sha256=")
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// Run a gin router on the provided address, serving TLS if a certificate is configured. Client
+// certificates are requested and verified against the client CA, if one is configured, so that
+// endpoints can require mTLS.
+func runRouter(router *gin.Engine, addr string, config *Config) error {
+	if config.TLSCert == "" {
+		return router.Run(addr)
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if config.TLSClientCA != "" {
+		caCert, err := os.ReadFile(config.TLSClientCA)
+		if err != nil {
+			return err
+		}
+		clientCAs := x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(caCert) {
+			return fmt.Errorf("Failed to parse client CA '%s'", config.TLSClientCA)
+		}
+		tlsConfig.ClientCAs = clientCAs
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	server := &http.Server{Addr: addr, Handler: router, TLSConfig: tlsConfig}
+	return server.ListenAndServeTLS(config.TLSCert, config.TLSKey)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that requests are only handled if they pass every configured authentication mode.
+func TestAuthenticate(t *testing.T) {
+	config := &Config{AuthToken: "s3cr3t", HMACSecret: "hmac-s3cr3t"}
+	body := `{"alertname": "HighErrorRate"}`
+	mac := hmac.New(sha256.New, []byte(config.HMACSecret))
+	mac.Write([]byte(body))
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	tests := []struct {
+		name     string
+		modes    string
+		headers  map[string]string
+		expected int
+	}{
+		{name: "NoAuth", modes: "", expected: http.StatusOK},
+		{name: "MissingToken", modes: "token", expected: http.StatusUnauthorized},
+		{
+			name:     "InvalidToken",
+			modes:    "token",
+			headers:  map[string]string{"Authorization": "Bearer wrong"},
+			expected: http.StatusUnauthorized,
+		},
+		{
+			name:     "ValidToken",
+			modes:    "token",
+			headers:  map[string]string{"Authorization": "Bearer s3cr3t"},
+			expected: http.StatusOK,
+		},
+		{
+			name:     "InvalidSignature",
+			modes:    "hmac",
+			headers:  map[string]string{"X-Signature": "sha256=abcdef"},
+			expected: http.StatusUnauthorized,
+		},
+		{
+			name:     "ValidSignature",
+			modes:    "hmac",
+			headers:  map[string]string{"X-Signature": signature},
+			expected: http.StatusOK,
+		},
+		{
+			name:     "TokenAndInvalidSignature",
+			modes:    "token,hmac",
+			headers:  map[string]string{"Authorization": "Bearer s3cr3t"},
+			expected: http.StatusUnauthorized,
+		},
+		{name: "MissingClientCertificate", modes: "mtls", expected: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			handler := func(c *gin.Context) {
+				// The body is still available to the handler
+				received, _ := io.ReadAll(c.Request.Body)
+				assert.Equal(t, body, string(received))
+				c.Status(http.StatusOK)
+			}
+			router.POST("/webhook", authenticate(config, "webhook", tt.modes), handler)
+
+			req := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(body))
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.expected, w.Code)
+		})
+	}
+}
+
+// Test that requests are attributed to the common name of their verified client certificate, or
+// to the mode they were authenticated with.
+func TestRequestIdentity(t *testing.T) {
+	config := &Config{AuthToken: "s3cr3t", TLSCert: "cert", TLSClientCA: "ca"}
+	tests := []struct {
+		name     string
+		modes    string
+		token    string
+		client   string
+		expected string
+	}{
+		{name: "NoAuth", expected: anonymousIdentity},
+		{name: "Token", modes: "token", token: "s3cr3t", expected: TokenAuthMode},
+		{name: "ClientCertificate", modes: "mtls", client: "alice", expected: "alice"},
+		{
+			name: "TokenAndClientCertificate", modes: "token,mtls", token: "s3cr3t",
+			client: "alice", expected: "alice",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.POST("/debug", authenticate(config, "api", tt.modes), func(c *gin.Context) {
+				c.String(http.StatusOK, requestIdentity(c))
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/debug", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			if tt.client != "" {
+				certificate := &x509.Certificate{Subject: pkix.Name{CommonName: tt.client}}
+				req.TLS = &tls.ConnectionState{
+					VerifiedChains: [][]*x509.Certificate{{certificate}},
+				}
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.expected, w.Body.String())
+		})
+	}
+}
+
+// Test that the settings required by the authentication modes are validated.
+func TestValidateAuthModes(t *testing.T) {
+	assert.Nil(t, validateAuthModes("", &Config{}))
+	assert.Nil(t, validateAuthModes("token, hmac", &Config{AuthToken: "a", HMACSecret: "b"}))
+	assert.NotNil(t, validateAuthModes("basic", &Config{}))
+	assert.NotNil(t, validateAuthModes("token", &Config{}))
+	assert.NotNil(t, validateAuthModes("hmac", &Config{AuthToken: "a"}))
+	assert.NotNil(t, validateAuthModes("mtls", &Config{TLSCert: "tls.crt"}))
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Number of alert payloads of a batch admitted at the same time.
+const batchConcurrency = 8
+
+// Outcome of the verification of a resolved alert received in a batch.
+const AlertVerifying = "verifying"
+
+// BatchAlertResult reports the outcome of an alert received in a batch. Payloads rejected as a
+// whole, e.g. because they are invalid, are reported as a single rejected alert.
+type BatchAlertResult struct {
+	// Position of the payload of the alert in the batch
+	Index  int    `json:"index"`
+	Status string `json:"status"`
+	// Incident of the alert, i.e. the active incident for suppressed alerts
+	Incident string   `json:"incident,omitempty"`
+	Error    *Problem `json:"error,omitempty"`
+}
+
+// Map the error an alert was rejected with to the problem reported for it.
+func admissionProblem(err error) Problem {
+	switch {
+	case errors.Is(err, errShuttingDown):
+		return newProblem(http.StatusServiceUnavailable, ShuttingDownProblem, err.Error())
+	case errors.Is(err, errIntakePaused):
+		return newProblem(http.StatusServiceUnavailable, IntakePausedProblem, err.Error())
+	default:
+		return newProblem(http.StatusTooManyRequests, QueueFullProblem, err.Error())
+	}
+}
+
+// Handle a batch of alert payloads, each of which is handled as if it was received on the webhook
+// on its own. The payloads are admitted concurrently, and the outcome of each alert is reported,
+// so that the sender only has to retry the rejected ones.
+func handleBatchWebhook(c *gin.Context, config *Config) {
+	var payloads []json.RawMessage
+	if err := c.ShouldBindJSON(&payloads); err != nil {
+		logger.Error("Failed to parse JSON", zap.Error(err))
+		respondProblem(
+			c, http.StatusBadRequest, InvalidRequestProblem, "Expected an array of alert payloads",
+		)
+		return
+	}
+	if len(payloads) == 0 {
+		respondProblem(c, http.StatusBadRequest, InvalidRequestProblem, "The batch is empty")
+		return
+	}
+	if len(payloads) > config.MaxBatchSize {
+		respondProblem(
+			c, http.StatusRequestEntityTooLarge, InvalidRequestProblem,
+			fmt.Sprintf("Batches are limited to %d alert payloads", config.MaxBatchSize),
+		)
+		return
+	}
+
+	results := make([][]BatchAlertResult, len(payloads))
+	slots := make(chan struct{}, batchConcurrency)
+	var wg sync.WaitGroup
+	for i, payload := range payloads {
+		wg.Add(1)
+		go func(i int, payload []byte) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			results[i] = admitBatchPayload(c, i, payload, config)
+		}(i, payload)
+	}
+	wg.Wait()
+
+	flattened := []BatchAlertResult{}
+	summary := map[string]int{AlertAccepted: 0, AlertSuppressed: 0, AlertRejected: 0}
+	for _, payloadResults := range results {
+		for _, result := range payloadResults {
+			flattened = append(flattened, result)
+			summary[result.Status]++
+			batchAlerts.WithLabelValues(result.Status).Inc()
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"results": flattened, "summary": summary})
+}
+
+// Admit the alerts of a payload received in a batch, along with the verifications of its resolved
+// alerts, reporting the outcome of each.
+func admitBatchPayload(
+	c *gin.Context, index int, payload []byte, config *Config,
+) []BatchAlertResult {
+	alerts, problem := parseAlertPayload(payload, config, requestAuthModes(c, config.WebhookAuth))
+	if problem != nil {
+		return []BatchAlertResult{{Index: index, Status: AlertRejected, Error: problem}}
+	}
+
+	var results []BatchAlertResult
+	for _, alertData := range alerts {
+		outcome, uuid, err := admitAlert(c, alertData, config)
+		result := BatchAlertResult{Index: index, Status: outcome, Incident: uuid}
+		if err != nil {
+			problem := admissionProblem(err)
+			result.Error = &problem
+		}
+		results = append(results, result)
+	}
+
+	// Resolved alerts run the verification recipes of their incidents, if any
+	if config.PayloadSchema == AlertmanagerPayloadSchema {
+		resolved, _ := splitResolvedAlertmanagerPayload(payload)
+		for _, alertData := range resolved {
+			if uuid, ok := submitVerification(c.Request.Context(), alertData, config); ok {
+				results = append(results, BatchAlertResult{
+					Index: index, Status: AlertVerifying, Incident: uuid,
+				})
+			}
+		}
+	}
+	return results
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that each alert of a batch is admitted on its own, reporting the alerts rejected by the
+// concurrency limits or for being invalid.
+func TestHandleBatchWebhook(t *testing.T) {
+	config := &Config{
+		Workers:                 10,
+		MaxConcurrentExecutions: 2,
+		QueueOverflow:           RejectQueueOverflow,
+		MaxBatchSize:            4,
+	}
+	queue := executionQueue
+	defer func() { executionQueue = queue }()
+	q, _, release := newTestQueue(config)
+	defer close(release)
+	executionQueue = q
+
+	router := gin.New()
+	router.POST("/webhook/batch", func(c *gin.Context) { handleBatchWebhook(c, config) })
+
+	tests := []struct {
+		name     string
+		body     string
+		status   int
+		expected map[string]int
+	}{
+		{
+			name:     "Batch",
+			body:     `[{"alertname": "a"}, {"alertname": "b"}, {"alertname": "c"}, "invalid"]`,
+			status:   http.StatusOK,
+			expected: map[string]int{AlertAccepted: 2, AlertSuppressed: 0, AlertRejected: 2},
+		},
+		{name: "NotArray", body: `{"alertname": "a"}`, status: http.StatusBadRequest},
+		{name: "Empty", body: `[]`, status: http.StatusBadRequest},
+		{name: "TooLarge", body: `[{}, {}, {}, {}, {}]`, status: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(
+				http.MethodPost, "/webhook/batch", strings.NewReader(tt.body),
+			))
+			assert.Equal(t, tt.status, w.Code)
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Results []BatchAlertResult `json:"results"`
+				Summary map[string]int     `json:"summary"`
+			}
+			assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, tt.expected, response.Summary)
+			assert.Len(t, response.Results, 4)
+			for i, result := range response.Results {
+				assert.Equal(t, i, result.Index)
+				switch result.Status {
+				case AlertAccepted:
+					assert.NotEmpty(t, result.Incident)
+					assert.Nil(t, result.Error)
+				case AlertRejected:
+					assert.Empty(t, result.Incident)
+					assert.NotNil(t, result.Error)
+				}
+			}
+			// The invalid payload is rejected as a whole
+			assert.Equal(t, InvalidAlertProblem, response.Results[3].Error.Code)
+		})
+	}
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// Minimum age of the resources removed by the batch cleanup, unless set otherwise
+	defaultBatchCleanupAge = 72 * time.Hour
+	// Timeout of the batch cleanup requested through the admin API
+	batchCleanupTimeout = 5 * time.Minute
+)
+
+// Kinds of the resources removed by the batch cleanup.
+const (
+	JobResourceKind       = "Job"
+	ConfigMapResourceKind = "ConfigMap"
+)
+
+// BatchCleanupFilter selects the resources of past executions to remove.
+type BatchCleanupFilter struct {
+	// Minimum age of the resources
+	OlderThan  Duration `json:"olderThan"`
+	Namespaces []string `json:"namespaces"`
+	// Execution the resources belong to, all executions if empty
+	UUID string `json:"uuid,omitempty"`
+	// Whether the resources retained after the cleanup of their execution are removed as well
+	IncludeRetained bool `json:"includeRetained"`
+	// Whether the resources are only listed, rather than removed
+	DryRun bool `json:"dryRun"`
+}
+
+// CleanupCandidate is a resource of a past execution matching the filter of the batch cleanup.
+type CleanupCandidate struct {
+	Kind      string    `json:"kind"`
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	UUID      string    `json:"uuid"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Error removing the resource, if any
+	Error string `json:"error,omitempty"`
+}
+
+// BatchCleanupReport summarises a batch cleanup.
+type BatchCleanupReport struct {
+	DryRun     bool               `json:"dryRun"`
+	Cutoff     time.Time          `json:"cutoff"`
+	Namespaces []string           `json:"namespaces"`
+	Resources  []CleanupCandidate `json:"resources"`
+	// Number of resources removed, or that would be removed on a dry run, by kind
+	Deleted map[string]int `json:"deleted"`
+	Failed  int            `json:"failed"`
+	// Number of matching resources left in place, as their execution is active or held
+	Skipped int `json:"skipped"`
+}
+
+// BatchCleanup removes the resources that past executions left behind, e.g. the Jobs and
+// ConfigMaps leaked by earlier versions of the reconciler.
+type BatchCleanup struct {
+	client kubernetes.Interface
+	// Whether the resources of an execution must be left in place
+	skip func(uuid string) bool
+}
+
+// Initialise a batch cleanup, leaving in place the resources of the executions to skip, if any.
+func NewBatchCleanup(client kubernetes.Interface, skip func(uuid string) bool) *BatchCleanup {
+	if skip == nil {
+		skip = func(string) bool { return false }
+	}
+	return &BatchCleanup{client: client, skip: skip}
+}
+
+// Build the label selector of the resources of past executions. Resources of other components,
+// such as debugging sessions, follow their own lifecycle and are left out.
+func batchCleanupLabelSelector(filter BatchCleanupFilter) string {
+	labels := map[string]string{"app": "euphrosyne"}
+	if filter.UUID != "" {
+		labels["uuid"] = filter.UUID
+	}
+	selector := &metav1.LabelSelector{
+		MatchLabels: labels,
+		MatchExpressions: []metav1.LabelSelectorRequirement{
+			{Key: "uuid", Operator: metav1.LabelSelectorOpExists},
+			{Key: "component", Operator: metav1.LabelSelectorOpDoesNotExist},
+		},
+	}
+	if !filter.IncludeRetained {
+		selector.MatchExpressions = append(
+			selector.MatchExpressions, metav1.LabelSelectorRequirement{
+				Key:      retainLabel,
+				Operator: metav1.LabelSelectorOpNotIn,
+				Values:   []string{"true"},
+			},
+		)
+	}
+	return metav1.FormatLabelSelector(selector)
+}
+
+// Find the resources of past executions matching the filter and remove them, unless on a dry
+// run, reporting every resource along with the outcome.
+func (bc *BatchCleanup) Run(
+	ctx context.Context, filter BatchCleanupFilter, now time.Time,
+) (*BatchCleanupReport, error) {
+	if filter.OlderThan.Duration <= 0 {
+		return nil, fmt.Errorf("The minimum age of the resources must be positive")
+	}
+	if len(filter.Namespaces) == 0 {
+		return nil, fmt.Errorf("At least one namespace is required")
+	}
+	report := &BatchCleanupReport{
+		DryRun:     filter.DryRun,
+		Cutoff:     now.Add(-filter.OlderThan.Duration).UTC(),
+		Namespaces: filter.Namespaces,
+		Resources:  []CleanupCandidate{},
+		Deleted:    map[string]int{JobResourceKind: 0, ConfigMapResourceKind: 0},
+	}
+
+	candidates, err := bc.list(ctx, filter, report)
+	if err != nil {
+		return nil, err
+	}
+	propagationPolicy := metav1.DeletePropagationBackground
+	deleteOptions := metav1.DeleteOptions{PropagationPolicy: &propagationPolicy}
+	for _, candidate := range candidates {
+		if !filter.DryRun {
+			var err error
+			switch candidate.Kind {
+			case JobResourceKind:
+				err = bc.client.BatchV1().Jobs(candidate.Namespace).Delete(
+					ctx, candidate.Name, deleteOptions,
+				)
+			case ConfigMapResourceKind:
+				err = bc.client.CoreV1().ConfigMaps(candidate.Namespace).Delete(
+					ctx, candidate.Name, deleteOptions,
+				)
+			}
+			// Resources removed in the meantime are as good as deleted
+			if err != nil && !apierrors.IsNotFound(err) {
+				candidate.Error = err.Error()
+				report.Failed++
+				batchCleanupResources.WithLabelValues(candidate.Kind, "failed").Inc()
+			} else {
+				batchCleanupResources.WithLabelValues(candidate.Kind, "deleted").Inc()
+			}
+		}
+		if candidate.Error == "" {
+			report.Deleted[candidate.Kind]++
+		}
+		report.Resources = append(report.Resources, candidate)
+	}
+
+	if !filter.DryRun {
+		auditLog.Record(AuditBatchCleanupFinished, "", map[string]interface{}{
+			"namespaces": filter.Namespaces,
+			"cutoff":     report.Cutoff,
+			"deleted":    report.Deleted,
+			"failed":     report.Failed,
+			"skipped":    report.Skipped,
+		})
+	}
+	return report, nil
+}
+
+// List the resources of past executions matching the filter, counting the ones to skip.
+func (bc *BatchCleanup) list(
+	ctx context.Context, filter BatchCleanupFilter, report *BatchCleanupReport,
+) ([]CleanupCandidate, error) {
+	listOptions := metav1.ListOptions{LabelSelector: batchCleanupLabelSelector(filter)}
+	var candidates []CleanupCandidate
+	add := func(kind string, meta metav1.ObjectMeta) {
+		if !meta.CreationTimestamp.Time.Before(report.Cutoff) {
+			return
+		}
+		uuid := meta.Labels["uuid"]
+		if bc.skip(uuid) {
+			report.Skipped++
+			return
+		}
+		candidates = append(candidates, CleanupCandidate{
+			Kind:      kind,
+			Namespace: meta.Namespace,
+			Name:      meta.Name,
+			UUID:      uuid,
+			CreatedAt: meta.CreationTimestamp.Time.UTC(),
+		})
+	}
+
+	for _, namespace := range filter.Namespaces {
+		jobs, err := bc.client.BatchV1().Jobs(namespace).List(ctx, listOptions)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to list Jobs in namespace '%s': %w", namespace, err)
+		}
+		for _, job := range jobs.Items {
+			add(JobResourceKind, job.ObjectMeta)
+		}
+		configMaps, err := bc.client.CoreV1().ConfigMaps(namespace).List(ctx, listOptions)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"Failed to list ConfigMaps in namespace '%s': %w", namespace, err,
+			)
+		}
+		for _, cm := range configMaps.Items {
+			add(ConfigMapResourceKind, cm.ObjectMeta)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].CreatedAt.Before(candidates[j].CreatedAt)
+	})
+	return candidates, nil
+}
+
+// Check whether the resources of an execution must be left in place by the batch cleanup, i.e.
+// whether the execution is still active or under legal hold. Incidents that have not completed
+// are taken as active, as they may be run by another process, e.g. when the cleanup is run from
+// the command line against the incident store of the Reconciler.
+func skipActiveExecutions() func(uuid string) bool {
+	skipped := make(map[string]bool)
+	for _, incident := range incidentRegistry.List() {
+		if incident.LegalHold != nil || incident.CompletedAt == nil {
+			skipped[incident.UUID] = true
+		}
+	}
+	return func(uuid string) bool {
+		return skipped[uuid] || activeExecutions.Active(uuid)
+	}
+}
+
+// Handle request to remove the resources of past executions, by default in the recipe namespace
+// and in the namespaces requests can override it with.
+func handleBatchCleanupRequest(c *gin.Context, config *Config) {
+	filter := BatchCleanupFilter{OlderThan: Duration{defaultBatchCleanupAge}}
+	// The body is optional, cleaning up with the defaults
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&filter); err != nil {
+			respondProblem(
+				c, http.StatusBadRequest, InvalidRequestProblem,
+				fmt.Sprintf("Invalid cleanup request: %s", err),
+			)
+			return
+		}
+	}
+	if len(filter.Namespaces) == 0 {
+		filter.Namespaces = append([]string{config.RecipeNamespace}, overrideNamespaces(config)...)
+	}
+	if filter.OlderThan.Duration <= 0 {
+		respondProblem(
+			c, http.StatusBadRequest, InvalidRequestProblem,
+			"The minimum age of the resources must be positive",
+		)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), batchCleanupTimeout)
+	defer cancel()
+	report, err := NewBatchCleanup(clientset, skipActiveExecutions()).Run(
+		ctx, filter, time.Now(),
+	)
+	if err != nil {
+		logger.Error("Failed to clean up past executions", zap.Error(err))
+		respondProblem(c, http.StatusInternalServerError, InternalErrorProblem, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// Run the batch cleanup from the command line, e.g.
+// `reconciler cleanup --older-than=72h --namespace=recipes --dry-run`, returning the exit code.
+func runCleanupCommand(args []string, out io.Writer) int {
+	fs := pflag.NewFlagSet("cleanup", pflag.ContinueOnError)
+	olderThan := fs.Duration(
+		"older-than", defaultBatchCleanupAge, "Minimum age of the resources to remove",
+	)
+	namespaces := fs.StringSlice(
+		"namespace", nil, "Namespaces to clean up, the Reconciler namespace if unset",
+	)
+	uuid := fs.String("uuid", "", "Only remove the resources of this execution")
+	includeRetained := fs.Bool(
+		"include-retained", false, "Also remove the resources retained after their cleanup",
+	)
+	dryRun := fs.Bool("dry-run", false, "Only list the resources that would be removed")
+	force := fs.Bool(
+		"force", false,
+		"Remove the resources even though the active and held executions cannot be determined",
+	)
+	output := fs.String("output", "text", "Format of the report (text, json)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *output != "text" && *output != "json" {
+		fmt.Fprintf(os.Stderr, "Unsupported output format '%s'\n", *output)
+		return 2
+	}
+	if len(*namespaces) == 0 {
+		namespace, err := getReconcilerNamespace()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "A namespace is required:", err)
+			return 2
+		}
+		*namespaces = []string{namespace}
+	}
+
+	initLogger()
+	// The executions to leave in place are read from the incident store of the Reconciler, which
+	// is configured through the same environment variables and configuration file
+	config, err := ParseConfig(nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to parse config: %s\n", err)
+		return 2
+	}
+	if !durableExecutions(&config) && !*dryRun && !*force {
+		fmt.Fprintln(
+			os.Stderr,
+			"The active and held executions are only known to the Reconciler, as incidents are"+
+				" not persisted (--incident-store=memory): use the admin API, or --force",
+		)
+		return 2
+	}
+	if durableExecutions(&config) {
+		if rdb, err = newRedisClient(&config); err == nil {
+			err = rdb.Ping(context.Background()).Err()
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to connect to Redis:", err)
+			return 1
+		}
+	}
+	incidentRegistry = NewIncidentRegistry(config.IncidentStore, config.IncidentRetention)
+
+	client, err := InitialiseKubernetesClient()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to initialise Kubernetes client:", err)
+		return 1
+	}
+	filter := BatchCleanupFilter{
+		OlderThan:       Duration{*olderThan},
+		Namespaces:      *namespaces,
+		UUID:            *uuid,
+		IncludeRetained: *includeRetained,
+		DryRun:          *dryRun,
+	}
+	report, err := NewBatchCleanup(client, skipActiveExecutions()).Run(
+		context.Background(), filter, time.Now(),
+	)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to clean up past executions:", err)
+		return 1
+	}
+
+	if *output == "json" {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(report)
+	} else {
+		writeBatchCleanupReport(out, report)
+	}
+	if report.Failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// Write the report of a batch cleanup as a table of the resources, followed by a summary.
+func writeBatchCleanupReport(out io.Writer, report *BatchCleanupReport) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tNAMESPACE\tNAME\tUUID\tCREATED\tSTATUS")
+	for _, resource := range report.Resources {
+		status := "deleted"
+		switch {
+		case report.DryRun:
+			status = "would delete"
+		case resource.Error != "":
+			status = "failed: " + resource.Error
+		}
+		fmt.Fprintf(
+			w, "%s\t%s\t%s\t%s\t%s\t%s\n", resource.Kind, resource.Namespace, resource.Name,
+			resource.UUID, resource.CreatedAt.Format(time.RFC3339), status,
+		)
+	}
+	w.Flush()
+
+	verb := "Deleted"
+	if report.DryRun {
+		verb = "Would delete"
+	}
+	fmt.Fprintf(
+		out, "\n%s %d Jobs and %d ConfigMaps created before %s in %s (%d failed, %d skipped)\n",
+		verb, report.Deleted[JobResourceKind], report.Deleted[ConfigMapResourceKind],
+		report.Cutoff.Format(time.RFC3339), strings.Join(report.Namespaces, ", "),
+		report.Failed, report.Skipped,
+	)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// Build the metadata of a resource created some time ago with the given labels.
+func leakedObjectMeta(
+	name string, namespace string, age time.Duration, labels map[string]string,
+) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:              name,
+		Namespace:         namespace,
+		Labels:            labels,
+		CreationTimestamp: metav1.NewTime(time.Now().Add(-age)),
+	}
+}
+
+// Build a fake client holding the resources of past executions, along with resources that the
+// batch cleanup must leave in place.
+func newLeakedResourcesClient() *fake.Clientset {
+	day := 24 * time.Hour
+	execution := func(uuid string) map[string]string {
+		return map[string]string{"app": "euphrosyne", "uuid": uuid}
+	}
+	job := func(name string, namespace string, age time.Duration, uuid string) *batchv1.Job {
+		return &batchv1.Job{ObjectMeta: leakedObjectMeta(name, namespace, age, execution(uuid))}
+	}
+	objects := []runtime.Object{
+		job("logs-old", "recipes", 5*day, "old"),
+		&corev1.ConfigMap{ObjectMeta: leakedObjectMeta(
+			"euphrosyne-recipes-old", "recipes", 5*day, execution("old"),
+		)},
+		job("logs-held", "recipes", 5*day, "held"),
+		job("logs-new", "recipes", time.Hour, "new"),
+		job("logs-other", "other", 5*day, "other"),
+		&batchv1.Job{ObjectMeta: leakedObjectMeta(
+			"logs-retained", "recipes", 5*day,
+			map[string]string{"app": "euphrosyne", "uuid": "retained", retainLabel: "true"},
+		)},
+		&corev1.ConfigMap{ObjectMeta: leakedObjectMeta(
+			"euphrosyne-debug-abcdefgh", "recipes", 5*day,
+			map[string]string{"app": "euphrosyne", "uuid": "old", "component": "debug-session"},
+		)},
+		&corev1.ConfigMap{ObjectMeta: leakedObjectMeta(
+			intakeConfigMapName, "recipes", 5*day, map[string]string{"app": "euphrosyne"},
+		)},
+	}
+	return fake.NewSimpleClientset(objects...)
+}
+
+// Test that only the resources of past executions matching the filter are removed, leaving the
+// ones of active or held executions in place.
+func TestBatchCleanup(t *testing.T) {
+	client := newLeakedResourcesClient()
+	ctx := context.Background()
+	bc := NewBatchCleanup(client, func(uuid string) bool { return uuid == "held" })
+	filter := BatchCleanupFilter{
+		OlderThan:  Duration{72 * time.Hour},
+		Namespaces: []string{"recipes"},
+		DryRun:     true,
+	}
+
+	// Dry runs only list the resources
+	report, err := bc.Run(ctx, filter, time.Now())
+	assert.Nil(t, err)
+	names := []string{}
+	for _, resource := range report.Resources {
+		names = append(names, resource.Name)
+	}
+	assert.ElementsMatch(t, []string{"logs-old", "euphrosyne-recipes-old"}, names)
+	assert.Equal(t, map[string]int{JobResourceKind: 1, ConfigMapResourceKind: 1}, report.Deleted)
+	assert.Equal(t, 1, report.Skipped)
+	jobs, _ := client.BatchV1().Jobs("recipes").List(ctx, metav1.ListOptions{})
+	assert.Len(t, jobs.Items, 4)
+
+	filter.DryRun = false
+	filter.IncludeRetained = true
+	report, err = bc.Run(ctx, filter, time.Now())
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]int{JobResourceKind: 2, ConfigMapResourceKind: 1}, report.Deleted)
+	assert.Zero(t, report.Failed)
+
+	jobs, _ = client.BatchV1().Jobs("recipes").List(ctx, metav1.ListOptions{})
+	remaining := []string{}
+	for _, job := range jobs.Items {
+		remaining = append(remaining, job.Name)
+	}
+	assert.ElementsMatch(t, []string{"logs-held", "logs-new"}, remaining)
+	configMaps, _ := client.CoreV1().ConfigMaps("recipes").List(ctx, metav1.ListOptions{})
+	assert.Len(t, configMaps.Items, 2)
+
+	// The minimum age and the namespaces are required
+	_, err = bc.Run(ctx, BatchCleanupFilter{Namespaces: []string{"recipes"}}, time.Now())
+	assert.NotNil(t, err)
+	_, err = bc.Run(ctx, BatchCleanupFilter{OlderThan: Duration{time.Hour}}, time.Now())
+	assert.NotNil(t, err)
+}
+
+// Test that the report of a batch cleanup lists the resources, followed by a summary.
+func TestWriteBatchCleanupReport(t *testing.T) {
+	createdAt := time.Date(2024, 2, 20, 10, 0, 0, 0, time.UTC)
+	report := &BatchCleanupReport{
+		DryRun:     true,
+		Cutoff:     createdAt.Add(72 * time.Hour),
+		Namespaces: []string{"recipes"},
+		Resources: []CleanupCandidate{{
+			Kind: JobResourceKind, Namespace: "recipes", Name: "logs-old", UUID: "old",
+			CreatedAt: createdAt,
+		}},
+		Deleted: map[string]int{JobResourceKind: 1, ConfigMapResourceKind: 0},
+	}
+
+	var out bytes.Buffer
+	writeBatchCleanupReport(&out, report)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Equal(t, []string{
+		"KIND  NAMESPACE  NAME      UUID  CREATED               STATUS",
+		"Job   recipes    logs-old  old   2024-02-20T10:00:00Z  would delete",
+		"",
+		"Would delete 1 Jobs and 0 ConfigMaps created before 2024-02-23T10:00:00Z in recipes " +
+			"(0 failed, 0 skipped)",
+	}, lines)
+}
+
+// Test that batch cleanup requests with an invalid minimum age are rejected.
+func TestBatchCleanupRequestValidation(t *testing.T) {
+	router := gin.New()
+	router.POST("/cleanup", func(ctx *gin.Context) {
+		handleBatchCleanupRequest(ctx, &Config{RecipeNamespace: "recipes"})
+	})
+
+	for _, body := range []string{`{"olderThan": -1}`, `{"olderThan": "soon"}`} {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(
+			recorder, httptest.NewRequest(http.MethodPost, "/cleanup", strings.NewReader(body)),
+		)
+		assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	}
+}
+
+// Test that the resources of executions that are running, have not completed or are under legal
+// hold are left in place.
+func TestSkipActiveExecutions(t *testing.T) {
+	registry := incidentRegistry
+	defer func() { incidentRegistry = registry }()
+	incidentRegistry = NewIncidentRegistry(MemoryIncidentStore, time.Hour)
+
+	for _, uuid := range []string{"completed", "held", "pending"} {
+		incidentRegistry.Register(uuid, Alert)
+	}
+	incidentRegistry.Complete("completed")
+	incidentRegistry.Complete("held")
+	incidentRegistry.Update("held", func(incident *Incident) {
+		incident.LegalHold = &LegalHold{Reason: "audit"}
+	})
+	activeExecutions.Track(context.Background(), "running")
+	defer activeExecutions.Unregister("running")
+
+	skip := skipActiveExecutions()
+	for uuid, skipped := range map[string]bool{
+		"completed": false, "held": true, "pending": true, "running": true, "unknown": false,
+	} {
+		assert.Equal(t, skipped, skip(uuid), uuid)
+	}
+}
+
+// Test that the command line refuses to remove resources when the active and held executions
+// cannot be read from the incident store, unless forced.
+func TestCleanupCommandRequiresIncidentStore(t *testing.T) {
+	t.Setenv("RECONCILER_NAMESPACE", "euphrosyne")
+	t.Setenv("INCIDENT_STORE", MemoryIncidentStore)
+	var out strings.Builder
+	assert.Equal(t, 2, runCleanupCommand([]string{"--namespace=recipes"}, &out))
+	assert.Empty(t, out.String())
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/nats-io/nats.go"
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+)
+
+// Supported brokers for collecting recipe results.
+const (
+	RedisResultBroker = "redis"
+	NATSResultBroker  = "nats"
+	KafkaResultBroker = "kafka"
+)
+
+const (
+	// Default subject prefix for recipe results published to NATS JetStream.
+	defaultNATSSubjectPrefix = "euphrosyne.results"
+	// Name of the JetStream stream capturing the recipe results.
+	natsStreamName = "EUPHROSYNE_RESULTS"
+	// How long recipe results are kept in the JetStream stream.
+	natsStreamMaxAge = time.Hour
+	// Default Kafka topic for recipe results.
+	defaultKafkaTopic = "euphrosyne-results"
+)
+
+// Environment variables through which recipes are told where to publish their results.
+const (
+	resultBrokerEnvVar        = "RESULT_BROKER"
+	resultBrokerAddressEnvVar = "RESULT_BROKER_ADDRESS"
+	resultTopicEnvVar         = "RESULT_TOPIC"
+	resultKeyEnvVar           = "RESULT_KEY"
+)
+
+// ResultBroker delivers the results published by recipes to the reconciler waiting for them.
+type ResultBroker interface {
+	// Subscribe to the results of the recipes of an incident.
+	Subscribe(ctx context.Context, uuid string) (ResultSubscription, error)
+	// Return the topic the recipes of an incident should publish their results to.
+	Topic(uuid string) string
+	Close() error
+}
+
+// ResultSubscription receives the results published for an incident.
+type ResultSubscription interface {
+	Messages() <-chan string
+	Close() error
+}
+
+var resultBroker ResultBroker = &redisBroker{}
+
+// Check whether the provided result broker is supported.
+func isValidResultBroker(broker string) bool {
+	switch broker {
+	case RedisResultBroker, NATSResultBroker, KafkaResultBroker:
+		return true
+	}
+	return false
+}
+
+// Initialise the result broker selected in the configuration.
+func NewResultBroker(config *Config) (ResultBroker, error) {
+	switch config.ResultBroker {
+	case NATSResultBroker:
+		return newNATSBroker(config.ResultBrokerAddress, config.ResultTopic)
+	case KafkaResultBroker:
+		return newKafkaBroker(config.ResultBrokerAddress, config.ResultTopic), nil
+	default:
+		return &redisBroker{}, nil
+	}
+}
+
+// redisBroker collects the results through Redis pub/sub, on a channel named after the incident.
+type redisBroker struct{}
+
+func (b *redisBroker) Subscribe(ctx context.Context, uuid string) (ResultSubscription, error) {
+	pubsub := rdb.Subscribe(ctx, uuid)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+
+	s := &redisSubscription{
+		pubsub:   pubsub,
+		uuid:     uuid,
+		messages: make(chan string),
+		done:     make(chan struct{}),
+	}
+	go s.receive()
+	return s, nil
+}
+
+func (b *redisBroker) Topic(uuid string) string {
+	return uuid
+}
+
+func (b *redisBroker) Close() error {
+	return nil
+}
+
+type redisSubscription struct {
+	pubsub   *redis.PubSub
+	uuid     string
+	messages chan string
+	done     chan struct{}
+}
+
+// Forward the results received on the subscription until it is closed. Whenever the connection is
+// lost, e.g. on a Redis failover, the subscription is restored with an exponential backoff. Results
+// published in the meantime are collected from the termination messages of the recipes instead.
+func (s *redisSubscription) receive() {
+	defer close(s.messages)
+	ctx := context.Background()
+	backoff := minResubscribeBackoff
+	lost := false
+	for {
+		msg, err := s.pubsub.ReceiveTimeout(ctx, subscriptionHealthCheckInterval)
+		select {
+		case <-s.done:
+			return
+		default:
+		}
+		// A quiet subscription is pinged, so that a dead connection is noticed
+		if isTimeout(err) {
+			if err = s.pubsub.Ping(ctx); err == nil {
+				continue
+			}
+		}
+		if err != nil {
+			if !lost {
+				logger.Warn(
+					"Result subscription lost, resubscribing",
+					zap.String("uuid", s.uuid),
+					zap.Error(err),
+				)
+				lost = true
+			}
+			select {
+			case <-time.After(backoff):
+			case <-s.done:
+				return
+			}
+			backoff = nextResubscribeBackoff(backoff)
+			continue
+		}
+
+		switch msg := msg.(type) {
+		case *redis.Subscription:
+			if lost {
+				logger.Info("Result subscription restored", zap.String("uuid", s.uuid))
+				resultResubscriptions.Inc()
+				lost = false
+				backoff = minResubscribeBackoff
+			}
+		case *redis.Message:
+			received := time.Now()
+			select {
+			case s.messages <- msg.Payload:
+				redisReceiveDuration.Observe(time.Since(received).Seconds())
+			case <-s.done:
+				return
+			}
+		}
+	}
+}
+
+func (s *redisSubscription) Messages() <-chan string {
+	return s.messages
+}
+
+func (s *redisSubscription) Close() error {
+	close(s.done)
+	return s.pubsub.Close()
+}
+
+// natsBroker collects the results through NATS JetStream, on a subject per incident. Results are
+// captured by a stream, so that results published before subscribing are not lost.
+type natsBroker struct {
+	conn          *nats.Conn
+	js            nats.JetStreamContext
+	subjectPrefix string
+}
+
+func newNATSBroker(address string, subjectPrefix string) (*natsBroker, error) {
+	if subjectPrefix == "" {
+		subjectPrefix = defaultNATSSubjectPrefix
+	}
+	conn, err := nats.Connect(address)
+	if err != nil {
+		return nil, err
+	}
+	js, err := conn.JetStream()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	_, err = js.StreamInfo(natsStreamName)
+	if err == nats.ErrStreamNotFound {
+		_, err = js.AddStream(&nats.StreamConfig{
+			Name:     natsStreamName,
+			Subjects: []string{subjectPrefix + ".>"},
+			MaxAge:   natsStreamMaxAge,
+		})
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("Failed to set up JetStream stream: %w", err)
+	}
+
+	logger.Info("NATS connected successfully", zap.String("natsAddress", address))
+	return &natsBroker{conn: conn, js: js, subjectPrefix: subjectPrefix}, nil
+}
+
+func (b *natsBroker) Subscribe(_ context.Context, uuid string) (ResultSubscription, error) {
+	msgs := make(chan *nats.Msg, 64)
+	sub, err := b.js.ChanSubscribe(b.Topic(uuid), msgs, nats.OrderedConsumer())
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make(chan string)
+	done := make(chan struct{})
+	go func() {
+		defer close(messages)
+		for {
+			select {
+			case msg := <-msgs:
+				select {
+				case messages <- string(msg.Data):
+				case <-done:
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return &natsSubscription{sub: sub, messages: messages, done: done}, nil
+}
+
+func (b *natsBroker) Topic(uuid string) string {
+	return b.subjectPrefix + "." + uuid
+}
+
+func (b *natsBroker) Close() error {
+	return b.conn.Drain()
+}
+
+type natsSubscription struct {
+	sub      *nats.Subscription
+	messages chan string
+	done     chan struct{}
+}
+
+func (s *natsSubscription) Messages() <-chan string {
+	return s.messages
+}
+
+func (s *natsSubscription) Close() error {
+	close(s.done)
+	return s.sub.Unsubscribe()
+}
+
+// kafkaBroker collects the results through a shared Kafka topic, keyed by incident. A single
+// reader consumes the topic and dispatches the results to the subscription of each incident.
+type kafkaBroker struct {
+	reader        *kafka.Reader
+	topic         string
+	mutex         sync.Mutex
+	subscriptions map[string]*kafkaSubscription
+	cancel        context.CancelFunc
+}
+
+func newKafkaBroker(address string, topic string) *kafkaBroker {
+	if topic == "" {
+		topic = defaultKafkaTopic
+	}
+	// Every reconciler process consumes all results, so each uses its own consumer group
+	hostname, _ := os.Hostname()
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     strings.Split(address, ","),
+		Topic:       topic,
+		GroupID:     "euphrosyne-reconciler-" + hostname,
+		StartOffset: kafka.LastOffset,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &kafkaBroker{
+		reader:        reader,
+		topic:         topic,
+		subscriptions: make(map[string]*kafkaSubscription),
+		cancel:        cancel,
+	}
+	go b.consume(ctx)
+	logger.Info("Kafka reader started", zap.String("kafkaAddress", address))
+	return b
+}
+
+// Consume the results topic, dispatching each result to the subscription of its incident.
+func (b *kafkaBroker) consume(ctx context.Context) {
+	for {
+		msg, err := b.reader.ReadMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Error("Failed to read from Kafka", zap.Error(err))
+			time.Sleep(time.Second)
+			continue
+		}
+		b.dispatch(string(msg.Key), string(msg.Value))
+	}
+}
+
+// Deliver a result to the subscription of its incident. Results for incidents without a
+// subscription are handled by other reconcilers, or arrived too late, and are dropped. The lock is
+// held while delivering, so that the subscription cannot close its channel in the meantime.
+func (b *kafkaBroker) dispatch(uuid string, payload string) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	sub, ok := b.subscriptions[uuid]
+	if !ok {
+		return
+	}
+	select {
+	case sub.messages <- payload:
+	case <-sub.done:
+	}
+}
+
+func (b *kafkaBroker) Subscribe(_ context.Context, uuid string) (ResultSubscription, error) {
+	sub := &kafkaSubscription{
+		broker:   b,
+		uuid:     uuid,
+		messages: make(chan string, 64),
+		done:     make(chan struct{}),
+	}
+	b.mutex.Lock()
+	b.subscriptions[uuid] = sub
+	b.mutex.Unlock()
+	return sub, nil
+}
+
+func (b *kafkaBroker) Topic(_ string) string {
+	return b.topic
+}
+
+func (b *kafkaBroker) Close() error {
+	b.cancel()
+	return b.reader.Close()
+}
+
+type kafkaSubscription struct {
+	broker   *kafkaBroker
+	uuid     string
+	messages chan string
+	done     chan struct{}
+}
+
+func (s *kafkaSubscription) Messages() <-chan string {
+	return s.messages
+}
+
+// Close the subscription. A pending delivery is abandoned first, so that the lock can be taken.
+func (s *kafkaSubscription) Close() error {
+	close(s.done)
+	s.broker.mutex.Lock()
+	delete(s.broker.subscriptions, s.uuid)
+	close(s.messages)
+	s.broker.mutex.Unlock()
+	return nil
+}
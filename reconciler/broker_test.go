@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that results published to Redis are delivered to the subscription of the incident.
+func TestRedisBroker(t *testing.T) {
+	ctx := context.Background()
+	broker := &redisBroker{}
+	assert.Equal(t, "broker-incident", broker.Topic("broker-incident"))
+
+	sub, err := broker.Subscribe(ctx, "broker-incident")
+	assert.Nil(t, err)
+	defer sub.Close()
+
+	assert.Nil(t, rdb.Publish(ctx, "other-incident", "ignored").Err())
+	assert.Nil(t, rdb.Publish(ctx, "broker-incident", "result").Err())
+	select {
+	case payload := <-sub.Messages():
+		assert.Equal(t, "result", payload)
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for result")
+	}
+}
+
+// Test that closing the Redis subscription closes its channel, so that the reconciler notices.
+func TestRedisBrokerClose(t *testing.T) {
+	sub, err := (&redisBroker{}).Subscribe(context.Background(), "closed-incident")
+	assert.Nil(t, err)
+	assert.Nil(t, sub.Close())
+	select {
+	case _, ok := <-sub.Messages():
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for the subscription to close")
+	}
+}
+
+// Test that the Redis subscription is restored once its connection is lost, e.g. on a failover.
+func TestRedisBrokerResubscribe(t *testing.T) {
+	ctx := context.Background()
+	proxy := newDroppingProxy(t, testConfig.RedisAddress)
+	defaultClient := rdb
+	rdb = redis.NewClient(&redis.Options{Addr: proxy.Addr().String()})
+	defer func() {
+		rdb.Close()
+		rdb = defaultClient
+	}()
+
+	broker := &redisBroker{}
+	sub, err := broker.Subscribe(ctx, "resubscribe-incident")
+	assert.Nil(t, err)
+	defer sub.Close()
+
+	resubscriptions := testutil.ToFloat64(resultResubscriptions)
+	proxy.DropConnections()
+
+	// Results published before the subscription is restored are missed, so publish until received
+	deadline := time.After(5 * time.Second)
+	for {
+		assert.Nil(t, defaultClient.Publish(ctx, "resubscribe-incident", "result").Err())
+		select {
+		case payload := <-sub.Messages():
+			assert.Equal(t, "result", payload)
+			assert.Equal(t, resubscriptions+1, testutil.ToFloat64(resultResubscriptions))
+			return
+		case <-time.After(100 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("Timed out waiting for the subscription to be restored")
+		}
+	}
+}
+
+// droppingProxy forwards TCP connections to a target, and can drop them to simulate a failover.
+type droppingProxy struct {
+	net.Listener
+	target string
+	mutex  sync.Mutex
+	conns  []net.Conn
+}
+
+func newDroppingProxy(t *testing.T, target string) *droppingProxy {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	p := &droppingProxy{Listener: listener, target: target}
+	t.Cleanup(func() {
+		listener.Close()
+		p.DropConnections()
+	})
+
+	go func() {
+		for {
+			client, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			server, err := net.Dial("tcp", target)
+			if err != nil {
+				client.Close()
+				continue
+			}
+			p.mutex.Lock()
+			p.conns = append(p.conns, client, server)
+			p.mutex.Unlock()
+			go io.Copy(server, client)
+			go io.Copy(client, server)
+		}
+	}()
+	return p
+}
+
+// Close the proxied connections, while still accepting new ones.
+func (p *droppingProxy) DropConnections() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, conn := range p.conns {
+		conn.Close()
+	}
+	p.conns = nil
+}
+
+// Test that results consumed from Kafka are dispatched by incident.
+func TestKafkaBrokerDispatch(t *testing.T) {
+	broker := &kafkaBroker{
+		topic:         defaultKafkaTopic,
+		subscriptions: make(map[string]*kafkaSubscription),
+	}
+	assert.Equal(t, defaultKafkaTopic, broker.Topic("broker-incident"))
+
+	sub, err := broker.Subscribe(context.Background(), "broker-incident")
+	assert.Nil(t, err)
+
+	broker.dispatch("other-incident", "ignored")
+	broker.dispatch("broker-incident", "result")
+	assert.Equal(t, "result", <-sub.Messages())
+
+	// Results arriving after the subscription is closed are dropped
+	assert.Nil(t, sub.Close())
+	broker.dispatch("broker-incident", "late")
+	assert.Empty(t, broker.subscriptions)
+	_, ok := <-sub.Messages()
+	assert.False(t, ok)
+}
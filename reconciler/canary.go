@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// Name of the built-in no-op recipe run by the canary self-test
+	canaryRecipeName = "canary"
+	// Entrypoint of the no-op recipe in the image of the recipe SDK
+	canaryEntrypoint = "canary"
+)
+
+// States of the canary self-test.
+const (
+	CanaryStatePending = "pending"
+	CanaryStatePassed  = "passed"
+	CanaryStateFailed  = "failed"
+)
+
+// CanaryResult is the outcome of the latest canary self-test.
+type CanaryResult struct {
+	State       string     `json:"state"`
+	Incident    string     `json:"incident,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	StartedAt   time.Time  `json:"startedAt"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+}
+
+// Canary proves that the whole pipeline works in the cluster, i.e. that recipe Jobs are created,
+// that their results are published and collected and that their resources are cleaned up, by
+// running a no-op recipe end-to-end before real alerts arrive.
+type Canary struct {
+	config *Config
+	mutex  sync.RWMutex
+	result *CanaryResult
+}
+
+// Canary self-test of the reconciler, nil unless enabled.
+var canary *Canary
+
+// Initialise a canary self-test, which is pending until it first runs.
+func NewCanary(config *Config) *Canary {
+	return &Canary{config: config}
+}
+
+// Run the self-test right away and then on the provided interval, if any, until the context is
+// cancelled.
+func (c *Canary) Run(ctx context.Context, interval time.Duration) {
+	c.RunOnce(ctx)
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.RunOnce(ctx)
+		}
+	}
+}
+
+// Run the self-test once, recording its outcome. The outcome of the previous run is reported
+// until this one completes.
+func (c *Canary) RunOnce(ctx context.Context) {
+	startedAt := time.Now().UTC()
+	c.mutex.Lock()
+	if c.result == nil {
+		c.result = &CanaryResult{State: CanaryStatePending, StartedAt: startedAt}
+	}
+	c.mutex.Unlock()
+
+	uuid, err := runCanary(ctx, c.config)
+	completedAt := time.Now().UTC()
+	result := &CanaryResult{
+		State:       CanaryStatePassed,
+		Incident:    uuid,
+		StartedAt:   startedAt,
+		CompletedAt: &completedAt,
+	}
+	if err != nil {
+		result.State = CanaryStateFailed
+		result.Error = err.Error()
+		logger.Error("Canary self-test failed", zap.String("uuid", uuid), zap.Error(err))
+		canaryHealthy.Set(0)
+	} else {
+		logger.Info("Canary self-test passed", zap.String("uuid", uuid))
+		canaryHealthy.Set(1)
+	}
+	canaryRuns.WithLabelValues(result.State).Inc()
+	canaryDuration.Set(completedAt.Sub(startedAt).Seconds())
+
+	c.mutex.Lock()
+	c.result = result
+	c.mutex.Unlock()
+}
+
+// Return the outcome of the latest self-test, or nil if it never ran on this replica.
+func (c *Canary) Result() *CanaryResult {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if c.result == nil {
+		return nil
+	}
+	result := *c.result
+	return &result
+}
+
+// Add the outcome of the latest self-test to a health report, failing it until the self-test
+// passes. Standby replicas do not run the self-test, so they are not held back by it.
+func (c *Canary) Check(report HealthReport) HealthReport {
+	result := c.Result()
+	if result == nil {
+		return report
+	}
+	check := HealthCheck{Name: "canary", Healthy: result.State == CanaryStatePassed}
+	switch result.State {
+	case CanaryStatePending:
+		check.Error = "Canary self-test pending"
+	case CanaryStateFailed:
+		check.Error = result.Error
+	}
+	if !check.Healthy {
+		report.Status = HealthStatusUnavailable
+	}
+	report.Checks = append(report.Checks, check)
+	return report
+}
+
+// Build the built-in no-op recipe of the canary self-test.
+func canaryRecipe(config *Config) Recipe {
+	return Recipe{Config: &RecipeConfig{
+		Enabled:     true,
+		Image:       config.CanaryImage,
+		Entrypoint:  canaryEntrypoint,
+		Description: "No-op recipe of the canary self-test",
+	}}
+}
+
+// Run the no-op recipe through the whole pipeline, without delivering its analysis, returning
+// the UUID of its execution and whether any of the stages failed.
+func runCanary(ctx context.Context, config *Config) (string, error) {
+	uuid := newExecutionID(ctx)
+	data := map[string]interface{}{"uuid": uuid}
+	recipe := canaryRecipe(config)
+	recipes := map[string]Recipe{canaryRecipeName: recipe}
+
+	incidentRegistry.Register(uuid, Alert)
+	incidentRegistry.Update(uuid, func(incident *Incident) {
+		incident.Canary = true
+	})
+	ctx = activeExecutions.Track(ctx, uuid)
+	reconciler, err := NewReconciler(ctx, config, &data, recipes, Alert)
+	if err != nil {
+		activeExecutions.Unregister(uuid)
+		incidentRegistry.Complete(uuid)
+		return uuid, fmt.Errorf("Failed to subscribe to the recipe results: %w", err)
+	}
+	reconciler.canary = true
+
+	cm, err := reconciler.createConfigMap(&data, recipeTarget(recipe.Config, config))
+	if err != nil {
+		reconciler.results.Close()
+		activeExecutions.Unregister(uuid)
+		incidentRegistry.Complete(uuid)
+		return uuid, fmt.Errorf("Failed to create the recipe ConfigMap: %w", err)
+	}
+	reconciler.launchRecipe(canaryRecipeName, recipe, cm.Name)
+	reconciler.Run()
+	return uuid, canaryOutcome(uuid)
+}
+
+// Check that the no-op recipe of a canary execution succeeded and that its resources were
+// cleaned up.
+func canaryOutcome(uuid string) error {
+	incident, ok := incidentRegistry.Get(uuid)
+	if !ok {
+		return fmt.Errorf("Canary incident '%s' not found", uuid)
+	}
+	state, ok := incident.Recipes[canaryRecipeName]
+	if !ok {
+		return fmt.Errorf("The canary recipe was not launched")
+	}
+	if state.State != RecipeStateCompleted {
+		if state.Error != "" {
+			return fmt.Errorf("The canary recipe ended as '%s': %s", state.State, state.Error)
+		}
+		return fmt.Errorf("The canary recipe ended as '%s'", state.State)
+	}
+	if state.Status != RecipeStatusSuccessful {
+		return fmt.Errorf("The canary recipe completed with status '%s'", state.Status)
+	}
+	if incident.Cleanup.State != CleanupStateCompleted {
+		return fmt.Errorf("Failed to clean up after the canary recipe: %s", incident.Cleanup.Error)
+	}
+	return nil
+}
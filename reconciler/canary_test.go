@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that the canary only passes once its recipe succeeded and its resources were cleaned up.
+func TestCanaryOutcome(t *testing.T) {
+	registry := incidentRegistry
+	defer func() { incidentRegistry = registry }()
+	incidentRegistry = NewIncidentRegistry(MemoryIncidentStore, time.Hour)
+
+	complete := func(status string) func(uuid string) {
+		return func(uuid string) {
+			incidentRegistry.RecipeLaunched(uuid, canaryRecipeName, "canary-abcde", 1)
+			incidentRegistry.RecipeCompleted(uuid, Recipe{Execution: &RecipeExecution{
+				Name: canaryRecipeName, Status: status,
+			}})
+		}
+	}
+	tests := []struct {
+		name    string
+		setup   func(uuid string)
+		cleanup error
+		err     string
+	}{
+		{name: "Passed", setup: complete(RecipeStatusSuccessful)},
+		{name: "NotLaunched", setup: func(string) {}, err: "The canary recipe was not launched"},
+		{
+			name: "LaunchFailed",
+			setup: func(uuid string) {
+				incidentRegistry.RecipeFailed(uuid, canaryRecipeName, errors.New("forbidden"))
+			},
+			err: "The canary recipe ended as 'failed': forbidden",
+		},
+		{
+			name: "TimedOut",
+			setup: func(uuid string) {
+				incidentRegistry.RecipeLaunched(uuid, canaryRecipeName, "canary-abcde", 1)
+				incidentRegistry.RecipesTimedOut(uuid)
+			},
+			err: "The canary recipe ended as 'timedOut'",
+		},
+		{
+			name:  "FailedStatus",
+			setup: complete(RecipeStatusFailed),
+			err:   "The canary recipe completed with status 'failed'",
+		},
+		{
+			name:    "CleanupFailed",
+			setup:   complete(RecipeStatusSuccessful),
+			cleanup: errors.New("forbidden"),
+			err:     "Failed to clean up after the canary recipe: forbidden",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uuid := "canary-" + tt.name
+			incidentRegistry.Register(uuid, Alert)
+			tt.setup(uuid)
+			incidentRegistry.CleanupFinished(uuid, nil, tt.cleanup)
+
+			err := canaryOutcome(uuid)
+			if tt.err != "" {
+				assert.EqualError(t, err, tt.err)
+				return
+			}
+			assert.Nil(t, err)
+		})
+	}
+	assert.ErrorContains(t, canaryOutcome("unknown"), "Canary incident 'unknown' not found")
+}
+
+// Test that the readiness fails until the canary passes, except on replicas not running it.
+func TestCanaryCheck(t *testing.T) {
+	completedAt := time.Now()
+	tests := []struct {
+		name     string
+		result   *CanaryResult
+		expected HealthReport
+	}{
+		{
+			name:     "NotRun",
+			expected: HealthReport{Status: HealthStatusOK},
+		},
+		{
+			name:   "Pending",
+			result: &CanaryResult{State: CanaryStatePending},
+			expected: HealthReport{
+				Status: HealthStatusUnavailable,
+				Checks: []HealthCheck{{Name: "canary", Error: "Canary self-test pending"}},
+			},
+		},
+		{
+			name:   "Passed",
+			result: &CanaryResult{State: CanaryStatePassed, CompletedAt: &completedAt},
+			expected: HealthReport{
+				Status: HealthStatusOK,
+				Checks: []HealthCheck{{Name: "canary", Healthy: true}},
+			},
+		},
+		{
+			name: "Failed",
+			result: &CanaryResult{
+				State: CanaryStateFailed, Error: "timed out", CompletedAt: &completedAt,
+			},
+			expected: HealthReport{
+				Status: HealthStatusUnavailable,
+				Checks: []HealthCheck{{Name: "canary", Error: "timed out"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCanary(&Config{})
+			c.result = tt.result
+			assert.Equal(t, tt.expected, c.Check(HealthReport{Status: HealthStatusOK}))
+		})
+	}
+}
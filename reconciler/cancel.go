@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	errExecutionCancelled = errors.New("Execution cancelled")
+	errIncidentNotFound   = errors.New("Incident not found")
+	errIncidentNotActive  = errors.New("Incident is not active")
+)
+
+// ActiveExecutions keeps track of the running executions, so that they can be cancelled.
+type ActiveExecutions struct {
+	mutex   sync.Mutex
+	cancels map[string]context.CancelFunc
+}
+
+var activeExecutions = NewActiveExecutions()
+
+// Initialise an empty set of active executions.
+func NewActiveExecutions() *ActiveExecutions {
+	return &ActiveExecutions{cancels: make(map[string]context.CancelFunc)}
+}
+
+// Keep track of a running execution, returning the context that is cancelled along with it.
+func (ae *ActiveExecutions) Track(ctx context.Context, uuid string) context.Context {
+	ctx, cancel := context.WithCancel(ctx)
+	ae.mutex.Lock()
+	defer ae.mutex.Unlock()
+	ae.cancels[uuid] = cancel
+	return ctx
+}
+
+// Stop keeping track of an execution that completed, releasing its context.
+func (ae *ActiveExecutions) Unregister(uuid string) {
+	ae.mutex.Lock()
+	defer ae.mutex.Unlock()
+	if cancel, ok := ae.cancels[uuid]; ok {
+		cancel()
+		delete(ae.cancels, uuid)
+	}
+}
+
+// Check whether an execution is running.
+func (ae *ActiveExecutions) Active(uuid string) bool {
+	ae.mutex.Lock()
+	defer ae.mutex.Unlock()
+	_, ok := ae.cancels[uuid]
+	return ok
+}
+
+// Return the number of running executions.
+func (ae *ActiveExecutions) Len() int {
+	ae.mutex.Lock()
+	defer ae.mutex.Unlock()
+	return len(ae.cancels)
+}
+
+// Cancel a running execution, returning whether it was found.
+func (ae *ActiveExecutions) Cancel(uuid string) bool {
+	ae.mutex.Lock()
+	defer ae.mutex.Unlock()
+	cancel, ok := ae.cancels[uuid]
+	if ok {
+		cancel()
+		delete(ae.cancels, uuid)
+	}
+	return ok
+}
+
+// Cancel the execution of an incident, whether it is queued, awaiting approval or collecting
+// results, and delete the recipe Jobs and ConfigMaps of the incident. Resources labelled to be
+// retained are kept.
+func CancelIncident(ctx context.Context, uuid string, config *Config) (*Incident, error) {
+	incident, ok := incidentRegistry.Get(uuid)
+	if !ok {
+		return nil, errIncidentNotFound
+	}
+	if incidentEnded(incident.State) {
+		return incident, errIncidentNotActive
+	}
+
+	queued := executionQueue != nil && executionQueue.Cancel(uuid)
+	running := activeExecutions.Cancel(uuid)
+	incidentRegistry.Cancel(uuid)
+	logger.Info(
+		"Incident cancelled",
+		zap.String("uuid", uuid),
+		zap.Bool("queued", queued),
+		zap.Bool("running", running),
+	)
+
+	// The cleanup of the execution is cancelled along with it, so the resources are deleted here
+	err := deleteIncidentResources(ctx, uuid, catalogTargets(config))
+	incidentRegistry.CleanupFinished(uuid, nil, err)
+	incident, _ = incidentRegistry.Get(uuid)
+	return incident, err
+}
+
+// Delete the Jobs and ConfigMaps of an incident in the given targets, including the Jobs that are
+// still running.
+func deleteIncidentResources(ctx context.Context, uuid string, targets []RecipeTarget) error {
+	propagationPolicy := metav1.DeletePropagationBackground
+	deleteOptions := metav1.DeleteOptions{PropagationPolicy: &propagationPolicy}
+	listOptions := metav1.ListOptions{
+		LabelSelector: cleanupLabelSelector(map[string]string{"app": "euphrosyne", "uuid": uuid}),
+	}
+
+	var errs []error
+	for _, target := range targets {
+		logger.Info(
+			"Deleting the resources of cancelled incident",
+			zap.String("labelSelector", listOptions.LabelSelector),
+			zap.Stringer("target", target),
+		)
+		client, err := clientsetFor(target.Cluster)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		jobErr := client.BatchV1().Jobs(target.Namespace).DeleteCollection(
+			ctx, deleteOptions, listOptions,
+		)
+		if jobErr != nil {
+			cleanupFailures.WithLabelValues("jobs").Inc()
+			errs = append(errs, fmt.Errorf("Target '%s': %w", target, jobErr))
+		}
+		cmErr := client.CoreV1().ConfigMaps(target.Namespace).DeleteCollection(
+			ctx, deleteOptions, listOptions,
+		)
+		if cmErr != nil {
+			cleanupFailures.WithLabelValues("configmaps").Inc()
+			errs = append(errs, fmt.Errorf("Target '%s': %w", target, cmErr))
+		}
+	}
+	return errors.Join(errs...)
+}
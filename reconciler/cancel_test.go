@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that tracked executions can be cancelled once, and are released when they complete.
+func TestActiveExecutions(t *testing.T) {
+	ae := NewActiveExecutions()
+
+	ctx := ae.Track(context.Background(), "active-1")
+	assert.Nil(t, ctx.Err())
+	assert.True(t, ae.Active("active-1"))
+	assert.True(t, ae.Cancel("active-1"))
+	assert.False(t, ae.Active("active-1"))
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+	assert.False(t, ae.Cancel("active-1"))
+
+	ctx = ae.Track(context.Background(), "active-2")
+	ae.Unregister("active-2")
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+	assert.False(t, ae.Cancel("active-2"))
+}
+
+// Test that the Kubernetes API requests and the cleanup of an execution are cancelled along with
+// the execution.
+func TestExecutionContextCancelled(t *testing.T) {
+	ae := NewActiveExecutions()
+	r := &Reconciler{uuid: "cancelled-execution"}
+	r.ctx = ae.Track(context.Background(), r.uuid)
+
+	ctx, cancel := r.requestContext()
+	defer cancel()
+	deadline, ok := ctx.Deadline()
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(kubeRequestTimeout), deadline, time.Second)
+
+	ae.Cancel(r.uuid)
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+	// The resources of the execution are deleted by the cancellation rather than the cleanup
+	incidentRegistry.Register(r.uuid, Alert)
+	r.Cleanup(nil)
+	incident, _ := incidentRegistry.Get(r.uuid)
+	assert.Equal(t, CleanupStatePending, incident.Cleanup.State)
+}
+
+// Test that cancelled incidents and their running recipes are recorded as cancelled, even once
+// their execution completes.
+func TestIncidentRegistryCancel(t *testing.T) {
+	uuid := "cancelled-incident"
+	incidentRegistry.Register(uuid, Alert)
+	incidentRegistry.RecipeLaunched(uuid, "diagnose", "diagnose-abcde", 1)
+	incidentRegistry.RecipeWaiting(uuid, "remediate", []string{"diagnose"})
+
+	incidentRegistry.Cancel(uuid)
+	incidentRegistry.Complete(uuid)
+
+	incident, ok := incidentRegistry.Get(uuid)
+	assert.True(t, ok)
+	assert.Equal(t, IncidentStateCancelled, incident.State)
+	assert.NotNil(t, incident.CompletedAt)
+	assert.Equal(t, RecipeStateCancelled, incident.Recipes["diagnose"].State)
+	assert.Equal(t, RecipeStateCancelled, incident.Recipes["remediate"].State)
+}
+
+// Test that only known incidents that are still active can be cancelled.
+func TestCancelIncidentRequest(t *testing.T) {
+	incidentRegistry.Register("completed-incident", Alert)
+	incidentRegistry.Complete("completed-incident")
+
+	testCases := []struct {
+		name   string
+		uuid   string
+		status int
+		code   string
+	}{
+		{
+			name:   "NotFound",
+			uuid:   "unknown-incident",
+			status: http.StatusNotFound,
+			code:   IncidentNotFoundProblem,
+		},
+		{
+			name:   "NotActive",
+			uuid:   "completed-incident",
+			status: http.StatusConflict,
+			code:   IncidentNotActiveProblem,
+		},
+	}
+
+	router := gin.New()
+	router.POST("/incidents/:uuid/cancel", func(c *gin.Context) {
+		handleCancelIncidentRequest(c, &Config{})
+	})
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(
+				recorder,
+				httptest.NewRequest(http.MethodPost, "/incidents/"+tc.uuid+"/cancel", nil),
+			)
+			assert.Equal(t, tc.status, recorder.Code)
+			var problem Problem
+			assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &problem))
+			assert.Equal(t, tc.code, problem.Code)
+		})
+	}
+}
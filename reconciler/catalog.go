@@ -0,0 +1,416 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	debuggingRecipesKey = "debugging"
+	actionRecipesKey    = "actions"
+	routingRulesKey     = "routing"
+	pollQueriesKey      = "queries"
+	nodeProblemsKey     = "nodeProblems"
+	requiredRecipesKey  = "required"
+)
+
+// Label used to discover additional ConfigMaps holding shards of the recipe catalog.
+const catalogShardLabel = "euphrosyne.io/recipe-catalog"
+
+const (
+	// Maximum size of the data stored in a ConfigMap.
+	configMapSizeLimit = 1024 * 1024
+	// Fraction of the ConfigMap size limit above which a warning is raised.
+	catalogSizeWarningRatio = 0.8
+)
+
+// RecipeCatalog holds the recipes loaded from the recipes ConfigMaps, along with information
+// identifying the exact version that was loaded.
+type RecipeCatalog struct {
+	Source          string                  `json:"source"`
+	ResourceVersion string                  `json:"resourceVersion"`
+	LoadedAt        time.Time               `json:"loadedAt"`
+	Hash            string                  `json:"hash"`
+	Shards          []CatalogShard          `json:"shards"`
+	Warnings        []string                `json:"warnings,omitempty"`
+	Debugging       map[string]RecipeConfig `json:"debugging"`
+	Actions         map[string]RecipeConfig `json:"actions"`
+	Routing         []RoutingRule           `json:"routing"`
+	Queries         []PollQuery             `json:"queries"`
+	NodeProblems    []NodeProblemRule       `json:"nodeProblems"`
+	Required        []RequiredRecipeRule    `json:"required"`
+}
+
+// CatalogShard identifies one of the ConfigMaps the recipe catalog was loaded from.
+type CatalogShard struct {
+	Source          string `json:"source"`
+	ResourceVersion string `json:"resourceVersion"`
+	Size            int    `json:"size"`
+}
+
+var (
+	catalog      *RecipeCatalog
+	catalogMutex sync.RWMutex
+)
+
+// Load the recipe catalog from the recipes ConfigMap in the specified namespace, merging any
+// additional shards discovered through the catalog label.
+func loadRecipeCatalog(namespace string) (*RecipeCatalog, error) {
+	cmClient := clientset.CoreV1().ConfigMaps(namespace)
+
+	var configMaps []*corev1.ConfigMap
+	configMap, err := cmClient.Get(context.TODO(), configMapName, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+	if err == nil {
+		configMaps = append(configMaps, configMap)
+	}
+
+	shardList, listErr := cmClient.List(
+		context.TODO(), metav1.ListOptions{LabelSelector: catalogShardLabel + "=true"},
+	)
+	if listErr != nil {
+		return nil, listErr
+	}
+	sort.Slice(shardList.Items, func(i, j int) bool {
+		return shardList.Items[i].Name < shardList.Items[j].Name
+	})
+	for i := range shardList.Items {
+		if shardList.Items[i].Name != configMapName {
+			configMaps = append(configMaps, &shardList.Items[i])
+		}
+	}
+
+	if len(configMaps) == 0 {
+		return nil, err
+	}
+	return parseRecipeCatalog(configMaps...)
+}
+
+// Parse the recipe catalog from the recipes ConfigMaps. Recipes and routing rules are merged
+// across ConfigMaps, rejecting any duplicates, and validated as a whole.
+func parseRecipeCatalog(configMaps ...*corev1.ConfigMap) (*RecipeCatalog, error) {
+	rc := &RecipeCatalog{
+		LoadedAt:  time.Now().UTC(),
+		Debugging: make(map[string]RecipeConfig),
+		Actions:   make(map[string]RecipeConfig),
+	}
+
+	var sources, resourceVersions []string
+	h := sha256.New()
+	for _, configMap := range configMaps {
+		shard := CatalogShard{
+			Source:          fmt.Sprintf("configmap/%s/%s", configMap.Namespace, configMap.Name),
+			ResourceVersion: configMap.ResourceVersion,
+			Size:            configMapSize(configMap),
+		}
+		rc.Shards = append(rc.Shards, shard)
+		sources = append(sources, shard.Source)
+		resourceVersions = append(resourceVersions, shard.ResourceVersion)
+		h.Write([]byte(hashRecipeData(configMap.Data)))
+
+		if float64(shard.Size) >= configMapSizeLimit*catalogSizeWarningRatio {
+			rc.Warnings = append(rc.Warnings, fmt.Sprintf(
+				"ConfigMap '%s' is approaching the size limit (%d of %d bytes), consider"+
+					" moving recipes to another shard",
+				configMap.Name, shard.Size, configMapSizeLimit,
+			))
+		}
+		if err := rc.mergeShard(configMap); err != nil {
+			return nil, fmt.Errorf("ConfigMap '%s': %w", configMap.Name, err)
+		}
+	}
+	rc.Source = strings.Join(sources, ",")
+	rc.ResourceVersion = strings.Join(resourceVersions, ",")
+	rc.Hash = hex.EncodeToString(h.Sum(nil))
+
+	if err := validateRecipeDependencies(rc.Debugging); err != nil {
+		return nil, fmt.Errorf("Invalid debugging recipes: %w", err)
+	}
+	if err := validateRecipeDependencies(rc.Actions); err != nil {
+		return nil, fmt.Errorf("Invalid action recipes: %w", err)
+	}
+	if err := validateRecipeParams(rc.Debugging); err != nil {
+		return nil, fmt.Errorf("Invalid debugging recipes: %w", err)
+	}
+	if err := validateRecipeParams(rc.Actions); err != nil {
+		return nil, fmt.Errorf("Invalid action recipes: %w", err)
+	}
+	if err := validateRecipeTransforms(rc.Debugging); err != nil {
+		return nil, fmt.Errorf("Invalid debugging recipes: %w", err)
+	}
+	if err := validateRecipeTransforms(rc.Actions); err != nil {
+		return nil, fmt.Errorf("Invalid action recipes: %w", err)
+	}
+	if err := validateRecipeTargets(rc.Debugging); err != nil {
+		return nil, err
+	}
+	if err := validateRecipeTargets(rc.Actions); err != nil {
+		return nil, err
+	}
+	if err := validateRecipeCleanup(rc.Debugging); err != nil {
+		return nil, fmt.Errorf("Invalid debugging recipes: %w", err)
+	}
+	if err := validateRecipeCleanup(rc.Actions); err != nil {
+		return nil, fmt.Errorf("Invalid action recipes: %w", err)
+	}
+	if err := validateRecipeDocs(rc.Debugging); err != nil {
+		return nil, fmt.Errorf("Invalid debugging recipes: %w", err)
+	}
+	if err := validateRecipeDocs(rc.Actions); err != nil {
+		return nil, fmt.Errorf("Invalid action recipes: %w", err)
+	}
+	if err := validateRecipeSchedules(rc); err != nil {
+		return nil, err
+	}
+	for _, rule := range rc.Routing {
+		for _, recipeName := range rule.Verification {
+			if _, ok := rc.Debugging[recipeName]; !ok {
+				return nil, fmt.Errorf(
+					"Routing rule for alert '%s' refers to unknown verification recipe '%s'",
+					rule.Alertname, recipeName,
+				)
+			}
+		}
+	}
+	for _, rule := range rc.NodeProblems {
+		for _, recipeName := range rule.Recipes {
+			if _, ok := rc.Debugging[recipeName]; !ok {
+				return nil, fmt.Errorf(
+					"Node problem rule for condition '%s' refers to unknown recipe '%s'",
+					rule.Condition, recipeName,
+				)
+			}
+		}
+	}
+	for _, rule := range rc.Required {
+		for _, recipeName := range rule.Recipes {
+			if _, ok := rc.Debugging[recipeName]; !ok {
+				return nil, fmt.Errorf(
+					"Required recipe rule '%s' refers to unknown recipe '%s'",
+					rule.Name, recipeName,
+				)
+			}
+		}
+	}
+
+	return rc, nil
+}
+
+// Merge the recipes, routing rules, PromQL queries, node problem rules and required recipe rules of
+// a ConfigMap into the catalog.
+func (rc *RecipeCatalog) mergeShard(configMap *corev1.ConfigMap) error {
+	var debugging, actions map[string]RecipeConfig
+	var routing []RoutingRule
+	var queries []PollQuery
+	var nodeProblems []NodeProblemRule
+	var required []RequiredRecipeRule
+
+	err := yaml.Unmarshal([]byte(configMap.Data[debuggingRecipesKey]), &debugging)
+	if err != nil {
+		return fmt.Errorf("Failed to parse debugging recipes: %w", err)
+	}
+	err = yaml.Unmarshal([]byte(configMap.Data[actionRecipesKey]), &actions)
+	if err != nil {
+		return fmt.Errorf("Failed to parse action recipes: %w", err)
+	}
+	err = yaml.Unmarshal([]byte(configMap.Data[routingRulesKey]), &routing)
+	if err != nil {
+		return fmt.Errorf("Failed to parse routing rules: %w", err)
+	}
+	err = yaml.Unmarshal([]byte(configMap.Data[pollQueriesKey]), &queries)
+	if err != nil {
+		return fmt.Errorf("Failed to parse PromQL queries: %w", err)
+	}
+	err = yaml.Unmarshal([]byte(configMap.Data[nodeProblemsKey]), &nodeProblems)
+	if err != nil {
+		return fmt.Errorf("Failed to parse node problem rules: %w", err)
+	}
+	err = yaml.Unmarshal([]byte(configMap.Data[requiredRecipesKey]), &required)
+	if err != nil {
+		return fmt.Errorf("Failed to parse required recipe rules: %w", err)
+	}
+
+	for recipeName, recipeConfig := range debugging {
+		if _, ok := rc.Debugging[recipeName]; ok {
+			return fmt.Errorf("Debugging recipe '%s' is defined more than once", recipeName)
+		}
+		rc.Debugging[recipeName] = recipeConfig
+	}
+	for recipeName, recipeConfig := range actions {
+		if _, ok := rc.Actions[recipeName]; ok {
+			return fmt.Errorf("Action recipe '%s' is defined more than once", recipeName)
+		}
+		rc.Actions[recipeName] = recipeConfig
+	}
+	for _, rule := range routing {
+		if rule.Alertname == "" {
+			return fmt.Errorf("Routing rules must specify an alertname")
+		}
+		if _, ok := rc.RoutingRule(rule.Alertname); ok {
+			return fmt.Errorf(
+				"Routing rule for alert '%s' is defined more than once", rule.Alertname,
+			)
+		}
+		rc.Routing = append(rc.Routing, rule)
+	}
+	for _, query := range queries {
+		if err := query.validate(); err != nil {
+			return err
+		}
+		for _, existing := range rc.Queries {
+			if existing.Alertname == query.Alertname {
+				return fmt.Errorf(
+					"PromQL query for alert '%s' is defined more than once", query.Alertname,
+				)
+			}
+		}
+		rc.Queries = append(rc.Queries, query)
+	}
+	for _, rule := range nodeProblems {
+		if err := rule.validate(); err != nil {
+			return err
+		}
+		if _, ok := rc.NodeProblemRule(rule.Condition); ok {
+			return fmt.Errorf(
+				"Node problem rule for condition '%s' is defined more than once", rule.Condition,
+			)
+		}
+		rc.NodeProblems = append(rc.NodeProblems, rule)
+	}
+	for _, rule := range required {
+		if err := rule.validate(); err != nil {
+			return err
+		}
+		for _, existing := range rc.Required {
+			if existing.Name == rule.Name {
+				return fmt.Errorf(
+					"Required recipe rule '%s' is defined more than once", rule.Name,
+				)
+			}
+		}
+		rc.Required = append(rc.Required, rule)
+	}
+	return nil
+}
+
+// Compute the size of the data stored in a ConfigMap.
+func configMapSize(configMap *corev1.ConfigMap) int {
+	size := 0
+	for k, v := range configMap.Data {
+		size += len(k) + len(v)
+	}
+	for k, v := range configMap.BinaryData {
+		size += len(k) + len(v)
+	}
+	return size
+}
+
+// Compute a hash identifying the recipe definitions in the ConfigMap data.
+func hashRecipeData(data map[string]string) string {
+	h := sha256.New()
+	keys := []string{
+		debuggingRecipesKey, actionRecipesKey, routingRulesKey, pollQueriesKey, nodeProblemsKey,
+		requiredRecipesKey,
+	}
+	for _, key := range keys {
+		fmt.Fprintf(h, "%s\x00%s\x00", key, data[key])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Reload the recipe catalog from the recipes ConfigMaps, replacing the one currently in use.
+func ReloadRecipeCatalog(namespace string) (*RecipeCatalog, error) {
+	rc, err := loadRecipeCatalog(namespace)
+	configStatus.Record(CatalogConfigSource, err)
+	if err != nil {
+		return nil, err
+	}
+
+	catalogMutex.Lock()
+	catalog = rc
+	catalogMutex.Unlock()
+
+	logger.Info(
+		"Recipe catalog loaded",
+		zap.String("source", rc.Source),
+		zap.String("hash", rc.Hash),
+		zap.String("resourceVersion", rc.ResourceVersion),
+	)
+	catalogShardSize.Reset()
+	for _, shard := range rc.Shards {
+		catalogShardSize.WithLabelValues(shard.Source).Set(float64(shard.Size))
+	}
+	for _, warning := range rc.Warnings {
+		logger.Warn(warning)
+	}
+	auditLog.Record(AuditCatalogLoaded, "", map[string]interface{}{
+		"source":          rc.Source,
+		"hash":            rc.Hash,
+		"resourceVersion": rc.ResourceVersion,
+	})
+	return rc, nil
+}
+
+// Return the recipe catalog currently in use, loading it if necessary.
+func getRecipeCatalog(namespace string) (*RecipeCatalog, error) {
+	catalogMutex.RLock()
+	rc := catalog
+	catalogMutex.RUnlock()
+
+	if rc != nil {
+		return rc, nil
+	}
+	return ReloadRecipeCatalog(namespace)
+}
+
+// Return the recipes of the catalog for the specified request type, optionally filtering by
+// enabled status.
+func (rc *RecipeCatalog) Recipes(requestType RequestType, filterEnabled bool) map[string]Recipe {
+	recipeConfigs := rc.Debugging
+	if requestType == Actions {
+		recipeConfigs = rc.Actions
+	}
+
+	recipeMap := make(map[string]Recipe)
+	for recipeName, recipeConfig := range recipeConfigs {
+		recipeConfigCopy := recipeConfig
+		if recipeConfigCopy.Enabled || !filterEnabled {
+			recipeMap[recipeName] = Recipe{Config: &recipeConfigCopy}
+		}
+	}
+	return recipeMap
+}
+
+// Return the node problem rule for the specified node condition, if any.
+func (rc *RecipeCatalog) NodeProblemRule(condition string) (NodeProblemRule, bool) {
+	for _, rule := range rc.NodeProblems {
+		if rule.Condition == condition {
+			return rule, true
+		}
+	}
+	return NodeProblemRule{}, false
+}
+
+// Return the routing rule for the specified alert name, if any.
+func (rc *RecipeCatalog) RoutingRule(alertname string) (RoutingRule, bool) {
+	for _, rule := range rc.Routing {
+		if rule.Alertname == alertname {
+			return rule, true
+		}
+	}
+	return RoutingRule{}, false
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Test that the recipe catalog is parsed and identified by the hash of the recipe definitions.
+func TestParseRecipeCatalog(t *testing.T) {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            testConfigMapName,
+			Namespace:       testNamespace,
+			ResourceVersion: "42",
+		},
+		Data: configMap,
+	}
+
+	rc, err := parseRecipeCatalog(cm)
+	assert.Nil(t, err)
+	assert.Equal(t, "configmap/orpheus-test/orpheus-operator-recipes-test", rc.Source)
+	assert.Equal(t, "42", rc.ResourceVersion)
+	assert.Equal(t, 2, len(rc.Debugging))
+	assert.Equal(t, 2, len(rc.Actions))
+	assert.Equal(t, 1, len(rc.Recipes(Alert, true)))
+	assert.Equal(t, recipe_2, rc.Recipes(Actions, true)["test-2-recipe"])
+
+	// The hash only changes when the recipe definitions change
+	cm.ResourceVersion = "43"
+	same, err := parseRecipeCatalog(cm)
+	assert.Nil(t, err)
+	assert.Equal(t, rc.Hash, same.Hash)
+
+	cm.Data = map[string]string{"debugging": recipe_1_config, "actions": actionsRecipes}
+	changed, err := parseRecipeCatalog(cm)
+	assert.Nil(t, err)
+	assert.NotEqual(t, rc.Hash, changed.Hash)
+
+	// Invalid definitions are rejected
+	cm.Data = map[string]string{"debugging": "- not a map"}
+	_, err = parseRecipeCatalog(cm)
+	assert.NotNil(t, err)
+
+	// Cyclic dependencies are rejected
+	cm.Data = map[string]string{"actions": `
+a:
+  dependsOn: [b]
+b:
+  dependsOn: [a]
+`}
+	_, err = parseRecipeCatalog(cm)
+	assert.NotNil(t, err)
+
+	// PromQL queries are parsed and validated
+	cm.Data = map[string]string{"queries": `
+- alertname: HighErrorRate
+  expr: sum(rate(http_errors_total[5m]))
+  threshold: 10
+`}
+	rc, err = parseRecipeCatalog(cm)
+	assert.Nil(t, err)
+	assert.Equal(t, "HighErrorRate", rc.Queries[0].Alertname)
+	assert.True(t, rc.Queries[0].crossed(11))
+
+	cm.Data = map[string]string{"queries": `
+- alertname: HighErrorRate
+  expr: sum(rate(http_errors_total[5m]))
+  operator: "~"
+`}
+	_, err = parseRecipeCatalog(cm)
+	assert.NotNil(t, err)
+
+	// Node problem rules are parsed and may only refer to debugging recipes
+	cm.Data = map[string]string{"debugging": recipe_1_config, "nodeProblems": `
+- condition: KernelDeadlock
+  recipes: [test-1-recipe]
+`}
+	rc, err = parseRecipeCatalog(cm)
+	assert.Nil(t, err)
+	rule, ok := rc.NodeProblemRule("KernelDeadlock")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"test-1-recipe"}, rule.Recipes)
+
+	cm.Data = map[string]string{"nodeProblems": `
+- condition: KernelDeadlock
+  recipes: [unknown-recipe]
+`}
+	_, err = parseRecipeCatalog(cm)
+	assert.NotNil(t, err)
+
+	// Verification recipes may only refer to debugging recipes
+	cm.Data = map[string]string{"routing": `
+- alertname: HighErrorRate
+  verification: [unknown-recipe]
+`}
+	_, err = parseRecipeCatalog(cm)
+	assert.NotNil(t, err)
+
+	// Required recipe rules are parsed and may only refer to debugging recipes
+	cm.Data = map[string]string{"debugging": recipe_1_config, "required": `
+- name: sev1-evidence
+  match: {severity: sev1}
+  recipes: [test-1-recipe]
+`}
+	rc, err = parseRecipeCatalog(cm)
+	assert.Nil(t, err)
+	assert.Equal(t, []RequiredRecipeRule{{
+		Name:    "sev1-evidence",
+		Match:   map[string]string{"severity": "sev1"},
+		Recipes: []string{"test-1-recipe"},
+	}}, rc.Required)
+
+	cm.Data = map[string]string{"required": `
+- name: sev1-evidence
+  recipes: [unknown-recipe]
+`}
+	_, err = parseRecipeCatalog(cm)
+	assert.NotNil(t, err)
+
+	cm.Data = map[string]string{"required": `
+- recipes: [test-1-recipe]
+`}
+	_, err = parseRecipeCatalog(cm)
+	assert.NotNil(t, err)
+}
+
+// Test that the recipe catalog is merged across shards, rejecting duplicate definitions.
+func TestParseRecipeCatalogShards(t *testing.T) {
+	primary := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "recipes", Namespace: testNamespace},
+		Data:       map[string]string{"debugging": recipe_1_config},
+	}
+	shard := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "recipes-shard-1", Namespace: testNamespace},
+		Data: map[string]string{
+			"actions": actionsRecipes,
+			"debugging": `
+test-3-recipe:
+  enabled: true
+  dependsOn: [test-1-recipe]
+`,
+		},
+	}
+
+	rc, err := parseRecipeCatalog(primary, shard)
+	assert.Nil(t, err)
+	assert.Equal(
+		t, "configmap/orpheus-test/recipes,configmap/orpheus-test/recipes-shard-1", rc.Source,
+	)
+	assert.Equal(t, 2, len(rc.Shards))
+	assert.Equal(t, 2, len(rc.Debugging))
+	assert.Equal(t, 2, len(rc.Actions))
+	assert.Empty(t, rc.Warnings)
+
+	// Recipes cannot be defined in more than one shard
+	_, err = parseRecipeCatalog(primary, shard, primary)
+	assert.NotNil(t, err)
+
+	// Shards approaching the ConfigMap size limit raise a warning
+	shard.Data["padding"] = strings.Repeat("#", configMapSizeLimit*9/10)
+	rc, err = parseRecipeCatalog(primary, shard)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(rc.Warnings))
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Supported ChatOps providers for incident threads.
+const (
+	SlackChatOpsProvider = "slack"
+	TeamsChatOpsProvider = "teams"
+)
+
+const (
+	// Default APIs of the ChatOps providers
+	defaultSlackEndpoint = "https://slack.com/api"
+	defaultTeamsEndpoint = "https://graph.microsoft.com/v1.0"
+	// Time allowed for each message posted to a thread
+	chatOpsTimeout = 10 * time.Second
+)
+
+// ChatThread is the conversation following an incident on a ChatOps provider.
+type ChatThread struct {
+	Provider string `json:"provider"`
+	Channel  string `json:"channel"`
+	// ID of the message starting the thread, which replies are attached to
+	ID string `json:"id"`
+}
+
+// ChatOps posts the progress of incidents to a thread per incident.
+type ChatOps interface {
+	// Start a thread with the given message.
+	StartThread(ctx context.Context, text string) (*ChatThread, error)
+	// Reply to a thread with the given message.
+	Reply(ctx context.Context, thread *ChatThread, text string) error
+}
+
+// ChatOps provider of the incident threads, nil unless configured.
+var chatOps ChatOps
+
+// Check whether the provided ChatOps provider is supported.
+func isValidChatOpsProvider(provider string) bool {
+	return provider == "" || provider == SlackChatOpsProvider || provider == TeamsChatOpsProvider
+}
+
+// Check that the settings required by the ChatOps provider are provided.
+func validateChatOps(config *Config) error {
+	if !isValidChatOpsProvider(config.ChatOpsProvider) {
+		return fmt.Errorf("Unsupported ChatOps provider '%s'", config.ChatOpsProvider)
+	}
+	if config.ChatOpsProvider == "" {
+		if config.ChatOpsSigningSecret != "" {
+			return fmt.Errorf("ChatOps callbacks require a ChatOps provider")
+		}
+		return nil
+	}
+	if config.ChatOpsChannel == "" || config.ChatOpsToken == "" {
+		return fmt.Errorf(
+			"A channel and a token are required for the '%s' ChatOps provider",
+			config.ChatOpsProvider,
+		)
+	}
+	if config.ChatOpsProvider == TeamsChatOpsProvider {
+		if _, _, ok := parseTeamsChannel(config.ChatOpsChannel); !ok {
+			return fmt.Errorf(
+				"Invalid Teams channel '%s', expected <team-id>/<channel-id>",
+				config.ChatOpsChannel,
+			)
+		}
+		// Teams shares the secret of outgoing webhooks encoded in base64
+		if _, err := base64.StdEncoding.DecodeString(config.ChatOpsSigningSecret); err != nil {
+			return fmt.Errorf("Invalid ChatOps signing secret, expected base64: %w", err)
+		}
+	}
+	return nil
+}
+
+// Create the client of the configured ChatOps provider, or nil if none is configured.
+func NewChatOps(config *Config) ChatOps {
+	switch config.ChatOpsProvider {
+	case SlackChatOpsProvider:
+		endpoint := config.ChatOpsEndpoint
+		if endpoint == "" {
+			endpoint = defaultSlackEndpoint
+		}
+		return &slackChatOps{
+			endpoint: endpoint, channel: config.ChatOpsChannel, token: config.ChatOpsToken,
+		}
+	case TeamsChatOpsProvider:
+		endpoint := config.ChatOpsEndpoint
+		if endpoint == "" {
+			endpoint = defaultTeamsEndpoint
+		}
+		team, channel, _ := parseTeamsChannel(config.ChatOpsChannel)
+		return &teamsChatOps{
+			endpoint: endpoint, team: team, channel: channel, token: config.ChatOpsToken,
+		}
+	}
+	return nil
+}
+
+// Post a JSON request to the API of a ChatOps provider, decoding its response.
+func postChatOps(
+	ctx context.Context, url string, token string, payload interface{}, response interface{},
+) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := httpc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Unexpected response status: %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(response)
+}
+
+// slackChatOps posts incident threads to a Slack channel through the Web API.
+type slackChatOps struct {
+	endpoint string
+	channel  string
+	token    string
+}
+
+// Response of the Slack Web API, which reports errors with a 200 status.
+type slackResponse struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error"`
+	TS    string `json:"ts"`
+}
+
+// Post a message to the channel, in reply to a thread if its timestamp is provided.
+func (s *slackChatOps) post(ctx context.Context, threadTS string, text string) (string, error) {
+	payload := map[string]string{"channel": s.channel, "text": text}
+	if threadTS != "" {
+		payload["thread_ts"] = threadTS
+	}
+	var response slackResponse
+	err := postChatOps(ctx, s.endpoint+"/chat.postMessage", s.token, payload, &response)
+	if err != nil {
+		return "", err
+	}
+	if !response.OK {
+		return "", fmt.Errorf("Slack API error: %s", response.Error)
+	}
+	return response.TS, nil
+}
+
+func (s *slackChatOps) StartThread(ctx context.Context, text string) (*ChatThread, error) {
+	ts, err := s.post(ctx, "", text)
+	if err != nil {
+		return nil, err
+	}
+	return &ChatThread{Provider: SlackChatOpsProvider, Channel: s.channel, ID: ts}, nil
+}
+
+func (s *slackChatOps) Reply(ctx context.Context, thread *ChatThread, text string) error {
+	_, err := s.post(ctx, thread.ID, text)
+	return err
+}
+
+// teamsChatOps posts incident threads to a Teams channel through the Microsoft Graph API.
+type teamsChatOps struct {
+	endpoint string
+	team     string
+	channel  string
+	token    string
+}
+
+// Split a Teams channel into the IDs of its team and of the channel itself.
+func parseTeamsChannel(channel string) (string, string, bool) {
+	team, channelID, ok := strings.Cut(channel, "/")
+	return team, channelID, ok && team != "" && channelID != ""
+}
+
+// Post a message to the given path of the channel, returning its ID.
+func (t *teamsChatOps) post(ctx context.Context, path string, text string) (string, error) {
+	url := fmt.Sprintf(
+		"%s/teams/%s/channels/%s/messages%s",
+		t.endpoint, url.PathEscape(t.team), url.PathEscape(t.channel), path,
+	)
+	payload := map[string]interface{}{
+		"body": map[string]string{"contentType": "text", "content": text},
+	}
+	var response struct {
+		ID string `json:"id"`
+	}
+	if err := postChatOps(ctx, url, t.token, payload, &response); err != nil {
+		return "", err
+	}
+	return response.ID, nil
+}
+
+func (t *teamsChatOps) StartThread(ctx context.Context, text string) (*ChatThread, error) {
+	id, err := t.post(ctx, "", text)
+	if err != nil {
+		return nil, err
+	}
+	channel := t.team + "/" + t.channel
+	return &ChatThread{Provider: TeamsChatOpsProvider, Channel: channel, ID: id}, nil
+}
+
+func (t *teamsChatOps) Reply(ctx context.Context, thread *ChatThread, text string) error {
+	_, err := t.post(ctx, "/"+url.PathEscape(thread.ID)+"/replies", text)
+	return err
+}
+
+// Start the thread of an incident, recording it on the incident so that the results of its
+// recipes are posted to it, even after a restart.
+func startIncidentThread(uuid string, requestType RequestType, data map[string]interface{}) {
+	if chatOps == nil || notificationSuppressed(uuid, "thread") {
+		return
+	}
+	text := fmt.Sprintf("Running actions for incident '%s'", uuid)
+	if requestType == Alert {
+		text = fmt.Sprintf("Investigating incident '%s'", uuid)
+		if alertname := alertLabels(data)["alertname"]; alertname != "" {
+			text = fmt.Sprintf("Investigating alert '%s' (incident '%s')", alertname, uuid)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), chatOpsTimeout)
+	defer cancel()
+	thread, err := chatOps.StartThread(ctx, text)
+	if err != nil {
+		logger.Error("Failed to start incident thread", zap.String("uuid", uuid), zap.Error(err))
+		chatOpsFailures.WithLabelValues("thread").Inc()
+		return
+	}
+	incidentRegistry.Update(uuid, func(incident *Incident) {
+		incident.Thread = thread
+	})
+}
+
+// Reply to the thread of an incident, if it has one.
+func replyToIncidentThread(uuid string, text string) {
+	if chatOps == nil {
+		return
+	}
+	incident, ok := incidentRegistry.Get(uuid)
+	if !ok || incident.Thread == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), chatOpsTimeout)
+	defer cancel()
+	if err := chatOps.Reply(ctx, incident.Thread, text); err != nil {
+		logger.Error("Failed to reply to incident thread", zap.String("uuid", uuid), zap.Error(err))
+		chatOpsFailures.WithLabelValues("reply").Inc()
+	}
+}
+
+// Format the results of a recipe as a reply to the thread of its incident.
+func recipeThreadReply(recipe Recipe) string {
+	execution := recipe.Execution
+	if !execution.Succeeded() {
+		return fmt.Sprintf("Recipe '%s' %s", execution.Name, execution.Status) +
+			docsThreadLines(recipe.Config.Docs())
+	}
+	text := fmt.Sprintf("Recipe '%s' completed successfully", execution.Name)
+	if recipe.Cached {
+		text += " (cached result)"
+	}
+	if !execution.Results.IsActionable() {
+		text += " (informational)"
+	}
+	if execution.Results.Analysis != "" {
+		text += ": " + execution.Results.Analysis
+	}
+	for _, action := range execution.Results.Actions {
+		text += "\n- " + action
+	}
+	return text + docsThreadLines(recipe.Config.Docs())
+}
+
+// Format the outcome of an incident as the last reply to its thread.
+func incidentThreadReply(message IncidentBotMessage) string {
+	if len(message.Actions) == 0 {
+		return "Investigation completed, no actions suggested"
+	}
+	text := "Investigation completed, suggested actions:"
+	for _, action := range message.Actions {
+		text += "\n- " + action
+	}
+	return text
+}
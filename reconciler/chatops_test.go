@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test the validation of the ChatOps settings.
+func TestValidateChatOps(t *testing.T) {
+	testCases := []struct {
+		name     string
+		config   Config
+		expected string
+	}{
+		{name: "Disabled", config: Config{}},
+		{
+			name: "Slack",
+			config: Config{
+				ChatOpsProvider: SlackChatOpsProvider, ChatOpsChannel: "C123", ChatOpsToken: "xoxb",
+			},
+		},
+		{
+			name:     "Unsupported",
+			config:   Config{ChatOpsProvider: "irc"},
+			expected: "Unsupported ChatOps provider 'irc'",
+		},
+		{
+			name:     "MissingToken",
+			config:   Config{ChatOpsProvider: SlackChatOpsProvider, ChatOpsChannel: "C123"},
+			expected: "A channel and a token are required",
+		},
+		{
+			name: "InvalidTeamsChannel",
+			config: Config{
+				ChatOpsProvider: TeamsChatOpsProvider, ChatOpsChannel: "oncall", ChatOpsToken: "t",
+			},
+			expected: "Invalid Teams channel 'oncall'",
+		},
+		{
+			name:     "SigningSecretWithoutProvider",
+			config:   Config{ChatOpsSigningSecret: "s3cr3t"},
+			expected: "ChatOps callbacks require a ChatOps provider",
+		},
+		{
+			name: "InvalidTeamsSigningSecret",
+			config: Config{
+				ChatOpsProvider:      TeamsChatOpsProvider,
+				ChatOpsChannel:       "team/channel",
+				ChatOpsToken:         "t",
+				ChatOpsSigningSecret: "not base64",
+			},
+			expected: "Invalid ChatOps signing secret",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateChatOps(&tc.config)
+			if tc.expected == "" {
+				assert.Nil(t, err)
+			} else {
+				assert.ErrorContains(t, err, tc.expected)
+			}
+		})
+	}
+}
+
+// Test that Slack threads are started in the channel and replied to through their timestamp.
+func TestSlackChatOps(t *testing.T) {
+	var requests []map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/chat.postMessage", r.URL.Path)
+		assert.Equal(t, "Bearer xoxb-token", r.Header.Get("Authorization"))
+		var payload map[string]string
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&payload))
+		requests = append(requests, payload)
+		if payload["text"] == "fail" {
+			w.Write([]byte(`{"ok": false, "error": "channel_not_found"}`))
+			return
+		}
+		w.Write([]byte(`{"ok": true, "ts": "1700000000.000100"}`))
+	}))
+	defer server.Close()
+	httpc = server.Client()
+
+	chat := NewChatOps(&Config{
+		ChatOpsProvider: SlackChatOpsProvider,
+		ChatOpsEndpoint: server.URL,
+		ChatOpsChannel:  "C123",
+		ChatOpsToken:    "xoxb-token",
+	})
+	thread, err := chat.StartThread(context.Background(), "Investigating")
+	assert.Nil(t, err)
+	assert.Equal(t, &ChatThread{
+		Provider: SlackChatOpsProvider, Channel: "C123", ID: "1700000000.000100",
+	}, thread)
+	assert.Nil(t, chat.Reply(context.Background(), thread, "Recipe 'logs' failed"))
+	assert.ErrorContains(
+		t, chat.Reply(context.Background(), thread, "fail"), "Slack API error: channel_not_found",
+	)
+
+	assert.Equal(t, []map[string]string{
+		{"channel": "C123", "text": "Investigating"},
+		{"channel": "C123", "text": "Recipe 'logs' failed", "thread_ts": "1700000000.000100"},
+		{"channel": "C123", "text": "fail", "thread_ts": "1700000000.000100"},
+	}, requests)
+}
+
+// Test that Teams threads are started in the channel and replied to through the Graph API.
+func TestTeamsChatOps(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id": "1700000000000"}`))
+	}))
+	defer server.Close()
+	httpc = server.Client()
+
+	chat := NewChatOps(&Config{
+		ChatOpsProvider: TeamsChatOpsProvider,
+		ChatOpsEndpoint: server.URL,
+		ChatOpsChannel:  "team-1/channel-1",
+		ChatOpsToken:    "graph-token",
+	})
+	thread, err := chat.StartThread(context.Background(), "Investigating")
+	assert.Nil(t, err)
+	assert.Equal(t, "team-1/channel-1", thread.Channel)
+	assert.Nil(t, chat.Reply(context.Background(), thread, "Recipe 'logs' failed"))
+	assert.Equal(t, []string{
+		"/teams/team-1/channels/channel-1/messages",
+		"/teams/team-1/channels/channel-1/messages/1700000000000/replies",
+	}, paths)
+}
+
+// fakeChatOps records the messages posted to incident threads.
+type fakeChatOps struct {
+	messages []string
+}
+
+func (f *fakeChatOps) StartThread(ctx context.Context, text string) (*ChatThread, error) {
+	f.messages = append(f.messages, text)
+	return &ChatThread{Provider: "fake", Channel: "oncall", ID: "thread-1"}, nil
+}
+
+func (f *fakeChatOps) Reply(ctx context.Context, thread *ChatThread, text string) error {
+	f.messages = append(f.messages, thread.ID+": "+text)
+	return nil
+}
+
+// Test that the thread of an incident is recorded on it, and that recipe results are posted to it.
+func TestIncidentThread(t *testing.T) {
+	registry := incidentRegistry
+	previous := chatOps
+	defer func() { incidentRegistry, chatOps = registry, previous }()
+	incidentRegistry = NewIncidentRegistry(MemoryIncidentStore, time.Hour)
+	fake := &fakeChatOps{}
+	chatOps = fake
+
+	incidentRegistry.Register("incident-1", Alert)
+	startIncidentThread("incident-1", Alert, map[string]interface{}{
+		"commonLabels": map[string]interface{}{"alertname": "HighErrorRate"},
+	})
+	incident, _ := incidentRegistry.Get("incident-1")
+	assert.Equal(t, "thread-1", incident.Thread.ID)
+
+	replyToIncidentThread("incident-1", recipeThreadReply(NewCompletedRecipe(NewRecipeExecution(
+		"logs", "incident-1", RecipeStatusSuccessful, RecipeResults{
+			Analysis: "Pod X is crash looping", Actions: []string{"Restart pod X"},
+		},
+	))))
+	replyToIncidentThread("incident-1", recipeThreadReply(NewCompletedRecipe(NewRecipeExecution(
+		"heap-dump", "incident-1", RecipeStatusFailed, RecipeResults{},
+	))))
+	replyToIncidentThread("incident-1", incidentThreadReply(IncidentBotMessage{}))
+	// Incidents without a thread are skipped
+	replyToIncidentThread("incident-2", "Ignored")
+
+	assert.Equal(t, []string{
+		"Investigating alert 'HighErrorRate' (incident 'incident-1')",
+		"thread-1: Recipe 'logs' completed successfully: Pod X is crash looping\n- Restart pod X",
+		"thread-1: Recipe 'heap-dump' failed",
+		"thread-1: Investigation completed, no actions suggested",
+	}, fake.messages)
+}
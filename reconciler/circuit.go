@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var errCircuitOpen = errors.New("Circuit open, skipping delivery")
+
+// CircuitBreaker stops calling a flaky destination once it fails a number of times in a row. Once
+// the cooldown passes, a single trial call is let through, closing the circuit if it succeeds and
+// opening it again otherwise.
+type CircuitBreaker struct {
+	mutex     sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openedAt  time.Time
+	// Whether a trial call is in flight while the circuit is half-open
+	trial bool
+}
+
+// Initialise a closed circuit breaker, opening after the given number of consecutive failures.
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// Check whether a call is allowed, i.e. the circuit is closed, or it is half-open and no trial
+// call is in flight.
+func (cb *CircuitBreaker) Allow(now time.Time) bool {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	if cb.failures < cb.threshold {
+		return true
+	}
+	if now.Before(cb.openedAt.Add(cb.cooldown)) || cb.trial {
+		return false
+	}
+	cb.trial = true
+	return true
+}
+
+// Record a successful call, closing the circuit.
+func (cb *CircuitBreaker) Success() {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	cb.failures = 0
+	cb.trial = false
+}
+
+// Record a failed call, returning whether it opened the circuit.
+func (cb *CircuitBreaker) Failure(now time.Time) bool {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	cb.failures++
+	cb.trial = false
+	if cb.failures < cb.threshold {
+		return false
+	}
+	cb.openedAt = now
+	return true
+}
+
+// Check whether the circuit is open, i.e. calls are skipped until the cooldown passes.
+func (cb *CircuitBreaker) Open(now time.Time) bool {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+	return cb.failures >= cb.threshold && now.Before(cb.openedAt.Add(cb.cooldown))
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that the circuit opens after consecutive failures and lets a single trial through once the
+// cooldown passes.
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	cb := NewCircuitBreaker(2, time.Minute)
+
+	assert.True(t, cb.Allow(now))
+	assert.False(t, cb.Failure(now))
+	cb.Success()
+	assert.False(t, cb.Failure(now))
+	assert.True(t, cb.Allow(now))
+	assert.True(t, cb.Failure(now))
+	assert.True(t, cb.Open(now))
+	assert.False(t, cb.Allow(now.Add(30*time.Second)))
+
+	// Half-open, a single trial is let through
+	later := now.Add(time.Minute)
+	assert.False(t, cb.Open(later))
+	assert.True(t, cb.Allow(later))
+	assert.False(t, cb.Allow(later))
+
+	// A failed trial opens the circuit again
+	assert.True(t, cb.Failure(later))
+	assert.False(t, cb.Allow(later.Add(30*time.Second)))
+
+	// A successful trial closes it
+	muchLater := later.Add(time.Minute)
+	assert.True(t, cb.Allow(muchLater))
+	cb.Success()
+	assert.False(t, cb.Open(muchLater))
+	assert.True(t, cb.Allow(muchLater))
+	assert.True(t, cb.Allow(muchLater))
+}
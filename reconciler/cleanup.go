@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"go.uber.org/zap"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Policies for the cleanup of completed recipe Jobs.
+const (
+	// Jobs are deleted by the reconciler once the execution completes
+	DeleteCleanupPolicy = "delete"
+	// Jobs are deleted by Kubernetes once their `ttlSecondsAfterFinished` expires
+	TTLCleanupPolicy = "ttl"
+)
+
+// Cleanup mode of a recipe keeping its Jobs, as if they were labelled to be retained.
+const NeverRecipeCleanup = "never"
+
+// Minimum TTL of recipe Jobs. Failed Jobs have to outlive the backoff before their retry, as they
+// keep the ConfigMap holding the recipe data in place.
+const minJobTTL = maxRetryBackoff
+
+// Limits of the logs snapshotted for each recipe, keeping the most recent lines.
+const (
+	maxLogSnapshotLines = 1000
+	maxLogSnapshotBytes = 256 * 1024
+)
+
+// Check whether a cleanup policy is supported.
+func isValidCleanupPolicy(policy string) bool {
+	return policy == DeleteCleanupPolicy || policy == TTLCleanupPolicy
+}
+
+// Check that the cleanup modes and the TTLs of the recipes are supported.
+func validateRecipeCleanup(recipes map[string]RecipeConfig) error {
+	for recipeName, recipeConfig := range recipes {
+		if recipeConfig.Cleanup != "" && recipeConfig.Cleanup != NeverRecipeCleanup {
+			return fmt.Errorf(
+				"Recipe '%s' has an unsupported cleanup mode '%s', expected '%s'",
+				recipeName, recipeConfig.Cleanup, NeverRecipeCleanup,
+			)
+		}
+		if recipeConfig.TTL.Duration > 0 && recipeConfig.TTL.Duration < minJobTTL {
+			return fmt.Errorf(
+				"Recipe '%s' has a TTL of %s, expected at least %s",
+				recipeName, recipeConfig.TTL, minJobTTL,
+			)
+		}
+	}
+	return nil
+}
+
+// Apply the cleanup policy to a recipe Job. Jobs of recipes that are never cleaned up are labelled
+// to be retained, while the others are given a TTL, so that the TTL controller deletes them even if
+// the reconciler fails before cleaning up. Under the delete policy, the reconciler usually deletes
+// them well before their TTL expires.
+func applyCleanupPolicy(job *batchv1.Job, recipeConfig *RecipeConfig, config *Config) {
+	if recipeConfig.Cleanup == NeverRecipeCleanup {
+		job.Labels[retainLabel] = "true"
+		return
+	}
+	ttl := config.CleanupTTL
+	if recipeConfig.TTL.Duration > 0 {
+		ttl = recipeConfig.TTL.Duration
+	}
+	if ttl > 0 {
+		job.Spec.TTLSecondsAfterFinished = int32Ptr(int32(ttl.Seconds()))
+	}
+}
+
+// Make the Job of a recipe an owner of the ConfigMap holding its data, so that the garbage
+// collector deletes the ConfigMap once all of its Jobs are deleted, e.g. by the TTL controller.
+func ownConfigMap(ctx context.Context, cluster string, job *batchv1.Job, cmName string) error {
+	client, err := clientsetFor(cluster)
+	if err != nil {
+		return err
+	}
+	patch, err := configMapOwnerPatch(job)
+	if err != nil {
+		return err
+	}
+	_, err = client.CoreV1().ConfigMaps(job.Namespace).Patch(
+		ctx, cmName, types.StrategicMergePatchType, patch, metav1.PatchOptions{},
+	)
+	return err
+}
+
+// Build the patch adding a Job to the owners of a ConfigMap. Owner references are merged by UID,
+// so ConfigMaps shared by several recipes are owned by all of their Jobs.
+func configMapOwnerPatch(job *batchv1.Job) ([]byte, error) {
+	owner := metav1.OwnerReference{
+		APIVersion: batchv1.SchemeGroupVersion.String(),
+		Kind:       "Job",
+		Name:       job.Name,
+		UID:        job.UID,
+	}
+	return json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"ownerReferences": []metav1.OwnerReference{owner},
+		},
+	})
+}
+
+// Select the completed recipes whose Jobs are deleted by the reconciler. No Job is deleted under
+// the TTL policy, while failed Jobs are kept if configured.
+func (r *Reconciler) cleanupRecipes(completedRecipes []Recipe) []Recipe {
+	if r.config.CleanupPolicy == TTLCleanupPolicy {
+		return nil
+	}
+	var recipes []Recipe
+	for _, recipe := range completedRecipes {
+		if r.config.KeepFailedJobs > 0 && !recipeSucceeded(recipe) {
+			continue
+		}
+		recipes = append(recipes, recipe)
+	}
+	return recipes
+}
+
+// Check whether the Jobs of a recipe are never cleaned up.
+func neverCleanedUp(recipe Recipe) bool {
+	return recipe.Config != nil && recipe.Config.Cleanup == NeverRecipeCleanup
+}
+
+// Check whether a recipe completed successfully.
+func recipeSucceeded(recipe Recipe) bool {
+	return recipe.Execution.Succeeded()
+}
+
+// Keep the Jobs of the recipes that did not complete successfully for debugging, setting their
+// TTL so that Kubernetes deletes them once the configured time has passed.
+func (r *Reconciler) keepFailedJobs(completedRecipes []Recipe) error {
+	if r.config.KeepFailedJobs <= 0 {
+		return nil
+	}
+	succeeded := make(map[string]bool)
+	for _, recipe := range completedRecipes {
+		if recipeSucceeded(recipe) {
+			succeeded[recipe.Execution.Name] = true
+		}
+	}
+
+	ttl := int64(r.config.KeepFailedJobs.Seconds())
+	patch := []byte(fmt.Sprintf(`{"spec":{"ttlSecondsAfterFinished":%d}}`, ttl))
+	for recipeName, rj := range r.jobs {
+		if succeeded[recipeName] || neverCleanedUp(r.recipes[recipeName]) {
+			continue
+		}
+		target := r.recipeTarget(recipeName)
+		logger.Info(
+			"Keeping failed recipe Job",
+			zap.String("recipe", recipeName),
+			zap.String("jobName", rj.jobName),
+			zap.Stringer("target", target),
+			zap.Duration("ttl", r.config.KeepFailedJobs),
+		)
+		client, err := clientsetFor(target.Cluster)
+		if err != nil {
+			return err
+		}
+		ctx, cancel := r.requestContext()
+		_, err = client.BatchV1().Jobs(target.Namespace).Patch(
+			ctx, rj.jobName, types.MergePatchType, patch, metav1.PatchOptions{},
+		)
+		cancel()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Snapshot the logs of the recipe Pods before their Jobs are deleted, so that they are persisted
+// along with the incident record.
+func (r *Reconciler) snapshotLogs() error {
+	if !r.config.SnapshotLogs {
+		return nil
+	}
+	var errs []error
+	r.logs = make(map[string]string, len(r.jobs))
+	for recipeName, rj := range r.jobs {
+		ctx, cancel := r.requestContext()
+		logs, err := getJobLogs(ctx, r.recipeTarget(recipeName), rj.jobName)
+		cancel()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Recipe '%s': %w", recipeName, err))
+			continue
+		}
+		r.logs[recipeName] = logs
+	}
+	return errors.Join(errs...)
+}
+
+// Read the most recent logs of the recipe container from the latest Pod of a Job.
+func getJobLogs(ctx context.Context, target RecipeTarget, jobName string) (string, error) {
+	client, err := clientsetFor(target.Cluster)
+	if err != nil {
+		return "", err
+	}
+	namespace := target.Namespace
+	labelSelector := metav1.FormatLabelSelector(&metav1.LabelSelector{
+		MatchLabels: map[string]string{"job-name": jobName},
+	})
+	podList, err := client.CoreV1().Pods(namespace).List(
+		ctx, metav1.ListOptions{LabelSelector: labelSelector},
+	)
+	if err != nil {
+		return "", err
+	}
+	var latest *corev1.Pod
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		if latest == nil || latest.CreationTimestamp.Before(&pod.CreationTimestamp) {
+			latest = pod
+		}
+	}
+	if latest == nil {
+		return "", nil
+	}
+
+	lines, limit := int64(maxLogSnapshotLines), int64(maxLogSnapshotBytes)
+	stream, err := client.CoreV1().Pods(namespace).GetLogs(latest.Name, &corev1.PodLogOptions{
+		Container:  "recipe-container",
+		TailLines:  &lines,
+		LimitBytes: &limit,
+	}).Stream(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer stream.Close()
+	logs, err := io.ReadAll(stream)
+	return string(logs), err
+}
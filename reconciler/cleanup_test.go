@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Test the validation of the cleanup modes of recipes.
+func TestValidateRecipeCleanup(t *testing.T) {
+	assert.Nil(t, validateRecipeCleanup(map[string]RecipeConfig{
+		"heap-dump": {Cleanup: NeverRecipeCleanup},
+		"logs":      {},
+	}))
+	assert.ErrorContains(t, validateRecipeCleanup(map[string]RecipeConfig{
+		"heap-dump": {Cleanup: "always"},
+	}), "Recipe 'heap-dump' has an unsupported cleanup mode 'always'")
+	assert.ErrorContains(t, validateRecipeCleanup(map[string]RecipeConfig{
+		"heap-dump": {TTL: Duration{time.Minute}},
+	}), "Recipe 'heap-dump' has a TTL of 1m0s, expected at least 10m0s")
+}
+
+// Test that recipe Jobs are given a TTL or labelled to be retained according to the policy.
+func TestApplyCleanupPolicy(t *testing.T) {
+	testCases := []struct {
+		name       string
+		policy     string
+		cleanupTTL time.Duration
+		recipe     RecipeConfig
+		ttl        *int32
+		retained   bool
+	}{
+		{name: "Delete", policy: DeleteCleanupPolicy, cleanupTTL: time.Hour, ttl: int32Ptr(3600)},
+		{name: "DeleteWithoutTTL", policy: DeleteCleanupPolicy},
+		{name: "TTL", policy: TTLCleanupPolicy, cleanupTTL: time.Hour, ttl: int32Ptr(3600)},
+		{
+			name:       "RecipeTTL",
+			policy:     DeleteCleanupPolicy,
+			cleanupTTL: time.Hour,
+			recipe:     RecipeConfig{TTL: Duration{30 * time.Minute}},
+			ttl:        int32Ptr(1800),
+		},
+		{
+			name:       "Never",
+			policy:     TTLCleanupPolicy,
+			cleanupTTL: time.Hour,
+			recipe:     RecipeConfig{Cleanup: NeverRecipeCleanup},
+			retained:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{}}}
+			applyCleanupPolicy(
+				job, &tc.recipe, &Config{CleanupPolicy: tc.policy, CleanupTTL: tc.cleanupTTL},
+			)
+			assert.Equal(t, tc.ttl, job.Spec.TTLSecondsAfterFinished)
+			_, retained := job.Labels[retainLabel]
+			assert.Equal(t, tc.retained, retained)
+		})
+	}
+}
+
+// Test that the Jobs of a recipe are added to the owners of its ConfigMap.
+func TestConfigMapOwnerPatch(t *testing.T) {
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "logs-x7k2p", UID: "job-uid"}}
+	patch, err := configMapOwnerPatch(job)
+	assert.Nil(t, err)
+
+	var cm corev1.ConfigMap
+	assert.Nil(t, json.Unmarshal(patch, &cm))
+	assert.Equal(t, []metav1.OwnerReference{{
+		APIVersion: "batch/v1", Kind: "Job", Name: "logs-x7k2p", UID: "job-uid",
+	}}, cm.OwnerReferences)
+}
+
+// Test the selection of the recipes whose Jobs the reconciler deletes.
+func TestCleanupRecipes(t *testing.T) {
+	recipes := []Recipe{
+		newCompletedRecipe(t, `{"name": "pods", "status": "successful"}`),
+		newCompletedRecipe(t, `{"name": "logs", "status": "failed"}`),
+	}
+
+	testCases := []struct {
+		name     string
+		config   Config
+		expected []string
+	}{
+		{"Delete", Config{CleanupPolicy: DeleteCleanupPolicy}, []string{"pods", "logs"}},
+		{
+			"KeepFailed",
+			Config{CleanupPolicy: DeleteCleanupPolicy, KeepFailedJobs: 24 * time.Hour},
+			[]string{"pods"},
+		},
+		{"TTL", Config{CleanupPolicy: TTLCleanupPolicy}, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &Reconciler{config: &tc.config}
+			var names []string
+			for _, recipe := range r.cleanupRecipes(recipes) {
+				names = append(names, recipe.Execution.Name)
+			}
+			assert.Equal(t, tc.expected, names)
+		})
+	}
+}
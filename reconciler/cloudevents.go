@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nats-io/nats.go"
+	"github.com/segmentio/kafka-go"
+	"go.uber.org/zap"
+)
+
+const (
+	// Version of the CloudEvents specification the events conform to
+	cloudEventsSpecVersion = "1.0"
+	// Media type of the events in the structured content mode
+	cloudEventsContentType = "application/cloudevents+json"
+	// Maximum number of events waiting to be emitted
+	maxPendingCloudEvents = 1000
+	// Time given to each attempt at emitting an event, and number of attempts
+	cloudEventTimeout  = 10 * time.Second
+	cloudEventAttempts = 3
+	// Time given to the queued events to be emitted on shutdown
+	cloudEventsFlushTimeout = 30 * time.Second
+	// Default Kafka topic and NATS subject of the events
+	defaultCloudEventsTopic = "euphrosyne.events"
+)
+
+// Types of the CloudEvents of the lifecycle transitions of executions, by audit action. The types
+// are versioned and kept stable, whatever the names of the audit actions.
+var cloudEventTypes = map[string]string{
+	AuditIncidentRegistered: "io.euphrosyne.execution.registered.v1",
+	AuditExecutionRecovered: "io.euphrosyne.execution.recovered.v1",
+	AuditIncidentCompleted:  "io.euphrosyne.execution.completed.v1",
+	AuditIncidentCancelled:  "io.euphrosyne.execution.cancelled.v1",
+	AuditIncidentFailed:     "io.euphrosyne.execution.failed.v1",
+	AuditIncidentClosed:     "io.euphrosyne.execution.closed.v1",
+	AuditCleanupFinished:    "io.euphrosyne.execution.cleanedup.v1",
+	AuditRecipeLaunched:     "io.euphrosyne.recipe.launched.v1",
+	AuditRecipeFailed:       "io.euphrosyne.recipe.failed.v1",
+	AuditRecipeFinished:     "io.euphrosyne.recipe.finished.v1",
+	AuditRecipesTimedOut:    "io.euphrosyne.recipe.timedout.v1",
+	AuditApprovalUpdated:    "io.euphrosyne.approval.updated.v1",
+	AuditAckUpdated:         "io.euphrosyne.ack.updated.v1",
+	AuditComplianceViolated: "io.euphrosyne.execution.noncompliant.v1",
+}
+
+// CloudEvent is a lifecycle transition of an execution, in the structured JSON format of the
+// CloudEvents specification.
+type CloudEvent struct {
+	SpecVersion string `json:"specversion"`
+	ID          string `json:"id"`
+	Source      string `json:"source"`
+	Type        string `json:"type"`
+	// UUID of the execution
+	Subject         string                 `json:"subject"`
+	Time            time.Time              `json:"time"`
+	DataContentType string                 `json:"datacontenttype"`
+	Data            map[string]interface{} `json:"data"`
+}
+
+// CloudEventsSink delivers the events to their destination.
+type CloudEventsSink interface {
+	Send(ctx context.Context, event CloudEvent, payload []byte) error
+	Close() error
+}
+
+// CloudEvents emits the lifecycle transitions of executions as CloudEvents, in the order they
+// happened, without holding back the executions.
+type CloudEvents struct {
+	sink    CloudEventsSink
+	source  string
+	pending chan CloudEvent
+	// Closed to stop emitting the events in the background, and once stopped
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// Export of the executions as CloudEvents, only set if enabled.
+var cloudEvents *CloudEvents
+
+// Check whether the destination of the CloudEvents is supported.
+func isValidCloudEventsSink(destination string) bool {
+	u, err := url.Parse(destination)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	switch u.Scheme {
+	case "http", "https", "kafka", "nats":
+		return true
+	}
+	return false
+}
+
+// Initialise the export of the executions as CloudEvents to the configured destination, i.e. an
+// HTTP endpoint, a Kafka topic as `kafka://<broker>/<topic>` or a NATS subject as
+// `nats://<server>/<subject>`.
+func NewCloudEvents(config *Config) (*CloudEvents, error) {
+	u, err := url.Parse(config.CloudEventsSink)
+	if err != nil || !isValidCloudEventsSink(config.CloudEventsSink) {
+		return nil, fmt.Errorf("Unsupported CloudEvents sink '%s'", config.CloudEventsSink)
+	}
+	topic := strings.TrimPrefix(u.Path, "/")
+	if topic == "" {
+		topic = defaultCloudEventsTopic
+	}
+
+	var sink CloudEventsSink
+	switch u.Scheme {
+	case "kafka":
+		sink = &kafkaCloudEventsSink{writer: &kafka.Writer{
+			Addr:     kafka.TCP(strings.Split(u.Host, ",")...),
+			Topic:    topic,
+			Balancer: &kafka.Hash{},
+		}}
+	case "nats":
+		conn, err := nats.Connect("nats://" + u.Host)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to connect to NATS: %w", err)
+		}
+		sink = &natsCloudEventsSink{conn: conn, subject: topic}
+	default:
+		sink = &httpCloudEventsSink{url: config.CloudEventsSink}
+	}
+	return newCloudEvents(sink, "/euphrosyne/"+config.ReconcilerNamespace), nil
+}
+
+func newCloudEvents(sink CloudEventsSink, source string) *CloudEvents {
+	return &CloudEvents{
+		sink:    sink,
+		source:  source,
+		pending: make(chan CloudEvent, maxPendingCloudEvents),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+// Build the CloudEvent of an audit event, if it is a lifecycle transition of an execution.
+func newCloudEvent(event AuditEvent, source string) (CloudEvent, bool) {
+	eventType, ok := cloudEventTypes[event.Action]
+	if !ok || event.Incident == "" {
+		return CloudEvent{}, false
+	}
+	data := make(map[string]interface{}, len(event.Details)+1)
+	for k, v := range event.Details {
+		data[k] = v
+	}
+	data["incident"] = event.Incident
+	return CloudEvent{
+		SpecVersion:     cloudEventsSpecVersion,
+		ID:              uuid.New().String(),
+		Source:          source,
+		Type:            eventType,
+		Subject:         event.Incident,
+		Time:            event.Timestamp,
+		DataContentType: "application/json",
+		Data:            data,
+	}, true
+}
+
+// Queue the CloudEvent of an audit event to be emitted, without waiting for the sink. Events are
+// dropped if too many are waiting.
+func (ce *CloudEvents) Emit(event AuditEvent) {
+	cloudEvent, ok := newCloudEvent(event, ce.source)
+	if !ok {
+		return
+	}
+	select {
+	case ce.pending <- cloudEvent:
+	default:
+		cloudEventsEmitted.WithLabelValues("dropped").Inc()
+	}
+}
+
+// Emit the queued events until the context is cancelled or the events are flushed.
+func (ce *CloudEvents) Run(ctx context.Context) {
+	defer close(ce.stopped)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ce.stop:
+			return
+		case event := <-ce.pending:
+			ce.send(ctx, event)
+		}
+	}
+}
+
+// Stop emitting the events in the background and emit the ones still queued, e.g. on shutdown,
+// until the context is cancelled, before closing the sink.
+func (ce *CloudEvents) Flush(ctx context.Context) {
+	defer ce.sink.Close()
+	close(ce.stop)
+	select {
+	case <-ce.stopped:
+	case <-ctx.Done():
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-ce.pending:
+			ce.send(ctx, event)
+		default:
+			return
+		}
+	}
+}
+
+// Send an event to the sink, retrying failed attempts.
+func (ce *CloudEvents) send(ctx context.Context, event CloudEvent) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		logger.Error("Failed to encode CloudEvent", zap.String("type", event.Type), zap.Error(err))
+		cloudEventsEmitted.WithLabelValues("failed").Inc()
+		return
+	}
+	for attempt := 1; attempt <= cloudEventAttempts; attempt++ {
+		attemptCtx, cancel := context.WithTimeout(ctx, cloudEventTimeout)
+		err = ce.sink.Send(attemptCtx, event, payload)
+		cancel()
+		if err == nil {
+			cloudEventsEmitted.WithLabelValues("delivered").Inc()
+			return
+		}
+		if attempt < cloudEventAttempts {
+			select {
+			case <-ctx.Done():
+				attempt = cloudEventAttempts
+			case <-time.After(sinkRetryBackoff):
+			}
+		}
+	}
+	logger.Error(
+		"Failed to emit CloudEvent",
+		zap.String("uuid", event.Subject),
+		zap.String("type", event.Type),
+		zap.Error(err),
+	)
+	cloudEventsEmitted.WithLabelValues("failed").Inc()
+}
+
+// httpCloudEventsSink posts the events to an HTTP endpoint in the structured content mode.
+type httpCloudEventsSink struct {
+	url string
+}
+
+func (s *httpCloudEventsSink) Send(ctx context.Context, _ CloudEvent, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", cloudEventsContentType)
+
+	resp, err := httpc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Unexpected response status: %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *httpCloudEventsSink) Close() error {
+	return nil
+}
+
+// kafkaCloudEventsSink writes the events to a Kafka topic in the structured content mode, keyed by
+// execution so that the events of an execution stay in order.
+type kafkaCloudEventsSink struct {
+	writer *kafka.Writer
+}
+
+func (s *kafkaCloudEventsSink) Send(ctx context.Context, event CloudEvent, payload []byte) error {
+	return s.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(event.Subject),
+		Value: payload,
+		Headers: []kafka.Header{
+			{Key: "content-type", Value: []byte(cloudEventsContentType)},
+		},
+	})
+}
+
+func (s *kafkaCloudEventsSink) Close() error {
+	return s.writer.Close()
+}
+
+// natsCloudEventsSink publishes the events to a NATS subject in the structured content mode.
+type natsCloudEventsSink struct {
+	conn    *nats.Conn
+	subject string
+}
+
+func (s *natsCloudEventsSink) Send(_ context.Context, _ CloudEvent, payload []byte) error {
+	msg := nats.NewMsg(s.subject)
+	msg.Header.Set("Content-Type", cloudEventsContentType)
+	msg.Data = payload
+	return s.conn.PublishMsg(msg)
+}
+
+func (s *natsCloudEventsSink) Close() error {
+	return s.conn.Drain()
+}
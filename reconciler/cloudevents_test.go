@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that only the supported destinations are accepted as CloudEvents sinks.
+func TestIsValidCloudEventsSink(t *testing.T) {
+	tests := []struct {
+		sink  string
+		valid bool
+	}{
+		{sink: "https://analytics.example.com/events", valid: true},
+		{sink: "http://collector:8080", valid: true},
+		{sink: "kafka://kafka:9092/euphrosyne.events", valid: true},
+		{sink: "nats://nats:4222", valid: true},
+		{sink: "amqp://rabbitmq:5672", valid: false},
+		{sink: "kafka:///topic", valid: false},
+		{sink: "collector:8080", valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sink, func(t *testing.T) {
+			assert.Equal(t, tt.valid, isValidCloudEventsSink(tt.sink))
+		})
+	}
+}
+
+// Test that only the lifecycle transitions of executions are turned into CloudEvents.
+func TestNewCloudEvent(t *testing.T) {
+	timestamp := time.Now().UTC()
+	event, ok := newCloudEvent(AuditEvent{
+		Timestamp: timestamp,
+		Action:    AuditRecipeFinished,
+		Incident:  "cloudevent-incident",
+		Details:   map[string]interface{}{"recipe": "logs", "status": "successful"},
+	}, "/euphrosyne/default")
+	assert.True(t, ok)
+	assert.Equal(t, "1.0", event.SpecVersion)
+	assert.NotEmpty(t, event.ID)
+	assert.Equal(t, "/euphrosyne/default", event.Source)
+	assert.Equal(t, "io.euphrosyne.recipe.finished.v1", event.Type)
+	assert.Equal(t, "cloudevent-incident", event.Subject)
+	assert.Equal(t, timestamp, event.Time)
+	assert.Equal(t, map[string]interface{}{
+		"incident": "cloudevent-incident",
+		"recipe":   "logs",
+		"status":   "successful",
+	}, event.Data)
+
+	_, ok = newCloudEvent(AuditEvent{
+		Action: AuditLegalHoldPlaced, Incident: "cloudevent-incident",
+	}, "/euphrosyne/default")
+	assert.False(t, ok)
+	_, ok = newCloudEvent(AuditEvent{Action: AuditIncidentCompleted}, "/euphrosyne/default")
+	assert.False(t, ok)
+}
+
+// Test that the CloudEvents are posted to an HTTP sink in order, in the structured content mode.
+func TestCloudEventsHTTPSink(t *testing.T) {
+	var mutex sync.Mutex
+	received := []CloudEvent{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, cloudEventsContentType, r.Header.Get("Content-Type"))
+		body, _ := io.ReadAll(r.Body)
+		var event CloudEvent
+		assert.Nil(t, json.Unmarshal(body, &event))
+		mutex.Lock()
+		received = append(received, event)
+		mutex.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+	httpc = server.Client()
+
+	ce := newCloudEvents(&httpCloudEventsSink{url: server.URL}, "/euphrosyne/default")
+	go ce.Run(context.Background())
+	ce.Emit(AuditEvent{Action: AuditIncidentRegistered, Incident: "http-incident"})
+	ce.Emit(AuditEvent{Action: AuditCatalogLoaded})
+	ce.Emit(AuditEvent{Action: AuditRecipeLaunched, Incident: "http-incident"})
+	ce.Emit(AuditEvent{Action: AuditIncidentCompleted, Incident: "http-incident"})
+	ce.Flush(context.Background())
+
+	types := []string{}
+	for _, event := range received {
+		assert.Equal(t, "http-incident", event.Subject)
+		types = append(types, event.Type)
+	}
+	assert.Equal(t, []string{
+		"io.euphrosyne.execution.registered.v1",
+		"io.euphrosyne.recipe.launched.v1",
+		"io.euphrosyne.execution.completed.v1",
+	}, types)
+}
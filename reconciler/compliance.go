@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Reasons a required recipe did not run successfully.
+const (
+	// The recipe is disabled in the catalog
+	ComplianceDisabled = "disabled"
+	// The recipe is enabled, but was left out of the execution, e.g. by the route of the alert
+	ComplianceExcluded = "excluded"
+	// The recipe failed, or was skipped because a recipe it depends on failed
+	ComplianceFailed = "failed"
+	// The recipe did not report its results before the execution timed out
+	ComplianceTimedOut = "timedOut"
+)
+
+// RequiredRecipeRule declares the recipes that must run successfully for the alerts matching its
+// labels, e.g. the collection of evidence for the most severe alerts.
+type RequiredRecipeRule struct {
+	Name string `json:"name"`
+	// Labels the alerts must carry for the rule to apply, all alerts if empty
+	Match   map[string]string `json:"match"`
+	Recipes []string          `json:"recipes"`
+}
+
+// Compliance of an execution with the minimum recipe set required for its alert.
+type Compliance struct {
+	Compliant bool `json:"compliant"`
+	// Rules matching the alert, and the recipes they require
+	Rules      []string              `json:"rules"`
+	Required   []string              `json:"required"`
+	Violations []ComplianceViolation `json:"violations,omitempty"`
+}
+
+// ComplianceViolation is a required recipe that did not run successfully.
+type ComplianceViolation struct {
+	Recipe string `json:"recipe"`
+	Reason string `json:"reason"`
+}
+
+// Check that a required recipe rule can be applied.
+func (rule RequiredRecipeRule) validate() error {
+	if rule.Name == "" {
+		return fmt.Errorf("Required recipe rules must specify a name")
+	}
+	if len(rule.Recipes) == 0 {
+		return fmt.Errorf("Required recipe rule '%s' must list recipes", rule.Name)
+	}
+	return nil
+}
+
+// Check whether an alert with the given labels matches the rule.
+func (rule RequiredRecipeRule) matches(labels map[string]string) bool {
+	for name, value := range rule.Match {
+		if labels[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Determine the recipes required for an alert, flagging the ones that are already known not to
+// run, i.e. the ones missing from the recipes of the execution. Returns nil if no rule applies,
+// including to the verification of resolved alerts.
+func requiredRecipes(
+	rc *RecipeCatalog, recipes map[string]Recipe, data map[string]interface{},
+) *Compliance {
+	if _, ok := parseVerification(data); ok {
+		return nil
+	}
+	labels := alertLabels(data)
+	var rules, required []string
+	for _, rule := range rc.Required {
+		if !rule.matches(labels) {
+			continue
+		}
+		rules = append(rules, rule.Name)
+		for _, recipeName := range rule.Recipes {
+			if !slices.Contains(required, recipeName) {
+				required = append(required, recipeName)
+			}
+		}
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+	sort.Strings(required)
+
+	compliance := &Compliance{Compliant: true, Rules: rules, Required: required}
+	for _, recipeName := range required {
+		if _, ok := recipes[recipeName]; ok {
+			continue
+		}
+		reason := ComplianceExcluded
+		if !rc.Debugging[recipeName].Enabled {
+			reason = ComplianceDisabled
+		}
+		compliance.Violations = append(
+			compliance.Violations, ComplianceViolation{Recipe: recipeName, Reason: reason},
+		)
+	}
+	compliance.Compliant = len(compliance.Violations) == 0
+	return compliance
+}
+
+// Record the compliance of an incident with its required recipes.
+func (ir *IncidentRegistry) SetCompliance(uuid string, compliance *Compliance) {
+	ir.Update(uuid, func(incident *Incident) {
+		incident.Compliance = compliance
+	})
+}
+
+// Evaluate whether the required recipes of the execution ran successfully once its results are
+// collected, recording any violations. Returns nil if no recipes are required.
+func (r *Reconciler) evaluateCompliance(completedRecipes []Recipe) *Compliance {
+	incident, ok := incidentRegistry.Get(r.uuid)
+	if !ok || incident.Compliance == nil {
+		return nil
+	}
+	// The compliance is shared with the registry until it is updated
+	compliance := *incident.Compliance
+	compliance.Violations = slices.Clone(compliance.Violations)
+
+	statuses := make(map[string]string, len(completedRecipes))
+	for _, recipe := range completedRecipes {
+		statuses[recipe.Execution.Name] = recipe.Execution.Status
+	}
+	for _, recipeName := range compliance.Required {
+		if _, ok := r.recipes[recipeName]; !ok {
+			// Recipes that never took part in the execution were flagged when it started
+			continue
+		}
+		reason := ""
+		status, completed := statuses[recipeName]
+		switch {
+		case completed && status != RecipeStatusSuccessful:
+			reason = ComplianceFailed
+		case !completed:
+			reason = ComplianceTimedOut
+			if state, ok := incident.Recipes[recipeName]; ok &&
+				(state.State == RecipeStateFailed || state.State == RecipeStateSkipped) {
+				reason = ComplianceFailed
+			}
+		}
+		if reason != "" {
+			compliance.Violations = append(
+				compliance.Violations, ComplianceViolation{Recipe: recipeName, Reason: reason},
+			)
+		}
+	}
+	compliance.Compliant = len(compliance.Violations) == 0
+	incidentRegistry.SetCompliance(r.uuid, &compliance)
+
+	status := "compliant"
+	if !compliance.Compliant {
+		status = "noncompliant"
+		logger.Warn(
+			"Execution is not compliant with its required recipes",
+			zap.String("uuid", r.uuid),
+			zap.Strings("rules", compliance.Rules),
+			zap.Any("violations", compliance.Violations),
+		)
+		auditLog.Record(AuditComplianceViolated, r.uuid, map[string]interface{}{
+			"rules":      compliance.Rules,
+			"violations": compliance.Violations,
+		})
+	}
+	for _, rule := range compliance.Rules {
+		executionCompliance.WithLabelValues(rule, status).Inc()
+	}
+	return &compliance
+}
+
+// Format the violations of the required recipes, e.g. "evidence (failed), logs (disabled)".
+func formatViolations(violations []ComplianceViolation) string {
+	formatted := make([]string, 0, len(violations))
+	for _, violation := range violations {
+		formatted = append(formatted, fmt.Sprintf("%s (%s)", violation.Recipe, violation.Reason))
+	}
+	return strings.Join(formatted, ", ")
+}
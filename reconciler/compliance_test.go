@@ -0,0 +1,121 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that the recipes required for an alert are determined by the labels of the alert, flagging
+// the ones left out of the execution.
+func TestRequiredRecipes(t *testing.T) {
+	rc := &RecipeCatalog{
+		Debugging: map[string]RecipeConfig{
+			"evidence": {Enabled: false},
+			"logs":     {Enabled: true},
+			"pods":     {Enabled: true},
+		},
+		Required: []RequiredRecipeRule{
+			{
+				Name:    "sev1-evidence",
+				Match:   map[string]string{"severity": "sev1"},
+				Recipes: []string{"logs", "evidence"},
+			},
+			{Name: "always-pods", Recipes: []string{"pods", "logs"}},
+		},
+	}
+	alert := func(severity string) map[string]interface{} {
+		return map[string]interface{}{
+			"commonLabels": map[string]interface{}{"severity": severity},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		recipes  map[string]Recipe
+		data     map[string]interface{}
+		expected *Compliance
+	}{
+		{
+			name:    "Compliant",
+			recipes: map[string]Recipe{"logs": {}, "pods": {}},
+			data:    alert("sev3"),
+			expected: &Compliance{
+				Compliant: true,
+				Rules:     []string{"always-pods"},
+				Required:  []string{"logs", "pods"},
+			},
+		},
+		{
+			name:    "DisabledAndExcluded",
+			recipes: map[string]Recipe{"logs": {}},
+			data:    alert("sev1"),
+			expected: &Compliance{
+				Rules:    []string{"sev1-evidence", "always-pods"},
+				Required: []string{"evidence", "logs", "pods"},
+				Violations: []ComplianceViolation{
+					{Recipe: "evidence", Reason: ComplianceDisabled},
+					{Recipe: "pods", Reason: ComplianceExcluded},
+				},
+			},
+		},
+		{
+			name:    "Verification",
+			recipes: map[string]Recipe{},
+			data: map[string]interface{}{
+				verificationField: Verification{Incident: "verified-incident"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, requiredRecipes(rc, tt.recipes, tt.data))
+		})
+	}
+
+	rc.Required = rc.Required[:1]
+	assert.Nil(t, requiredRecipes(rc, map[string]Recipe{}, alert("sev2")))
+}
+
+// Test that required recipes that failed or did not report their results make the execution
+// non-compliant.
+func TestEvaluateCompliance(t *testing.T) {
+	uuid := "compliance-incident"
+	incidentRegistry.Register(uuid, Alert)
+	incidentRegistry.SetCompliance(uuid, &Compliance{
+		Compliant: false,
+		Rules:     []string{"sev1-evidence"},
+		Required:  []string{"evidence", "logs", "metrics", "pods", "traces"},
+		Violations: []ComplianceViolation{
+			{Recipe: "evidence", Reason: ComplianceDisabled},
+		},
+	})
+	incidentRegistry.RecipeFailed(uuid, "traces", assert.AnError)
+
+	r := &Reconciler{uuid: uuid, recipes: map[string]Recipe{
+		"logs": {}, "metrics": {}, "pods": {}, "traces": {},
+	}}
+	compliance := r.evaluateCompliance([]Recipe{
+		NewCompletedRecipe(NewRecipeExecution(
+			"logs", uuid, RecipeStatusSuccessful, RecipeResults{},
+		)),
+		NewCompletedRecipe(NewRecipeExecution("pods", uuid, RecipeStatusFailed, RecipeResults{})),
+	})
+
+	expected := []ComplianceViolation{
+		{Recipe: "evidence", Reason: ComplianceDisabled},
+		{Recipe: "metrics", Reason: ComplianceTimedOut},
+		{Recipe: "pods", Reason: ComplianceFailed},
+		{Recipe: "traces", Reason: ComplianceFailed},
+	}
+	assert.False(t, compliance.Compliant)
+	assert.Equal(t, expected, compliance.Violations)
+	incident, _ := incidentRegistry.Get(uuid)
+	assert.Equal(t, compliance, incident.Compliance)
+
+	// Executions without required recipes are not evaluated
+	r.uuid = "other-incident"
+	incidentRegistry.Register(r.uuid, Alert)
+	assert.Nil(t, r.evaluateCompliance(nil))
+}
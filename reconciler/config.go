@@ -2,21 +2,64 @@ package main
 
 import (
 	"fmt"
+	"io"
+	"net"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/util/validation"
 )
 
 const (
-	AggregatorAddress = "localhost:8080"
-	RedisAddress      = "localhost:6379"
-	WebexBotAddress   = "localhost:7001"
-	RecipeTimeout     = 300
+	AggregatorAddress     = "localhost:8080"
+	RedisAddress          = "localhost:6379"
+	WebexBotAddress       = "localhost:7001"
+	RecipeTimeout         = 5 * time.Minute
+	PayloadSchema         = RawPayloadSchema
+	PayloadAlertsField    = "alerts"
+	IncidentStore         = MemoryIncidentStore
+	IncidentRetention     = 24 * time.Hour
+	ExportFormat          = JSONLExportFormat
+	DefaultResultBroker   = RedisResultBroker
+	PollInterval          = time.Minute
+	Workers               = 50
+	QueueSize             = 1000
+	QueueOverflow         = EnqueueQueueOverflow
+	InlineRecipeMaxCPU    = "500m"
+	InlineRecipeMaxMemory = "512Mi"
+	NodeProblemLabel      = "node"
+	LeaderElectionLease   = "euphrosyne-reconciler"
+	IDFormat              = UUIDIDFormat
+	IDPrefix              = "inc"
+	CleanupPolicy         = DeleteCleanupPolicy
+	CleanupTTL            = time.Hour
+	MaxSubscriptions      = 2000
+	ShutdownTimeout       = 25 * time.Second
+	CanaryImage           = "phoevos/euphrosyne-recipes:latest"
+	DebugImage            = "phoevos/euphrosyne-debug:latest"
+	DebugSessionTTL       = time.Hour
+	DebugSessionMaxTTL    = 4 * time.Hour
+	SchemaDriftSamples    = 20
+	MinRecipeTimeout      = time.Minute
+	RedisMode             = StandaloneRedisMode
+	Sinks                 = WebexSink
+	JiraIssueType         = "Task"
+	SinkRetries           = 2
+	SinkFailureThreshold  = 5
+	SinkCooldown          = time.Minute
+	JanitorInterval       = time.Hour
+	MaxBatchSize          = 100
+	StatusInterval        = 30 * time.Second
 )
 
+const day = 24 * time.Hour
+
 // Rule represents a single rule from a Role or ClusterRole in Kubernetes RBAC.
 type Rule struct {
 	APIGroups []string
@@ -24,13 +67,13 @@ type Rule struct {
 	Verbs     []string
 }
 
-// Parse the Reconciler configuration from environment variables and command-line flags.
+// Parse the Reconciler configuration from its layered sources, i.e. the defaults, overridden by the
+// configuration file, environment variables and command-line flags, in that order. All the invalid
+// options are reported at once.
 func ParseConfig(args []string) (Config, error) {
 	// Set up Viper
 	v := viper.New()
 	v.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
-	v.SetConfigName("config")
-	v.AddConfigPath(".")
 	v.SetConfigType("yaml")
 
 	reconcilerNamespace, err := getReconcilerNamespace()
@@ -44,28 +87,805 @@ func ParseConfig(args []string) (Config, error) {
 	v.SetDefault("webex-bot-address", WebexBotAddress)
 	v.SetDefault("recipe-timeout", RecipeTimeout)
 	v.SetDefault("recipe-namespace", reconcilerNamespace)
+	v.SetDefault("payload-schema", PayloadSchema)
+	v.SetDefault("payload-alerts-field", PayloadAlertsField)
+	v.SetDefault("incident-store", IncidentStore)
+	v.SetDefault("incident-retention", IncidentRetention)
+	v.SetDefault("export-interval", 0)
+	v.SetDefault("export-destination", "")
+	v.SetDefault("export-endpoint", "")
+	v.SetDefault("export-format", ExportFormat)
+	v.SetDefault("export-retention", 0)
+	v.SetDefault("approval-timeout", 0)
+	v.SetDefault("approval-webhook", "")
+	v.SetDefault("result-broker", DefaultResultBroker)
+	v.SetDefault("result-broker-address", "")
+	v.SetDefault("result-topic", "")
+	v.SetDefault("prometheus-url", "")
+	v.SetDefault("poll-interval", PollInterval)
+	v.SetDefault("federation-peers", "")
+	v.SetDefault("federation-token", "")
+	v.SetDefault("webhook-auth", "")
+	v.SetDefault("api-auth", "")
+	v.SetDefault("auth-token", "")
+	v.SetDefault("hmac-secret", "")
+	v.SetDefault("tls-cert", "")
+	v.SetDefault("tls-key", "")
+	v.SetDefault("tls-client-ca", "")
+	v.SetDefault("admin-token", "")
+	v.SetDefault("dedup-window", 0)
+	v.SetDefault("dedup-fields", "")
+	v.SetDefault("max-concurrent-executions", 0)
+	v.SetDefault("workers", Workers)
+	v.SetDefault("queue-size", QueueSize)
+	v.SetDefault("queue-overflow", QueueOverflow)
+	v.SetDefault("max-batch-size", MaxBatchSize)
+	v.SetDefault("dry-run", false)
+	v.SetDefault("inline-recipes", false)
+	v.SetDefault("inline-recipe-images", "")
+	v.SetDefault("inline-recipe-max-cpu", InlineRecipeMaxCPU)
+	v.SetDefault("inline-recipe-max-memory", InlineRecipeMaxMemory)
+	v.SetDefault("otel-endpoint", "")
+	v.SetDefault("node-problems", false)
+	v.SetDefault("node-problem-label", NodeProblemLabel)
+	v.SetDefault("id-format", IDFormat)
+	v.SetDefault("id-prefix", IDPrefix)
+	v.SetDefault("watch-config", false)
+	v.SetDefault("events", false)
+	v.SetDefault("leader-election", false)
+	v.SetDefault("leader-election-lease", LeaderElectionLease)
+	v.SetDefault("result-store", "")
+	v.SetDefault("result-store-endpoint", "")
+	v.SetDefault("result-store-retention", 0)
+	v.SetDefault("data-retention", 0)
+	v.SetDefault("janitor-interval", JanitorInterval)
+	v.SetDefault("cleanup-policy", CleanupPolicy)
+	v.SetDefault("cleanup-ttl", CleanupTTL)
+	v.SetDefault("keep-failed-jobs", 0)
+	v.SetDefault("snapshot-logs", false)
+	v.SetDefault("chatops-provider", "")
+	v.SetDefault("chatops-endpoint", "")
+	v.SetDefault("chatops-channel", "")
+	v.SetDefault("chatops-token", "")
+	v.SetDefault("chatops-signing-secret", "")
+	v.SetDefault("suppress-acked-notifications", false)
+	v.SetDefault("clusters", "")
+	v.SetDefault("kubeconfig", "")
+	v.SetDefault("max-subscriptions", MaxSubscriptions)
+	v.SetDefault("shutdown-timeout", ShutdownTimeout)
+	v.SetDefault("canary", false)
+	v.SetDefault("canary-image", CanaryImage)
+	v.SetDefault("canary-interval", 0)
+	v.SetDefault("debug-sessions", false)
+	v.SetDefault("debug-image", DebugImage)
+	v.SetDefault("debug-session-ttl", DebugSessionTTL)
+	v.SetDefault("debug-session-max-ttl", DebugSessionMaxTTL)
+	v.SetDefault("debug-service-account", "")
+	v.SetDefault("schema-drift-samples", SchemaDriftSamples)
+	v.SetDefault("cloudevents-sink", "")
+	v.SetDefault("min-recipe-timeout", MinRecipeTimeout)
+	v.SetDefault("max-recipe-timeout", 0)
+	v.SetDefault("override-namespaces", "")
+	v.SetDefault("redis-mode", RedisMode)
+	v.SetDefault("redis-master-name", "")
+	v.SetDefault("redis-username", "")
+	v.SetDefault("redis-password", "")
+	v.SetDefault("redis-sentinel-password", "")
+	v.SetDefault("redis-db", 0)
+	v.SetDefault("redis-tls", false)
+	v.SetDefault("redis-tls-ca", "")
+	v.SetDefault("sinks", Sinks)
+	v.SetDefault("http-sink-url", "")
+	v.SetDefault("slack-webhook-url", "")
+	v.SetDefault("jira-url", "")
+	v.SetDefault("jira-project", "")
+	v.SetDefault("jira-issue-type", JiraIssueType)
+	v.SetDefault("jira-user", "")
+	v.SetDefault("jira-token", "")
+	v.SetDefault("webhook-sink-url", "")
+	v.SetDefault("sink-retries", SinkRetries)
+	v.SetDefault("sink-failure-threshold", SinkFailureThreshold)
+	v.SetDefault("sink-cooldown", SinkCooldown)
+	v.SetDefault("actionable-sinks", "")
+	v.SetDefault("status-configmap", "")
+	v.SetDefault("status-interval", StatusInterval)
+
+	v.SetDefault("config-file", "")
 
 	v.AutomaticEnv()
 
+	// Read the configuration file, named by its flag ahead of parsing the rest of the flags
+	configFile := configFileFlag(args)
+	if configFile == "" {
+		configFile = v.GetString("config-file")
+	}
+	if configFile != "" {
+		v.SetConfigFile(configFile)
+		if err := v.ReadInConfig(); err != nil {
+			return Config{}, fmt.Errorf(
+				"Failed to read configuration file '%s': %w", configFile, err,
+			)
+		}
+	}
+
 	// Set up command-line flags
 	fs := pflag.NewFlagSet("config", pflag.ContinueOnError)
+	fs.String(
+		"config-file", v.GetString("config-file"),
+		"Path to a YAML configuration file, overridden by environment variables and flags",
+	)
 	fs.String("aggregator-address", v.GetString("aggregator-address"), "Aggregator Address")
-	fs.String("redis-address", v.GetString("redis-address"), "Redis Address")
+	fs.String(
+		"redis-address", v.GetString("redis-address"),
+		"Redis address, or comma-separated addresses of the Sentinels or Cluster nodes",
+	)
 	fs.String("webex-bot-address", v.GetString("webex-bot-address"), "Webex Bot Address")
-	fs.Int("recipe-timeout", v.GetInt("recipe-timeout"), "Timeout (s) for recipe execution")
+	fs.String("recipe-timeout", v.GetString("recipe-timeout"), "Timeout for recipe execution")
 	fs.String("recipe-namespace", v.GetString("recipe-namespace"), "Namespace for recipes")
-	fs.Parse(args)
+	fs.String(
+		"payload-schema", v.GetString("payload-schema"),
+		"Schema of the webhook payload (raw, alertmanager, custom)",
+	)
+	fs.String(
+		"payload-alerts-field", v.GetString("payload-alerts-field"),
+		"Field holding the list of alerts for the custom payload schema",
+	)
+	fs.String(
+		"incident-store", v.GetString("incident-store"),
+		"Backend for the incident registry (memory, redis)",
+	)
+	fs.String(
+		"incident-retention", v.GetString("incident-retention"),
+		"Retention of completed incidents in the incident registry",
+	)
+	fs.String(
+		"export-interval", v.GetString("export-interval"),
+		"Interval between compliance exports, 0 to disable",
+	)
+	fs.String(
+		"export-destination", v.GetString("export-destination"),
+		"Destination of the compliance export (s3://<bucket>/<prefix> or file://<path>)",
+	)
+	fs.String(
+		"export-endpoint", v.GetString("export-endpoint"),
+		"Endpoint of the S3-compatible object store for the compliance export",
+	)
+	fs.String(
+		"export-format", v.GetString("export-format"),
+		"Format of the compliance export (jsonl, parquet)",
+	)
+	fs.String(
+		"export-retention", v.GetString("export-retention"),
+		"Retention of the compliance export, 0 to keep forever",
+	)
+	fs.String(
+		"approval-timeout", v.GetString("approval-timeout"),
+		"Time to wait for approval of action recipes, 0 to run them without approval",
+	)
+	fs.String(
+		"approval-webhook", v.GetString("approval-webhook"),
+		"Webhook URL to notify of pending approvals",
+	)
+	fs.String(
+		"result-broker", v.GetString("result-broker"),
+		"Broker for collecting recipe results (redis, nats, kafka)",
+	)
+	fs.String(
+		"result-broker-address", v.GetString("result-broker-address"),
+		"Address of the NATS server or comma-separated Kafka brokers",
+	)
+	fs.String(
+		"result-topic", v.GetString("result-topic"),
+		"NATS subject prefix or Kafka topic for recipe results",
+	)
+	fs.String(
+		"prometheus-url", v.GetString("prometheus-url"),
+		"Prometheus URL to evaluate the PromQL queries of the catalog against, empty to disable",
+	)
+	fs.String(
+		"poll-interval", v.GetString("poll-interval"),
+		"Interval between evaluations of the PromQL queries",
+	)
+	fs.String(
+		"federation-peers", v.GetString("federation-peers"),
+		"Comma-separated list of peer reconcilers recipes can be forwarded to (<name>=<url>)",
+	)
+	fs.String(
+		"federation-token", v.GetString("federation-token"),
+		"Token authenticating requests between federated reconcilers",
+	)
+	fs.String(
+		"webhook-auth", v.GetString("webhook-auth"),
+		"Comma-separated authentication modes required on the webhook (token, hmac, mtls)",
+	)
+	fs.String(
+		"api-auth", v.GetString("api-auth"),
+		"Comma-separated authentication modes required on the API (token, hmac, mtls)",
+	)
+	fs.String("auth-token", v.GetString("auth-token"), "Bearer token for the token auth mode")
+	fs.String(
+		"admin-token", v.GetString("admin-token"),
+		"Bearer token required by the admin API, which is disabled unless set",
+	)
+	fs.String("hmac-secret", v.GetString("hmac-secret"), "Secret for the hmac auth mode")
+	fs.String("tls-cert", v.GetString("tls-cert"), "Path to the TLS certificate of the servers")
+	fs.String("tls-key", v.GetString("tls-key"), "Path to the TLS key of the servers")
+	fs.String(
+		"tls-client-ca", v.GetString("tls-client-ca"),
+		"Path to the CA verifying client certificates for the mtls auth mode",
+	)
+	fs.String(
+		"dedup-window", v.GetString("dedup-window"),
+		"Window in which repeated alerts are attached to the same incident, 0 to disable",
+	)
+	fs.String(
+		"dedup-fields", v.GetString("dedup-fields"),
+		"Comma-separated alert fields fingerprinting duplicate alerts, defaults to the labels",
+	)
+	fs.Int(
+		"max-concurrent-executions", v.GetInt("max-concurrent-executions"),
+		"Maximum number of recipe executions running at once, 0 for no limit",
+	)
+	fs.Int(
+		"workers", v.GetInt("workers"),
+		"Number of workers running recipe executions, bounding the executions running at once",
+	)
+	fs.Int(
+		"queue-size", v.GetInt("queue-size"),
+		"Maximum number of executions waiting for capacity, 0 for no limit",
+	)
+	fs.String(
+		"queue-overflow", v.GetString("queue-overflow"),
+		"Handling of executions that cannot start right away (enqueue, reject)",
+	)
+	fs.Int(
+		"max-batch-size", v.GetInt("max-batch-size"),
+		"Maximum number of alert payloads accepted in a single batch",
+	)
+	fs.Bool(
+		"dry-run", v.GetBool("dry-run"),
+		"Render the Jobs of action recipes without creating anything in the cluster",
+	)
+	fs.Bool(
+		"inline-recipes", v.GetBool("inline-recipes"),
+		"Accept recipes defined inline in authenticated webhook and Actions requests",
+	)
+	fs.String(
+		"inline-recipe-images", v.GetString("inline-recipe-images"),
+		"Comma-separated list of image prefixes inline recipes may use",
+	)
+	fs.String(
+		"inline-recipe-max-cpu", v.GetString("inline-recipe-max-cpu"),
+		"Maximum CPU inline recipes may request",
+	)
+	fs.String(
+		"inline-recipe-max-memory", v.GetString("inline-recipe-max-memory"),
+		"Maximum memory inline recipes may request",
+	)
+	fs.String(
+		"otel-endpoint", v.GetString("otel-endpoint"),
+		"URL of the OTLP/HTTP endpoint to export traces to, e.g. http://otel-collector:4318",
+	)
+	fs.Bool(
+		"node-problems", v.GetBool("node-problems"),
+		"Watch the problems reported on nodes, e.g. by the Node Problem Detector",
+	)
+	fs.String(
+		"node-problem-label", v.GetString("node-problem-label"),
+		"Alert label identifying the node of node-related alerts",
+	)
+	fs.String(
+		"id-format", v.GetString("id-format"),
+		"Format of the execution IDs (uuid, uuidv7, ulid, sequence)",
+	)
+	fs.String(
+		"id-prefix", v.GetString("id-prefix"),
+		"Prefix of sequential execution IDs, i.e. <prefix>-<date>-<seq>",
+	)
+	fs.Bool(
+		"watch-config", v.GetBool("watch-config"),
+		"Reload the recipe catalog, message templates and routes when their ConfigMaps change,"+
+			" and validate changes to the configuration file",
+	)
+	fs.Bool(
+		"events", v.GetBool("events"),
+		"Record the milestones of incidents as Kubernetes Events",
+	)
+	fs.Bool(
+		"leader-election", v.GetBool("leader-election"),
+		"Elect a leader among replicas, so that only the leader launches recipes",
+	)
+	fs.String(
+		"leader-election-lease", v.GetString("leader-election-lease"),
+		"Name of the Lease used for leader election in the Reconciler namespace",
+	)
+	fs.String(
+		"result-store", v.GetString("result-store"),
+		"Store of completed incident records (postgres://..., s3://<bucket>/<prefix>, file://...)",
+	)
+	fs.String(
+		"result-store-endpoint", v.GetString("result-store-endpoint"),
+		"Endpoint of the S3-compatible object store for incident records",
+	)
+	fs.String(
+		"result-store-retention", v.GetString("result-store-retention"),
+		"Retention of stored incident records, 0 to keep forever",
+	)
+	fs.String(
+		"data-retention", v.GetString("data-retention"),
+		"Retention of all execution data, 0 to keep forever",
+	)
+	fs.String(
+		"janitor-interval", v.GetString("janitor-interval"),
+		"Interval between the purges of data older than its retention",
+	)
+	fs.String(
+		"cleanup-policy", v.GetString("cleanup-policy"),
+		"Cleanup of completed recipe Jobs (delete, ttl)",
+	)
+	fs.String(
+		"cleanup-ttl", v.GetString("cleanup-ttl"),
+		"Time finished recipe Jobs are kept for, 0 to leave them to the reconciler",
+	)
+	fs.String(
+		"keep-failed-jobs", v.GetString("keep-failed-jobs"),
+		"Time failed recipe Jobs are kept for debugging, 0 to clean them up",
+	)
+	fs.Bool(
+		"snapshot-logs", v.GetBool("snapshot-logs"),
+		"Persist the logs of recipe Pods along with incident records before cleaning them up",
+	)
+	fs.String(
+		"chatops-provider", v.GetString("chatops-provider"),
+		"Provider of the threads following the progress of incidents (slack, teams)",
+	)
+	fs.String(
+		"chatops-endpoint", v.GetString("chatops-endpoint"),
+		"API of the ChatOps provider, defaults to the public API of the provider",
+	)
+	fs.String(
+		"chatops-channel", v.GetString("chatops-channel"),
+		"Slack channel ID, or Teams channel (<team-id>/<channel-id>) of the incident threads",
+	)
+	fs.String("chatops-token", v.GetString("chatops-token"), "Token of the ChatOps provider API")
+	fs.String(
+		"chatops-signing-secret", v.GetString("chatops-signing-secret"),
+		"Secret verifying the ChatOps callbacks acknowledging incidents, disabled if empty",
+	)
+	fs.Bool(
+		"suppress-acked-notifications", v.GetBool("suppress-acked-notifications"),
+		"Hold back the notifications of alerts whose incident is acknowledged",
+	)
+	fs.String(
+		"clusters", v.GetString("clusters"),
+		"Comma-separated list of additional clusters recipes can run in (<name>=<context>)",
+	)
+	fs.String(
+		"kubeconfig", v.GetString("kubeconfig"),
+		"Path to the kubeconfig holding the contexts of the clusters, defaults to ~/.kube/config",
+	)
+	fs.Int(
+		"max-subscriptions", v.GetInt("max-subscriptions"),
+		"Maximum number of open result subscriptions, 0 for no limit",
+	)
+	fs.String(
+		"shutdown-timeout", v.GetString("shutdown-timeout"),
+		"Time in-flight executions are given to complete on shutdown before being checkpointed",
+	)
+	fs.Bool(
+		"canary", v.GetBool("canary"),
+		"Run a no-op recipe end-to-end on startup, reporting the replica ready once it succeeds",
+	)
+	fs.String(
+		"canary-image", v.GetString("canary-image"),
+		"Image of the no-op recipe run by the canary self-test, which needs the recipe SDK",
+	)
+	fs.String(
+		"canary-interval", v.GetString("canary-interval"),
+		"Time between canary self-tests after the one on startup, 0 to only run it on startup",
+	)
+	fs.Bool(
+		"debug-sessions", v.GetBool("debug-sessions"),
+		"Allow spawning interactive debugging Pods from executions through the API",
+	)
+	fs.String(
+		"debug-image", v.GetString("debug-image"),
+		"Image of the debugging Pods, holding the tooling of the investigation",
+	)
+	fs.String(
+		"debug-session-ttl", v.GetString("debug-session-ttl"),
+		"Default time debugging Pods are kept for before being deleted",
+	)
+	fs.String(
+		"debug-session-max-ttl", v.GetString("debug-session-max-ttl"),
+		"Maximum time debugging Pods can be requested for",
+	)
+	fs.String(
+		"debug-service-account", v.GetString("debug-service-account"),
+		"Service account of the debugging Pods, the default one of the recipe namespace if unset",
+	)
+	fs.Int(
+		"schema-drift-samples", v.GetInt("schema-drift-samples"),
+		"Number of alerts of a source learned before detecting schema drift, 0 to disable it",
+	)
+	fs.String(
+		"cloudevents-sink", v.GetString("cloudevents-sink"),
+		"Sink of the execution CloudEvents (http(s)://..., kafka://<broker>/<topic> or "+
+			"nats://<server>/<subject>)",
+	)
+	fs.String(
+		"min-recipe-timeout", v.GetString("min-recipe-timeout"),
+		"Minimum recipe timeout requests can override the recipe timeout with",
+	)
+	fs.String(
+		"max-recipe-timeout", v.GetString("max-recipe-timeout"),
+		"Maximum recipe timeout requests can override the recipe timeout with, 0 to disable",
+	)
+	fs.String(
+		"override-namespaces", v.GetString("override-namespaces"),
+		"Comma-separated list of namespaces requests can override the recipe namespace with",
+	)
+	fs.String(
+		"redis-mode", v.GetString("redis-mode"),
+		"Topology of the Redis deployment (standalone, sentinel, cluster)",
+	)
+	fs.String(
+		"redis-master-name", v.GetString("redis-master-name"),
+		"Name of the master monitored by the Redis Sentinels",
+	)
+	fs.String("redis-username", v.GetString("redis-username"), "Redis ACL username")
+	fs.String("redis-password", v.GetString("redis-password"), "Redis password")
+	fs.String(
+		"redis-sentinel-password", v.GetString("redis-sentinel-password"),
+		"Password of the Redis Sentinels, if different from the Redis password",
+	)
+	fs.Int("redis-db", v.GetInt("redis-db"), "Redis database, not supported by Redis Cluster")
+	fs.Bool("redis-tls", v.GetBool("redis-tls"), "Connect to Redis over TLS")
+	fs.String(
+		"redis-tls-ca", v.GetString("redis-tls-ca"),
+		"Path to the CA certificate of Redis, defaults to the system certificate pool",
+	)
+	fs.String(
+		"sinks", v.GetString("sinks"),
+		"Comma-separated list of sinks the analysis of incidents is delivered to "+
+			"(webex, http, slack, jira, webhook)",
+	)
+	fs.String(
+		"http-sink-url", v.GetString("http-sink-url"),
+		"URL of the HTTP aggregator the analysis of incidents is posted to",
+	)
+	fs.String("slack-webhook-url", v.GetString("slack-webhook-url"), "Slack incoming webhook URL")
+	fs.String("jira-url", v.GetString("jira-url"), "Base URL of Jira")
+	fs.String("jira-project", v.GetString("jira-project"), "Key of the Jira project of the issues")
+	fs.String("jira-issue-type", v.GetString("jira-issue-type"), "Type of the Jira issues")
+	fs.String("jira-user", v.GetString("jira-user"), "Jira user creating the issues")
+	fs.String("jira-token", v.GetString("jira-token"), "API token of the Jira user")
+	fs.String(
+		"webhook-sink-url", v.GetString("webhook-sink-url"),
+		"URL of the webhook the templated analysis of incidents is posted to",
+	)
+	fs.Int(
+		"sink-retries", v.GetInt("sink-retries"),
+		"Number of times a failed delivery to a sink is retried",
+	)
+	fs.Int(
+		"sink-failure-threshold", v.GetInt("sink-failure-threshold"),
+		"Number of consecutive failed deliveries after which a sink is skipped",
+	)
+	fs.String(
+		"sink-cooldown", v.GetString("sink-cooldown"),
+		"Time a failing sink is skipped for before deliveries are attempted again",
+	)
+	fs.String(
+		"actionable-sinks", v.GetString("actionable-sinks"),
+		"Comma-separated list of sinks only delivered to when the analysis calls for action",
+	)
+	fs.String(
+		"status-configmap", v.GetString("status-configmap"),
+		"ConfigMap the leader keeps updated with the status of the Reconciler, disabled if empty",
+	)
+	fs.String(
+		"status-interval", v.GetString("status-interval"),
+		"Interval between the updates of the status ConfigMap",
+	)
+	if err := fs.Parse(args); err != nil {
+		return Config{}, fmt.Errorf("Invalid command-line arguments: %w", err)
+	}
 
 	// Bind command-line flags to v keys
 	v.BindPFlags(fs)
 
+	r := &configReader{v: v}
+	if configFile != "" {
+		// Options of the configuration file are named after their flags
+		for _, key := range v.AllKeys() {
+			if fs.Lookup(key) == nil {
+				r.fail("Unknown option '%s' in configuration file '%s'", key, configFile)
+			}
+		}
+	}
 	config := Config{
-		AggregatorAddress:   v.GetString("aggregator-address"),
-		RedisAddress:        v.GetString("redis-address"),
-		WebexBotAddress:     v.GetString("webex-bot-address"),
-		RecipeTimeout:       v.GetInt("recipe-timeout"),
-		RecipeNamespace:     v.GetString("recipe-namespace"),
+		AggregatorAddress:   r.String("aggregator-address"),
+		RedisAddress:        r.String("redis-address"),
+		WebexBotAddress:     r.String("webex-bot-address"),
+		RecipeTimeout:       r.Duration("recipe-timeout", time.Second),
+		RecipeNamespace:     r.String("recipe-namespace"),
 		ReconcilerNamespace: reconcilerNamespace,
+		PayloadSchema:       r.String("payload-schema"),
+		PayloadAlertsField:  r.String("payload-alerts-field"),
+		IncidentStore:       r.String("incident-store"),
+		IncidentRetention:   r.Duration("incident-retention", time.Second),
+		ExportInterval:      r.Duration("export-interval", time.Second),
+		ExportDestination:   r.String("export-destination"),
+		ExportEndpoint:      r.String("export-endpoint"),
+		ExportFormat:        r.String("export-format"),
+		ExportRetention:     r.Duration("export-retention", day),
+		ApprovalTimeout:     r.Duration("approval-timeout", time.Second),
+		ApprovalWebhook:     r.String("approval-webhook"),
+		ResultBroker:        r.String("result-broker"),
+		ResultBrokerAddress: r.String("result-broker-address"),
+		ResultTopic:         r.String("result-topic"),
+		PrometheusURL:       r.String("prometheus-url"),
+		PollInterval:        r.Duration("poll-interval", time.Second),
+		FederationPeers:     r.String("federation-peers"),
+		FederationToken:     r.String("federation-token"),
+		WebhookAuth:         r.String("webhook-auth"),
+		APIAuth:             r.String("api-auth"),
+		AuthToken:           r.String("auth-token"),
+		HMACSecret:          r.String("hmac-secret"),
+		TLSCert:             r.String("tls-cert"),
+		TLSKey:              r.String("tls-key"),
+		TLSClientCA:         r.String("tls-client-ca"),
+		AdminToken:          r.String("admin-token"),
+		DedupWindow:         r.Duration("dedup-window", time.Second),
+		DedupFields:         r.String("dedup-fields"),
+
+		MaxConcurrentExecutions: r.Int("max-concurrent-executions"),
+		Workers:                 r.Int("workers"),
+		QueueSize:               r.Int("queue-size"),
+		QueueOverflow:           r.String("queue-overflow"),
+		MaxBatchSize:            r.Int("max-batch-size"),
+		DryRun:                  r.Bool("dry-run"),
+
+		InlineRecipes:         r.Bool("inline-recipes"),
+		InlineRecipeImages:    r.String("inline-recipe-images"),
+		InlineRecipeMaxCPU:    r.String("inline-recipe-max-cpu"),
+		InlineRecipeMaxMemory: r.String("inline-recipe-max-memory"),
+
+		OTelEndpoint: r.String("otel-endpoint"),
+
+		NodeProblems:     r.Bool("node-problems"),
+		NodeProblemLabel: r.String("node-problem-label"),
+
+		IDFormat:            r.String("id-format"),
+		IDPrefix:            r.String("id-prefix"),
+		WatchConfig:         r.Bool("watch-config"),
+		ConfigFile:          configFile,
+		Events:              r.Bool("events"),
+		LeaderElection:      r.Bool("leader-election"),
+		LeaderElectionLease: r.String("leader-election-lease"),
+
+		ResultStore:          r.String("result-store"),
+		ResultStoreEndpoint:  r.String("result-store-endpoint"),
+		ResultStoreRetention: r.Duration("result-store-retention", day),
+		DataRetention:        r.Duration("data-retention", day),
+		JanitorInterval:      r.Duration("janitor-interval", time.Second),
+
+		CleanupPolicy:  r.String("cleanup-policy"),
+		CleanupTTL:     r.Duration("cleanup-ttl", time.Second),
+		KeepFailedJobs: r.Duration("keep-failed-jobs", time.Hour),
+		SnapshotLogs:   r.Bool("snapshot-logs"),
+
+		ChatOpsProvider: r.String("chatops-provider"),
+		ChatOpsEndpoint: r.String("chatops-endpoint"),
+		ChatOpsChannel:  r.String("chatops-channel"),
+		ChatOpsToken:    r.String("chatops-token"),
+
+		ChatOpsSigningSecret:       r.String("chatops-signing-secret"),
+		SuppressAckedNotifications: r.Bool("suppress-acked-notifications"),
+
+		Clusters:   r.String("clusters"),
+		Kubeconfig: r.String("kubeconfig"),
+
+		MaxSubscriptions: r.Int("max-subscriptions"),
+
+		ShutdownTimeout: r.Duration("shutdown-timeout", time.Second),
+
+		Canary:         r.Bool("canary"),
+		CanaryImage:    r.String("canary-image"),
+		CanaryInterval: r.Duration("canary-interval", time.Second),
+
+		DebugSessions:       r.Bool("debug-sessions"),
+		DebugImage:          r.String("debug-image"),
+		DebugSessionTTL:     r.Duration("debug-session-ttl", time.Second),
+		DebugSessionMaxTTL:  r.Duration("debug-session-max-ttl", time.Second),
+		DebugServiceAccount: r.String("debug-service-account"),
+
+		SchemaDriftSamples: r.Int("schema-drift-samples"),
+		CloudEventsSink:    r.String("cloudevents-sink"),
+
+		MinRecipeTimeout:   r.Duration("min-recipe-timeout", time.Second),
+		MaxRecipeTimeout:   r.Duration("max-recipe-timeout", time.Second),
+		OverrideNamespaces: r.String("override-namespaces"),
+
+		RedisMode:             r.String("redis-mode"),
+		RedisMasterName:       r.String("redis-master-name"),
+		RedisUsername:         r.String("redis-username"),
+		RedisPassword:         r.String("redis-password"),
+		RedisSentinelPassword: r.String("redis-sentinel-password"),
+		RedisDB:               r.Int("redis-db"),
+		RedisTLS:              r.Bool("redis-tls"),
+		RedisTLSCA:            r.String("redis-tls-ca"),
+
+		Sinks:                r.String("sinks"),
+		HTTPSinkURL:          r.String("http-sink-url"),
+		SlackWebhookURL:      r.String("slack-webhook-url"),
+		JiraURL:              r.String("jira-url"),
+		JiraProject:          r.String("jira-project"),
+		JiraIssueType:        r.String("jira-issue-type"),
+		JiraUser:             r.String("jira-user"),
+		JiraToken:            r.String("jira-token"),
+		WebhookSinkURL:       r.String("webhook-sink-url"),
+		SinkRetries:          r.Int("sink-retries"),
+		SinkFailureThreshold: r.Int("sink-failure-threshold"),
+		SinkCooldown:         r.Duration("sink-cooldown", time.Second),
+		ActionableSinks:      r.String("actionable-sinks"),
+
+		StatusConfigMap: r.String("status-configmap"),
+		StatusInterval:  r.Duration("status-interval", time.Second),
+	}
+
+	if err := validateAddress("aggregator", config.AggregatorAddress); err != nil {
+		r.add(err)
+	}
+	if err := validateAddress("Webex Bot", config.WebexBotAddress); err != nil {
+		r.add(err)
+	}
+	if !isValidPayloadSchema(config.PayloadSchema) {
+		r.fail("Unsupported payload schema '%s'", config.PayloadSchema)
+	}
+	if !isValidIncidentStore(config.IncidentStore) {
+		r.fail("Unsupported incident store '%s'", config.IncidentStore)
+	}
+	if !isValidExportFormat(config.ExportFormat) {
+		r.fail("Unsupported export format '%s'", config.ExportFormat)
+	}
+	if !isValidResultBroker(config.ResultBroker) {
+		r.fail("Unsupported result broker '%s'", config.ResultBroker)
+	}
+	if config.ResultBroker != RedisResultBroker && config.ResultBrokerAddress == "" {
+		r.fail("A result broker address is required for '%s'", config.ResultBroker)
+	}
+	if !isValidQueueOverflow(config.QueueOverflow) {
+		r.fail("Unsupported queue overflow policy '%s'", config.QueueOverflow)
+	}
+	if config.MaxConcurrentExecutions < 0 || config.QueueSize < 0 {
+		r.fail("Concurrency limits and queue sizes cannot be negative")
+	}
+	if config.Workers <= 0 {
+		r.fail("The number of workers must be positive")
+	}
+	if config.MaxBatchSize <= 0 {
+		r.fail("The maximum batch size must be positive")
+	}
+	if err := validateInlineRecipePolicy(&config); err != nil {
+		r.add(err)
+	}
+	if err := validateOTelEndpoint(config.OTelEndpoint); err != nil {
+		r.add(err)
+	}
+	if config.ResultStore != "" && !isValidResultStore(config.ResultStore) {
+		r.fail("Unsupported result store '%s'", config.ResultStore)
+	}
+	if !isValidIDFormat(config.IDFormat) {
+		r.fail("Unsupported ID format '%s'", config.IDFormat)
+	}
+	if config.IDFormat == SequenceIDFormat {
+		if err := validateIDPrefix(config.IDPrefix); err != nil {
+			r.add(err)
+		}
+	}
+	if config.LeaderElection && config.LeaderElectionLease == "" {
+		r.fail("A Lease name is required for leader election")
+	}
+	if config.ResultStoreRetention < 0 {
+		r.fail("The result store retention cannot be negative")
+	}
+	if config.DataRetention < 0 {
+		r.fail("The data retention cannot be negative")
+	}
+	if config.JanitorInterval <= 0 {
+		r.fail("The janitor interval must be positive")
+	}
+	if !isValidCleanupPolicy(config.CleanupPolicy) {
+		r.fail("Unsupported cleanup policy '%s'", config.CleanupPolicy)
+	}
+	if config.CleanupPolicy == TTLCleanupPolicy && config.CleanupTTL <= 0 {
+		r.fail("The cleanup TTL must be positive for the ttl cleanup policy")
+	}
+	if config.CleanupTTL < 0 || (config.CleanupTTL > 0 && config.CleanupTTL < minJobTTL) {
+		r.fail("The cleanup TTL must be at least %s, or 0 to disable it", minJobTTL)
+	}
+	if config.KeepFailedJobs < 0 {
+		r.fail("The time failed Jobs are kept for cannot be negative")
+	}
+	if config.SnapshotLogs && config.ResultStore == "" {
+		r.fail("A result store is required to snapshot recipe logs")
+	}
+	if config.ExportInterval > 0 && config.ExportDestination == "" {
+		r.fail("An export destination is required to enable the export")
+	}
+	if config.PrometheusURL != "" && config.PollInterval <= 0 {
+		r.fail("The poll interval must be positive to enable the poller")
+	}
+	if _, err := parseFederationPeers(config.FederationPeers); err != nil {
+		r.add(err)
+	}
+	if config.FederationPeers != "" && config.FederationToken == "" {
+		r.fail("A federation token is required to forward recipes to peers")
+	}
+	if (config.TLSCert == "") != (config.TLSKey == "") {
+		r.fail("Both a TLS certificate and a TLS key are required")
+	}
+	if config.MaxSubscriptions < 0 {
+		r.fail("The maximum number of subscriptions cannot be negative")
+	}
+	if config.ShutdownTimeout < 0 {
+		r.fail("The shutdown timeout cannot be negative")
+	}
+	if config.Canary && config.CanaryImage == "" {
+		r.fail("The canary self-test requires an image")
+	}
+	if config.CanaryInterval < 0 {
+		r.fail("The canary interval cannot be negative")
+	}
+	if config.SchemaDriftSamples < 0 {
+		r.fail("The number of schema drift samples cannot be negative")
+	}
+	if config.CloudEventsSink != "" && !isValidCloudEventsSink(config.CloudEventsSink) {
+		r.fail("Unsupported CloudEvents sink '%s'", config.CloudEventsSink)
+	}
+	if config.DebugSessions && config.DebugImage == "" {
+		r.fail("Debugging sessions require an image")
+	}
+	if config.DebugSessionTTL <= 0 || config.DebugSessionMaxTTL < config.DebugSessionTTL {
+		r.fail("The debugging session TTL must be positive and cannot exceed the maximum TTL")
+	}
+	if config.StatusConfigMap != "" {
+		if errs := validation.IsDNS1123Subdomain(config.StatusConfigMap); len(errs) > 0 {
+			r.fail(
+				"Invalid status ConfigMap name '%s': %s",
+				config.StatusConfigMap, strings.Join(errs, ", "),
+			)
+		}
+		if config.StatusInterval <= 0 {
+			r.fail("The status interval must be positive to update the status ConfigMap")
+		}
+	}
+	if err := validateOverridePolicy(&config); err != nil {
+		r.add(err)
+	}
+	if err := validateRedisConfig(&config); err != nil {
+		r.add(err)
+	}
+	if err := validateSinks(&config); err != nil {
+		r.add(err)
+	}
+	if _, err := parseClusters(config.Clusters); err != nil {
+		r.add(err)
+	}
+	if err := validateChatOps(&config); err != nil {
+		r.add(err)
+	}
+	if err := validateAuthModes(config.WebhookAuth, &config); err != nil {
+		r.fail("Invalid webhook authentication: %w", err)
+	}
+	if err := validateAuthModes(config.APIAuth, &config); err != nil {
+		r.fail("Invalid API authentication: %w", err)
+	}
+	r.warnDeprecated()
+	if len(r.errs) > 0 {
+		return Config{}, &ConfigError{Errors: r.errs}
 	}
 	return config, nil
 }
@@ -88,3 +908,135 @@ func getReconcilerNamespace() (string, error) {
 		"Failed to read Reconciler namespace from service account or environment variable",
 	)
 }
+
+// ConfigError reports all the invalid options of the configuration, so that they can be fixed at
+// once rather than one restart at a time.
+type ConfigError struct {
+	Errors []error
+}
+
+func (e *ConfigError) Error() string {
+	if len(e.Errors) == 1 {
+		return fmt.Sprintf("Invalid configuration: %v", e.Errors[0])
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Invalid configuration, %d problems found:", len(e.Errors))
+	for _, err := range e.Errors {
+		fmt.Fprintf(&b, "\n  - %v", err)
+	}
+	return b.String()
+}
+
+func (e *ConfigError) Unwrap() []error {
+	return e.Errors
+}
+
+// configReader reads typed options from the layered sources of the configuration, collecting the
+// options that cannot be parsed along with the ones that fail validation.
+type configReader struct {
+	v    *viper.Viper
+	errs []error
+	// Duration options given as bare numbers, read in their legacy unit
+	deprecated []string
+}
+
+func (r *configReader) add(err error) {
+	r.errs = append(r.errs, err)
+}
+
+func (r *configReader) fail(format string, args ...interface{}) {
+	r.add(fmt.Errorf(format, args...))
+}
+
+func (r *configReader) String(key string) string {
+	return r.v.GetString(key)
+}
+
+func (r *configReader) Int(key string) int {
+	value := strings.TrimSpace(r.v.GetString(key))
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		r.fail("Option '%s' must be an integer, got '%s'", key, value)
+	}
+	return n
+}
+
+func (r *configReader) Bool(key string) bool {
+	value := strings.TrimSpace(r.v.GetString(key))
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		r.fail("Option '%s' must be true or false, got '%s'", key, value)
+	}
+	return b
+}
+
+// Read a duration with its unit, e.g. 90s, 5m or 30d. Bare numbers are read in the unit the option
+// used to be configured in, which is deprecated as it is ambiguous.
+func (r *configReader) Duration(key string, unit time.Duration) time.Duration {
+	value := strings.TrimSpace(r.v.GetString(key))
+	if n, err := strconv.Atoi(value); err == nil {
+		if n != 0 {
+			r.deprecated = append(r.deprecated, key)
+		}
+		return time.Duration(n) * unit
+	}
+	d, err := parseDuration(value)
+	if err != nil {
+		r.fail("Option '%s' must be a duration such as 30s, 5m or 7d, got '%s'", key, value)
+	}
+	return d
+}
+
+// Warn about the duration options given without a unit.
+func (r *configReader) warnDeprecated() {
+	if len(r.deprecated) > 0 {
+		logger.Warn(
+			"Durations without a unit are deprecated, e.g. use 5m instead of 300 seconds",
+			zap.Strings("options", r.deprecated),
+		)
+	}
+}
+
+// Parse a Go duration, also accepting whole days, e.g. 30d, for retention periods.
+func parseDuration(value string) (time.Duration, error) {
+	if days, found := strings.CutSuffix(value, "d"); found {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("Invalid number of days '%s'", value)
+		}
+		return time.Duration(n) * day, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// Check that the address of a service is either a host and port, or an HTTP(S) URL.
+func validateAddress(service string, address string) error {
+	invalid := fmt.Errorf(
+		"Invalid %s address '%s', expected an HTTP(S) URL or <host>:<port>", service, address,
+	)
+	if strings.Contains(address, "://") {
+		u, err := url.Parse(address)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return invalid
+		}
+		return nil
+	}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || host == "" {
+		return invalid
+	}
+	if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+		return invalid
+	}
+	return nil
+}
+
+// Find the configuration file in the command-line arguments, ahead of parsing the rest of them.
+func configFileFlag(args []string) string {
+	fs := pflag.NewFlagSet("config-file", pflag.ContinueOnError)
+	fs.ParseErrorsWhitelist.UnknownFlags = true
+	fs.SetOutput(io.Discard)
+	configFile := fs.String("config-file", "", "")
+	_ = fs.Parse(args)
+	return *configFile
+}
@@ -2,7 +2,9 @@ package main
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
@@ -31,9 +33,45 @@ func TestParseConfig(t *testing.T) {
 				AggregatorAddress:   "localhost:8080",
 				RedisAddress:        "localhost:6379",
 				WebexBotAddress:     "localhost:7001",
-				RecipeTimeout:       300,
+				RecipeTimeout:       5 * time.Minute,
 				RecipeNamespace:     "default",
 				ReconcilerNamespace: "default",
+				PayloadSchema:       "raw",
+				PayloadAlertsField:  "alerts",
+				IncidentStore:       "memory",
+				IncidentRetention:   24 * time.Hour,
+				ExportFormat:        "jsonl",
+				ResultBroker:        "redis",
+				PollInterval:        time.Minute,
+				Workers:             50,
+				QueueSize:           1000,
+				QueueOverflow:       "enqueue",
+				MaxBatchSize:        100,
+
+				InlineRecipeMaxCPU:    "500m",
+				InlineRecipeMaxMemory: "512Mi",
+				NodeProblemLabel:      "node",
+				LeaderElectionLease:   "euphrosyne-reconciler",
+				IDFormat:              "uuid",
+				IDPrefix:              "inc",
+				CleanupPolicy:         "delete",
+				CleanupTTL:            time.Hour,
+				MaxSubscriptions:      2000,
+				ShutdownTimeout:       25 * time.Second,
+				CanaryImage:           "phoevos/euphrosyne-recipes:latest",
+				DebugImage:            "phoevos/euphrosyne-debug:latest",
+				DebugSessionTTL:       time.Hour,
+				DebugSessionMaxTTL:    4 * time.Hour,
+				SchemaDriftSamples:    20,
+				MinRecipeTimeout:      time.Minute,
+				RedisMode:             "standalone",
+				Sinks:                 "webex",
+				JiraIssueType:         "Task",
+				SinkRetries:           2,
+				SinkFailureThreshold:  5,
+				SinkCooldown:          time.Minute,
+				JanitorInterval:       time.Hour,
+				StatusInterval:        30 * time.Second,
 			},
 		},
 		{
@@ -51,9 +89,45 @@ func TestParseConfig(t *testing.T) {
 				AggregatorAddress:   "localhost:8081",
 				RedisAddress:        "localhost:6380",
 				WebexBotAddress:     "localhost:7002",
-				RecipeTimeout:       400,
+				RecipeTimeout:       400 * time.Second,
 				RecipeNamespace:     "recipe-ns",
 				ReconcilerNamespace: "reconciler-ns",
+				PayloadSchema:       "raw",
+				PayloadAlertsField:  "alerts",
+				IncidentStore:       "memory",
+				IncidentRetention:   24 * time.Hour,
+				ExportFormat:        "jsonl",
+				ResultBroker:        "redis",
+				PollInterval:        time.Minute,
+				Workers:             50,
+				QueueSize:           1000,
+				QueueOverflow:       "enqueue",
+				MaxBatchSize:        100,
+
+				InlineRecipeMaxCPU:    "500m",
+				InlineRecipeMaxMemory: "512Mi",
+				NodeProblemLabel:      "node",
+				LeaderElectionLease:   "euphrosyne-reconciler",
+				IDFormat:              "uuid",
+				IDPrefix:              "inc",
+				CleanupPolicy:         "delete",
+				CleanupTTL:            time.Hour,
+				MaxSubscriptions:      2000,
+				ShutdownTimeout:       25 * time.Second,
+				CanaryImage:           "phoevos/euphrosyne-recipes:latest",
+				DebugImage:            "phoevos/euphrosyne-debug:latest",
+				DebugSessionTTL:       time.Hour,
+				DebugSessionMaxTTL:    4 * time.Hour,
+				SchemaDriftSamples:    20,
+				MinRecipeTimeout:      time.Minute,
+				RedisMode:             "standalone",
+				Sinks:                 "webex",
+				JiraIssueType:         "Task",
+				SinkRetries:           2,
+				SinkFailureThreshold:  5,
+				SinkCooldown:          time.Minute,
+				JanitorInterval:       time.Hour,
+				StatusInterval:        30 * time.Second,
 			},
 		},
 		{
@@ -72,9 +146,45 @@ func TestParseConfig(t *testing.T) {
 				AggregatorAddress:   "localhost:8082",
 				RedisAddress:        "localhost:6381",
 				WebexBotAddress:     "localhost:7003",
-				RecipeTimeout:       500,
+				RecipeTimeout:       500 * time.Second,
 				RecipeNamespace:     "recipe-ns",
 				ReconcilerNamespace: "default",
+				PayloadSchema:       "raw",
+				PayloadAlertsField:  "alerts",
+				IncidentStore:       "memory",
+				IncidentRetention:   24 * time.Hour,
+				ExportFormat:        "jsonl",
+				ResultBroker:        "redis",
+				PollInterval:        time.Minute,
+				Workers:             50,
+				QueueSize:           1000,
+				QueueOverflow:       "enqueue",
+				MaxBatchSize:        100,
+
+				InlineRecipeMaxCPU:    "500m",
+				InlineRecipeMaxMemory: "512Mi",
+				NodeProblemLabel:      "node",
+				LeaderElectionLease:   "euphrosyne-reconciler",
+				IDFormat:              "uuid",
+				IDPrefix:              "inc",
+				CleanupPolicy:         "delete",
+				CleanupTTL:            time.Hour,
+				MaxSubscriptions:      2000,
+				ShutdownTimeout:       25 * time.Second,
+				CanaryImage:           "phoevos/euphrosyne-recipes:latest",
+				DebugImage:            "phoevos/euphrosyne-debug:latest",
+				DebugSessionTTL:       time.Hour,
+				DebugSessionMaxTTL:    4 * time.Hour,
+				SchemaDriftSamples:    20,
+				MinRecipeTimeout:      time.Minute,
+				RedisMode:             "standalone",
+				Sinks:                 "webex",
+				JiraIssueType:         "Task",
+				SinkRetries:           2,
+				SinkFailureThreshold:  5,
+				SinkCooldown:          time.Minute,
+				JanitorInterval:       time.Hour,
+				StatusInterval:        30 * time.Second,
 			},
 		}, {
 			name: "CommandLineArgsOverrideEnvVars",
@@ -95,9 +205,45 @@ func TestParseConfig(t *testing.T) {
 				AggregatorAddress:   "localhost:8084", // Expect command-line argument value
 				RedisAddress:        "localhost:6383", // Expect command-line argument value
 				WebexBotAddress:     "localhost:7004", // Expect environment variable value
-				RecipeTimeout:       600,              // Expect environment variable value
+				RecipeTimeout:       10 * time.Minute, // Expect environment variable value
 				RecipeNamespace:     "recipe-ns",      // Expect environment variable value
 				ReconcilerNamespace: "default",        // Expect default value
+				PayloadSchema:       "raw",            // Expect default value
+				PayloadAlertsField:  "alerts",         // Expect default value
+				IncidentStore:       "memory",         // Expect default value
+				IncidentRetention:   24 * time.Hour,   // Expect default value
+				ExportFormat:        "jsonl",          // Expect default value
+				ResultBroker:        "redis",          // Expect default value
+				PollInterval:        time.Minute,      // Expect default value
+				Workers:             50,               // Expect default value
+				QueueSize:           1000,             // Expect default value
+				QueueOverflow:       "enqueue",        // Expect default value
+				MaxBatchSize:        100,              // Expect default value
+
+				InlineRecipeMaxCPU:    "500m",                              // Expect default value
+				InlineRecipeMaxMemory: "512Mi",                             // Expect default value
+				NodeProblemLabel:      "node",                              // Expect default value
+				LeaderElectionLease:   "euphrosyne-reconciler",             // Expect default value
+				IDFormat:              "uuid",                              // Expect default value
+				IDPrefix:              "inc",                               // Expect default value
+				CleanupPolicy:         "delete",                            // Expect default value
+				CleanupTTL:            time.Hour,                           // Expect default value
+				MaxSubscriptions:      2000,                                // Expect default value
+				ShutdownTimeout:       25 * time.Second,                    // Expect default value
+				CanaryImage:           "phoevos/euphrosyne-recipes:latest", // Expect default value
+				DebugImage:            "phoevos/euphrosyne-debug:latest",   // Expect default value
+				DebugSessionTTL:       time.Hour,                           // Expect default value
+				DebugSessionMaxTTL:    4 * time.Hour,                       // Expect default value
+				SchemaDriftSamples:    20,                                  // Expect default value
+				MinRecipeTimeout:      time.Minute,                         // Expect default value
+				RedisMode:             "standalone",                        // Expect default value
+				Sinks:                 "webex",                             // Expect default value
+				JiraIssueType:         "Task",                              // Expect default value
+				SinkRetries:           2,                                   // Expect default value
+				SinkFailureThreshold:  5,                                   // Expect default value
+				SinkCooldown:          time.Minute,                         // Expect default value
+				JanitorInterval:       time.Hour,                           // Expect default value
+				StatusInterval:        30 * time.Second,                    // Expect default value
 			},
 		},
 		{
@@ -116,9 +262,45 @@ func TestParseConfig(t *testing.T) {
 				AggregatorAddress:   "localhost:8085", // Expect environment variable value
 				RedisAddress:        "localhost:6385", // Expect command-line argument value
 				WebexBotAddress:     "localhost:7003", // Expect command-line argument value
-				RecipeTimeout:       300,              // Expect default value
+				RecipeTimeout:       5 * time.Minute,  // Expect default value
 				RecipeNamespace:     "default",        // Expect default value
 				ReconcilerNamespace: "default",        // Expect default value
+				PayloadSchema:       "raw",            // Expect default value
+				PayloadAlertsField:  "alerts",         // Expect default value
+				IncidentStore:       "memory",         // Expect default value
+				IncidentRetention:   24 * time.Hour,   // Expect default value
+				ExportFormat:        "jsonl",          // Expect default value
+				ResultBroker:        "redis",          // Expect default value
+				PollInterval:        time.Minute,      // Expect default value
+				Workers:             50,               // Expect default value
+				QueueSize:           1000,             // Expect default value
+				QueueOverflow:       "enqueue",        // Expect default value
+				MaxBatchSize:        100,              // Expect default value
+
+				InlineRecipeMaxCPU:    "500m",                              // Expect default value
+				InlineRecipeMaxMemory: "512Mi",                             // Expect default value
+				NodeProblemLabel:      "node",                              // Expect default value
+				LeaderElectionLease:   "euphrosyne-reconciler",             // Expect default value
+				IDFormat:              "uuid",                              // Expect default value
+				IDPrefix:              "inc",                               // Expect default value
+				CleanupPolicy:         "delete",                            // Expect default value
+				CleanupTTL:            time.Hour,                           // Expect default value
+				MaxSubscriptions:      2000,                                // Expect default value
+				ShutdownTimeout:       25 * time.Second,                    // Expect default value
+				CanaryImage:           "phoevos/euphrosyne-recipes:latest", // Expect default value
+				DebugImage:            "phoevos/euphrosyne-debug:latest",   // Expect default value
+				DebugSessionTTL:       time.Hour,                           // Expect default value
+				DebugSessionMaxTTL:    4 * time.Hour,                       // Expect default value
+				SchemaDriftSamples:    20,                                  // Expect default value
+				MinRecipeTimeout:      time.Minute,                         // Expect default value
+				RedisMode:             "standalone",                        // Expect default value
+				Sinks:                 "webex",                             // Expect default value
+				JiraIssueType:         "Task",                              // Expect default value
+				SinkRetries:           2,                                   // Expect default value
+				SinkFailureThreshold:  5,                                   // Expect default value
+				SinkCooldown:          time.Minute,                         // Expect default value
+				JanitorInterval:       time.Hour,                           // Expect default value
+				StatusInterval:        30 * time.Second,                    // Expect default value
 			},
 		},
 	}
@@ -148,3 +330,103 @@ func TestParseConfig(t *testing.T) {
 		})
 	}
 }
+
+// Test that durations are read with their units, while bare numbers keep their legacy unit.
+func TestParseConfigDurations(t *testing.T) {
+	t.Setenv("RECONCILER_NAMESPACE", "default")
+	t.Setenv("DATA_RETENTION", "30d")
+	t.Setenv("INCIDENT_RETENTION", "7200")
+
+	config, err := ParseConfig([]string{
+		"--recipe-timeout=10m",
+		"--shutdown-timeout=1m30s",
+		"--keep-failed-jobs=36",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 10*time.Minute, config.RecipeTimeout)
+	assert.Equal(t, 90*time.Second, config.ShutdownTimeout)
+	assert.Equal(t, 36*time.Hour, config.KeepFailedJobs)
+	assert.Equal(t, 30*day, config.DataRetention)
+	assert.Equal(t, 2*time.Hour, config.IncidentRetention)
+}
+
+// Test that the configuration file is overridden by environment variables and flags.
+func TestParseConfigFile(t *testing.T) {
+	t.Setenv("RECONCILER_NAMESPACE", "default")
+	t.Setenv("WORKERS", "20")
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(configFile, []byte(`
+recipe-timeout: 2m
+workers: 10
+redis-address: redis:6379
+dry-run: true
+`), 0o600))
+
+	config, err := ParseConfig(
+		[]string{"--config-file", configFile, "--redis-address=redis-0:6379"},
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, 2*time.Minute, config.RecipeTimeout)
+	assert.Equal(t, 20, config.Workers)
+	assert.Equal(t, "redis-0:6379", config.RedisAddress)
+	assert.True(t, config.DryRun)
+
+	// Misspelt options are reported rather than ignored
+	assert.NoError(t, os.WriteFile(configFile, []byte("recipe-timout: 2m\n"), 0o600))
+	_, err = ParseConfig([]string{"--config-file=" + configFile})
+	assert.ErrorContains(t, err, "Unknown option 'recipe-timout'")
+
+	_, err = ParseConfig([]string{"--config-file=" + filepath.Join(t.TempDir(), "missing.yaml")})
+	assert.ErrorContains(t, err, "Failed to read configuration file")
+}
+
+// Test that all the invalid options are reported at once.
+func TestParseConfigErrors(t *testing.T) {
+	t.Setenv("RECONCILER_NAMESPACE", "default")
+	t.Setenv("MAX_SUBSCRIPTIONS", "many")
+
+	_, err := ParseConfig([]string{
+		"--recipe-timeout=soon",
+		"--aggregator-address=http//aggregator",
+		"--redis-address=redis",
+		"--max-batch-size=0",
+	})
+	var configErr *ConfigError
+	assert.ErrorAs(t, err, &configErr)
+	assert.Len(t, configErr.Errors, 5)
+	for _, option := range []string{"recipe-timeout", "max-subscriptions"} {
+		assert.ErrorContains(t, err, "Option '"+option+"'")
+	}
+	assert.ErrorContains(t, err, "Invalid aggregator address 'http//aggregator'")
+	assert.ErrorContains(t, err, "Invalid Redis address 'redis'")
+	assert.ErrorContains(t, err, "The maximum batch size must be positive")
+
+	_, err = ParseConfig([]string{"--workers=many"})
+	assert.ErrorContains(t, err, "Invalid command-line arguments")
+}
+
+// Test that addresses are either hosts and ports, or HTTP(S) URLs.
+func TestValidateAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		valid   bool
+	}{
+		{address: "localhost:8080", valid: true},
+		{address: "10.0.0.1:80", valid: true},
+		{address: "[::1]:7001", valid: true},
+		{address: "http://thalia-aggregator.default.svc.cluster.local", valid: true},
+		{address: "https://bot.example.com:8443/webex", valid: true},
+		{address: "localhost"},
+		{address: "localhost:http"},
+		{address: ":8080"},
+		{address: "localhost:70000"},
+		{address: "ftp://bot.example.com"},
+		{address: "http://"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			assert.Equal(t, tt.valid, validateAddress("aggregator", tt.address) == nil)
+		})
+	}
+}
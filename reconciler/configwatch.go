@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// Sources of configuration that are reloaded when their ConfigMaps change.
+const (
+	CatalogConfigSource   = "catalog"
+	TemplatesConfigSource = "templates"
+	RoutesConfigSource    = "routes"
+	// Configuration file of the Reconciler, whose changes are validated but applied on restart
+	FileConfigSource = "config"
+)
+
+var (
+	// Time to wait before watching the ConfigMaps again once a watch ends
+	configWatchBackoff = 5 * time.Second
+	// Interval between checks of the configuration file for changes
+	configFileCheckInterval = 10 * time.Second
+)
+
+// ConfigSourceStatus reports the outcome of the latest load of a configuration source.
+type ConfigSourceStatus struct {
+	Valid       bool      `json:"valid"`
+	Error       string    `json:"error,omitempty"`
+	LastAttempt time.Time `json:"lastAttempt"`
+	// Time the configuration currently in use was loaded, kept while newer versions are invalid
+	LastLoaded *time.Time `json:"lastLoaded,omitempty"`
+	// Whether a valid version differs from the one in use until the Reconciler restarts
+	RestartRequired bool `json:"restartRequired,omitempty"`
+}
+
+// ConfigStatus keeps track of the loads of each configuration source, so that invalid changes are
+// reported as soon as they are made rather than when the next alert arrives.
+type ConfigStatus struct {
+	mutex   sync.RWMutex
+	sources map[string]*ConfigSourceStatus
+}
+
+var configStatus = NewConfigStatus()
+
+// Initialise an empty configuration status.
+func NewConfigStatus() *ConfigStatus {
+	return &ConfigStatus{sources: make(map[string]*ConfigSourceStatus)}
+}
+
+// Record the outcome of loading a configuration source. Failed loads keep the last known good
+// configuration in use.
+func (cs *ConfigStatus) Record(source string, err error) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	status, ok := cs.sources[source]
+	if !ok {
+		status = &ConfigSourceStatus{}
+		cs.sources[source] = status
+	}
+	now := time.Now().UTC()
+	status.LastAttempt = now
+	status.Valid = err == nil
+	status.Error = ""
+	if err != nil {
+		status.Error = err.Error()
+		configReloadFailures.WithLabelValues(source).Inc()
+		return
+	}
+	status.LastLoaded = &now
+}
+
+// Record whether the valid version of a configuration source is waiting for a restart to apply.
+func (cs *ConfigStatus) SetRestartRequired(source string, restartRequired bool) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	if status, ok := cs.sources[source]; ok {
+		status.RestartRequired = restartRequired
+	}
+}
+
+// Return a copy of the status of each configuration source, and whether all of them are valid.
+func (cs *ConfigStatus) Snapshot() (map[string]ConfigSourceStatus, bool) {
+	cs.mutex.RLock()
+	defer cs.mutex.RUnlock()
+
+	valid := true
+	sources := make(map[string]ConfigSourceStatus, len(cs.sources))
+	for source, status := range cs.sources {
+		sources[source] = *status
+		valid = valid && status.Valid
+	}
+	return sources, valid
+}
+
+// ConfigWatcher reloads the recipe catalog, the message templates and the request routes whenever
+// their ConfigMaps change, and validates the changes to the configuration file of the Reconciler.
+type ConfigWatcher struct {
+	namespace string
+	config    *Config
+	// Arguments the configuration was parsed from, parsed again when the configuration file changes
+	args []string
+}
+
+// Initialise a watcher for the ConfigMaps in the Reconciler namespace and the configuration file.
+func NewConfigWatcher(config *Config, args []string) *ConfigWatcher {
+	return &ConfigWatcher{namespace: config.ReconcilerNamespace, config: config, args: args}
+}
+
+// Watch the configuration until the context is cancelled.
+func (w *ConfigWatcher) Run(ctx context.Context) {
+	for _, options := range configWatchOptions() {
+		go w.watchConfigMaps(ctx, options)
+	}
+	if w.config.ConfigFile != "" {
+		configStatus.Record(FileConfigSource, nil)
+		go w.watchFile(ctx, configFileCheckInterval)
+	}
+	<-ctx.Done()
+}
+
+// Select the ConfigMaps holding configuration, i.e. the catalog, its shards, the templates and the
+// routes, so that changes to other ConfigMaps, e.g. the data of executions, are not watched.
+func configWatchOptions() []metav1.ListOptions {
+	options := []metav1.ListOptions{{LabelSelector: catalogShardLabel + "=true"}}
+	for _, name := range []string{configMapName, templatesConfigMapName, routesConfigMapName} {
+		options = append(options, metav1.ListOptions{
+			FieldSelector: fields.OneTermEqualSelector("metadata.name", name).String(),
+		})
+	}
+	return options
+}
+
+// Watch the selected ConfigMaps until the context is cancelled, watching again whenever the watch
+// ends.
+func (w *ConfigWatcher) watchConfigMaps(ctx context.Context, options metav1.ListOptions) {
+	for {
+		if err := w.watch(ctx, options); err != nil {
+			logger.Warn("Failed to watch configuration ConfigMaps", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(configWatchBackoff):
+		}
+	}
+}
+
+// Watch the selected ConfigMaps once, reloading the configuration sources affected by each change.
+func (w *ConfigWatcher) watch(ctx context.Context, options metav1.ListOptions) error {
+	watcher, err := clientset.CoreV1().ConfigMaps(w.namespace).Watch(ctx, options)
+	if err != nil {
+		return err
+	}
+	defer watcher.Stop()
+
+	for event := range watcher.ResultChan() {
+		if event.Type == watch.Error || event.Type == watch.Bookmark {
+			continue
+		}
+		configMap, ok := event.Object.(*corev1.ConfigMap)
+		if !ok {
+			continue
+		}
+		source, ok := configMapSource(configMap)
+		if !ok {
+			continue
+		}
+
+		logger.Info(
+			"Configuration ConfigMap changed",
+			zap.String("configMap", configMap.Name),
+			zap.String("event", string(event.Type)),
+		)
+		w.reload(source)
+	}
+	return nil
+}
+
+// Reload a configuration source, keeping the last known good configuration if it is invalid.
+func (w *ConfigWatcher) reload(source string) {
+	var err error
+	switch source {
+	case CatalogConfigSource:
+		_, err = ReloadRecipeCatalog(w.namespace)
+	case TemplatesConfigSource:
+		err = LoadMessageTemplates(w.namespace)
+	case RoutesConfigSource:
+		err = LoadRoutes(w.config)
+	}
+	if err != nil {
+		logger.Error(
+			"Invalid configuration, keeping the last known good one",
+			zap.String("source", source),
+			zap.Error(err),
+		)
+	}
+}
+
+// Determine the configuration source held by a ConfigMap, if any.
+func configMapSource(configMap *corev1.ConfigMap) (string, bool) {
+	switch {
+	case configMap.Name == configMapName || configMap.Labels[catalogShardLabel] == "true":
+		return CatalogConfigSource, true
+	case configMap.Name == templatesConfigMapName:
+		return TemplatesConfigSource, true
+	case configMap.Name == routesConfigMapName:
+		return RoutesConfigSource, true
+	}
+	return "", false
+}
+
+// Check the configuration file for changes until the context is cancelled. Mounted ConfigMaps are
+// updated by replacing their files, so changes are detected by content rather than by event.
+func (w *ConfigWatcher) watchFile(ctx context.Context, interval time.Duration) {
+	hash, _ := fileHash(w.config.ConfigFile)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		current, err := fileHash(w.config.ConfigFile)
+		if err == nil && current == hash {
+			continue
+		}
+		hash = current
+		logger.Info("Configuration file changed", zap.String("file", w.config.ConfigFile))
+		w.validateFile()
+	}
+}
+
+// Validate the configuration with the current version of the configuration file. The configuration
+// in use is kept either way: most options configure clients, servers and workers set up on
+// start-up, so valid changes are only applied when the Reconciler restarts.
+func (w *ConfigWatcher) validateFile() {
+	config, err := ParseConfig(w.args)
+	configStatus.Record(FileConfigSource, err)
+	if err != nil {
+		logger.Error(
+			"Invalid configuration file, keeping the configuration in use",
+			zap.String("file", w.config.ConfigFile),
+			zap.Error(err),
+		)
+		return
+	}
+	restartRequired := config != *w.config
+	configStatus.SetRestartRequired(FileConfigSource, restartRequired)
+	if restartRequired {
+		logger.Warn(
+			"Configuration file changed, restart the Reconciler to apply it",
+			zap.String("file", w.config.ConfigFile),
+		)
+	}
+}
+
+// Hash the contents of a file.
+func fileHash(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("Failed to read '%s': %w", path, err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Test that invalid configuration changes are reported while the last good load is kept.
+func TestConfigStatus(t *testing.T) {
+	cs := NewConfigStatus()
+	cs.Record(CatalogConfigSource, nil)
+	cs.Record(TemplatesConfigSource, nil)
+	sources, valid := cs.Snapshot()
+	assert.True(t, valid)
+	loaded := sources[CatalogConfigSource].LastLoaded
+
+	cs.Record(CatalogConfigSource, errors.New("Failed to parse debugging recipes"))
+	sources, valid = cs.Snapshot()
+	assert.False(t, valid)
+	assert.False(t, sources[CatalogConfigSource].Valid)
+	assert.Equal(t, "Failed to parse debugging recipes", sources[CatalogConfigSource].Error)
+	assert.Equal(t, loaded, sources[CatalogConfigSource].LastLoaded)
+	assert.True(t, sources[TemplatesConfigSource].Valid)
+}
+
+// Test that only the ConfigMaps holding configuration trigger reloads.
+func TestConfigMapSource(t *testing.T) {
+	testCases := []struct {
+		name      string
+		configMap metav1.ObjectMeta
+		source    string
+		ok        bool
+	}{
+		{"Catalog", metav1.ObjectMeta{Name: configMapName}, CatalogConfigSource, true},
+		{
+			"Shard",
+			metav1.ObjectMeta{
+				Name: "team-recipes", Labels: map[string]string{catalogShardLabel: "true"},
+			},
+			CatalogConfigSource,
+			true,
+		},
+		{"Templates", metav1.ObjectMeta{Name: templatesConfigMapName}, TemplatesConfigSource, true},
+		{"Routes", metav1.ObjectMeta{Name: routesConfigMapName}, RoutesConfigSource, true},
+		{"Other", metav1.ObjectMeta{Name: "kube-root-ca.crt"}, "", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			source, ok := configMapSource(&corev1.ConfigMap{ObjectMeta: tc.configMap})
+			assert.Equal(t, tc.ok, ok)
+			assert.Equal(t, tc.source, source)
+		})
+	}
+}
+
+// Test that only the ConfigMaps holding configuration are watched.
+func TestConfigWatchOptions(t *testing.T) {
+	options := configWatchOptions()
+	assert.Equal(t, 4, len(options))
+	assert.Equal(t, catalogShardLabel+"=true", options[0].LabelSelector)
+	assert.Equal(t, "metadata.name="+configMapName, options[1].FieldSelector)
+	assert.Equal(t, "metadata.name="+templatesConfigMapName, options[2].FieldSelector)
+	assert.Equal(t, "metadata.name="+routesConfigMapName, options[3].FieldSelector)
+}
+
+// Test that changes to the configuration file are validated, keeping the configuration in use and
+// reporting valid changes as waiting for a restart.
+func TestConfigWatcherValidateFile(t *testing.T) {
+	previous := configStatus
+	configStatus = NewConfigStatus()
+	defer func() { configStatus = previous }()
+
+	t.Setenv("RECONCILER_NAMESPACE", "default")
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, os.WriteFile(configFile, []byte("workers: 10\n"), 0o600))
+	args := []string{"--config-file", configFile}
+	config, err := ParseConfig(args)
+	assert.NoError(t, err)
+	w := NewConfigWatcher(&config, args)
+
+	w.validateFile()
+	sources, valid := configStatus.Snapshot()
+	assert.True(t, valid)
+	assert.False(t, sources[FileConfigSource].RestartRequired)
+
+	assert.NoError(t, os.WriteFile(configFile, []byte("workers: 20\n"), 0o600))
+	w.validateFile()
+	sources, valid = configStatus.Snapshot()
+	assert.True(t, valid)
+	assert.True(t, sources[FileConfigSource].RestartRequired)
+	assert.Equal(t, 10, w.config.Workers)
+
+	assert.NoError(t, os.WriteFile(configFile, []byte("workers: many\n"), 0o600))
+	w.validateFile()
+	sources, valid = configStatus.Snapshot()
+	assert.False(t, valid)
+	assert.Contains(t, sources[FileConfigSource].Error, "Option 'workers' must be an integer")
+	assert.NotNil(t, sources[FileConfigSource].LastLoaded)
+	assert.Equal(t, 10, w.config.Workers)
+}
+
+// Test that the configuration status is exposed through the API.
+func TestHandleConfigStatusRequest(t *testing.T) {
+	previous := configStatus
+	configStatus = NewConfigStatus()
+	defer func() { configStatus = previous }()
+	configStatus.Record(CatalogConfigSource, errors.New("Invalid recipes"))
+
+	router := gin.New()
+	router.GET("/api/v1/config/status", handleConfigStatusRequest)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/config/status", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"valid":false`)
+	assert.Contains(t, w.Body.String(), `"error":"Invalid recipes"`)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// CooldownTracker keeps track of the alerts that were recently reconciled, so that bursts of the
+// same alert don't trigger a new execution each time.
+type CooldownTracker struct {
+	mutex   sync.Mutex
+	entries map[string]cooldownEntry
+}
+
+type cooldownEntry struct {
+	uuid    string
+	expires time.Time
+}
+
+var cooldowns = NewCooldownTracker()
+
+// Initialise an empty cooldown tracker.
+func NewCooldownTracker() *CooldownTracker {
+	return &CooldownTracker{entries: make(map[string]cooldownEntry)}
+}
+
+// Build the cooldown key of an alert for a routing rule, i.e. the alert name along with the values
+// of the labels the cooldown is scoped by.
+func cooldownKey(rule RoutingRule, labels map[string]string) string {
+	scope := append([]string{}, rule.CooldownBy...)
+	sort.Strings(scope)
+
+	key := rule.Alertname
+	for _, label := range scope {
+		key += fmt.Sprintf(",%s=%s", label, labels[label])
+	}
+	return key
+}
+
+// Check whether an alert is in cooldown. If it is, the UUID of the active execution is returned.
+// Otherwise, a new cooldown period starts for the execution with the provided UUID.
+func (ct *CooldownTracker) Check(key string, window time.Duration, uuid string) (string, bool) {
+	ct.mutex.Lock()
+	defer ct.mutex.Unlock()
+
+	now := time.Now()
+	for k, entry := range ct.entries {
+		if now.After(entry.expires) {
+			delete(ct.entries, k)
+		}
+	}
+
+	if entry, ok := ct.entries[key]; ok {
+		return entry.uuid, true
+	}
+	ct.entries[key] = cooldownEntry{uuid: uuid, expires: now.Add(window)}
+	return "", false
+}
+
+// Release the entries started for an execution that did not take place after all.
+func (ct *CooldownTracker) Release(uuid string) {
+	ct.mutex.Lock()
+	defer ct.mutex.Unlock()
+
+	for k, entry := range ct.entries {
+		if entry.uuid == uuid {
+			delete(ct.entries, k)
+		}
+	}
+}
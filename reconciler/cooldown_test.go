@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"sigs.k8s.io/yaml"
+)
+
+// Test that routing rules are parsed with human-readable cooldowns.
+func TestRoutingRuleCooldown(t *testing.T) {
+	var rules []RoutingRule
+	err := yaml.Unmarshal([]byte(`
+- alertname: KubePodCrashLooping
+  cooldown: 10m
+  cooldownBy: [pod, namespace]
+- alertname: HighErrorRate
+  cooldown: 30
+`), &rules)
+	assert.Nil(t, err)
+	assert.Equal(t, 10*time.Minute, rules[0].Cooldown.Duration)
+	assert.Equal(t, 30*time.Second, rules[1].Cooldown.Duration)
+
+	err = yaml.Unmarshal([]byte(`[{"alertname": "x", "cooldown": "-1m"}]`), &rules)
+	assert.NotNil(t, err)
+	err = yaml.Unmarshal([]byte(`[{"alertname": "x", "cooldown": "soon"}]`), &rules)
+	assert.NotNil(t, err)
+}
+
+// Test that repeated alerts are suppressed within the cooldown window.
+func TestCooldownTracker(t *testing.T) {
+	rule := RoutingRule{
+		Alertname:  "KubePodCrashLooping",
+		Cooldown:   Duration{100 * time.Millisecond},
+		CooldownBy: []string{"namespace", "pod"},
+	}
+	pod1 := cooldownKey(rule, map[string]string{"namespace": "default", "pod": "web-1"})
+	pod2 := cooldownKey(rule, map[string]string{"namespace": "default", "pod": "web-2"})
+	assert.NotEqual(t, pod1, pod2)
+
+	ct := NewCooldownTracker()
+	_, ok := ct.Check(pod1, rule.Cooldown.Duration, "incident-1")
+	assert.False(t, ok)
+	_, ok = ct.Check(pod2, rule.Cooldown.Duration, "incident-2")
+	assert.False(t, ok)
+
+	active, ok := ct.Check(pod1, rule.Cooldown.Duration, "incident-3")
+	assert.True(t, ok)
+	assert.Equal(t, "incident-1", active)
+
+	// A new execution is allowed once the cooldown expires
+	time.Sleep(150 * time.Millisecond)
+	_, ok = ct.Check(pod1, rule.Cooldown.Duration, "incident-4")
+	assert.False(t, ok)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Shorthands for common schedules.
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cronField describes the values one of the fields of a cron expression accepts.
+type cronField struct {
+	name     string
+	min, max int
+}
+
+// Fields of a cron expression, in order. Sunday is both 0 and 7.
+var cronFields = []cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// How far ahead the next run of a schedule is looked for.
+const cronSearchLimit = 5 * 366 * 24 * time.Hour
+
+// CronSchedule is a parsed cron expression, i.e. the minutes, hours, days of the month, months and
+// days of the week it fires at, as bit sets. Schedules are evaluated in UTC.
+type CronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// Unrestricted days of the month or of the week, otherwise days matching either fire
+	domStar, dowStar bool
+}
+
+// Parse a standard cron expression with 5 fields, e.g. "0 2 * * *", or one of the shorthands,
+// e.g. "@daily". Fields accept numbers, ranges, lists and steps, e.g. "1-5", "0,30", "*/15".
+func ParseCronSchedule(spec string) (*CronSchedule, error) {
+	expression := strings.TrimSpace(spec)
+	if expanded, ok := cronMacros[expression]; ok {
+		expression = expanded
+	}
+	fields := strings.Fields(expression)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("Invalid schedule '%s', expected 5 fields", spec)
+	}
+
+	var bits [5]uint64
+	for i, field := range fields {
+		value, err := parseCronField(field, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid schedule '%s': %w", spec, err)
+		}
+		bits[i] = value
+	}
+	if bits[4]&(1<<7) != 0 {
+		bits[4] = bits[4]&^(1<<7) | 1
+	}
+
+	schedule := &CronSchedule{
+		minute:  bits[0],
+		hour:    bits[1],
+		dom:     bits[2],
+		month:   bits[3],
+		dow:     bits[4],
+		domStar: strings.HasPrefix(fields[2], "*"),
+		dowStar: strings.HasPrefix(fields[4], "*"),
+	}
+	// Reject schedules that never fire, e.g. on the 30th of February
+	if schedule.Next(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)).IsZero() {
+		return nil, fmt.Errorf("Invalid schedule '%s', it never fires", spec)
+	}
+	return schedule, nil
+}
+
+// Parse a field of a cron expression into the set of values it accepts.
+func parseCronField(field string, f cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		valueRange, stepText, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepText)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step '%s' in %s field", stepText, f.name)
+			}
+		}
+
+		var low, high int
+		var err error
+		switch lowText, highText, isRange := strings.Cut(valueRange, "-"); {
+		case valueRange == "*":
+			low, high = f.min, f.max
+		case isRange:
+			low, err = strconv.Atoi(lowText)
+			if err == nil {
+				high, err = strconv.Atoi(highText)
+			}
+		default:
+			low, err = strconv.Atoi(valueRange)
+			high = low
+			// A single value with a step covers the rest of the range, e.g. "5/15"
+			if hasStep {
+				high = f.max
+			}
+		}
+		if err != nil {
+			return 0, fmt.Errorf("invalid value '%s' in %s field", part, f.name)
+		}
+		if low < f.min || high > f.max || low > high {
+			return 0, fmt.Errorf(
+				"value '%s' out of range [%d, %d] in %s field", part, f.min, f.max, f.name,
+			)
+		}
+		for value := low; value <= high; value += step {
+			bits |= 1 << uint(value)
+		}
+	}
+	return bits, nil
+}
+
+// Return the first time the schedule fires after the provided time, or the zero time if it never
+// fires.
+func (s *CronSchedule) Next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(cronSearchLimit)
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// Check whether the schedule fires on the day of the provided time. If both the days of the month
+// and the days of the week are restricted, days matching either fire, as in standard cron.
+func (s *CronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that invalid cron expressions are rejected.
+func TestParseCronScheduleInvalid(t *testing.T) {
+	testCases := []struct {
+		spec string
+		err  string
+	}{
+		{"0 2 * *", "expected 5 fields"},
+		{"60 * * * *", "value '60' out of range [0, 59] in minute field"},
+		{"0 5-1 * * *", "value '5-1' out of range [0, 23] in hour field"},
+		{"*/0 * * * *", "invalid step '0' in minute field"},
+		{"0 0 * JAN *", "invalid value 'JAN' in month field"},
+		{"0 0 30 2 *", "it never fires"},
+		{"@often", "expected 5 fields"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.spec, func(t *testing.T) {
+			_, err := ParseCronSchedule(tc.spec)
+			assert.ErrorContains(t, err, tc.err)
+		})
+	}
+}
+
+// Test that schedules fire at the next matching minute.
+func TestCronScheduleNext(t *testing.T) {
+	// A Wednesday
+	now := time.Date(2024, 5, 15, 10, 20, 30, 0, time.UTC)
+
+	testCases := []struct {
+		spec     string
+		expected time.Time
+	}{
+		{"* * * * *", time.Date(2024, 5, 15, 10, 21, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 5, 15, 10, 30, 0, 0, time.UTC)},
+		{"0 2 * * *", time.Date(2024, 5, 16, 2, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 5, 15, 11, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)},
+		{"30 9 * * 1-5", time.Date(2024, 5, 16, 9, 30, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, 5, 19, 0, 0, 0, 0, time.UTC)},
+		{"5/20 10 * * *", time.Date(2024, 5, 15, 10, 25, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		// Days matching either the day of the month or the day of the week fire
+		{"0 0 1 * 5", time.Date(2024, 5, 17, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.spec, func(t *testing.T) {
+			schedule, err := ParseCronSchedule(tc.spec)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expected, schedule.Next(now))
+		})
+	}
+}
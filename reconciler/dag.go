@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Key of the recipe data holding the results of the upstream recipes.
+const upstreamDataKey = "upstream"
+
+// Validate the dependencies between recipes, rejecting dependencies on unknown recipes and cycles.
+func validateRecipeDependencies(recipes map[string]RecipeConfig) error {
+	for recipeName, recipeConfig := range recipes {
+		for _, dependency := range recipeConfig.DependsOn {
+			if _, ok := recipes[dependency]; !ok {
+				return fmt.Errorf(
+					"Recipe '%s' depends on unknown recipe '%s'", recipeName, dependency,
+				)
+			}
+		}
+	}
+	_, err := topologicalOrder(recipes)
+	return err
+}
+
+// Sort recipes so that every recipe comes after the recipes it depends on. Recipes at the same
+// depth are sorted by name, so that the order is deterministic. Dependencies on recipes missing
+// from the map are ignored.
+func topologicalOrder(recipes map[string]RecipeConfig) ([]string, error) {
+	inDegree := make(map[string]int, len(recipes))
+	dependents := make(map[string][]string)
+	for recipeName, recipeConfig := range recipes {
+		inDegree[recipeName] += 0
+		for _, dependency := range recipeConfig.DependsOn {
+			if _, ok := recipes[dependency]; !ok {
+				continue
+			}
+			inDegree[recipeName]++
+			dependents[dependency] = append(dependents[dependency], recipeName)
+		}
+	}
+
+	var ready []string
+	for recipeName, degree := range inDegree {
+		if degree == 0 {
+			ready = append(ready, recipeName)
+		}
+	}
+
+	order := make([]string, 0, len(recipes))
+	for len(ready) > 0 {
+		sort.Strings(ready)
+		var next []string
+		for _, recipeName := range ready {
+			order = append(order, recipeName)
+			for _, dependent := range dependents[recipeName] {
+				inDegree[dependent]--
+				if inDegree[dependent] == 0 {
+					next = append(next, dependent)
+				}
+			}
+		}
+		ready = next
+	}
+
+	if len(order) < len(recipes) {
+		var cycle []string
+		for recipeName, degree := range inDegree {
+			if degree > 0 {
+				cycle = append(cycle, recipeName)
+			}
+		}
+		sort.Strings(cycle)
+		return nil, fmt.Errorf(
+			"Recipe dependencies contain a cycle involving: %s", strings.Join(cycle, ", "),
+		)
+	}
+	return order, nil
+}
+
+// Return the names of the reconciler recipes, in topological order.
+func (r *Reconciler) recipeOrder() []string {
+	recipeConfigs := make(map[string]RecipeConfig, len(r.recipes))
+	for recipeName, recipe := range r.recipes {
+		recipeConfigs[recipeName] = RecipeConfig{}
+		if recipe.Config != nil {
+			recipeConfigs[recipeName] = *recipe.Config
+		}
+	}
+	order, err := topologicalOrder(recipeConfigs)
+	if err != nil {
+		// Cycles are rejected when the catalog is loaded
+		logger.Error("Failed to sort recipes", zap.Error(err))
+		for recipeName := range recipeConfigs {
+			order = append(order, recipeName)
+		}
+		sort.Strings(order)
+	}
+	return order
+}
+
+// Hold back a recipe until the recipes it depends on have completed.
+func (r *Reconciler) deferRecipe(recipeName string, data map[string]interface{}) {
+	r.waiting[recipeName] = data
+	incidentRegistry.RecipeWaiting(r.uuid, recipeName, r.recipes[recipeName].Config.DependsOn)
+}
+
+// Launch the waiting recipes whose dependencies have completed successfully, passing the results
+// of the upstream recipes in their data. Recipes with a dependency that failed, timed out or was
+// not scheduled are skipped.
+func (r *Reconciler) launchReadyRecipes(completed map[string]bool) {
+	for progress := true; progress; {
+		progress = false
+
+		waiting := make([]string, 0, len(r.waiting))
+		for recipeName := range r.waiting {
+			waiting = append(waiting, recipeName)
+		}
+		sort.Strings(waiting)
+
+		for _, recipeName := range waiting {
+			recipe := r.recipes[recipeName]
+			ready, blocker := r.dependenciesReady(recipe.Config.DependsOn, completed)
+			if blocker != "" {
+				logger.Warn(
+					"Skipping recipe, dependency did not complete successfully",
+					zap.String("recipe", recipeName),
+					zap.String("dependency", blocker),
+				)
+				delete(r.waiting, recipeName)
+				r.finished[recipeName] = true
+				incidentRegistry.RecipeJobFinished(
+					r.uuid, recipeName, RecipeStateSkipped,
+					fmt.Sprintf("Dependency '%s' did not complete successfully", blocker),
+				)
+				progress = true
+				continue
+			}
+			if !ready {
+				continue
+			}
+
+			data := r.upstreamData(r.waiting[recipeName], recipe.Config.DependsOn)
+			delete(r.waiting, recipeName)
+			progress = true
+
+			if recipe.Config.Peer != "" {
+				r.forwardRecipe(recipeName, recipe, data)
+				continue
+			}
+			data, ok := r.recipeParamsData(recipeName, recipe, data)
+			if !ok {
+				continue
+			}
+			cm, err := r.createConfigMap(&data, r.recipeTarget(recipeName))
+			if err != nil {
+				logger.Error("Failed to create ConfigMap", zap.Error(err))
+				r.finished[recipeName] = true
+				incidentRegistry.RecipeFailed(r.uuid, recipeName, err)
+				continue
+			}
+			r.launchRecipe(recipeName, recipe, cm.Name)
+		}
+	}
+}
+
+// Check whether the provided dependencies have completed successfully. If a dependency cannot
+// complete successfully anymore, it is returned as the blocker.
+func (r *Reconciler) dependenciesReady(
+	dependencies []string, completed map[string]bool,
+) (bool, string) {
+	ready := true
+	for _, dependency := range dependencies {
+		recipe, ok := r.recipes[dependency]
+		switch {
+		case !ok:
+			return false, dependency
+		case completed[dependency]:
+			if !recipe.Execution.Succeeded() {
+				return false, dependency
+			}
+		case r.finished[dependency]:
+			return false, dependency
+		default:
+			ready = false
+		}
+	}
+	return ready, ""
+}
+
+// Copy the recipe data, adding the results of the upstream recipes.
+func (r *Reconciler) upstreamData(
+	data map[string]interface{}, dependencies []string,
+) map[string]interface{} {
+	upstream := make(map[string]interface{}, len(dependencies))
+	for _, dependency := range dependencies {
+		execution := r.recipes[dependency].Execution
+		upstream[dependency] = map[string]interface{}{
+			"status":  execution.Status,
+			"results": execution.Results,
+		}
+	}
+
+	dataCopy := make(map[string]interface{}, len(data)+1)
+	for k, v := range data {
+		dataCopy[k] = v
+	}
+	dataCopy[upstreamDataKey] = upstream
+	return dataCopy
+}
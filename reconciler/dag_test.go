@@ -0,0 +1,141 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that recipes are sorted after their dependencies and that cycles are rejected.
+func TestTopologicalOrder(t *testing.T) {
+	tests := []struct {
+		name     string
+		recipes  map[string]RecipeConfig
+		expected []string
+		err      bool
+	}{
+		{
+			name: "Independent",
+			recipes: map[string]RecipeConfig{
+				"b": {},
+				"a": {},
+			},
+			expected: []string{"a", "b"},
+		},
+		{
+			name: "Chain",
+			recipes: map[string]RecipeConfig{
+				"remediate": {DependsOn: []string{"diagnose"}},
+				"diagnose":  {DependsOn: []string{"collect"}},
+				"collect":   {},
+			},
+			expected: []string{"collect", "diagnose", "remediate"},
+		},
+		{
+			name: "Diamond",
+			recipes: map[string]RecipeConfig{
+				"d": {DependsOn: []string{"b", "c"}},
+				"c": {DependsOn: []string{"a"}},
+				"b": {DependsOn: []string{"a"}},
+				"a": {},
+			},
+			expected: []string{"a", "b", "c", "d"},
+		},
+		{
+			name: "Cycle",
+			recipes: map[string]RecipeConfig{
+				"a": {DependsOn: []string{"c"}},
+				"b": {DependsOn: []string{"a"}},
+				"c": {DependsOn: []string{"b"}},
+				"d": {},
+			},
+			err: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order, err := topologicalOrder(tt.recipes)
+			if tt.err {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expected, order)
+		})
+	}
+}
+
+// Test that dependencies on unknown recipes are rejected.
+func TestValidateRecipeDependencies(t *testing.T) {
+	assert.Nil(t, validateRecipeDependencies(map[string]RecipeConfig{
+		"a": {},
+		"b": {DependsOn: []string{"a"}},
+	}))
+	assert.NotNil(t, validateRecipeDependencies(map[string]RecipeConfig{
+		"b": {DependsOn: []string{"a"}},
+	}))
+	assert.NotNil(t, validateRecipeDependencies(map[string]RecipeConfig{
+		"a": {DependsOn: []string{"a"}},
+	}))
+}
+
+// Test that recipes are skipped when their dependencies cannot complete successfully.
+func TestLaunchReadyRecipesSkipped(t *testing.T) {
+	r := &Reconciler{
+		uuid: "dag-incident",
+		recipes: map[string]Recipe{
+			"diagnose":  {Config: &RecipeConfig{}},
+			"remediate": {Config: &RecipeConfig{DependsOn: []string{"diagnose"}}},
+			"report":    {Config: &RecipeConfig{DependsOn: []string{"remediate"}}},
+			"orphan":    {Config: &RecipeConfig{DependsOn: []string{"disabled"}}},
+		},
+		finished: make(map[string]bool),
+		waiting:  make(map[string]map[string]interface{}),
+	}
+	incidentRegistry.Register(r.uuid, Alert)
+	for _, recipeName := range []string{"remediate", "report", "orphan"} {
+		r.deferRecipe(recipeName, map[string]interface{}{"uuid": r.uuid})
+	}
+	completed := make(map[string]bool)
+
+	// Dependencies on recipes that were not scheduled are never satisfied
+	r.launchReadyRecipes(completed)
+	assert.True(t, r.finished["orphan"])
+	assert.Equal(t, 2, len(r.waiting))
+
+	// Failures cascade to every downstream recipe
+	recipe, err := r.parseRecipeResults(`{"name": "diagnose", "status": "failed"}`)
+	assert.Nil(t, err)
+	r.recipes["diagnose"] = recipe
+	completed["diagnose"] = true
+	r.launchReadyRecipes(completed)
+	assert.Empty(t, r.waiting)
+	assert.True(t, r.finished["remediate"])
+	assert.True(t, r.finished["report"])
+
+	incident, ok := incidentRegistry.Get(r.uuid)
+	assert.True(t, ok)
+	assert.Equal(t, RecipeStateSkipped, incident.Recipes["report"].State)
+	assert.Equal(t, []string{"remediate"}, incident.Recipes["report"].DependsOn)
+}
+
+// Test that the results of the upstream recipes are passed to downstream recipes.
+func TestUpstreamData(t *testing.T) {
+	r := &Reconciler{recipes: make(map[string]Recipe)}
+	recipe, err := r.parseRecipeResults(
+		`{"name": "diagnose", "status": "successful", "results": {"analysis": "OOMKilled"}}`,
+	)
+	assert.Nil(t, err)
+	r.recipes["diagnose"] = recipe
+
+	data := map[string]interface{}{"uuid": "dag-incident"}
+	upstreamData := r.upstreamData(data, []string{"diagnose"})
+	assert.NotContains(t, data, upstreamDataKey)
+	assert.Equal(t, "dag-incident", upstreamData["uuid"])
+
+	upstream := upstreamData[upstreamDataKey].(map[string]interface{})
+	diagnose := upstream["diagnose"].(map[string]interface{})
+	assert.Equal(t, "successful", diagnose["status"])
+	assert.Equal(t, recipe.Execution.Results, diagnose["results"])
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// Component label of the debugging Pods and of the ConfigMaps holding their context
+	debugSessionComponent = "debug-session"
+	// Annotations of the debugging Pods
+	debugExpiresAtAnnotation = "euphrosyne/expires-at"
+	debugUserAnnotation      = "euphrosyne/user"
+	// Directory the execution context is mounted at in the debugging Pods
+	debugContextMountPath = "/euphrosyne"
+	debugContextFileName  = "incident.json"
+	// Interval between the sweeps of the expired debugging sessions
+	debugSessionSweepInterval = time.Minute
+)
+
+// Reasons the debugging sessions end for.
+const (
+	DebugSessionDeleted = "deleted"
+	DebugSessionExpired = "expired"
+)
+
+var errDebugSessionNotFound = errors.New("Debugging session not found")
+
+// DebugSession is an interactive debugging Pod spawned from an execution, which is deleted once
+// its TTL expires.
+type DebugSession struct {
+	Name      string    `json:"name"`
+	Namespace string    `json:"namespace"`
+	Incident  string    `json:"incident"`
+	User      string    `json:"user,omitempty"`
+	Phase     string    `json:"phase,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	// Command opening a shell in the debugging Pod
+	Command string `json:"command"`
+}
+
+// DebugSessions spawns the debugging Pods of executions in the recipe namespace, with the context
+// of their execution mounted, and deletes them once they expire. The Pods are the source of truth
+// for the sessions, so that they are expired by any leader.
+type DebugSessions struct {
+	client         kubernetes.Interface
+	namespace      string
+	image          string
+	serviceAccount string
+	ttl            time.Duration
+	maxTTL         time.Duration
+}
+
+// Debugging sessions of executions, nil unless enabled.
+var debugSessions *DebugSessions
+
+// Initialise the debugging sessions from the Reconciler configuration.
+func NewDebugSessions(client kubernetes.Interface, config *Config) *DebugSessions {
+	return &DebugSessions{
+		client:         client,
+		namespace:      config.RecipeNamespace,
+		image:          config.DebugImage,
+		serviceAccount: config.DebugServiceAccount,
+		ttl:            config.DebugSessionTTL,
+		maxTTL:         config.DebugSessionMaxTTL,
+	}
+}
+
+// Delete the expired debugging sessions on the provided interval, until the context is cancelled.
+func (ds *DebugSessions) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := ds.Sweep(ctx, time.Now()); err != nil {
+				logger.Warn("Failed to sweep expired debugging sessions", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Spawn a debugging Pod for an incident, holding the context of its execution, which expires
+// after the TTL. The ConfigMap holding the context is owned by the Pod, so that it is deleted
+// along with it.
+func (ds *DebugSessions) Create(
+	ctx context.Context, incident *Incident, user string, ttl time.Duration, now time.Time,
+) (*DebugSession, error) {
+	data, err := json.MarshalIndent(incident, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	name := "euphrosyne-debug-" + utilrand.String(8)
+	pod, err := ds.client.CoreV1().Pods(ds.namespace).Create(
+		ctx, ds.buildPod(name, incident.UUID, user, ttl, now), metav1.CreateOptions{},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create debugging Pod: %w", err)
+	}
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: ds.namespace,
+			Labels:    debugSessionLabels(incident.UUID),
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: corev1.SchemeGroupVersion.String(),
+				Kind:       "Pod",
+				Name:       pod.Name,
+				UID:        pod.UID,
+			}},
+		},
+		Data: map[string]string{debugContextFileName: string(data)},
+	}
+	_, err = ds.client.CoreV1().ConfigMaps(ds.namespace).Create(ctx, cm, metav1.CreateOptions{})
+	if err != nil {
+		// The Pod would wait for its context forever
+		_ = ds.client.CoreV1().Pods(ds.namespace).Delete(ctx, pod.Name, metav1.DeleteOptions{})
+		return nil, fmt.Errorf("Failed to create the ConfigMap of the debugging Pod: %w", err)
+	}
+
+	session := debugSessionFromPod(pod)
+	auditLog.Record(AuditDebugSessionCreated, incident.UUID, map[string]interface{}{
+		"pod":       session.Name,
+		"namespace": session.Namespace,
+		"user":      user,
+		"expiresAt": session.ExpiresAt.Format(time.RFC3339),
+	})
+	debugSessionEvents.WithLabelValues("created").Inc()
+	return &session, nil
+}
+
+// Build the Pod of a debugging session. Kubernetes terminates the Pod once its TTL expires, even
+// if the reconciler is not around to delete it.
+func (ds *DebugSessions) buildPod(
+	name string, uuid string, user string, ttl time.Duration, now time.Time,
+) *corev1.Pod {
+	seconds := int64(ttl.Seconds())
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: ds.namespace,
+			Labels:    debugSessionLabels(uuid),
+			Annotations: map[string]string{
+				debugExpiresAtAnnotation: now.Add(ttl).UTC().Format(time.RFC3339),
+				debugUserAnnotation:      user,
+			},
+		},
+		Spec: corev1.PodSpec{
+			ServiceAccountName:    ds.serviceAccount,
+			RestartPolicy:         corev1.RestartPolicyNever,
+			ActiveDeadlineSeconds: &seconds,
+			Volumes: []corev1.Volume{{
+				Name: "execution-context",
+				VolumeSource: corev1.VolumeSource{
+					ConfigMap: &corev1.ConfigMapVolumeSource{
+						LocalObjectReference: corev1.LocalObjectReference{Name: name},
+					},
+				},
+			}},
+			Containers: []corev1.Container{{
+				Name:       "debug",
+				Image:      ds.image,
+				Command:    []string{"sleep", strconv.FormatInt(seconds, 10)},
+				Stdin:      true,
+				TTY:        true,
+				WorkingDir: debugContextMountPath,
+				VolumeMounts: []corev1.VolumeMount{{
+					Name:      "execution-context",
+					MountPath: debugContextMountPath,
+					ReadOnly:  true,
+				}},
+				Env: []corev1.EnvVar{
+					{Name: "INCIDENT_UUID", Value: uuid},
+					{Name: "RECIPE_NAMESPACE", Value: ds.namespace},
+				},
+			}},
+		},
+	}
+}
+
+// List the debugging sessions of an incident, or of every incident if none is provided.
+func (ds *DebugSessions) List(ctx context.Context, uuid string) ([]DebugSession, error) {
+	selector := fmt.Sprintf("app=euphrosyne,component=%s", debugSessionComponent)
+	if uuid != "" {
+		selector += ",uuid=" + uuid
+	}
+	pods, err := ds.client.CoreV1().Pods(ds.namespace).List(
+		ctx, metav1.ListOptions{LabelSelector: selector},
+	)
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]DebugSession, 0, len(pods.Items))
+	for _, pod := range pods.Items {
+		sessions = append(sessions, debugSessionFromPod(&pod))
+	}
+	return sessions, nil
+}
+
+// Delete a debugging session of an incident, along with the ConfigMap holding its context.
+func (ds *DebugSessions) Delete(
+	ctx context.Context, uuid string, name string, reason string,
+) (*DebugSession, error) {
+	pod, err := ds.client.CoreV1().Pods(ds.namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) || (err == nil && !isDebugSessionOf(pod, uuid)) {
+		return nil, errDebugSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	propagation := metav1.DeletePropagationBackground
+	err = ds.client.CoreV1().Pods(ds.namespace).Delete(
+		ctx, name, metav1.DeleteOptions{PropagationPolicy: &propagation},
+	)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("Failed to delete debugging Pod: %w", err)
+	}
+
+	session := debugSessionFromPod(pod)
+	auditLog.Record(AuditDebugSessionDeleted, session.Incident, map[string]interface{}{
+		"pod":       session.Name,
+		"namespace": session.Namespace,
+		"user":      session.User,
+		"reason":    reason,
+	})
+	debugSessionEvents.WithLabelValues(reason).Inc()
+	return &session, nil
+}
+
+// Delete the debugging sessions whose TTL expired.
+func (ds *DebugSessions) Sweep(ctx context.Context, now time.Time) error {
+	sessions, err := ds.List(ctx, "")
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, session := range sessions {
+		if now.Before(session.ExpiresAt) {
+			continue
+		}
+		_, err := ds.Delete(ctx, session.Incident, session.Name, DebugSessionExpired)
+		if err != nil && !errors.Is(err, errDebugSessionNotFound) {
+			errs = append(errs, err)
+			continue
+		}
+		logger.Info(
+			"Deleted expired debugging session",
+			zap.String("uuid", session.Incident),
+			zap.String("pod", session.Name),
+		)
+	}
+	return errors.Join(errs...)
+}
+
+// Return the labels of the resources of the debugging sessions of an incident.
+func debugSessionLabels(uuid string) map[string]string {
+	return map[string]string{"app": "euphrosyne", "component": debugSessionComponent, "uuid": uuid}
+}
+
+// Check whether a Pod is a debugging session of an incident.
+func isDebugSessionOf(pod *corev1.Pod, uuid string) bool {
+	return pod.Labels["component"] == debugSessionComponent && pod.Labels["uuid"] == uuid
+}
+
+// Describe the debugging session run by a Pod. Pods without a valid expiry are considered expired.
+func debugSessionFromPod(pod *corev1.Pod) DebugSession {
+	expiresAt, _ := time.Parse(time.RFC3339, pod.Annotations[debugExpiresAtAnnotation])
+	return DebugSession{
+		Name:      pod.Name,
+		Namespace: pod.Namespace,
+		Incident:  pod.Labels["uuid"],
+		User:      pod.Annotations[debugUserAnnotation],
+		Phase:     string(pod.Status.Phase),
+		CreatedAt: pod.CreationTimestamp.UTC(),
+		ExpiresAt: expiresAt,
+		Command:   fmt.Sprintf("kubectl exec -it -n %s %s -- /bin/sh", pod.Namespace, pod.Name),
+	}
+}
+
+// Handle request to spawn a debugging session for an incident. The session is attributed to the
+// identity the request was authenticated as, rather than to a user the request claims.
+func handleCreateDebugSessionRequest(c *gin.Context) {
+	var request struct {
+		// TTL (s) of the session, the default TTL if unset
+		TTL int `json:"ttl"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			logger.Error("Failed to parse JSON", zap.Error(err))
+			respondProblem(
+				c, http.StatusBadRequest, InvalidRequestProblem,
+				"Invalid JSON for debugging session",
+			)
+			return
+		}
+	}
+	ttl := debugSessions.ttl
+	if request.TTL != 0 {
+		ttl = time.Duration(request.TTL) * time.Second
+	}
+	if ttl <= 0 || ttl > debugSessions.maxTTL {
+		respondProblem(
+			c, http.StatusBadRequest, InvalidRequestProblem,
+			fmt.Sprintf(
+				"The TTL must be between 1 and %d seconds", int(debugSessions.maxTTL.Seconds()),
+			),
+		)
+		return
+	}
+
+	incident, ok := incidentRegistry.Get(c.Param("uuid"))
+	if !ok {
+		respondProblem(c, http.StatusNotFound, IncidentNotFoundProblem, "")
+		return
+	}
+	session, err := debugSessions.Create(
+		c.Request.Context(), incident, requestIdentity(c), ttl, time.Now(),
+	)
+	if err != nil {
+		logger.Error(
+			"Failed to create debugging session", zap.String("uuid", incident.UUID), zap.Error(err),
+		)
+		debugSessionEvents.WithLabelValues("failed").Inc()
+		respondProblem(c, http.StatusInternalServerError, InternalErrorProblem, err.Error())
+		return
+	}
+	c.JSON(http.StatusCreated, session)
+}
+
+// Handle request to list the debugging sessions of an incident.
+func handleListDebugSessionsRequest(c *gin.Context) {
+	sessions, err := debugSessions.List(c.Request.Context(), c.Param("uuid"))
+	if err != nil {
+		logger.Error("Failed to list debugging sessions", zap.Error(err))
+		respondProblem(c, http.StatusInternalServerError, InternalErrorProblem, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+}
+
+// Handle request to end a debugging session of an incident before it expires.
+func handleDeleteDebugSessionRequest(c *gin.Context) {
+	session, err := debugSessions.Delete(
+		c.Request.Context(), c.Param("uuid"), c.Param("name"), DebugSessionDeleted,
+	)
+	if errors.Is(err, errDebugSessionNotFound) {
+		respondProblem(c, http.StatusNotFound, DebugSessionNotFoundProblem, "")
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to delete debugging session", zap.Error(err))
+		respondProblem(c, http.StatusInternalServerError, InternalErrorProblem, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, session)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// Build debugging sessions spawning their Pods with a fake client.
+func newFakeDebugSessions() (*DebugSessions, *fake.Clientset) {
+	client := fake.NewSimpleClientset()
+	return NewDebugSessions(client, &Config{
+		RecipeNamespace:    "recipes",
+		DebugImage:         "phoevos/euphrosyne-debug:latest",
+		DebugSessionTTL:    time.Hour,
+		DebugSessionMaxTTL: 4 * time.Hour,
+	}), client
+}
+
+// Test that debugging Pods are spawned with the context of their execution and then deleted.
+func TestDebugSessions(t *testing.T) {
+	ds, client := newFakeDebugSessions()
+	ctx := context.Background()
+	now := time.Now()
+	incident := &Incident{UUID: "debug-incident", State: IncidentStateCompleted}
+
+	session, err := ds.Create(ctx, incident, "alice", 30*time.Minute, now)
+	assert.Nil(t, err)
+	assert.Equal(t, "recipes", session.Namespace)
+	assert.Equal(t, "debug-incident", session.Incident)
+	assert.Equal(t, "alice", session.User)
+	assert.Equal(t, now.Add(30*time.Minute).UTC().Truncate(time.Second), session.ExpiresAt)
+	assert.Equal(t, "kubectl exec -it -n recipes "+session.Name+" -- /bin/sh", session.Command)
+
+	pod, err := client.CoreV1().Pods("recipes").Get(ctx, session.Name, metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1800), *pod.Spec.ActiveDeadlineSeconds)
+	assert.Equal(t, "phoevos/euphrosyne-debug:latest", pod.Spec.Containers[0].Image)
+	assert.Equal(t, []string{"sleep", "1800"}, pod.Spec.Containers[0].Command)
+
+	// The context of the execution is owned by the Pod
+	cm, err := client.CoreV1().ConfigMaps("recipes").Get(ctx, session.Name, metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, session.Name, cm.OwnerReferences[0].Name)
+	var mounted Incident
+	assert.Nil(t, json.Unmarshal([]byte(cm.Data[debugContextFileName]), &mounted))
+	assert.Equal(t, "debug-incident", mounted.UUID)
+
+	sessions, err := ds.List(ctx, "debug-incident")
+	assert.Nil(t, err)
+	assert.Len(t, sessions, 1)
+	sessions, err = ds.List(ctx, "other-incident")
+	assert.Nil(t, err)
+	assert.Empty(t, sessions)
+
+	// Sessions can only be deleted through their own incident
+	_, err = ds.Delete(ctx, "other-incident", session.Name, DebugSessionDeleted)
+	assert.ErrorIs(t, err, errDebugSessionNotFound)
+	_, err = ds.Delete(ctx, "debug-incident", session.Name, DebugSessionDeleted)
+	assert.Nil(t, err)
+	_, err = ds.Delete(ctx, "debug-incident", session.Name, DebugSessionDeleted)
+	assert.ErrorIs(t, err, errDebugSessionNotFound)
+}
+
+// Test that only the debugging sessions whose TTL expired are swept.
+func TestDebugSessionsSweep(t *testing.T) {
+	ds, _ := newFakeDebugSessions()
+	ctx := context.Background()
+	now := time.Now()
+	incident := &Incident{UUID: "sweep-incident"}
+
+	expired, err := ds.Create(ctx, incident, "alice", time.Minute, now.Add(-time.Hour))
+	assert.Nil(t, err)
+	active, err := ds.Create(ctx, incident, "bob", time.Hour, now)
+	assert.Nil(t, err)
+
+	assert.Nil(t, ds.Sweep(ctx, now))
+	sessions, err := ds.List(ctx, "sweep-incident")
+	assert.Nil(t, err)
+	assert.Len(t, sessions, 1)
+	assert.Equal(t, active.Name, sessions[0].Name)
+	assert.NotEqual(t, expired.Name, sessions[0].Name)
+}
+
+// Test that debugging sessions are requested through the API within the maximum TTL.
+func TestDebugSessionRequest(t *testing.T) {
+	sessions := debugSessions
+	defer func() { debugSessions = sessions }()
+	debugSessions, _ = newFakeDebugSessions()
+	incidentRegistry.Register("debug-request-incident", Alert)
+
+	router := gin.New()
+	router.POST("/incidents/:uuid/debug", handleCreateDebugSessionRequest)
+	router.GET("/incidents/:uuid/debug", handleListDebugSessionsRequest)
+	router.DELETE("/incidents/:uuid/debug/:name", handleDeleteDebugSessionRequest)
+
+	tests := []struct {
+		name   string
+		uuid   string
+		body   string
+		status int
+		ttl    time.Duration
+	}{
+		{
+			name:   "DefaultTTL",
+			uuid:   "debug-request-incident",
+			status: http.StatusCreated,
+			ttl:    time.Hour,
+		},
+		{
+			name:   "TTL",
+			uuid:   "debug-request-incident",
+			body:   `{"user": "alice", "ttl": 600}`,
+			status: http.StatusCreated,
+			ttl:    10 * time.Minute,
+		},
+		{
+			name:   "TTLTooLong",
+			uuid:   "debug-request-incident",
+			body:   `{"ttl": 86400}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "NegativeTTL",
+			uuid:   "debug-request-incident",
+			body:   `{"ttl": -1}`,
+			status: http.StatusBadRequest,
+		},
+		{name: "NotFound", uuid: "unknown-incident", status: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(
+				http.MethodPost, "/incidents/"+tt.uuid+"/debug", strings.NewReader(tt.body),
+			))
+			assert.Equal(t, tt.status, recorder.Code)
+			if tt.status != http.StatusCreated {
+				return
+			}
+			var session DebugSession
+			assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &session))
+			assert.WithinDuration(t, time.Now().Add(tt.ttl), session.ExpiresAt, 5*time.Second)
+			// The user claimed by the request is ignored
+			assert.Equal(t, anonymousIdentity, session.User)
+		})
+	}
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(
+		http.MethodGet, "/incidents/debug-request-incident/debug", nil,
+	))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	var list struct {
+		Sessions []DebugSession `json:"sessions"`
+	}
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &list))
+	assert.Len(t, list.Sessions, 2)
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(
+		http.MethodDelete, "/incidents/debug-request-incident/debug/"+list.Sessions[0].Name, nil,
+	))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(
+		http.MethodDelete, "/incidents/debug-request-incident/debug/unknown", nil,
+	))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+var dedups = NewCooldownTracker()
+
+// Compute the fingerprint of an alert from the configured fields, or from its labels if no fields
+// are configured. Missing fields are fingerprinted as empty.
+func alertFingerprint(alertData map[string]interface{}, fields string) string {
+	values := make(map[string]interface{})
+	if fields == "" {
+		for k, v := range alertLabels(alertData) {
+			values[k] = v
+		}
+	}
+	for _, field := range strings.Split(fields, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		value, _ := lookupField(alertData, field)
+		values[field] = value
+	}
+
+	// Maps are encoded with sorted keys, so the fingerprint is stable
+	data, _ := json.Marshal(values)
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+// Check whether an alert duplicates one received within the dedup window. Duplicates are attached
+// to the incident of the first alert, whose UUID is returned.
+func checkDedup(alertData map[string]interface{}, config *Config) (string, bool) {
+	if config.DedupWindow <= 0 {
+		return "", false
+	}
+
+	fingerprint := alertFingerprint(alertData, config.DedupFields)
+	activeUUID, duplicate := dedups.Check(
+		fingerprint, config.DedupWindow, alertData["uuid"].(string),
+	)
+	if !duplicate {
+		return "", false
+	}
+
+	logger.Info(
+		"Duplicate alert attached to existing incident",
+		zap.String("fingerprint", fingerprint),
+		zap.String("incident", activeUUID),
+	)
+	alertsDeduplicated.Inc()
+	incidentRegistry.RecordOccurrence(activeUUID)
+	return activeUUID, true
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that alerts are fingerprinted on the configured fields, or on their labels by default.
+func TestAlertFingerprint(t *testing.T) {
+	alert := func(pod string, startsAt string) map[string]interface{} {
+		return map[string]interface{}{
+			"commonLabels": map[string]interface{}{"alertname": "KubePodCrashLooping", "pod": pod},
+			"startsAt":     startsAt,
+		}
+	}
+
+	// Alerts with the same labels are duplicates, regardless of the other fields
+	assert.Equal(
+		t,
+		alertFingerprint(alert("web-1", "10:00"), ""),
+		alertFingerprint(alert("web-1", "10:05"), ""),
+	)
+	assert.NotEqual(
+		t,
+		alertFingerprint(alert("web-1", "10:00"), ""),
+		alertFingerprint(alert("web-2", "10:00"), ""),
+	)
+
+	// Only the configured fields are fingerprinted
+	fields := "commonLabels.alertname"
+	assert.Equal(
+		t,
+		alertFingerprint(alert("web-1", "10:00"), fields),
+		alertFingerprint(alert("web-2", "10:05"), fields),
+	)
+	fields = "commonLabels.alertname, startsAt"
+	assert.NotEqual(
+		t,
+		alertFingerprint(alert("web-1", "10:00"), fields),
+		alertFingerprint(alert("web-1", "10:05"), fields),
+	)
+}
+
+// Test that duplicate alerts within the window are attached to the existing incident.
+func TestCheckDedup(t *testing.T) {
+	config := &Config{DedupWindow: time.Minute, DedupFields: "alertname"}
+	dedups = NewCooldownTracker()
+
+	first := map[string]interface{}{"uuid": "dedup-1", "alertname": "HighErrorRate"}
+	_, ok := checkDedup(first, config)
+	assert.False(t, ok)
+	incidentRegistry.Register("dedup-1", Alert)
+
+	for _, uuid := range []string{"dedup-2", "dedup-3"} {
+		duplicate := map[string]interface{}{"uuid": uuid, "alertname": "HighErrorRate"}
+		activeUUID, ok := checkDedup(duplicate, config)
+		assert.True(t, ok)
+		assert.Equal(t, "dedup-1", activeUUID)
+	}
+	incident, _ := incidentRegistry.Get("dedup-1")
+	assert.Equal(t, 3, incident.Occurrences)
+
+	// Released executions don't absorb later alerts
+	dedups.Release("dedup-1")
+	later := map[string]interface{}{"uuid": "dedup-4", "alertname": "HighErrorRate"}
+	_, ok = checkDedup(later, config)
+	assert.False(t, ok)
+
+	// Deduplication is disabled by default
+	_, ok = checkDedup(first, &Config{})
+	assert.False(t, ok)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// PlannedAction describes the resources an action recipe would create, if it was not a dry run.
+type PlannedAction struct {
+	Recipe    string            `json:"recipe"`
+	Peer      string            `json:"peer,omitempty"`
+	Cluster   string            `json:"cluster,omitempty"`
+	DependsOn []string          `json:"dependsOn,omitempty"`
+	ConfigMap *corev1.ConfigMap `json:"configMap,omitempty"`
+	Job       *batchv1.Job      `json:"job,omitempty"`
+}
+
+// Check whether an Actions request is a dry run, either globally or through its `dryRun` query
+// parameter or field.
+func isDryRun(c *gin.Context, data map[string]interface{}, config *Config) bool {
+	if config.DryRun {
+		return true
+	}
+	if dryRun, err := strconv.ParseBool(c.Query("dryRun")); err == nil && dryRun {
+		return true
+	}
+	dryRun, _ := data["dryRun"].(bool)
+	return dryRun
+}
+
+// Render the resources the action recipes of a request would create, without creating anything
+// in the cluster.
+func planActionRecipes(config *Config, data *map[string]interface{}) ([]PlannedAction, error) {
+	config = executionConfig(config, *data)
+	actions, err := parseActionData(data)
+	if err != nil {
+		return nil, err
+	}
+	recipes, _, err := executionRecipes(config, data, Actions)
+	if err != nil {
+		return nil, err
+	}
+
+	uuid, _ := (*data)["uuid"].(string)
+	plan := []PlannedAction{}
+	for _, action := range actions {
+		recipe, ok := recipes[action.Name]
+		if !ok {
+			continue
+		}
+		planned := PlannedAction{
+			Recipe:    action.Name,
+			Peer:      recipe.Config.Peer,
+			DependsOn: recipe.Config.DependsOn,
+		}
+		if recipe.Config.Peer == "" {
+			target := recipeTarget(recipe.Config, config)
+			planned.Cluster = target.Cluster
+			actionData := make(map[string]interface{})
+			for k, v := range action.Data {
+				actionData[k] = v
+			}
+			actionData["uuid"] = uuid
+			actionData, err = withRecipeParams(recipe, actionData)
+			if err != nil {
+				return nil, fmt.Errorf("Recipe '%s': %w", action.Name, err)
+			}
+			planned.ConfigMap, err = buildConfigMap(&actionData, uuid, target.Namespace)
+			if err != nil {
+				return nil, err
+			}
+			// The name of the ConfigMap is only generated once it is created
+			planned.Job = buildJob(
+				action.Name, recipe, uuid, planned.ConfigMap.GenerateName, config,
+			)
+		}
+		plan = append(plan, planned)
+	}
+	sort.Slice(plan, func(i, j int) bool { return plan[i].Recipe < plan[j].Recipe })
+
+	logger.Info(
+		"Planned action recipes for dry run",
+		zap.String("uuid", uuid),
+		zap.Any("recipes", plannedRecipeNames(plan)),
+	)
+	return plan, nil
+}
+
+// List the names of the recipes in a plan.
+func plannedRecipeNames(plan []PlannedAction) []string {
+	names := make([]string, 0, len(plan))
+	for _, planned := range plan {
+		names = append(names, planned.Recipe)
+	}
+	return names
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that dry runs of Actions requests return the planned Jobs without creating them.
+func TestDryRunActionsRequest(t *testing.T) {
+	catalogMutex.Lock()
+	previous := catalog
+	catalog = &RecipeCatalog{Actions: map[string]RecipeConfig{
+		"restart":  {Enabled: true, Image: "restart:latest", Entrypoint: "restart"},
+		"failover": {Enabled: true, Peer: "eu-west"},
+	}}
+	catalogMutex.Unlock()
+	defer func() {
+		catalogMutex.Lock()
+		catalog = previous
+		catalogMutex.Unlock()
+	}()
+
+	testCases := []struct {
+		name   string
+		config Config
+		query  string
+		dryRun interface{}
+	}{
+		{name: "Config", config: Config{DryRun: true}},
+		{name: "QueryParameter", query: "?dryRun=true"},
+		{name: "Field", dryRun: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := tc.config
+			config.RecipeNamespace = "recipes"
+			router := gin.New()
+			router.POST("/api/actions", func(c *gin.Context) { handleActionsRequest(c, &config) })
+
+			request := map[string]interface{}{
+				"uuid": "dry-run-1",
+				"actions": []interface{}{
+					map[string]interface{}{"name": "restart", "data": map[string]interface{}{}},
+					map[string]interface{}{"name": "failover", "data": map[string]interface{}{}},
+				},
+			}
+			if tc.dryRun != nil {
+				request["dryRun"] = tc.dryRun
+			}
+			body, _ := json.Marshal(request)
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(
+				http.MethodPost, "/api/actions"+tc.query, bytes.NewReader(body),
+			))
+			assert.Equal(t, http.StatusOK, recorder.Code)
+
+			var response struct {
+				DryRun  bool            `json:"dryRun"`
+				Actions []PlannedAction `json:"actions"`
+			}
+			assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+			assert.True(t, response.DryRun)
+			assert.Equal(t, 2, len(response.Actions))
+
+			failover := response.Actions[0]
+			assert.Equal(t, "failover", failover.Recipe)
+			assert.Equal(t, "eu-west", failover.Peer)
+			assert.Nil(t, failover.Job)
+
+			restart := response.Actions[1]
+			assert.Equal(t, "restart", restart.Recipe)
+			assert.Equal(t, "recipes", restart.Job.Namespace)
+			assert.Equal(t, "dry-run-1", restart.Job.Labels["uuid"])
+			container := restart.Job.Spec.Template.Spec.Containers[0]
+			assert.Equal(t, "restart:latest", container.Image)
+			assert.Contains(t, container.Command[2], "restart --data-file-path")
+			assert.Contains(t, restart.ConfigMap.Data[configMapFileName], `"uuid":"dry-run-1"`)
+		})
+	}
+}
@@ -0,0 +1,8 @@
+// Package e2e runs the Reconciler end-to-end against a kind cluster. It builds the Reconciler
+// image, deploys it along with Redis and a set of sample recipes, drives alerts through the
+// webhook and compares the outcome of each incident against golden files.
+//
+// Run with `go test -tags e2e ./e2e/...`, after installing kind, kubectl and docker. Set
+// E2E_KIND_CLUSTER to reuse an existing cluster, which is then left in place, and pass -update to
+// regenerate the golden files.
+package e2e
@@ -0,0 +1,268 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	defaultClusterName = "euphrosyne-e2e"
+	reconcilerImage    = "euphrosyne-reconciler:e2e"
+	webhookPort        = 18080
+	serverPort         = 18081
+	incidentTimeout    = 3 * time.Minute
+)
+
+var update = flag.Bool("update", false, "Update the golden files")
+
+// Provision the cluster and deploy the Reconciler before running the tests.
+func TestMain(m *testing.M) {
+	flag.Parse()
+
+	clusterName := os.Getenv("E2E_KIND_CLUSTER")
+	createCluster := clusterName == ""
+	if createCluster {
+		clusterName = defaultClusterName
+	}
+
+	portForward, err := setup(clusterName, createCluster)
+	code := 1
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to set up e2e environment: %s\n", err)
+	} else {
+		code = m.Run()
+	}
+
+	if portForward != nil {
+		_ = portForward.Process.Kill()
+	}
+	if createCluster {
+		_ = run("kind", "delete", "cluster", "--name", clusterName)
+	}
+	os.Exit(code)
+}
+
+// Create the kind cluster, build and load the Reconciler image and deploy all components.
+func setup(clusterName string, createCluster bool) (*exec.Cmd, error) {
+	if createCluster {
+		err := run("kind", "create", "cluster", "--name", clusterName, "--wait", "2m")
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := run("kubectl", "config", "use-context", "kind-"+clusterName); err != nil {
+		return nil, err
+	}
+
+	if err := run("docker", "build", "-t", reconcilerImage, ".."); err != nil {
+		return nil, err
+	}
+	err := run("kind", "load", "docker-image", reconcilerImage, "--name", clusterName)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, manifest := range []string{
+		"../manifests/sa.yaml",
+		"../manifests/role.yaml",
+		"../manifests/rolebinding.yaml",
+		"../manifests/service.yaml",
+		"../manifests/redis",
+		"testdata/manifests",
+	} {
+		if err := run("kubectl", "apply", "-f", manifest); err != nil {
+			return nil, err
+		}
+	}
+	for _, deployment := range []string{"euphrosyne-reconciler-redis", "euphrosyne-reconciler"} {
+		err := run(
+			"kubectl", "rollout", "status", "deployment/"+deployment, "--timeout", "3m",
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	portForward := exec.Command(
+		"kubectl", "port-forward", "service/euphrosyne-reconciler",
+		fmt.Sprintf("%d:80", webhookPort), fmt.Sprintf("%d:81", serverPort),
+	)
+	portForward.Stderr = os.Stderr
+	if err := portForward.Start(); err != nil {
+		return nil, err
+	}
+
+	// Wait for the port forwarding to be established
+	deadline := time.Now().Add(30 * time.Second)
+	for {
+		resp, err := http.Get(fmt.Sprintf("http://localhost:%d/incidents", serverPort))
+		if err == nil {
+			resp.Body.Close()
+			return portForward, nil
+		}
+		if time.Now().After(deadline) {
+			return portForward, err
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// Test that alerts trigger the expected recipes and outbound messages, and that the resources
+// created for each incident are cleaned up.
+func TestAlerts(t *testing.T) {
+	tests := []struct {
+		name  string
+		alert string
+	}{
+		{name: "HTTPErrors", alert: "http-errors.json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uuids, _ := postAlert(t, tt.alert)
+			assert.Equal(t, 1, len(uuids))
+			uuid := uuids[0]
+
+			incident := waitForIncident(t, uuid)
+			assertGolden(t, tt.name, summariseIncident(t, incident, uuid))
+
+			// Only the resources of recipes that completed are cleaned up
+			assert.Equal(t, "", kubectlNames(t, "configmaps", "uuid="+uuid))
+			assert.Equal(t, "", kubectlNames(t, "jobs", "uuid="+uuid+",recipe=echo"))
+			assert.Equal(t, "", kubectlNames(t, "jobs", "uuid="+uuid+",recipe=remediate"))
+		})
+	}
+}
+
+// Test that repeated alerts are suppressed during their cooldown.
+func TestCooldown(t *testing.T) {
+	uuids, suppressed := postAlert(t, "flapping.json")
+	assert.Equal(t, 1, len(uuids))
+	assert.Empty(t, suppressed)
+
+	repeated, suppressed := postAlert(t, "flapping.json")
+	assert.Empty(t, repeated)
+	assert.Equal(t, uuids, suppressed)
+
+	incident := waitForIncident(t, uuids[0])
+	assert.Equal(t, float64(1), incident["suppressed"])
+}
+
+// Post an alert to the webhook, returning the UUIDs of the created and suppressed incidents.
+func postAlert(t *testing.T, alert string) ([]string, []string) {
+	data, err := os.ReadFile(filepath.Join("testdata", "alerts", alert))
+	assert.Nil(t, err)
+
+	resp, err := http.Post(
+		fmt.Sprintf("http://localhost:%d/webhook", webhookPort),
+		"application/json", bytes.NewReader(data),
+	)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var response struct {
+		Incidents  []string `json:"incidents"`
+		Suppressed []string `json:"suppressed"`
+	}
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(&response))
+	return response.Incidents, response.Suppressed
+}
+
+// Wait for an incident to complete, including the cleanup of its resources.
+func waitForIncident(t *testing.T, uuid string) map[string]interface{} {
+	var incident map[string]interface{}
+	assert.Eventually(t, func() bool {
+		resp, err := http.Get(fmt.Sprintf("http://localhost:%d/incidents/%s", serverPort, uuid))
+		if err != nil {
+			return false
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return false
+		}
+		incident = nil
+		if err := json.NewDecoder(resp.Body).Decode(&incident); err != nil {
+			return false
+		}
+		cleanup, _ := incident["cleanup"].(map[string]interface{})
+		return incident["state"] == "completed" && cleanup["state"] != "pending"
+	}, incidentTimeout, 2*time.Second)
+	return incident
+}
+
+// Extract the deterministic parts of an incident, replacing its UUID with a placeholder.
+func summariseIncident(
+	t *testing.T, incident map[string]interface{}, uuid string,
+) map[string]interface{} {
+	recipes := make(map[string]interface{})
+	for name, value := range incident["recipes"].(map[string]interface{}) {
+		state := value.(map[string]interface{})
+		recipes[name] = map[string]interface{}{
+			"state":    state["state"],
+			"status":   state["status"],
+			"attempts": state["attempts"],
+		}
+	}
+	summary := map[string]interface{}{
+		"requestType": incident["requestType"],
+		"state":       incident["state"],
+		"recipes":     recipes,
+		"cleanup":     incident["cleanup"],
+		"messages":    incident["messages"],
+	}
+
+	data, err := json.Marshal(summary)
+	assert.Nil(t, err)
+	data = bytes.ReplaceAll(data, []byte(uuid), []byte("<uuid>"))
+	assert.Nil(t, json.Unmarshal(data, &summary))
+	return summary
+}
+
+// Compare a result against its golden file, updating the golden file if requested.
+func assertGolden(t *testing.T, name string, result interface{}) {
+	path := filepath.Join("testdata", "golden", name+".json")
+	actual, err := json.MarshalIndent(result, "", "  ")
+	assert.Nil(t, err)
+
+	if *update {
+		assert.Nil(t, os.WriteFile(path, append(actual, '\n'), 0o644))
+		return
+	}
+	expected, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.JSONEq(t, string(expected), string(actual))
+}
+
+// List the names of the resources of a kind matching a label selector.
+func kubectlNames(t *testing.T, kind string, selector string) string {
+	out, err := exec.Command(
+		"kubectl", "get", kind, "-l", selector, "-o", "name",
+	).Output()
+	assert.Nil(t, err)
+	return strings.TrimSpace(string(out))
+}
+
+// Run a command, streaming its output.
+func run(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s %s: %w", name, strings.Join(args, " "), err)
+	}
+	return nil
+}
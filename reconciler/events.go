@@ -0,0 +1,464 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	// Component reported as the source of the recorded Events
+	eventsComponent = "euphrosyne-reconciler"
+	// Prefix of the names of the ConfigMaps reporting the status of incidents
+	incidentObjectPrefix = "euphrosyne-incident-"
+	// Value of the component label of the ConfigMaps reporting the status of incidents
+	incidentObjectComponent = "incident"
+	// Maximum number of milestones waiting to be recorded
+	maxPendingEvents = 1000
+	// Interval between the deletions of the ConfigMaps of incidents that are no longer known
+	incidentObjectSweepInterval = time.Hour
+)
+
+// Reasons of the Events recorded for the milestones of incidents.
+const (
+	IncidentRegisteredReason  = "IncidentRegistered"
+	IncidentCompletedReason   = "IncidentCompleted"
+	IncidentCancelledReason   = "IncidentCancelled"
+	IncidentFailedReason      = "IncidentFailed"
+	IncidentClosedReason      = "IncidentClosed"
+	RecipeLaunchedReason      = "RecipeLaunched"
+	RecipeCompletedReason     = "RecipeCompleted"
+	RecipeFailedReason        = "RecipeFailed"
+	RecipeTimedOutReason      = "RecipeTimedOut"
+	CleanupCompletedReason    = "CleanupCompleted"
+	CleanupFailedReason       = "CleanupFailed"
+	ApprovalUpdatedReason     = "ApprovalUpdated"
+	ExecutionRecoveredReason  = "ExecutionRecovered"
+	LegalHoldPlacedReason     = "LegalHoldPlaced"
+	LegalHoldReleasedReason   = "LegalHoldReleased"
+	AckUpdatedReason          = "AckUpdated"
+	DebugSessionCreatedReason = "DebugSessionCreated"
+	DebugSessionDeletedReason = "DebugSessionDeleted"
+	ComplianceViolatedReason  = "ComplianceViolated"
+)
+
+// Events recorded for incidents, only set if enabled.
+var incidentEvents *IncidentEvents
+
+// IncidentEvent is the Kubernetes Event recorded for a milestone of an incident.
+type IncidentEvent struct {
+	Type    string
+	Reason  string
+	Message string
+	// Recipes whose Jobs the Event is also recorded on
+	Recipes []string
+}
+
+// IncidentEvents records the milestones of incidents as Kubernetes Events, so that their timeline
+// shows up in `kubectl describe`. Each incident is represented by a ConfigMap in the Reconciler
+// namespace, reporting its status and holding its Events, while the milestones of recipes are
+// also recorded on their Jobs.
+type IncidentEvents struct {
+	client    kubernetes.Interface
+	namespace string
+	recorder  record.EventRecorder
+	pending   chan AuditEvent
+	mutex     sync.Mutex
+	// References to the Jobs of the recipes of each incident, by incident and recipe
+	jobs map[string]map[string]*corev1.ObjectReference
+}
+
+// Initialise the recording of the Events of incidents in the Reconciler namespace.
+func NewIncidentEvents(client kubernetes.Interface, namespace string) *IncidentEvents {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(
+		&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events("")},
+	)
+	recorder := broadcaster.NewRecorder(
+		scheme.Scheme, corev1.EventSource{Component: eventsComponent},
+	)
+	return newIncidentEvents(client, namespace, recorder)
+}
+
+func newIncidentEvents(
+	client kubernetes.Interface, namespace string, recorder record.EventRecorder,
+) *IncidentEvents {
+	return &IncidentEvents{
+		client:    client,
+		namespace: namespace,
+		recorder:  recorder,
+		pending:   make(chan AuditEvent, maxPendingEvents),
+		jobs:      make(map[string]map[string]*corev1.ObjectReference),
+	}
+}
+
+// Queue the milestone of an incident to be recorded, without waiting for the Kubernetes API.
+// Milestones are dropped if too many are waiting.
+func (ie *IncidentEvents) Record(event AuditEvent) {
+	select {
+	case ie.pending <- event:
+	default:
+		eventsDropped.Inc()
+	}
+}
+
+// Keep track of the Job of a recipe, so that the milestones of the recipe are recorded on it.
+func (ie *IncidentEvents) TrackJob(uuid string, recipeName string, job *batchv1.Job) {
+	ie.mutex.Lock()
+	defer ie.mutex.Unlock()
+	if ie.jobs[uuid] == nil {
+		ie.jobs[uuid] = make(map[string]*corev1.ObjectReference)
+	}
+	ie.jobs[uuid][recipeName] = &corev1.ObjectReference{
+		Kind:       "Job",
+		APIVersion: batchv1.SchemeGroupVersion.String(),
+		Name:       job.Name,
+		Namespace:  job.Namespace,
+		UID:        job.UID,
+	}
+}
+
+// Record the queued milestones, deleting the ConfigMaps of the incidents that are no longer
+// known, until the context is cancelled.
+func (ie *IncidentEvents) Run(ctx context.Context) {
+	ticker := time.NewTicker(incidentObjectSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-ie.pending:
+			ie.record(ctx, event)
+		case <-ticker.C:
+			// Other replicas may not know the incidents of the leader
+			if leadership.IsLeader() {
+				ie.sweep(ctx)
+			}
+		}
+	}
+}
+
+// Record the Event of a milestone on the ConfigMap of its incident and on the Jobs of its
+// recipes, updating the status reported by the ConfigMap.
+func (ie *IncidentEvents) record(ctx context.Context, event AuditEvent) {
+	incidentEvent, ok := newIncidentEvent(event)
+	if !ok {
+		return
+	}
+	object, err := ie.syncIncidentObject(ctx, event.Incident)
+	if err != nil {
+		logger.Warn(
+			"Failed to update the status of incident",
+			zap.String("uuid", event.Incident),
+			zap.Error(err),
+		)
+		eventFailures.Inc()
+	} else {
+		ie.recorder.Event(object, incidentEvent.Type, incidentEvent.Reason, incidentEvent.Message)
+	}
+
+	ie.mutex.Lock()
+	defer ie.mutex.Unlock()
+	for _, recipeName := range incidentEvent.Recipes {
+		if job, ok := ie.jobs[event.Incident][recipeName]; ok {
+			ie.recorder.Event(job, incidentEvent.Type, incidentEvent.Reason, incidentEvent.Message)
+		}
+	}
+	// No milestones are recorded on the Jobs of incidents that are over
+	switch event.Action {
+	case AuditIncidentCompleted, AuditIncidentCancelled, AuditIncidentFailed:
+		delete(ie.jobs, event.Incident)
+	}
+}
+
+// Return the name of the ConfigMap of an incident. IDs may be upper case, unlike resource names.
+func incidentObjectName(uuid string) string {
+	return incidentObjectPrefix + strings.ToLower(uuid)
+}
+
+// Build the data of the ConfigMap of an incident, reporting its status.
+func incidentObjectData(incident *Incident) map[string]string {
+	data := map[string]string{
+		"state":       incident.State,
+		"requestType": incident.RequestType,
+		"createdAt":   incident.CreatedAt.Format(time.RFC3339),
+		"cleanup":     incident.Cleanup.State,
+	}
+	if incident.CompletedAt != nil {
+		data["completedAt"] = incident.CompletedAt.Format(time.RFC3339)
+	}
+	if incident.Error != "" {
+		data["error"] = incident.Error
+	}
+	if len(incident.Recipes) > 0 {
+		recipes := make([]string, 0, len(incident.Recipes))
+		for recipeName, state := range incident.Recipes {
+			recipes = append(recipes, fmt.Sprintf("%s: %s", recipeName, state.State))
+		}
+		sort.Strings(recipes)
+		data["recipes"] = strings.Join(recipes, "\n")
+	}
+	if incident.LegalHold != nil {
+		data["legalHold"] = "true"
+	}
+	if incident.Ack.State != "" {
+		data["ack"] = incident.Ack.State
+	}
+	return data
+}
+
+// Create or update the ConfigMap of an incident with its current status, returning it.
+func (ie *IncidentEvents) syncIncidentObject(
+	ctx context.Context, uuid string,
+) (*corev1.ConfigMap, error) {
+	incident, ok := incidentRegistry.Get(uuid)
+	if !ok {
+		return nil, errIncidentNotFound
+	}
+	configMaps := ie.client.CoreV1().ConfigMaps(ie.namespace)
+	name := incidentObjectName(uuid)
+
+	configMap, err := configMaps.Get(ctx, name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		configMap = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: ie.namespace,
+				// Unlike the resources of recipes, the ConfigMap outlives the cleanup
+				Labels: map[string]string{
+					"app":       eventsComponent,
+					"component": incidentObjectComponent,
+					"uuid":      uuid,
+				},
+			},
+			Data: incidentObjectData(incident),
+		}
+		return configMaps.Create(ctx, configMap, metav1.CreateOptions{})
+	}
+	if err != nil {
+		return nil, err
+	}
+	configMap.Data = incidentObjectData(incident)
+	return configMaps.Update(ctx, configMap, metav1.UpdateOptions{})
+}
+
+// Delete the ConfigMaps of the incidents that are no longer known to the incident registry,
+// along with their Events.
+func (ie *IncidentEvents) sweep(ctx context.Context) {
+	configMaps := ie.client.CoreV1().ConfigMaps(ie.namespace)
+	list, err := configMaps.List(ctx, metav1.ListOptions{
+		LabelSelector: metav1.FormatLabelSelector(&metav1.LabelSelector{
+			MatchLabels: map[string]string{
+				"app": eventsComponent, "component": incidentObjectComponent,
+			},
+		}),
+	})
+	if err != nil {
+		logger.Warn("Failed to list the ConfigMaps of incidents", zap.Error(err))
+		return
+	}
+	for _, configMap := range list.Items {
+		if _, ok := incidentRegistry.Get(configMap.Labels["uuid"]); ok {
+			continue
+		}
+		err := configMaps.Delete(ctx, configMap.Name, metav1.DeleteOptions{})
+		if err != nil && !k8serrors.IsNotFound(err) {
+			logger.Warn(
+				"Failed to delete the ConfigMap of incident",
+				zap.String("configMapName", configMap.Name),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+// Build the Event of a milestone of an incident. Audit events that are not milestones of
+// incidents are left out.
+func newIncidentEvent(event AuditEvent) (IncidentEvent, bool) {
+	detail := func(key string) string {
+		if value, ok := event.Details[key]; ok {
+			return fmt.Sprint(value)
+		}
+		return ""
+	}
+	recipeName := detail("recipe")
+
+	switch event.Action {
+	case AuditIncidentRegistered:
+		return IncidentEvent{
+			Type:    corev1.EventTypeNormal,
+			Reason:  IncidentRegisteredReason,
+			Message: fmt.Sprintf("Registered %s incident", detail("requestType")),
+		}, true
+	case AuditRecipeLaunched:
+		return IncidentEvent{
+			Type:   corev1.EventTypeNormal,
+			Reason: RecipeLaunchedReason,
+			Message: fmt.Sprintf(
+				"Launched recipe '%s' as Job '%s' (attempt %s)",
+				recipeName, detail("job"), detail("attempts"),
+			),
+			Recipes: []string{recipeName},
+		}, true
+	case AuditRecipeFailed:
+		return IncidentEvent{
+			Type:    corev1.EventTypeWarning,
+			Reason:  RecipeFailedReason,
+			Message: fmt.Sprintf("Recipe '%s' failed: %s", recipeName, detail("error")),
+			Recipes: []string{recipeName},
+		}, true
+	case AuditRecipeFinished:
+		incidentEvent := IncidentEvent{
+			Type:   corev1.EventTypeWarning,
+			Reason: RecipeFailedReason,
+			Message: fmt.Sprintf(
+				"Recipe '%s' %s: %s", recipeName, detail("state"), detail("reason"),
+			),
+			Recipes: []string{recipeName},
+		}
+		switch detail("state") {
+		case RecipeStateCompleted:
+			incidentEvent.Type = corev1.EventTypeNormal
+			incidentEvent.Reason = RecipeCompletedReason
+		case RecipeStateTimedOut:
+			incidentEvent.Reason = RecipeTimedOutReason
+		}
+		// Recipes that published their results report their status instead of a reason
+		if status := detail("status"); status != "" {
+			incidentEvent.Message = fmt.Sprintf(
+				"Recipe '%s' completed with status '%s'", recipeName, status,
+			)
+		}
+		return incidentEvent, true
+	case AuditRecipesTimedOut:
+		recipes, _ := event.Details["recipes"].([]string)
+		return IncidentEvent{
+			Type:    corev1.EventTypeWarning,
+			Reason:  RecipeTimedOutReason,
+			Message: fmt.Sprintf("Recipes timed out: %s", strings.Join(recipes, ", ")),
+			Recipes: recipes,
+		}, true
+	case AuditCleanupFinished:
+		if err := detail("error"); err != "" {
+			return IncidentEvent{
+				Type:    corev1.EventTypeWarning,
+				Reason:  CleanupFailedReason,
+				Message: fmt.Sprintf("Cleanup failed: %s", err),
+			}, true
+		}
+		return IncidentEvent{
+			Type:    corev1.EventTypeNormal,
+			Reason:  CleanupCompletedReason,
+			Message: "Cleaned up the resources of the incident",
+		}, true
+	case AuditApprovalUpdated:
+		return IncidentEvent{
+			Type:    corev1.EventTypeNormal,
+			Reason:  ApprovalUpdatedReason,
+			Message: fmt.Sprintf("Approval of the actions %s", detail("state")),
+		}, true
+	case AuditIncidentClosed:
+		return IncidentEvent{
+			Type:   corev1.EventTypeNormal,
+			Reason: IncidentClosedReason,
+			Message: fmt.Sprintf(
+				"Verification of the resolved alert finished with status '%s'", detail("status"),
+			),
+		}, true
+	case AuditIncidentCompleted:
+		return IncidentEvent{
+			Type:    corev1.EventTypeNormal,
+			Reason:  IncidentCompletedReason,
+			Message: "Incident completed",
+		}, true
+	case AuditIncidentCancelled:
+		return IncidentEvent{
+			Type:    corev1.EventTypeWarning,
+			Reason:  IncidentCancelledReason,
+			Message: "Incident cancelled",
+		}, true
+	case AuditIncidentFailed:
+		return IncidentEvent{
+			Type:    corev1.EventTypeWarning,
+			Reason:  IncidentFailedReason,
+			Message: fmt.Sprintf("Incident failed: %s", detail("error")),
+		}, true
+	case AuditExecutionRecovered:
+		return IncidentEvent{
+			Type:    corev1.EventTypeNormal,
+			Reason:  ExecutionRecoveredReason,
+			Message: "Execution recovered after a restart of the reconciler",
+		}, true
+	case AuditLegalHoldPlaced:
+		return IncidentEvent{
+			Type:    corev1.EventTypeNormal,
+			Reason:  LegalHoldPlacedReason,
+			Message: fmt.Sprintf("Placed under legal hold: %s", detail("reason")),
+		}, true
+	case AuditLegalHoldReleased:
+		return IncidentEvent{
+			Type:    corev1.EventTypeNormal,
+			Reason:  LegalHoldReleasedReason,
+			Message: "Released from legal hold",
+		}, true
+	case AuditAckUpdated:
+		return IncidentEvent{
+			Type:    corev1.EventTypeNormal,
+			Reason:  AckUpdatedReason,
+			Message: fmt.Sprintf("Marked as %s by '%s'", detail("state"), detail("user")),
+		}, true
+	case AuditDebugSessionCreated:
+		return IncidentEvent{
+			Type:   corev1.EventTypeNormal,
+			Reason: DebugSessionCreatedReason,
+			Message: fmt.Sprintf(
+				"Created debugging session '%s' for '%s', expiring at %s",
+				detail("pod"), detail("user"), detail("expiresAt"),
+			),
+		}, true
+	case AuditDebugSessionDeleted:
+		return IncidentEvent{
+			Type:    corev1.EventTypeNormal,
+			Reason:  DebugSessionDeletedReason,
+			Message: fmt.Sprintf("Debugging session '%s' %s", detail("pod"), detail("reason")),
+		}, true
+	case AuditComplianceViolated:
+		violations, _ := event.Details["violations"].([]ComplianceViolation)
+		recipes := make([]string, 0, len(violations))
+		for _, violation := range violations {
+			recipes = append(recipes, violation.Recipe)
+		}
+		return IncidentEvent{
+			Type:   corev1.EventTypeWarning,
+			Reason: ComplianceViolatedReason,
+			Message: fmt.Sprintf(
+				"Required recipes did not run successfully: %s", formatViolations(violations),
+			),
+			Recipes: recipes,
+		}, true
+	}
+	return IncidentEvent{}, false
+}
+
+// Keep track of the Job of a recipe, if Events are recorded. Events are only recorded on the Jobs
+// of the local cluster.
+func (r *Reconciler) trackJobEvents(recipeName string, job *batchv1.Job) {
+	if incidentEvents == nil || r.recipeTarget(recipeName).Cluster != "" {
+		return
+	}
+	incidentEvents.TrackJob(r.uuid, recipeName, job)
+}
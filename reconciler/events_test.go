@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+// Test that the milestones of incidents are turned into Events, leaving out other audit events.
+func TestNewIncidentEvent(t *testing.T) {
+	tests := []struct {
+		name     string
+		event    AuditEvent
+		expected IncidentEvent
+		ok       bool
+	}{
+		{
+			name: "RecipeLaunched",
+			event: AuditEvent{
+				Action: AuditRecipeLaunched,
+				Details: map[string]interface{}{
+					"recipe": "logs", "job": "logs-abcde", "attempts": 2,
+				},
+			},
+			expected: IncidentEvent{
+				Type:    corev1.EventTypeNormal,
+				Reason:  RecipeLaunchedReason,
+				Message: "Launched recipe 'logs' as Job 'logs-abcde' (attempt 2)",
+				Recipes: []string{"logs"},
+			},
+			ok: true,
+		},
+		{
+			name: "RecipeCompleted",
+			event: AuditEvent{
+				Action: AuditRecipeFinished,
+				Details: map[string]interface{}{
+					"recipe": "logs", "state": RecipeStateCompleted, "status": "successful",
+				},
+			},
+			expected: IncidentEvent{
+				Type:    corev1.EventTypeNormal,
+				Reason:  RecipeCompletedReason,
+				Message: "Recipe 'logs' completed with status 'successful'",
+				Recipes: []string{"logs"},
+			},
+			ok: true,
+		},
+		{
+			name: "RecipeJobFailed",
+			event: AuditEvent{
+				Action: AuditRecipeFinished,
+				Details: map[string]interface{}{
+					"recipe": "logs", "state": RecipeStateFailed, "reason": "BackoffLimitExceeded",
+				},
+			},
+			expected: IncidentEvent{
+				Type:    corev1.EventTypeWarning,
+				Reason:  RecipeFailedReason,
+				Message: "Recipe 'logs' failed: BackoffLimitExceeded",
+				Recipes: []string{"logs"},
+			},
+			ok: true,
+		},
+		{
+			name: "RecipesTimedOut",
+			event: AuditEvent{
+				Action:  AuditRecipesTimedOut,
+				Details: map[string]interface{}{"recipes": []string{"logs", "metrics"}},
+			},
+			expected: IncidentEvent{
+				Type:    corev1.EventTypeWarning,
+				Reason:  RecipeTimedOutReason,
+				Message: "Recipes timed out: logs, metrics",
+				Recipes: []string{"logs", "metrics"},
+			},
+			ok: true,
+		},
+		{
+			name: "CleanupFailed",
+			event: AuditEvent{
+				Action:  AuditCleanupFinished,
+				Details: map[string]interface{}{"error": "forbidden"},
+			},
+			expected: IncidentEvent{
+				Type:    corev1.EventTypeWarning,
+				Reason:  CleanupFailedReason,
+				Message: "Cleanup failed: forbidden",
+			},
+			ok: true,
+		},
+		{
+			name: "AckUpdated",
+			event: AuditEvent{
+				Action: AuditAckUpdated,
+				Details: map[string]interface{}{
+					"state": AckStateAcked, "user": "alice", "source": APIAckSource,
+				},
+			},
+			expected: IncidentEvent{
+				Type:    corev1.EventTypeNormal,
+				Reason:  AckUpdatedReason,
+				Message: "Marked as acked by 'alice'",
+			},
+			ok: true,
+		},
+		{
+			name: "DebugSessionDeleted",
+			event: AuditEvent{
+				Action: AuditDebugSessionDeleted,
+				Details: map[string]interface{}{
+					"pod": "euphrosyne-debug-abcdefgh", "reason": DebugSessionExpired,
+				},
+			},
+			expected: IncidentEvent{
+				Type:    corev1.EventTypeNormal,
+				Reason:  DebugSessionDeletedReason,
+				Message: "Debugging session 'euphrosyne-debug-abcdefgh' expired",
+			},
+			ok: true,
+		},
+		{
+			name: "ComplianceViolated",
+			event: AuditEvent{
+				Action: AuditComplianceViolated,
+				Details: map[string]interface{}{
+					"rules": []string{"sev1-evidence"},
+					"violations": []ComplianceViolation{
+						{Recipe: "evidence", Reason: ComplianceDisabled},
+						{Recipe: "logs", Reason: ComplianceFailed},
+					},
+				},
+			},
+			expected: IncidentEvent{
+				Type:   corev1.EventTypeWarning,
+				Reason: ComplianceViolatedReason,
+				Message: "Required recipes did not run successfully: " +
+					"evidence (disabled), logs (failed)",
+				Recipes: []string{"evidence", "logs"},
+			},
+			ok: true,
+		},
+		{
+			name: "IncidentFailed",
+			event: AuditEvent{
+				Action:  AuditIncidentFailed,
+				Details: map[string]interface{}{"error": "catalog unavailable"},
+			},
+			expected: IncidentEvent{
+				Type:    corev1.EventTypeWarning,
+				Reason:  IncidentFailedReason,
+				Message: "Incident failed: catalog unavailable",
+			},
+			ok: true,
+		},
+		{
+			name:  "CatalogLoaded",
+			event: AuditEvent{Action: AuditCatalogLoaded},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			incidentEvent, ok := newIncidentEvent(tt.event)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.expected, incidentEvent)
+		})
+	}
+}
+
+// Test that milestones are recorded on the ConfigMap of their incident, which reports its status,
+// and on the Jobs of their recipes.
+func TestIncidentEventsRecord(t *testing.T) {
+	registry := incidentRegistry
+	defer func() { incidentRegistry = registry }()
+	incidentRegistry = NewIncidentRegistry(MemoryIncidentStore, time.Hour)
+
+	client := fake.NewSimpleClientset()
+	recorder := record.NewFakeRecorder(10)
+	ie := newIncidentEvents(client, "euphrosyne", recorder)
+	ctx := context.Background()
+
+	uuid := "01HQ3Z5N2E8Y6V4C1X0W9T7R5P"
+	incidentRegistry.Register(uuid, Alert)
+	ie.record(ctx, AuditEvent{
+		Action: AuditIncidentRegistered, Incident: uuid,
+		Details: map[string]interface{}{"requestType": "alert"},
+	})
+
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{
+		Name: "logs-abcde", Namespace: "recipes", UID: "job-uid",
+	}}
+	ie.TrackJob(uuid, "logs", job)
+	incidentRegistry.RecipeLaunched(uuid, "logs", job.Name, 1)
+	ie.record(ctx, AuditEvent{
+		Action: AuditRecipeLaunched, Incident: uuid,
+		Details: map[string]interface{}{"recipe": "logs", "job": job.Name, "attempts": 1},
+	})
+
+	assert.Equal(t, []string{
+		"Normal IncidentRegistered Registered alert incident",
+		"Normal RecipeLaunched Launched recipe 'logs' as Job 'logs-abcde' (attempt 1)",
+		"Normal RecipeLaunched Launched recipe 'logs' as Job 'logs-abcde' (attempt 1)",
+	}, drainFakeEvents(recorder))
+
+	configMap, err := client.CoreV1().ConfigMaps("euphrosyne").Get(
+		ctx, incidentObjectName(uuid), metav1.GetOptions{},
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, "euphrosyne-incident-01hq3z5n2e8y6v4c1x0w9t7r5p", configMap.Name)
+	assert.Equal(t, uuid, configMap.Labels["uuid"])
+	assert.Equal(t, IncidentStateRunning, configMap.Data["state"])
+	assert.Equal(t, "logs: running", configMap.Data["recipes"])
+
+	// Milestones are no longer recorded on the Jobs of completed incidents
+	incidentRegistry.Complete(uuid)
+	ie.record(ctx, AuditEvent{Action: AuditIncidentCompleted, Incident: uuid})
+	ie.record(ctx, AuditEvent{
+		Action: AuditRecipeFailed, Incident: uuid,
+		Details: map[string]interface{}{"recipe": "logs", "error": "late"},
+	})
+	assert.Equal(t, []string{
+		"Normal IncidentCompleted Incident completed",
+		"Warning RecipeFailed Recipe 'logs' failed: late",
+	}, drainFakeEvents(recorder))
+
+	configMap, err = client.CoreV1().ConfigMaps("euphrosyne").Get(
+		ctx, incidentObjectName(uuid), metav1.GetOptions{},
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, IncidentStateCompleted, configMap.Data["state"])
+	assert.NotEmpty(t, configMap.Data["completedAt"])
+}
+
+// Test that the ConfigMaps of incidents are deleted once the incidents are no longer known.
+func TestIncidentEventsSweep(t *testing.T) {
+	registry := incidentRegistry
+	defer func() { incidentRegistry = registry }()
+	incidentRegistry = NewIncidentRegistry(MemoryIncidentStore, time.Hour)
+	incidentRegistry.Register("known", Alert)
+
+	client := fake.NewSimpleClientset()
+	ctx := context.Background()
+	for _, uuid := range []string{"known", "forgotten"} {
+		_, err := client.CoreV1().ConfigMaps("euphrosyne").Create(ctx, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: incidentObjectName(uuid),
+				Labels: map[string]string{
+					"app": eventsComponent, "component": incidentObjectComponent, "uuid": uuid,
+				},
+			},
+		}, metav1.CreateOptions{})
+		assert.Nil(t, err)
+	}
+
+	newIncidentEvents(client, "euphrosyne", record.NewFakeRecorder(1)).sweep(ctx)
+
+	configMaps, err := client.CoreV1().ConfigMaps("euphrosyne").List(ctx, metav1.ListOptions{})
+	assert.Nil(t, err)
+	assert.Len(t, configMaps.Items, 1)
+	assert.Equal(t, incidentObjectName("known"), configMaps.Items[0].Name)
+}
+
+// Return the Events recorded so far by a fake recorder.
+func drainFakeEvents(recorder *record.FakeRecorder) []string {
+	var events []string
+	for {
+		select {
+		case event := <-recorder.Events:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"go.uber.org/zap"
+)
+
+// Supported formats for the compliance export.
+const (
+	JSONLExportFormat   = "jsonl"
+	ParquetExportFormat = "parquet"
+)
+
+// Kinds of records written by the compliance export.
+const (
+	auditExportKind      = "audit"
+	executionsExportKind = "executions"
+)
+
+const (
+	// Suffix of the objects holding the integrity hash of each exported object
+	checksumSuffix = ".sha256"
+	// Suffix of the objects listing the incidents each exported object holds records of
+	incidentsSuffix = ".incidents"
+)
+
+// ExecutionSummary is the exported record of a completed incident.
+type ExecutionSummary struct {
+	UUID        string                  `json:"uuid"`
+	RequestType string                  `json:"requestType"`
+	State       string                  `json:"state"`
+	CreatedAt   time.Time               `json:"createdAt"`
+	CompletedAt time.Time               `json:"completedAt"`
+	Recipes     map[string]*RecipeState `json:"recipes"`
+	Cleanup     CleanupState            `json:"cleanup"`
+	Suppressed  int                     `json:"suppressed"`
+	Occurrences int                     `json:"occurrences"`
+	Compliance  *Compliance             `json:"compliance,omitempty"`
+}
+
+// Flat representations of the exported records for columnar formats, with nested fields
+// JSON-encoded.
+type auditRow struct {
+	Timestamp time.Time `parquet:"timestamp,timestamp(millisecond)"`
+	Action    string    `parquet:"action"`
+	Incident  string    `parquet:"incident"`
+	Details   string    `parquet:"details"`
+}
+
+type executionRow struct {
+	UUID        string    `parquet:"uuid"`
+	RequestType string    `parquet:"requestType"`
+	State       string    `parquet:"state"`
+	CreatedAt   time.Time `parquet:"createdAt,timestamp(millisecond)"`
+	CompletedAt time.Time `parquet:"completedAt,timestamp(millisecond)"`
+	Recipes     string    `parquet:"recipes"`
+	Cleanup     string    `parquet:"cleanup"`
+	Suppressed  int64     `parquet:"suppressed"`
+	Occurrences int64     `parquet:"occurrences"`
+	Compliance  string    `parquet:"compliance,optional"`
+}
+
+// Exporter periodically writes the audit log and the summaries of completed incidents to an
+// object store. Expired objects are pruned by the janitor.
+type Exporter struct {
+	store      ObjectStore
+	prefix     string
+	format     string
+	lastExport time.Time
+}
+
+// Exporter of the compliance records, only set if enabled.
+var complianceExporter *Exporter
+
+// Check whether the provided export format is supported.
+func isValidExportFormat(format string) bool {
+	switch format {
+	case JSONLExportFormat, ParquetExportFormat:
+		return true
+	}
+	return false
+}
+
+// Initialise an exporter from the Reconciler configuration.
+func NewExporter(config *Config) (*Exporter, error) {
+	store, prefix, err := NewObjectStore(config.ExportDestination, config.ExportEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	return &Exporter{
+		store:      store,
+		prefix:     prefix,
+		format:     config.ExportFormat,
+		lastExport: time.Now().UTC(),
+	}, nil
+}
+
+// Run the export on the provided interval, until the context is cancelled.
+func (e *Exporter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := e.Export(ctx); err != nil {
+				logger.Error("Failed to export compliance records", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Export the audit events collected since the last export, along with the summaries of the
+// incidents completed in the meantime.
+func (e *Exporter) Export(ctx context.Context) error {
+	now := time.Now().UTC()
+
+	events, dropped := auditLog.Drain()
+	if dropped > 0 {
+		logger.Warn("Audit events were dropped before being exported", zap.Int("dropped", dropped))
+	}
+	if len(events) > 0 {
+		var incidents []string
+		for _, event := range events {
+			incidents = append(incidents, event.Incident)
+		}
+		if err := e.write(ctx, auditExportKind, now, events, incidents); err != nil {
+			auditLog.Restore(events)
+			exportFailures.Inc()
+			return err
+		}
+		exportedRecords.WithLabelValues(auditExportKind).Add(float64(len(events)))
+	}
+
+	executions := completedIncidents(incidentRegistry.List(), e.lastExport, now)
+	if len(executions) > 0 {
+		var incidents []string
+		for _, execution := range executions {
+			incidents = append(incidents, execution.UUID)
+		}
+		if err := e.write(ctx, executionsExportKind, now, executions, incidents); err != nil {
+			exportFailures.Inc()
+			return err
+		}
+		exportedRecords.WithLabelValues(executionsExportKind).Add(float64(len(executions)))
+	}
+	e.lastExport = now
+	return nil
+}
+
+// Summarise the incidents completed within the provided time window.
+func completedIncidents(incidents []*Incident, since, until time.Time) []ExecutionSummary {
+	var executions []ExecutionSummary
+	for _, incident := range incidents {
+		if incident.CompletedAt == nil ||
+			!incident.CompletedAt.After(since) || incident.CompletedAt.After(until) {
+			continue
+		}
+		executions = append(executions, ExecutionSummary{
+			UUID:        incident.UUID,
+			RequestType: incident.RequestType,
+			State:       incident.State,
+			CreatedAt:   incident.CreatedAt,
+			CompletedAt: *incident.CompletedAt,
+			Recipes:     incident.Recipes,
+			Cleanup:     incident.Cleanup,
+			Suppressed:  incident.Suppressed,
+			Occurrences: incident.Occurrences,
+			Compliance:  incident.Compliance,
+		})
+	}
+	return executions
+}
+
+// Write a batch of records along with its integrity hash and the list of incidents it holds
+// records of, under a date-partitioned key.
+func (e *Exporter) write(
+	ctx context.Context, kind string, now time.Time, records interface{}, incidents []string,
+) error {
+	data, err := encodeRecords(e.format, records)
+	if err != nil {
+		return err
+	}
+
+	key := path.Join(
+		e.prefix, kind, "dt="+now.Format("2006-01-02"),
+		fmt.Sprintf("%s-%s.%s", kind, now.Format("20060102T150405.000Z"), e.format),
+	)
+	sum := sha256.Sum256(data)
+	checksum := fmt.Sprintf("%s  %s\n", hex.EncodeToString(sum[:]), path.Base(key))
+
+	if err := e.store.Put(ctx, key, data, exportContentType(e.format)); err != nil {
+		return fmt.Errorf("Failed to write '%s': %w", key, err)
+	}
+	if err := e.store.Put(ctx, key+checksumSuffix, []byte(checksum), "text/plain"); err != nil {
+		return fmt.Errorf("Failed to write '%s': %w", key+checksumSuffix, err)
+	}
+	if err := e.store.Put(
+		ctx, key+incidentsSuffix, []byte(incidentsIndex(incidents)), "text/plain",
+	); err != nil {
+		return fmt.Errorf("Failed to write '%s': %w", key+incidentsSuffix, err)
+	}
+	logger.Info("Exported compliance records", zap.String("key", key))
+	return nil
+}
+
+// List the distinct incidents of a batch, one per line.
+func incidentsIndex(incidents []string) string {
+	var index strings.Builder
+	seen := make(map[string]bool)
+	for _, incident := range incidents {
+		if incident == "" || seen[incident] {
+			continue
+		}
+		seen[incident] = true
+		index.WriteString(incident + "\n")
+	}
+	return index.String()
+}
+
+// Delete the exported batches last modified before the cutoff, along with their integrity hash,
+// returning how many were deleted. Batches holding records of held incidents are kept.
+func (e *Exporter) prune(ctx context.Context, cutoff time.Time, held []string) (int, error) {
+	deleted := 0
+	for _, kind := range []string{auditExportKind, executionsExportKind} {
+		objects, err := e.store.List(ctx, path.Join(e.prefix, kind)+"/")
+		if err != nil {
+			return deleted, err
+		}
+
+		kept := make(map[string]bool)
+		for _, object := range objects {
+			batch, ok := strings.CutSuffix(object.Key, incidentsSuffix)
+			if !ok || len(held) == 0 || !object.LastModified.Before(cutoff) {
+				continue
+			}
+			index, err := e.store.Get(ctx, object.Key)
+			if err != nil {
+				return deleted, err
+			}
+			for _, incident := range strings.Fields(string(index)) {
+				if slices.Contains(held, incident) {
+					kept[batch] = true
+					break
+				}
+			}
+		}
+
+		for _, object := range objects {
+			batch := strings.TrimSuffix(object.Key, checksumSuffix)
+			batch = strings.TrimSuffix(batch, incidentsSuffix)
+			if !object.LastModified.Before(cutoff) || kept[batch] {
+				continue
+			}
+			if err := e.store.Delete(ctx, object.Key); err != nil {
+				return deleted, err
+			}
+			if object.Key == batch {
+				deleted++
+			}
+			logger.Info("Pruned expired compliance record", zap.String("key", object.Key))
+		}
+	}
+	return deleted, nil
+}
+
+// Encode a batch of records in the provided format.
+func encodeRecords(format string, records interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	switch format {
+	case ParquetExportFormat:
+		if err := writeParquet(&buf, records); err != nil {
+			return nil, err
+		}
+	default:
+		encoder := json.NewEncoder(&buf)
+		switch records := records.(type) {
+		case []AuditEvent:
+			for _, record := range records {
+				if err := encoder.Encode(record); err != nil {
+					return nil, err
+				}
+			}
+		case []ExecutionSummary:
+			for _, record := range records {
+				if err := encoder.Encode(record); err != nil {
+					return nil, err
+				}
+			}
+		default:
+			return nil, fmt.Errorf("Unsupported export records %T", records)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// Write a batch of records as a Parquet file.
+func writeParquet(buf *bytes.Buffer, records interface{}) error {
+	switch records := records.(type) {
+	case []AuditEvent:
+		rows := make([]auditRow, 0, len(records))
+		for _, record := range records {
+			details, err := json.Marshal(record.Details)
+			if err != nil {
+				return err
+			}
+			rows = append(rows, auditRow{
+				Timestamp: record.Timestamp,
+				Action:    record.Action,
+				Incident:  record.Incident,
+				Details:   string(details),
+			})
+		}
+		return parquet.Write(buf, rows)
+	case []ExecutionSummary:
+		rows := make([]executionRow, 0, len(records))
+		for _, record := range records {
+			recipes, err := json.Marshal(record.Recipes)
+			if err != nil {
+				return err
+			}
+			cleanup, err := json.Marshal(record.Cleanup)
+			if err != nil {
+				return err
+			}
+			var compliance []byte
+			if record.Compliance != nil {
+				if compliance, err = json.Marshal(record.Compliance); err != nil {
+					return err
+				}
+			}
+			rows = append(rows, executionRow{
+				UUID:        record.UUID,
+				RequestType: record.RequestType,
+				State:       record.State,
+				CreatedAt:   record.CreatedAt,
+				CompletedAt: record.CompletedAt,
+				Recipes:     string(recipes),
+				Cleanup:     string(cleanup),
+				Suppressed:  int64(record.Suppressed),
+				Occurrences: int64(record.Occurrences),
+				Compliance:  string(compliance),
+			})
+		}
+		return parquet.Write(buf, rows)
+	}
+	return fmt.Errorf("Unsupported export records %T", records)
+}
+
+// Return the content type of the exported objects.
+func exportContentType(format string) string {
+	if format == ParquetExportFormat {
+		return "application/vnd.apache.parquet"
+	}
+	return "application/x-ndjson"
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that the exporter writes the audit log and execution summaries with integrity hashes.
+func TestExporter(t *testing.T) {
+	registry := incidentRegistry
+	defer func() { incidentRegistry = registry }()
+
+	tests := []struct {
+		name   string
+		format string
+	}{
+		{name: "JSONL", format: JSONLExportFormat},
+		{name: "Parquet", format: ParquetExportFormat},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auditLog.Drain()
+			incidentRegistry = NewIncidentRegistry(MemoryIncidentStore, time.Hour)
+
+			root := t.TempDir()
+			exporter, err := NewExporter(&Config{
+				ExportDestination: "file://" + root,
+				ExportFormat:      tt.format,
+			})
+			assert.Nil(t, err)
+
+			incidentRegistry.Register("incident-1", Alert)
+			incidentRegistry.RecipeLaunched("incident-1", "test-recipe", "test-recipe-abcde", 1)
+			incidentRegistry.Complete("incident-1")
+			incidentRegistry.Register("incident-2", Alert)
+
+			assert.Nil(t, exporter.Export(context.Background()))
+
+			objects, err := exporter.store.List(context.Background(), "")
+			assert.Nil(t, err)
+			assert.Len(t, objects, 6)
+
+			for _, object := range objects {
+				if strings.HasSuffix(object.Key, checksumSuffix) {
+					continue
+				}
+				index, ok := strings.CutSuffix(object.Key, incidentsSuffix)
+				if ok {
+					// The incidents of each batch are listed alongside it
+					data, err := exporter.store.Get(context.Background(), object.Key)
+					assert.Nil(t, err)
+					if strings.HasPrefix(index, executionsExportKind) {
+						assert.Equal(t, "incident-1\n", string(data))
+					} else {
+						assert.Equal(t, "incident-1\nincident-2\n", string(data))
+					}
+					continue
+				}
+				assert.True(t, strings.HasSuffix(object.Key, "."+tt.format))
+
+				data, err := exporter.store.Get(context.Background(), object.Key)
+				assert.Nil(t, err)
+				checksum, err := exporter.store.Get(context.Background(), object.Key+checksumSuffix)
+				assert.Nil(t, err)
+				sum := sha256.Sum256(data)
+				assert.True(t, strings.HasPrefix(string(checksum), hex.EncodeToString(sum[:])))
+
+				if tt.format == JSONLExportFormat {
+					lines := bytes.Count(data, []byte("\n"))
+					if strings.HasPrefix(object.Key, executionsExportKind) {
+						assert.Equal(t, 1, lines)
+					} else {
+						assert.Equal(t, 4, lines)
+					}
+				}
+			}
+
+			// Nothing new to export
+			assert.Nil(t, exporter.Export(context.Background()))
+			objects, err = exporter.store.List(context.Background(), "")
+			assert.Nil(t, err)
+			assert.Len(t, objects, 6)
+		})
+	}
+}
+
+// Test that the exporter prunes objects older than the retention period, unless they hold
+// records of incidents under legal hold.
+func TestExporterRetention(t *testing.T) {
+	root := t.TempDir()
+	exporter, err := NewExporter(&Config{
+		ExportDestination: "file://" + root,
+		ExportFormat:      JSONLExportFormat,
+		ExportRetention:   30 * day,
+	})
+	assert.Nil(t, err)
+
+	old := filepath.Join(root, "audit", "dt=2020-01-01", "audit-20200101T000000.000Z.jsonl")
+	held := filepath.Join(root, "audit", "dt=2020-01-01", "audit-20200101T010000.000Z.jsonl")
+	recent := filepath.Join(root, "audit", "dt=2020-01-02", "audit-20200102T000000.000Z.jsonl")
+	oldTime := time.Now().Add(-31 * 24 * time.Hour)
+	for _, path := range []string{old, held, recent} {
+		assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		assert.Nil(t, os.WriteFile(path, []byte("{}\n"), 0o644))
+	}
+	assert.Nil(t, os.WriteFile(old+incidentsSuffix, []byte("incident-1\n"), 0o644))
+	assert.Nil(t, os.WriteFile(held+incidentsSuffix, []byte("incident-1\nincident-2\n"), 0o644))
+	for _, path := range []string{old, old + incidentsSuffix, held, held + incidentsSuffix} {
+		assert.Nil(t, os.Chtimes(path, oldTime, oldTime))
+	}
+
+	cutoff := time.Now().Add(-30 * 24 * time.Hour)
+	deleted, err := exporter.prune(context.Background(), cutoff, []string{"incident-2"})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, deleted)
+
+	assert.NoFileExists(t, old)
+	assert.NoFileExists(t, old+incidentsSuffix)
+	assert.FileExists(t, held)
+	assert.FileExists(t, held+incidentsSuffix)
+	assert.FileExists(t, recent)
+}
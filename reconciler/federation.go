@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.uber.org/zap"
+)
+
+// FederatedExecution is the request sent to a peer reconciler to run a recipe on behalf of an
+// incident handled by this reconciler.
+type FederatedExecution struct {
+	Origin      string                 `json:"origin"`
+	RequestType string                 `json:"requestType"`
+	Recipe      string                 `json:"recipe"`
+	Data        map[string]interface{} `json:"data"`
+}
+
+// remoteExecution tracks a recipe forwarded to a peer reconciler.
+type remoteExecution struct {
+	Peer string `json:"peer"`
+	UUID string `json:"uuid"`
+}
+
+// Parse the federation peers from a comma-separated list of name=URL pairs.
+func parseFederationPeers(peers string) (map[string]string, error) {
+	peerURLs := make(map[string]string)
+	for _, peer := range strings.Split(peers, ",") {
+		peer = strings.TrimSpace(peer)
+		if peer == "" {
+			continue
+		}
+		name, peerURL, ok := strings.Cut(peer, "=")
+		if !ok || name == "" || peerURL == "" {
+			return nil, fmt.Errorf("Invalid federation peer '%s', expected <name>=<url>", peer)
+		}
+		peerURLs[name] = strings.TrimSuffix(peerURL, "/")
+	}
+	return peerURLs, nil
+}
+
+// Parse a request type from its name.
+func parseRequestType(name string) (RequestType, error) {
+	switch name {
+	case Alert.String():
+		return Alert, nil
+	case Actions.String():
+		return Actions, nil
+	}
+	return 0, fmt.Errorf("Unsupported request type '%s'", name)
+}
+
+// Send a request to a peer reconciler, authenticated with the federation token and carrying the
+// trace context.
+func federationRequest(
+	ctx context.Context, config *Config, method string, peer string, path string,
+	body interface{}, response interface{},
+) error {
+	peers, err := parseFederationPeers(config.FederationPeers)
+	if err != nil {
+		return err
+	}
+	peerURL, ok := peers[peer]
+	if !ok {
+		return fmt.Errorf("Unknown federation peer '%s'", peer)
+	}
+
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, peerURL+path, &payload)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+config.FederationToken)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := httpc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		var problem Problem
+		if json.NewDecoder(resp.Body).Decode(&problem) == nil && problem.Code != "" {
+			return fmt.Errorf(
+				"Peer '%s' responded with %s (%s): %s",
+				peer, resp.Status, problem.Code, problem.Detail,
+			)
+		}
+		return fmt.Errorf("Peer '%s' responded with %s", peer, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(response)
+}
+
+// Forward a recipe to the peer reconciler it is assigned to, instead of launching it locally.
+func (r *Reconciler) forwardRecipe(recipeName string, recipe Recipe, data map[string]interface{}) {
+	peer := recipe.Config.Peer
+	request := FederatedExecution{
+		Origin:      r.uuid,
+		RequestType: r.requestType.String(),
+		Recipe:      recipeName,
+		Data:        data,
+	}
+	var response struct {
+		UUID string `json:"uuid"`
+	}
+	err := federationRequest(
+		r.traceContext(), r.config, http.MethodPost, peer, "/federation/executions", request,
+		&response,
+	)
+	if err != nil {
+		logger.Error(
+			"Failed to forward recipe to peer",
+			zap.String("recipe", recipeName),
+			zap.String("peer", peer),
+			zap.Error(err),
+		)
+		r.finished[recipeName] = true
+		incidentRegistry.RecipeFailed(r.uuid, recipeName, err)
+		recipeLaunchFailures.WithLabelValues(recipeLabel(recipeName)).Inc()
+		return
+	}
+
+	logger.Info(
+		"Recipe forwarded to peer",
+		zap.String("uuid", r.uuid),
+		zap.String("recipe", recipeName),
+		zap.String("peer", peer),
+		zap.String("remoteUUID", response.UUID),
+	)
+	r.remote[recipeName] = &remoteExecution{Peer: peer, UUID: response.UUID}
+	incidentRegistry.RecipeLaunched(r.uuid, recipeName, peer+"/"+response.UUID, 1)
+	recipesLaunched.WithLabelValues(recipeLabel(recipeName)).Inc()
+}
+
+// Poll the peer reconcilers for the results of the forwarded recipes that have not reported
+// their results yet, aggregating them with the local ones.
+func (r *Reconciler) pollRemoteRecipes() {
+	for recipeName, remote := range r.remote {
+		if r.completed[recipeName] || r.finished[recipeName] {
+			continue
+		}
+
+		var incident Incident
+		err := federationRequest(
+			r.traceContext(), r.config, http.MethodGet, remote.Peer,
+			"/federation/executions/"+remote.UUID, nil, &incident,
+		)
+		if err != nil {
+			logger.Error(
+				"Failed to poll peer for recipe results",
+				zap.String("recipe", recipeName),
+				zap.String("peer", remote.Peer),
+				zap.Error(err),
+			)
+			continue
+		}
+		r.collectRemoteResult(recipeName, remote, &incident)
+	}
+}
+
+// Collect the result of a forwarded recipe from the incident reported by the peer reconciler.
+func (r *Reconciler) collectRemoteResult(
+	recipeName string, remote *remoteExecution, incident *Incident,
+) {
+	state, ok := incident.Recipes[recipeName]
+	if ok && state.State == RecipeStateCompleted && state.Status != "" {
+		var results RecipeResults
+		if state.Results != nil {
+			results = *state.Results
+		}
+		execution := NewRecipeExecution(recipeName, r.uuid, state.Status, results)
+		r.completeRecipe(NewCompletedRecipe(execution))
+		return
+	}
+
+	reason := fmt.Sprintf("Recipe did not complete on peer '%s'", remote.Peer)
+	switch {
+	case ok && state.State != RecipeStateRunning && state.State != RecipeStateWaiting:
+		if state.Error != "" {
+			reason = fmt.Sprintf("%s: %s", reason, state.Error)
+		}
+		r.finished[recipeName] = true
+		incidentRegistry.RecipeJobFinished(r.uuid, recipeName, RecipeStateFailed, reason)
+	case incident.State == IncidentStateCompleted || incident.State == IncidentStateFailed:
+		r.finished[recipeName] = true
+		incidentRegistry.RecipeJobFinished(r.uuid, recipeName, RecipeStateFailed, reason)
+	}
+}
+
+// Start the execution of a recipe forwarded by a peer reconciler. The results are collected by
+// the peer, so no messages are sent for the execution.
+func StartFederatedExecution(
+	ctx context.Context, config *Config, request FederatedExecution,
+) (string, error) {
+	requestType, err := parseRequestType(request.RequestType)
+	if err != nil {
+		return "", err
+	}
+	rc, err := getRecipeCatalog(config.ReconcilerNamespace)
+	if err != nil {
+		return "", err
+	}
+	recipe, ok := rc.Recipes(requestType, true)[request.Recipe]
+	if !ok {
+		return "", fmt.Errorf("%w: '%s' is not enabled", errRecipeNotFound, request.Recipe)
+	}
+	if recipe.Config.Peer != "" {
+		return "", fmt.Errorf("Recipe '%s' is itself forwarded to a peer", request.Recipe)
+	}
+
+	data := make(map[string]interface{}, len(request.Data)+1)
+	for k, v := range request.Data {
+		data[k] = v
+	}
+	executionUUID := newExecutionID(ctx)
+	data["uuid"] = executionUUID
+	data["federation"] = map[string]interface{}{"origin": request.Origin}
+
+	incidentRegistry.Register(executionUUID, requestType)
+	incidentRegistry.Update(executionUUID, func(incident *Incident) {
+		incident.Origin = request.Origin
+	})
+
+	recipes := map[string]Recipe{request.Recipe: recipe}
+	ctx = activeExecutions.Track(ctx, executionUUID)
+	reconciler, err := NewReconciler(ctx, config, &data, recipes, requestType)
+	if err != nil {
+		activeExecutions.Unregister(executionUUID)
+		incidentRegistry.Complete(executionUUID)
+		return "", err
+	}
+	reconciler.federated = true
+
+	cm, err := reconciler.createConfigMap(&data, recipeTarget(recipe.Config, config))
+	if err != nil {
+		reconciler.results.Close()
+		activeExecutions.Unregister(executionUUID)
+		incidentRegistry.Complete(executionUUID)
+		return "", err
+	}
+	reconciler.launchRecipe(request.Recipe, recipe, cm.Name)
+	go reconciler.Run()
+
+	logger.Info(
+		"Federated execution started",
+		zap.String("uuid", executionUUID),
+		zap.String("origin", request.Origin),
+		zap.String("recipe", request.Recipe),
+	)
+	return executionUUID, nil
+}
+
+// Authenticate the requests of peer reconcilers with the federation token. Federation is
+// disabled unless a token is configured.
+func requireFederationToken(config *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !validBearerToken(c, config.FederationToken) {
+			respondProblem(c, http.StatusUnauthorized, UnauthorizedProblem, "")
+			return
+		}
+		c.Next()
+	}
+}
+
+// Handle request from a peer reconciler to run a recipe on its behalf.
+func handleFederatedExecutionRequest(c *gin.Context, config *Config) {
+	var request FederatedExecution
+	if err := c.ShouldBindJSON(&request); err != nil {
+		logger.Error("Failed to parse JSON", zap.Error(err))
+		respondProblem(
+			c, http.StatusBadRequest, InvalidRequestProblem, "Invalid federated execution request",
+		)
+		return
+	}
+
+	executionUUID, err := StartFederatedExecution(
+		context.WithoutCancel(c.Request.Context()), config, request,
+	)
+	if err != nil {
+		logger.Error("Failed to start federated execution", zap.Error(err))
+		switch {
+		case errors.Is(err, errRecipeNotFound):
+			respondProblem(c, http.StatusNotFound, RecipeNotFoundProblem, err.Error())
+		case isQuotaExceeded(err):
+			respondProblem(c, http.StatusForbidden, QuotaExceededProblem, err.Error())
+		default:
+			respondProblem(c, http.StatusBadRequest, InvalidRequestProblem, err.Error())
+		}
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"uuid": executionUUID})
+}
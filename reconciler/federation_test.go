@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that federation peers are parsed from name=URL pairs.
+func TestParseFederationPeers(t *testing.T) {
+	peers, err := parseFederationPeers("eu-west=https://eu.example.com/, us-east=http://us:8081")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{
+		"eu-west": "https://eu.example.com",
+		"us-east": "http://us:8081",
+	}, peers)
+
+	peers, err = parseFederationPeers("")
+	assert.Nil(t, err)
+	assert.Empty(t, peers)
+
+	_, err = parseFederationPeers("eu-west")
+	assert.NotNil(t, err)
+}
+
+// Test that the federation API requires the federation token with the Bearer scheme, and is
+// disabled without one.
+func TestRequireFederationToken(t *testing.T) {
+	testCases := []struct {
+		name   string
+		token  string
+		header string
+		status int
+	}{
+		{"Disabled", "", "Bearer ", http.StatusUnauthorized},
+		{"MissingToken", "s3cr3t", "", http.StatusUnauthorized},
+		{"InvalidToken", "s3cr3t", "Bearer admin-secret", http.StatusUnauthorized},
+		{"MissingScheme", "s3cr3t", "s3cr3t", http.StatusUnauthorized},
+		{"ValidToken", "s3cr3t", "Bearer s3cr3t", http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET(
+				"/federation/executions/:uuid",
+				requireFederationToken(&Config{FederationToken: tc.token}),
+				func(c *gin.Context) { c.Status(http.StatusOK) },
+			)
+			req := httptest.NewRequest(http.MethodGet, "/federation/executions/remote-1", nil)
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tc.status, w.Code)
+		})
+	}
+}
+
+// Test that recipes are forwarded to peers, and that their remote results are aggregated.
+func TestForwardRecipe(t *testing.T) {
+	var forwarded FederatedExecution
+	router := gin.New()
+	peer := router.Group("/federation", requireFederationToken(&Config{FederationToken: "s3cr3t"}))
+	peer.POST("/executions", func(c *gin.Context) {
+		assert.Nil(t, c.BindJSON(&forwarded))
+		c.JSON(http.StatusAccepted, gin.H{"uuid": "remote-1"})
+	})
+	peer.GET("/executions/:uuid", func(c *gin.Context) {
+		assert.Equal(t, "remote-1", c.Param("uuid"))
+		c.JSON(http.StatusOK, Incident{
+			UUID:  "remote-1",
+			State: IncidentStateCompleted,
+			Recipes: map[string]*RecipeState{
+				"test-1-recipe": {
+					State:   RecipeStateCompleted,
+					Status:  "successful",
+					Results: &RecipeResults{Analysis: "remote analysis"},
+				},
+				"test-2-recipe": {State: RecipeStateFailed, Error: "quota exceeded"},
+			},
+		})
+	})
+	server := httptest.NewServer(router)
+	defer server.Close()
+	httpc = server.Client()
+
+	uuid := "federation-1"
+	incidentRegistry.Register(uuid, Alert)
+	recipe := Recipe{Config: &RecipeConfig{Peer: "eu-west"}}
+	r := &Reconciler{
+		uuid: uuid,
+		config: &Config{
+			FederationPeers: "eu-west=" + server.URL,
+			FederationToken: "s3cr3t",
+		},
+		recipes:     map[string]Recipe{"test-1-recipe": recipe, "test-2-recipe": recipe},
+		requestType: Alert,
+		jobs:        map[string]*recipeJob{},
+		finished:    map[string]bool{},
+		completed:   map[string]bool{},
+		remote:      map[string]*remoteExecution{},
+	}
+	data := map[string]interface{}{"uuid": uuid, "alertname": "HighErrorRate"}
+	r.forwardRecipe("test-1-recipe", recipe, data)
+	r.forwardRecipe("test-2-recipe", recipe, data)
+
+	assert.Equal(t, uuid, forwarded.Origin)
+	assert.Equal(t, "alert", forwarded.RequestType)
+	assert.Equal(t, "HighErrorRate", forwarded.Data["alertname"])
+	assert.Equal(t, &remoteExecution{Peer: "eu-west", UUID: "remote-1"}, r.remote["test-1-recipe"])
+
+	r.pollRemoteRecipes()
+	assert.True(t, r.completed["test-1-recipe"])
+	assert.Equal(t, "remote analysis", r.recipes["test-1-recipe"].Execution.Results.Analysis)
+	assert.Equal(t, uuid, r.recipes["test-1-recipe"].Execution.Incident)
+	assert.True(t, r.finished["test-2-recipe"])
+
+	incident, _ := incidentRegistry.Get(uuid)
+	assert.Equal(t, "eu-west/remote-1", incident.Recipes["test-2-recipe"].Job)
+	assert.Contains(t, incident.Recipes["test-2-recipe"].Error, "quota exceeded")
+
+	// Requests without the federation token are rejected
+	resp, err := http.Post(server.URL+"/federation/executions", "application/json", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, problemContentType, resp.Header.Get("Content-Type"))
+	var problem Problem
+	assert.Nil(t, json.NewDecoder(resp.Body).Decode(&problem))
+	assert.Equal(t, UnauthorizedProblem, problem.Code)
+}
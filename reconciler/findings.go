@@ -0,0 +1,115 @@
+package main
+
+import (
+	"slices"
+	"strings"
+)
+
+// Finding is a suggested action reported by one or more recipes of an execution, so that the
+// recipes suggesting the same action can still be traced once it is deduplicated.
+type Finding struct {
+	// Action as reported by the first recipe suggesting it
+	Action  string   `json:"action"`
+	Recipes []string `json:"recipes"`
+}
+
+// InformationalAnalysis is the analysis of a recipe whose results do not call for action, which
+// is reported separately from the actionable findings.
+type InformationalAnalysis struct {
+	Recipe   string `json:"recipe"`
+	Analysis string `json:"analysis"`
+}
+
+// Check whether a recipe completed successfully with results calling for action.
+func actionableRecipe(recipe Recipe) bool {
+	return recipe.Execution.Succeeded() && recipe.Execution.Results.IsActionable()
+}
+
+// Check whether any of the recipes of an execution calls for action.
+func actionableOutcome(completedRecipes []Recipe) bool {
+	return slices.ContainsFunc(completedRecipes, actionableRecipe)
+}
+
+// Collect the analyses of the successful recipes whose results are informational, in the order
+// they completed.
+func informationalAnalyses(completedRecipes []Recipe) []InformationalAnalysis {
+	var analyses []InformationalAnalysis
+	for _, recipe := range completedRecipes {
+		if !recipe.Execution.Succeeded() || actionableRecipe(recipe) {
+			continue
+		}
+		analyses = append(analyses, InformationalAnalysis{
+			Recipe:   recipe.Execution.Name,
+			Analysis: strings.TrimSpace(recipe.Execution.Results.Analysis),
+		})
+	}
+	return analyses
+}
+
+// Normalise a finding for comparison, ignoring case, repeated whitespace and trailing punctuation,
+// so that "Restart pod X." and "restart  pod x" are considered the same finding.
+func normalizeFinding(finding string) string {
+	normalized := strings.ToLower(strings.Join(strings.Fields(finding), " "))
+	return strings.TrimRight(normalized, ".;!")
+}
+
+// Merge the actions suggested by the successful recipes calling for action, in the order they
+// completed, keeping each distinct action once along with every recipe that suggested it.
+func aggregateFindings(completedRecipes []Recipe) []Finding {
+	var findings []Finding
+	indices := make(map[string]int)
+	for _, recipe := range completedRecipes {
+		if !actionableRecipe(recipe) {
+			continue
+		}
+		for _, action := range recipe.Execution.Results.Actions {
+			key := normalizeFinding(action)
+			if key == "" {
+				continue
+			}
+			i, ok := indices[key]
+			if !ok {
+				indices[key] = len(findings)
+				findings = append(findings, Finding{
+					Action:  strings.TrimSpace(action),
+					Recipes: []string{recipe.Execution.Name},
+				})
+				continue
+			}
+			findingsDeduplicated.Inc()
+			if !slices.Contains(findings[i].Recipes, recipe.Execution.Name) {
+				findings[i].Recipes = append(findings[i].Recipes, recipe.Execution.Name)
+			}
+		}
+	}
+	return findings
+}
+
+// Retrieve the actions of a set of findings.
+func findingActions(findings []Finding) []string {
+	var actions []string
+	for _, finding := range findings {
+		actions = append(actions, finding.Action)
+	}
+	return actions
+}
+
+// Merge the links reported by the recipes, keeping each distinct link once.
+func aggregateLinks(completedRecipes []Recipe) []string {
+	var links []string
+	seen := make(map[string]bool)
+	for _, recipe := range completedRecipes {
+		if recipe.Execution == nil {
+			continue
+		}
+		for _, link := range recipe.Execution.Results.Links {
+			link = strings.TrimSpace(link)
+			if link == "" || seen[link] {
+				continue
+			}
+			seen[link] = true
+			links = append(links, link)
+		}
+	}
+	return links
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Build a completed recipe from its results payload.
+func newCompletedRecipe(t *testing.T, payload string) Recipe {
+	recipe, err := (&Reconciler{}).parseRecipeResults(payload)
+	assert.Nil(t, err)
+	return recipe
+}
+
+// Test the normalisation of findings before comparison.
+func TestNormalizeFinding(t *testing.T) {
+	testCases := []struct {
+		finding  string
+		expected string
+	}{
+		{"Restart pod X", "restart pod x"},
+		{"  restart   pod\tX. ", "restart pod x"},
+		{"Scale up deployment!", "scale up deployment"},
+		{"", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.finding, func(t *testing.T) {
+			assert.Equal(t, tc.expected, normalizeFinding(tc.finding))
+		})
+	}
+}
+
+// Test that actions suggested by several recipes are listed once, along with their recipes.
+func TestAggregateFindings(t *testing.T) {
+	recipes := []Recipe{
+		newCompletedRecipe(t, `{"name": "pods", "status": "successful",
+			"results": {"actions": ["Restart pod X", "Check node Y"]}}`),
+		newCompletedRecipe(t, `{"name": "logs", "status": "successful",
+			"results": {"actions": ["restart  pod x.", "Restart pod X"]}}`),
+		newCompletedRecipe(t, `{"name": "events", "status": "failed",
+			"results": {"actions": ["Restart pod X", "Drain node Y"]}}`),
+		newCompletedRecipe(t, `{"name": "metrics", "status": "successful",
+			"results": {"actions": ["Scale up deployment Z", " "]}}`),
+	}
+
+	findings := aggregateFindings(recipes)
+	assert.Equal(t, []Finding{
+		{Action: "Restart pod X", Recipes: []string{"pods", "logs"}},
+		{Action: "Check node Y", Recipes: []string{"pods"}},
+		{Action: "Scale up deployment Z", Recipes: []string{"metrics"}},
+	}, findings)
+	assert.Equal(
+		t, []string{"Restart pod X", "Check node Y", "Scale up deployment Z"},
+		findingActions(findings),
+	)
+	assert.Nil(t, aggregateFindings(nil))
+}
+
+// Test that the analyses of recipes not calling for action are kept apart from the findings.
+func TestInformationalAnalyses(t *testing.T) {
+	recipes := []Recipe{
+		newCompletedRecipe(t, `{"name": "pods", "status": "successful",
+			"results": {"analysis": "Pod X restarted 5 times", "actions": ["Restart pod X"]}}`),
+		newCompletedRecipe(t, `{"name": "capacity", "status": "successful",
+			"results": {"analysis": " Nodes at 60% ", "actions": ["Add nodes"],
+			"actionable": false}}`),
+		newCompletedRecipe(t, `{"name": "events", "status": "failed",
+			"results": {"analysis": "No events", "actionable": false}}`),
+	}
+
+	assert.Equal(t, []Finding{
+		{Action: "Restart pod X", Recipes: []string{"pods"}},
+	}, aggregateFindings(recipes))
+	assert.Equal(t, []InformationalAnalysis{
+		{Recipe: "capacity", Analysis: "Nodes at 60%"},
+	}, informationalAnalyses(recipes))
+	assert.True(t, actionableOutcome(recipes))
+	assert.False(t, actionableOutcome(recipes[1:]))
+	assert.False(t, actionableOutcome(nil))
+}
+
+// Test that links reported by several recipes are listed once.
+func TestAggregateLinks(t *testing.T) {
+	recipes := []Recipe{
+		newCompletedRecipe(t, `{"name": "pods", "status": "successful",
+			"results": {"links": ["https://grafana/d/pods", "https://grafana/d/nodes"]}}`),
+		newCompletedRecipe(t, `{"name": "logs", "status": "successful",
+			"results": {"links": ["https://grafana/d/pods "]}}`),
+	}
+
+	assert.Equal(
+		t, []string{"https://grafana/d/pods", "https://grafana/d/nodes"}, aggregateLinks(recipes),
+	)
+}
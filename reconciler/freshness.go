@@ -0,0 +1,96 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ResultCache keeps the latest successful results of the recipes declaring a freshness window, so
+// that they can be reused instead of running the recipes again for the same alert.
+type ResultCache struct {
+	mutex   sync.Mutex
+	entries map[string]cachedResult
+}
+
+type cachedResult struct {
+	recipe  Recipe
+	expires time.Time
+}
+
+var freshResults = NewResultCache()
+
+// Initialise an empty result cache.
+func NewResultCache() *ResultCache {
+	return &ResultCache{entries: make(map[string]cachedResult)}
+}
+
+// Build the cache key of the results of a recipe for an alert, i.e. the recipe name along with the
+// fingerprint of the alert.
+func freshnessKey(recipeName string, alertData map[string]interface{}, config *Config) string {
+	return recipeName + "/" + alertFingerprint(alertData, config.DedupFields)
+}
+
+// Get the results stored under a key, if they are still fresh.
+func (rc *ResultCache) Get(key string) (Recipe, bool) {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	now := time.Now()
+	for k, entry := range rc.entries {
+		if now.After(entry.expires) {
+			delete(rc.entries, k)
+		}
+	}
+
+	entry, ok := rc.entries[key]
+	return entry.recipe, ok
+}
+
+// Store the results of a recipe under a key, for the duration of its freshness window.
+func (rc *ResultCache) Store(key string, recipe Recipe, window time.Duration) {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	rc.entries[key] = cachedResult{recipe: recipe, expires: time.Now().Add(window)}
+}
+
+// Get the freshness window of a recipe of the reconciler. Only the results of debugging recipes
+// are reused, as action recipes are expected to act every time they are requested.
+func (r *Reconciler) freshnessWindow(recipeName string) time.Duration {
+	recipe, ok := r.recipes[recipeName]
+	if r.requestType != Alert || !ok || recipe.Config == nil {
+		return 0
+	}
+	return recipe.Config.Freshness.Duration
+}
+
+// Complete a recipe with its stored results, if they are still fresh, instead of running it.
+func (r *Reconciler) reuseFreshResult(recipeName string) bool {
+	if r.freshnessWindow(recipeName) <= 0 {
+		return false
+	}
+	recipe, ok := freshResults.Get(freshnessKey(recipeName, *r.data, r.config))
+	if !ok {
+		return false
+	}
+
+	logger.Info(
+		"Reusing fresh recipe results",
+		zap.String("uuid", r.uuid),
+		zap.String("recipe", recipeName),
+		zap.String("incident", recipe.Execution.Incident),
+	)
+	recipe.Cached = true
+	r.completeRecipe(recipe)
+	return true
+}
+
+// Store the results of a recipe for reuse within its freshness window, if they are successful.
+func (r *Reconciler) storeFreshResult(recipe Recipe) {
+	window := r.freshnessWindow(recipe.Execution.Name)
+	if window <= 0 || !recipe.Execution.Succeeded() {
+		return
+	}
+	freshResults.Store(freshnessKey(recipe.Execution.Name, *r.data, r.config), recipe, window)
+}
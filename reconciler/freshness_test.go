@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Build a reconciler for an alert, with a recipe declaring the provided freshness window.
+func newFreshnessReconciler(
+	uuid string, requestType RequestType, freshness time.Duration,
+) *Reconciler {
+	return &Reconciler{
+		uuid:   uuid,
+		config: &Config{},
+		data: &map[string]interface{}{
+			"uuid":   uuid,
+			"labels": map[string]interface{}{"alertname": "HighErrorRate", "service": "orders"},
+		},
+		recipes: map[string]Recipe{
+			"diagnose": {Config: &RecipeConfig{Freshness: Duration{freshness}}},
+		},
+		requestType: requestType,
+		jobs:        make(map[string]*recipeJob),
+		completed:   make(map[string]bool),
+	}
+}
+
+// Test that results are only kept for the duration of their freshness window.
+func TestResultCache(t *testing.T) {
+	rc := NewResultCache()
+	recipe := Recipe{Attempts: 1}
+
+	rc.Store("diagnose/fresh", recipe, time.Minute)
+	rc.Store("diagnose/stale", recipe, -time.Second)
+
+	cached, ok := rc.Get("diagnose/fresh")
+	assert.True(t, ok)
+	assert.Equal(t, recipe, cached)
+	_, ok = rc.Get("diagnose/stale")
+	assert.False(t, ok)
+}
+
+// Test that the results of recipes are reused for the same alert within their freshness window.
+func TestReuseFreshResult(t *testing.T) {
+	previous := freshResults
+	freshResults = NewResultCache()
+	defer func() { freshResults = previous }()
+
+	// The first execution runs the recipe and stores its successful results
+	first := newFreshnessReconciler("fresh-1", Alert, 10*time.Minute)
+	incidentRegistry.Register(first.uuid, Alert)
+	assert.False(t, first.reuseFreshResult("diagnose"))
+	recipe, err := first.parseRecipeResults(
+		`{"name": "diagnose", "incident": "fresh-1", "status": "successful"}`,
+	)
+	assert.Nil(t, err)
+	first.completeRecipe(recipe)
+
+	// A flapping alert reuses the results, marked as cached
+	second := newFreshnessReconciler("fresh-2", Alert, 10*time.Minute)
+	incidentRegistry.Register(second.uuid, Alert)
+	assert.True(t, second.reuseFreshResult("diagnose"))
+	assert.True(t, second.completed["diagnose"])
+	assert.True(t, second.completedRecipes[0].Cached)
+	assert.Equal(t, "fresh-1", second.completedRecipes[0].Execution.Incident)
+	assert.Contains(t, second.getIncidentAnalysis(second.completedRecipes), "(cached result)")
+	incident, _ := incidentRegistry.Get(second.uuid)
+	assert.True(t, incident.Recipes["diagnose"].Cached)
+
+	// Other alerts, action recipes and recipes without a freshness window run again
+	other := newFreshnessReconciler("fresh-3", Alert, 10*time.Minute)
+	(*other.data)["labels"] = map[string]interface{}{"alertname": "HighLatency"}
+	assert.False(t, other.reuseFreshResult("diagnose"))
+	assert.False(t, newFreshnessReconciler("fresh-4", Actions, time.Minute).reuseFreshResult(
+		"diagnose",
+	))
+	assert.False(t, newFreshnessReconciler("fresh-5", Alert, 0).reuseFreshResult("diagnose"))
+}
+
+// Test that failed results are not reused.
+func TestStoreFreshResultFailed(t *testing.T) {
+	previous := freshResults
+	freshResults = NewResultCache()
+	defer func() { freshResults = previous }()
+
+	r := newFreshnessReconciler("fresh-failed", Alert, 10*time.Minute)
+	recipe, err := r.parseRecipeResults(`{"name": "diagnose", "status": "failed"}`)
+	assert.Nil(t, err)
+	r.storeFreshResult(recipe)
+	assert.False(t, r.reuseFreshResult("diagnose"))
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Time each dependency is given to respond to a health check.
+const healthCheckTimeout = 2 * time.Second
+
+// Statuses reported by the health endpoints.
+const (
+	HealthStatusOK          = "ok"
+	HealthStatusUnavailable = "unavailable"
+	HealthStatusDraining    = "draining"
+)
+
+// HealthReport is the response of the health endpoints, along with the outcome of each check.
+type HealthReport struct {
+	Status string        `json:"status"`
+	Checks []HealthCheck `json:"checks"`
+}
+
+// HealthCheck is the outcome of checking that a dependency of the reconciler is reachable.
+type HealthCheck struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+	Error   string `json:"error,omitempty"`
+}
+
+// dependency is a service the reconciler cannot work without.
+type dependency struct {
+	name  string
+	check func(context.Context) error
+}
+
+// Return the dependencies of the reconciler, i.e. Redis if any of the configured features rely on
+// it, and the Kubernetes API of each of the clusters recipes run in.
+func dependencies() []dependency {
+	var deps []dependency
+	if rdb != nil {
+		deps = append(deps, dependency{
+			name:  "redis",
+			check: func(ctx context.Context) error { return rdb.Ping(ctx).Err() },
+		})
+	}
+	if clientset != nil {
+		deps = append(deps, kubernetesDependency("kubernetes", clientset))
+	}
+	clusters := make([]string, 0, len(clusterClients))
+	for cluster := range clusterClients {
+		clusters = append(clusters, cluster)
+	}
+	sort.Strings(clusters)
+	for _, cluster := range clusters {
+		deps = append(deps, kubernetesDependency("kubernetes/"+cluster, clusterClients[cluster]))
+	}
+	return deps
+}
+
+// Build the check of the API server of a cluster, querying its health endpoint.
+func kubernetesDependency(name string, client kubernetes.Interface) dependency {
+	return dependency{
+		name: name,
+		check: func(ctx context.Context) error {
+			return client.Discovery().RESTClient().Get().AbsPath("/healthz").Do(ctx).Error()
+		},
+	}
+}
+
+// Check that the dependencies are reachable, reporting them as unavailable otherwise.
+func checkDependencies(ctx context.Context, deps []dependency) HealthReport {
+	report := HealthReport{Status: HealthStatusOK, Checks: make([]HealthCheck, 0, len(deps))}
+	for _, dep := range deps {
+		checkCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+		err := dep.check(checkCtx)
+		cancel()
+
+		check := HealthCheck{Name: dep.name, Healthy: err == nil}
+		if err != nil {
+			check.Error = err.Error()
+			report.Status = HealthStatusUnavailable
+		}
+		report.Checks = append(report.Checks, check)
+	}
+	return report
+}
+
+// Respond with a health report, failing unless everything is healthy.
+func respondHealth(c *gin.Context, report HealthReport) {
+	status := http.StatusOK
+	if report.Status != HealthStatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
+
+// Handle a liveness probe, which only checks that the reconciler is serving requests. Dependencies
+// are left to the readiness probe, as restarting the reconciler does not bring them back, while an
+// outage of a dependency would otherwise restart every replica at once.
+func handleHealthRequest(c *gin.Context) {
+	respondHealth(c, HealthReport{Status: HealthStatusOK, Checks: []HealthCheck{}})
+}
+
+// Handle a readiness probe, failing while any of the dependencies is unreachable, as well as once
+// the reconciler is shutting down, so that alerts are no longer routed to it.
+func handleReadinessRequest(c *gin.Context) {
+	report := checkDependencies(c.Request.Context(), dependencies())
+	if canary != nil {
+		report = canary.Check(report)
+	}
+	if drain.Draining() {
+		report.Status = HealthStatusDraining
+	}
+	respondHealth(c, report)
+}
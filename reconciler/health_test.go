@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that unreachable dependencies are reported as unavailable.
+func TestCheckDependencies(t *testing.T) {
+	healthy := dependency{name: "redis", check: func(context.Context) error { return nil }}
+	unhealthy := dependency{
+		name:  "kubernetes",
+		check: func(context.Context) error { return errors.New("connection refused") },
+	}
+
+	report := checkDependencies(context.Background(), []dependency{healthy})
+	assert.Equal(t, HealthReport{
+		Status: HealthStatusOK,
+		Checks: []HealthCheck{{Name: "redis", Healthy: true}},
+	}, report)
+
+	report = checkDependencies(context.Background(), []dependency{healthy, unhealthy})
+	assert.Equal(t, HealthReport{
+		Status: HealthStatusUnavailable,
+		Checks: []HealthCheck{
+			{Name: "redis", Healthy: true},
+			{Name: "kubernetes", Error: "connection refused"},
+		},
+	}, report)
+}
+
+// Test that the reconciler stops being ready once it is shutting down, while staying healthy.
+func TestHandleReadinessRequest(t *testing.T) {
+	d := useTestDrain(t)
+	// Only Redis is reachable in tests
+	previous := clientset
+	defer func() { clientset = previous }()
+	clientset = nil
+
+	router := gin.New()
+	router.GET("/healthz", handleHealthRequest)
+	router.GET("/readyz", handleReadinessRequest)
+
+	testCases := []struct {
+		path     string
+		draining bool
+		status   int
+		expected string
+	}{
+		{"/healthz", false, http.StatusOK, HealthStatusOK},
+		{"/readyz", false, http.StatusOK, HealthStatusOK},
+		{"/healthz", true, http.StatusOK, HealthStatusOK},
+		{"/readyz", true, http.StatusServiceUnavailable, HealthStatusDraining},
+	}
+
+	for _, tc := range testCases {
+		if tc.draining {
+			d.Start()
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+		assert.Equal(t, tc.status, w.Code, tc.path)
+		var report HealthReport
+		assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &report))
+		assert.Equal(t, tc.expected, report.Status, tc.path)
+	}
+}
+
+// Test that unreachable dependencies fail the readiness probe, but not the liveness probe, so that
+// an outage of a dependency does not restart the reconciler.
+func TestLivenessIgnoresDependencies(t *testing.T) {
+	previousClientset, previousRedis := clientset, rdb
+	defer func() { clientset, rdb = previousClientset, previousRedis }()
+	clientset = nil
+	rdb = redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	defer rdb.Close()
+
+	router := gin.New()
+	router.GET("/healthz", handleHealthRequest)
+	router.GET("/readyz", handleReadinessRequest)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	var report HealthReport
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Equal(t, HealthStatusUnavailable, report.Status)
+	assert.Equal(t, "redis", report.Checks[0].Name)
+}
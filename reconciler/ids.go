@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Supported formats of execution IDs.
+const (
+	UUIDIDFormat     = "uuid"
+	UUIDv7IDFormat   = "uuidv7"
+	ULIDIDFormat     = "ulid"
+	SequenceIDFormat = "sequence"
+)
+
+const (
+	idSequenceKeyPrefix = "euphrosyne:id-sequence:"
+	// How long the sequence of a day is kept, so that it outlives the day it numbers
+	idSequenceTTL = 48 * time.Hour
+	// Maximum length of the prefix of sequential IDs, keeping IDs within label value limits
+	maxIDPrefixLength = 32
+)
+
+// Prefixes of sequential IDs must be usable in Kubernetes label values and resource names.
+var idPrefixPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+// Crockford's Base32 alphabet, used by ULIDs.
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// IDGenerator generates the IDs identifying executions, which are also used to label their
+// recipe Jobs and ConfigMaps.
+type IDGenerator interface {
+	NewID(ctx context.Context) (string, error)
+}
+
+// Generator of execution IDs, random UUIDs unless configured otherwise.
+var idGenerator IDGenerator = uuidGenerator{}
+
+// Check whether an ID format is supported.
+func isValidIDFormat(format string) bool {
+	switch format {
+	case UUIDIDFormat, UUIDv7IDFormat, ULIDIDFormat, SequenceIDFormat:
+		return true
+	}
+	return false
+}
+
+// Check that a prefix of sequential IDs can be used in label values and resource names.
+func validateIDPrefix(prefix string) error {
+	if len(prefix) > maxIDPrefixLength || !idPrefixPattern.MatchString(prefix) {
+		return fmt.Errorf(
+			"Invalid ID prefix '%s', expected up to %d lowercase alphanumeric characters or '-'",
+			prefix, maxIDPrefixLength,
+		)
+	}
+	return nil
+}
+
+// Initialise the ID generator for the configured format.
+func NewIDGenerator(config *Config) IDGenerator {
+	switch config.IDFormat {
+	case UUIDv7IDFormat:
+		return uuidV7Generator{}
+	case ULIDIDFormat:
+		return ulidGenerator{}
+	case SequenceIDFormat:
+		return &sequenceGenerator{prefix: config.IDPrefix}
+	}
+	return uuidGenerator{}
+}
+
+// Generate the ID of a new execution, falling back to a random UUID if the configured generator
+// fails, so that executions are never dropped for lack of an ID.
+func newExecutionID(ctx context.Context) string {
+	id, err := idGenerator.NewID(ctx)
+	if err != nil {
+		logger.Warn("Failed to generate execution ID, using a random UUID", zap.Error(err))
+		return uuid.New().String()
+	}
+	return id
+}
+
+// uuidGenerator generates random (version 4) UUIDs.
+type uuidGenerator struct{}
+
+func (uuidGenerator) NewID(context.Context) (string, error) {
+	return uuid.New().String(), nil
+}
+
+// uuidV7Generator generates time-ordered (version 7) UUIDs.
+type uuidV7Generator struct{}
+
+func (uuidV7Generator) NewID(context.Context) (string, error) {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return "", err
+	}
+	return id.String(), nil
+}
+
+// ulidGenerator generates ULIDs, i.e. a millisecond timestamp followed by 80 random bits, encoded
+// in Crockford's Base32 so that they sort lexicographically by time.
+type ulidGenerator struct{}
+
+func (ulidGenerator) NewID(context.Context) (string, error) {
+	var id [16]byte
+	binary.BigEndian.PutUint64(id[:8], uint64(time.Now().UnixMilli())<<16)
+	if _, err := rand.Read(id[6:]); err != nil {
+		return "", err
+	}
+	return encodeULID(id), nil
+}
+
+// Encode the 128 bits of a ULID as 26 Base32 characters, the first one holding only 3 bits.
+func encodeULID(id [16]byte) string {
+	high := binary.BigEndian.Uint64(id[:8])
+	low := binary.BigEndian.Uint64(id[8:])
+
+	encoded := make([]byte, 26)
+	for i := 25; i >= 0; i-- {
+		encoded[i] = crockfordAlphabet[low&0x1f]
+		low = low>>5 | high<<59
+		high >>= 5
+	}
+	return string(encoded)
+}
+
+// sequenceGenerator generates IDs of the form `<prefix>-<date>-<seq>`, numbering the executions
+// of each day through a counter in Redis, so that IDs stay unique across restarts and replicas.
+type sequenceGenerator struct {
+	prefix string
+}
+
+func (g *sequenceGenerator) NewID(ctx context.Context) (string, error) {
+	date := time.Now().UTC().Format("20060102")
+	key := idSequenceKeyPrefix + g.prefix + ":" + date
+
+	pipe := rdb.TxPipeline()
+	seq := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, idSequenceTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s-%s-%d", g.prefix, date, seq.Val()), nil
+}
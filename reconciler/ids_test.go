@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// failingIDGenerator fails to generate IDs, e.g. because Redis is unavailable.
+type failingIDGenerator struct{}
+
+func (failingIDGenerator) NewID(context.Context) (string, error) {
+	return "", errors.New("Redis unavailable")
+}
+
+// Test that ULIDs are encoded in Crockford's Base32.
+func TestEncodeULID(t *testing.T) {
+	var id [16]byte
+	assert.Equal(t, "00000000000000000000000000", encodeULID(id))
+	id[15] = 0x21
+	assert.Equal(t, "00000000000000000000000011", encodeULID(id))
+	for i := range id {
+		id[i] = 0xff
+	}
+	assert.Equal(t, "7ZZZZZZZZZZZZZZZZZZZZZZZZZ", encodeULID(id))
+}
+
+// Test that time-ordered IDs sort by generation time and can be used as label values.
+func TestTimeOrderedIDs(t *testing.T) {
+	for _, generator := range []IDGenerator{uuidV7Generator{}, ulidGenerator{}} {
+		first, err := generator.NewID(context.Background())
+		assert.Nil(t, err)
+		time.Sleep(2 * time.Millisecond)
+		second, err := generator.NewID(context.Background())
+		assert.Nil(t, err)
+
+		assert.Less(t, first, second)
+		assert.Empty(t, validation.IsValidLabelValue(second))
+	}
+}
+
+// Test that the prefixes of sequential IDs are validated.
+func TestValidateIDPrefix(t *testing.T) {
+	testCases := []struct {
+		prefix string
+		valid  bool
+	}{
+		{"inc", true},
+		{"team-a", true},
+		{"", false},
+		{"INC", false},
+		{"inc-", false},
+		{"inc_1", false},
+		{"a-very-long-prefix-for-incident-ids", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.prefix, func(t *testing.T) {
+			assert.Equal(t, tc.valid, validateIDPrefix(tc.prefix) == nil)
+		})
+	}
+}
+
+// Test that executions fall back to random UUIDs if IDs cannot be generated.
+func TestNewExecutionID(t *testing.T) {
+	previous := idGenerator
+	defer func() { idGenerator = previous }()
+
+	idGenerator = NewIDGenerator(&Config{IDFormat: ULIDIDFormat})
+	assert.Len(t, newExecutionID(context.Background()), 26)
+
+	idGenerator = failingIDGenerator{}
+	assert.Len(t, newExecutionID(context.Background()), 36)
+}
@@ -0,0 +1,601 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// Supported backends for the incident registry.
+const (
+	MemoryIncidentStore = "memory"
+	RedisIncidentStore  = "redis"
+)
+
+// Incident states.
+const (
+	IncidentStateQueued          = "queued"
+	IncidentStatePendingApproval = "pendingApproval"
+	IncidentStateRunning         = "running"
+	IncidentStateCompleted       = "completed"
+	IncidentStateCancelled       = "cancelled"
+	IncidentStateFailed          = "failed"
+)
+
+// Recipe execution states.
+const (
+	RecipeStateWaiting   = "waiting"
+	RecipeStateRunning   = "running"
+	RecipeStateRetrying  = "retrying"
+	RecipeStateCompleted = "completed"
+	RecipeStateTimedOut  = "timedOut"
+	RecipeStateFailed    = "failed"
+	RecipeStateSkipped   = "skipped"
+	RecipeStateCancelled = "cancelled"
+)
+
+// Cleanup states.
+const (
+	CleanupStatePending   = "pending"
+	CleanupStateCompleted = "completed"
+	CleanupStateFailed    = "failed"
+)
+
+const incidentKeyPrefix = "euphrosyne:incident:"
+
+// Incident tracks the progress of a reconciler execution for an alert or an actions request.
+type Incident struct {
+	UUID        string                  `json:"uuid"`
+	RequestType string                  `json:"requestType"`
+	State       string                  `json:"state"`
+	CreatedAt   time.Time               `json:"createdAt"`
+	CompletedAt *time.Time              `json:"completedAt,omitempty"`
+	Recipes     map[string]*RecipeState `json:"recipes"`
+	Cleanup     CleanupState            `json:"cleanup"`
+	Error       string                  `json:"error,omitempty"`
+	Suppressed  int                     `json:"suppressed"`
+	Occurrences int                     `json:"occurrences"`
+	Messages    map[string]interface{}  `json:"messages,omitempty"`
+	Approval    *Approval               `json:"approval,omitempty"`
+	// UUID of the incident of the peer reconciler the execution was forwarded by, if any
+	Origin string `json:"origin,omitempty"`
+	// Report of the verification that ran once the alert of the incident resolved
+	Closure *ClosureReport `json:"closure,omitempty"`
+	// ChatOps thread following the progress of the incident, if any
+	Thread *ChatThread `json:"thread,omitempty"`
+	// Legal hold exempting the incident from deletion, if any
+	LegalHold *LegalHold `json:"legalHold,omitempty"`
+	// Acknowledgement of the incident by the people handling it
+	Ack Acknowledgement `json:"ack"`
+	// Fingerprint of the alert of the incident, matching it with the later executions of the alert
+	Fingerprint string `json:"fingerprint,omitempty"`
+	// Whether the incident is a canary self-test rather than a real alert
+	Canary bool `json:"canary,omitempty"`
+	// Compliance of the execution with the recipes required for its alert, if any
+	Compliance *Compliance `json:"compliance,omitempty"`
+}
+
+// RecipeState tracks the execution of a single recipe for an incident.
+type RecipeState struct {
+	State       string         `json:"state"`
+	Job         string         `json:"job,omitempty"`
+	Attempts    int            `json:"attempts,omitempty"`
+	StartedAt   time.Time      `json:"startedAt"`
+	CompletedAt *time.Time     `json:"completedAt,omitempty"`
+	Status      string         `json:"status,omitempty"`
+	Results     *RecipeResults `json:"results,omitempty"`
+	Cached      bool           `json:"cached,omitempty"`
+	Error       string         `json:"error,omitempty"`
+	DependsOn   []string       `json:"dependsOn,omitempty"`
+}
+
+// CleanupState tracks the cleanup of the resources created for an incident.
+type CleanupState struct {
+	State    string             `json:"state"`
+	Error    string             `json:"error,omitempty"`
+	Retained []RetainedResource `json:"retained,omitempty"`
+}
+
+// IncidentRegistry keeps track of the incidents handled by the reconciler, optionally persisting
+// them to Redis so that they outlive the reconciler process.
+type IncidentRegistry struct {
+	mutex     sync.RWMutex
+	incidents map[string]*Incident
+	persist   bool
+	retention time.Duration
+}
+
+var incidentRegistry = NewIncidentRegistry(MemoryIncidentStore, 24*time.Hour)
+
+// Initialise an incident registry with the specified backend and retention.
+func NewIncidentRegistry(store string, retention time.Duration) *IncidentRegistry {
+	return &IncidentRegistry{
+		incidents: make(map[string]*Incident),
+		persist:   store == RedisIncidentStore,
+		retention: retention,
+	}
+}
+
+// Check whether the provided incident store is supported.
+func isValidIncidentStore(store string) bool {
+	return store == MemoryIncidentStore || store == RedisIncidentStore
+}
+
+// Return the name of the request type.
+func (t RequestType) String() string {
+	switch t {
+	case Actions:
+		return "actions"
+	case Alert:
+		return "alert"
+	}
+	return fmt.Sprintf("RequestType(%d)", int(t))
+}
+
+// Register a new incident.
+func (ir *IncidentRegistry) Register(uuid string, requestType RequestType) {
+	incident := &Incident{
+		UUID:        uuid,
+		RequestType: requestType.String(),
+		State:       IncidentStateRunning,
+		CreatedAt:   time.Now().UTC(),
+		Recipes:     make(map[string]*RecipeState),
+		Cleanup:     CleanupState{State: CleanupStatePending},
+		Occurrences: 1,
+		Ack:         Acknowledgement{State: AckStateUnacked},
+	}
+
+	ir.mutex.Lock()
+	ir.pruneLocked()
+	ir.incidents[uuid] = incident
+	ir.mutex.Unlock()
+
+	ir.save(incident)
+	auditLog.Record(AuditIncidentRegistered, uuid, map[string]interface{}{
+		"requestType": requestType.String(),
+	})
+}
+
+// Register an incident whose execution is waiting in the execution queue.
+func (ir *IncidentRegistry) RegisterQueued(uuid string, requestType RequestType) {
+	ir.Register(uuid, requestType)
+	ir.Update(uuid, func(incident *Incident) {
+		incident.State = IncidentStateQueued
+	})
+}
+
+// Register an incident whose execution is starting, carrying over the incident registered while
+// the execution was queued.
+func (ir *IncidentRegistry) Start(uuid string, requestType RequestType) {
+	queued := false
+	ir.Update(uuid, func(incident *Incident) {
+		if incident.State == IncidentStateQueued {
+			incident.State = IncidentStateRunning
+			queued = true
+		}
+	})
+	if !queued {
+		ir.Register(uuid, requestType)
+	}
+}
+
+// Apply an update to a registered incident. Updates to unknown incidents are ignored.
+func (ir *IncidentRegistry) Update(uuid string, update func(*Incident)) {
+	ir.mutex.Lock()
+	incident, ok := ir.incidents[uuid]
+	if !ok {
+		ir.mutex.Unlock()
+		return
+	}
+	update(incident)
+	incidentCopy := copyIncident(incident)
+	ir.mutex.Unlock()
+
+	ir.save(incidentCopy)
+}
+
+// Load a persisted incident back into memory, so that it can be updated by a recovered
+// reconciler.
+func (ir *IncidentRegistry) Restore(uuid string) {
+	if !ir.persist {
+		return
+	}
+	incident, ok := ir.load(uuid)
+	if !ok {
+		return
+	}
+	ir.mutex.Lock()
+	ir.incidents[uuid] = incident
+	ir.mutex.Unlock()
+}
+
+// Retrieve an incident by UUID.
+func (ir *IncidentRegistry) Get(uuid string) (*Incident, bool) {
+	ir.mutex.RLock()
+	incident, ok := ir.incidents[uuid]
+	if ok {
+		incident = copyIncident(incident)
+	}
+	ir.mutex.RUnlock()
+
+	if ok || !ir.persist {
+		return incident, ok
+	}
+	return ir.load(uuid)
+}
+
+// List all known incidents, most recent first.
+func (ir *IncidentRegistry) List() []*Incident {
+	incidents := make(map[string]*Incident)
+	if ir.persist {
+		for _, incident := range ir.loadAll() {
+			incidents[incident.UUID] = incident
+		}
+	}
+
+	ir.mutex.RLock()
+	for uuid, incident := range ir.incidents {
+		incidents[uuid] = copyIncident(incident)
+	}
+	ir.mutex.RUnlock()
+
+	incidentList := make([]*Incident, 0, len(incidents))
+	for _, incident := range incidents {
+		incidentList = append(incidentList, incident)
+	}
+	sort.Slice(incidentList, func(i, j int) bool {
+		return incidentList[i].CreatedAt.After(incidentList[j].CreatedAt)
+	})
+	return incidentList
+}
+
+// Record that a recipe is waiting for the recipes it depends on to complete.
+func (ir *IncidentRegistry) RecipeWaiting(uuid string, recipeName string, dependsOn []string) {
+	ir.Update(uuid, func(incident *Incident) {
+		incident.Recipes[recipeName] = &RecipeState{
+			State:     RecipeStateWaiting,
+			DependsOn: dependsOn,
+		}
+	})
+}
+
+// Record that a recipe Job was launched for an incident.
+func (ir *IncidentRegistry) RecipeLaunched(
+	uuid string, recipeName string, jobName string, attempts int,
+) {
+	ir.Update(uuid, func(incident *Incident) {
+		startedAt := time.Now().UTC()
+		var dependsOn []string
+		if state, ok := incident.Recipes[recipeName]; ok {
+			dependsOn = state.DependsOn
+			if attempts > 1 {
+				startedAt = state.StartedAt
+			}
+		}
+		incident.Recipes[recipeName] = &RecipeState{
+			State:     RecipeStateRunning,
+			Job:       jobName,
+			Attempts:  attempts,
+			StartedAt: startedAt,
+			DependsOn: dependsOn,
+		}
+	})
+	auditLog.Record(AuditRecipeLaunched, uuid, map[string]interface{}{
+		"recipe":   recipeName,
+		"job":      jobName,
+		"attempts": attempts,
+	})
+}
+
+// Record that a failed recipe Job is going to be retried.
+func (ir *IncidentRegistry) RecipeRetrying(uuid string, recipeName string, attempts int) {
+	ir.Update(uuid, func(incident *Incident) {
+		if state, ok := incident.Recipes[recipeName]; ok {
+			state.State = RecipeStateRetrying
+			state.Attempts = attempts
+		}
+	})
+}
+
+// Record that a recipe Job could not be launched for an incident.
+func (ir *IncidentRegistry) RecipeFailed(uuid string, recipeName string, err error) {
+	ir.Update(uuid, func(incident *Incident) {
+		now := time.Now().UTC()
+		incident.Recipes[recipeName] = &RecipeState{
+			State:       RecipeStateFailed,
+			StartedAt:   now,
+			CompletedAt: &now,
+			Error:       err.Error(),
+		}
+	})
+	auditLog.Record(AuditRecipeFailed, uuid, map[string]interface{}{
+		"recipe": recipeName,
+		"error":  err.Error(),
+	})
+}
+
+// Record that a recipe Job finished without publishing its results.
+func (ir *IncidentRegistry) RecipeJobFinished(
+	uuid string, recipeName string, state string, reason string,
+) {
+	ir.Update(uuid, func(incident *Incident) {
+		now := time.Now().UTC()
+		recipeState, ok := incident.Recipes[recipeName]
+		if !ok {
+			recipeState = &RecipeState{StartedAt: now}
+			incident.Recipes[recipeName] = recipeState
+		}
+		recipeState.State = state
+		recipeState.CompletedAt = &now
+		recipeState.Error = reason
+	})
+	auditLog.Record(AuditRecipeFinished, uuid, map[string]interface{}{
+		"recipe": recipeName,
+		"state":  state,
+		"reason": reason,
+	})
+}
+
+// Record the results of a completed recipe.
+func (ir *IncidentRegistry) RecipeCompleted(uuid string, recipe Recipe) {
+	ir.Update(uuid, func(incident *Incident) {
+		now := time.Now().UTC()
+		state, ok := incident.Recipes[recipe.Execution.Name]
+		if !ok {
+			state = &RecipeState{StartedAt: now}
+			incident.Recipes[recipe.Execution.Name] = state
+		}
+		state.State = RecipeStateCompleted
+		state.CompletedAt = &now
+		state.Status = recipe.Execution.Status
+		results := recipe.Execution.Results
+		state.Results = &results
+		state.Cached = recipe.Cached
+	})
+	auditLog.Record(AuditRecipeFinished, uuid, map[string]interface{}{
+		"recipe": recipe.Execution.Name,
+		"state":  RecipeStateCompleted,
+		"status": recipe.Execution.Status,
+	})
+}
+
+// Mark all the recipes of an incident that are still running as timed out.
+func (ir *IncidentRegistry) RecipesTimedOut(uuid string) {
+	var timedOut []string
+	ir.Update(uuid, func(incident *Incident) {
+		now := time.Now().UTC()
+		for name, state := range incident.Recipes {
+			switch state.State {
+			case RecipeStateWaiting, RecipeStateRunning, RecipeStateRetrying:
+				state.State = RecipeStateTimedOut
+				state.CompletedAt = &now
+				timedOut = append(timedOut, name)
+			}
+		}
+	})
+	if len(timedOut) > 0 {
+		sort.Strings(timedOut)
+		auditLog.Record(AuditRecipesTimedOut, uuid, map[string]interface{}{
+			"recipes": timedOut,
+		})
+	}
+}
+
+// Record the outcome of the cleanup for an incident, along with the resources it retained.
+func (ir *IncidentRegistry) CleanupFinished(
+	uuid string, retained []RetainedResource, err error,
+) {
+	ir.Update(uuid, func(incident *Incident) {
+		incident.Cleanup.State = CleanupStateCompleted
+		incident.Cleanup.Retained = retained
+		if err != nil {
+			incident.Cleanup.State = CleanupStateFailed
+			incident.Cleanup.Error = err.Error()
+		}
+	})
+	details := map[string]interface{}{}
+	if err != nil {
+		details["error"] = err.Error()
+	}
+	if len(retained) > 0 {
+		details["retained"] = retained
+	}
+	auditLog.Record(AuditCleanupFinished, uuid, details)
+}
+
+// Record the state of the approval requested for the actions of an incident.
+func (ir *IncidentRegistry) ApprovalUpdated(uuid string, approval *Approval) {
+	approvalCopy := *approval
+	ir.Update(uuid, func(incident *Incident) {
+		incident.Approval = &approvalCopy
+		switch approval.State {
+		case ApprovalStatePending:
+			incident.State = IncidentStatePendingApproval
+		case ApprovalStateApproved:
+			incident.State = IncidentStateRunning
+		}
+	})
+	details := map[string]interface{}{"state": approval.State}
+	if approval.DecidedBy != "" {
+		details["decidedBy"] = approval.DecidedBy
+	}
+	if approval.Reason != "" {
+		details["reason"] = approval.Reason
+	}
+	auditLog.Record(AuditApprovalUpdated, uuid, details)
+}
+
+// Record an outbound message sent for an incident, so that templates can be previewed against it.
+func (ir *IncidentRegistry) RecordMessage(uuid string, destination string, message interface{}) {
+	ir.Update(uuid, func(incident *Incident) {
+		if incident.Messages == nil {
+			incident.Messages = make(map[string]interface{})
+		}
+		incident.Messages[destination] = message
+	})
+}
+
+// Record an occurrence of an alert that was suppressed in favour of an active incident.
+func (ir *IncidentRegistry) RecordSuppressed(uuid string) {
+	ir.Update(uuid, func(incident *Incident) {
+		incident.Suppressed++
+	})
+}
+
+// Record a duplicate occurrence of the alert that triggered an incident.
+func (ir *IncidentRegistry) RecordOccurrence(uuid string) {
+	ir.Update(uuid, func(incident *Incident) {
+		incident.Occurrences++
+	})
+}
+
+// Append the closure report of the verification of a resolved alert to its incident.
+func (ir *IncidentRegistry) RecordClosure(uuid string, report *ClosureReport) {
+	ir.Update(uuid, func(incident *Incident) {
+		incident.Closure = report
+	})
+	auditLog.Record(AuditIncidentClosed, uuid, map[string]interface{}{
+		"verification": report.Verification,
+		"status":       report.Status,
+	})
+}
+
+// Mark an incident as completed.
+func (ir *IncidentRegistry) Complete(uuid string) {
+	completed := false
+	ir.Update(uuid, func(incident *Incident) {
+		// Cancelled incidents keep their state once their execution winds down
+		if incident.State == IncidentStateCancelled {
+			return
+		}
+		now := time.Now().UTC()
+		incident.State = IncidentStateCompleted
+		incident.CompletedAt = &now
+		completed = true
+	})
+	if completed {
+		auditLog.Record(AuditIncidentCompleted, uuid, nil)
+	}
+}
+
+// Mark an incident as failed, when its execution could not start.
+func (ir *IncidentRegistry) Fail(uuid string, err error) {
+	ir.Update(uuid, func(incident *Incident) {
+		now := time.Now().UTC()
+		incident.State = IncidentStateFailed
+		incident.CompletedAt = &now
+		incident.Error = err.Error()
+	})
+	auditLog.Record(AuditIncidentFailed, uuid, map[string]interface{}{
+		"error": err.Error(),
+	})
+}
+
+// Mark an incident as cancelled, along with the recipes that are still running.
+func (ir *IncidentRegistry) Cancel(uuid string) {
+	ir.Update(uuid, func(incident *Incident) {
+		now := time.Now().UTC()
+		incident.State = IncidentStateCancelled
+		incident.CompletedAt = &now
+		for _, state := range incident.Recipes {
+			switch state.State {
+			case RecipeStateWaiting, RecipeStateRunning, RecipeStateRetrying:
+				state.State = RecipeStateCancelled
+				state.CompletedAt = &now
+			}
+		}
+	})
+	auditLog.Record(AuditIncidentCancelled, uuid, nil)
+}
+
+// Drop completed incidents older than the retention period from memory, unless they are under
+// legal hold. The caller must hold the registry lock.
+func (ir *IncidentRegistry) pruneLocked() {
+	cutoff := time.Now().Add(-ir.retention)
+	for uuid, incident := range ir.incidents {
+		if incident.LegalHold == nil && incident.CompletedAt != nil &&
+			incident.CompletedAt.Before(cutoff) {
+			delete(ir.incidents, uuid)
+		}
+	}
+}
+
+// Persist an incident to Redis, if enabled. Incidents under legal hold never expire.
+func (ir *IncidentRegistry) save(incident *Incident) {
+	if !ir.persist {
+		return
+	}
+	data, err := json.Marshal(incident)
+	if err != nil {
+		logger.Error(
+			"Failed to serialise incident", zap.String("uuid", incident.UUID), zap.Error(err),
+		)
+		return
+	}
+	expiration := ir.retention
+	if incident.LegalHold != nil {
+		expiration = 0
+	}
+	err = rdb.Set(context.TODO(), incidentKeyPrefix+incident.UUID, data, expiration).Err()
+	if err != nil {
+		logger.Error(
+			"Failed to persist incident", zap.String("uuid", incident.UUID), zap.Error(err),
+		)
+	}
+}
+
+// Load an incident from Redis.
+func (ir *IncidentRegistry) load(uuid string) (*Incident, bool) {
+	data, err := rdb.Get(context.TODO(), incidentKeyPrefix+uuid).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			logger.Error("Failed to load incident", zap.String("uuid", uuid), zap.Error(err))
+		}
+		return nil, false
+	}
+
+	var incident Incident
+	if err := json.Unmarshal(data, &incident); err != nil {
+		logger.Error("Failed to deserialise incident", zap.String("uuid", uuid), zap.Error(err))
+		return nil, false
+	}
+	return &incident, true
+}
+
+// Load all incidents from Redis.
+func (ir *IncidentRegistry) loadAll() []*Incident {
+	var incidents []*Incident
+	keys, err := scanKeys(context.TODO(), incidentKeyPrefix+"*")
+	if err != nil {
+		logger.Error("Failed to list incidents", zap.Error(err))
+	}
+	for _, key := range keys {
+		if incident, ok := ir.load(key[len(incidentKeyPrefix):]); ok {
+			incidents = append(incidents, incident)
+		}
+	}
+	return incidents
+}
+
+// Create a deep copy of an incident, so that it can be used outside the registry lock.
+func copyIncident(incident *Incident) *Incident {
+	incidentCopy := *incident
+	incidentCopy.Recipes = make(map[string]*RecipeState, len(incident.Recipes))
+	for name, state := range incident.Recipes {
+		stateCopy := *state
+		incidentCopy.Recipes[name] = &stateCopy
+	}
+	if incident.Messages != nil {
+		incidentCopy.Messages = make(map[string]interface{}, len(incident.Messages))
+		for destination, message := range incident.Messages {
+			incidentCopy.Messages[destination] = message
+		}
+	}
+	return &incidentCopy
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that the incident registry tracks the lifecycle of an incident.
+func TestIncidentRegistry(t *testing.T) {
+	ir := NewIncidentRegistry(MemoryIncidentStore, time.Hour)
+	ir.Register("incident-1", Alert)
+
+	incident, ok := ir.Get("incident-1")
+	assert.True(t, ok)
+	assert.Equal(t, "alert", incident.RequestType)
+	assert.Equal(t, IncidentStateRunning, incident.State)
+	assert.Equal(t, CleanupStatePending, incident.Cleanup.State)
+
+	ir.RecipeLaunched("incident-1", "test-1-recipe", "test-1-recipe-abcde", 1)
+	ir.RecipeLaunched("incident-1", "test-2-recipe", "test-2-recipe-fghij", 1)
+	ir.RecipeRetrying("incident-1", "test-2-recipe", 1)
+	ir.RecipeLaunched("incident-1", "test-2-recipe", "test-2-recipe-klmno", 2)
+	ir.RecipeFailed("incident-1", "test-3-recipe", errors.New("quota exceeded"))
+
+	recipe, err := (&Reconciler{}).parseRecipeResults(
+		`{"name": "test-1-recipe", "status": "successful", "results": {"analysis": "ok"}}`,
+	)
+	assert.Nil(t, err)
+	ir.RecipeCompleted("incident-1", recipe)
+	ir.RecipesTimedOut("incident-1")
+	retained := []RetainedResource{{Kind: "PersistentVolumeClaim", Name: "heap-dump"}}
+	ir.CleanupFinished("incident-1", retained, nil)
+	ir.Complete("incident-1")
+
+	incident, ok = ir.Get("incident-1")
+	assert.True(t, ok)
+	assert.Equal(t, IncidentStateCompleted, incident.State)
+	assert.NotNil(t, incident.CompletedAt)
+	assert.Equal(t, CleanupStateCompleted, incident.Cleanup.State)
+	assert.Equal(t, retained, incident.Cleanup.Retained)
+	assert.Equal(t, RecipeStateCompleted, incident.Recipes["test-1-recipe"].State)
+	assert.Equal(t, "successful", incident.Recipes["test-1-recipe"].Status)
+	assert.Equal(t, RecipeStateTimedOut, incident.Recipes["test-2-recipe"].State)
+	assert.Equal(t, 2, incident.Recipes["test-2-recipe"].Attempts)
+	assert.Equal(t, "test-2-recipe-klmno", incident.Recipes["test-2-recipe"].Job)
+	assert.Equal(t, RecipeStateFailed, incident.Recipes["test-3-recipe"].State)
+	assert.Equal(t, "quota exceeded", incident.Recipes["test-3-recipe"].Error)
+
+	// Incidents returned by the registry are copies
+	incident.Recipes["test-1-recipe"].State = RecipeStateRunning
+	incident, _ = ir.Get("incident-1")
+	assert.Equal(t, RecipeStateCompleted, incident.Recipes["test-1-recipe"].State)
+
+	// Updates to unknown incidents are ignored
+	ir.RecipeLaunched("unknown", "test-1-recipe", "test-1-recipe-klmno", 1)
+	_, ok = ir.Get("unknown")
+	assert.False(t, ok)
+
+	ir.Register("incident-2", Actions)
+	incidents := ir.List()
+	assert.Equal(t, 2, len(incidents))
+	assert.Equal(t, "incident-2", incidents[0].UUID)
+}
+
+// Test that incidents whose execution could not start are recorded as failed, and no longer
+// active.
+func TestIncidentRegistryFail(t *testing.T) {
+	ir := NewIncidentRegistry(MemoryIncidentStore, time.Hour)
+	ir.RegisterQueued("incident-1", Alert)
+	ir.Start("incident-1", Alert)
+	ir.Fail("incident-1", errors.New("catalog unavailable"))
+
+	incident, ok := ir.Get("incident-1")
+	assert.True(t, ok)
+	assert.Equal(t, IncidentStateFailed, incident.State)
+	assert.Equal(t, "catalog unavailable", incident.Error)
+	assert.NotNil(t, incident.CompletedAt)
+	assert.True(t, incidentEnded(incident.State))
+}
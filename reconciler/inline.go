@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Field of webhook and Actions requests holding an inline recipe definition.
+const inlineRecipeField = "recipe"
+
+var (
+	errInvalidRecipe    = errors.New("Invalid inline recipe")
+	errRecipeNotAllowed = errors.New("Inline recipe not allowed")
+
+	inlineRecipeNameRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+)
+
+// InlineRecipe is a one-off recipe defined in a request rather than in the recipe catalog.
+type InlineRecipe struct {
+	Name       string                       `json:"name"`
+	Image      string                       `json:"image"`
+	Entrypoint string                       `json:"entrypoint"`
+	Params     map[string]interface{}       `json:"params"`
+	Resources  *corev1.ResourceRequirements `json:"resources"`
+	Timeout    Duration                     `json:"timeout"`
+}
+
+// Parse the inline recipe of a request, if it defines one.
+func parseInlineRecipe(data map[string]interface{}) (*InlineRecipe, error) {
+	spec, ok := data[inlineRecipeField]
+	if !ok {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(spec)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", errInvalidRecipe, err)
+	}
+
+	// Reject anything beyond what inline recipes may configure, e.g. a service account
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.DisallowUnknownFields()
+	var recipe InlineRecipe
+	if err := decoder.Decode(&recipe); err != nil {
+		return nil, fmt.Errorf("%w: %s", errInvalidRecipe, err)
+	}
+	if recipe.Name == "" {
+		recipe.Name = "recipe"
+	}
+	if len(recipe.Name) > 40 || !inlineRecipeNameRegexp.MatchString(recipe.Name) {
+		return nil, fmt.Errorf("%w: invalid name '%s'", errInvalidRecipe, recipe.Name)
+	}
+	if recipe.Image == "" || recipe.Entrypoint == "" {
+		return nil, fmt.Errorf("%w: an image and an entrypoint are required", errInvalidRecipe)
+	}
+	return &recipe, nil
+}
+
+// Name of the inline recipe in the execution, set apart from the recipes of the catalog.
+func (ir *InlineRecipe) RecipeName() string {
+	return "inline-" + ir.Name
+}
+
+// Check an inline recipe against the policy for inline recipes. Inline recipes are only accepted
+// on authenticated endpoints, from allowed images and within the resource limits.
+func (ir *InlineRecipe) validate(config *Config, authModes string) error {
+	if !config.InlineRecipes {
+		return fmt.Errorf("%w: inline recipes are disabled", errRecipeNotAllowed)
+	}
+	if authModes == "" {
+		return fmt.Errorf("%w: the endpoint is not authenticated", errRecipeNotAllowed)
+	}
+
+	allowed := false
+	for _, prefix := range strings.Split(config.InlineRecipeImages, ",") {
+		prefix = strings.TrimSpace(prefix)
+		if prefix != "" && imageHasPrefix(ir.Image, prefix) {
+			allowed = true
+		}
+	}
+	if !allowed {
+		return fmt.Errorf("%w: image '%s' is not allowed", errRecipeNotAllowed, ir.Image)
+	}
+
+	timeout := config.RecipeTimeout
+	if ir.Timeout.Duration > timeout {
+		return fmt.Errorf(
+			"%w: timeout %s exceeds the recipe timeout", errRecipeNotAllowed, ir.Timeout,
+		)
+	}
+	if ir.Resources != nil {
+		maxResources := inlineRecipeMaxResources(config)
+		for _, list := range []corev1.ResourceList{ir.Resources.Requests, ir.Resources.Limits} {
+			for name, quantity := range list {
+				maxQuantity, ok := maxResources[name]
+				if !ok || quantity.Cmp(maxQuantity) > 0 {
+					return fmt.Errorf(
+						"%w: %s %s exceeds the limit", errRecipeNotAllowed, name, quantity.String(),
+					)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Check whether an image is under an allowed prefix, i.e. a registry, repository or image name.
+// The prefix must end at a path, tag or digest separator, so that a prefix does not also allow
+// the repositories whose names merely start with it.
+func imageHasPrefix(image string, prefix string) bool {
+	rest, ok := strings.CutPrefix(image, prefix)
+	if !ok {
+		return false
+	}
+	return rest == "" || strings.ContainsAny(prefix[len(prefix)-1:], "/:@") ||
+		strings.ContainsAny(rest[:1], "/:@")
+}
+
+// Build the recipe running an inline recipe. Its Job is always bounded by the resource limits and
+// the recipe timeout.
+func (ir *InlineRecipe) Recipe(config *Config) Recipe {
+	resources := corev1.ResourceRequirements{}
+	if ir.Resources != nil {
+		resources = *ir.Resources.DeepCopy()
+	}
+	if resources.Limits == nil {
+		resources.Limits = corev1.ResourceList{}
+	}
+	for name, quantity := range inlineRecipeMaxResources(config) {
+		if _, ok := resources.Limits[name]; !ok {
+			resources.Limits[name] = quantity
+		}
+	}
+
+	timeout := ir.Timeout
+	if timeout.Duration == 0 {
+		timeout.Duration = config.RecipeTimeout
+	}
+	return Recipe{Config: &RecipeConfig{
+		Enabled:     true,
+		Image:       ir.Image,
+		Entrypoint:  ir.Entrypoint,
+		Description: "Inline recipe defined in the request.",
+		Timeout:     timeout,
+		Resources:   &resources,
+	}}
+}
+
+// Validate the policy for inline recipes.
+func validateInlineRecipePolicy(config *Config) error {
+	for _, quantity := range []string{config.InlineRecipeMaxCPU, config.InlineRecipeMaxMemory} {
+		if _, err := resource.ParseQuantity(quantity); err != nil {
+			return fmt.Errorf("Invalid inline recipe resource limit '%s': %w", quantity, err)
+		}
+	}
+	if config.InlineRecipes && strings.TrimSpace(config.InlineRecipeImages) == "" {
+		return fmt.Errorf("Allowed images are required to accept inline recipes")
+	}
+	return nil
+}
+
+// Get the maximum resources of inline recipes. The limits are validated with the configuration.
+func inlineRecipeMaxResources(config *Config) corev1.ResourceList {
+	cpu, _ := resource.ParseQuantity(config.InlineRecipeMaxCPU)
+	memory, _ := resource.ParseQuantity(config.InlineRecipeMaxMemory)
+	return corev1.ResourceList{corev1.ResourceCPU: cpu, corev1.ResourceMemory: memory}
+}
+
+// Validate the inline recipe of a request against the policy, responding with a problem if it is
+// rejected.
+func checkInlineRecipe(
+	c *gin.Context, data map[string]interface{}, config *Config, authModes string,
+	requestType RequestType,
+) bool {
+	if problem := validateInlineRecipe(data, config, authModes, requestType); problem != nil {
+		respondWithProblem(c, *problem)
+		return false
+	}
+	return true
+}
+
+// Validate the inline recipe of a request against the policy, returning the problem to reject the
+// request with, if any. Action requests run the inline recipe as an additional action, with its
+// parameters as the action data.
+func validateInlineRecipe(
+	data map[string]interface{}, config *Config, authModes string, requestType RequestType,
+) *Problem {
+	inline, err := parseInlineRecipe(data)
+	if err == nil && inline != nil {
+		err = inline.validate(config, authModes)
+	}
+	switch {
+	case errors.Is(err, errRecipeNotAllowed):
+		logger.Warn("Rejecting inline recipe", zap.Error(err))
+		problem := newProblem(http.StatusForbidden, RecipeNotAllowedProblem, err.Error())
+		return &problem
+	case err != nil:
+		problem := newProblem(http.StatusBadRequest, InvalidRecipeProblem, err.Error())
+		return &problem
+	case inline == nil:
+		return nil
+	}
+
+	logger.Info(
+		"Inline recipe accepted",
+		zap.String("recipe", inline.RecipeName()),
+		zap.String("image", inline.Image),
+	)
+	if requestType == Actions {
+		params := inline.Params
+		if params == nil {
+			params = map[string]interface{}{}
+		}
+		actions, _ := data["actions"].([]interface{})
+		data["actions"] = append(actions, map[string]interface{}{
+			"name": inline.RecipeName(),
+			"data": params,
+		})
+	}
+	return nil
+}
+
+// Get the recipes of an execution, i.e. the enabled recipes of the catalog along with the inline
+// recipe of the request, if any. Alerts raised for node problems only run the recipes of their
+// node problem rule.
+func executionRecipes(
+	config *Config, data *map[string]interface{}, requestType RequestType,
+) (map[string]Recipe, *RecipeCatalog, error) {
+	rc, err := getRecipeCatalog(config.ReconcilerNamespace)
+	if err != nil {
+		return nil, nil, err
+	}
+	recipes := rc.Recipes(requestType, true)
+	if requestType == Alert {
+		recipes = nodeProblemRecipes(recipes, *data)
+		recipes = verificationRecipes(recipes, *data)
+		recipes = scheduledRecipes(rc, recipes, *data)
+		recipes = routeRecipes(recipes, *data)
+	}
+
+	inline, err := parseInlineRecipe(*data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if inline != nil {
+		recipes[inline.RecipeName()] = inline.Recipe(config)
+	}
+	return recipes, rc, nil
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Parse an inline recipe from its JSON definition.
+func parseTestInlineRecipe(t *testing.T, spec string) (*InlineRecipe, error) {
+	var data map[string]interface{}
+	assert.Nil(t, json.Unmarshal([]byte(`{"recipe": `+spec+`}`), &data))
+	return parseInlineRecipe(data)
+}
+
+// Test that inline recipes are parsed, rejecting anything they may not configure.
+func TestParseInlineRecipe(t *testing.T) {
+	testCases := []struct {
+		name  string
+		spec  string
+		valid bool
+	}{
+		{
+			name:  "Valid",
+			spec:  `{"name": "netcheck", "image": "tools/netcheck:1", "entrypoint": "netcheck"}`,
+			valid: true,
+		},
+		{
+			name:  "DefaultName",
+			spec:  `{"image": "tools/netcheck:1", "entrypoint": "netcheck"}`,
+			valid: true,
+		},
+		{
+			name: "UnknownField",
+			spec: `{"image": "tools/netcheck:1", "entrypoint": "netcheck",
+				"serviceAccount": "admin"}`,
+		},
+		{
+			name: "InvalidName",
+			spec: `{"name": "Net_Check", "image": "tools/netcheck:1", "entrypoint": "netcheck"}`,
+		},
+		{
+			name: "MissingImage",
+			spec: `{"entrypoint": "netcheck"}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recipe, err := parseTestInlineRecipe(t, tc.spec)
+			if !tc.valid {
+				assert.ErrorIs(t, err, errInvalidRecipe)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Contains(t, recipe.RecipeName(), "inline-")
+		})
+	}
+
+	recipe, err := parseInlineRecipe(map[string]interface{}{"alertname": "HighErrorRate"})
+	assert.Nil(t, err)
+	assert.Nil(t, recipe)
+}
+
+// Test that inline recipes are validated against the policy.
+func TestValidateInlineRecipe(t *testing.T) {
+	config := &Config{
+		RecipeTimeout:         5 * time.Minute,
+		InlineRecipes:         true,
+		InlineRecipeImages:    "registry.example.com/tools/, tools/",
+		InlineRecipeMaxCPU:    "500m",
+		InlineRecipeMaxMemory: "512Mi",
+	}
+	testCases := []struct {
+		name      string
+		spec      string
+		config    Config
+		authModes string
+		allowed   bool
+	}{
+		{
+			name:      "Allowed",
+			spec:      `{"image": "tools/netcheck:1", "entrypoint": "netcheck", "timeout": "5m"}`,
+			config:    *config,
+			authModes: TokenAuthMode,
+			allowed:   true,
+		},
+		{
+			name:      "Disabled",
+			spec:      `{"image": "tools/netcheck:1", "entrypoint": "netcheck"}`,
+			config:    Config{InlineRecipeImages: "tools/"},
+			authModes: TokenAuthMode,
+		},
+		{
+			name:   "Unauthenticated",
+			spec:   `{"image": "tools/netcheck:1", "entrypoint": "netcheck"}`,
+			config: *config,
+		},
+		{
+			name:      "ImageNotAllowed",
+			spec:      `{"image": "evil/miner:1", "entrypoint": "mine"}`,
+			config:    *config,
+			authModes: TokenAuthMode,
+		},
+		{
+			name:      "TimeoutExceeded",
+			spec:      `{"image": "tools/netcheck:1", "entrypoint": "netcheck", "timeout": "1h"}`,
+			config:    *config,
+			authModes: TokenAuthMode,
+		},
+		{
+			name: "ResourcesExceeded",
+			spec: `{"image": "tools/netcheck:1", "entrypoint": "netcheck",
+				"resources": {"limits": {"memory": "1Gi"}}}`,
+			config:    *config,
+			authModes: TokenAuthMode,
+		},
+		{
+			name: "UnlimitedResource",
+			spec: `{"image": "tools/netcheck:1", "entrypoint": "netcheck",
+				"resources": {"limits": {"nvidia.com/gpu": "1"}}}`,
+			config:    *config,
+			authModes: TokenAuthMode,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recipe, err := parseTestInlineRecipe(t, tc.spec)
+			assert.Nil(t, err)
+			err = recipe.validate(&tc.config, tc.authModes)
+			if tc.allowed {
+				assert.Nil(t, err)
+			} else {
+				assert.ErrorIs(t, err, errRecipeNotAllowed)
+			}
+		})
+	}
+}
+
+// Test that image prefixes only match at a path, tag or digest separator.
+func TestImageHasPrefix(t *testing.T) {
+	for image, allowed := range map[string]bool{
+		"registry.example.com/recipes":               true,
+		"registry.example.com/recipes/netcheck:1":    true,
+		"registry.example.com/recipes:1":             true,
+		"registry.example.com/recipes@sha256:abcdef": true,
+		"registry.example.com/recipes-evil/miner:1":  false,
+		"registry.example.com/other/netcheck:1":      false,
+	} {
+		assert.Equal(t, allowed, imageHasPrefix(image, "registry.example.com/recipes"), image)
+	}
+	assert.True(t, imageHasPrefix("tools/netcheck:1", "tools/"))
+	assert.False(t, imageHasPrefix("toolsevil/netcheck:1", "tools"))
+}
+
+// Test that the Jobs of inline recipes are bounded by the resource limits and the recipe timeout.
+func TestInlineRecipeConfig(t *testing.T) {
+	config := &Config{
+		RecipeTimeout:         5 * time.Minute,
+		InlineRecipeMaxCPU:    "500m",
+		InlineRecipeMaxMemory: "512Mi",
+	}
+	recipe, err := parseTestInlineRecipe(t, `{"image": "tools/netcheck:1", "entrypoint": "netcheck",
+		"resources": {"limits": {"memory": "256Mi"}}}`)
+	assert.Nil(t, err)
+
+	recipeConfig := recipe.Recipe(config).Config
+	assert.True(t, recipeConfig.Enabled)
+	assert.Equal(t, 300*time.Second, recipeConfig.Timeout.Duration)
+	assert.Equal(t, corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse("500m"),
+		corev1.ResourceMemory: resource.MustParse("256Mi"),
+	}, recipeConfig.Resources.Limits)
+}
+
+// Test that inline recipes of Actions requests run as an additional action.
+func TestCheckInlineRecipe(t *testing.T) {
+	config := &Config{
+		RecipeTimeout:         5 * time.Minute,
+		InlineRecipes:         true,
+		InlineRecipeImages:    "tools/",
+		InlineRecipeMaxCPU:    "500m",
+		InlineRecipeMaxMemory: "512Mi",
+	}
+	data := map[string]interface{}{
+		"uuid": "inline-1",
+		"recipe": map[string]interface{}{
+			"name":       "netcheck",
+			"image":      "tools/netcheck:1",
+			"entrypoint": "netcheck",
+			"params":     map[string]interface{}{"host": "db"},
+		},
+	}
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	assert.True(t, checkInlineRecipe(c, data, config, TokenAuthMode, Actions))
+	actions, err := parseActionData(&data)
+	assert.Nil(t, err)
+	assert.Equal(t, []Action{
+		{Name: "inline-netcheck", Data: map[string]interface{}{"host": "db"}},
+	}, actions)
+
+	// Rejected inline recipes are answered with a problem
+	recorder := httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/actions", nil)
+	assert.False(t, checkInlineRecipe(c, data, config, "", Actions))
+	assert.Equal(t, http.StatusForbidden, recorder.Code)
+	var problem Problem
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &problem))
+	assert.Equal(t, RecipeNotAllowedProblem, problem.Code)
+}
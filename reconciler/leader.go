@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// Timings of the leader election, as recommended by client-go.
+const (
+	leaseDuration = 15 * time.Second
+	renewDeadline = 10 * time.Second
+	retryPeriod   = 2 * time.Second
+)
+
+// Header identifying the standby replica that forwarded a request to the leader. Forwarded
+// requests are never forwarded again.
+const forwardedByHeader = "X-Euphrosyne-Forwarded-By"
+
+// Leadership reports whether this replica is the leader, i.e. the one launching recipes and
+// cleaning up after them, along with the identity of the current leader.
+type Leadership struct {
+	mutex    sync.RWMutex
+	identity string
+	leader   string
+	// Namespace of the replicas, and the IP of the Pod of the current leader once looked up
+	namespace string
+	leaderIP  string
+}
+
+// Resolve the URL requests are forwarded to the leader at, replaced in tests.
+var resolveLeaderURL = leaderPodURL
+
+// Leadership of this replica, which always leads unless leader election is enabled.
+var leadership = &Leadership{}
+
+// Check whether this replica is the leader.
+func (l *Leadership) IsLeader() bool {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	return l.leader == l.identity
+}
+
+// Return the identity of the current leader, if known.
+func (l *Leadership) Leader() string {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	return l.leader
+}
+
+// Record the identity of the current leader.
+func (l *Leadership) setLeader(leader string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.leader != leader {
+		l.leaderIP = ""
+	}
+	l.leader = leader
+	isLeader.Set(boolToFloat(l.leader == l.identity))
+}
+
+// Look up the IP of the Pod of the leader, which is identified by its Pod name.
+func (l *Leadership) leaderPodIP(ctx context.Context, leader string) (string, error) {
+	l.mutex.RLock()
+	ip, namespace := l.leaderIP, l.namespace
+	if l.leader != leader {
+		ip = ""
+	}
+	l.mutex.RUnlock()
+	if ip != "" {
+		return ip, nil
+	}
+
+	pod, err := clientset.CoreV1().Pods(namespace).Get(ctx, leader, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	if pod.Status.PodIP == "" {
+		return "", fmt.Errorf("The Pod of leader '%s' has no IP", leader)
+	}
+	l.mutex.Lock()
+	if l.leader == leader {
+		l.leaderIP = pod.Status.PodIP
+	}
+	l.mutex.Unlock()
+	return pod.Status.PodIP, nil
+}
+
+// Determine the identity of this replica in the leader election, i.e. its Pod name.
+func leaderIdentity() (string, error) {
+	if name := os.Getenv("POD_NAME"); name != "" {
+		return name, nil
+	}
+	return os.Hostname()
+}
+
+// Take part in the leader election through a Lease in the Reconciler namespace, running the
+// provided function once this replica becomes the leader. Replicas that lose the leadership exit,
+// so that they restart as standby while the new leader recovers their in-flight executions.
+func RunLeaderElection(ctx context.Context, config *Config, lead func(context.Context)) error {
+	identity, err := leaderIdentity()
+	if err != nil {
+		return fmt.Errorf("Failed to determine leader election identity: %w", err)
+	}
+	leadership.mutex.Lock()
+	leadership.identity = identity
+	leadership.namespace = config.ReconcilerNamespace
+	leadership.leader = ""
+	leadership.mutex.Unlock()
+	isLeader.Set(0)
+
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      config.LeaderElectionLease,
+			Namespace: config.ReconcilerNamespace,
+		},
+		Client:     clientset.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+	}
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:          lock,
+		LeaseDuration: leaseDuration,
+		RenewDeadline: renewDeadline,
+		RetryPeriod:   retryPeriod,
+		Name:          config.LeaderElectionLease,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				logger.Info("Started leading", zap.String("identity", identity))
+				lead(ctx)
+			},
+			OnStoppedLeading: func() {
+				leadership.setLeader("")
+				logger.Fatal("Lost leadership, restarting as standby")
+			},
+			OnNewLeader: func(leader string) {
+				logger.Info("New leader elected", zap.String("leader", leader))
+				leadership.setLeader(leader)
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	elector.Run(ctx)
+	return nil
+}
+
+// Middleware forwarding the requests that start or change executions from standby replicas, which
+// only serve read-only requests, to the leader. As the Service of the Reconciler spreads requests
+// across replicas, webhooks would otherwise be rejected by standby replicas. Requests that cannot
+// be forwarded, e.g. while no leader is elected, are rejected.
+func requireLeader() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if leadership.IsLeader() {
+			c.Next()
+			return
+		}
+		leader := leadership.Leader()
+		if leader != "" && c.GetHeader(forwardedByHeader) == "" {
+			target, err := resolveLeaderURL(c, leader)
+			if err == nil {
+				forwardToLeader(c, target)
+				return
+			}
+			logger.Warn(
+				"Failed to resolve the address of the leader",
+				zap.String("leader", leader),
+				zap.Error(err),
+			)
+			leaderForwards.WithLabelValues("failed").Inc()
+		}
+		respondNotLeader(c)
+	}
+}
+
+// Proxy a request to the leader, rejecting it if the leader cannot be reached.
+func forwardToLeader(c *gin.Context, target *url.URL) {
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		logger.Warn(
+			"Failed to forward request to the leader",
+			zap.String("url", target.String()),
+			zap.Error(err),
+		)
+		leaderForwards.WithLabelValues("failed").Inc()
+		respondNotLeader(c)
+	}
+	leadership.mutex.RLock()
+	c.Request.Header.Set(forwardedByHeader, leadership.identity)
+	leadership.mutex.RUnlock()
+	proxy.ServeHTTP(c.Writer, c.Request)
+	if !c.IsAborted() {
+		leaderForwards.WithLabelValues("forwarded").Inc()
+	}
+	c.Abort()
+}
+
+// Build the URL of the leader from the IP of its Pod and the port the request was received on, as
+// replicas serve the same ports. Requests received over TLS are not forwarded, as the certificate
+// of the leader is not issued for its Pod IP.
+func leaderPodURL(c *gin.Context, leader string) (*url.URL, error) {
+	if c.Request.TLS != nil {
+		return nil, fmt.Errorf("Requests received over TLS are not forwarded")
+	}
+	local, ok := c.Request.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	if !ok {
+		return nil, fmt.Errorf("The local address of the request is unknown")
+	}
+	_, port, err := net.SplitHostPort(local.String())
+	if err != nil {
+		return nil, err
+	}
+	ip, err := leadership.leaderPodIP(c.Request.Context(), leader)
+	if err != nil {
+		return nil, err
+	}
+	return &url.URL{Scheme: "http", Host: net.JoinHostPort(ip, port)}, nil
+}
+
+// Reject a request that only the leader can serve, pointing to the leader.
+func respondNotLeader(c *gin.Context) {
+	problem := newProblem(
+		http.StatusServiceUnavailable, NotLeaderProblem,
+		"This replica is on standby, send the request to the leader",
+	)
+	problem.Extensions = map[string]interface{}{"leader": leadership.Leader()}
+	respondWithProblem(c, problem)
+}
+
+// Convert a boolean into a gauge value.
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
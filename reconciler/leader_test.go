@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that requests changing executions are only served by the leader.
+func TestRequireLeader(t *testing.T) {
+	testCases := []struct {
+		name     string
+		identity string
+		leader   string
+		status   int
+	}{
+		{"ElectionDisabled", "", "", http.StatusOK},
+		{"Leader", "reconciler-0", "reconciler-0", http.StatusOK},
+		{"Standby", "reconciler-1", "reconciler-0", http.StatusServiceUnavailable},
+		{"NoLeader", "reconciler-1", "", http.StatusServiceUnavailable},
+	}
+
+	previous, previousResolve := leadership, resolveLeaderURL
+	defer func() { leadership, resolveLeaderURL = previous, previousResolve }()
+	resolveLeaderURL = func(*gin.Context, string) (*url.URL, error) {
+		return nil, errors.New("leader unreachable")
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			leadership = &Leadership{identity: tc.identity}
+			leadership.setLeader(tc.leader)
+
+			router := gin.New()
+			router.POST("/webhook", requireLeader(), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/webhook", nil))
+
+			assert.Equal(t, tc.status, w.Code)
+			if tc.status != http.StatusOK {
+				var problem map[string]interface{}
+				assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &problem))
+				assert.Equal(t, NotLeaderProblem, problem["code"])
+				assert.Equal(t, tc.leader, problem["leader"])
+			}
+		})
+	}
+}
+
+// Test that standby replicas forward requests changing executions to the leader, unless they were
+// already forwarded or the leader cannot be reached.
+func TestForwardToLeader(t *testing.T) {
+	leader := func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Forwarded-By", r.Header.Get(forwardedByHeader))
+		w.WriteHeader(http.StatusAccepted)
+		w.Write(body)
+	}
+	leaderServer := httptest.NewServer(http.HandlerFunc(leader))
+	defer leaderServer.Close()
+	leaderURL, _ := url.Parse(leaderServer.URL)
+
+	previous, previousResolve := leadership, resolveLeaderURL
+	defer func() { leadership, resolveLeaderURL = previous, previousResolve }()
+	leadership = &Leadership{identity: "reconciler-1"}
+	leadership.setLeader("reconciler-0")
+	resolveLeaderURL = func(_ *gin.Context, leader string) (*url.URL, error) {
+		assert.Equal(t, "reconciler-0", leader)
+		return leaderURL, nil
+	}
+
+	// The proxy needs a real connection, rather than a response recorder
+	router := gin.New()
+	router.POST("/webhook", requireLeader(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	standbyServer := httptest.NewServer(router)
+	defer standbyServer.Close()
+
+	response, err := http.Post(
+		standbyServer.URL+"/webhook", "application/json", strings.NewReader(`{"alerts": []}`),
+	)
+	assert.Nil(t, err)
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	assert.Equal(t, http.StatusAccepted, response.StatusCode)
+	assert.Equal(t, `{"alerts": []}`, string(body))
+	assert.Equal(t, "reconciler-1", response.Header.Get("X-Forwarded-By"))
+
+	// Requests are only forwarded once
+	request, _ := http.NewRequest(http.MethodPost, standbyServer.URL+"/webhook", nil)
+	request.Header.Set(forwardedByHeader, "reconciler-2")
+	response, err = http.DefaultClient.Do(request)
+	assert.Nil(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, response.StatusCode)
+
+	leaderServer.Close()
+	response, err = http.Post(standbyServer.URL+"/webhook", "application/json", nil)
+	assert.Nil(t, err)
+	var problem map[string]interface{}
+	assert.Nil(t, json.NewDecoder(response.Body).Decode(&problem))
+	response.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, response.StatusCode)
+	assert.Equal(t, NotLeaderProblem, problem["code"])
+}
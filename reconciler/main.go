@@ -16,9 +16,9 @@ import (
 )
 
 var (
-	clientset *kubernetes.Clientset
+	clientset kubernetes.Interface
 	httpc     *http.Client
-	rdb       *redis.Client
+	rdb       redis.UniversalClient
 	logger    *zap.Logger
 )
 
@@ -59,27 +59,105 @@ func getHTTPClient() *http.Client {
 }
 
 func connectRedis(config *Config) {
-	rdb = redis.NewClient(&redis.Options{
-		Addr:     config.RedisAddress,
-		Password: "",
-		DB:       0,
-	})
-	_, err := rdb.Ping(context.Background()).Result()
+	var err error
+	rdb, err = newRedisClient(config)
 	if err != nil {
 		panic(err)
 	}
-	logger.Info("Redis connected successfully", zap.String("redisAddress", config.RedisAddress))
+	rdb.AddHook(redisMetricsHook{})
+	_, err = rdb.Ping(context.Background()).Result()
+	if err != nil {
+		panic(err)
+	}
+	logger.Info(
+		"Redis connected successfully",
+		zap.String("redisAddress", config.RedisAddress),
+		zap.String("redisMode", config.RedisMode),
+	)
+}
+
+// Check whether any of the configured features rely on Redis.
+func needsRedis(config *Config) bool {
+	return config.ResultBroker == RedisResultBroker ||
+		config.IncidentStore == RedisIncidentStore ||
+		config.ApprovalTimeout > 0 ||
+		config.IDFormat == SequenceIDFormat
+}
+
+// Start the work only the leader performs, i.e. recovering in-flight executions, raising alerts
+// from Prometheus queries and node problems, running scheduled recipes, exporting compliance
+// records and purging expired data.
+func startLeading(ctx context.Context, config *Config) {
+	// The intake may have been paused or resumed through the previous leader
+	if config.LeaderElection {
+		if err := LoadIntakeState(config.ReconcilerNamespace); err != nil {
+			logger.Warn("Failed to load the state of the alert intake", zap.Error(err))
+		}
+		executionQueue.Release()
+	}
+	go RecoverExecutions(ctx, config)
+	if config.PrometheusURL != "" {
+		poller := NewPoller(config)
+		go poller.Run(ctx, config.PollInterval)
+	}
+	if nodeProblemWatcher != nil {
+		go nodeProblemWatcher.Run(ctx)
+	}
+	go NewScheduler(config).Run(ctx, scheduleCheckInterval)
+	if canary != nil {
+		go canary.Run(ctx, config.CanaryInterval)
+	}
+	if debugSessions != nil {
+		go debugSessions.Run(ctx, debugSessionSweepInterval)
+	}
+	if statusReporter != nil {
+		go statusReporter.Run(ctx, config.StatusInterval)
+	}
+	if complianceExporter != nil {
+		go complianceExporter.Run(ctx, config.ExportInterval)
+	}
+	if janitor != nil {
+		go janitor.Run(ctx, config.JanitorInterval)
+	}
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "cleanup" {
+		os.Exit(runCleanupCommand(os.Args[2:], os.Stdout))
+	}
+	initLogger()
 	config, err := ParseConfig(os.Args[1:])
 	if err != nil {
-		panic(fmt.Sprintf("Failed to parse config: %s", err))
+		// Printed as is, as the errors of the configuration span several lines
+		fmt.Fprintf(os.Stderr, "Failed to parse config: %s\n", err)
+		os.Exit(1)
 	}
 	httpc = getHTTPClient()
-	initLogger()
+	shutdownTracing, err := initTracing(&config)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to initialise tracing: %s", err))
+	}
 
-	connectRedis(&config)
+	if needsRedis(&config) {
+		connectRedis(&config)
+	}
+	resultBroker, err = NewResultBroker(&config)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to connect to result broker: %s", err))
+	}
+	defer resultBroker.Close()
+	subscriptionRegistry = NewSubscriptionRegistry(config.MaxSubscriptions)
+	go subscriptionRegistry.Run(context.Background(), subscriptionReapInterval)
+	idGenerator = NewIDGenerator(&config)
+	chatOps = NewChatOps(&config)
+	suppressAckedNotifications = config.SuppressAckedNotifications
+	if config.SchemaDriftSamples > 0 {
+		alertSchemas = NewAlertSchemas(config.SchemaDriftSamples)
+	}
+	aggregationPipeline = NewAggregationPipeline(&config)
+	incidentRegistry = NewIncidentRegistry(
+		config.IncidentStore, config.IncidentRetention,
+	)
 
 	// Create a channel for graceful shutdown signal
 	shutdownChan := make(chan os.Signal, 1)
@@ -101,10 +179,142 @@ func main() {
 		)
 	}
 
+	for _, namespace := range overrideNamespaces(&config) {
+		if err := CheckNamespaceAccess(clientset, namespace); err != nil {
+			panic(fmt.Sprintf(
+				"The Reconciler doesn't have the necessary permissions in the override namespace"+
+					" '%s': %s",
+				namespace, err,
+			))
+		}
+	}
+
+	if err := InitialiseClusterClients(&config); err != nil {
+		panic(fmt.Sprintf("Failed to initialise the clients of the recipe clusters: %s", err))
+	}
+
+	if err := CheckCleanupAccess(clientset, &config); err != nil {
+		panic(fmt.Sprintf("The Reconciler cannot apply the cleanup policy: %s", err))
+	}
+
+	if _, err := ReloadRecipeCatalog(config.ReconcilerNamespace); err != nil {
+		logger.Warn("Failed to load recipe catalog, will retry on demand", zap.Error(err))
+	}
+	if err := LoadMessageTemplates(config.ReconcilerNamespace); err != nil {
+		panic(fmt.Sprintf("Failed to load message templates: %s", err))
+	}
+	if err := LoadRoutes(&config); err != nil {
+		panic(fmt.Sprintf("Failed to load routes: %s", err))
+	}
+	if config.WatchConfig {
+		if err := CheckConfigWatchAccess(clientset, config.ReconcilerNamespace); err != nil {
+			panic(fmt.Sprintf("The Reconciler cannot watch its configuration: %s", err))
+		}
+		go NewConfigWatcher(&config, os.Args[1:]).Run(context.Background())
+	}
+	if config.Events {
+		if err := CheckEventsAccess(clientset, &config); err != nil {
+			panic(fmt.Sprintf("The Reconciler cannot record Events: %s", err))
+		}
+		incidentEvents = NewIncidentEvents(clientset, config.ReconcilerNamespace)
+		go incidentEvents.Run(context.Background())
+	}
+	if config.DebugSessions {
+		if err := CheckDebugSessionAccess(clientset, &config); err != nil {
+			panic(fmt.Sprintf("The Reconciler cannot spawn debugging sessions: %s", err))
+		}
+		debugSessions = NewDebugSessions(clientset, &config)
+	}
+	if config.CloudEventsSink != "" {
+		cloudEvents, err = NewCloudEvents(&config)
+		if err != nil {
+			panic(fmt.Sprintf("Failed to initialise CloudEvents export: %s", err))
+		}
+		go cloudEvents.Run(context.Background())
+	}
+	if config.ResultStore != "" {
+		resultStore, err = NewResultStore(
+			context.Background(), config.ResultStore, config.ResultStoreEndpoint,
+		)
+		if err != nil {
+			panic(fmt.Sprintf("Failed to initialise result store: %s", err))
+		}
+	}
+	if config.NodeProblems {
+		if err := CheckNodeAccess(clientset); err != nil {
+			panic(fmt.Sprintf("The Reconciler cannot watch node problems: %s", err))
+		}
+		nodeProblemWatcher = NewNodeProblemWatcher(&config)
+	}
+	if config.AdminToken != "" {
+		if err := CheckIntakeAccess(clientset, config.ReconcilerNamespace); err != nil {
+			panic(fmt.Sprintf("The Reconciler cannot persist the state of the intake: %s", err))
+		}
+	}
+	if config.StatusConfigMap != "" {
+		if err := CheckStatusAccess(clientset, config.ReconcilerNamespace); err != nil {
+			panic(fmt.Sprintf("The Reconciler cannot update its status ConfigMap: %s", err))
+		}
+		statusReporter = NewStatusReporter(clientset, &config)
+	}
+	if err := LoadIntakeState(config.ReconcilerNamespace); err != nil {
+		logger.Warn("Failed to load the state of the alert intake", zap.Error(err))
+	}
+	executionQueue = NewExecutionQueue(&config)
+	if config.Canary {
+		canary = NewCanary(&config)
+	}
+
+	if config.ExportInterval > 0 {
+		complianceExporter, err = NewExporter(&config)
+		if err != nil {
+			panic(fmt.Sprintf("Failed to initialise compliance export: %s", err))
+		}
+	}
+	if j := NewJanitor(&config, resultStore, complianceExporter); j.Enabled() {
+		janitor = j
+	}
+
+	// Standby replicas only serve read-only requests until they are elected
+	if config.LeaderElection {
+		if err := CheckLeaseAccess(clientset, config.ReconcilerNamespace); err != nil {
+			panic(fmt.Sprintf("The Reconciler cannot take part in leader election: %s", err))
+		}
+		go func() {
+			err := RunLeaderElection(context.Background(), &config, func(ctx context.Context) {
+				startLeading(ctx, &config)
+			})
+			if err != nil {
+				panic(fmt.Sprintf("Failed to run leader election: %s", err))
+			}
+		}()
+	} else {
+		startLeading(context.Background(), &config)
+	}
 	go StartAlertHandler(&config)
 	go StartServer(&config)
 
 	<-shutdownChan
 	logger.Info("Shutting down...")
+	Shutdown(&config)
+	if cloudEvents != nil {
+		flushCtx, cancel := context.WithTimeout(context.Background(), cloudEventsFlushTimeout)
+		cloudEvents.Flush(flushCtx)
+		cancel()
+	}
+	// Only the leader exports, so that the records are not exported by every replica
+	if complianceExporter != nil && leadership.IsLeader() {
+		if err := complianceExporter.Export(context.Background()); err != nil {
+			logger.Error("Failed to export compliance records", zap.Error(err))
+		}
+	}
+	if resultStore != nil {
+		if err := resultStore.Close(); err != nil {
+			logger.Error("Failed to close result store", zap.Error(err))
+		}
+	}
+	if err := shutdownTracing(context.Background()); err != nil {
+		logger.Error("Failed to flush traces", zap.Error(err))
+	}
 	_ = logger.Sync()
 }
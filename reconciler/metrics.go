@@ -0,0 +1,431 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const metricsNamespace = "euphrosyne"
+
+var (
+	alertsReceived = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "alerts_received_total",
+		Help:      "Number of alerts received on the webhook.",
+	})
+	authFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "auth_failures_total",
+		Help:      "Number of requests rejected as unauthenticated, by endpoint and mode.",
+	}, []string{"endpoint", "mode"})
+	alertsSuppressed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "alerts_suppressed_total",
+		Help:      "Number of alerts suppressed by a cooldown, by alert name.",
+	}, []string{"alertname"})
+	alertsDeduplicated = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "alerts_deduplicated_total",
+		Help:      "Number of alerts attached to an existing incident within the dedup window.",
+	})
+	batchAlerts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "batch_alerts_total",
+		Help:      "Number of alerts received in batches, by outcome.",
+	}, []string{"outcome"})
+	recipesLaunched = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "recipes_launched_total",
+		Help:      "Number of recipe Jobs launched, by recipe.",
+	}, []string{"recipe"})
+	recipeLaunchFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "recipe_launch_failures_total",
+		Help:      "Number of recipe Jobs that could not be launched, by recipe.",
+	}, []string{"recipe"})
+	recipeJobFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "recipe_job_failures_total",
+		Help:      "Number of recipes whose Jobs failed after exhausting their retries, by recipe.",
+	}, []string{"recipe"})
+	recipeResults = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "recipe_results_total",
+		Help:      "Number of recipe results received, by recipe and reported status.",
+	}, []string{"recipe", "status"})
+	recipeDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "recipe_duration_seconds",
+		Help:      "Time from launching a recipe Job until its results are received, by recipe.",
+		Buckets:   []float64{1, 5, 10, 30, 60, 120, 300, 600, 1200},
+	}, []string{"recipe"})
+	recipeResultsReused = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "recipe_results_reused_total",
+		Help:      "Number of fresh recipe results reused instead of running recipes, by recipe.",
+	}, []string{"recipe"})
+	recipeResultFallbacks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "recipe_result_fallbacks_total",
+		Help:      "Number of recipe results read from Job termination messages, by recipe.",
+	}, []string{"recipe"})
+	resultTransformFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "result_transform_failures_total",
+		Help:      "Number of recipe results kept as reported after failing to be transformed.",
+	}, []string{"recipe"})
+	recipeResultsRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "recipe_results_rejected_total",
+		Help:      "Number of recipe results failing validation, by recipe and schema.",
+	}, []string{"recipe", "schema"})
+	recipeTimeouts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "recipe_timeouts_total",
+		Help:      "Number of recipes that failed to report results in time, by recipe.",
+	}, []string{"recipe"})
+	redisCommandDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "redis_command_duration_seconds",
+		Help:      "Latency of the Redis commands issued by the reconciler, by command.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"command"})
+	redisMessagesReceived = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "redis_messages_received_total",
+		Help:      "Number of recipe result messages received from Redis.",
+	})
+	redisReceiveDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "redis_receive_duration_seconds",
+		Help:      "Time from receiving a recipe result from Redis until it is collected.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+	})
+	cleanupFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "cleanup_failures_total",
+		Help:      "Number of failed attempts to clean up recipe resources, by resource.",
+	}, []string{"resource"})
+	chatOpsFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "chatops_failures_total",
+		Help:      "Number of failed posts to incident threads, by operation (thread, reply).",
+	}, []string{"operation"})
+	canaryRuns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "canary_runs_total",
+		Help:      "Number of canary self-tests, by result (passed, failed).",
+	}, []string{"result"})
+	canaryHealthy = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "canary_healthy",
+		Help:      "Whether the latest canary self-test passed (1) or failed (0).",
+	})
+	alertSchemaDrifts = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "alert_schema_drifts",
+		Help: "Number of typical fields missing from the latest alerts of each source, " +
+			"by whether recipes depend on them.",
+	}, []string{"source", "breaking"})
+	alertsSchemaDrifted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "alerts_schema_drifted_total",
+		Help:      "Number of alerts missing typical fields of their source, by source.",
+	}, []string{"source"})
+	debugSessionEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "debug_sessions_total",
+		Help:      "Number of debugging sessions, by event (created, failed, deleted, expired).",
+	}, []string{"event"})
+	executionCompliance = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "execution_compliance_total",
+		Help: "Number of executions subject to required recipe rules, by rule and status " +
+			"(compliant, noncompliant).",
+	}, []string{"rule", "status"})
+	batchCleanupResources = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "batch_cleanup_resources_total",
+		Help: "Number of resources of past executions removed by the batch cleanup, " +
+			"by kind and outcome (deleted, failed).",
+	}, []string{"kind", "outcome"})
+	statusSyncs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "status_syncs_total",
+		Help:      "Number of updates of the status ConfigMap, by outcome (updated, failed).",
+	}, []string{"outcome"})
+	cloudEventsEmitted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "cloudevents_total",
+		Help:      "Number of execution CloudEvents, by outcome (delivered, failed, dropped).",
+	}, []string{"outcome"})
+	canaryDuration = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "canary_duration_seconds",
+		Help:      "Duration of the latest canary self-test.",
+	})
+	ackUpdates = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "ack_updates_total",
+		Help:      "Number of acknowledgement updates of incidents, by state and source.",
+	}, []string{"state", "source"})
+	ackedNotificationsSuppressed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "acked_notifications_suppressed_total",
+		Help:      "Number of notifications held back for acknowledged alerts, by kind.",
+	}, []string{"kind"})
+	catalogShardSize = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "recipe_catalog_shard_size_bytes",
+		Help:      "Size of the ConfigMaps holding the recipe catalog, by ConfigMap.",
+	}, []string{"configmap"})
+	exportedRecords = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "exported_records_total",
+		Help:      "Number of records exported to the compliance store, by kind.",
+	}, []string{"kind"})
+	exportFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "export_failures_total",
+		Help:      "Number of failed compliance exports.",
+	})
+	pollerEvaluations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "poller_evaluations_total",
+		Help:      "Number of PromQL query evaluations by the poller, by alert name.",
+	}, []string{"alertname"})
+	pollerFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "poller_evaluation_failures_total",
+		Help:      "Number of failed PromQL query evaluations by the poller, by alert name.",
+	}, []string{"alertname"})
+	pollerAlerts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "poller_alerts_total",
+		Help:      "Number of alerts triggered by PromQL queries crossing their threshold.",
+	}, []string{"alertname"})
+	scheduledRuns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "scheduled_runs_total",
+		Help:      "Number of runs of scheduled recipes triggered.",
+	}, []string{"recipe"})
+	scheduledRunFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "scheduled_run_failures_total",
+		Help:      "Number of runs of scheduled recipes that could not be submitted.",
+	}, []string{"recipe"})
+	nodeProblemsDetected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "node_problems_detected_total",
+		Help:      "Number of problems that appeared on nodes, by node condition.",
+	}, []string{"condition"})
+	resultStoreFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "result_store_failures_total",
+		Help:      "Number of incident records that could not be written to the result store.",
+	})
+	eventsDropped = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "events_dropped_total",
+		Help:      "Number of incident milestones dropped before being recorded as Events.",
+	})
+	eventFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "event_failures_total",
+		Help:      "Number of incident milestones whose status could not be reported.",
+	})
+	retentionPurged = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "retention_purged_total",
+		Help:      "Number of records deleted by the retention policies, by kind of data.",
+	}, []string{"kind"})
+	retentionFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "retention_failures_total",
+		Help:      "Number of failed purges of expired data, by kind of data.",
+	}, []string{"kind"})
+	verificationsCompleted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "verifications_completed_total",
+		Help:      "Number of verifications of resolved alerts, by outcome.",
+	}, []string{"status"})
+	configReloadFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "config_reload_failures_total",
+		Help:      "Number of invalid configuration changes rejected, by configuration source.",
+	}, []string{"source"})
+	isLeader = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "leader",
+		Help:      "Whether this replica is the leader launching recipes (1) or on standby (0).",
+	})
+	leaderForwards = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "leader_forwarded_requests_total",
+		Help:      "Requests forwarded by a standby replica to the leader, by outcome.",
+	}, []string{"outcome"})
+	findingsDeduplicated = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "findings_deduplicated_total",
+		Help:      "Number of duplicate suggested actions merged when aggregating recipe results.",
+	})
+	intakePaused = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "intake_paused",
+		Help:      "Whether the alert intake is paused through the admin API (1) or open (0).",
+	})
+	alertsPaused = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "alerts_paused_total",
+		Help:      "Number of webhook requests rejected while the alert intake is paused.",
+	})
+	incidentStreamClients = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "incident_stream_clients",
+		Help:      "Number of clients streaming the progress of incidents.",
+	})
+	openSubscriptions = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "result_subscriptions_open",
+		Help:      "Number of open subscriptions to recipe results.",
+	})
+	oldestSubscriptionAge = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "result_subscription_oldest_age_seconds",
+		Help:      "Age of the oldest open subscription to recipe results, as of the last check.",
+	})
+	subscriptionsReaped = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "result_subscriptions_reaped_total",
+		Help:      "Number of result subscriptions torn down for outliving their execution.",
+	})
+	subscriptionsRejected = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "result_subscriptions_rejected_total",
+		Help:      "Number of executions rejected as the limit of open subscriptions was reached.",
+	})
+	routeRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "route_requests_total",
+		Help:      "Number of requests received on each configured route.",
+	}, []string{"route"})
+	sinkDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "sink_deliveries_total",
+		Help:      "Number of incident analyses delivered to each sink, by outcome.",
+	}, []string{"sink", "outcome"})
+	sinkCircuitOpen = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "sink_circuit_open",
+		Help:      "Whether deliveries to each sink are skipped after consecutive failures.",
+	}, []string{"sink"})
+	resultResubscriptions = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "result_resubscriptions_total",
+		Help:      "Number of Redis result subscriptions restored after losing their connection.",
+	})
+	shuttingDown = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "shutting_down",
+		Help:      "Whether the reconciler is draining its executions before shutting down.",
+	})
+	executionsSuspended = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "executions_suspended_total",
+		Help:      "Number of executions suspended on shutdown, to be resumed by another replica.",
+	})
+	queueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "execution_queue_depth",
+		Help:      "Number of executions waiting for capacity to start.",
+	})
+	runningExecutions = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "executions_running",
+		Help:      "Number of executions currently running.",
+	})
+	workerPoolSize = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "execution_workers",
+		Help:      "Number of workers running recipe executions.",
+	})
+	workerPoolSaturation = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "execution_workers_saturation",
+		Help:      "Share of the workers busy running executions, from 0 to 1.",
+	})
+	queueWait = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "execution_queue_wait_seconds",
+		Help:      "Time executions waited in the queue before starting.",
+		Buckets:   []float64{0.1, 1, 5, 10, 30, 60, 120, 300, 600},
+	})
+	executionsRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "executions_rejected_total",
+		Help:      "Number of executions rejected by the overflow policy, by request type.",
+	}, []string{"type"})
+)
+
+// Label of the recipes outside of the catalog, e.g. recipe names reported by result messages.
+const otherRecipeLabel = "other"
+
+// Return the label of a recipe for the metrics. The recipe names reported by result messages are
+// not trusted, so only the recipes of the catalog have their own label, keeping the cardinality of
+// the metrics bounded.
+func recipeLabel(recipeName string) string {
+	catalogMutex.RLock()
+	rc := catalog
+	catalogMutex.RUnlock()
+
+	if rc != nil {
+		if _, ok := rc.Debugging[recipeName]; ok {
+			return recipeName
+		}
+		if _, ok := rc.Actions[recipeName]; ok {
+			return recipeName
+		}
+	}
+	return otherRecipeLabel
+}
+
+// Return the label of a recipe status for the metrics, i.e. the status if supported.
+func recipeStatusLabel(status string) string {
+	if validateRecipeStatus(status) != nil {
+		return RecipeStatusUnknown
+	}
+	return status
+}
+
+type redisStartKey struct{}
+
+// redisMetricsHook records the latency of Redis commands.
+type redisMetricsHook struct{}
+
+func (redisMetricsHook) BeforeProcess(ctx context.Context, _ redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, redisStartKey{}, time.Now()), nil
+}
+
+func (redisMetricsHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	if start, ok := ctx.Value(redisStartKey{}).(time.Time); ok {
+		redisCommandDuration.WithLabelValues(cmd.Name()).Observe(time.Since(start).Seconds())
+	}
+	return nil
+}
+
+func (redisMetricsHook) BeforeProcessPipeline(
+	ctx context.Context, _ []redis.Cmder,
+) (context.Context, error) {
+	return context.WithValue(ctx, redisStartKey{}, time.Now()), nil
+}
+
+func (redisMetricsHook) AfterProcessPipeline(ctx context.Context, _ []redis.Cmder) error {
+	if start, ok := ctx.Value(redisStartKey{}).(time.Time); ok {
+		redisCommandDuration.WithLabelValues("pipeline").Observe(time.Since(start).Seconds())
+	}
+	return nil
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// Replace the recipe catalog with one holding a debugging and an action recipe.
+func useMetricsCatalog(t *testing.T) {
+	catalogMutex.Lock()
+	previous := catalog
+	catalog = &RecipeCatalog{
+		Debugging: map[string]RecipeConfig{"logs": {Enabled: true}},
+		Actions:   map[string]RecipeConfig{"restart": {Enabled: true}},
+	}
+	catalogMutex.Unlock()
+	t.Cleanup(func() {
+		catalogMutex.Lock()
+		catalog = previous
+		catalogMutex.Unlock()
+	})
+}
+
+// Test that only the recipes of the catalog and the supported statuses have their own labels.
+func TestRecipeLabels(t *testing.T) {
+	useMetricsCatalog(t)
+	assert.Equal(t, "logs", recipeLabel("logs"))
+	assert.Equal(t, "restart", recipeLabel("restart"))
+	assert.Equal(t, otherRecipeLabel, recipeLabel("logs-1706183420"))
+	assert.Equal(t, otherRecipeLabel, recipeLabel(""))
+
+	assert.Equal(t, RecipeStatusFailed, recipeStatusLabel(RecipeStatusFailed))
+	assert.Equal(t, RecipeStatusUnknown, recipeStatusLabel("exploded"))
+}
+
+// Test that the results reported for recipes outside of the catalog share a single label.
+func TestObserveRecipeResult(t *testing.T) {
+	useMetricsCatalog(t)
+	uuid := "metrics-1"
+	incidentRegistry.Register(uuid, Alert)
+	incidentRegistry.RecipeLaunched(uuid, "logs", "logs-abcde", 1)
+	r := &Reconciler{uuid: uuid}
+
+	logs := testutil.ToFloat64(recipeResults.WithLabelValues("logs", RecipeStatusSuccessful))
+	other := testutil.ToFloat64(
+		recipeResults.WithLabelValues(otherRecipeLabel, RecipeStatusSuccessful),
+	)
+	series := testutil.CollectAndCount(recipeDuration)
+	for _, recipeName := range []string{"logs", "injected-1", "injected-2"} {
+		r.observeRecipeResult(Recipe{Execution: &RecipeExecution{
+			Name: recipeName, Status: RecipeStatusSuccessful,
+		}})
+	}
+
+	assert.Equal(
+		t, logs+1,
+		testutil.ToFloat64(recipeResults.WithLabelValues("logs", RecipeStatusSuccessful)),
+	)
+	assert.Equal(t, other+2, testutil.ToFloat64(
+		recipeResults.WithLabelValues(otherRecipeLabel, RecipeStatusSuccessful),
+	))
+	assert.LessOrEqual(t, testutil.CollectAndCount(recipeDuration), series+1)
+}
+
+// Test that the recipe metrics label the recipes outside of the catalog, e.g. inline recipes named
+// by their requests, with the shared label.
+func TestRecipeMetricLabels(t *testing.T) {
+	useMetricsCatalog(t)
+	const recipeName = "inline-injected"
+	newReconciler := func(uuid string, recipe Recipe) *Reconciler {
+		incidentRegistry.Register(uuid, Alert)
+		return &Reconciler{
+			uuid:      uuid,
+			config:    &testConfig,
+			recipes:   map[string]Recipe{recipeName: recipe},
+			jobs:      map[string]*recipeJob{},
+			finished:  map[string]bool{},
+			completed: map[string]bool{},
+		}
+	}
+	recipe := Recipe{Config: &RecipeConfig{Image: imageName}}
+
+	testCases := []struct {
+		name    string
+		metric  *prometheus.CounterVec
+		observe func(t *testing.T)
+	}{
+		{
+			name:   "Launched",
+			metric: recipesLaunched,
+			observe: func(t *testing.T) {
+				useFakeClientset(t)
+				newReconciler("labels-launched", recipe).launchRecipe(recipeName, recipe, "cm")
+			},
+		},
+		{
+			name:   "LaunchFailures",
+			metric: recipeLaunchFailures,
+			observe: func(t *testing.T) {
+				recipe := Recipe{Config: &RecipeConfig{Image: imageName, Cluster: "missing"}}
+				newReconciler("labels-failures", recipe).launchRecipe(recipeName, recipe, "cm")
+			},
+		},
+		{
+			name:   "Timeouts",
+			metric: recipeTimeouts,
+			observe: func(t *testing.T) {
+				newReconciler("labels-timeouts", recipe).observeRecipeTimeouts(map[string]bool{})
+			},
+		},
+		{
+			name:   "JobFailures",
+			metric: recipeJobFailures,
+			observe: func(t *testing.T) {
+				uuid := "labels-job-failures"
+				useFakeClientset(t, &batchv1.Job{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:      recipeName + "-abcde",
+						Namespace: testConfig.RecipeNamespace,
+						Labels:    map[string]string{"app": "euphrosyne", "uuid": uuid},
+					},
+					Status: batchv1.JobStatus{Failed: 1},
+				})
+				r := newReconciler(uuid, recipe)
+				r.jobs[recipeName] = &recipeJob{jobName: recipeName + "-abcde", attempts: 1}
+				r.reconcileJobs(r.completed)
+			},
+		},
+		{
+			name:   "ResultFallbacks",
+			metric: recipeResultFallbacks,
+			observe: func(t *testing.T) {
+				uuid := "labels-fallbacks"
+				job := useTerminatedJob(
+					t, uuid,
+					`{"name": "`+recipeName+`", "status": "successful", "results": {}}`,
+					time.Now().Add(-time.Minute),
+				)
+				r := newTerminationReconciler(uuid)
+				r.recipes = map[string]Recipe{recipeName: {}}
+				r.collectTerminationMessage(recipeName, job)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			other := testutil.ToFloat64(tc.metric.WithLabelValues(otherRecipeLabel))
+			tc.observe(t)
+			assert.Equal(t, other+1, testutil.ToFloat64(tc.metric.WithLabelValues(otherRecipeLabel)))
+			assert.False(t, hasRecipeSeries(tc.metric, recipeName))
+		})
+	}
+}
+
+// Replace the Kubernetes client with a fake one serving the provided objects.
+func useFakeClientset(t *testing.T, objects ...runtime.Object) {
+	previous := clientset
+	t.Cleanup(func() { clientset = previous })
+	clientset = fake.NewSimpleClientset(objects...)
+}
+
+// Check whether a recipe metric has a series labelled with the provided recipe name.
+func hasRecipeSeries(metric *prometheus.CounterVec, recipeName string) bool {
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		metric.Collect(metrics)
+		close(metrics)
+	}()
+	found := false
+	for m := range metrics {
+		var series dto.Metric
+		if m.Write(&series) != nil {
+			continue
+		}
+		for _, label := range series.GetLabel() {
+			if label.GetName() == "recipe" && label.GetValue() == recipeName {
+				found = true
+			}
+		}
+	}
+	return found
+}
+
+// Test that the time taken to collect the results received from Redis is observed.
+func TestRedisReceiveDuration(t *testing.T) {
+	ctx := context.Background()
+	sub, err := (&redisBroker{}).Subscribe(ctx, "metrics-incident")
+	assert.Nil(t, err)
+	defer sub.Close()
+
+	received := redisReceiveSamples(t)
+	assert.Nil(t, rdb.Publish(ctx, "metrics-incident", "result").Err())
+	select {
+	case <-sub.Messages():
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for result")
+	}
+	assert.Eventually(t, func() bool {
+		return redisReceiveSamples(t) == received+1
+	}, time.Second, 10*time.Millisecond)
+}
+
+// Return the number of observations of the Redis receive duration.
+func redisReceiveSamples(t *testing.T) uint64 {
+	var metric dto.Metric
+	assert.Nil(t, redisReceiveDuration.Write(&metric))
+	return metric.GetHistogram().GetSampleCount()
+}
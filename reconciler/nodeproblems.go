@@ -0,0 +1,417 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+const (
+	// Field of the alert data holding the node problems of the node an alert refers to.
+	nodeProblemsField = "nodeProblems"
+	// Field of the alert data restricting an execution to the recipes of a node problem rule.
+	nodeProblemRecipesField = "nodeProblemRecipes"
+	// Name of the alerts raised for new node problems.
+	nodeProblemAlertname = "NodeProblem"
+)
+
+// NodeProblemRule triggers a set of debugging recipes whenever a node condition appears.
+type NodeProblemRule struct {
+	Condition string   `json:"condition"`
+	Recipes   []string `json:"recipes"`
+}
+
+// Check that a node problem rule can be applied.
+func (npr NodeProblemRule) validate() error {
+	if npr.Condition == "" {
+		return fmt.Errorf("Node problem rules must specify a condition")
+	}
+	if len(npr.Recipes) == 0 {
+		return fmt.Errorf("Node problem rule for condition '%s' must list recipes", npr.Condition)
+	}
+	return nil
+}
+
+// NodeFinding is a problem reported on a node, e.g. by the Node Problem Detector.
+type NodeFinding struct {
+	Node      string    `json:"node"`
+	Condition string    `json:"condition"`
+	Reason    string    `json:"reason,omitempty"`
+	Message   string    `json:"message,omitempty"`
+	Since     time.Time `json:"since"`
+}
+
+// NodeProblemWatcher watches the problems reported on the nodes, such as the ones set by the Node
+// Problem Detector as node conditions or reported as node events, to enrich node-related alerts and
+// to trigger the recipes of node problem rules when new problems appear.
+type NodeProblemWatcher struct {
+	config *Config
+	mutex  sync.Mutex
+	// Current problems of each node
+	findings map[string][]NodeFinding
+	// Whether the problems present on start-up have been collected
+	initialised bool
+}
+
+var (
+	// Watcher of node problems, only set if enabled.
+	nodeProblemWatcher *NodeProblemWatcher
+	// Time to wait before watching the nodes or their events again once a watch ends
+	nodeProblemWatchBackoff = 5 * time.Second
+)
+
+// Select the Warning events reported on nodes, e.g. the temporary problems reported by the Node
+// Problem Detector.
+var nodeEventSelector = fields.AndSelectors(
+	fields.OneTermEqualSelector("involvedObject.kind", "Node"),
+	fields.OneTermEqualSelector("type", corev1.EventTypeWarning),
+).String()
+
+// Initialise a node problem watcher.
+func NewNodeProblemWatcher(config *Config) *NodeProblemWatcher {
+	return &NodeProblemWatcher{config: config, findings: make(map[string][]NodeFinding)}
+}
+
+// Watch the conditions of the nodes and the events reported on them until the context is
+// cancelled.
+func (w *NodeProblemWatcher) Run(ctx context.Context) {
+	go w.watchEvents(ctx)
+	for {
+		if err := w.watchNodes(ctx); err != nil {
+			logger.Warn("Failed to watch nodes", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(nodeProblemWatchBackoff):
+		}
+	}
+}
+
+// List the nodes, then watch them from the listed version, raising an alert for each new problem
+// matching a node problem rule. Every watch starts from a fresh list, so that the changes made
+// while no watch was open are not missed.
+func (w *NodeProblemWatcher) watchNodes(ctx context.Context) error {
+	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	w.raiseAlerts(ctx, w.update(nodes.Items))
+
+	watcher, err := clientset.CoreV1().Nodes().Watch(
+		ctx, metav1.ListOptions{ResourceVersion: nodes.ResourceVersion},
+	)
+	if err != nil {
+		return err
+	}
+	defer watcher.Stop()
+
+	for event := range watcher.ResultChan() {
+		node, ok := event.Object.(*corev1.Node)
+		if !ok {
+			continue
+		}
+		switch event.Type {
+		case watch.Added, watch.Modified:
+			w.raiseAlerts(ctx, w.updateNode(*node))
+		case watch.Deleted:
+			w.removeNode(node.Name)
+		}
+	}
+	return nil
+}
+
+// Watch the Warning events reported on nodes until the context is cancelled, raising an alert for
+// each new event matching a node problem rule. The Node Problem Detector reports temporary
+// problems, e.g. OOMKilling or TaskHung, as events rather than node conditions.
+func (w *NodeProblemWatcher) watchEvents(ctx context.Context) {
+	var resourceVersion string
+	for {
+		var err error
+		resourceVersion, err = w.watchEventsFrom(ctx, resourceVersion)
+		if err != nil {
+			logger.Warn("Failed to watch node events", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(nodeProblemWatchBackoff):
+		}
+	}
+}
+
+// Watch the node events from a resource version, or from the current one if unset, so that the
+// events reported earlier do not raise alerts. Return the version of the last event seen, from
+// which the next watch resumes, or an empty version if the watch failed.
+func (w *NodeProblemWatcher) watchEventsFrom(
+	ctx context.Context, resourceVersion string,
+) (string, error) {
+	events := clientset.CoreV1().Events(metav1.NamespaceAll)
+	if resourceVersion == "" {
+		list, err := events.List(
+			ctx, metav1.ListOptions{FieldSelector: nodeEventSelector, Limit: 1},
+		)
+		if err != nil {
+			return "", err
+		}
+		resourceVersion = list.ResourceVersion
+	}
+
+	watcher, err := events.Watch(ctx, metav1.ListOptions{
+		FieldSelector: nodeEventSelector, ResourceVersion: resourceVersion,
+	})
+	if err != nil {
+		return "", err
+	}
+	defer watcher.Stop()
+
+	for event := range watcher.ResultChan() {
+		if event.Type == watch.Error {
+			return "", apierrors.FromObject(event.Object)
+		}
+		problem, ok := event.Object.(*corev1.Event)
+		if !ok {
+			continue
+		}
+		resourceVersion = problem.ResourceVersion
+		// Repeated events update the count of the original one
+		if event.Type == watch.Added {
+			w.raiseAlerts(ctx, []NodeFinding{eventFinding(problem)})
+		}
+	}
+	return resourceVersion, nil
+}
+
+// Raise an alert for each new problem matching a node problem rule.
+func (w *NodeProblemWatcher) raiseAlerts(ctx context.Context, appeared []NodeFinding) {
+	if len(appeared) == 0 {
+		return
+	}
+
+	rc, err := getRecipeCatalog(w.config.ReconcilerNamespace)
+	if err != nil {
+		logger.Error("Failed to retrieve node problem rules from catalog", zap.Error(err))
+		return
+	}
+	for _, finding := range appeared {
+		nodeProblemsDetected.WithLabelValues(finding.Condition).Inc()
+		rule, ok := rc.NodeProblemRule(finding.Condition)
+		if !ok {
+			continue
+		}
+
+		alertData, err := toMap(nodeProblemAlertData(finding))
+		if err != nil {
+			logger.Error("Failed to build alert data", zap.Error(err))
+			continue
+		}
+		alertData["uuid"] = newExecutionID(ctx)
+		alertData[nodeProblemsField] = w.problems(finding)
+		alertData[nodeProblemRecipesField] = rule.Recipes
+		logger.Info("Alert triggered by node problem", zap.Any("alert", alertData))
+
+		if err := submitRaisedAlert(ctx, alertData, w.config); err != nil {
+			logger.Warn("Dropping alert triggered by node problem", zap.Error(err))
+		}
+	}
+}
+
+// Get the current problems of the node of a new problem, including the problem itself if it was
+// reported by an event rather than a node condition.
+func (w *NodeProblemWatcher) problems(finding NodeFinding) []NodeFinding {
+	findings := w.Findings(finding.Node)
+	for _, known := range findings {
+		if known.Condition == finding.Condition {
+			return findings
+		}
+	}
+	return append(findings, finding)
+}
+
+// Replace the known node problems with the ones currently reported on the nodes, returning the
+// problems that appeared since the previous update. The problems present on start-up are only
+// recorded, so that restarts do not trigger recipes again.
+func (w *NodeProblemWatcher) update(nodes []corev1.Node) []NodeFinding {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	previous := w.findings
+	w.findings = make(map[string][]NodeFinding, len(nodes))
+	var appeared []NodeFinding
+	for _, node := range nodes {
+		appeared = append(appeared, w.setFindings(node, previous[node.Name])...)
+	}
+	w.initialised = true
+	return appeared
+}
+
+// Replace the known problems of a node with the ones currently reported on it, returning the
+// problems that appeared since the previous update.
+func (w *NodeProblemWatcher) updateNode(node corev1.Node) []NodeFinding {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.setFindings(node, w.findings[node.Name])
+}
+
+// Forget the problems of a deleted node.
+func (w *NodeProblemWatcher) removeNode(node string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	delete(w.findings, node)
+}
+
+// Record the problems currently reported on a node, returning the ones missing from its known
+// problems. The caller must hold the mutex.
+func (w *NodeProblemWatcher) setFindings(node corev1.Node, known []NodeFinding) []NodeFinding {
+	conditions := make(map[string]bool, len(known))
+	for _, finding := range known {
+		conditions[finding.Condition] = true
+	}
+	var appeared []NodeFinding
+	findings := nodeFindings(node)
+	for _, finding := range findings {
+		if w.initialised && !conditions[finding.Condition] {
+			appeared = append(appeared, finding)
+		}
+	}
+	if len(findings) == 0 {
+		delete(w.findings, node.Name)
+	} else {
+		w.findings[node.Name] = findings
+	}
+	return appeared
+}
+
+// Get the current problems of a node.
+func (w *NodeProblemWatcher) Findings(node string) []NodeFinding {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return append([]NodeFinding{}, w.findings[node]...)
+}
+
+// Extract the problems reported as conditions of a node, i.e. every condition other than Ready
+// that is currently true.
+func nodeFindings(node corev1.Node) []NodeFinding {
+	var findings []NodeFinding
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady || condition.Status != corev1.ConditionTrue {
+			continue
+		}
+		findings = append(findings, NodeFinding{
+			Node:      node.Name,
+			Condition: string(condition.Type),
+			Reason:    condition.Reason,
+			Message:   condition.Message,
+			Since:     condition.LastTransitionTime.UTC(),
+		})
+	}
+	sort.Slice(findings, func(i, j int) bool {
+		return findings[i].Condition < findings[j].Condition
+	})
+	return findings
+}
+
+// Extract the problem reported by a Warning event on a node, identified by the reason of the event.
+func eventFinding(event *corev1.Event) NodeFinding {
+	since := event.LastTimestamp.Time
+	if since.IsZero() {
+		since = event.EventTime.Time
+	}
+	if since.IsZero() {
+		since = event.CreationTimestamp.Time
+	}
+	return NodeFinding{
+		Node:      event.InvolvedObject.Name,
+		Condition: event.Reason,
+		Reason:    event.Reason,
+		Message:   event.Message,
+		Since:     since.UTC(),
+	}
+}
+
+// Build an Alertmanager-like payload for a new node problem, so that it is handled exactly like
+// the alerts received on the webhook.
+func nodeProblemAlertData(finding NodeFinding) AlertmanagerPayload {
+	labels := map[string]string{
+		"alertname": nodeProblemAlertname,
+		"node":      finding.Node,
+		"condition": finding.Condition,
+	}
+	annotations := map[string]string{
+		"summary": fmt.Sprintf("Node '%s' reports %s", finding.Node, finding.Condition),
+	}
+	if finding.Message != "" {
+		annotations["description"] = finding.Message
+	}
+	alert := AlertmanagerAlert{
+		Status:      "firing",
+		Labels:      labels,
+		Annotations: annotations,
+		StartsAt:    finding.Since,
+		Fingerprint: seriesKey(nodeProblemAlertname, labels),
+	}
+	return AlertmanagerPayload{
+		Version:           "4",
+		Status:            "firing",
+		Receiver:          "euphrosyne-node-problems",
+		GroupLabels:       map[string]string{"alertname": nodeProblemAlertname},
+		CommonLabels:      labels,
+		CommonAnnotations: annotations,
+		Alerts:            []AlertmanagerAlert{alert},
+	}
+}
+
+// Add the current problems of the node an alert refers to, identified by the configured label, to
+// the alert data.
+func enrichNodeProblems(data map[string]interface{}, config *Config) {
+	if nodeProblemWatcher == nil {
+		return
+	}
+	if _, ok := data[nodeProblemsField]; ok {
+		return
+	}
+	node, ok := alertLabels(data)[config.NodeProblemLabel]
+	if !ok {
+		return
+	}
+	if findings := nodeProblemWatcher.Findings(node); len(findings) > 0 {
+		data[nodeProblemsField] = findings
+	}
+}
+
+// Restrict the debugging recipes of an alert raised for a node problem to the recipes of the
+// matching node problem rule.
+func nodeProblemRecipes(
+	recipes map[string]Recipe, data map[string]interface{},
+) map[string]Recipe {
+	var names []string
+	switch value := data[nodeProblemRecipesField].(type) {
+	case []string:
+		names = value
+	case []interface{}:
+		for _, name := range value {
+			if name, ok := name.(string); ok {
+				names = append(names, name)
+			}
+		}
+	default:
+		return recipes
+	}
+
+	restricted := make(map[string]Recipe, len(names))
+	for _, name := range names {
+		if recipe, ok := recipes[name]; ok {
+			restricted[name] = recipe
+		}
+	}
+	return restricted
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// Build a node reporting the provided conditions as true, along with a ready condition.
+func newTestNode(name string, conditions ...corev1.NodeConditionType) corev1.Node {
+	node := corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	node.Status.Conditions = []corev1.NodeCondition{
+		{Type: corev1.NodeReady, Status: corev1.ConditionTrue},
+		{Type: corev1.NodeMemoryPressure, Status: corev1.ConditionFalse},
+	}
+	for _, condition := range conditions {
+		node.Status.Conditions = append(node.Status.Conditions, corev1.NodeCondition{
+			Type:               condition,
+			Status:             corev1.ConditionTrue,
+			Reason:             string(condition) + "Detected",
+			LastTransitionTime: metav1.NewTime(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)),
+		})
+	}
+	return node
+}
+
+// Test that the problems of a node are the conditions other than Ready that are true.
+func TestNodeFindings(t *testing.T) {
+	findings := nodeFindings(newTestNode("worker-1", "ReadonlyFilesystem", "KernelDeadlock"))
+	assert.Equal(t, []NodeFinding{
+		{
+			Node:      "worker-1",
+			Condition: "KernelDeadlock",
+			Reason:    "KernelDeadlockDetected",
+			Since:     time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			Node:      "worker-1",
+			Condition: "ReadonlyFilesystem",
+			Reason:    "ReadonlyFilesystemDetected",
+			Since:     time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}, findings)
+	assert.Empty(t, nodeFindings(newTestNode("worker-2")))
+}
+
+// Test that only the problems appearing after start-up are reported as new.
+func TestNodeProblemWatcherUpdate(t *testing.T) {
+	w := NewNodeProblemWatcher(&Config{})
+
+	// Problems present on start-up are only recorded
+	assert.Empty(t, w.update([]corev1.Node{newTestNode("worker-1", "KernelDeadlock")}))
+	assert.Len(t, w.Findings("worker-1"), 1)
+
+	appeared := w.update([]corev1.Node{
+		newTestNode("worker-1", "KernelDeadlock", "ReadonlyFilesystem"),
+		newTestNode("worker-2", "FrequentKubeletRestart"),
+	})
+	assert.Len(t, appeared, 2)
+	assert.Equal(t, "ReadonlyFilesystem", appeared[0].Condition)
+	assert.Equal(t, "worker-2", appeared[1].Node)
+
+	// Problems that went away are forgotten, so they are reported again if they reappear
+	assert.Empty(t, w.update([]corev1.Node{newTestNode("worker-1")}))
+	assert.Empty(t, w.Findings("worker-2"))
+	assert.Len(t, w.update([]corev1.Node{newTestNode("worker-1", "KernelDeadlock")}), 1)
+}
+
+// Test that the problems of each watched node are updated as the node changes.
+func TestNodeProblemWatcherUpdateNode(t *testing.T) {
+	w := NewNodeProblemWatcher(&Config{})
+	w.update([]corev1.Node{newTestNode("worker-1", "KernelDeadlock")})
+
+	appeared := w.updateNode(newTestNode("worker-1", "KernelDeadlock", "ReadonlyFilesystem"))
+	assert.Len(t, appeared, 1)
+	assert.Equal(t, "ReadonlyFilesystem", appeared[0].Condition)
+	assert.Len(t, w.Findings("worker-1"), 2)
+	assert.Len(t, w.updateNode(newTestNode("worker-2", "KernelDeadlock")), 1)
+
+	w.removeNode("worker-1")
+	assert.Empty(t, w.Findings("worker-1"))
+	assert.Len(t, w.Findings("worker-2"), 1)
+}
+
+// Test that the nodes are listed before being watched, and that their changes update the problems.
+func TestNodeProblemWatcherWatchNodes(t *testing.T) {
+	node := func(name string, conditions ...corev1.NodeConditionType) *corev1.Node {
+		node := newTestNode(name, conditions...)
+		return &node
+	}
+	client := fake.NewSimpleClientset(node("worker-1", "KernelDeadlock"))
+	watcher := watch.NewFake()
+	client.PrependWatchReactor("nodes", k8stesting.DefaultWatchReactor(watcher, nil))
+	previous := clientset
+	t.Cleanup(func() { clientset = previous })
+	clientset = client
+
+	w := NewNodeProblemWatcher(&Config{})
+	done := make(chan error)
+	go func() { done <- w.watchNodes(context.Background()) }()
+
+	// Each event is only sent once the previous one has been handled
+	watcher.Add(node("worker-2", "ReadonlyFilesystem"))
+	assert.Len(t, w.Findings("worker-1"), 1)
+	watcher.Modify(node("worker-1"))
+	watcher.Delete(node("worker-2"))
+	watcher.Add(node("worker-3", "KernelDeadlock"))
+	watcher.Stop()
+	assert.Nil(t, <-done)
+
+	assert.Empty(t, w.Findings("worker-1"))
+	assert.Empty(t, w.Findings("worker-2"))
+	assert.Len(t, w.Findings("worker-3"), 1)
+}
+
+// Test that the problems reported by node events are identified by their reason.
+func TestEventFinding(t *testing.T) {
+	event := &corev1.Event{
+		InvolvedObject: corev1.ObjectReference{Kind: "Node", Name: "worker-1"},
+		Reason:         "OOMKilling",
+		Message:        "Killed process 1234 (java)",
+		LastTimestamp:  metav1.NewTime(time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)),
+	}
+	assert.Equal(t, NodeFinding{
+		Node:      "worker-1",
+		Condition: "OOMKilling",
+		Reason:    "OOMKilling",
+		Message:   "Killed process 1234 (java)",
+		Since:     time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+	}, eventFinding(event))
+
+	// Events recorded through the events API only set the event time
+	event.LastTimestamp = metav1.Time{}
+	event.EventTime = metav1.NewMicroTime(time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC))
+	assert.Equal(t, time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC), eventFinding(event).Since)
+}
+
+// Test that node-related alerts are enriched with the problems of their node.
+func TestEnrichNodeProblems(t *testing.T) {
+	previous := nodeProblemWatcher
+	nodeProblemWatcher = NewNodeProblemWatcher(&Config{})
+	defer func() { nodeProblemWatcher = previous }()
+	nodeProblemWatcher.update([]corev1.Node{newTestNode("worker-1", "KernelDeadlock")})
+
+	config := &Config{NodeProblemLabel: "node"}
+	data := map[string]interface{}{
+		"labels": map[string]interface{}{"alertname": "NodeNotReady", "node": "worker-1"},
+	}
+	enrichNodeProblems(data, config)
+	assert.Equal(t, nodeProblemWatcher.Findings("worker-1"), data[nodeProblemsField])
+
+	data = map[string]interface{}{
+		"labels": map[string]interface{}{"alertname": "HighErrorRate", "service": "orders"},
+	}
+	enrichNodeProblems(data, config)
+	assert.NotContains(t, data, nodeProblemsField)
+}
+
+// Test that alerts raised for node problems only run the recipes of their node problem rule.
+func TestNodeProblemRecipes(t *testing.T) {
+	recipes := map[string]Recipe{
+		"http-errors":  {Config: &RecipeConfig{Enabled: true}},
+		"kernel-logs":  {Config: &RecipeConfig{Enabled: true}},
+		"node-summary": {Config: &RecipeConfig{Enabled: true}},
+	}
+
+	alertData, err := toMap(nodeProblemAlertData(NodeFinding{
+		Node: "worker-1", Condition: "KernelDeadlock",
+	}))
+	assert.Nil(t, err)
+	assert.Equal(t, "worker-1", alertLabels(alertData)["node"])
+	assert.Equal(t, recipes, nodeProblemRecipes(recipes, alertData))
+
+	alertData[nodeProblemRecipesField] = []interface{}{"kernel-logs", "disabled-recipe"}
+	restricted := nodeProblemRecipes(recipes, alertData)
+	assert.Equal(t, map[string]Recipe{"kernel-logs": recipes["kernel-logs"]}, restricted)
+}
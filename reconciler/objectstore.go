@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+const defaultObjectStoreEndpoint = "s3.amazonaws.com"
+
+// ObjectInfo describes an object in an object store.
+type ObjectInfo struct {
+	Key          string
+	LastModified time.Time
+}
+
+// ObjectStore is a minimal interface to the storage backends used for exported data.
+type ObjectStore interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// Initialise an object store from a destination URL, either `s3://<bucket>/<prefix>` for an
+// S3-compatible bucket or `file://<path>` for a local directory (e.g. a mounted volume). The
+// returned prefix should be prepended to all object keys.
+func NewObjectStore(destination string, endpoint string) (ObjectStore, string, error) {
+	u, err := url.Parse(destination)
+	if err != nil {
+		return nil, "", err
+	}
+
+	switch u.Scheme {
+	case "s3":
+		store, err := newS3ObjectStore(u.Host, endpoint)
+		return store, strings.Trim(u.Path, "/"), err
+	case "file":
+		return &fileObjectStore{root: u.Path}, "", nil
+	}
+	return nil, "", fmt.Errorf("Unsupported object store destination '%s'", destination)
+}
+
+// s3ObjectStore stores objects in an S3-compatible bucket. Credentials are read from the standard
+// AWS environment variables (`AWS_ACCESS_KEY_ID`, `AWS_SECRET_ACCESS_KEY`).
+type s3ObjectStore struct {
+	client *minio.Client
+	bucket string
+}
+
+func newS3ObjectStore(bucket string, endpoint string) (*s3ObjectStore, error) {
+	secure := true
+	if endpoint == "" {
+		endpoint = defaultObjectStoreEndpoint
+	}
+	if u, err := url.Parse(endpoint); err == nil && u.Host != "" {
+		secure = u.Scheme != "http"
+		endpoint = u.Host
+	}
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewEnvAWS(),
+		Secure: secure,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &s3ObjectStore{client: client, bucket: bucket}, nil
+}
+
+func (s *s3ObjectStore) Put(
+	ctx context.Context, key string, data []byte, contentType string,
+) error {
+	_, err := s.client.PutObject(
+		ctx, s.bucket, key, bytes.NewReader(data), int64(len(data)),
+		minio.PutObjectOptions{ContentType: contentType},
+	)
+	return err
+}
+
+func (s *s3ObjectStore) Get(ctx context.Context, key string) ([]byte, error) {
+	object, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+
+	var buf bytes.Buffer
+	if _, err := buf.ReadFrom(object); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (s *s3ObjectStore) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	for object := range s.client.ListObjects(
+		ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true},
+	) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		objects = append(objects, ObjectInfo{Key: object.Key, LastModified: object.LastModified})
+	}
+	return objects, nil
+}
+
+func (s *s3ObjectStore) Delete(ctx context.Context, key string) error {
+	return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+}
+
+// fileObjectStore stores objects as files under a local directory.
+type fileObjectStore struct {
+	root string
+}
+
+func (s *fileObjectStore) Put(_ context.Context, key string, data []byte, _ string) error {
+	path := filepath.Join(s.root, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+func (s *fileObjectStore) Get(_ context.Context, key string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(s.root, filepath.FromSlash(key)))
+}
+
+func (s *fileObjectStore) List(_ context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	err := filepath.Walk(s.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(s.root, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, ObjectInfo{Key: key, LastModified: info.ModTime()})
+		}
+		return nil
+	})
+	return objects, err
+}
+
+func (s *fileObjectStore) Delete(_ context.Context, key string) error {
+	return os.Remove(filepath.Join(s.root, filepath.FromSlash(key)))
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// Field of webhook and Actions requests holding the overrides of the execution.
+const overridesField = "overrides"
+
+var (
+	errInvalidOverrides   = errors.New("Invalid overrides")
+	errOverrideNotAllowed = errors.New("Override not allowed")
+)
+
+// ExecutionOverrides adjust the configuration of a single execution, e.g. for the chatbot to
+// request a longer deep-dive run without changing the global configuration.
+type ExecutionOverrides struct {
+	// Time to wait for the results of the recipes, instead of the recipe timeout
+	Timeout Duration `json:"timeout"`
+	// Namespace of the recipe Jobs, instead of the recipe namespace
+	Namespace string `json:"namespace"`
+}
+
+// Parse the overrides of a request, if it defines any.
+func parseOverrides(data map[string]interface{}) (*ExecutionOverrides, error) {
+	spec, ok := data[overridesField]
+	if !ok {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(spec)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", errInvalidOverrides, err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.DisallowUnknownFields()
+	var overrides ExecutionOverrides
+	if err := decoder.Decode(&overrides); err != nil {
+		return nil, fmt.Errorf("%w: %s", errInvalidOverrides, err)
+	}
+	return &overrides, nil
+}
+
+// Check the overrides of a request against the policy. Overrides are only accepted on
+// authenticated endpoints, with a timeout within the configured bounds and an allowed namespace.
+func (o *ExecutionOverrides) validate(config *Config, authModes string) error {
+	if authModes == "" {
+		return fmt.Errorf("%w: the endpoint is not authenticated", errOverrideNotAllowed)
+	}
+	if o.Timeout.Duration > 0 {
+		if config.MaxRecipeTimeout == 0 {
+			return fmt.Errorf("%w: timeout overrides are disabled", errOverrideNotAllowed)
+		}
+		minTimeout, maxTimeout := config.MinRecipeTimeout, config.MaxRecipeTimeout
+		if o.Timeout.Duration < minTimeout || o.Timeout.Duration > maxTimeout {
+			return fmt.Errorf(
+				"%w: timeout %s is not between %s and %s",
+				errOverrideNotAllowed, o.Timeout, minTimeout, maxTimeout,
+			)
+		}
+	}
+	if o.Namespace != "" && !slices.Contains(overrideNamespaces(config), o.Namespace) {
+		return fmt.Errorf("%w: namespace '%s' is not allowed", errOverrideNotAllowed, o.Namespace)
+	}
+	return nil
+}
+
+// Return the namespaces requests can override the recipe namespace with.
+func overrideNamespaces(config *Config) []string {
+	var namespaces []string
+	for _, namespace := range strings.Split(config.OverrideNamespaces, ",") {
+		namespace = strings.TrimSpace(namespace)
+		if namespace != "" {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	return namespaces
+}
+
+// Check that the bounds of the recipe timeout and the namespaces requests can override are valid.
+func validateOverridePolicy(config *Config) error {
+	if config.MinRecipeTimeout < 0 || config.MaxRecipeTimeout < 0 {
+		return fmt.Errorf("The bounds of the recipe timeout cannot be negative")
+	}
+	if config.MaxRecipeTimeout > 0 && config.MinRecipeTimeout > config.MaxRecipeTimeout {
+		return fmt.Errorf(
+			"The minimum recipe timeout (%s) exceeds the maximum recipe timeout (%s)",
+			config.MinRecipeTimeout, config.MaxRecipeTimeout,
+		)
+	}
+	for _, namespace := range overrideNamespaces(config) {
+		if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+			return fmt.Errorf(
+				"Invalid override namespace '%s': %s", namespace, strings.Join(errs, ", "),
+			)
+		}
+	}
+	return nil
+}
+
+// Validate the overrides of a request against the policy, responding with a problem if they are
+// rejected.
+func checkOverrides(
+	c *gin.Context, data map[string]interface{}, config *Config, authModes string,
+) bool {
+	if problem := validateOverrides(data, config, authModes); problem != nil {
+		respondWithProblem(c, *problem)
+		return false
+	}
+	return true
+}
+
+// Validate the overrides of a request against the policy, returning the problem to reject the
+// request with, if any.
+func validateOverrides(data map[string]interface{}, config *Config, authModes string) *Problem {
+	overrides, err := parseOverrides(data)
+	if err == nil && overrides != nil {
+		err = overrides.validate(config, authModes)
+	}
+	switch {
+	case errors.Is(err, errOverrideNotAllowed):
+		logger.Warn("Rejecting overrides", zap.Error(err))
+		problem := newProblem(http.StatusForbidden, OverrideNotAllowedProblem, err.Error())
+		return &problem
+	case err != nil:
+		problem := newProblem(http.StatusBadRequest, InvalidRequestProblem, err.Error())
+		return &problem
+	case overrides != nil:
+		logger.Info(
+			"Overrides accepted",
+			zap.Stringer("timeout", overrides.Timeout),
+			zap.String("namespace", overrides.Namespace),
+		)
+	}
+	return nil
+}
+
+// Return the configuration of an execution, i.e. the global configuration with the overrides of
+// its request applied. The overrides are validated along with the request.
+func executionConfig(config *Config, data map[string]interface{}) *Config {
+	overrides, err := parseOverrides(data)
+	if err != nil || overrides == nil {
+		return config
+	}
+	overridden := *config
+	if overrides.Timeout.Duration > 0 {
+		overridden.RecipeTimeout = overrides.Timeout.Duration
+	}
+	if overrides.Namespace != "" {
+		overridden.RecipeNamespace = overrides.Namespace
+	}
+	return &overridden
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that overrides are only accepted on authenticated endpoints and within the policy.
+func TestValidateOverrides(t *testing.T) {
+	config := &Config{
+		MinRecipeTimeout:   time.Minute,
+		MaxRecipeTimeout:   time.Hour,
+		OverrideNamespaces: "deep-dive, sandbox",
+	}
+
+	testCases := []struct {
+		name      string
+		overrides ExecutionOverrides
+		config    *Config
+		authModes string
+		err       string
+	}{
+		{
+			name: "Allowed",
+			overrides: ExecutionOverrides{
+				Timeout: Duration{30 * time.Minute}, Namespace: "sandbox",
+			},
+			config:    config,
+			authModes: TokenAuthMode,
+		},
+		{
+			name:      "Unauthenticated",
+			overrides: ExecutionOverrides{Namespace: "sandbox"},
+			config:    config,
+			err:       "the endpoint is not authenticated",
+		},
+		{
+			name:      "TimeoutTooShort",
+			overrides: ExecutionOverrides{Timeout: Duration{time.Second}},
+			config:    config,
+			authModes: TokenAuthMode,
+			err:       "timeout 1s is not between 1m0s and 1h0m0s",
+		},
+		{
+			name:      "TimeoutTooLong",
+			overrides: ExecutionOverrides{Timeout: Duration{2 * time.Hour}},
+			config:    config,
+			authModes: TokenAuthMode,
+			err:       "timeout 2h0m0s is not between 1m0s and 1h0m0s",
+		},
+		{
+			name:      "TimeoutDisabled",
+			overrides: ExecutionOverrides{Timeout: Duration{time.Minute}},
+			config:    &Config{},
+			authModes: TokenAuthMode,
+			err:       "timeout overrides are disabled",
+		},
+		{
+			name:      "NamespaceNotAllowed",
+			overrides: ExecutionOverrides{Namespace: "kube-system"},
+			config:    config,
+			authModes: TokenAuthMode,
+			err:       "namespace 'kube-system' is not allowed",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.overrides.validate(tc.config, tc.authModes)
+			if tc.err == "" {
+				assert.Nil(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, errOverrideNotAllowed)
+			assert.ErrorContains(t, err, tc.err)
+		})
+	}
+}
+
+// Test the validation of the bounds of the recipe timeout and the override namespaces.
+func TestValidateOverridePolicy(t *testing.T) {
+	assert.Nil(t, validateOverridePolicy(&Config{MinRecipeTimeout: time.Minute}))
+	assert.Nil(t, validateOverridePolicy(
+		&Config{
+			MinRecipeTimeout:   time.Minute,
+			MaxRecipeTimeout:   time.Hour,
+			OverrideNamespaces: "deep-dive",
+		},
+	))
+	assert.ErrorContains(t, validateOverridePolicy(
+		&Config{MinRecipeTimeout: 10 * time.Minute, MaxRecipeTimeout: time.Minute},
+	), "The minimum recipe timeout (10m0s) exceeds the maximum recipe timeout (1m0s)")
+	assert.ErrorContains(t, validateOverridePolicy(
+		&Config{OverrideNamespaces: "Deep_Dive"},
+	), "Invalid override namespace 'Deep_Dive'")
+}
+
+// Test that the overrides of a request only apply to the configuration of its execution.
+func TestExecutionConfig(t *testing.T) {
+	config := &Config{RecipeTimeout: 5 * time.Minute, RecipeNamespace: "euphrosyne"}
+
+	assert.Same(t, config, executionConfig(config, map[string]interface{}{}))
+
+	overridden := executionConfig(config, map[string]interface{}{
+		overridesField: map[string]interface{}{"timeout": "30m", "namespace": "deep-dive"},
+	})
+	assert.Equal(t, 30*time.Minute, overridden.RecipeTimeout)
+	assert.Equal(t, "deep-dive", overridden.RecipeNamespace)
+	assert.Equal(t, 5*time.Minute, config.RecipeTimeout)
+	assert.Equal(t, "euphrosyne", config.RecipeNamespace)
+
+	recipes := map[string]Recipe{"logs": {}, "heap-dump": {Config: &RecipeConfig{
+		Namespace: "jvm",
+	}}}
+	assert.Equal(t, 30*time.Minute, executionTimeout(overridden, recipes))
+	assert.Equal(t, []RecipeTarget{{Namespace: "deep-dive"}, {Namespace: "jvm"}},
+		recipeTargets(recipes, overridden))
+}
+
+// Test that requests with invalid or disallowed overrides are rejected with a problem.
+func TestCheckOverrides(t *testing.T) {
+	config := &Config{MinRecipeTimeout: time.Minute, MaxRecipeTimeout: time.Hour}
+
+	testCases := []struct {
+		name   string
+		body   string
+		status int
+		code   string
+	}{
+		{"None", `{}`, http.StatusOK, ""},
+		{"Allowed", `{"overrides": {"timeout": "10m"}}`, http.StatusOK, ""},
+		{
+			"UnknownField", `{"overrides": {"image": "busybox"}}`,
+			http.StatusBadRequest, InvalidRequestProblem,
+		},
+		{
+			"NotAllowed", `{"overrides": {"namespace": "kube-system"}}`,
+			http.StatusForbidden, OverrideNotAllowedProblem,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			router := gin.New()
+			router.POST("/api/actions", func(c *gin.Context) {
+				var data map[string]interface{}
+				_ = c.ShouldBindJSON(&data)
+				if checkOverrides(c, data, config, TokenAuthMode) {
+					c.Status(http.StatusOK)
+				}
+			})
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(
+				http.MethodPost, "/api/actions", bytes.NewReader([]byte(tc.body)),
+			))
+			assert.Equal(t, tc.status, w.Code)
+			if tc.code != "" {
+				var problem map[string]interface{}
+				assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &problem))
+				assert.Equal(t, tc.code, problem["code"])
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"text/template"
+
+	"go.uber.org/zap"
+)
+
+// Field of the recipe data holding the rendered parameters of the recipe.
+const recipeParamsField = "params"
+
+var errInvalidRecipeParams = errors.New("Invalid recipe parameters")
+
+// Parse the template of a recipe parameter. Templates are rendered in strict mode, so that a
+// reference to a missing field fails the recipe rather than running it with empty input.
+func parseRecipeParam(name string, text string) (*template.Template, error) {
+	return template.New(name).
+		Option("missingkey=error").
+		Funcs(templateFuncs()).
+		Parse(text)
+}
+
+// Check that the parameters of the recipes are valid templates.
+func validateRecipeParams(recipes map[string]RecipeConfig) error {
+	for recipeName, recipeConfig := range recipes {
+		for name, text := range recipeConfig.Params {
+			if _, err := parseRecipeParam(name, text); err != nil {
+				return fmt.Errorf(
+					"Recipe '%s' has an invalid template for parameter '%s': %w",
+					recipeName, name, err,
+				)
+			}
+		}
+	}
+	return nil
+}
+
+// Render the parameters of a recipe against the data of the execution, available to the templates
+// as `.alert`, along with the labels of the alert as `.labels`, whatever the payload schema, and
+// the execution ID as `.uuid`.
+func renderRecipeParams(
+	recipeConfig *RecipeConfig, data map[string]interface{},
+) (map[string]string, error) {
+	names := make([]string, 0, len(recipeConfig.Params))
+	for name := range recipeConfig.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	context := map[string]interface{}{
+		"alert":  data,
+		"labels": alertLabels(data),
+		"uuid":   data["uuid"],
+	}
+	params := make(map[string]string, len(names))
+	for _, name := range names {
+		tmpl, err := parseRecipeParam(name, recipeConfig.Params[name])
+		if err != nil {
+			return nil, fmt.Errorf("%w: parameter '%s': %s", errInvalidRecipeParams, name, err)
+		}
+		var rendered bytes.Buffer
+		if err := tmpl.Execute(&rendered, context); err != nil {
+			return nil, fmt.Errorf("%w: parameter '%s': %s", errInvalidRecipeParams, name, err)
+		}
+		params[name] = rendered.String()
+	}
+	return params, nil
+}
+
+// Copy the data of a recipe, adding its rendered parameters. Recipes without parameters get their
+// data unchanged.
+func withRecipeParams(
+	recipe Recipe, data map[string]interface{},
+) (map[string]interface{}, error) {
+	if recipe.Config == nil || len(recipe.Config.Params) == 0 {
+		return data, nil
+	}
+	params, err := renderRecipeParams(recipe.Config, data)
+	if err != nil {
+		return nil, err
+	}
+	withParams := make(map[string]interface{}, len(data)+1)
+	for k, v := range data {
+		withParams[k] = v
+	}
+	withParams[recipeParamsField] = params
+	return withParams, nil
+}
+
+// Add the rendered parameters of a recipe to its data, failing the recipe if they cannot be
+// rendered.
+func (r *Reconciler) recipeParamsData(
+	recipeName string, recipe Recipe, data map[string]interface{},
+) (map[string]interface{}, bool) {
+	withParams, err := withRecipeParams(recipe, data)
+	if err != nil {
+		logger.Error(
+			"Failed to render recipe parameters",
+			zap.String("uuid", r.uuid),
+			zap.String("recipe", recipeName),
+			zap.Error(err),
+		)
+		r.finished[recipeName] = true
+		incidentRegistry.RecipeFailed(r.uuid, recipeName, err)
+		recipeLaunchFailures.WithLabelValues(recipeLabel(recipeName)).Inc()
+		return nil, false
+	}
+	return withParams, true
+}
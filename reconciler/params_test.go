@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that invalid parameter templates are rejected when the catalog is loaded.
+func TestValidateRecipeParams(t *testing.T) {
+	valid := map[string]RecipeConfig{
+		"pods": {Params: map[string]string{"namespace": "{{ .alert.labels.namespace }}"}},
+		"logs": {},
+	}
+	assert.Nil(t, validateRecipeParams(valid))
+
+	invalid := map[string]RecipeConfig{
+		"pods": {Params: map[string]string{"namespace": "{{ .alert.labels.namespace"}},
+	}
+	err := validateRecipeParams(invalid)
+	assert.ErrorContains(t, err, "Recipe 'pods' has an invalid template for parameter 'namespace'")
+
+	// The environment of the Reconciler holds its secrets
+	_, err = parseRecipeParam("token", `{{ env "ADMIN_TOKEN" }}`)
+	assert.ErrorContains(t, err, `function "env" not defined`)
+}
+
+// Test the rendering of recipe parameters against the alert.
+func TestRenderRecipeParams(t *testing.T) {
+	data := map[string]interface{}{
+		"uuid": "params-1",
+		"labels": map[string]interface{}{
+			"namespace": "orders",
+			"pod":       "orders-7d9f",
+		},
+	}
+
+	testCases := []struct {
+		name     string
+		params   map[string]string
+		expected map[string]string
+		err      bool
+	}{
+		{
+			name: "Fields",
+			params: map[string]string{
+				"namespace": "{{ .alert.labels.namespace }}",
+				"target":    "{{ .alert.labels.namespace }}/{{ .alert.labels.pod }}",
+				"incident":  "{{ .uuid }}",
+			},
+			expected: map[string]string{
+				"namespace": "orders", "target": "orders/orders-7d9f", "incident": "params-1",
+			},
+		},
+		{
+			name:     "Labels",
+			params:   map[string]string{"pod": "{{ .labels.pod }}"},
+			expected: map[string]string{"pod": "orders-7d9f"},
+		},
+		{
+			name:     "Static",
+			params:   map[string]string{"window": "15m"},
+			expected: map[string]string{"window": "15m"},
+		},
+		{
+			name:     "Functions",
+			params:   map[string]string{"namespace": "{{ .alert.labels.namespace | upper }}"},
+			expected: map[string]string{"namespace": "ORDERS"},
+		},
+		{
+			name:   "MissingField",
+			params: map[string]string{"node": "{{ .alert.labels.node }}"},
+			err:    true,
+		},
+		{
+			name:   "MissingObject",
+			params: map[string]string{"team": "{{ .alert.annotations.team }}"},
+			err:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			params, err := renderRecipeParams(&RecipeConfig{Params: tc.params}, data)
+			if tc.err {
+				assert.True(t, errors.Is(err, errInvalidRecipeParams))
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tc.expected, params)
+		})
+	}
+}
+
+// Test that rendered parameters are added to a copy of the recipe data.
+func TestWithRecipeParams(t *testing.T) {
+	data := map[string]interface{}{"uuid": "params-2", "status": "firing"}
+
+	unchanged, err := withRecipeParams(Recipe{Config: &RecipeConfig{}}, data)
+	assert.Nil(t, err)
+	assert.Equal(t, data, unchanged)
+
+	recipe := Recipe{
+		Config: &RecipeConfig{Params: map[string]string{"status": "{{ .alert.status }}"}},
+	}
+	withParams, err := withRecipeParams(recipe, data)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"status": "firing"}, withParams[recipeParamsField])
+	assert.NotContains(t, data, recipeParamsField)
+}
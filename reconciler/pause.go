@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Modes of pausing the alert intake.
+const (
+	// Alerts are rejected, so that their senders retry them once the intake resumes
+	RejectPauseMode = "reject"
+	// Executions are accepted and queued, but not started until the intake resumes
+	QueuePauseMode = "queue"
+)
+
+const (
+	// ConfigMap in the Reconciler namespace persisting the state of the alert intake
+	intakeConfigMapName = "euphrosyne-intake"
+	intakeStateKey      = "state.json"
+	// Time senders of rejected alerts are asked to wait, unless the pause says otherwise
+	defaultPauseRetryAfter = 5 * time.Minute
+)
+
+var errIntakePaused = errors.New("Alert intake is paused")
+
+// IntakeState reports whether the alert intake is paused, e.g. during the maintenance of the
+// systems recipes rely on.
+type IntakeState struct {
+	Paused     bool       `json:"paused"`
+	Mode       string     `json:"mode,omitempty"`
+	Reason     string     `json:"reason,omitempty"`
+	RetryAfter Duration   `json:"retryAfter"`
+	PausedAt   *time.Time `json:"pausedAt,omitempty"`
+}
+
+// Intake keeps track of the state of the alert intake.
+type Intake struct {
+	mutex sync.RWMutex
+	state IntakeState
+}
+
+// State of the alert intake, which is open unless paused through the admin API.
+var intake = &Intake{}
+
+// Return the state of the alert intake.
+func (i *Intake) State() IntakeState {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	return i.state
+}
+
+// Replace the state of the alert intake.
+func (i *Intake) set(state IntakeState) {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	i.state = state
+	intakePaused.Set(boolToFloat(state.Paused))
+}
+
+// Check whether alerts are rejected, returning how long their senders should wait before retrying.
+func (i *Intake) Rejecting() (bool, time.Duration) {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	if !i.state.Paused || i.state.Mode != RejectPauseMode {
+		return false, 0
+	}
+	return true, i.state.RetryAfter.Duration
+}
+
+// Check whether executions are held in the queue rather than started.
+func (i *Intake) Holding() bool {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	return i.state.Paused && i.state.Mode == QueuePauseMode
+}
+
+// Check whether a pause mode is supported.
+func isValidPauseMode(mode string) bool {
+	return mode == RejectPauseMode || mode == QueuePauseMode
+}
+
+// Load the persisted state of the alert intake, so that a pause outlives restarts and failovers.
+func LoadIntakeState(namespace string) error {
+	cm, err := clientset.CoreV1().ConfigMaps(namespace).Get(
+		context.TODO(), intakeConfigMapName, metav1.GetOptions{},
+	)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var state IntakeState
+	if err := json.Unmarshal([]byte(cm.Data[intakeStateKey]), &state); err != nil {
+		return fmt.Errorf("Invalid intake state in ConfigMap '%s': %w", intakeConfigMapName, err)
+	}
+	intake.set(state)
+	if state.Paused {
+		logger.Warn(
+			"Alert intake is paused",
+			zap.String("mode", state.Mode),
+			zap.String("reason", state.Reason),
+		)
+	}
+	return nil
+}
+
+// Persist the state of the alert intake in its ConfigMap, creating it if needed.
+func saveIntakeState(ctx context.Context, namespace string, state IntakeState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	configMaps := clientset.CoreV1().ConfigMaps(namespace)
+
+	cm, err := configMaps.Get(ctx, intakeConfigMapName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = configMaps.Create(ctx, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      intakeConfigMapName,
+				Namespace: namespace,
+				Labels:    map[string]string{"app": "euphrosyne"},
+			},
+			Data: map[string]string{intakeStateKey: string(data)},
+		}, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if cm.Data == nil {
+		cm.Data = make(map[string]string)
+	}
+	cm.Data[intakeStateKey] = string(data)
+	_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+	return err
+}
+
+// Authenticate the requests to the admin API with the admin token. The admin API is disabled
+// unless a token is configured.
+func requireAdminToken(config *Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !validBearerToken(c, config.AdminToken) {
+			respondProblem(c, http.StatusUnauthorized, UnauthorizedProblem, "")
+			return
+		}
+		c.Next()
+	}
+}
+
+// Middleware rejecting alerts while the intake is paused, asking their senders to retry later.
+func checkIntake() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rejecting, retryAfter := intake.Rejecting()
+		if !rejecting {
+			c.Next()
+			return
+		}
+		alertsPaused.Inc()
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		problem := newProblem(
+			http.StatusServiceUnavailable, IntakePausedProblem,
+			"The alert intake is paused, retry later",
+		)
+		problem.Extensions = map[string]interface{}{"reason": intake.State().Reason}
+		respondWithProblem(c, problem)
+	}
+}
+
+// Handle a request to pause the alert intake.
+func handlePauseRequest(c *gin.Context, config *Config) {
+	request := struct {
+		Mode       string   `json:"mode"`
+		Reason     string   `json:"reason"`
+		RetryAfter Duration `json:"retryAfter"`
+	}{Mode: RejectPauseMode, RetryAfter: Duration{defaultPauseRetryAfter}}
+	// The body is optional, pausing with the defaults
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			respondProblem(
+				c, http.StatusBadRequest, InvalidRequestProblem,
+				fmt.Sprintf("Invalid pause request: %s", err),
+			)
+			return
+		}
+	}
+	if !isValidPauseMode(request.Mode) {
+		respondProblem(
+			c, http.StatusBadRequest, InvalidRequestProblem,
+			fmt.Sprintf("Invalid pause mode '%s', expected 'reject' or 'queue'", request.Mode),
+		)
+		return
+	}
+
+	pausedAt := time.Now().UTC()
+	state := IntakeState{
+		Paused:     true,
+		Mode:       request.Mode,
+		Reason:     request.Reason,
+		RetryAfter: request.RetryAfter,
+		PausedAt:   &pausedAt,
+	}
+	if !applyIntakeState(c, config, state) {
+		return
+	}
+	logger.Warn(
+		"Alert intake paused",
+		zap.String("mode", state.Mode),
+		zap.String("reason", state.Reason),
+		zap.String("remoteAddr", c.ClientIP()),
+	)
+	c.JSON(http.StatusOK, state)
+}
+
+// Handle a request to resume the alert intake, starting the executions held while it was paused.
+func handleResumeRequest(c *gin.Context, config *Config) {
+	state := IntakeState{}
+	if !applyIntakeState(c, config, state) {
+		return
+	}
+	executionQueue.Release()
+	logger.Info("Alert intake resumed", zap.String("remoteAddr", c.ClientIP()))
+	c.JSON(http.StatusOK, state)
+}
+
+// Handle a request for the state of the alert intake.
+func handleIntakeStateRequest(c *gin.Context) {
+	c.JSON(http.StatusOK, intake.State())
+}
+
+// Persist a new state of the alert intake before applying it, so that it is not lost on failover.
+func applyIntakeState(c *gin.Context, config *Config, state IntakeState) bool {
+	err := saveIntakeState(c.Request.Context(), config.ReconcilerNamespace, state)
+	if err != nil {
+		logger.Error("Failed to persist intake state", zap.Error(err))
+		respondProblem(c, http.StatusInternalServerError, InternalErrorProblem, err.Error())
+		return false
+	}
+	intake.set(state)
+	return true
+}
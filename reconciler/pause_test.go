@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that alerts are rejected with a Retry-After header while the intake is paused.
+func TestCheckIntake(t *testing.T) {
+	testCases := []struct {
+		name       string
+		state      IntakeState
+		status     int
+		retryAfter string
+	}{
+		{name: "Open", status: http.StatusOK},
+		{
+			name: "Reject",
+			state: IntakeState{
+				Paused: true, Mode: RejectPauseMode, Reason: "Maintenance",
+				RetryAfter: Duration{90 * time.Second},
+			},
+			status:     http.StatusServiceUnavailable,
+			retryAfter: "90",
+		},
+		{
+			name:   "Queue",
+			state:  IntakeState{Paused: true, Mode: QueuePauseMode},
+			status: http.StatusOK,
+		},
+	}
+
+	previous := intake
+	defer func() { intake = previous }()
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			intake = &Intake{}
+			intake.set(tc.state)
+
+			router := gin.New()
+			router.POST("/webhook", checkIntake(), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/webhook", nil))
+
+			assert.Equal(t, tc.status, w.Code)
+			assert.Equal(t, tc.retryAfter, w.Header().Get("Retry-After"))
+			if tc.status != http.StatusOK {
+				var problem map[string]interface{}
+				assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &problem))
+				assert.Equal(t, IntakePausedProblem, problem["code"])
+				assert.Equal(t, tc.state.Reason, problem["reason"])
+			}
+		})
+	}
+}
+
+// Test that the admin API requires the admin token, and is disabled without one.
+func TestRequireAdminToken(t *testing.T) {
+	testCases := []struct {
+		name   string
+		token  string
+		header string
+		status int
+	}{
+		{"Disabled", "", "Bearer ", http.StatusUnauthorized},
+		{"MissingToken", "admin-secret", "", http.StatusUnauthorized},
+		{"InvalidToken", "admin-secret", "Bearer api-secret", http.StatusUnauthorized},
+		{"MissingScheme", "admin-secret", "admin-secret", http.StatusUnauthorized},
+		{"ValidToken", "admin-secret", "Bearer admin-secret", http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/api/v1/admin/pause", requireAdminToken(&Config{AdminToken: tc.token}),
+				func(c *gin.Context) { c.Status(http.StatusOK) },
+			)
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/pause", nil)
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tc.status, w.Code)
+		})
+	}
+}
+
+// Test that pause requests with an unsupported mode are rejected before anything is persisted.
+func TestHandlePauseRequestInvalid(t *testing.T) {
+	for _, body := range []string{`{"mode": "drop"}`, `{"retryAfter": "soon"}`} {
+		router := gin.New()
+		router.POST("/api/v1/admin/pause", func(c *gin.Context) {
+			handlePauseRequest(c, &Config{})
+		})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(
+			http.MethodPost, "/api/v1/admin/pause", bytes.NewReader([]byte(body)),
+		))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.False(t, intake.State().Paused)
+	}
+}
+
+// Test that executions are held in the queue while the intake is paused, and started once it
+// resumes.
+func TestExecutionQueuePaused(t *testing.T) {
+	previous := intake
+	defer func() { intake = previous }()
+	intake = &Intake{}
+
+	q, started, release := newTestQueue(&Config{Workers: 10, QueueOverflow: RejectQueueOverflow})
+	defer close(release)
+
+	intake.set(IntakeState{Paused: true, Mode: RejectPauseMode})
+	err := q.Submit(context.Background(), &map[string]interface{}{"uuid": "paused-1"}, Alert)
+	assert.ErrorIs(t, err, errIntakePaused)
+
+	intake.set(IntakeState{Paused: true, Mode: QueuePauseMode})
+	assert.Nil(t, q.Submit(
+		context.Background(), &map[string]interface{}{"uuid": "paused-2"}, Alert,
+	))
+	select {
+	case uuid := <-started:
+		t.Fatalf("Execution '%s' started while the intake is paused", uuid)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	intake.set(IntakeState{})
+	q.Release()
+	assert.Equal(t, "paused-2", nextStarted(t, started))
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Comparison operators supported by PromQL queries.
+var pollOperators = map[string]func(value, threshold float64) bool{
+	">":  func(value, threshold float64) bool { return value > threshold },
+	">=": func(value, threshold float64) bool { return value >= threshold },
+	"<":  func(value, threshold float64) bool { return value < threshold },
+	"<=": func(value, threshold float64) bool { return value <= threshold },
+	"==": func(value, threshold float64) bool { return value == threshold },
+	"!=": func(value, threshold float64) bool { return value != threshold },
+}
+
+const defaultPollOperator = ">"
+
+// PollQuery is a PromQL expression evaluated periodically by the poller. Each series of the
+// result that crosses the threshold triggers a reconciliation for the named alert.
+type PollQuery struct {
+	Alertname   string            `json:"alertname"`
+	Expr        string            `json:"expr"`
+	Operator    string            `json:"operator,omitempty"`
+	Threshold   float64           `json:"threshold"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Check that a query can be evaluated.
+func (q PollQuery) validate() error {
+	if q.Alertname == "" {
+		return fmt.Errorf("PromQL queries must specify an alertname")
+	}
+	if q.Expr == "" {
+		return fmt.Errorf("PromQL query for alert '%s' must specify an expression", q.Alertname)
+	}
+	if _, ok := pollOperators[q.operator()]; !ok {
+		return fmt.Errorf(
+			"PromQL query for alert '%s' has an unsupported operator '%s'",
+			q.Alertname, q.Operator,
+		)
+	}
+	return nil
+}
+
+// Return the comparison operator of the query, falling back to the default one.
+func (q PollQuery) operator() string {
+	if q.Operator == "" {
+		return defaultPollOperator
+	}
+	return q.Operator
+}
+
+// Check whether a value crosses the threshold of the query.
+func (q PollQuery) crossed(value float64) bool {
+	return pollOperators[q.operator()](value, q.Threshold)
+}
+
+// PromSample is a single series of a PromQL query result.
+type PromSample struct {
+	Metric map[string]string
+	Value  float64
+}
+
+// Response of the Prometheus instant query API.
+type promQueryResponse struct {
+	Status    string `json:"status"`
+	ErrorType string `json:"errorType"`
+	Error     string `json:"error"`
+	Data      struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+// Poller periodically evaluates the PromQL queries of the recipe catalog against Prometheus and
+// triggers reconciliations when thresholds are crossed, for environments without Alertmanager.
+type Poller struct {
+	config *Config
+	mutex  sync.Mutex
+	// Series currently crossing their threshold, so that they only trigger once
+	firing map[string]bool
+}
+
+// Initialise a poller for the configured Prometheus endpoint.
+func NewPoller(config *Config) *Poller {
+	return &Poller{config: config, firing: make(map[string]bool)}
+}
+
+// Evaluate the queries periodically until the context is cancelled.
+func (p *Poller) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.Poll(ctx)
+		}
+	}
+}
+
+// Evaluate every query once, triggering a reconciliation for each series that started crossing
+// its threshold since the previous evaluation.
+func (p *Poller) Poll(ctx context.Context) {
+	rc, err := getRecipeCatalog(p.config.ReconcilerNamespace)
+	if err != nil {
+		logger.Error("Failed to retrieve PromQL queries from catalog", zap.Error(err))
+		return
+	}
+
+	for _, query := range rc.Queries {
+		samples, err := queryPrometheus(ctx, p.config.PrometheusURL, query.Expr)
+		pollerEvaluations.WithLabelValues(query.Alertname).Inc()
+		if err != nil {
+			logger.Error(
+				"Failed to evaluate PromQL query",
+				zap.String("alertname", query.Alertname),
+				zap.String("expr", query.Expr),
+				zap.Error(err),
+			)
+			pollerFailures.WithLabelValues(query.Alertname).Inc()
+			continue
+		}
+
+		for _, alertData := range p.evaluate(query, samples, time.Now().UTC()) {
+			alertData["uuid"] = newExecutionID(ctx)
+			logger.Info("Alert triggered by PromQL query", zap.Any("alert", alertData))
+			pollerAlerts.WithLabelValues(query.Alertname).Inc()
+
+			if err := submitRaisedAlert(ctx, alertData, p.config); err != nil {
+				logger.Warn("Dropping alert triggered by PromQL query", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Submit an alert raised by the reconciler itself, handling it exactly like the alerts received
+// on the webhook. Alerts that duplicate a recent alert or are in cooldown are skipped.
+func submitRaisedAlert(
+	ctx context.Context, alertData map[string]interface{}, config *Config,
+) error {
+	if _, ok := checkDedup(alertData, config); ok {
+		return nil
+	}
+	if _, ok := checkCooldown(alertData, config); ok {
+		dedups.Release(alertData["uuid"].(string))
+		return nil
+	}
+	if err := executionQueue.Submit(ctx, &alertData, Alert); err != nil {
+		dedups.Release(alertData["uuid"].(string))
+		cooldowns.Release(alertData["uuid"].(string))
+		return err
+	}
+	return nil
+}
+
+// Compare the samples of a query against its threshold, returning the alert data of the series
+// that started crossing it. Series that no longer cross it are reset, so that they can trigger
+// again in the future.
+func (p *Poller) evaluate(
+	query PollQuery, samples []PromSample, now time.Time,
+) []map[string]interface{} {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	crossing := make(map[string]bool)
+	var alerts []map[string]interface{}
+	for _, sample := range samples {
+		if !query.crossed(sample.Value) {
+			continue
+		}
+		key := seriesKey(query.Alertname, sample.Metric)
+		crossing[key] = true
+		if p.firing[key] {
+			continue
+		}
+		p.firing[key] = true
+
+		alertData, err := toMap(pollAlertData(query, sample, p.config.PrometheusURL, now))
+		if err != nil {
+			logger.Error("Failed to build alert data", zap.Error(err))
+			continue
+		}
+		alerts = append(alerts, alertData)
+	}
+
+	prefix := query.Alertname + "{"
+	for key := range p.firing {
+		if strings.HasPrefix(key, prefix) && !crossing[key] {
+			delete(p.firing, key)
+		}
+	}
+	return alerts
+}
+
+// Build an Alertmanager-like payload for a series crossing the threshold of a query, so that it
+// is handled exactly like the alerts received on the webhook.
+func pollAlertData(
+	query PollQuery, sample PromSample, prometheusURL string, now time.Time,
+) AlertmanagerPayload {
+	labels := make(map[string]string, len(sample.Metric)+len(query.Labels)+1)
+	for k, v := range sample.Metric {
+		labels[k] = v
+	}
+	delete(labels, "__name__")
+	for k, v := range query.Labels {
+		labels[k] = v
+	}
+	labels["alertname"] = query.Alertname
+
+	annotations := make(map[string]string, len(query.Annotations)+1)
+	for k, v := range query.Annotations {
+		annotations[k] = v
+	}
+	annotations["value"] = strconv.FormatFloat(sample.Value, 'g', -1, 64)
+
+	generatorURL := fmt.Sprintf(
+		"%s/graph?g0.expr=%s", strings.TrimSuffix(prometheusURL, "/"), url.QueryEscape(query.Expr),
+	)
+	alert := AlertmanagerAlert{
+		Status:       "firing",
+		Labels:       labels,
+		Annotations:  annotations,
+		StartsAt:     now,
+		GeneratorURL: generatorURL,
+		Fingerprint:  seriesKey(query.Alertname, sample.Metric),
+	}
+	return AlertmanagerPayload{
+		Version:           "4",
+		Status:            "firing",
+		Receiver:          "euphrosyne-poller",
+		GroupLabels:       map[string]string{"alertname": query.Alertname},
+		CommonLabels:      labels,
+		CommonAnnotations: annotations,
+		ExternalURL:       prometheusURL,
+		Alerts:            []AlertmanagerAlert{alert},
+	}
+}
+
+// Build a key identifying a series of a query result.
+func seriesKey(alertname string, metric map[string]string) string {
+	names := make([]string, 0, len(metric))
+	for name := range metric {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", name, metric[name]))
+	}
+	return alertname + "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Evaluate an instant PromQL query against the Prometheus HTTP API.
+func queryPrometheus(ctx context.Context, prometheusURL string, expr string) ([]PromSample, error) {
+	endpoint := strings.TrimSuffix(prometheusURL, "/") + "/api/v1/query"
+	req, err := http.NewRequestWithContext(
+		ctx, http.MethodPost, endpoint, strings.NewReader(url.Values{"query": {expr}}.Encode()),
+	)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := httpc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var response promQueryResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("Failed to decode Prometheus response (%s): %w", resp.Status, err)
+	}
+	if response.Status != "success" {
+		return nil, fmt.Errorf(
+			"Prometheus query failed (%s): %s", response.ErrorType, response.Error,
+		)
+	}
+	return parsePromResult(response.Data.ResultType, response.Data.Result)
+}
+
+// Parse the result of an instant query, which may be a vector or a scalar.
+func parsePromResult(resultType string, result json.RawMessage) ([]PromSample, error) {
+	switch resultType {
+	case "vector":
+		var vector []struct {
+			Metric map[string]string `json:"metric"`
+			Value  [2]interface{}    `json:"value"`
+		}
+		if err := json.Unmarshal(result, &vector); err != nil {
+			return nil, err
+		}
+		samples := make([]PromSample, 0, len(vector))
+		for _, v := range vector {
+			value, err := parsePromValue(v.Value)
+			if err != nil {
+				return nil, err
+			}
+			samples = append(samples, PromSample{Metric: v.Metric, Value: value})
+		}
+		return samples, nil
+	case "scalar":
+		var scalar [2]interface{}
+		if err := json.Unmarshal(result, &scalar); err != nil {
+			return nil, err
+		}
+		value, err := parsePromValue(scalar)
+		if err != nil {
+			return nil, err
+		}
+		return []PromSample{{Metric: map[string]string{}, Value: value}}, nil
+	}
+	return nil, fmt.Errorf("Unsupported PromQL result type '%s'", resultType)
+}
+
+// Parse a sample value, encoded by Prometheus as a [timestamp, "value"] pair.
+func parsePromValue(value [2]interface{}) (float64, error) {
+	s, ok := value[1].(string)
+	if !ok {
+		return 0, fmt.Errorf("Invalid sample value '%v'", value[1])
+	}
+	return strconv.ParseFloat(s, 64)
+}
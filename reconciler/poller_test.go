@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that series only trigger when they start crossing the threshold of a query.
+func TestPollerEvaluate(t *testing.T) {
+	p := NewPoller(&Config{PrometheusURL: "http://prometheus:9090"})
+	query := PollQuery{
+		Alertname:   "HighErrorRate",
+		Expr:        `sum by (service) (rate(http_errors_total[5m]))`,
+		Operator:    ">=",
+		Threshold:   1,
+		Labels:      map[string]string{"severity": "critical"},
+		Annotations: map[string]string{"summary": "Too many errors"},
+	}
+	now := time.Now().UTC()
+	web := map[string]string{"service": "web"}
+	api := map[string]string{"service": "api"}
+
+	alerts := p.evaluate(query, []PromSample{{web, 2}, {api, 0.5}}, now)
+	assert.Equal(t, 1, len(alerts))
+	assert.Equal(t, "HighErrorRate", alertLabels(alerts[0])["alertname"])
+	assert.Equal(t, "web", alertLabels(alerts[0])["service"])
+	assert.Equal(t, "critical", alertLabels(alerts[0])["severity"])
+	annotations := alerts[0]["commonAnnotations"].(map[string]interface{})
+	assert.Equal(t, "2", annotations["value"])
+
+	// Series that keep crossing the threshold don't trigger again
+	alerts = p.evaluate(query, []PromSample{{web, 3}, {api, 1}}, now)
+	assert.Equal(t, 1, len(alerts))
+	assert.Equal(t, "api", alertLabels(alerts[0])["service"])
+
+	// Series trigger again once they have recovered
+	assert.Empty(t, p.evaluate(query, []PromSample{{api, 1}}, now))
+	alerts = p.evaluate(query, []PromSample{{web, 1}, {api, 1}}, now)
+	assert.Equal(t, 1, len(alerts))
+	assert.Equal(t, "web", alertLabels(alerts[0])["service"])
+}
+
+// Test that PromQL queries are evaluated against the Prometheus HTTP API.
+func TestQueryPrometheus(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		expected []PromSample
+		wantErr  bool
+	}{
+		{
+			name: "Vector",
+			response: `{"status": "success", "data": {"resultType": "vector", "result": [
+				{"metric": {"service": "web"}, "value": [1700000000, "2.5"]}
+			]}}`,
+			expected: []PromSample{{Metric: map[string]string{"service": "web"}, Value: 2.5}},
+		},
+		{
+			name: "Scalar",
+			response: `{"status": "success", "data": {
+				"resultType": "scalar", "result": [1700000000, "1"]
+			}}`,
+			expected: []PromSample{{Metric: map[string]string{}, Value: 1}},
+		},
+		{
+			name: "Matrix",
+			response: `{"status": "success", "data": {
+				"resultType": "matrix", "result": []
+			}}`,
+			wantErr: true,
+		},
+		{
+			name:     "Error",
+			response: `{"status": "error", "errorType": "bad_data", "error": "parse error"}`,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/api/v1/query", r.URL.Path)
+				assert.Equal(t, "up == 0", r.FormValue("query"))
+				w.Write([]byte(tt.response))
+			}
+			server := httptest.NewServer(http.HandlerFunc(handler))
+			defer server.Close()
+			httpc = server.Client()
+
+			samples, err := queryPrometheus(context.Background(), server.URL, "up == 0")
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expected, samples)
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+const problemContentType = "application/problem+json"
+
+// Stable codes identifying the errors returned by the API.
+const (
+	InvalidAlertProblem         = "invalid-alert"
+	InvalidRequestProblem       = "invalid-request"
+	InvalidTemplateProblem      = "invalid-template"
+	InvalidRecipeProblem        = "invalid-recipe"
+	RecipeNotAllowedProblem     = "recipe-not-allowed"
+	OverrideNotAllowedProblem   = "override-not-allowed"
+	UnauthorizedProblem         = "unauthorized"
+	RecipeNotFoundProblem       = "recipe-not-found"
+	IncidentNotFoundProblem     = "incident-not-found"
+	IncidentNotActiveProblem    = "incident-not-active"
+	MessageNotFoundProblem      = "message-not-found"
+	ApprovalNotFoundProblem     = "approval-not-found"
+	ApprovalDecidedProblem      = "approval-decided"
+	QuotaExceededProblem        = "quota-exceeded"
+	QueueFullProblem            = "queue-full"
+	CatalogUnavailableProblem   = "catalog-unavailable"
+	NotLeaderProblem            = "not-leader"
+	IntakePausedProblem         = "intake-paused"
+	ShuttingDownProblem         = "shutting-down"
+	RouteNotFoundProblem        = "route-not-found"
+	DebugSessionNotFoundProblem = "debug-session-not-found"
+	SchemaNotFoundProblem       = "schema-not-found"
+	ResultStoreDisabledProblem  = "result-store-disabled"
+	InternalErrorProblem        = "internal-error"
+)
+
+var problemTitles = map[string]string{
+	InvalidAlertProblem:         "Invalid alert payload",
+	InvalidRequestProblem:       "Invalid request",
+	InvalidTemplateProblem:      "Invalid message template",
+	InvalidRecipeProblem:        "Invalid inline recipe",
+	RecipeNotAllowedProblem:     "Inline recipe not allowed",
+	OverrideNotAllowedProblem:   "Override not allowed",
+	UnauthorizedProblem:         "Unauthorized",
+	RecipeNotFoundProblem:       "Recipe not found",
+	IncidentNotFoundProblem:     "Incident not found",
+	IncidentNotActiveProblem:    "Incident not active",
+	MessageNotFoundProblem:      "Message not found",
+	ApprovalNotFoundProblem:     "Approval not found",
+	ApprovalDecidedProblem:      "Approval already decided",
+	QuotaExceededProblem:        "Quota exceeded",
+	QueueFullProblem:            "Execution queue full",
+	CatalogUnavailableProblem:   "Recipe catalog unavailable",
+	NotLeaderProblem:            "Replica on standby",
+	IntakePausedProblem:         "Alert intake paused",
+	ShuttingDownProblem:         "Reconciler shutting down",
+	RouteNotFoundProblem:        "Route not found",
+	DebugSessionNotFoundProblem: "Debugging session not found",
+	SchemaNotFoundProblem:       "Alert schema not found",
+	ResultStoreDisabledProblem:  "Result store not enabled",
+	InternalErrorProblem:        "Internal error",
+}
+
+var errRecipeNotFound = errors.New("Recipe not found")
+
+// Problem is an RFC 7807 problem details object describing an API error. The code is a stable
+// identifier integrators can rely on, while the detail is meant for humans.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     string `json:"code"`
+	// Additional members describing the problem
+	Extensions map[string]interface{} `json:"-"`
+}
+
+func (p Problem) MarshalJSON() ([]byte, error) {
+	type problem Problem
+	encoded, err := json.Marshal(problem(p))
+	if err != nil || len(p.Extensions) == 0 {
+		return encoded, err
+	}
+
+	members := make(map[string]interface{}, len(p.Extensions))
+	for k, v := range p.Extensions {
+		members[k] = v
+	}
+	// The standard members take precedence over the extensions
+	if err := json.Unmarshal(encoded, &members); err != nil {
+		return nil, err
+	}
+	return json.Marshal(members)
+}
+
+// Build the problem details for an error code.
+func newProblem(status int, code string, detail string) Problem {
+	return Problem{
+		Type:   "urn:euphrosyne:problem:" + code,
+		Title:  problemTitles[code],
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// Abort the request with the problem details for an error code.
+func respondProblem(c *gin.Context, status int, code string, detail string) {
+	respondWithProblem(c, newProblem(status, code, detail))
+}
+
+// Abort the request with the given problem details.
+func respondWithProblem(c *gin.Context, problem Problem) {
+	if problem.Instance == "" && c.Request != nil {
+		problem.Instance = c.Request.URL.Path
+	}
+	c.Header("Content-Type", problemContentType)
+	c.AbortWithStatusJSON(problem.Status, problem)
+}
+
+// Check whether an error was caused by a Kubernetes ResourceQuota rejecting a resource.
+func isQuotaExceeded(err error) bool {
+	return apierrors.IsForbidden(err) && strings.Contains(err.Error(), "exceeded quota")
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Test that problems are returned as problem details with a stable code.
+func TestRespondProblem(t *testing.T) {
+	router := gin.New()
+	router.GET("/incidents/:uuid", handleGetIncidentRequest)
+	router.POST("/incidents/:uuid/deny", func(c *gin.Context) {
+		problem := newProblem(http.StatusConflict, ApprovalDecidedProblem, "Already decided")
+		problem.Extensions = map[string]interface{}{"approval": "approved", "code": "overridden"}
+		respondWithProblem(c, problem)
+	})
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/incidents/missing", nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+	assert.Equal(t, problemContentType, recorder.Header().Get("Content-Type"))
+	var problem map[string]interface{}
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &problem))
+	assert.Equal(t, map[string]interface{}{
+		"type":     "urn:euphrosyne:problem:incident-not-found",
+		"title":    "Incident not found",
+		"status":   float64(http.StatusNotFound),
+		"instance": "/incidents/missing",
+		"code":     IncidentNotFoundProblem,
+	}, problem)
+
+	// Extensions are included, but cannot override the standard members
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/incidents/1/deny", nil))
+	assert.Equal(t, http.StatusConflict, recorder.Code)
+	problem = nil
+	assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &problem))
+	assert.Equal(t, ApprovalDecidedProblem, problem["code"])
+	assert.Equal(t, "Already decided", problem["detail"])
+	assert.Equal(t, "approved", problem["approval"])
+}
+
+// Test that action requests for recipes missing from the catalog are rejected.
+func TestValidateActionRequest(t *testing.T) {
+	catalogMutex.Lock()
+	previous := catalog
+	catalog = &RecipeCatalog{Actions: map[string]RecipeConfig{
+		"restart": {Enabled: true},
+		"scale":   {Enabled: false},
+	}}
+	catalogMutex.Unlock()
+	defer func() {
+		catalogMutex.Lock()
+		catalog = previous
+		catalogMutex.Unlock()
+	}()
+
+	testCases := []struct {
+		name    string
+		actions interface{}
+		code    string
+	}{
+		{
+			name: "Enabled",
+			actions: []interface{}{
+				map[string]interface{}{"name": "restart", "data": map[string]interface{}{}},
+			},
+		},
+		{
+			name: "Disabled",
+			actions: []interface{}{
+				map[string]interface{}{"name": "scale", "data": map[string]interface{}{}},
+			},
+			code: RecipeNotFoundProblem,
+		},
+		{
+			name: "Unknown",
+			actions: []interface{}{
+				map[string]interface{}{"name": "drain", "data": map[string]interface{}{}},
+			},
+			code: RecipeNotFoundProblem,
+		},
+		{
+			name:    "NotAList",
+			actions: "restart",
+			code:    InvalidRequestProblem,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data := map[string]interface{}{"uuid": "1", "actions": tc.actions}
+			problem, ok := validateActionRequest(data, &Config{})
+			assert.Equal(t, tc.code == "", ok)
+			assert.Equal(t, tc.code, problem.Code)
+		})
+	}
+}
+
+// Test that quota rejections are told apart from other forbidden errors.
+func TestIsQuotaExceeded(t *testing.T) {
+	resource := schema.GroupResource{Resource: "configmaps"}
+	quota := apierrors.NewForbidden(
+		resource, "data", errors.New("exceeded quota: recipes, requested: count/configmaps=1"),
+	)
+	assert.True(t, isQuotaExceeded(quota))
+	assert.False(t, isQuotaExceeded(apierrors.NewForbidden(resource, "data", errors.New("RBAC"))))
+	assert.False(t, isQuotaExceeded(errors.New("exceeded quota")))
+}
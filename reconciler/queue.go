@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Overflow policies for executions that cannot start right away.
+const (
+	EnqueueQueueOverflow = "enqueue"
+	RejectQueueOverflow  = "reject"
+)
+
+var errQueueFull = errors.New("Execution queue is full")
+
+// Queue holding back executions beyond the concurrency limits, initialised on start-up.
+var executionQueue *ExecutionQueue
+
+// ExecutionQueue admits recipe executions within a global concurrency limit and the concurrency
+// limits of each recipe, queueing the rest in order of arrival until capacity frees up. Admitted
+// executions are run by a fixed pool of workers, so that bursts of alerts cannot spawn an
+// unbounded number of goroutines.
+type ExecutionQueue struct {
+	config  *Config
+	mutex   sync.Mutex
+	pending []*queuedExecution
+	running int
+	// Admitted executions waiting for a worker to pick them up
+	ready chan *queuedExecution
+	// Number of running executions of each recipe
+	recipes map[string]int
+	// Function running an execution to completion
+	execute func(context.Context, *Config, *map[string]interface{}, RequestType)
+	// Function requesting approval for the actions of an execution, returning whether they were
+	// approved
+	approve func(context.Context, *Config, *map[string]interface{}) bool
+}
+
+// queuedExecution is an execution waiting for capacity, along with the limits of its recipes.
+type queuedExecution struct {
+	// Context of the request that submitted the execution, carrying its trace
+	ctx         context.Context
+	data        *map[string]interface{}
+	requestType RequestType
+	limits      map[string]int
+	enqueuedAt  time.Time
+	started     bool
+	// Function resuming a recovered execution, run instead of starting the execution anew
+	resume func()
+}
+
+// Initialise a queue, starting its pool of workers.
+func NewExecutionQueue(config *Config) *ExecutionQueue {
+	q := &ExecutionQueue{
+		config:  config,
+		ready:   make(chan *queuedExecution, config.Workers),
+		recipes: make(map[string]int),
+		execute: StartRecipeExecutor,
+		approve: awaitApproval,
+	}
+	for i := 0; i < config.Workers; i++ {
+		go q.work()
+	}
+	workerPoolSize.Set(float64(config.Workers))
+	return q
+}
+
+// Run the admitted executions one at a time.
+func (q *ExecutionQueue) work() {
+	for execution := range q.ready {
+		if execution.resume != nil {
+			execution.resume()
+		} else {
+			q.execute(execution.ctx, q.config, execution.data, execution.requestType)
+		}
+		q.finish(execution)
+	}
+}
+
+// Check whether an overflow policy is supported.
+func isValidQueueOverflow(policy string) bool {
+	return policy == EnqueueQueueOverflow || policy == RejectQueueOverflow
+}
+
+// Submit an execution, starting it right away if there is capacity for it. Executions that have
+// to wait are queued, unless the overflow policy rejects them or the queue is full. The execution
+// outlives the context it is submitted with, keeping only its values.
+func (q *ExecutionQueue) Submit(
+	ctx context.Context, data *map[string]interface{}, requestType RequestType,
+) error {
+	if drain.Draining() {
+		executionsRejected.WithLabelValues(requestType.String()).Inc()
+		return errShuttingDown
+	}
+	// Alerts raised by the reconciler itself are dropped like the ones received on the webhook
+	if rejecting, _ := intake.Rejecting(); rejecting && requestType == Alert {
+		executionsRejected.WithLabelValues(requestType.String()).Inc()
+		return errIntakePaused
+	}
+	execution := &queuedExecution{
+		ctx:         context.WithoutCancel(ctx),
+		data:        data,
+		requestType: requestType,
+		limits:      recipeConcurrencyLimits(q.config, data, requestType),
+		enqueuedAt:  time.Now(),
+	}
+	if requestType == Actions && q.config.ApprovalTimeout > 0 {
+		go q.awaitApproval(execution)
+		return nil
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.pending = append(q.pending, execution)
+	q.dispatch()
+	if execution.started {
+		return nil
+	}
+
+	// Executions are only held back by a paused intake, so they are queued regardless of the policy
+	if (q.config.QueueOverflow == RejectQueueOverflow && !intake.Holding()) ||
+		(q.config.QueueSize > 0 && len(q.pending) > q.config.QueueSize) {
+		q.pending = q.pending[:len(q.pending)-1]
+		queueDepth.Set(float64(len(q.pending)))
+		executionsRejected.WithLabelValues(requestType.String()).Inc()
+		return errQueueFull
+	}
+	incidentRegistry.RegisterQueued((*data)["uuid"].(string), requestType)
+	logger.Info(
+		"Execution queued until capacity is available",
+		zap.Any("uuid", (*data)["uuid"]),
+		zap.Int("queueDepth", len(q.pending)),
+	)
+	return nil
+}
+
+// Hold back the actions of an execution until they are approved, queueing the execution once they
+// are. Approvals are awaited outside of the workers and the concurrency limits, so that pending
+// approvals do not hold back other executions. Approved executions are queued whatever the
+// overflow policy.
+func (q *ExecutionQueue) awaitApproval(execution *queuedExecution) {
+	uuid := (*execution.data)["uuid"].(string)
+	incidentRegistry.Register(uuid, execution.requestType)
+	// Executions awaiting approval can be cancelled like the running ones
+	ctx := activeExecutions.Track(execution.ctx, uuid)
+	approved := q.approve(ctx, q.config, execution.data)
+	activeExecutions.Unregister(uuid)
+	if !approved {
+		logger.Info("Actions were not approved, skipping execution", zap.String("uuid", uuid))
+		incidentRegistry.Complete(uuid)
+		return
+	}
+
+	incidentRegistry.Update(uuid, func(incident *Incident) {
+		if incident.State == IncidentStateRunning {
+			incident.State = IncidentStateQueued
+		}
+	})
+	execution.enqueuedAt = time.Now()
+	q.enqueue(execution)
+}
+
+// Resume a recovered execution once there is capacity for it, so that it counts towards the
+// concurrency limits like the executions started anew. The recipes of recovered executions were
+// launched before the restart, so they are queued whatever the overflow policy.
+func (q *ExecutionQueue) Resume(r *Reconciler) {
+	execution := &queuedExecution{
+		ctx:         r.ctx,
+		data:        r.data,
+		requestType: r.requestType,
+		limits:      concurrencyLimits(r.recipes, r.data, r.requestType),
+		enqueuedAt:  time.Now(),
+		resume:      r.Run,
+	}
+	if !q.enqueue(execution) {
+		logger.Info(
+			"Recovered execution queued until capacity is available", zap.String("uuid", r.uuid),
+		)
+	}
+}
+
+// Queue an execution regardless of the overflow policy, starting it right away if there is capacity
+// for it. Returns whether the execution started.
+func (q *ExecutionQueue) enqueue(execution *queuedExecution) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.pending = append(q.pending, execution)
+	q.dispatch()
+	return execution.started
+}
+
+// Remove a queued execution before it starts, returning whether it was found. Recovered executions
+// are still run, so that they wind down as cancelled and their persisted state is deleted.
+func (q *ExecutionQueue) Cancel(uuid string) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for i, execution := range q.pending {
+		if (*execution.data)["uuid"] == uuid {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			queueDepth.Set(float64(len(q.pending)))
+			if execution.resume != nil {
+				go execution.resume()
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// Return the number of executions waiting to start.
+func (q *ExecutionQueue) Pending() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.pending)
+}
+
+// Start the pending executions there is capacity for, e.g. once the intake resumes.
+func (q *ExecutionQueue) Release() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.dispatch()
+}
+
+// Start the pending executions there is capacity for, in order of arrival. Executions held back
+// by the limit of one of their recipes do not block the ones behind them.
+func (q *ExecutionQueue) dispatch() {
+	remaining := q.pending[:0]
+	for _, execution := range q.pending {
+		if q.admissible(execution) {
+			q.start(execution)
+		} else {
+			remaining = append(remaining, execution)
+		}
+	}
+	q.pending = remaining
+	queueDepth.Set(float64(len(q.pending)))
+}
+
+// Check whether an execution fits within the worker pool, the global limit and the limits of its
+// recipes. No execution is admitted while the intake holds them, or once the running ones are
+// suspended on shutdown, besides the recovered ones, which were admitted before the restart and
+// are suspended again as soon as they run.
+func (q *ExecutionQueue) admissible(execution *queuedExecution) bool {
+	if execution.resume == nil && (intake.Holding() || drain.Suspending()) {
+		return false
+	}
+	if q.running >= q.config.Workers {
+		return false
+	}
+	if q.config.MaxConcurrentExecutions > 0 && q.running >= q.config.MaxConcurrentExecutions {
+		return false
+	}
+	for recipeName, limit := range execution.limits {
+		if limit > 0 && q.recipes[recipeName] >= limit {
+			return false
+		}
+	}
+	return true
+}
+
+// Hand an execution over to the workers, holding its share of the limits until it completes. The
+// admitted executions never outnumber the workers, so this does not block.
+func (q *ExecutionQueue) start(execution *queuedExecution) {
+	execution.started = true
+	q.running++
+	for recipeName := range execution.limits {
+		q.recipes[recipeName]++
+	}
+	q.reportUsage()
+	queueWait.Observe(time.Since(execution.enqueuedAt).Seconds())
+	q.ready <- execution
+}
+
+// Report the number of running executions and the share of the workers they occupy.
+func (q *ExecutionQueue) reportUsage() {
+	runningExecutions.Set(float64(q.running))
+	workerPoolSaturation.Set(float64(q.running) / float64(q.config.Workers))
+}
+
+// Release the share of the limits held by a completed execution, starting any that were waiting.
+func (q *ExecutionQueue) finish(execution *queuedExecution) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.running--
+	for recipeName := range execution.limits {
+		q.recipes[recipeName]--
+		if q.recipes[recipeName] == 0 {
+			delete(q.recipes, recipeName)
+		}
+	}
+	q.reportUsage()
+	q.dispatch()
+}
+
+// Determine the recipes an execution is going to run locally, along with their concurrency limits.
+func recipeConcurrencyLimits(
+	config *Config, data *map[string]interface{}, requestType RequestType,
+) map[string]int {
+	limits := make(map[string]int)
+	recipes, _, err := executionRecipes(config, data, requestType)
+	if err != nil {
+		return limits
+	}
+	return concurrencyLimits(recipes, data, requestType)
+}
+
+// Determine the concurrency limits of the recipes out of the provided ones that an execution is
+// going to run locally.
+func concurrencyLimits(
+	recipes map[string]Recipe, data *map[string]interface{}, requestType RequestType,
+) map[string]int {
+	limits := make(map[string]int)
+
+	// Only the requested action recipes are run
+	if requestType == Actions {
+		requested := make(map[string]Recipe)
+		if actions, err := parseActionData(data); err == nil {
+			for _, action := range actions {
+				if recipe, ok := recipes[action.Name]; ok {
+					requested[action.Name] = recipe
+				}
+			}
+		}
+		recipes = requested
+	}
+
+	for recipeName, recipe := range recipes {
+		if recipe.Config != nil && recipe.Config.Peer == "" {
+			limits[recipeName] = recipe.Config.Concurrency
+		}
+	}
+	return limits
+}
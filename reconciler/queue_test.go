@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Start a queue whose executions block until released, reporting the UUIDs they start with.
+func newTestQueue(config *Config) (*ExecutionQueue, chan string, chan struct{}) {
+	started := make(chan string, 10)
+	release := make(chan struct{})
+	q := NewExecutionQueue(config)
+	q.execute = func(_ context.Context, _ *Config, data *map[string]interface{}, _ RequestType) {
+		started <- (*data)["uuid"].(string)
+		<-release
+	}
+	return q, started, release
+}
+
+// Wait for the next execution to start, failing if none starts in time.
+func nextStarted(t *testing.T, started chan string) string {
+	select {
+	case uuid := <-started:
+		return uuid
+	case <-time.After(time.Second):
+		t.Fatal("Execution did not start")
+		return ""
+	}
+}
+
+// Test that executions beyond the global limit or the worker pool are queued or rejected by the
+// overflow policy.
+func TestExecutionQueue(t *testing.T) {
+	testCases := []struct {
+		name     string
+		config   Config
+		rejected []bool
+	}{
+		{
+			name: "Enqueue",
+			config: Config{
+				Workers: 10, MaxConcurrentExecutions: 1, QueueOverflow: EnqueueQueueOverflow,
+			},
+			rejected: []bool{false, false, false},
+		},
+		{
+			name: "QueueFull",
+			config: Config{
+				Workers:                 10,
+				MaxConcurrentExecutions: 1,
+				QueueSize:               1,
+				QueueOverflow:           EnqueueQueueOverflow,
+			},
+			rejected: []bool{false, false, true},
+		},
+		{
+			name:     "WorkersBusy",
+			config:   Config{Workers: 1, QueueOverflow: EnqueueQueueOverflow},
+			rejected: []bool{false, false, false},
+		},
+		{
+			name: "Reject",
+			config: Config{
+				Workers: 10, MaxConcurrentExecutions: 1, QueueOverflow: RejectQueueOverflow,
+			},
+			rejected: []bool{false, true, true},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := tc.config
+			q, started, release := newTestQueue(&config)
+			defer close(release)
+
+			for i, rejected := range tc.rejected {
+				uuid := fmt.Sprintf("queue-%s-%d", tc.name, i)
+				err := q.Submit(context.Background(), &map[string]interface{}{"uuid": uuid}, Alert)
+				if rejected {
+					assert.ErrorIs(t, err, errQueueFull)
+					continue
+				}
+				assert.Nil(t, err)
+				if i > 0 {
+					incident, ok := incidentRegistry.Get(uuid)
+					assert.True(t, ok)
+					assert.Equal(t, IncidentStateQueued, incident.State)
+				}
+			}
+			assert.Equal(t, fmt.Sprintf("queue-%s-0", tc.name), nextStarted(t, started))
+
+			// Completing an execution starts the next one in order of arrival
+			if !tc.rejected[1] {
+				release <- struct{}{}
+				assert.Equal(t, fmt.Sprintf("queue-%s-1", tc.name), nextStarted(t, started))
+			}
+		})
+	}
+}
+
+// Test that executions are held back by the concurrency limits of their recipes, without blocking
+// the executions of other recipes.
+func TestExecutionQueueRecipeLimits(t *testing.T) {
+	catalogMutex.Lock()
+	previous := catalog
+	catalog = &RecipeCatalog{
+		Debugging: map[string]RecipeConfig{"heap-dump": {Enabled: true, Concurrency: 1}},
+		Actions:   map[string]RecipeConfig{"restart": {Enabled: true}},
+	}
+	catalogMutex.Unlock()
+	defer func() {
+		catalogMutex.Lock()
+		catalog = previous
+		catalogMutex.Unlock()
+	}()
+
+	q, started, release := newTestQueue(&Config{Workers: 10, QueueOverflow: EnqueueQueueOverflow})
+	defer close(release)
+
+	assert.Nil(t, q.Submit(
+		context.Background(), &map[string]interface{}{"uuid": "limits-1"}, Alert,
+	))
+	assert.Equal(t, "limits-1", nextStarted(t, started))
+	assert.Nil(t, q.Submit(
+		context.Background(), &map[string]interface{}{"uuid": "limits-2"}, Alert,
+	))
+	action := map[string]interface{}{
+		"uuid": "limits-3",
+		"actions": []interface{}{
+			map[string]interface{}{"name": "restart", "data": map[string]interface{}{}},
+		},
+	}
+	assert.Nil(t, q.Submit(context.Background(), &action, Actions))
+	assert.Equal(t, "limits-3", nextStarted(t, started))
+
+	release <- struct{}{}
+	assert.Equal(t, "limits-2", nextStarted(t, started))
+}
+
+// Test that queued executions are removed from the queue when they are cancelled.
+func TestExecutionQueueCancel(t *testing.T) {
+	q, started, release := newTestQueue(&Config{Workers: 10, MaxConcurrentExecutions: 1})
+	defer close(release)
+
+	for _, uuid := range []string{"cancel-1", "cancel-2", "cancel-3"} {
+		assert.Nil(t, q.Submit(context.Background(), &map[string]interface{}{"uuid": uuid}, Alert))
+	}
+	assert.Equal(t, "cancel-1", nextStarted(t, started))
+	assert.True(t, q.Cancel("cancel-2"))
+	assert.False(t, q.Cancel("cancel-2"))
+
+	release <- struct{}{}
+	assert.Equal(t, "cancel-3", nextStarted(t, started))
+}
+
+// Test that actions awaiting approval hold neither a worker nor a share of the limits, and are
+// queued once approved.
+func TestExecutionQueueApproval(t *testing.T) {
+	q, started, release := newTestQueue(&Config{Workers: 1, ApprovalTimeout: time.Minute})
+	defer close(release)
+	decisions := make(chan bool)
+	q.approve = func(_ context.Context, _ *Config, _ *map[string]interface{}) bool {
+		return <-decisions
+	}
+
+	for _, uuid := range []string{"approval-1", "approval-2"} {
+		assert.Nil(t, q.Submit(context.Background(), &map[string]interface{}{"uuid": uuid}, Actions))
+	}
+	assert.Nil(t, q.Submit(
+		context.Background(), &map[string]interface{}{"uuid": "approval-3"}, Alert,
+	))
+	assert.Equal(t, "approval-3", nextStarted(t, started))
+
+	// Approved actions wait for the worker, denied ones are skipped
+	decisions <- true
+	assert.Eventually(t, func() bool { return q.Pending() == 1 }, time.Second, 10*time.Millisecond)
+	decisions <- false
+	release <- struct{}{}
+	uuid := nextStarted(t, started)
+	assert.Contains(t, []string{"approval-1", "approval-2"}, uuid)
+	assert.Equal(t, 0, q.Pending())
+	assert.Eventually(
+		t, func() bool { return activeExecutions.Len() == 0 }, time.Second, 10*time.Millisecond,
+	)
+}
+
+// Test that recovered executions are subject to the limits, and are still run when cancelled so
+// that they wind down.
+func TestExecutionQueueResume(t *testing.T) {
+	q, started, release := newTestQueue(&Config{Workers: 1})
+	defer close(release)
+	recovered := func(uuid string) *queuedExecution {
+		return &queuedExecution{
+			ctx:  context.Background(),
+			data: &map[string]interface{}{"uuid": uuid},
+			resume: func() {
+				started <- uuid
+				<-release
+			},
+		}
+	}
+
+	assert.True(t, q.enqueue(recovered("resume-1")))
+	assert.Equal(t, "resume-1", nextStarted(t, started))
+	assert.False(t, q.enqueue(recovered("resume-2")))
+	assert.False(t, q.enqueue(recovered("resume-3")))
+
+	assert.True(t, q.Cancel("resume-2"))
+	assert.Equal(t, "resume-2", nextStarted(t, started))
+	release <- struct{}{}
+	release <- struct{}{}
+	assert.Equal(t, "resume-3", nextStarted(t, started))
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Statuses of a completed recipe, as reported by the recipe itself.
+const (
+	RecipeStatusSuccessful = "successful"
+	RecipeStatusFailed     = "failed"
+	RecipeStatusUnknown    = "unknown"
+)
+
+// Versions of the schema of the results messages published by recipes. Messages without a schema
+// follow the original format, which is validated less strictly.
+const (
+	ResultSchemaV1     = "results/v1"
+	LegacyResultSchema = "legacy"
+)
+
+// Recipe is a recipe taking part in an execution, along with its results once it completes.
+type Recipe struct {
+	Config   *RecipeConfig `json:"config,omitempty" yaml:"config,omitempty"`
+	Attempts int           `json:"attempts,omitempty" yaml:"attempts,omitempty"`
+	// Whether the results were reused from a previous execution
+	Cached    bool             `json:"cached,omitempty" yaml:"cached,omitempty"`
+	Execution *RecipeExecution `json:"execution,omitempty" yaml:"execution,omitempty"`
+}
+
+// RecipeExecution is the message a recipe publishes once it completes.
+type RecipeExecution struct {
+	// Name of the recipe
+	Name string `json:"name" yaml:"name"`
+	// ID of the execution the recipe ran for
+	Incident string        `json:"incident" yaml:"incident"`
+	Status   string        `json:"status" yaml:"status"`
+	Results  RecipeResults `json:"results" yaml:"results"`
+}
+
+// RecipeResults are the results reported by a recipe.
+type RecipeResults struct {
+	// Actions suggested to resolve the incident
+	Actions  []string `json:"actions" yaml:"actions"`
+	Analysis string   `json:"analysis" yaml:"analysis"`
+	// Free-form results, encoded as JSON by the recipe
+	JSON  string   `json:"json" yaml:"json"`
+	Links []string `json:"links" yaml:"links"`
+	// Whether the results call for action, rather than being informational. Results that do not
+	// say are considered actionable.
+	Actionable *bool `json:"actionable,omitempty" yaml:"actionable,omitempty"`
+}
+
+// Check whether the results call for action.
+func (r RecipeResults) IsActionable() bool {
+	return r.Actionable == nil || *r.Actionable
+}
+
+// Create the results message of a recipe.
+func NewRecipeExecution(
+	name string, incident string, status string, results RecipeResults,
+) *RecipeExecution {
+	return &RecipeExecution{Name: name, Incident: incident, Status: status, Results: results}
+}
+
+// Create a recipe that completed with the given results message.
+func NewCompletedRecipe(execution *RecipeExecution) Recipe {
+	return Recipe{Execution: execution}
+}
+
+// RecipeResultsError is returned for results messages that fail to be parsed or validated. The
+// recipe that published the message is included if it could be identified.
+type RecipeResultsError struct {
+	Recipe string
+	Schema string
+	Err    error
+}
+
+func (e *RecipeResultsError) Error() string {
+	return fmt.Sprintf("Invalid recipe results: %s", e.Err)
+}
+
+func (e *RecipeResultsError) Unwrap() error {
+	return e.Err
+}
+
+// Parse the results message of a recipe from JSON, validating it against its schema.
+func ParseRecipeExecution(data []byte) (*RecipeExecution, error) {
+	var header struct {
+		Schema json.RawMessage `json:"schema"`
+		Name   json.RawMessage `json:"name"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, &RecipeResultsError{Err: err}
+	}
+	var schema, name string
+	_ = json.Unmarshal(header.Name, &name)
+	if len(header.Schema) > 0 && json.Unmarshal(header.Schema, &schema) != nil {
+		return nil, &RecipeResultsError{Recipe: name, Err: errors.New("Expected a string schema")}
+	}
+
+	var execution *RecipeExecution
+	var err error
+	switch schema {
+	case "":
+		schema = LegacyResultSchema
+		execution, err = parseLegacyRecipeExecution(data)
+	case ResultSchemaV1:
+		execution, err = parseRecipeExecutionV1(data)
+	default:
+		return nil, &RecipeResultsError{
+			Recipe: name, Err: fmt.Errorf("Unsupported schema '%s'", schema),
+		}
+	}
+	if err != nil {
+		return nil, &RecipeResultsError{Recipe: name, Schema: schema, Err: err}
+	}
+	return execution, nil
+}
+
+// Parse a results message in the original format, which predates the versioned schemas. Only the
+// types of the fields and the status are validated.
+func parseLegacyRecipeExecution(data []byte) (*RecipeExecution, error) {
+	var execution RecipeExecution
+	if err := json.Unmarshal(data, &execution); err != nil {
+		return nil, err
+	}
+	if err := validateRecipeStatus(execution.Status); err != nil {
+		return nil, err
+	}
+	return &execution, nil
+}
+
+// Parse a `results/v1` message, rejecting unknown fields, missing identifiers and free-form
+// results that are not valid JSON.
+func parseRecipeExecutionV1(data []byte) (*RecipeExecution, error) {
+	var message struct {
+		Schema string `json:"schema"`
+		RecipeExecution
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&message); err != nil {
+		return nil, err
+	}
+
+	execution := message.RecipeExecution
+	switch {
+	case execution.Name == "":
+		return nil, errors.New("Missing recipe name")
+	case execution.Incident == "":
+		return nil, errors.New("Missing incident")
+	}
+	if err := validateRecipeStatus(execution.Status); err != nil {
+		return nil, err
+	}
+	if execution.Results.JSON != "" && !json.Valid([]byte(execution.Results.JSON)) {
+		return nil, errors.New("Field 'json' does not hold valid JSON")
+	}
+	for _, link := range execution.Results.Links {
+		if link == "" {
+			return nil, errors.New("Field 'links' holds an empty link")
+		}
+	}
+	return &execution, nil
+}
+
+// Check that the status reported by a recipe is known.
+func validateRecipeStatus(status string) error {
+	statuses := []string{RecipeStatusSuccessful, RecipeStatusFailed, RecipeStatusUnknown}
+	if !slices.Contains(statuses, status) {
+		return fmt.Errorf("Unsupported status '%s'", status)
+	}
+	return nil
+}
+
+// Parse the results message of a recipe from YAML.
+func ParseRecipeExecutionYAML(data []byte) (*RecipeExecution, error) {
+	var execution RecipeExecution
+	if err := yaml.Unmarshal(data, &execution); err != nil {
+		return nil, fmt.Errorf("Invalid recipe results: %w", err)
+	}
+	return &execution, nil
+}
+
+// Encode the results message of a recipe as JSON.
+func (e *RecipeExecution) JSON() ([]byte, error) {
+	return json.Marshal(e)
+}
+
+// Encode the results message of a recipe as YAML.
+func (e *RecipeExecution) YAML() ([]byte, error) {
+	return yaml.Marshal(e)
+}
+
+// Check whether the recipe completed successfully.
+func (e *RecipeExecution) Succeeded() bool {
+	return e != nil && e.Status == RecipeStatusSuccessful
+}
@@ -5,12 +5,12 @@ import (
 	"encoding/json"
 	"fmt"
 
-	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"sigs.k8s.io/yaml"
 )
 
 var (
@@ -18,88 +18,169 @@ var (
 )
 
 const (
+	// Label of the run of the execution that created a recipe Job
+	executionLabel     = "execution"
 	configMapMountPath = "/app"
 	configMapFileName  = "data.json"
 	configMapFilePath  = configMapMountPath + "/" + configMapFileName
 )
 
-// Initialise and run the recipe executor.
+// Initialise and run the recipe executor, returning once the execution completes.
 func StartRecipeExecutor(
-	c *gin.Context, config *Config, data *map[string]interface{}, requestType RequestType,
+	c context.Context, config *Config, data *map[string]interface{}, requestType RequestType,
 ) {
-	// Retrieve recipes from ConfigMap
-	recipes, err := getRecipesFromConfigMap(requestType, true, config.ReconcilerNamespace)
+	uuid := (*data)["uuid"].(string)
+	config = executionConfig(config, *data)
+	c, span := tracer.Start(
+		c, "execution",
+		trace.WithAttributes(
+			attribute.String("euphrosyne.incident", uuid),
+			attribute.String("euphrosyne.request_type", requestType.String()),
+		),
+	)
+	defer span.End()
+
+	// Add what is known about the node of node-related alerts
+	if requestType == Alert {
+		enrichNodeProblems(*data, config)
+	}
+
+	incidentRegistry.Start(uuid, requestType)
+
+	// Retrieve recipes from the loaded catalog
+	recipes, rc, err := executionRecipes(config, data, requestType)
 	if err != nil {
-		logger.Error("Failed to retrieve recipes from ConfigMap", zap.Error(err))
+		logger.Error("Failed to retrieve recipes from catalog", zap.Error(err))
+		recordSpanError(span, err)
+		incidentRegistry.Fail(uuid, err)
 		return
 	}
-	logger.Info("Retrieved recipes from ConfigMap", zap.Any("recipes", recipes))
+	logger.Info(
+		"Retrieved recipes from catalog",
+		zap.String("catalogHash", rc.Hash),
+		zap.Any("recipes", recipes),
+	)
 
-	uuid := (*data)["uuid"].(string)
+	if _, verifies := parseVerification(*data); requestType == Alert && !verifies {
+		incidentRegistry.SetFingerprint(uuid, alertFingerprint(*data, config.DedupFields))
+	}
+	if requestType == Alert {
+		incidentRegistry.SetCompliance(uuid, requiredRecipes(rc, recipes, *data))
+	}
+	startIncidentThread(uuid, requestType, *data)
+
+	// Keep track of the execution, so that it can be cancelled
+	c = activeExecutions.Track(c, uuid)
+	defer activeExecutions.Unregister(uuid)
 
 	reconciler, err := NewReconciler(c, config, data, recipes, requestType)
 	if err != nil {
 		logger.Error("Failed to create reconciler", zap.Error(err))
+		recordSpanError(span, err)
+		incidentRegistry.Fail(uuid, err)
 		return
 	}
 
 	if requestType == Actions {
-		err = runActionRecipes(uuid, recipes, data, config)
+		err = reconciler.runActionRecipes()
 		if err != nil {
 			logger.Error("Failed to create jobs for Action", zap.Error(err))
+			recordSpanError(span, err)
+			reconciler.abort(err)
 			return
 		}
 	} else if requestType == Alert {
-		err = runDebuggingRecipes(uuid, recipes, data, config)
+		err = reconciler.runDebuggingRecipes()
 		if err != nil {
 			logger.Error("Failed to create jobs for Alert", zap.Error(err))
+			recordSpanError(span, err)
+			reconciler.abort(err)
 			return
 		}
 	}
 
-	go reconciler.Run()
-
 	logger.Info("Recipe execution started successfully")
+	reconciler.Run()
+}
+
+// Fail an execution whose recipes could not all be launched. Nothing is going to collect the
+// results of the Jobs launched so far, so they are deleted along with the ConfigMaps created for
+// them and the persisted state of the execution.
+func (r *Reconciler) abort(err error) {
+	r.results.Close()
+
+	launched := make([]Recipe, 0, len(r.jobs))
+	for recipeName := range r.jobs {
+		launched = append(launched, Recipe{Execution: &RecipeExecution{Name: recipeName}})
+	}
+	labels := map[string]string{"app": "euphrosyne", "uuid": r.uuid}
+	jobErr := r.deleteCompletedJobsWithLabels(launched, map[string]string{
+		"app": "euphrosyne", "uuid": r.uuid, executionLabel: r.execution,
+	})
+	if jobErr != nil {
+		logger.Error("Failed to delete the Jobs of the failed execution", zap.Error(jobErr))
+		cleanupFailures.WithLabelValues("jobs").Inc()
+	}
+	if cmErr := r.deleteConfigMapsWithLabels(labels); cmErr != nil {
+		logger.Error("Failed to delete the ConfigMaps of the failed execution", zap.Error(cmErr))
+		cleanupFailures.WithLabelValues("configmaps").Inc()
+	}
+
+	r.deleteExecution()
+	incidentRegistry.Fail(r.uuid, err)
 }
 
-// Retrieve recipes from ConfigMap, optionally filtering by enabled status.
+// Retrieve recipes from the loaded catalog, optionally filtering by enabled status.
 func getRecipesFromConfigMap(
 	requestType RequestType, filterEnabled bool, namespace string,
 ) (map[string]Recipe, error) {
-	configMap, err := clientset.CoreV1().ConfigMaps(namespace).Get(
-		context.TODO(), configMapName, metav1.GetOptions{},
-	)
+	rc, err := getRecipeCatalog(namespace)
 	if err != nil {
 		return nil, err
 	}
+	return rc.Recipes(requestType, filterEnabled), nil
+}
 
-	var recipeConfigMap map[string]RecipeConfig
-	if requestType == Actions {
-		err = yaml.Unmarshal([]byte(configMap.Data["actions"]), &recipeConfigMap)
-	} else {
-		err = yaml.Unmarshal([]byte(configMap.Data["debugging"]), &recipeConfigMap)
+// Create a Kubernetes ConfigMap for the recipe data in the target of the recipes using it.
+func createConfigMap(
+	ctx context.Context, data *map[string]interface{}, uuid string, target RecipeTarget,
+) (*corev1.ConfigMap, error) {
+	client, err := clientsetFor(target.Cluster)
+	if err != nil {
+		return nil, err
 	}
+	cm, err := buildConfigMap(data, uuid, target.Namespace)
 	if err != nil {
 		return nil, err
 	}
 
-	recipeMap := make(map[string]Recipe)
-	for recipeName, recipeConfig := range recipeConfigMap {
-		recipeConfigCopy := recipeConfig
-		if recipeConfigCopy.Enabled || !filterEnabled {
-			recipeMap[recipeName] = Recipe{Config: &recipeConfigCopy}
-		}
+	cm, err = client.CoreV1().ConfigMaps(target.Namespace).Create(ctx, cm, metav1.CreateOptions{})
+	if err != nil {
+		return nil, err
 	}
 
-	return recipeMap, nil
+	logger.Info(
+		"ConfigMap created successfully",
+		zap.String("configMapName", cm.Name),
+		zap.Stringer("target", target),
+	)
+
+	return cm, nil
 }
 
-// Create a Kubernetes ConfigMap for the recipe data.
-func createConfigMap(
-	data *map[string]interface{}, uuid string, namespace string,
+// Create a ConfigMap for the data of the recipes of the reconciler in one of their targets.
+func (r *Reconciler) createConfigMap(
+	data *map[string]interface{}, target RecipeTarget,
 ) (*corev1.ConfigMap, error) {
-	cmClient := clientset.CoreV1().ConfigMaps(namespace)
+	ctx, cancel := r.requestContext()
+	defer cancel()
+	return createConfigMap(ctx, data, r.uuid, target)
+}
 
+// Build the ConfigMap holding the data of a recipe, without creating it.
+func buildConfigMap(
+	data *map[string]interface{}, uuid string, namespace string,
+) (*corev1.ConfigMap, error) {
 	//Marshal the data into JSON format
 	dataJSON, err := json.Marshal(data)
 	if err != nil {
@@ -107,7 +188,7 @@ func createConfigMap(
 	}
 
 	//Create the ConfigMap for data
-	cm := &corev1.ConfigMap{
+	return &corev1.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
 			GenerateName: "euphrosyne-recipes-",
 			Namespace:    namespace,
@@ -119,24 +200,41 @@ func createConfigMap(
 		Data: map[string]string{
 			configMapFileName: string(dataJSON),
 		},
-	}
+	}, nil
+}
 
-	cm, err = cmClient.Create(context.TODO(), cm, metav1.CreateOptions{})
+// Create a Kubernetes Job to execute a recipe, passing it the trace context. The Job is labelled
+// with the run of the execution that created it.
+func createJob(
+	ctx context.Context, recipeName string, recipe Recipe, uuid string, execution string,
+	cmName string, config *Config,
+) (*batchv1.Job, error) {
+	target := recipeTarget(recipe.Config, config)
+	client, err := clientsetFor(target.Cluster)
+	if err != nil {
+		return nil, err
+	}
+	job := buildJob(recipeName, recipe, uuid, cmName, config)
+	job.Labels[executionLabel] = execution
+	injectTraceContext(ctx, &job.Spec.Template.Spec.Containers[0])
+	job, err = client.BatchV1().Jobs(target.Namespace).Create(ctx, job, metav1.CreateOptions{})
 	if err != nil {
 		return nil, err
 	}
 
-	logger.Info("ConfigMap created successfully", zap.String("configMapName", cm.Name))
+	logger.Info(
+		"Job created successfully",
+		zap.String("jobName", job.Name),
+		zap.Stringer("target", target),
+	)
 
-	return cm, nil
+	return job, nil
 }
 
-// Create a Kubernetes Job to execute a recipe.
-func createJob(
+// Build the Kubernetes Job executing a recipe, without creating it.
+func buildJob(
 	recipeName string, recipe Recipe, uuid string, cmName string, config *Config,
-) (*batchv1.Job, error) {
-	jobClient := clientset.BatchV1().Jobs(config.RecipeNamespace)
-
+) *batchv1.Job {
 	// Define the Job object
 	job := &batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
@@ -149,7 +247,7 @@ func createJob(
 				"recipe": recipeName,
 				"uuid":   uuid,
 			},
-			Namespace: config.RecipeNamespace,
+			Namespace: recipeTarget(recipe.Config, config).Namespace,
 		},
 		Spec: batchv1.JobSpec{
 			Template: corev1.PodTemplateSpec{
@@ -189,6 +287,22 @@ func createJob(
 								buildRecipeCommand(recipe.Config, config),
 							},
 							Env: []corev1.EnvVar{
+								{
+									Name:  resultBrokerEnvVar,
+									Value: config.ResultBroker,
+								},
+								{
+									Name:  resultBrokerAddressEnvVar,
+									Value: resultBrokerAddress(config),
+								},
+								{
+									Name:  resultTopicEnvVar,
+									Value: resultBroker.Topic(uuid),
+								},
+								{
+									Name:  resultKeyEnvVar,
+									Value: uuid,
+								},
 								{
 									Name: "JIRA_URL",
 									ValueFrom: &corev1.EnvVarSource{
@@ -231,65 +345,261 @@ func createJob(
 			BackoffLimit: int32Ptr(0),
 		},
 	}
+	applyRecipeOverrides(&job.Spec, recipe.Config)
+	applyCleanupPolicy(job, recipe.Config, config)
+	return job
+}
+
+// Apply the overrides declared by a recipe to the spec of its Job. Recipes with their own timeout
+// are terminated by Kubernetes once it expires, and then handled like any other failed Job.
+func applyRecipeOverrides(spec *batchv1.JobSpec, recipeConfig *RecipeConfig) {
+	if recipeConfig.Timeout.Duration > 0 {
+		activeDeadline := int64(recipeConfig.Timeout.Seconds())
+		spec.ActiveDeadlineSeconds = &activeDeadline
+	}
+
+	podSpec := &spec.Template.Spec
+	if recipeConfig.Resources != nil {
+		podSpec.Containers[0].Resources = *recipeConfig.Resources
+	}
+	podSpec.NodeSelector = recipeConfig.NodeSelector
+	podSpec.Tolerations = recipeConfig.Tolerations
+	podSpec.ServiceAccountName = recipeConfig.ServiceAccount
+}
+
+// Find the Jobs already created by a run of an execution across the targets of its recipes, indexed
+// by recipe name. This allows recovered executions to adopt existing Jobs instead of creating
+// duplicates. If a recipe has more than one Job, the most recent one is returned.
+func getExistingJobs(
+	ctx context.Context, uuid string, execution string, targets []RecipeTarget,
+) (map[string]*batchv1.Job, error) {
+	labelSelector := existingJobsSelector(uuid, execution)
+	jobs := make(map[string]*batchv1.Job)
+	for _, target := range targets {
+		jobList, err := listTargetJobs(ctx, target, labelSelector)
+		if err != nil {
+			return nil, err
+		}
+		for i := range jobList.Items {
+			job := &jobList.Items[i]
+			recipeName := job.Labels["recipe"]
+			existing, ok := jobs[recipeName]
+			if !ok || existing.CreationTimestamp.Before(&job.CreationTimestamp) {
+				jobs[recipeName] = job
+			}
+		}
+	}
+	return jobs, nil
+}
 
-	job, err := jobClient.Create(context.TODO(), job, metav1.CreateOptions{})
+// Build the label selector of the Jobs of a run of an execution. Jobs of other runs under the same
+// UUID, e.g. of earlier action requests, are left out. Executions checkpointed before their runs
+// were identified match all the Jobs of their UUID.
+func existingJobsSelector(uuid string, execution string) string {
+	labels := map[string]string{
+		"app":  "euphrosyne",
+		"uuid": uuid,
+	}
+	if execution != "" {
+		labels[executionLabel] = execution
+	}
+	return metav1.FormatLabelSelector(&metav1.LabelSelector{MatchLabels: labels})
+}
+
+// List the Jobs matching a label selector in a target.
+func listTargetJobs(
+	ctx context.Context, target RecipeTarget, labelSelector string,
+) (*batchv1.JobList, error) {
+	client, err := clientsetFor(target.Cluster)
 	if err != nil {
 		return nil, err
 	}
+	jobList, err := client.BatchV1().Jobs(target.Namespace).List(
+		ctx, metav1.ListOptions{LabelSelector: labelSelector},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Target '%s': %w", target, err)
+	}
+	return jobList, nil
+}
 
-	logger.Info("Job created successfully", zap.String("jobName", job.Name))
+// Adopt the existing Job of a recipe, if one exists. Jobs that have already completed will not
+// publish their results again, and have their results read from their termination message.
+func (r *Reconciler) adoptJob(recipeName string, existingJobs map[string]*batchv1.Job) bool {
+	job, ok := existingJobs[recipeName]
+	if !ok {
+		return false
+	}
+	logger.Info(
+		"Adopting existing recipe Job",
+		zap.String("uuid", r.uuid),
+		zap.String("recipe", recipeName),
+		zap.String("jobName", job.Name),
+	)
+	r.trackJobEvents(recipeName, job)
+	incidentRegistry.RecipeLaunched(r.uuid, recipeName, job.Name, 1)
 
-	return job, nil
+	var cmName string
+	for _, volume := range job.Spec.Template.Spec.Volumes {
+		if volume.ConfigMap != nil {
+			cmName = volume.ConfigMap.Name
+		}
+	}
+	r.jobs[recipeName] = &recipeJob{jobName: job.Name, cmName: cmName, attempts: 1}
+	return true
 }
 
-// Create Jobs to execute a list of debugging recipes.
-func runDebuggingRecipes(
-	uuid string, recipes map[string]Recipe, data *map[string]interface{}, config *Config,
-) error {
-	cm, err := createConfigMap(data, uuid, config.RecipeNamespace)
+// Launch a Job for a recipe, keeping track of it so that it can be retried if it fails.
+func (r *Reconciler) launchRecipe(recipeName string, recipe Recipe, cmName string) {
+	attempts := 1
+	if rj, ok := r.jobs[recipeName]; ok {
+		attempts = rj.attempts + 1
+	}
+	// Nothing is launched once the execution is cancelled
+	if r.traceContext().Err() != nil {
+		r.finished[recipeName] = true
+		return
+	}
+	ctx, span := tracer.Start(
+		r.traceContext(), "recipe.launch",
+		recipeSpanAttributes(r.uuid, recipeName),
+		trace.WithAttributes(attribute.Int("euphrosyne.attempt", attempts)),
+	)
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, kubeRequestTimeout)
+	defer cancel()
+
+	job, err := createJob(ctx, recipeName, recipe, r.uuid, r.execution, cmName, r.config)
 	if err != nil {
-		logger.Error("Failed to create ConfigMap", zap.Error(err))
-		return err
+		logger.Error("Failed to create K8s Job", zap.Error(err))
+		recordSpanError(span, err)
+		recipeLaunchFailures.WithLabelValues(recipeLabel(recipeName)).Inc()
+		// Retries that cannot be launched fail the recipe along with its previous attempts
+		if attempts > 1 {
+			r.failRecipeJob(
+				recipeName, RecipeStateFailed,
+				fmt.Sprintf("Failed to retry recipe Job after %d attempt(s): %s", attempts-1, err),
+			)
+			return
+		}
+		r.finished[recipeName] = true
+		incidentRegistry.RecipeFailed(r.uuid, recipeName, err)
+		r.recordFailedRecipe(recipeName, fmt.Sprintf("Failed to launch recipe Job: %s", err))
+		return
 	}
-	// Create a Job for each recipe
-	for recipeName, recipe := range recipes {
-		_, err := createJob(recipeName, recipe, uuid, cm.Name, config)
-		if err != nil {
-			logger.Error("Failed to create K8s Job", zap.Error(err))
-			// FIXME: Handle the error as needed
+
+	if err := ownConfigMap(ctx, r.recipeTarget(recipeName).Cluster, job, cmName); err != nil {
+		logger.Warn(
+			"Failed to set the owner of the recipe ConfigMap",
+			zap.String("configMapName", cmName),
+			zap.String("jobName", job.Name),
+			zap.Error(err),
+		)
+		cleanupFailures.WithLabelValues("ownership").Inc()
+	}
+
+	r.jobs[recipeName] = &recipeJob{jobName: job.Name, cmName: cmName, attempts: attempts}
+	r.trackJobEvents(recipeName, job)
+	incidentRegistry.RecipeLaunched(r.uuid, recipeName, job.Name, attempts)
+	recipesLaunched.WithLabelValues(recipeLabel(recipeName)).Inc()
+}
+
+// Create Jobs to execute the debugging recipes of the reconciler.
+func (r *Reconciler) runDebuggingRecipes() error {
+	// The execution is persisted before its Jobs are created, so that a restart in between adopts
+	// them rather than losing track of them
+	r.checkpoint()
+
+	// Recipes running in the same target share the ConfigMap holding the alert data
+	cms := make(map[RecipeTarget]*corev1.ConfigMap)
+	// Create a Job for each recipe, holding back the ones that depend on other recipes
+	var err error
+	for _, recipeName := range r.recipeOrder() {
+		recipe := r.recipes[recipeName]
+		if r.reuseFreshResult(recipeName) {
+			continue
+		}
+		if len(recipe.Config.DependsOn) > 0 {
+			r.deferRecipe(recipeName, *r.data)
+			continue
+		}
+		if recipe.Config.Peer != "" {
+			r.forwardRecipe(recipeName, recipe, *r.data)
+			continue
+		}
+		// Recipes with parameters get their own ConfigMap, holding their rendered parameters
+		if len(recipe.Config.Params) > 0 {
+			data, ok := r.recipeParamsData(recipeName, recipe, *r.data)
+			if !ok {
+				continue
+			}
+			paramsCM, err := r.createConfigMap(&data, r.recipeTarget(recipeName))
+			if err != nil {
+				logger.Error("Failed to create ConfigMap", zap.Error(err))
+				return err
+			}
+			r.launchRecipe(recipeName, recipe, paramsCM.Name)
+			continue
 		}
+		target := r.recipeTarget(recipeName)
+		if cms[target] == nil {
+			cms[target], err = r.createConfigMap(r.data, target)
+			if err != nil {
+				logger.Error("Failed to create ConfigMap", zap.Error(err))
+				return err
+			}
+		}
+		r.launchRecipe(recipeName, recipe, cms[target].Name)
 	}
 	return nil
 }
 
-// Create Jobs to execute a list of action recipes.
-func runActionRecipes(
-	uuid string, recipes map[string]Recipe, data *map[string]interface{}, config *Config,
-) error {
-	actions, err := parseActionData(data)
+// Create Jobs to execute the action recipes requested in the reconciler data.
+func (r *Reconciler) runActionRecipes() error {
+	actions, err := parseActionData(r.data)
 	if err != nil {
 		logger.Error("Failed to parse actions", zap.Error(err))
 		return err
 	}
 
+	// Only the requested actions are expected to report their results
+	requestedRecipes := make(map[string]Recipe)
+	for _, action := range actions {
+		if recipe, ok := r.recipes[action.Name]; ok {
+			requestedRecipes[action.Name] = recipe
+		}
+	}
+	r.recipes = requestedRecipes
+	// The execution is persisted before its Jobs are created, so that a restart in between adopts
+	// them rather than losing track of them
+	r.checkpoint()
+
 	for _, action := range actions {
-		_, ok := recipes[action.Name]
+		recipe, ok := r.recipes[action.Name]
 		if ok {
 			actionData := make(map[string]interface{})
 			for k, v := range action.Data {
 				actionData[k] = v
 			}
-			actionData["uuid"] = uuid
-			cm, err := createConfigMap(&actionData, uuid, config.RecipeNamespace)
+			actionData["uuid"] = r.uuid
+			if len(recipe.Config.DependsOn) > 0 {
+				r.deferRecipe(action.Name, actionData)
+				continue
+			}
+			if recipe.Config.Peer != "" {
+				r.forwardRecipe(action.Name, recipe, actionData)
+				continue
+			}
+			actionData, ok = r.recipeParamsData(action.Name, recipe, actionData)
+			if !ok {
+				continue
+			}
+			cm, err := r.createConfigMap(&actionData, r.recipeTarget(action.Name))
 			if err != nil {
 				logger.Error("Failed to create ConfigMap", zap.Error(err))
 				return err
 			}
-			_, err = createJob(action.Name, recipes[action.Name], uuid, cm.Name, config)
-			if err != nil {
-				logger.Error("Failed to create K8s Job", zap.Error(err))
-				// FIXME: Handle the error as needed
-			}
+			r.launchRecipe(action.Name, recipe, cm.Name)
 		}
 	}
 	return nil
@@ -303,10 +613,18 @@ func buildRecipeCommand(
 	recipeCommand += fmt.Sprintf("%v ", recipeConfig.Entrypoint)
 	recipeCommand += fmt.Sprintf("--data-file-path '%v' ", configMapFilePath)
 	recipeCommand += fmt.Sprintf("--aggregator-address '%v' ", config.AggregatorAddress)
-	recipeCommand += fmt.Sprintf("--redis-address '%v' ", config.RedisAddress)
+	recipeCommand += fmt.Sprintf("--redis-address '%v' ", recipeRedisAddress(config))
 	return recipeCommand
 }
 
+// Return the address recipes should publish their results to.
+func resultBrokerAddress(config *Config) string {
+	if config.ResultBroker == RedisResultBroker {
+		return recipeRedisAddress(config)
+	}
+	return config.ResultBrokerAddress
+}
+
 // Parse the action data from the Webex Bot request.
 func parseActionData(data *map[string]interface{}) ([]Action, error) {
 	var actions []Action
@@ -2,14 +2,20 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
 )
 
 const (
@@ -22,7 +28,7 @@ var testConfig = Config{
 	AggregatorAddress:   "localhost:8080",
 	RedisAddress:        "localhost:6379",
 	WebexBotAddress:     "localhost:7001",
-	RecipeTimeout:       300,
+	RecipeTimeout:       5 * time.Minute,
 	RecipeNamespace:     testNamespace,
 	ReconcilerNamespace: testNamespace,
 }
@@ -168,7 +174,10 @@ func TestRecipeExecutor(t *testing.T) {
 		createTestNamespace()
 	}
 	// create a data ConfigMap for the test recipes
-	dataConfigMap, err = createConfigMap(alertData, incidentUuid, testConfig.RecipeNamespace)
+	dataConfigMap, err = createConfigMap(
+		context.Background(), alertData, incidentUuid,
+		RecipeTarget{Namespace: testConfig.RecipeNamespace},
+	)
 	if err != nil {
 		panic(err)
 	}
@@ -218,7 +227,10 @@ func testCreateConfigMap(t *testing.T) {
 		deleteConfigMap(configMapName, testNamespace)
 	}()
 
-	configMap, err := createConfigMap(alertData, incidentUuid, testConfig.RecipeNamespace)
+	configMap, err := createConfigMap(
+		context.Background(), alertData, incidentUuid,
+		RecipeTarget{Namespace: testConfig.RecipeNamespace},
+	)
 	assert.Nil(t, err)
 
 	configMapName = configMap.Name
@@ -236,7 +248,10 @@ func testCreateJob(t *testing.T) {
 		deleteJob(jobName, testNamespace)
 	}()
 
-	job, err := createJob("test-1-recipe", recipe_1, incidentUuid, dataConfigMap.Name, &testConfig)
+	job, err := createJob(
+		context.TODO(), "test-1-recipe", recipe_1, incidentUuid, "test-execution",
+		dataConfigMap.Name, &testConfig,
+	)
 	assert.NotNil(t, job)
 	assert.Nil(t, err)
 	jobName = job.Name
@@ -247,3 +262,210 @@ func testCreateJob(t *testing.T) {
 	assert.NotNil(t, getJob)
 	assert.Nil(t, err)
 }
+
+// Test that the overrides declared by a recipe are applied to its Job.
+func TestApplyRecipeOverrides(t *testing.T) {
+	recipeConfig, err := parseRecipeCatalog(&corev1.ConfigMap{Data: map[string]string{
+		"debugging": `
+heavy-recipe:
+  image: "heavy"
+  timeout: 20m
+  resources:
+    requests:
+      cpu: 500m
+      memory: 1Gi
+    limits:
+      memory: 2Gi
+  nodeSelector:
+    kubernetes.io/arch: amd64
+  tolerations:
+  - key: dedicated
+    operator: Equal
+    value: recipes
+    effect: NoSchedule
+  serviceAccount: heavy-recipe
+`,
+	}})
+	assert.Nil(t, err)
+
+	spec := batchv1.JobSpec{
+		Template: corev1.PodTemplateSpec{
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "recipe-container"}}},
+		},
+	}
+	heavy := recipeConfig.Debugging["heavy-recipe"]
+	applyRecipeOverrides(&spec, &heavy)
+
+	assert.Equal(t, int64(1200), *spec.ActiveDeadlineSeconds)
+	resources := spec.Template.Spec.Containers[0].Resources
+	assert.Equal(t, "500m", resources.Requests.Cpu().String())
+	assert.Equal(t, "2Gi", resources.Limits.Memory().String())
+	assert.Equal(t, "amd64", spec.Template.Spec.NodeSelector["kubernetes.io/arch"])
+	assert.Equal(t, "dedicated", spec.Template.Spec.Tolerations[0].Key)
+	assert.Equal(t, "heavy-recipe", spec.Template.Spec.ServiceAccountName)
+
+	// Recipes without overrides keep the defaults
+	spec = batchv1.JobSpec{
+		Template: corev1.PodTemplateSpec{
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "recipe-container"}}},
+		},
+	}
+	applyRecipeOverrides(&spec, &RecipeConfig{})
+	assert.Nil(t, spec.ActiveDeadlineSeconds)
+	assert.Empty(t, spec.Template.Spec.Containers[0].Resources.Requests)
+	assert.Empty(t, spec.Template.Spec.ServiceAccountName)
+}
+
+// failingBroker refuses every subscription.
+type failingBroker struct {
+	fakeBroker
+}
+
+func (b *failingBroker) Subscribe(context.Context, string) (ResultSubscription, error) {
+	return nil, errors.New("broker unavailable")
+}
+
+// Replace the Kubernetes client with a fake one failing the creation of every ConfigMap past the
+// first one, returning it along with its recorded actions.
+func useFailingConfigMaps(t *testing.T) *fake.Clientset {
+	client := fake.NewSimpleClientset()
+	created := 0
+	client.PrependReactor("create", "configmaps", func(k8stesting.Action) (bool, runtime.Object, error) {
+		created++
+		if created > 1 {
+			return true, nil, errors.New("quota exceeded")
+		}
+		return false, nil, nil
+	})
+	previous := clientset
+	t.Cleanup(func() { clientset = previous })
+	clientset = client
+	return client
+}
+
+// Test that executions whose recipes cannot be launched fail, deleting the Jobs launched so far.
+func TestStartRecipeExecutorFailures(t *testing.T) {
+	catalogMutex.Lock()
+	previous := catalog
+	catalogMutex.Unlock()
+	t.Cleanup(func() {
+		catalogMutex.Lock()
+		catalog = previous
+		catalogMutex.Unlock()
+	})
+	setCatalog := func(rc *RecipeCatalog) {
+		catalogMutex.Lock()
+		catalog = rc
+		catalogMutex.Unlock()
+	}
+	recipes := &RecipeCatalog{
+		Debugging: map[string]RecipeConfig{
+			"pod-logs": {Enabled: true, Image: imageName, Entrypoint: "pod-logs"},
+			"pod-status": {
+				Enabled:    true,
+				Image:      imageName,
+				Entrypoint: "pod-status",
+				Params:     map[string]string{"incident": "{{ .uuid }}"},
+			},
+		},
+		Actions: map[string]RecipeConfig{
+			"restart": {Enabled: true, Image: imageName, Entrypoint: "restart"},
+		},
+	}
+	config := &Config{RecipeNamespace: testNamespace, ReconcilerNamespace: testNamespace}
+
+	t.Run("CatalogUnavailable", func(t *testing.T) {
+		useFakeBroker(t)
+		useFakeClientset(t)
+		setCatalog(nil)
+
+		StartRecipeExecutor(
+			context.Background(), config, &map[string]interface{}{"uuid": "failure-1"}, Alert,
+		)
+		incident, ok := incidentRegistry.Get("failure-1")
+		assert.True(t, ok)
+		assert.Equal(t, IncidentStateFailed, incident.State)
+	})
+
+	t.Run("SubscriptionFailed", func(t *testing.T) {
+		previous := resultBroker
+		t.Cleanup(func() { resultBroker = previous })
+		resultBroker = &failingBroker{}
+		useFakeClientset(t)
+		setCatalog(recipes)
+
+		StartRecipeExecutor(
+			context.Background(), config, &map[string]interface{}{"uuid": "failure-2"}, Alert,
+		)
+		incident, _ := incidentRegistry.Get("failure-2")
+		assert.Equal(t, IncidentStateFailed, incident.State)
+		assert.Contains(t, incident.Error, "broker unavailable")
+	})
+
+	t.Run("JobsPartiallyLaunched", func(t *testing.T) {
+		broker := useFakeBroker(t)
+		client := useFailingConfigMaps(t)
+		setCatalog(recipes)
+
+		StartRecipeExecutor(
+			context.Background(), config, &map[string]interface{}{"uuid": "failure-3"}, Alert,
+		)
+		incident, _ := incidentRegistry.Get("failure-3")
+		assert.Equal(t, IncidentStateFailed, incident.State)
+		assert.Contains(t, incident.Error, "quota exceeded")
+		assert.Equal(t, 1, broker.closed["failure-3"])
+
+		// The Job launched before the failure is deleted along with its ConfigMap
+		deleted := map[string]string{}
+		for _, action := range client.Actions() {
+			if action, ok := action.(k8stesting.DeleteCollectionAction); ok {
+				deleted[action.GetResource().Resource] = action.GetListRestrictions().Labels.String()
+			}
+		}
+		assert.Contains(t, deleted["jobs"], "uuid=failure-3")
+		assert.Contains(t, deleted["jobs"], executionLabel+"=")
+		assert.Contains(t, deleted["configmaps"], "uuid=failure-3")
+	})
+
+	t.Run("InvalidActions", func(t *testing.T) {
+		broker := useFakeBroker(t)
+		useFakeClientset(t)
+		setCatalog(recipes)
+
+		data := map[string]interface{}{
+			"uuid": "failure-4", "actions": []interface{}{map[string]interface{}{"name": "restart"}},
+		}
+		StartRecipeExecutor(context.Background(), config, &data, Actions)
+		incident, _ := incidentRegistry.Get("failure-4")
+		assert.Equal(t, IncidentStateFailed, incident.State)
+		assert.Contains(t, incident.Error, "'data'")
+		assert.Equal(t, 1, broker.closed["failure-4"])
+	})
+}
+
+// Test that recipes whose Job cannot be launched are reported as failed.
+func TestLaunchRecipeFailure(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	client.PrependReactor("create", "jobs", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("quota exceeded")
+	})
+	previous := clientset
+	t.Cleanup(func() { clientset = previous })
+	clientset = client
+
+	incidentRegistry.Register("launch-1", Alert)
+	r := &Reconciler{
+		uuid:     "launch-1",
+		config:   &testConfig,
+		recipes:  map[string]Recipe{"pod-logs": recipe_2},
+		jobs:     map[string]*recipeJob{},
+		finished: map[string]bool{},
+	}
+	r.launchRecipe("pod-logs", recipe_2, "cm")
+
+	assert.True(t, r.finished["pod-logs"])
+	assert.Len(t, r.completedRecipes, 1)
+	assert.Equal(t, "pod-logs", r.completedRecipes[0].Execution.Name)
+	assert.Equal(t, RecipeStatusFailed, r.completedRecipes[0].Execution.Status)
+	assert.Contains(t, r.completedRecipes[0].Execution.Results.Analysis, "quota exceeded")
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that the results message of a recipe survives a round trip through JSON and YAML.
+func TestRecipeExecutionRoundTrip(t *testing.T) {
+	execution := NewRecipeExecution("logs", "incident-1", RecipeStatusSuccessful, RecipeResults{
+		Actions:  []string{"Restart pod X"},
+		Analysis: "Pod X is crash looping",
+		JSON:     `{"restarts": 5}`,
+		Links:    []string{"https://grafana.example.com/d/pods"},
+	})
+
+	data, err := execution.JSON()
+	assert.Nil(t, err)
+	parsed, err := ParseRecipeExecution(data)
+	assert.Nil(t, err)
+	assert.Equal(t, execution, parsed)
+
+	data, err = execution.YAML()
+	assert.Nil(t, err)
+	parsed, err = ParseRecipeExecutionYAML(data)
+	assert.Nil(t, err)
+	assert.Equal(t, execution, parsed)
+}
+
+// Test the parsing of the results messages published by recipes.
+func TestParseRecipeExecution(t *testing.T) {
+	execution, err := ParseRecipeExecution([]byte(
+		`{"name": "logs", "incident": "incident-1", "status": "failed", "results": {}}`,
+	))
+	assert.Nil(t, err)
+	assert.Equal(t, "logs", execution.Name)
+	assert.False(t, execution.Succeeded())
+
+	_, err = ParseRecipeExecution([]byte(`{"name": 42}`))
+	assert.ErrorContains(t, err, "Invalid recipe results")
+	_, err = ParseRecipeExecution([]byte(`{"name": "logs", "status": "done"}`))
+	assert.ErrorContains(t, err, "Unsupported status 'done'")
+
+	var missing *RecipeExecution
+	assert.False(t, missing.Succeeded())
+}
+
+// Test that results messages following a versioned schema are validated strictly, identifying the
+// recipe that published invalid results.
+func TestParseRecipeExecutionSchema(t *testing.T) {
+	testCases := []struct {
+		name     string
+		message  string
+		expected *RecipeExecution
+		err      string
+		recipe   string
+		schema   string
+	}{
+		{
+			name: "V1",
+			message: `{"schema": "results/v1", "name": "logs", "incident": "incident-1",
+				"status": "successful",
+				"results": {"analysis": "ok", "json": "{\"restarts\": 5}"}}`,
+			expected: NewRecipeExecution(
+				"logs", "incident-1", RecipeStatusSuccessful,
+				RecipeResults{Analysis: "ok", JSON: `{"restarts": 5}`},
+			),
+		},
+		{
+			name: "V1Informational",
+			message: `{"schema": "results/v1", "name": "logs", "incident": "incident-1",
+				"status": "successful", "results": {"analysis": "ok", "actionable": false}}`,
+			expected: NewRecipeExecution(
+				"logs", "incident-1", RecipeStatusSuccessful,
+				RecipeResults{Analysis: "ok", Actionable: new(bool)},
+			),
+		},
+		{
+			name: "UnknownField",
+			message: `{"schema": "results/v1", "name": "logs", "incident": "incident-1",
+				"status": "successful", "results": {"analysys": "ok"}}`,
+			err:    `unknown field "analysys"`,
+			recipe: "logs",
+			schema: ResultSchemaV1,
+		},
+		{
+			name:    "MissingIncident",
+			message: `{"schema": "results/v1", "name": "logs", "status": "failed"}`,
+			err:     "Missing incident",
+			recipe:  "logs",
+			schema:  ResultSchemaV1,
+		},
+		{
+			name: "InvalidJSON",
+			message: `{"schema": "results/v1", "name": "logs", "incident": "incident-1",
+				"status": "successful", "results": {"json": "{restarts"}}`,
+			err:    "Field 'json' does not hold valid JSON",
+			recipe: "logs",
+			schema: ResultSchemaV1,
+		},
+		{
+			name:    "UnsupportedSchema",
+			message: `{"schema": "results/v9", "name": "logs"}`,
+			err:     "Unsupported schema 'results/v9'",
+			recipe:  "logs",
+		},
+		{
+			name:     "Legacy",
+			message:  `{"name": "logs", "status": "unknown", "results": {"extra": true}}`,
+			expected: &RecipeExecution{Name: "logs", Status: RecipeStatusUnknown},
+		},
+		{
+			name:    "LegacyInvalidType",
+			message: `{"name": "logs", "status": "failed", "results": {"links": "x"}}`,
+			err:     "cannot unmarshal string",
+			recipe:  "logs",
+			schema:  LegacyResultSchema,
+		},
+		{name: "NotAnObject", message: `[]`, err: "Invalid recipe results"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			execution, err := ParseRecipeExecution([]byte(tc.message))
+			if tc.err == "" {
+				assert.Nil(t, err)
+				assert.Equal(t, tc.expected, execution)
+				return
+			}
+			assert.ErrorContains(t, err, tc.err)
+			var resultsErr *RecipeResultsError
+			assert.ErrorAs(t, err, &resultsErr)
+			assert.Equal(t, tc.recipe, resultsErr.Recipe)
+			assert.Equal(t, tc.schema, resultsErr.Schema)
+		})
+	}
+}
+
+// Test that invalid results fail the recipe that published them, instead of being aggregated.
+func TestRejectRecipeResults(t *testing.T) {
+	uuid := "rejected-results"
+	incidentRegistry.Register(uuid, Alert)
+	r := &Reconciler{
+		uuid:      uuid,
+		recipes:   map[string]Recipe{"logs": {}, "metrics": {}},
+		finished:  make(map[string]bool),
+		completed: make(map[string]bool),
+	}
+
+	_, err := r.parseRecipeResults(`{"schema": "results/v1", "name": "logs", "status": "failed"}`)
+	r.rejectRecipeResults(err)
+	_, err = r.parseRecipeResults(`{"schema": "results/v1", "name": "other", "status": "failed"}`)
+	r.rejectRecipeResults(err)
+
+	assert.Equal(t, map[string]bool{"logs": true}, r.finished)
+	assert.Empty(t, r.completedRecipes)
+	incident, _ := incidentRegistry.Get(uuid)
+	assert.Equal(t, RecipeStateFailed, incident.Recipes["logs"].State)
+	assert.Contains(t, incident.Recipes["logs"].Error, "Missing incident")
+	assert.NotContains(t, incident.Recipes, "other")
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// RecipeDocs points the responders reading the results of a recipe to its documentation, to the
+// team owning it and to the runbook to follow up on its results manually.
+type RecipeDocs struct {
+	DocsURL string `json:"docsUrl,omitempty"`
+	Owner   string `json:"owner,omitempty"`
+	Runbook string `json:"runbook,omitempty"`
+}
+
+// RecipeSummary describes a recipe of the catalog, as listed by the recipes API.
+type RecipeSummary struct {
+	Name        string      `json:"name"`
+	Type        string      `json:"type"`
+	Enabled     bool        `json:"enabled"`
+	Description string      `json:"description,omitempty"`
+	Docs        *RecipeDocs `json:"docs,omitempty"`
+}
+
+// Return the documentation of a recipe, or nil if it has none.
+func (rc *RecipeConfig) Docs() *RecipeDocs {
+	if rc == nil || (rc.DocsURL == "" && rc.Owner == "" && rc.Runbook == "") {
+		return nil
+	}
+	return &RecipeDocs{DocsURL: rc.DocsURL, Owner: rc.Owner, Runbook: rc.Runbook}
+}
+
+// Check that the documentation and runbook links of the recipes are absolute HTTP(S) URLs.
+func validateRecipeDocs(recipes map[string]RecipeConfig) error {
+	for recipeName, recipeConfig := range recipes {
+		links := map[string]string{"docsUrl": recipeConfig.DocsURL, "runbook": recipeConfig.Runbook}
+		for field, link := range links {
+			if link == "" {
+				continue
+			}
+			u, err := url.Parse(link)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf(
+					"Recipe '%s' has an invalid %s '%s', expected an HTTP(S) URL",
+					recipeName, field, link,
+				)
+			}
+		}
+	}
+	return nil
+}
+
+// Collect the documentation of the recipes that reported results, by recipe.
+func recipeDocs(completedRecipes []Recipe) map[string]RecipeDocs {
+	var docs map[string]RecipeDocs
+	for _, recipe := range completedRecipes {
+		recipeDocs := recipe.Config.Docs()
+		if recipeDocs == nil {
+			continue
+		}
+		if docs == nil {
+			docs = make(map[string]RecipeDocs)
+		}
+		docs[recipe.Execution.Name] = *recipeDocs
+	}
+	return docs
+}
+
+// Format the documentation of a recipe as the last lines of its replies, if any.
+func docsThreadLines(docs *RecipeDocs) string {
+	if docs == nil {
+		return ""
+	}
+	var parts []string
+	if docs.Owner != "" {
+		parts = append(parts, "Owner: "+docs.Owner)
+	}
+	if docs.Runbook != "" {
+		parts = append(parts, "Runbook: "+docs.Runbook)
+	}
+	if docs.DocsURL != "" {
+		parts = append(parts, "Docs: "+docs.DocsURL)
+	}
+	return "\n" + strings.Join(parts, " | ")
+}
+
+// Handle request to list the recipes of the catalog along with their documentation, optionally
+// only the ones of a given owner.
+func handleListRecipesRequest(c *gin.Context, config *Config) {
+	rc, err := getRecipeCatalog(config.ReconcilerNamespace)
+	if err != nil {
+		logger.Error("Failed to retrieve recipe catalog", zap.Error(err))
+		respondProblem(
+			c, http.StatusServiceUnavailable, CatalogUnavailableProblem,
+			"Recipe catalog not loaded",
+		)
+		return
+	}
+
+	owner := c.Query("owner")
+	recipes := []RecipeSummary{}
+	for _, requestType := range []RequestType{Alert, Actions} {
+		recipeType := debuggingRecipesKey
+		if requestType == Actions {
+			recipeType = actionRecipesKey
+		}
+		for recipeName, recipe := range rc.Recipes(requestType, false) {
+			if owner != "" && recipe.Config.Owner != owner {
+				continue
+			}
+			recipes = append(recipes, RecipeSummary{
+				Name:        recipeName,
+				Type:        recipeType,
+				Enabled:     recipe.Config.Enabled,
+				Description: recipe.Config.Description,
+				Docs:        recipe.Config.Docs(),
+			})
+		}
+	}
+	sort.Slice(recipes, func(i, j int) bool {
+		if recipes[i].Type != recipes[j].Type {
+			return recipes[i].Type < recipes[j].Type
+		}
+		return recipes[i].Name < recipes[j].Name
+	})
+
+	c.JSON(http.StatusOK, gin.H{"hash": rc.Hash, "recipes": recipes})
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that only HTTP(S) URLs are accepted as documentation and runbook links.
+func TestValidateRecipeDocs(t *testing.T) {
+	tests := []struct {
+		name   string
+		config RecipeConfig
+		valid  bool
+	}{
+		{name: "None", valid: true},
+		{
+			name: "Links",
+			config: RecipeConfig{
+				DocsURL: "https://docs.example.com/recipes/logs",
+				Owner:   "sre",
+				Runbook: "http://wiki.example.com/runbooks/logs",
+			},
+			valid: true,
+		},
+		{name: "RelativeDocsURL", config: RecipeConfig{DocsURL: "/recipes/logs"}},
+		{name: "RunbookText", config: RecipeConfig{Runbook: "restart the pod"}},
+		{name: "UnsupportedScheme", config: RecipeConfig{Runbook: "ftp://wiki.example.com"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateRecipeDocs(map[string]RecipeConfig{"logs": tt.config})
+			assert.Equal(t, tt.valid, err == nil)
+		})
+	}
+}
+
+// Test that the documentation of the recipes is collected from their results and added to their
+// thread replies.
+func TestRecipeDocs(t *testing.T) {
+	documented := NewCompletedRecipe(NewRecipeExecution(
+		"logs", "docs-incident", RecipeStatusFailed, RecipeResults{},
+	))
+	documented.Config = &RecipeConfig{Owner: "sre", Runbook: "https://wiki.example.com/logs"}
+	undocumented := NewCompletedRecipe(NewRecipeExecution(
+		"pods", "docs-incident", RecipeStatusSuccessful, RecipeResults{},
+	))
+	undocumented.Config = &RecipeConfig{}
+
+	assert.Equal(t, map[string]RecipeDocs{
+		"logs": {Owner: "sre", Runbook: "https://wiki.example.com/logs"},
+	}, recipeDocs([]Recipe{documented, undocumented}))
+	assert.Nil(t, recipeDocs([]Recipe{undocumented}))
+
+	assert.Equal(
+		t, "Recipe 'logs' failed\nOwner: sre | Runbook: https://wiki.example.com/logs",
+		recipeThreadReply(documented),
+	)
+	assert.Equal(t, "Recipe 'pods' completed successfully", recipeThreadReply(undocumented))
+}
+
+// Test that the recipes of the catalog are listed along with their documentation.
+func TestListRecipesRequest(t *testing.T) {
+	catalogMutex.Lock()
+	previous := catalog
+	catalog = &RecipeCatalog{
+		Hash: "catalog-hash",
+		Debugging: map[string]RecipeConfig{
+			"logs": {Enabled: true, Description: "Collect logs", Owner: "sre"},
+			"pods": {Enabled: false, Owner: "platform"},
+		},
+		Actions: map[string]RecipeConfig{
+			"restart": {
+				Enabled: true, Owner: "sre", Runbook: "https://wiki.example.com/restart",
+			},
+		},
+	}
+	catalogMutex.Unlock()
+	defer func() {
+		catalogMutex.Lock()
+		catalog = previous
+		catalogMutex.Unlock()
+	}()
+
+	router := gin.New()
+	router.GET("/api/v1/recipes", func(ctx *gin.Context) {
+		handleListRecipesRequest(ctx, &Config{})
+	})
+
+	tests := []struct {
+		name     string
+		query    string
+		expected []RecipeSummary
+	}{
+		{
+			name: "All",
+			expected: []RecipeSummary{
+				{
+					Name:    "restart",
+					Type:    "actions",
+					Enabled: true,
+					Docs:    &RecipeDocs{Owner: "sre", Runbook: "https://wiki.example.com/restart"},
+				},
+				{
+					Name:        "logs",
+					Type:        "debugging",
+					Enabled:     true,
+					Description: "Collect logs",
+					Docs:        &RecipeDocs{Owner: "sre"},
+				},
+				{Name: "pods", Type: "debugging", Docs: &RecipeDocs{Owner: "platform"}},
+			},
+		},
+		{
+			name:  "Owner",
+			query: "?owner=platform",
+			expected: []RecipeSummary{
+				{Name: "pods", Type: "debugging", Docs: &RecipeDocs{Owner: "platform"}},
+			},
+		},
+		{name: "UnknownOwner", query: "?owner=unknown", expected: []RecipeSummary{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(
+				recorder, httptest.NewRequest(http.MethodGet, "/api/v1/recipes"+tt.query, nil),
+			)
+			assert.Equal(t, http.StatusOK, recorder.Code)
+			var response struct {
+				Hash    string          `json:"hash"`
+				Recipes []RecipeSummary `json:"recipes"`
+			}
+			assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+			assert.Equal(t, "catalog-hash", response.Hash)
+			assert.Equal(t, tt.expected, response.Recipes)
+		})
+	}
+}
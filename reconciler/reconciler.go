@@ -1,19 +1,31 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"net/http"
 	"time"
 
-	"github.com/gin-gonic/gin"
-	"github.com/go-redis/redis/v8"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+const (
+	defaultRetryBackoff = 10 * time.Second
+	maxRetryBackoff     = 10 * time.Minute
+	// Timeout of each Kubernetes API request made by an execution
+	kubeRequestTimeout = 30 * time.Second
+	// Time left to an execution past its deadline to clean up and deliver its analysis
+	executionGracePeriod = 5 * time.Minute
+)
+
+// Interval for checking the status of recipe Jobs while waiting for their results.
+var jobPollInterval = 5 * time.Second
+
 // RequestType enumeration
 type RequestType int
 
@@ -23,133 +35,492 @@ const (
 )
 
 type Reconciler struct {
-	uuid        string
-	config      *Config
-	data        *map[string]interface{}
-	pubsub      *redis.PubSub
-	recipes     map[string]Recipe
-	requestType RequestType
+	// Context of the execution, carrying its trace
+	ctx  context.Context
+	uuid string
+	// ID of this run of the execution, telling its Jobs apart from the ones of earlier runs under
+	// the same UUID, e.g. of re-requested actions
+	execution        string
+	config           *Config
+	data             *map[string]interface{}
+	results          ResultSubscription
+	recipes          map[string]Recipe
+	requestType      RequestType
+	deadline         time.Time
+	jobs             map[string]*recipeJob
+	finished         map[string]bool
+	waiting          map[string]map[string]interface{}
+	completed        map[string]bool
+	completedRecipes []Recipe
+	// Recipes forwarded to peer reconcilers
+	remote map[string]*remoteExecution
+	// Whether the execution was forwarded by a peer reconciler, which collects its results
+	federated bool
+	// Logs of the recipe Pods, by recipe, if snapshotted before the cleanup
+	logs map[string]string
+	// Whether the execution was suspended on shutdown, keeping its state and resources
+	suspended bool
+	// Whether the execution is a canary self-test, whose analysis is not delivered
+	canary bool
+}
+
+// jobRef identifies a Job across the targets of the recipes.
+type jobRef struct {
+	target RecipeTarget
+	name   string
+}
+
+// recipeJob tracks the Job running a recipe, along with any previous attempts.
+type recipeJob struct {
+	jobName  string
+	cmName   string
+	attempts int
+	retryAt  time.Time
 }
 
 // Initialise a reconciler for a specific alert or for actions
 func NewReconciler(
-	c *gin.Context, config *Config, data *map[string]interface{},
+	c context.Context, config *Config, data *map[string]interface{},
 	recipes map[string]Recipe, requestType RequestType,
 ) (*Reconciler, error) {
 	uuid := (*data)["uuid"].(string)
+	deadline := time.Now().Add(executionTimeout(config, recipes))
 
-	// Subscribe to a new redis channel
-	pubsub := rdb.Subscribe(c, uuid)
-
-	_, err := pubsub.Receive(c)
-
+	// Subscribe to the results of the recipes
+	results, err := subscriptionRegistry.Subscribe(c, uuid, deadline)
 	if err != nil {
-		logger.Error("Failed to subscribe to channel", zap.Error(err))
+		logger.Error("Failed to subscribe to recipe results", zap.Error(err))
 		return nil, err
 	}
 
 	return &Reconciler{
+		ctx:         c,
 		uuid:        uuid,
+		execution:   newExecutionRun(),
 		config:      config,
 		data:        data,
-		pubsub:      pubsub,
+		results:     results,
 		recipes:     recipes,
 		requestType: requestType,
+		deadline:    deadline,
+		jobs:        make(map[string]*recipeJob),
+		finished:    make(map[string]bool),
+		waiting:     make(map[string]map[string]interface{}),
+		completed:   make(map[string]bool),
+		remote:      make(map[string]*remoteExecution),
 	}, nil
 }
 
+// Compute how long to wait for the results of the recipes, i.e. the global recipe timeout, extended
+// to cover any recipes declaring a longer timeout of their own.
+func executionTimeout(config *Config, recipes map[string]Recipe) time.Duration {
+	timeout := config.RecipeTimeout
+	for _, recipe := range recipes {
+		if recipe.Config != nil && recipe.Config.Timeout.Duration > timeout {
+			timeout = recipe.Config.Timeout.Duration
+		}
+	}
+	return timeout
+}
+
 // Run the reconciler to monitor the subscribed Redis channel for the outcome of each recipe.
 func (r *Reconciler) Run() {
+	defer activeExecutions.Unregister(r.uuid)
+	// Collecting the results, cleaning up and delivering the analysis are bounded by the deadline
+	ctx, cancel := context.WithDeadline(r.traceContext(), r.deadline.Add(executionGracePeriod))
+	defer cancel()
+	r.ctx = ctx
+	defer func() {
+		// Suspended executions are resumed from their persisted state
+		if !r.suspended {
+			r.deleteExecution()
+			incidentRegistry.Complete(r.uuid)
+		}
+	}()
+
+	_, span := tracer.Start(
+		r.traceContext(), "recipe.collect",
+		trace.WithAttributes(attribute.String("euphrosyne.incident", r.uuid)),
+	)
 	completedRecipes, err := collectRecipeResult(r)
+	span.SetAttributes(attribute.Int("euphrosyne.completed_recipes", len(completedRecipes)))
+	if errors.Is(err, errExecutionCancelled) {
+		span.SetAttributes(attribute.Bool("euphrosyne.cancelled", true))
+		span.End()
+		return
+	}
+	if errors.Is(err, errExecutionSuspended) {
+		span.SetAttributes(attribute.Bool("euphrosyne.suspended", true))
+		span.End()
+		return
+	}
 	if err != nil {
 		logger.Error("Failed to collect recipe results", zap.Error(err))
+		recordSpanError(span, err)
+		span.End()
+		return
+	}
+	span.End()
+	if r.federated || r.canary {
 		return
 	}
 
-	// Send received messages to Webex Bot
+	// Deliver the analysis to the sinks
+	findings := aggregateFindings(completedRecipes)
 	botMessage := IncidentBotMessage{
-		UUID:     r.uuid,
-		Analysis: r.getIncidentAnalysis(completedRecipes),
-		Actions:  r.getActions(completedRecipes),
+		UUID:          r.uuid,
+		Analysis:      r.getIncidentAnalysis(completedRecipes),
+		Actions:       findingActions(findings),
+		Findings:      findings,
+		Actionable:    actionableOutcome(completedRecipes),
+		Informational: informationalAnalyses(completedRecipes),
+		Compliance:    r.evaluateCompliance(completedRecipes),
+		Docs:          recipeDocs(completedRecipes),
+	}
+	if incident, ok := incidentRegistry.Get(r.uuid); ok {
+		botMessage.Occurrences = incident.Occurrences
+		botMessage.Ack = &incident.Ack
+	}
+	if verification, ok := parseVerification(*r.data); ok {
+		botMessage.Verifies = verification.Incident
 	}
 
-	err = r.postMessageToWebexBot(botMessage)
-	if err != nil {
-		logger.Error("Failed to forward message to Webex Bot", zap.Error(err))
-		// FIXME: Handle the error as needed
+	incidentRegistry.RecordMessage(r.uuid, WebexAnalysisDestination, botMessage)
+	if !notificationSuppressed(r.uuid, "sinks") {
+		err = aggregationPipeline.Deliver(r.traceContext(), botMessage)
+		if err != nil {
+			logger.Error("Failed to deliver incident analysis", zap.Error(err))
+		}
 	}
+	replyToIncidentThread(r.uuid, incidentThreadReply(botMessage))
+	r.recordClosure(completedRecipes, botMessage.Analysis)
+	r.persistIncidentRecord(completedRecipes, botMessage)
 }
 
 func collectRecipeResult(r *Reconciler) ([]Recipe, error) {
-	var completedRecipes []Recipe
 	defer func() {
-		r.Cleanup(completedRecipes)
+		// The Jobs of suspended executions are adopted once they are resumed
+		if !r.suspended {
+			r.Cleanup(r.completedRecipes)
+		}
 	}()
-	ch := r.pubsub.Channel()
-
-	messageCount := 0
-
-	timeoutDuration := time.Duration(r.config.RecipeTimeout) * time.Second
-	timeout := time.NewTimer(timeoutDuration)
-	shouldBreak := false
-
-	for {
+	ch := r.results.Messages()
+	completed := r.completed
+
+	// The deadline is kept across restarts, so that recovered executions time out correctly
+	timeout := time.NewTimer(time.Until(r.deadline))
+	jobTicker := time.NewTicker(jobPollInterval)
+	defer jobTicker.Stop()
+	r.launchReadyRecipes(completed)
+	r.checkpoint()
+	shouldBreak := !r.hasPendingRecipes(completed)
+	cancelled := false
+
+	for !shouldBreak {
 		select {
-		case msg := <-ch:
-			// Parse the recipe results from the Redis message
-			recipe, err := r.parseRecipeResults(msg.Payload)
+		case payload, ok := <-ch:
+			// Results can still be collected from the recipe Jobs if the broker goes away
+			if !ok {
+				logger.Warn(
+					"Result subscription closed, falling back to polling recipe Jobs",
+					zap.String("uuid", r.uuid),
+				)
+				ch = nil
+				continue
+			}
 
+			// Parse the recipe results from the broker message
+			recipe, err := r.parseRecipeResults(payload)
 			if err != nil {
-				logger.Error("Failed to parse recipe results", zap.Error(err))
+				r.rejectRecipeResults(err)
+			} else {
+				logger.Info(
+					"Received message from channel",
+					zap.String("topic", resultBroker.Topic(r.uuid)),
+					zap.Any("payload", recipe),
+				)
+				r.completeRecipe(recipe)
 			}
+			r.launchReadyRecipes(completed)
+			r.checkpoint()
+			shouldBreak = !r.hasPendingRecipes(completed)
+
+		// Check the recipe Jobs periodically to retry the ones that failed
+		case <-jobTicker.C:
+			r.reconcileJobs(completed)
+			r.pollRemoteRecipes()
+			r.launchReadyRecipes(completed)
+			r.checkpoint()
+			shouldBreak = !r.hasPendingRecipes(completed)
+
+		// Stop collecting results once the execution is cancelled
+		case <-r.traceContext().Done():
+			shouldBreak = true
+			cancelled = true
 			logger.Info(
-				"Received message from channel",
-				zap.String("channel", msg.Channel),
-				zap.Any("payload", recipe),
+				"Execution cancelled, stopping result collection", zap.String("uuid", r.uuid),
 			)
-			// Update the Reconciler recipe with the execution results
-			recipe.Config = r.recipes[recipe.Execution.Name].Config
-			r.recipes[recipe.Execution.Name] = recipe
-
-			completedRecipes = append(completedRecipes, recipe)
-			messageCount++
-			if messageCount == len(r.recipes) {
-				shouldBreak = true
-			}
+
+		// Checkpoint the execution and stop once the reconciler shuts down, so that it is resumed
+		case <-drain.Suspended():
+			shouldBreak = true
+			r.suspend()
 
 		// Close channel after timeout to protect against recipes that end up in error state
 		// Recipes might not complete if there are errors during runtime
 		case <-timeout.C:
 			shouldBreak = true
+			r.observeRecipeTimeouts(completed)
+			incidentRegistry.RecipesTimedOut(r.uuid)
 			logger.Warn(
 				fmt.Sprintf(
-					"Recipes failed to complete in %d seconds, closing channel",
-					r.config.RecipeTimeout,
+					"Recipes failed to complete in %s, closing channel",
+					executionTimeout(r.config, r.recipes),
 				),
 			)
 		}
-		if shouldBreak {
-			break
-		}
 	}
 
-	err := r.pubsub.Close()
+	err := r.results.Close()
+	if cancelled {
+		return r.completedRecipes, errExecutionCancelled
+	}
+	if r.suspended {
+		return r.completedRecipes, errExecutionSuspended
+	}
 	if err != nil {
-		logger.Error("Failed to close channel", zap.Error(err))
+		logger.Error("Failed to close subscription", zap.Error(err))
 		return nil, err
 	}
 
-	return completedRecipes, nil
+	return r.completedRecipes, nil
+}
+
+// Update the Reconciler recipe with the execution results.
+func (r *Reconciler) completeRecipe(recipe Recipe) {
+	recipe.Config = r.recipes[recipe.Execution.Name].Config
+	if rj, ok := r.jobs[recipe.Execution.Name]; ok {
+		recipe.Attempts = rj.attempts
+	}
+	// Cached results were already transformed when they were stored
+	if !recipe.Cached {
+		recipe = r.transformResults(recipe)
+	}
+	r.recipes[recipe.Execution.Name] = recipe
+	if recipe.Cached {
+		recipeResultsReused.WithLabelValues(recipeLabel(recipe.Execution.Name)).Inc()
+	} else {
+		r.observeRecipeResult(recipe)
+		r.storeFreshResult(recipe)
+	}
+	incidentRegistry.RecipeCompleted(r.uuid, recipe)
+	replyToIncidentThread(r.uuid, recipeThreadReply(recipe))
+
+	r.completedRecipes = append(r.completedRecipes, recipe)
+	r.completed[recipe.Execution.Name] = true
+}
+
+// Record the metrics for a received recipe result.
+func (r *Reconciler) observeRecipeResult(recipe Recipe) {
+	redisMessagesReceived.Inc()
+	recipeName := recipeLabel(recipe.Execution.Name)
+	recipeResults.WithLabelValues(recipeName, recipeStatusLabel(recipe.Execution.Status)).Inc()
+	if incident, ok := incidentRegistry.Get(r.uuid); ok {
+		if state, ok := incident.Recipes[recipe.Execution.Name]; ok {
+			recipeDuration.WithLabelValues(recipeName).Observe(
+				time.Since(state.StartedAt).Seconds(),
+			)
+		}
+	}
+}
+
+// Record the metrics for the recipes that failed to report their results in time.
+func (r *Reconciler) observeRecipeTimeouts(completed map[string]bool) {
+	for recipeName := range r.recipes {
+		if !completed[recipeName] && !r.finished[recipeName] {
+			recipeTimeouts.WithLabelValues(recipeLabel(recipeName)).Inc()
+		}
+	}
+}
+
+// Check whether any recipes are still expected to report their results.
+func (r *Reconciler) hasPendingRecipes(completed map[string]bool) bool {
+	for recipeName := range r.recipes {
+		if !completed[recipeName] && !r.finished[recipeName] {
+			return true
+		}
+	}
+	return false
 }
 
-// Aggregate the results of all recipes.
+// Check the Jobs of the recipes that have not reported their results yet, retrying the ones that
+// failed according to the retry policy of each recipe. Recipes are marked as failed once their
+// retries are exhausted.
+func (r *Reconciler) reconcileJobs(completed map[string]bool) {
+	pending := false
+	for recipeName := range r.jobs {
+		if !completed[recipeName] && !r.finished[recipeName] {
+			pending = true
+		}
+	}
+	if !pending {
+		return
+	}
+
+	labelSelector := metav1.FormatLabelSelector(&metav1.LabelSelector{
+		MatchLabels: map[string]string{
+			"app":  "euphrosyne",
+			"uuid": r.uuid,
+		},
+	})
+	// Failed Jobs, and whether they timed out
+	failedJobs := make(map[jobRef]bool)
+	succeededJobs := make(map[jobRef]*batchv1.Job)
+	for _, target := range r.targets() {
+		ctx, cancel := r.requestContext()
+		jobList, err := listTargetJobs(ctx, target, labelSelector)
+		cancel()
+		if err != nil {
+			logger.Error("Failed to list recipe Jobs", zap.Error(err))
+			return
+		}
+		for i, job := range jobList.Items {
+			ref := jobRef{target: target, name: job.Name}
+			if failed, timedOut := jobFailure(&job); failed {
+				failedJobs[ref] = timedOut
+			}
+			if job.Status.Succeeded > 0 {
+				succeededJobs[ref] = &jobList.Items[i]
+			}
+		}
+	}
+
+	for recipeName, rj := range r.jobs {
+		if completed[recipeName] || r.finished[recipeName] {
+			continue
+		}
+		ref := jobRef{target: r.recipeTarget(recipeName), name: rj.jobName}
+		if job, ok := succeededJobs[ref]; ok {
+			r.collectTerminationMessage(recipeName, job)
+			continue
+		}
+		timedOut, failed := failedJobs[ref]
+		if !failed {
+			continue
+		}
+
+		recipe := r.recipes[recipeName]
+		retries := 0
+		if recipe.Config != nil {
+			retries = recipe.Config.Retries
+		}
+		if rj.attempts > retries {
+			logger.Warn(
+				"Recipe Job failed, no retries left",
+				zap.String("recipe", recipeName),
+				zap.Int("attempts", rj.attempts),
+				zap.Bool("timedOut", timedOut),
+			)
+			recipeJobFailures.WithLabelValues(recipeLabel(recipeName)).Inc()
+			if timedOut {
+				r.failRecipeJob(
+					recipeName, RecipeStateTimedOut,
+					fmt.Sprintf("Recipe Job timed out after %d attempt(s)", rj.attempts),
+				)
+			} else {
+				r.failRecipeJob(
+					recipeName, RecipeStateFailed,
+					fmt.Sprintf("Recipe Job failed after %d attempt(s)", rj.attempts),
+				)
+			}
+			continue
+		}
+
+		if rj.retryAt.IsZero() {
+			backoff := retryBackoff(recipe.Config, rj.attempts)
+			rj.retryAt = time.Now().Add(backoff)
+			logger.Info(
+				"Recipe Job failed, scheduling retry",
+				zap.String("recipe", recipeName),
+				zap.Int("attempts", rj.attempts),
+				zap.Duration("backoff", backoff),
+			)
+			incidentRegistry.RecipeRetrying(r.uuid, recipeName, rj.attempts)
+		} else if time.Now().After(rj.retryAt) {
+			r.launchRecipe(recipeName, recipe, rj.cmName)
+		}
+	}
+}
+
+// Check whether a Job failed, and whether it failed because it ran past its deadline. Jobs that
+// time out are marked failed even if none of their Pods did.
+func jobFailure(job *batchv1.Job) (bool, bool) {
+	for _, condition := range job.Status.Conditions {
+		if condition.Type == batchv1.JobFailed && condition.Status == corev1.ConditionTrue {
+			return true, condition.Reason == batchv1.JobReasonDeadlineExceeded
+		}
+	}
+	return job.Status.Failed > 0, false
+}
+
+// Fail a recipe whose Job did not succeed on its last attempt. The recipe is reported along with
+// the completed ones, so that the final result includes its status and attempts.
+func (r *Reconciler) failRecipeJob(recipeName string, state string, reason string) {
+	r.finished[recipeName] = true
+	incidentRegistry.RecipeJobFinished(r.uuid, recipeName, state, reason)
+	r.recordFailedRecipe(recipeName, reason)
+}
+
+// Report a failed recipe along with the completed ones, so that the final result includes its
+// status and the attempts of its Job.
+func (r *Reconciler) recordFailedRecipe(recipeName string, reason string) {
+	recipe := Recipe{
+		Config: r.recipes[recipeName].Config,
+		Execution: &RecipeExecution{
+			Name:     recipeName,
+			Incident: r.uuid,
+			Status:   RecipeStatusFailed,
+			Results:  RecipeResults{Analysis: reason},
+		},
+	}
+	if rj, ok := r.jobs[recipeName]; ok {
+		recipe.Attempts = rj.attempts
+	}
+	r.completedRecipes = append(r.completedRecipes, recipe)
+}
+
+// Compute the delay before retrying a recipe, doubling the configured backoff on every attempt.
+func retryBackoff(recipeConfig *RecipeConfig, attempts int) time.Duration {
+	backoff := defaultRetryBackoff
+	if recipeConfig != nil && recipeConfig.Backoff != nil && recipeConfig.Backoff.Duration > 0 {
+		backoff = recipeConfig.Backoff.Duration
+	}
+	for i := 1; i < attempts && backoff < maxRetryBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxRetryBackoff {
+		backoff = maxRetryBackoff
+	}
+	return backoff
+}
+
+// Aggregate the analyses of the recipes calling for action.
 func (r *Reconciler) getIncidentAnalysis(completedRecipes []Recipe) string {
 	var incidentAnalysis string
 	for _, recipe := range completedRecipes {
-		if recipe.Execution.Status == "successful" {
+		// Informational analyses are reported separately
+		if actionableRecipe(recipe) {
+			attempts := ""
+			if recipe.Attempts > 1 {
+				attempts = fmt.Sprintf(" after %d attempts", recipe.Attempts)
+			}
+			if recipe.Cached {
+				attempts = " (cached result)"
+			}
 			message := fmt.Sprintf(
-				"Recipe '%s' completed successfully in response to incident '%s': %s",
+				"Recipe '%s' completed successfully%s in response to incident '%s': %s",
 				recipe.Execution.Name,
+				attempts,
 				recipe.Execution.Incident,
 				recipe.Execution.Results.Analysis,
 			)
@@ -159,76 +530,122 @@ func (r *Reconciler) getIncidentAnalysis(completedRecipes []Recipe) string {
 	return incidentAnalysis
 }
 
-// Retrieve the suggested actions from the completed recipes.
-func (r *Reconciler) getActions(completedRecipes []Recipe) []string {
-	var actions []string
-	for _, recipe := range completedRecipes {
-		if recipe.Execution.Status == "successful" {
-			actions = append(actions, recipe.Execution.Results.Actions...)
-		}
-	}
-	return actions
-}
-
 // Parse recipe results from Redis message.
 func (r *Reconciler) parseRecipeResults(message string) (Recipe, error) {
-	var recipe Recipe
-	err := json.Unmarshal([]byte(message), &recipe.Execution)
+	execution, err := ParseRecipeExecution([]byte(message))
 	if err != nil {
 		return Recipe{}, err
 	}
-	return recipe, nil
+	return NewCompletedRecipe(execution), nil
 }
 
-// Post message to Webex Bot.
-func (r *Reconciler) postMessageToWebexBot(message IncidentBotMessage) error {
-	// Convert the messages to JSON
-	jsonData, err := json.Marshal(message)
-	if err != nil {
-		return err
-	}
-
-	// Send the POST request
-	url := fmt.Sprintf("%s/api/analysis", r.config.WebexBotAddress)
-	resp, err := httpc.Post(url, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return err
+// Fail the recipe that published an invalid results message, rather than aggregating partial
+// results. Messages that cannot be attributed to a pending recipe of the execution are dropped.
+func (r *Reconciler) rejectRecipeResults(err error) {
+	recipeName := observeRejectedResults(err)
+	if _, ok := r.recipes[recipeName]; !ok || r.completed[recipeName] || r.finished[recipeName] {
+		logger.Error("Dropping invalid recipe results", zap.String("uuid", r.uuid), zap.Error(err))
+		return
 	}
-	defer resp.Body.Close()
+	logger.Error(
+		"Rejecting invalid recipe results",
+		zap.String("uuid", r.uuid),
+		zap.String("recipe", recipeName),
+		zap.Error(err),
+	)
+	r.finished[recipeName] = true
+	incidentRegistry.RecipeJobFinished(r.uuid, recipeName, RecipeStateFailed, err.Error())
+}
 
-	// Check the response status code
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("Unexpected response status: %s", resp.Status)
+// Count an invalid results message by the recipe that published it, if known, and its schema.
+// Returns the name of the recipe.
+func observeRejectedResults(err error) string {
+	recipeName, schema := "", "unknown"
+	var resultsErr *RecipeResultsError
+	if errors.As(err, &resultsErr) {
+		recipeName = resultsErr.Recipe
+		if resultsErr.Schema != "" {
+			schema = resultsErr.Schema
+		}
 	}
-
-	return nil
+	recipeResultsRejected.WithLabelValues(recipeLabel(recipeName), schema).Inc()
+	return recipeName
 }
 
-// Cleanup at the end of the reconciler execution.
+// Cleanup at the end of the reconciler execution. Resources labelled to be retained are skipped.
 func (r *Reconciler) Cleanup(completedRecipes []Recipe) {
+	// The resources of cancelled executions are deleted along with the cancellation
+	if errors.Is(r.traceContext().Err(), context.Canceled) {
+		logger.Info("Execution cancelled, skipping cleanup", zap.String("uuid", r.uuid))
+		return
+	}
 	logger.Info("Cleaning up created resources")
+	_, span := tracer.Start(
+		r.traceContext(), "cleanup",
+		trace.WithAttributes(attribute.String("euphrosyne.incident", r.uuid)),
+	)
+	defer span.End()
 
-	// Delete the completed recipe Jobs
+	logErr := r.snapshotLogs()
+	if logErr != nil {
+		logger.Error("Failed to snapshot recipe logs", zap.Error(logErr))
+		cleanupFailures.WithLabelValues("logs").Inc()
+	}
+
+	// Delete the completed recipe Jobs, according to the cleanup policy
 	labels := map[string]string{
 		"app":  "euphrosyne",
 		"uuid": r.uuid,
 	}
-	err := r.deleteCompletedJobsWithLabels(completedRecipes, labels)
-	if err != nil {
-		logger.Error("Failed to delete completed Jobs", zap.Error(err))
+	jobErr := errors.Join(
+		r.deleteCompletedJobsWithLabels(r.cleanupRecipes(completedRecipes), labels),
+		r.keepFailedJobs(completedRecipes),
+	)
+	if jobErr != nil {
+		logger.Error("Failed to delete completed Jobs", zap.Error(jobErr))
+		cleanupFailures.WithLabelValues("jobs").Inc()
 	}
-	err = r.deleteConfigMapsWithLabels(labels)
+	cmErr := r.deleteConfigMapsWithLabels(labels)
+	if cmErr != nil {
+		logger.Error("Failed to delete ConfigMaps", zap.Error(cmErr))
+		cleanupFailures.WithLabelValues("configmaps").Inc()
+	}
+
+	// Keep track of the resources retained for responders
+	retained, retainErr := r.listRetainedResources()
+	if retainErr != nil {
+		logger.Error("Failed to list retained resources", zap.Error(retainErr))
+		cleanupFailures.WithLabelValues("retained").Inc()
+	} else if len(retained) > 0 {
+		logger.Info("Retaining labelled resources", zap.Any("resources", retained))
+	}
+	err := errors.Join(logErr, jobErr, cmErr, retainErr)
 	if err != nil {
-		logger.Error("Failed to delete ConfigMaps", zap.Error(err))
+		recordSpanError(span, err)
+	}
+	span.SetAttributes(attribute.Int("euphrosyne.retained_resources", len(retained)))
+	incidentRegistry.CleanupFinished(r.uuid, retained, err)
+}
+
+// Get the context of the execution, for the spans of its recipes. The context is cancelled along
+// with the execution.
+func (r *Reconciler) traceContext() context.Context {
+	if r.ctx == nil {
+		return context.Background()
 	}
+	return r.ctx
 }
 
-// Delete completed Kubernetes Jobs with the specified labels.
+// Get the context of a Kubernetes API request made by the execution, which is cancelled along with
+// the execution or once the request times out.
+func (r *Reconciler) requestContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(r.traceContext(), kubeRequestTimeout)
+}
+
+// Delete completed Kubernetes Jobs with the specified labels, in the target of each recipe.
 func (r *Reconciler) deleteCompletedJobsWithLabels(
 	completedRecipes []Recipe, labels map[string]string,
 ) error {
-	jobClient := clientset.BatchV1().Jobs(r.config.RecipeNamespace)
-
 	propagationPolicy := metav1.DeletePropagationBackground
 	deleteOptions := metav1.DeleteOptions{
 		PropagationPolicy: &propagationPolicy,
@@ -240,15 +657,23 @@ func (r *Reconciler) deleteCompletedJobsWithLabels(
 	}
 	for _, recipe := range completedRecipes {
 		labelsCopy["recipe"] = recipe.Execution.Name
-		labelSelector := metav1.FormatLabelSelector(&metav1.LabelSelector{MatchLabels: labelsCopy})
+		labelSelector := cleanupLabelSelector(labelsCopy)
+		target := r.recipeTarget(recipe.Execution.Name)
+		client, err := clientsetFor(target.Cluster)
+		if err != nil {
+			return err
+		}
 
 		logger.Info(
 			"Deleting completed recipe Job with the following labels",
 			zap.String("labelSelector", labelSelector),
+			zap.Stringer("target", target),
 		)
-		err := jobClient.DeleteCollection(
-			context.TODO(), deleteOptions, metav1.ListOptions{LabelSelector: labelSelector},
+		ctx, cancel := r.requestContext()
+		err = client.BatchV1().Jobs(target.Namespace).DeleteCollection(
+			ctx, deleteOptions, metav1.ListOptions{LabelSelector: labelSelector},
 		)
+		cancel()
 		if err != nil {
 			return err
 		}
@@ -257,27 +682,33 @@ func (r *Reconciler) deleteCompletedJobsWithLabels(
 	return nil
 }
 
-// Delete ConfigMaps with the specified labels.
+// Delete ConfigMaps with the specified labels, in every target of the recipes.
 func (r *Reconciler) deleteConfigMapsWithLabels(labels map[string]string) error {
-	cmClient := clientset.CoreV1().ConfigMaps(r.config.RecipeNamespace)
-
 	propagationPolicy := metav1.DeletePropagationBackground
 	deleteOptions := metav1.DeleteOptions{
 		PropagationPolicy: &propagationPolicy,
 	}
 
-	labelSelector := metav1.FormatLabelSelector(&metav1.LabelSelector{MatchLabels: labels})
+	labelSelector := cleanupLabelSelector(labels)
 
-	logger.Info(
-		"Deleting ConfigMaps with the following labels",
-		zap.String("labelSelector", labelSelector),
-	)
-	err := cmClient.DeleteCollection(
-		context.TODO(), deleteOptions, metav1.ListOptions{LabelSelector: labelSelector},
-	)
-	if err != nil {
-		return err
+	var errs []error
+	for _, target := range r.targets() {
+		logger.Info(
+			"Deleting ConfigMaps with the following labels",
+			zap.String("labelSelector", labelSelector),
+			zap.Stringer("target", target),
+		)
+		client, err := clientsetFor(target.Cluster)
+		if err == nil {
+			ctx, cancel := r.requestContext()
+			err = client.CoreV1().ConfigMaps(target.Namespace).DeleteCollection(
+				ctx, deleteOptions, metav1.ListOptions{LabelSelector: labelSelector},
+			)
+			cancel()
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Target '%s': %w", target, err))
+		}
 	}
-
-	return nil
+	return errors.Join(errs...)
 }
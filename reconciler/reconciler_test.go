@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"sync"
 	"testing"
 	"time"
@@ -11,6 +12,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
 )
 
 // Test Reconciler.
@@ -35,7 +37,7 @@ func testCollectRecipeResult(t *testing.T) {
 	wg.Add(2)
 
 	testConfig := Config{
-		RecipeTimeout:       2,
+		RecipeTimeout:       2 * time.Second,
 		RecipeNamespace:     testNamespace,
 		ReconcilerNamespace: testNamespace,
 	}
@@ -96,7 +98,7 @@ func testCollectRecipeResult(t *testing.T) {
 // Test that created resources are cleaned up successfully.
 func testCleanup(t *testing.T) {
 	testConfig := Config{
-		RecipeTimeout:       2,
+		RecipeTimeout:       2 * time.Second,
 		RecipeNamespace:     testNamespace,
 		ReconcilerNamespace: testNamespace,
 	}
@@ -151,17 +153,7 @@ func testCleanup(t *testing.T) {
 	}
 
 	completedRecipe := Recipe{
-		Execution: &struct {
-			Name     string "json:\"name\""
-			Incident string "json:\"incident\""
-			Status   string "json:\"status\""
-			Results  struct {
-				Actions  []string "json:\"actions\""
-				Analysis string   "json:\"analysis\""
-				JSON     string   "json:\"json\""
-				Links    []string "json:\"links\""
-			} "json:\"results\""
-		}{Name: "test-job"},
+		Execution: &RecipeExecution{Name: "test-job"},
 	}
 	completedRecipes := []Recipe{
 		completedRecipe,
@@ -236,3 +228,122 @@ ConfigMapLoop:
 		}
 	}
 }
+
+// Test that the retry backoff doubles on every attempt, up to the maximum backoff.
+func TestRetryBackoff(t *testing.T) {
+	assert.Equal(t, defaultRetryBackoff, retryBackoff(nil, 1))
+	assert.Equal(t, 2*defaultRetryBackoff, retryBackoff(&RecipeConfig{}, 2))
+
+	recipeConfig := &RecipeConfig{Retries: 3, Backoff: &Duration{30 * time.Second}}
+	assert.Equal(t, 30*time.Second, retryBackoff(recipeConfig, 1))
+	assert.Equal(t, 60*time.Second, retryBackoff(recipeConfig, 2))
+	assert.Equal(t, 120*time.Second, retryBackoff(recipeConfig, 3))
+	assert.Equal(t, maxRetryBackoff, retryBackoff(recipeConfig, 10))
+}
+
+// Test that the default backoff is left out of the recipe configuration, as it is not set.
+func TestRetryBackoffOmitted(t *testing.T) {
+	data, err := json.Marshal(RecipeConfig{Retries: 1})
+	assert.Nil(t, err)
+	assert.NotContains(t, string(data), "backoff")
+
+	data, err = json.Marshal(RecipeConfig{Retries: 1, Backoff: &Duration{time.Minute}})
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), `"backoff":"1m0s"`)
+}
+
+// Replace the Kubernetes client with a fake one serving the failed Job of a recipe, optionally
+// timed out, i.e. failed by Kubernetes once its deadline passed rather than by its Pod.
+func useFailedJob(t *testing.T, uuid string, timedOut bool) {
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{
+		Name:      "test-1-recipe-abcde",
+		Namespace: testNamespace,
+		Labels:    map[string]string{"app": "euphrosyne", "uuid": uuid},
+	}}
+	if timedOut {
+		job.Status.Conditions = []batchv1.JobCondition{{
+			Type:   batchv1.JobFailed,
+			Status: corev1.ConditionTrue,
+			Reason: batchv1.JobReasonDeadlineExceeded,
+		}}
+	} else {
+		job.Status.Failed = 1
+	}
+
+	previous := clientset
+	t.Cleanup(func() { clientset = previous })
+	clientset = fake.NewSimpleClientset(job)
+}
+
+func newRetryingReconciler(uuid string, retries int) *Reconciler {
+	incidentRegistry.Register(uuid, Alert)
+	incidentRegistry.RecipeLaunched(uuid, "test-1-recipe", "test-1-recipe-abcde", 1)
+	return &Reconciler{
+		uuid:   uuid,
+		config: &testConfig,
+		recipes: map[string]Recipe{"test-1-recipe": {Config: &RecipeConfig{
+			Image: imageName, Retries: retries, Backoff: &Duration{time.Millisecond},
+		}}},
+		jobs: map[string]*recipeJob{
+			"test-1-recipe": {jobName: "test-1-recipe-abcde", cmName: "cm", attempts: 1},
+		},
+		finished:  map[string]bool{},
+		completed: map[string]bool{},
+	}
+}
+
+// Test that Jobs which time out are retried like the ones that fail.
+func TestReconcileTimedOutJobs(t *testing.T) {
+	uuid := "retry-1"
+	useFailedJob(t, uuid, true)
+	r := newRetryingReconciler(uuid, 1)
+
+	r.reconcileJobs(r.completed)
+	incident, _ := incidentRegistry.Get(uuid)
+	assert.Equal(t, RecipeStateRetrying, incident.Recipes["test-1-recipe"].State)
+
+	time.Sleep(2 * time.Millisecond)
+	r.reconcileJobs(r.completed)
+	assert.Equal(t, 2, r.jobs["test-1-recipe"].attempts)
+	assert.Empty(t, r.finished)
+	incident, _ = incidentRegistry.Get(uuid)
+	assert.Equal(t, RecipeStateRunning, incident.Recipes["test-1-recipe"].State)
+	assert.Equal(t, 2, incident.Recipes["test-1-recipe"].Attempts)
+}
+
+// Test that recipes whose retries are exhausted are reported failed, along with their attempts.
+func TestReconcileExhaustedJobs(t *testing.T) {
+	for state, timedOut := range map[string]bool{
+		RecipeStateFailed:   false,
+		RecipeStateTimedOut: true,
+	} {
+		t.Run(state, func(t *testing.T) {
+			uuid := "retry-" + state
+			useFailedJob(t, uuid, timedOut)
+			r := newRetryingReconciler(uuid, 0)
+
+			r.reconcileJobs(r.completed)
+			assert.True(t, r.finished["test-1-recipe"])
+			assert.Len(t, r.completedRecipes, 1)
+			recipe := r.completedRecipes[0]
+			assert.Equal(t, RecipeStatusFailed, recipe.Execution.Status)
+			assert.Equal(t, 1, recipe.Attempts)
+			incident, _ := incidentRegistry.Get(uuid)
+			assert.Equal(t, state, incident.Recipes["test-1-recipe"].State)
+			assert.Equal(t, 1, incident.Recipes["test-1-recipe"].Attempts)
+		})
+	}
+}
+
+// Test that recipes declaring a longer timeout extend the time to wait for results.
+func TestExecutionTimeout(t *testing.T) {
+	config := &Config{RecipeTimeout: 5 * time.Minute}
+	recipes := map[string]Recipe{
+		"test-1-recipe": {Config: &RecipeConfig{Timeout: Duration{time.Minute}}},
+		"test-2-recipe": {Config: &RecipeConfig{}},
+	}
+	assert.Equal(t, 5*time.Minute, executionTimeout(config, recipes))
+
+	recipes["test-3-recipe"] = Recipe{Config: &RecipeConfig{Timeout: Duration{time.Hour}}}
+	assert.Equal(t, time.Hour, executionTimeout(config, recipes))
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	batchv1 "k8s.io/api/batch/v1"
+)
+
+const (
+	executionKeyPrefix     = "euphrosyne:execution:"
+	executionLockKeyPrefix = "euphrosyne:execution-lock:"
+	// How long an execution stays claimed by a reconciler without being checkpointed.
+	executionLockTTL = 30 * time.Second
+	// How long execution records are kept past their deadline, in case cleanup never runs.
+	executionRecordGrace = 10 * time.Minute
+)
+
+// executionRecord is the durable state of a running reconciler, used to resume it after a restart.
+type executionRecord struct {
+	UUID        string                            `json:"uuid"`
+	Execution   string                            `json:"execution,omitempty"`
+	RequestType RequestType                       `json:"requestType"`
+	Data        map[string]interface{}            `json:"data"`
+	Recipes     map[string]Recipe                 `json:"recipes"`
+	Deadline    time.Time                         `json:"deadline"`
+	Jobs        map[string]jobRecord              `json:"jobs"`
+	Finished    map[string]bool                   `json:"finished"`
+	Waiting     map[string]map[string]interface{} `json:"waiting,omitempty"`
+	Completed   []Recipe                          `json:"completed"`
+	Remote      map[string]*remoteExecution       `json:"remote,omitempty"`
+	Federated   bool                              `json:"federated,omitempty"`
+}
+
+// jobRecord is the durable state of a recipe Job.
+type jobRecord struct {
+	JobName  string    `json:"jobName"`
+	CMName   string    `json:"cmName"`
+	Attempts int       `json:"attempts"`
+	RetryAt  time.Time `json:"retryAt,omitempty"`
+}
+
+// Check whether the state of running reconcilers is persisted, which requires the Redis store.
+func durableExecutions(config *Config) bool {
+	return config.IncidentStore == RedisIncidentStore
+}
+
+// Identify a run of an execution, i.e. the Jobs it launched.
+func newExecutionRun() string {
+	return uuid.New().String()
+}
+
+// Identify this reconciler instance when claiming executions.
+func executionOwner() string {
+	hostname, _ := os.Hostname()
+	return hostname
+}
+
+// Persist the state of the reconciler and renew its claim on the execution.
+func (r *Reconciler) checkpoint() {
+	// Canary self-tests are run again rather than recovered
+	if !durableExecutions(r.config) || r.canary {
+		return
+	}
+
+	record := executionRecord{
+		UUID:        r.uuid,
+		Execution:   r.execution,
+		RequestType: r.requestType,
+		Data:        *r.data,
+		Recipes:     r.recipes,
+		Deadline:    r.deadline,
+		Jobs:        make(map[string]jobRecord, len(r.jobs)),
+		Finished:    r.finished,
+		Waiting:     r.waiting,
+		Completed:   r.completedRecipes,
+		Remote:      r.remote,
+		Federated:   r.federated,
+	}
+	for recipeName, rj := range r.jobs {
+		record.Jobs[recipeName] = jobRecord{
+			JobName:  rj.jobName,
+			CMName:   rj.cmName,
+			Attempts: rj.attempts,
+			RetryAt:  rj.retryAt,
+		}
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		logger.Error("Failed to serialise execution", zap.String("uuid", r.uuid), zap.Error(err))
+		return
+	}
+	ctx := context.TODO()
+	ttl := time.Until(r.deadline) + executionRecordGrace
+	if err := rdb.Set(ctx, executionKeyPrefix+r.uuid, data, ttl).Err(); err != nil {
+		logger.Error("Failed to persist execution", zap.String("uuid", r.uuid), zap.Error(err))
+	}
+	err = rdb.Set(ctx, executionLockKeyPrefix+r.uuid, executionOwner(), executionLockTTL).Err()
+	if err != nil {
+		logger.Error("Failed to renew execution claim", zap.String("uuid", r.uuid), zap.Error(err))
+	}
+}
+
+// Suspend the reconciler on shutdown, persisting its state and releasing its claim on the
+// execution, so that the next leader resumes it right away. Executions whose state is not
+// persisted are abandoned.
+func (r *Reconciler) suspend() {
+	r.suspended = true
+	if !durableExecutions(r.config) || r.canary {
+		logger.Warn("Execution interrupted by shutdown", zap.String("uuid", r.uuid))
+		return
+	}
+	r.checkpoint()
+	if err := rdb.Del(context.TODO(), executionLockKeyPrefix+r.uuid).Err(); err != nil {
+		logger.Error(
+			"Failed to release execution claim", zap.String("uuid", r.uuid), zap.Error(err),
+		)
+	}
+	executionsSuspended.Inc()
+	logger.Info("Execution suspended", zap.String("uuid", r.uuid))
+}
+
+// Delete the persisted state of the reconciler once it has finished.
+func (r *Reconciler) deleteExecution() {
+	if !durableExecutions(r.config) {
+		return
+	}
+	// The keys are deleted one at a time, as they may live on different Redis Cluster nodes
+	for _, key := range []string{executionKeyPrefix + r.uuid, executionLockKeyPrefix + r.uuid} {
+		if err := rdb.Del(context.TODO(), key).Err(); err != nil {
+			logger.Error("Failed to delete execution", zap.String("uuid", r.uuid), zap.Error(err))
+		}
+	}
+}
+
+// Resume the executions that were interrupted by a restart of the reconciler, until the context is
+// done. Executions are only resumed if they are not claimed by another running reconciler. The
+// claims of a crashed reconciler, e.g. one replaced by a pod with a different name, are kept until
+// they expire, so the executions are claimed again until none of them is left behind.
+func RecoverExecutions(ctx context.Context, config *Config) {
+	if !durableExecutions(config) {
+		return
+	}
+	for recoverExecutions(ctx, config) > 0 {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(executionLockTTL):
+		}
+	}
+}
+
+// Resume the executions that are not claimed by another reconciler, returning the number of the
+// ones that are still claimed.
+func recoverExecutions(ctx context.Context, config *Config) int {
+	keys, err := scanKeys(ctx, executionKeyPrefix+"*")
+	if err != nil {
+		logger.Error("Failed to list executions", zap.Error(err))
+	}
+	pending := 0
+	for _, key := range keys {
+		uuid := key[len(executionKeyPrefix):]
+		if activeExecutions.Active(uuid) {
+			continue
+		}
+		claimed, err := claimExecution(ctx, uuid)
+		if err != nil {
+			logger.Error("Failed to claim execution", zap.String("uuid", uuid), zap.Error(err))
+			continue
+		}
+		if !claimed {
+			pending++
+			continue
+		}
+
+		// Recovered executions outlive the leadership of the reconciler that recovered them
+		r, err := restoreReconciler(context.TODO(), config, uuid)
+		if err != nil {
+			logger.Error("Failed to recover execution", zap.String("uuid", uuid), zap.Error(err))
+			continue
+		}
+		logger.Info(
+			"Recovered execution",
+			zap.String("uuid", uuid),
+			zap.Time("deadline", r.deadline),
+		)
+		executionQueue.Resume(r)
+	}
+	return pending
+}
+
+// Claim an execution, unless it is claimed by another reconciler.
+func claimExecution(ctx context.Context, uuid string) (bool, error) {
+	owner := executionOwner()
+	claimed, err := rdb.SetNX(ctx, executionLockKeyPrefix+uuid, owner, executionLockTTL).Result()
+	if err != nil || claimed {
+		return claimed, err
+	}
+	// A restarted reconciler keeps its name, and can reclaim its own executions
+	current, err := rdb.Get(ctx, executionLockKeyPrefix+uuid).Result()
+	if err == redis.Nil {
+		return claimExecution(ctx, uuid)
+	}
+	return current == owner, err
+}
+
+// Rebuild a reconciler from its persisted state, re-adopting the Jobs it launched.
+func restoreReconciler(ctx context.Context, config *Config, uuid string) (*Reconciler, error) {
+	data, err := rdb.Get(ctx, executionKeyPrefix+uuid).Bytes()
+	if err != nil {
+		return nil, err
+	}
+	var record executionRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+
+	incidentRegistry.Restore(uuid)
+	ctx = activeExecutions.Track(ctx, uuid)
+	config = executionConfig(config, record.Data)
+	r, err := NewReconciler(ctx, config, &record.Data, record.Recipes, record.RequestType)
+	if err != nil {
+		activeExecutions.Unregister(uuid)
+		return nil, err
+	}
+	r.execution = record.Execution
+	r.deadline = record.Deadline
+	r.federated = record.Federated
+	for recipeName, remote := range record.Remote {
+		r.remote[recipeName] = remote
+	}
+	for recipeName, rj := range record.Jobs {
+		r.jobs[recipeName] = &recipeJob{
+			jobName:  rj.JobName,
+			cmName:   rj.CMName,
+			attempts: rj.Attempts,
+			retryAt:  rj.RetryAt,
+		}
+	}
+	for recipeName, finished := range record.Finished {
+		r.finished[recipeName] = finished
+	}
+	for recipeName, waitingData := range record.Waiting {
+		r.waiting[recipeName] = waitingData
+	}
+	for _, recipe := range record.Completed {
+		r.completed[recipe.Execution.Name] = true
+		r.completedRecipes = append(r.completedRecipes, recipe)
+	}
+
+	existingJobs, err := getExistingJobs(ctx, uuid, r.execution, r.targets())
+	if err != nil {
+		r.results.Close()
+		return nil, err
+	}
+	r.reconcileRecoveredJobs(existingJobs)
+	auditLog.Record(AuditExecutionRecovered, uuid, map[string]interface{}{
+		"deadline": r.deadline,
+	})
+	return r, nil
+}
+
+// Reconcile the recovered Jobs with the ones found in the cluster. Jobs that succeeded while the
+// reconciler was down have their results read from their termination message, while failed Jobs
+// are handled by the retry policy as usual. Jobs created right before a restart, and therefore not
+// yet checkpointed, are adopted rather than launched again, while recipes that were not launched
+// at all are failed.
+func (r *Reconciler) reconcileRecoveredJobs(existingJobs map[string]*batchv1.Job) {
+	for recipeName := range r.recipes {
+		_, launched := r.jobs[recipeName]
+		_, waiting := r.waiting[recipeName]
+		_, remote := r.remote[recipeName]
+		if launched || waiting || remote || r.completed[recipeName] || r.finished[recipeName] {
+			continue
+		}
+		if !r.adoptJob(recipeName, existingJobs) {
+			r.finished[recipeName] = true
+			incidentRegistry.RecipeJobFinished(
+				r.uuid, recipeName, RecipeStateFailed, "Recipe was not launched before the restart",
+			)
+		}
+	}
+	for recipeName := range r.jobs {
+		if r.completed[recipeName] || r.finished[recipeName] {
+			continue
+		}
+		if _, ok := existingJobs[recipeName]; !ok {
+			r.finished[recipeName] = true
+			incidentRegistry.RecipeJobFinished(
+				r.uuid, recipeName, RecipeStateFailed, "Recipe Job not found after recovery",
+			)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Test that the state of a reconciler is persisted and can be claimed on recovery.
+func TestCheckpointExecution(t *testing.T) {
+	ctx := context.Background()
+	uuid := "recovery-1"
+	data := map[string]interface{}{"uuid": uuid}
+	recipe, err := (&Reconciler{}).parseRecipeResults(
+		`{"name": "test-1-recipe", "status": "successful", "results": {"analysis": "ok"}}`,
+	)
+	assert.Nil(t, err)
+
+	r := &Reconciler{
+		uuid:        uuid,
+		config:      &Config{IncidentStore: RedisIncidentStore},
+		data:        &data,
+		recipes:     map[string]Recipe{"test-1-recipe": {}, "test-2-recipe": {}},
+		requestType: Alert,
+		deadline:    time.Now().Add(time.Minute).UTC().Round(time.Second),
+		jobs: map[string]*recipeJob{
+			"test-1-recipe": {jobName: "test-1-recipe-abcde", cmName: "cm", attempts: 1},
+			"test-2-recipe": {jobName: "test-2-recipe-fghij", cmName: "cm", attempts: 2},
+		},
+		finished:         map[string]bool{},
+		completed:        map[string]bool{"test-1-recipe": true},
+		completedRecipes: []Recipe{recipe},
+	}
+	r.checkpoint()
+
+	raw, err := rdb.Get(ctx, executionKeyPrefix+uuid).Bytes()
+	assert.Nil(t, err)
+	var record executionRecord
+	assert.Nil(t, json.Unmarshal(raw, &record))
+	assert.Equal(t, Alert, record.RequestType)
+	assert.True(t, r.deadline.Equal(record.Deadline))
+	assert.Equal(t, 2, record.Jobs["test-2-recipe"].Attempts)
+	assert.Equal(t, "ok", record.Completed[0].Execution.Results.Analysis)
+
+	// Executions can be reclaimed by the same reconciler, but not by others
+	claimed, err := claimExecution(ctx, uuid)
+	assert.Nil(t, err)
+	assert.True(t, claimed)
+	rdb.Set(ctx, executionLockKeyPrefix+uuid, "another-reconciler", executionLockTTL)
+	claimed, err = claimExecution(ctx, uuid)
+	assert.Nil(t, err)
+	assert.False(t, claimed)
+
+	r.deleteExecution()
+	assert.Equal(t, int64(0), rdb.Exists(ctx, executionKeyPrefix+uuid).Val())
+	assert.Equal(t, int64(0), rdb.Exists(ctx, executionLockKeyPrefix+uuid).Val())
+}
+
+// Test that Jobs which disappeared while the reconciler was down are not waited for.
+func TestReconcileRecoveredJobs(t *testing.T) {
+	uuid := "recovery-2"
+	incidentRegistry.Register(uuid, Alert)
+	r := &Reconciler{
+		uuid: uuid,
+		jobs: map[string]*recipeJob{
+			"test-1-recipe": {jobName: "test-1-recipe-abcde"},
+			"test-2-recipe": {jobName: "test-2-recipe-fghij"},
+			"test-3-recipe": {jobName: "test-3-recipe-klmno"},
+		},
+		finished:  map[string]bool{},
+		completed: map[string]bool{},
+	}
+	succeeded := &batchv1.Job{}
+	succeeded.Status.Succeeded = 1
+	r.reconcileRecoveredJobs(map[string]*batchv1.Job{
+		"test-1-recipe": succeeded,
+		"test-2-recipe": {},
+	})
+
+	// Completed Jobs have their results read from their termination message
+	assert.Equal(t, map[string]bool{"test-3-recipe": true}, r.finished)
+	incident, _ := incidentRegistry.Get(uuid)
+	assert.Equal(t, RecipeStateFailed, incident.Recipes["test-3-recipe"].State)
+}
+
+// Test that the executions of a crashed reconciler, whose replacement has a different name, are
+// left pending until their claims expire, and can then be claimed.
+func TestClaimExpiredExecution(t *testing.T) {
+	ctx := context.Background()
+	uuid := "recovery-3"
+	config := &Config{IncidentStore: RedisIncidentStore}
+	defer rdb.Del(ctx, executionKeyPrefix+uuid, executionLockKeyPrefix+uuid)
+
+	rdb.Set(ctx, executionKeyPrefix+uuid, "{}", time.Minute)
+	rdb.Set(ctx, executionLockKeyPrefix+uuid, "crashed-reconciler", 100*time.Millisecond)
+	assert.Equal(t, 1, recoverExecutions(ctx, config))
+	claimed, err := claimExecution(ctx, uuid)
+	assert.Nil(t, err)
+	assert.False(t, claimed)
+
+	time.Sleep(200 * time.Millisecond)
+	claimed, err = claimExecution(ctx, uuid)
+	assert.Nil(t, err)
+	assert.True(t, claimed)
+	assert.Equal(t, executionOwner(), rdb.Get(ctx, executionLockKeyPrefix+uuid).Val())
+}
+
+// Test that the Jobs created right before a restart are adopted on recovery, while recipes that
+// were not launched at all are failed.
+func TestAdoptRecoveredJobs(t *testing.T) {
+	uuid := "recovery-4"
+	incidentRegistry.Register(uuid, Alert)
+	r := &Reconciler{
+		uuid:      uuid,
+		recipes:   map[string]Recipe{"test-1-recipe": {}, "test-2-recipe": {}},
+		jobs:      map[string]*recipeJob{},
+		finished:  map[string]bool{},
+		completed: map[string]bool{},
+		waiting:   map[string]map[string]interface{}{},
+		remote:    map[string]*remoteExecution{},
+	}
+	succeeded := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "test-1-recipe-abcde"}}
+	succeeded.Status.Succeeded = 1
+	r.reconcileRecoveredJobs(map[string]*batchv1.Job{"test-1-recipe": succeeded})
+
+	// Succeeded Jobs are left to be collected from their termination message
+	assert.Equal(t, "test-1-recipe-abcde", r.jobs["test-1-recipe"].jobName)
+	assert.Equal(t, map[string]bool{"test-2-recipe": true}, r.finished)
+	incident, _ := incidentRegistry.Get(uuid)
+	assert.Equal(t, RecipeStateFailed, incident.Recipes["test-2-recipe"].State)
+}
+
+// Test that a re-requested execution under the same UUID does not match the Jobs of the previous
+// run, which a recovered run of the previous execution still does.
+func TestExistingJobsSelector(t *testing.T) {
+	previous := labels.Set{
+		"app": "euphrosyne", "uuid": "recovery-5", "recipe": "logs", executionLabel: "run-1",
+	}
+	for _, testCase := range []struct {
+		execution string
+		matches   bool
+	}{
+		{execution: "run-1", matches: true},
+		{execution: "run-2", matches: false},
+		// Executions checkpointed before their runs were identified
+		{execution: "", matches: true},
+	} {
+		selector, err := labels.Parse(existingJobsSelector("recovery-5", testCase.execution))
+		assert.Nil(t, err)
+		assert.Equal(t, testCase.matches, selector.Matches(previous), testCase.execution)
+	}
+}
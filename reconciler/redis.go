@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// Supported topologies of the Redis deployment.
+const (
+	StandaloneRedisMode = "standalone"
+	SentinelRedisMode   = "sentinel"
+	ClusterRedisMode    = "cluster"
+)
+
+const (
+	// Bounds of the delay between attempts to restore a lost result subscription
+	minResubscribeBackoff = 100 * time.Millisecond
+	maxResubscribeBackoff = 10 * time.Second
+)
+
+// How long a result subscription waits for a message before checking that its connection is alive.
+var subscriptionHealthCheckInterval = 30 * time.Second
+
+// Check whether the provided Redis mode is supported.
+func isValidRedisMode(mode string) bool {
+	switch mode {
+	case StandaloneRedisMode, SentinelRedisMode, ClusterRedisMode:
+		return true
+	}
+	return false
+}
+
+// Return the configured Redis addresses, i.e. the address of a standalone Redis, or the addresses
+// of the Sentinels or of the Cluster nodes.
+func redisAddresses(config *Config) []string {
+	var addresses []string
+	for _, address := range strings.Split(config.RedisAddress, ",") {
+		address = strings.TrimSpace(address)
+		if address != "" {
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses
+}
+
+// Check that the Redis connection settings are consistent with the topology of the deployment.
+func validateRedisConfig(config *Config) error {
+	if !isValidRedisMode(config.RedisMode) {
+		return fmt.Errorf("Unsupported Redis mode '%s'", config.RedisMode)
+	}
+	addresses := redisAddresses(config)
+	if len(addresses) == 0 {
+		return fmt.Errorf("A Redis address is required")
+	}
+	for _, address := range addresses {
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			return fmt.Errorf("Invalid Redis address '%s', expected <host>:<port>", address)
+		}
+	}
+	if config.RedisMode == StandaloneRedisMode && len(addresses) > 1 {
+		return fmt.Errorf("A single Redis address is expected in standalone mode")
+	}
+	if config.RedisMode == SentinelRedisMode && config.RedisMasterName == "" {
+		return fmt.Errorf("A master name is required for Redis Sentinel")
+	}
+	if config.RedisDB < 0 {
+		return fmt.Errorf("The Redis database cannot be negative")
+	}
+	if config.RedisMode == ClusterRedisMode && config.RedisDB != 0 {
+		return fmt.Errorf("Redis Cluster only supports database 0")
+	}
+	if config.RedisTLSCA != "" && !config.RedisTLS {
+		return fmt.Errorf("TLS must be enabled to verify Redis against a CA")
+	}
+	return nil
+}
+
+// Build the TLS configuration of the Redis connection, if TLS is enabled. The certificate of Redis
+// is verified against the configured CA, or the system certificate pool.
+func redisTLSConfig(config *Config) (*tls.Config, error) {
+	if !config.RedisTLS {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if config.RedisTLSCA != "" {
+		caCert, err := os.ReadFile(config.RedisTLSCA)
+		if err != nil {
+			return nil, err
+		}
+		rootCAs := x509.NewCertPool()
+		if !rootCAs.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("Failed to parse Redis CA '%s'", config.RedisTLSCA)
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+	return tlsConfig, nil
+}
+
+// Create the Redis client matching the topology of the Redis deployment. Sentinel clients follow
+// the master across failovers, while Cluster clients route commands to the node owning each key.
+func newRedisClient(config *Config) (redis.UniversalClient, error) {
+	tlsConfig, err := redisTLSConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	addresses := redisAddresses(config)
+
+	switch config.RedisMode {
+	case SentinelRedisMode:
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       config.RedisMasterName,
+			SentinelAddrs:    addresses,
+			SentinelPassword: config.RedisSentinelPassword,
+			Username:         config.RedisUsername,
+			Password:         config.RedisPassword,
+			DB:               config.RedisDB,
+			TLSConfig:        tlsConfig,
+		}), nil
+	case ClusterRedisMode:
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:     addresses,
+			Username:  config.RedisUsername,
+			Password:  config.RedisPassword,
+			TLSConfig: tlsConfig,
+		}), nil
+	default:
+		address := config.RedisAddress
+		if len(addresses) > 0 {
+			address = addresses[0]
+		}
+		return redis.NewClient(&redis.Options{
+			Addr:      address,
+			Username:  config.RedisUsername,
+			Password:  config.RedisPassword,
+			DB:        config.RedisDB,
+			TLSConfig: tlsConfig,
+		}), nil
+	}
+}
+
+// Return the keys matching a pattern. Each master of a Redis Cluster only holds a share of the
+// keys, so all of them are scanned.
+func scanKeys(ctx context.Context, pattern string) ([]string, error) {
+	cluster, ok := rdb.(*redis.ClusterClient)
+	if !ok {
+		return scanClientKeys(ctx, rdb, pattern)
+	}
+
+	var keys []string
+	var mutex sync.Mutex
+	err := cluster.ForEachMaster(ctx, func(ctx context.Context, client *redis.Client) error {
+		masterKeys, err := scanClientKeys(ctx, client, pattern)
+		mutex.Lock()
+		defer mutex.Unlock()
+		keys = append(keys, masterKeys...)
+		return err
+	})
+	return keys, err
+}
+
+// Return the keys matching a pattern on a single Redis node.
+func scanClientKeys(ctx context.Context, client redis.Cmdable, pattern string) ([]string, error) {
+	var keys []string
+	iter := client.Scan(ctx, 0, pattern, 0).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	return keys, iter.Err()
+}
+
+// Return the Redis address recipes should publish their results to. Recipes cannot follow a
+// failover, so they are given the address of the current master when using Redis Sentinel.
+func recipeRedisAddress(config *Config) string {
+	addresses := redisAddresses(config)
+	if len(addresses) == 0 {
+		return config.RedisAddress
+	}
+	if config.RedisMode != SentinelRedisMode {
+		return addresses[0]
+	}
+
+	tlsConfig, _ := redisTLSConfig(config)
+	for _, address := range addresses {
+		sentinel := redis.NewSentinelClient(&redis.Options{
+			Addr:      address,
+			Password:  config.RedisSentinelPassword,
+			TLSConfig: tlsConfig,
+		})
+		master, err := sentinel.GetMasterAddrByName(context.TODO(), config.RedisMasterName).Result()
+		sentinel.Close()
+		if err == nil && len(master) == 2 {
+			return net.JoinHostPort(master[0], master[1])
+		}
+		logger.Warn(
+			"Failed to resolve Redis master through Sentinel",
+			zap.String("sentinel", address),
+			zap.Error(err),
+		)
+	}
+	return addresses[0]
+}
+
+// Double the delay before the next attempt to restore a lost result subscription, up to the
+// maximum backoff.
+func nextResubscribeBackoff(backoff time.Duration) time.Duration {
+	return min(2*backoff, maxResubscribeBackoff)
+}
+
+// Check whether an error is a network timeout, i.e. no message arrived in time.
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
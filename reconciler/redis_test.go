@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that the Redis connection settings are checked against the topology of the deployment.
+func TestValidateRedisConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		valid  bool
+	}{
+		{
+			name:   "Standalone",
+			config: Config{RedisMode: StandaloneRedisMode, RedisAddress: "localhost:6379"},
+			valid:  true,
+		},
+		{
+			name:   "Unsupported mode",
+			config: Config{RedisMode: "replicated", RedisAddress: "localhost:6379"},
+		},
+		{
+			name:   "Missing address",
+			config: Config{RedisMode: StandaloneRedisMode, RedisAddress: " , "},
+		},
+		{
+			name:   "Missing port",
+			config: Config{RedisMode: StandaloneRedisMode, RedisAddress: "redis"},
+		},
+		{
+			name: "Multiple standalone addresses",
+			config: Config{
+				RedisMode: StandaloneRedisMode, RedisAddress: "redis-0:6379,redis-1:6379",
+			},
+		},
+		{
+			name: "Sentinel",
+			config: Config{
+				RedisMode:       SentinelRedisMode,
+				RedisAddress:    "sentinel-0:26379, sentinel-1:26379",
+				RedisMasterName: "mymaster",
+				RedisDB:         1,
+			},
+			valid: true,
+		},
+		{
+			name:   "Sentinel without master name",
+			config: Config{RedisMode: SentinelRedisMode, RedisAddress: "sentinel-0:26379"},
+		},
+		{
+			name:   "Cluster",
+			config: Config{RedisMode: ClusterRedisMode, RedisAddress: "node-0:6379,node-1:6379"},
+			valid:  true,
+		},
+		{
+			name: "Cluster with database",
+			config: Config{
+				RedisMode: ClusterRedisMode, RedisAddress: "node-0:6379", RedisDB: 1,
+			},
+		},
+		{
+			name: "Negative database",
+			config: Config{
+				RedisMode: StandaloneRedisMode, RedisAddress: "localhost:6379", RedisDB: -1,
+			},
+		},
+		{
+			name: "CA without TLS",
+			config: Config{
+				RedisMode:    StandaloneRedisMode,
+				RedisAddress: "localhost:6379",
+				RedisTLSCA:   "ca.pem",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateRedisConfig(&tt.config)
+			assert.Equal(t, tt.valid, err == nil, err)
+		})
+	}
+}
+
+// Test that the TLS configuration of the Redis connection trusts the configured CA.
+func TestRedisTLSConfig(t *testing.T) {
+	tlsConfig, err := redisTLSConfig(&Config{})
+	assert.Nil(t, err)
+	assert.Nil(t, tlsConfig)
+
+	tlsConfig, err = redisTLSConfig(&Config{RedisTLS: true})
+	assert.Nil(t, err)
+	assert.Nil(t, tlsConfig.RootCAs)
+
+	_, err = redisTLSConfig(&Config{RedisTLS: true, RedisTLSCA: "/nonexistent/ca.pem"})
+	assert.NotNil(t, err)
+
+	invalidCA := filepath.Join(t.TempDir(), "ca.pem")
+	assert.Nil(t, os.WriteFile(invalidCA, []byte("not a certificate"), 0o600))
+	_, err = redisTLSConfig(&Config{RedisTLS: true, RedisTLSCA: invalidCA})
+	assert.NotNil(t, err)
+}
+
+// Test that the Redis client matches the topology of the deployment.
+func TestNewRedisClient(t *testing.T) {
+	client, err := newRedisClient(&Config{
+		RedisMode: StandaloneRedisMode, RedisAddress: "localhost:6379", RedisDB: 2,
+	})
+	assert.Nil(t, err)
+	assert.IsType(t, &redis.Client{}, client)
+	assert.Equal(t, 2, client.(*redis.Client).Options().DB)
+
+	client, err = newRedisClient(&Config{
+		RedisMode:       SentinelRedisMode,
+		RedisAddress:    "sentinel-0:26379,sentinel-1:26379",
+		RedisMasterName: "mymaster",
+	})
+	assert.Nil(t, err)
+	assert.IsType(t, &redis.Client{}, client)
+
+	client, err = newRedisClient(&Config{
+		RedisMode: ClusterRedisMode, RedisAddress: "node-0:6379,node-1:6379", RedisTLS: true,
+	})
+	assert.Nil(t, err)
+	assert.IsType(t, &redis.ClusterClient{}, client)
+	assert.NotNil(t, client.(*redis.ClusterClient).Options().TLSConfig)
+}
+
+// Test that the keys matching a pattern are all returned.
+func TestScanKeys(t *testing.T) {
+	ctx := context.Background()
+	for _, key := range []string{"scan-test:a", "scan-test:b", "scan-other:c"} {
+		assert.Nil(t, rdb.Set(ctx, key, "value", time.Minute).Err())
+		defer rdb.Del(ctx, key)
+	}
+
+	keys, err := scanKeys(ctx, "scan-test:*")
+	assert.Nil(t, err)
+	sort.Strings(keys)
+	assert.Equal(t, []string{"scan-test:a", "scan-test:b"}, keys)
+}
+
+// Test that recipes publish to the first Redis address, unless the master is resolved through
+// Sentinel.
+func TestRecipeRedisAddress(t *testing.T) {
+	assert.Equal(t, "localhost:6379", recipeRedisAddress(&Config{
+		RedisMode: StandaloneRedisMode, RedisAddress: "localhost:6379",
+	}))
+	assert.Equal(t, "node-0:6379", recipeRedisAddress(&Config{
+		RedisMode: ClusterRedisMode, RedisAddress: "node-0:6379, node-1:6379",
+	}))
+}
+
+// Test that the delay between attempts to restore a subscription doubles up to the maximum.
+func TestNextResubscribeBackoff(t *testing.T) {
+	assert.Equal(t, 200*time.Millisecond, nextResubscribeBackoff(minResubscribeBackoff))
+	assert.Equal(t, maxResubscribeBackoff, nextResubscribeBackoff(8*time.Second))
+	assert.Equal(t, maxResubscribeBackoff, nextResubscribeBackoff(maxResubscribeBackoff))
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+)
+
+const (
+	// Table holding the incident records in PostgreSQL.
+	resultStoreTable = "euphrosyne_incidents"
+	// Time allowed for writing an incident record.
+	resultStoreTimeout = 30 * time.Second
+)
+
+// Store of the records of completed incidents, only set if enabled.
+var resultStore ResultStore
+
+// IncidentRecord is the full record of a completed incident, kept for auditing and postmortems.
+type IncidentRecord struct {
+	UUID        string                 `json:"uuid"`
+	RequestType string                 `json:"requestType"`
+	Alert       map[string]interface{} `json:"alert"`
+	Recipes     []Recipe               `json:"recipes"`
+	// State of the run of each recipe, including the recipes that did not report results
+	States   map[string]*RecipeState `json:"states,omitempty"`
+	Analysis string                  `json:"analysis"`
+	Actions  []string                `json:"actions"`
+	Findings []Finding               `json:"findings,omitempty"`
+	Links    []string                `json:"links"`
+	// Logs of the recipe Pods, by recipe, if snapshotted
+	Logs map[string]string `json:"logs,omitempty"`
+	// Compliance of the execution with the recipes required for its alert, if any
+	Compliance  *Compliance `json:"compliance,omitempty"`
+	CreatedAt   time.Time   `json:"createdAt"`
+	CompletedAt time.Time   `json:"completedAt"`
+}
+
+// ResultStore persists the records of completed incidents beyond the lifetime of the reconciler.
+type ResultStore interface {
+	// Write the record of an incident, replacing any previous record of the same incident
+	Save(ctx context.Context, record IncidentRecord) error
+	// Read the records of the incidents completed since a point in time
+	List(ctx context.Context, since time.Time) ([]IncidentRecord, error)
+	// Delete the records of incidents completed before the cutoff, except for the held ones,
+	// returning how many were deleted
+	Prune(ctx context.Context, cutoff time.Time, held []string) (int, error)
+	Close() error
+}
+
+// Check whether a result store destination is supported.
+func isValidResultStore(destination string) bool {
+	u, err := url.Parse(destination)
+	if err != nil {
+		return false
+	}
+	switch u.Scheme {
+	case "postgres", "postgresql", "s3", "file":
+		return true
+	}
+	return false
+}
+
+// Initialise a result store from a destination URL, either a PostgreSQL connection URL or an
+// object store destination, as supported by the compliance export.
+func NewResultStore(ctx context.Context, destination string, endpoint string) (ResultStore, error) {
+	if !isValidResultStore(destination) {
+		return nil, fmt.Errorf("Unsupported result store '%s'", destination)
+	}
+	if strings.HasPrefix(destination, "postgres") {
+		return newPostgresResultStore(ctx, destination)
+	}
+
+	store, prefix, err := NewObjectStore(destination, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	return &objectResultStore{store: store, prefix: prefix}, nil
+}
+
+// Build the record of an incident from the results collected by the reconciler.
+func (r *Reconciler) incidentRecord(
+	completedRecipes []Recipe, message IncidentBotMessage,
+) IncidentRecord {
+	record := IncidentRecord{
+		UUID:        r.uuid,
+		RequestType: r.requestType.String(),
+		Alert:       *r.data,
+		Recipes:     completedRecipes,
+		Analysis:    message.Analysis,
+		Actions:     message.Actions,
+		Findings:    message.Findings,
+		Links:       aggregateLinks(completedRecipes),
+		Logs:        r.logs,
+		Compliance:  message.Compliance,
+		CompletedAt: time.Now().UTC(),
+	}
+	if incident, ok := incidentRegistry.Get(r.uuid); ok {
+		record.CreatedAt = incident.CreatedAt
+		record.States = incident.Recipes
+	}
+	return record
+}
+
+// Write the record of the incident to the result store, if enabled.
+func (r *Reconciler) persistIncidentRecord(completedRecipes []Recipe, message IncidentBotMessage) {
+	if resultStore == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(
+		context.WithoutCancel(r.traceContext()), resultStoreTimeout,
+	)
+	defer cancel()
+
+	if err := resultStore.Save(ctx, r.incidentRecord(completedRecipes, message)); err != nil {
+		resultStoreFailures.Inc()
+		logger.Error("Failed to store incident record", zap.String("uuid", r.uuid), zap.Error(err))
+	}
+}
+
+// postgresResultStore keeps the incident records in a PostgreSQL table, with the full record as a
+// JSONB column, so that they can be queried with SQL.
+type postgresResultStore struct {
+	db *sql.DB
+}
+
+func newPostgresResultStore(ctx context.Context, dsn string) (*postgresResultStore, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+resultStoreTable+` (
+		uuid TEXT PRIMARY KEY,
+		request_type TEXT NOT NULL,
+		created_at TIMESTAMPTZ,
+		completed_at TIMESTAMPTZ NOT NULL,
+		record JSONB NOT NULL
+	)`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("Failed to create table '%s': %w", resultStoreTable, err)
+	}
+	return &postgresResultStore{db: db}, nil
+}
+
+func (s *postgresResultStore) Save(ctx context.Context, record IncidentRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	var createdAt interface{}
+	if !record.CreatedAt.IsZero() {
+		createdAt = record.CreatedAt
+	}
+	_, err = s.db.ExecContext(
+		ctx,
+		`INSERT INTO `+resultStoreTable+` (uuid, request_type, created_at, completed_at, record)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (uuid) DO UPDATE SET completed_at = EXCLUDED.completed_at,
+			record = EXCLUDED.record`,
+		record.UUID, record.RequestType, createdAt, record.CompletedAt, string(data),
+	)
+	return err
+}
+
+func (s *postgresResultStore) List(ctx context.Context, since time.Time) ([]IncidentRecord, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT record FROM `+resultStoreTable+` WHERE completed_at >= $1 ORDER BY completed_at`,
+		since,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []IncidentRecord{}
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var record IncidentRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+func (s *postgresResultStore) Prune(
+	ctx context.Context, cutoff time.Time, held []string,
+) (int, error) {
+	// A nil array would be NULL, matching no records at all
+	result, err := s.db.ExecContext(
+		ctx,
+		`DELETE FROM `+resultStoreTable+` WHERE completed_at < $1 AND NOT (uuid = ANY($2))`,
+		cutoff, pq.StringArray(append([]string{}, held...)),
+	)
+	if err != nil {
+		return 0, err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if deleted > 0 {
+		logger.Info("Pruned expired incident records", zap.Int64("deleted", deleted))
+	}
+	return int(deleted), nil
+}
+
+func (s *postgresResultStore) Close() error {
+	return s.db.Close()
+}
+
+// objectResultStore keeps each incident record as a JSON object, under a date-partitioned key.
+type objectResultStore struct {
+	store  ObjectStore
+	prefix string
+}
+
+// Build the key of the record of an incident.
+func (s *objectResultStore) key(record IncidentRecord) string {
+	return path.Join(
+		s.prefix, "incidents", "dt="+record.CompletedAt.Format("2006-01-02"), record.UUID+".json",
+	)
+}
+
+func (s *objectResultStore) Save(ctx context.Context, record IncidentRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return s.store.Put(ctx, s.key(record), data, "application/json")
+}
+
+// Read the records under the date partitions since a point in time. The partitions are named
+// after the completion date of the records, so whole partitions can be skipped.
+func (s *objectResultStore) List(ctx context.Context, since time.Time) ([]IncidentRecord, error) {
+	objects, err := s.store.List(ctx, path.Join(s.prefix, "incidents")+"/")
+	if err != nil {
+		return nil, err
+	}
+	first := "dt=" + since.UTC().Format("2006-01-02")
+	records := []IncidentRecord{}
+	for _, object := range objects {
+		if path.Base(path.Dir(object.Key)) < first {
+			continue
+		}
+		data, err := s.store.Get(ctx, object.Key)
+		if err != nil {
+			return nil, err
+		}
+		var record IncidentRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return nil, fmt.Errorf("Invalid incident record '%s': %w", object.Key, err)
+		}
+		if !record.CompletedAt.Before(since) {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+func (s *objectResultStore) Prune(
+	ctx context.Context, cutoff time.Time, held []string,
+) (int, error) {
+	objects, err := s.store.List(ctx, path.Join(s.prefix, "incidents")+"/")
+	if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	for _, object := range objects {
+		uuid := strings.TrimSuffix(path.Base(object.Key), ".json")
+		if !object.LastModified.Before(cutoff) || slices.Contains(held, uuid) {
+			continue
+		}
+		if err := s.store.Delete(ctx, object.Key); err != nil {
+			return deleted, err
+		}
+		deleted++
+		logger.Info("Pruned expired incident record", zap.String("key", object.Key))
+	}
+	return deleted, nil
+}
+
+func (s *objectResultStore) Close() error {
+	return nil
+}
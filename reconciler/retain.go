@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Label marking the resources of an incident that are kept after its cleanup.
+const retainLabel = "euphrosyne.io/retain"
+
+// RetainedResource identifies a resource kept after the cleanup of an incident.
+type RetainedResource struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// Target the resource lives in, if it is not the recipe namespace of the local cluster
+	Namespace string `json:"namespace,omitempty"`
+	Cluster   string `json:"cluster,omitempty"`
+}
+
+// Build the label selector for the resources to clean up, leaving out the retained ones.
+func cleanupLabelSelector(labels map[string]string) string {
+	return metav1.FormatLabelSelector(&metav1.LabelSelector{
+		MatchLabels: labels,
+		MatchExpressions: []metav1.LabelSelectorRequirement{{
+			Key:      retainLabel,
+			Operator: metav1.LabelSelectorOpNotIn,
+			Values:   []string{"true"},
+		}},
+	})
+}
+
+// List the resources of the reconciler that are retained after its cleanup, in every target of
+// its recipes.
+func (r *Reconciler) listRetainedResources() ([]RetainedResource, error) {
+	retained := []RetainedResource{}
+	for _, target := range r.targets() {
+		ctx, cancel := r.requestContext()
+		resources, err := r.listTargetRetainedResources(ctx, target)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		retained = append(retained, resources...)
+	}
+	return retained, nil
+}
+
+// List the resources of the reconciler that are retained in a target.
+func (r *Reconciler) listTargetRetainedResources(
+	ctx context.Context, target RecipeTarget,
+) ([]RetainedResource, error) {
+	client, err := clientsetFor(target.Cluster)
+	if err != nil {
+		return nil, err
+	}
+	listOptions := metav1.ListOptions{
+		LabelSelector: metav1.FormatLabelSelector(&metav1.LabelSelector{
+			MatchLabels: map[string]string{"uuid": r.uuid, retainLabel: "true"},
+		}),
+	}
+	namespace := target.Namespace
+	// Resources in the default target are reported as before, without their target
+	resource := func(kind string, name string) RetainedResource {
+		if target == recipeTarget(nil, r.config) {
+			return RetainedResource{Kind: kind, Name: name}
+		}
+		return RetainedResource{
+			Kind: kind, Name: name, Namespace: target.Namespace, Cluster: target.Cluster,
+		}
+	}
+	var retained []RetainedResource
+
+	jobs, err := client.BatchV1().Jobs(namespace).List(ctx, listOptions)
+	if err != nil {
+		return nil, err
+	}
+	for _, job := range jobs.Items {
+		retained = append(retained, resource("Job", job.Name))
+	}
+
+	cms, err := client.CoreV1().ConfigMaps(namespace).List(ctx, listOptions)
+	if err != nil {
+		return nil, err
+	}
+	for _, cm := range cms.Items {
+		retained = append(retained, resource("ConfigMap", cm.Name))
+	}
+
+	pvcs, err := client.CoreV1().PersistentVolumeClaims(namespace).List(
+		ctx, listOptions,
+	)
+	if err != nil {
+		return nil, err
+	}
+	for _, pvc := range pvcs.Items {
+		retained = append(retained, resource("PersistentVolumeClaim", pvc.Name))
+	}
+	return retained, nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Test that the cleanup selector leaves out the resources labelled to be retained.
+func TestCleanupLabelSelector(t *testing.T) {
+	selector, err := labels.Parse(
+		cleanupLabelSelector(map[string]string{"app": "euphrosyne", "uuid": "incident-1"}),
+	)
+	assert.Nil(t, err)
+
+	testCases := []struct {
+		name    string
+		labels  map[string]string
+		matches bool
+	}{
+		{
+			name:    "Unlabelled",
+			labels:  map[string]string{"app": "euphrosyne", "uuid": "incident-1"},
+			matches: true,
+		},
+		{
+			name: "NotRetained",
+			labels: map[string]string{
+				"app": "euphrosyne", "uuid": "incident-1", retainLabel: "false",
+			},
+			matches: true,
+		},
+		{
+			name: "Retained",
+			labels: map[string]string{
+				"app": "euphrosyne", "uuid": "incident-1", retainLabel: "true",
+			},
+			matches: false,
+		},
+		{
+			name:    "OtherIncident",
+			labels:  map[string]string{"app": "euphrosyne", "uuid": "incident-2"},
+			matches: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.matches, selector.Matches(labels.Set(tc.labels)))
+		})
+	}
+}
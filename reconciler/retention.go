@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Kinds of data purged by the janitor.
+const (
+	HistoryRetentionKind   = "history"
+	ArtifactsRetentionKind = "artifacts"
+	AuditRetentionKind     = "audit"
+)
+
+// LegalHold exempts an incident, along with its records, from deletion by the retention policies.
+type LegalHold struct {
+	Reason   string    `json:"reason,omitempty"`
+	User     string    `json:"user,omitempty"`
+	PlacedAt time.Time `json:"placedAt"`
+}
+
+// Janitor periodically deletes the execution history, the incident records and the compliance
+// export once they are older than their retention, sparing the incidents under legal hold.
+type Janitor struct {
+	resultStore ResultStore
+	exporter    *Exporter
+	// Retention of each kind of data, zero to keep it forever
+	retentions map[string]time.Duration
+}
+
+// Janitor of the expired data, only set if any retention is enabled.
+var janitor *Janitor
+
+// Return the shortest of the enabled retention periods, or zero if none is enabled.
+func shortestRetention(retentions ...time.Duration) time.Duration {
+	var shortest time.Duration
+	for _, retention := range retentions {
+		if retention > 0 && (shortest == 0 || retention < shortest) {
+			shortest = retention
+		}
+	}
+	return shortest
+}
+
+// Initialise a janitor from the Reconciler configuration. The data retention caps the retention
+// of the result store and of the compliance export, if they keep their data for longer.
+func NewJanitor(config *Config, store ResultStore, exporter *Exporter) *Janitor {
+	retentions := map[string]time.Duration{HistoryRetentionKind: config.DataRetention}
+	if store != nil {
+		retentions[ArtifactsRetentionKind] = shortestRetention(
+			config.ResultStoreRetention, config.DataRetention,
+		)
+	}
+	if exporter != nil {
+		retentions[AuditRetentionKind] = shortestRetention(
+			config.ExportRetention, config.DataRetention,
+		)
+	}
+	return &Janitor{resultStore: store, exporter: exporter, retentions: retentions}
+}
+
+// Check whether any kind of data is subject to a retention policy.
+func (j *Janitor) Enabled() bool {
+	return shortestRetention(
+		j.retentions[HistoryRetentionKind],
+		j.retentions[ArtifactsRetentionKind],
+		j.retentions[AuditRetentionKind],
+	) > 0
+}
+
+// Purge the expired data on the provided interval, until the context is cancelled.
+func (j *Janitor) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := j.Purge(ctx, time.Now().UTC()); err != nil {
+				logger.Warn("Failed to purge expired data", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Delete the data older than its retention, except for the incidents under legal hold.
+func (j *Janitor) Purge(ctx context.Context, now time.Time) error {
+	held := incidentRegistry.HeldIncidents()
+	var errs []error
+	purge := func(kind string, prune func(cutoff time.Time) (int, error)) {
+		retention := j.retentions[kind]
+		if retention <= 0 {
+			return
+		}
+		purged, err := prune(now.Add(-retention))
+		retentionPurged.WithLabelValues(kind).Add(float64(purged))
+		if err != nil {
+			retentionFailures.WithLabelValues(kind).Inc()
+			errs = append(errs, fmt.Errorf("Failed to purge %s: %w", kind, err))
+		}
+		if purged > 0 {
+			logger.Info("Purged expired data", zap.String("kind", kind), zap.Int("purged", purged))
+		}
+	}
+
+	purge(HistoryRetentionKind, func(cutoff time.Time) (int, error) {
+		return incidentRegistry.Purge(cutoff)
+	})
+	purge(ArtifactsRetentionKind, func(cutoff time.Time) (int, error) {
+		return j.resultStore.Prune(ctx, cutoff, held)
+	})
+	purge(AuditRetentionKind, func(cutoff time.Time) (int, error) {
+		return j.exporter.prune(ctx, cutoff, held)
+	})
+	return errors.Join(errs...)
+}
+
+// Place an incident under legal hold, or release it if the hold is nil, returning the updated
+// incident.
+func (ir *IncidentRegistry) SetLegalHold(uuid string, hold *LegalHold) (*Incident, bool) {
+	ir.mutex.RLock()
+	_, ok := ir.incidents[uuid]
+	ir.mutex.RUnlock()
+	// Incidents that are only persisted are held in memory as well
+	if !ok {
+		ir.Restore(uuid)
+	}
+
+	var updated *Incident
+	ir.Update(uuid, func(incident *Incident) {
+		incident.LegalHold = hold
+		updated = copyIncident(incident)
+	})
+	return updated, updated != nil
+}
+
+// Return the UUIDs of the incidents under legal hold.
+func (ir *IncidentRegistry) HeldIncidents() []string {
+	var held []string
+	for _, incident := range ir.List() {
+		if incident.LegalHold != nil {
+			held = append(held, incident.UUID)
+		}
+	}
+	return held
+}
+
+// Delete the incidents completed before the cutoff that are not under legal hold, returning how
+// many were deleted.
+func (ir *IncidentRegistry) Purge(cutoff time.Time) (int, error) {
+	purged := 0
+	var errs []error
+	for _, incident := range ir.List() {
+		if incident.LegalHold != nil || incident.CompletedAt == nil ||
+			!incident.CompletedAt.Before(cutoff) {
+			continue
+		}
+		ir.mutex.Lock()
+		delete(ir.incidents, incident.UUID)
+		ir.mutex.Unlock()
+		if ir.persist {
+			err := rdb.Del(context.TODO(), incidentKeyPrefix+incident.UUID).Err()
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+		purged++
+	}
+	return purged, errors.Join(errs...)
+}
+
+// Handle request to place an incident under legal hold, exempting it from deletion.
+func handlePlaceLegalHoldRequest(c *gin.Context) {
+	var request struct {
+		User   string `json:"user"`
+		Reason string `json:"reason"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			logger.Error("Failed to parse JSON", zap.Error(err))
+			respondProblem(
+				c, http.StatusBadRequest, InvalidRequestProblem, "Invalid JSON for legal hold",
+			)
+			return
+		}
+	}
+
+	uuid := c.Param("uuid")
+	hold := &LegalHold{Reason: request.Reason, User: request.User, PlacedAt: time.Now().UTC()}
+	incident, ok := incidentRegistry.SetLegalHold(uuid, hold)
+	if !ok {
+		respondProblem(c, http.StatusNotFound, IncidentNotFoundProblem, "")
+		return
+	}
+	auditLog.Record(AuditLegalHoldPlaced, uuid, map[string]interface{}{
+		"user": request.User, "reason": request.Reason,
+	})
+	c.JSON(http.StatusOK, incident)
+}
+
+// Handle request to release the legal hold of an incident, subjecting it to the retention
+// policies again.
+func handleReleaseLegalHoldRequest(c *gin.Context) {
+	uuid := c.Param("uuid")
+	incident, ok := incidentRegistry.SetLegalHold(uuid, nil)
+	if !ok {
+		respondProblem(c, http.StatusNotFound, IncidentNotFoundProblem, "")
+		return
+	}
+	auditLog.Record(AuditLegalHoldReleased, uuid, nil)
+	c.JSON(http.StatusOK, incident)
+}
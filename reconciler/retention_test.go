@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that the data retention caps the retention of the result store and the compliance export.
+func TestNewJanitor(t *testing.T) {
+	day := 24 * time.Hour
+	store := &objectResultStore{}
+	exporter := &Exporter{}
+
+	tests := []struct {
+		name     string
+		config   Config
+		stores   bool
+		expected map[string]time.Duration
+		enabled  bool
+	}{
+		{
+			name:     "Disabled",
+			config:   Config{},
+			expected: map[string]time.Duration{HistoryRetentionKind: 0},
+		},
+		{
+			name:   "HistoryOnly",
+			config: Config{DataRetention: 90 * day},
+			expected: map[string]time.Duration{
+				HistoryRetentionKind: 90 * day,
+			},
+			enabled: true,
+		},
+		{
+			name:   "DataRetention",
+			config: Config{DataRetention: 90 * day},
+			stores: true,
+			expected: map[string]time.Duration{
+				HistoryRetentionKind:   90 * day,
+				ArtifactsRetentionKind: 90 * day,
+				AuditRetentionKind:     90 * day,
+			},
+			enabled: true,
+		},
+		{
+			name: "ShorterRetention",
+			config: Config{
+				DataRetention: 90 * day, ResultStoreRetention: 30 * day, ExportRetention: 365 * day,
+			},
+			stores: true,
+			expected: map[string]time.Duration{
+				HistoryRetentionKind:   90 * day,
+				ArtifactsRetentionKind: 30 * day,
+				AuditRetentionKind:     90 * day,
+			},
+			enabled: true,
+		},
+		{
+			name:   "StoreRetentionOnly",
+			config: Config{ResultStoreRetention: 30 * day},
+			stores: true,
+			expected: map[string]time.Duration{
+				HistoryRetentionKind:   0,
+				ArtifactsRetentionKind: 30 * day,
+				AuditRetentionKind:     0,
+			},
+			enabled: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			janitor := NewJanitor(&tt.config, nil, nil)
+			if tt.stores {
+				janitor = NewJanitor(&tt.config, store, exporter)
+			}
+			assert.Equal(t, tt.expected, janitor.retentions)
+			assert.Equal(t, tt.enabled, janitor.Enabled())
+		})
+	}
+}
+
+// Test that the janitor purges the expired execution history and incident records, sparing the
+// incidents under legal hold.
+func TestJanitorPurge(t *testing.T) {
+	registry := incidentRegistry
+	defer func() { incidentRegistry = registry }()
+	incidentRegistry = NewIncidentRegistry(MemoryIncidentStore, 365*24*time.Hour)
+
+	root := t.TempDir()
+	store, err := NewResultStore(context.Background(), "file://"+root, "")
+	assert.Nil(t, err)
+	janitor := NewJanitor(&Config{DataRetention: 30 * day}, store, nil)
+
+	now := time.Now().UTC()
+	expired := now.Add(-31 * 24 * time.Hour)
+	for _, uuid := range []string{"expired", "held", "recent", "running"} {
+		incidentRegistry.Register(uuid, Alert)
+		if uuid == "running" {
+			continue
+		}
+		completedAt := now
+		if uuid != "recent" {
+			completedAt = expired
+		}
+		incidentRegistry.Update(uuid, func(incident *Incident) {
+			incident.State = IncidentStateCompleted
+			incident.CompletedAt = &completedAt
+		})
+		record := IncidentRecord{UUID: uuid, RequestType: "alert", CompletedAt: completedAt}
+		assert.Nil(t, store.Save(context.Background(), record))
+		// Incident records are purged by when they were written
+		path := filepath.Join(
+			root, "incidents", "dt="+completedAt.Format("2006-01-02"), uuid+".json",
+		)
+		assert.Nil(t, os.Chtimes(path, completedAt, completedAt))
+	}
+	_, ok := incidentRegistry.SetLegalHold("held", &LegalHold{Reason: "Litigation"})
+	assert.True(t, ok)
+
+	assert.Nil(t, janitor.Purge(context.Background(), now))
+
+	var remaining []string
+	for _, incident := range incidentRegistry.List() {
+		remaining = append(remaining, incident.UUID)
+	}
+	assert.ElementsMatch(t, []string{"held", "recent", "running"}, remaining)
+
+	objects, err := store.(*objectResultStore).store.List(context.Background(), "")
+	assert.Nil(t, err)
+	var records []string
+	for _, object := range objects {
+		records = append(records, filepath.Base(object.Key))
+	}
+	assert.ElementsMatch(t, []string{"held.json", "recent.json"}, records)
+}
+
+// Test that incidents under legal hold are kept in memory past the retention of the registry.
+func TestIncidentRegistryLegalHold(t *testing.T) {
+	registry := NewIncidentRegistry(MemoryIncidentStore, time.Hour)
+	completedAt := time.Now().Add(-2 * time.Hour)
+	for _, uuid := range []string{"held", "released"} {
+		registry.Register(uuid, Alert)
+		registry.SetLegalHold(uuid, &LegalHold{Reason: "Audit"})
+		registry.Update(uuid, func(incident *Incident) { incident.CompletedAt = &completedAt })
+	}
+	incident, ok := registry.SetLegalHold("released", nil)
+	assert.True(t, ok)
+	assert.Nil(t, incident.LegalHold)
+	_, ok = registry.SetLegalHold("unknown", nil)
+	assert.False(t, ok)
+
+	registry.Register("new", Alert)
+	_, ok = registry.Get("held")
+	assert.True(t, ok)
+	_, ok = registry.Get("released")
+	assert.False(t, ok)
+	assert.Equal(t, []string{"held"}, registry.HeldIncidents())
+}
+
+// Test that incidents are placed under legal hold and released through the API.
+func TestLegalHoldRequest(t *testing.T) {
+	incidentRegistry.Register("legal-hold-incident", Alert)
+
+	router := gin.New()
+	router.PUT("/incidents/:uuid/hold", handlePlaceLegalHoldRequest)
+	router.DELETE("/incidents/:uuid/hold", handleReleaseLegalHoldRequest)
+
+	tests := []struct {
+		name   string
+		method string
+		uuid   string
+		body   string
+		status int
+		held   bool
+	}{
+		{
+			name:   "Place",
+			method: http.MethodPut,
+			uuid:   "legal-hold-incident",
+			body:   `{"user": "legal", "reason": "Litigation"}`,
+			status: http.StatusOK,
+			held:   true,
+		},
+		{
+			name:   "Release",
+			method: http.MethodDelete,
+			uuid:   "legal-hold-incident",
+			status: http.StatusOK,
+		},
+		{
+			name:   "InvalidJSON",
+			method: http.MethodPut,
+			uuid:   "legal-hold-incident",
+			body:   `{"reason":`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "NotFound",
+			method: http.MethodPut,
+			uuid:   "unknown-incident",
+			status: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(
+				tt.method, "/incidents/"+tt.uuid+"/hold", strings.NewReader(tt.body),
+			))
+			assert.Equal(t, tt.status, recorder.Code)
+			if tt.status != http.StatusOK {
+				return
+			}
+			var incident Incident
+			assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &incident))
+			assert.Equal(t, tt.held, incident.LegalHold != nil)
+			if tt.held {
+				assert.Equal(t, "Litigation", incident.LegalHold.Reason)
+				assert.Equal(t, "legal", incident.LegalHold.User)
+			}
+		})
+	}
+}
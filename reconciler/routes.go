@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+var (
+	routesConfigMapName = "euphrosyne-routes"
+)
+
+const (
+	// Field of the request data identifying the route an execution was requested through
+	routeField = "route"
+	// Key of the gin context holding the route a request was received on
+	routeContextKey = "route"
+)
+
+// Request types of the configured routes.
+const (
+	AlertRouteType   = "alert"
+	ActionsRouteType = "actions"
+)
+
+// Paths served by the webhook router itself, which routes cannot shadow.
+var reservedRoutePaths = []string{"/webhook", "/webhook/batch"}
+
+// RouteConfig defines an additional endpoint receiving requests of a given type, e.g. the alerts
+// of a new integration, without code changes.
+type RouteConfig struct {
+	Path string `json:"path"`
+	// Type of the requests, alerts by default
+	RequestType string `json:"requestType,omitempty"`
+	// Recipes the requests are restricted to, all enabled recipes if empty
+	Recipes []string `json:"recipes,omitempty"`
+	// Comma-separated authentication modes of the endpoint, none if empty
+	Auth string `json:"auth,omitempty"`
+}
+
+// Route is a configured endpoint, named after its key in the routes ConfigMap.
+type Route struct {
+	Name string `json:"name"`
+	RouteConfig
+}
+
+// RouteMatch identifies the route an execution was requested through, along with the recipes it
+// is restricted to.
+type RouteMatch struct {
+	Name    string   `json:"name"`
+	Recipes []string `json:"recipes,omitempty"`
+}
+
+// RequestRoutes serves the configured routes through a router that is rebuilt whenever they are
+// reloaded, so that routes are added, changed and removed without restarting the reconciler.
+type RequestRoutes struct {
+	mutex  sync.RWMutex
+	routes []Route
+	router *gin.Engine
+}
+
+var requestRoutes = &RequestRoutes{}
+
+// Parse and validate the routes defined in the routes ConfigMap, reporting every invalid route.
+func parseRoutes(data map[string]string, config *Config) ([]Route, error) {
+	names := make([]string, 0, len(data))
+	for name := range data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var routes []Route
+	var errs []error
+	paths := make(map[string]string)
+	for _, name := range names {
+		route := Route{Name: name}
+		err := yaml.UnmarshalStrict([]byte(data[name]), &route.RouteConfig)
+		if err == nil {
+			err = validateRoute(&route, config)
+		}
+		if err == nil && paths[route.Path] != "" {
+			err = fmt.Errorf(
+				"Path '%s' is already served by route '%s'", route.Path, paths[route.Path],
+			)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Invalid route '%s': %w", name, err))
+			continue
+		}
+		paths[route.Path] = name
+		routes = append(routes, route)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return routes, nil
+}
+
+// Check that a route defines a static path, a supported request type and valid authentication
+// modes, defaulting its request type to alerts.
+func validateRoute(route *Route, config *Config) error {
+	if !strings.HasPrefix(route.Path, "/") || strings.ContainsAny(route.Path, ":*?# ") {
+		return fmt.Errorf("Expected a static path starting with '/', got '%s'", route.Path)
+	}
+	if slices.Contains(reservedRoutePaths, route.Path) {
+		return fmt.Errorf("Path '%s' is reserved", route.Path)
+	}
+	switch route.RequestType {
+	case "":
+		route.RequestType = AlertRouteType
+	case AlertRouteType, ActionsRouteType:
+	default:
+		return fmt.Errorf("Unsupported request type '%s'", route.RequestType)
+	}
+	for _, recipeName := range route.Recipes {
+		if recipeName == "" {
+			return fmt.Errorf("Recipe names cannot be empty")
+		}
+	}
+	return validateAuthModes(route.Auth, config)
+}
+
+// Build the router serving the routes, each behind the same checks as the built-in endpoint for
+// its request type.
+func newRoutesRouter(routes []Route, config *Config) *gin.Engine {
+	router := gin.New()
+	router.NoRoute(func(c *gin.Context) {
+		respondProblem(
+			c, http.StatusNotFound, RouteNotFoundProblem,
+			fmt.Sprintf("No route for %s %s", c.Request.Method, c.Request.URL.Path),
+		)
+	})
+	for _, route := range routes {
+		route := route
+		handlers := []gin.HandlerFunc{
+			authenticate(config, "route:"+route.Name, route.Auth),
+			requireLeader(),
+			checkDraining(),
+		}
+		handle := handleActionsRequest
+		if route.RequestType == AlertRouteType {
+			handlers = append(handlers, checkIntake())
+			handle = handleWebhook
+		}
+		handlers = append(handlers, func(c *gin.Context) {
+			c.Set(routeContextKey, &route)
+			routeRequests.WithLabelValues(route.Name).Inc()
+			handle(c, config)
+		})
+		router.POST(route.Path, handlers...)
+	}
+	return router
+}
+
+// Load the routes from the routes ConfigMap in the Reconciler namespace. The ConfigMap is
+// optional; if it doesn't exist, no routes are served besides the built-in ones.
+func LoadRoutes(config *Config) error {
+	data := map[string]string{}
+	configMap, err := clientset.CoreV1().ConfigMaps(config.ReconcilerNamespace).Get(
+		context.TODO(), routesConfigMapName, metav1.GetOptions{},
+	)
+	if err == nil {
+		data = configMap.Data
+	} else if !k8serrors.IsNotFound(err) {
+		return err
+	}
+
+	routes, err := parseRoutes(data, config)
+	configStatus.Record(RoutesConfigSource, err)
+	if err != nil {
+		return err
+	}
+	requestRoutes.Set(routes, newRoutesRouter(routes, config))
+	logger.Info("Routes loaded", zap.Int("count", len(routes)))
+	return nil
+}
+
+// Replace the served routes.
+func (rr *RequestRoutes) Set(routes []Route, router *gin.Engine) {
+	rr.mutex.Lock()
+	defer rr.mutex.Unlock()
+	rr.routes = routes
+	rr.router = router
+}
+
+// Return the served routes.
+func (rr *RequestRoutes) List() []Route {
+	rr.mutex.RLock()
+	defer rr.mutex.RUnlock()
+	return append([]Route{}, rr.routes...)
+}
+
+// Serve a request that matched none of the built-in endpoints through the configured routes.
+func (rr *RequestRoutes) Handle(c *gin.Context) {
+	rr.mutex.RLock()
+	router := rr.router
+	rr.mutex.RUnlock()
+	if router == nil {
+		respondProblem(
+			c, http.StatusNotFound, RouteNotFoundProblem,
+			fmt.Sprintf("No route for %s %s", c.Request.Method, c.Request.URL.Path),
+		)
+		return
+	}
+	router.ServeHTTP(c.Writer, c.Request)
+}
+
+// Return the route a request was received on, if it was received on a configured route.
+func requestRoute(c *gin.Context) (*Route, bool) {
+	value, ok := c.Get(routeContextKey)
+	if !ok {
+		return nil, false
+	}
+	route, ok := value.(*Route)
+	return route, ok
+}
+
+// Return the authentication modes of the endpoint a request was received on.
+func requestAuthModes(c *gin.Context, defaultModes string) string {
+	if route, ok := requestRoute(c); ok {
+		return route.Auth
+	}
+	return defaultModes
+}
+
+// Identify the route of a request along with its recipe filter.
+func (r *Route) Match() RouteMatch {
+	return RouteMatch{Name: r.Name, Recipes: r.Recipes}
+}
+
+// Check that the actions requested on a route are among the recipes it is restricted to.
+func checkRouteActions(c *gin.Context, data map[string]interface{}) bool {
+	// The route is set by the Reconciler alone, never by the caller
+	delete(data, routeField)
+	route, ok := requestRoute(c)
+	if !ok {
+		return true
+	}
+	data[routeField] = route.Match()
+	if len(route.Recipes) == 0 {
+		return true
+	}
+	// The actions are validated along with the request
+	actions, _ := parseActionData(&data)
+	for _, action := range actions {
+		if !slices.Contains(route.Recipes, action.Name) {
+			respondProblem(
+				c, http.StatusNotFound, RecipeNotFoundProblem,
+				fmt.Sprintf(
+					"Action recipe '%s' is not available on route '%s'", action.Name, route.Name,
+				),
+			)
+			return false
+		}
+	}
+	return true
+}
+
+// Extract the route an execution was requested through, if any.
+func parseRouteMatch(data map[string]interface{}) (*RouteMatch, bool) {
+	value, ok := data[routeField]
+	if !ok {
+		return nil, false
+	}
+	if match, ok := value.(RouteMatch); ok {
+		return &match, true
+	}
+
+	// Executions restored from Redis hold the route as a generic JSON object
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, false
+	}
+	var match RouteMatch
+	if err := json.Unmarshal(encoded, &match); err != nil || match.Name == "" {
+		return nil, false
+	}
+	return &match, true
+}
+
+// Restrict the recipes of an execution to the ones of the route it was requested through, if the
+// route restricts them.
+func routeRecipes(recipes map[string]Recipe, data map[string]interface{}) map[string]Recipe {
+	match, ok := parseRouteMatch(data)
+	if !ok || len(match.Recipes) == 0 {
+		return recipes
+	}
+	restricted := make(map[string]Recipe, len(match.Recipes))
+	for recipeName, recipe := range recipes {
+		if slices.Contains(match.Recipes, recipeName) {
+			restricted[recipeName] = recipe
+		}
+	}
+	return restricted
+}
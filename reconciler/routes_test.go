@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that routes are parsed from the routes ConfigMap and that invalid routes are rejected.
+func TestParseRoutes(t *testing.T) {
+	config := &Config{AuthToken: "s3cr3t"}
+
+	tests := []struct {
+		name     string
+		data     map[string]string
+		expected []Route
+		err      string
+	}{
+		{name: "Empty", data: map[string]string{}},
+		{
+			name: "Valid",
+			data: map[string]string{
+				"storage":     "path: /integrations/storage\nrecipes: [disk-usage]\nauth: token",
+				"remediation": "path: /integrations/remediation\nrequestType: actions",
+			},
+			expected: []Route{
+				{
+					Name: "remediation",
+					RouteConfig: RouteConfig{
+						Path: "/integrations/remediation", RequestType: ActionsRouteType,
+					},
+				},
+				{
+					Name: "storage",
+					RouteConfig: RouteConfig{
+						Path:        "/integrations/storage",
+						RequestType: AlertRouteType,
+						Recipes:     []string{"disk-usage"},
+						Auth:        "token",
+					},
+				},
+			},
+		},
+		{
+			name: "UnknownField",
+			data: map[string]string{"storage": "path: /storage\nrecipe: disk-usage"},
+			err:  "Invalid route 'storage'",
+		},
+		{
+			name: "RelativePath",
+			data: map[string]string{"storage": "path: storage"},
+			err:  "Expected a static path",
+		},
+		{
+			name: "WildcardPath",
+			data: map[string]string{"storage": "path: /storage/*name"},
+			err:  "Expected a static path",
+		},
+		{
+			name: "ReservedPath",
+			data: map[string]string{"storage": "path: /webhook"},
+			err:  "Path '/webhook' is reserved",
+		},
+		{
+			name: "DuplicatePath",
+			data: map[string]string{"a": "path: /storage", "b": "path: /storage"},
+			err:  "Path '/storage' is already served by route 'a'",
+		},
+		{
+			name: "UnsupportedRequestType",
+			data: map[string]string{"storage": "path: /storage\nrequestType: status"},
+			err:  "Unsupported request type 'status'",
+		},
+		{
+			name: "UnavailableAuthMode",
+			data: map[string]string{"storage": "path: /storage\nauth: hmac"},
+			err:  "Invalid route 'storage'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routes, err := parseRoutes(tt.data, config)
+			if tt.err != "" {
+				assert.ErrorContains(t, err, tt.err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expected, routes)
+		})
+	}
+}
+
+// Test that requests on unknown paths or failing the authentication of a route are rejected.
+func TestRoutesRouter(t *testing.T) {
+	config := &Config{AuthToken: "s3cr3t"}
+	routes := []Route{
+		{
+			Name: "storage",
+			RouteConfig: RouteConfig{
+				Path: "/integrations/storage", RequestType: AlertRouteType, Auth: "token",
+			},
+		},
+	}
+
+	previous := requestRoutes
+	defer func() { requestRoutes = previous }()
+	requestRoutes = &RequestRoutes{}
+
+	router := gin.New()
+	router.NoRoute(requestRoutes.Handle)
+
+	tests := []struct {
+		name     string
+		path     string
+		expected int
+		problem  string
+	}{
+		{
+			name:     "UnknownPath",
+			path:     "/integrations/network",
+			expected: http.StatusNotFound,
+			problem:  RouteNotFoundProblem,
+		},
+		{name: "MissingToken", path: "/integrations/storage", expected: http.StatusUnauthorized},
+	}
+
+	// No routes are served until they are loaded
+	req := httptest.NewRequest(http.MethodPost, "/integrations/storage", strings.NewReader("{}"))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	requestRoutes.Set(routes, newRoutesRouter(routes, config))
+	assert.Equal(t, routes, requestRoutes.List())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader("{}"))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.expected, w.Code)
+			if tt.problem != "" {
+				var problem map[string]interface{}
+				assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &problem))
+				assert.Equal(t, tt.problem, problem["code"])
+			}
+		})
+	}
+}
+
+// Test that the actions requested on a route are restricted to its recipes.
+func TestCheckRouteActions(t *testing.T) {
+	route := &Route{
+		Name:        "remediation",
+		RouteConfig: RouteConfig{RequestType: ActionsRouteType, Recipes: []string{"restart-pod"}},
+	}
+	action := func(name string) map[string]interface{} {
+		return map[string]interface{}{"actions": []interface{}{
+			map[string]interface{}{"name": name, "data": map[string]interface{}{}},
+		}}
+	}
+
+	tests := []struct {
+		name     string
+		route    *Route
+		data     map[string]interface{}
+		allowed  bool
+		expected int
+	}{
+		{name: "NoRoute", data: action("drain-node"), allowed: true, expected: http.StatusOK},
+		{
+			name: "ForgedRoute",
+			data: map[string]interface{}{
+				"actions":  action("drain-node")["actions"],
+				routeField: map[string]interface{}{"name": "remediation"},
+			},
+			allowed:  true,
+			expected: http.StatusOK,
+		},
+		{
+			name:     "AllowedAction",
+			route:    route,
+			data:     action("restart-pod"),
+			allowed:  true,
+			expected: http.StatusOK,
+		},
+		{
+			name:     "RestrictedAction",
+			route:    route,
+			data:     action("drain-node"),
+			expected: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			if tt.route != nil {
+				c.Set(routeContextKey, tt.route)
+			}
+			assert.Equal(t, tt.allowed, checkRouteActions(c, tt.data))
+			assert.Equal(t, tt.expected, w.Code)
+			if tt.route != nil {
+				assert.Equal(t, tt.route.Match(), tt.data[routeField])
+			} else {
+				assert.NotContains(t, tt.data, routeField)
+			}
+		})
+	}
+}
+
+// Test that the recipes of an execution are restricted to the ones of its route.
+func TestRouteRecipes(t *testing.T) {
+	recipes := map[string]Recipe{"disk-usage": {}, "pvc-status": {}, "pod-logs": {}}
+
+	tests := []struct {
+		name     string
+		data     map[string]interface{}
+		expected []string
+	}{
+		{
+			name:     "NoRoute",
+			data:     map[string]interface{}{},
+			expected: []string{"disk-usage", "pod-logs", "pvc-status"},
+		},
+		{
+			name:     "UnrestrictedRoute",
+			data:     map[string]interface{}{routeField: RouteMatch{Name: "storage"}},
+			expected: []string{"disk-usage", "pod-logs", "pvc-status"},
+		},
+		{
+			name: "RestrictedRoute",
+			data: map[string]interface{}{
+				routeField: RouteMatch{
+					Name: "storage", Recipes: []string{"disk-usage", "pvc-status"},
+				},
+			},
+			expected: []string{"disk-usage", "pvc-status"},
+		},
+		{
+			// Executions restored from Redis hold the route as a generic JSON object
+			name: "RestoredRoute",
+			data: map[string]interface{}{
+				routeField: map[string]interface{}{
+					"name": "storage", "recipes": []interface{}{"pod-logs"},
+				},
+			},
+			expected: []string{"pod-logs"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var names []string
+			for recipeName := range routeRecipes(recipes, tt.data) {
+				names = append(names, recipeName)
+			}
+			assert.ElementsMatch(t, tt.expected, names)
+		})
+	}
+}
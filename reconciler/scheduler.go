@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// Interval for checking whether scheduled recipes are due
+	scheduleCheckInterval = 15 * time.Second
+	// Name of the alerts synthesised for scheduled runs
+	scheduledRunAlertname = "ScheduledRecipeRun"
+	// Field of the alert data identifying the scheduled run of an execution
+	scheduledRunField = "scheduledRun"
+)
+
+// ScheduledRun identifies the run of a scheduled recipe an execution was triggered for.
+type ScheduledRun struct {
+	Recipe      string    `json:"recipe"`
+	Schedule    string    `json:"schedule"`
+	ScheduledAt time.Time `json:"scheduledAt"`
+}
+
+// Scheduler triggers the debugging recipes declaring a schedule, e.g. nightly capacity checks,
+// running them through the same pipeline as alerts.
+type Scheduler struct {
+	config *Config
+	// Next run of each scheduled recipe
+	next map[string]plannedRun
+}
+
+// plannedRun is the next run of a scheduled recipe, along with the schedule it was planned from.
+type plannedRun struct {
+	schedule string
+	at       time.Time
+}
+
+// Initialise a scheduler, planning the runs of the recipes once it starts.
+func NewScheduler(config *Config) *Scheduler {
+	return &Scheduler{config: config, next: make(map[string]plannedRun)}
+}
+
+// Check whether a scheduled recipe is due periodically, until the context is cancelled.
+func (s *Scheduler) Run(ctx context.Context, interval time.Duration) {
+	s.Tick(ctx, time.Now())
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.Tick(ctx, now)
+		}
+	}
+}
+
+// Trigger the scheduled recipes that are due.
+func (s *Scheduler) Tick(ctx context.Context, now time.Time) {
+	rc, err := getRecipeCatalog(s.config.ReconcilerNamespace)
+	if err != nil {
+		logger.Error("Failed to retrieve scheduled recipes from catalog", zap.Error(err))
+		return
+	}
+
+	for _, run := range s.due(rc, now) {
+		alertData, err := toMap(scheduledRunAlertData(run))
+		if err != nil {
+			logger.Error("Failed to build alert data", zap.Error(err))
+			continue
+		}
+		alertData["uuid"] = newExecutionID(ctx)
+		alertData[scheduledRunField] = run
+		logger.Info("Alert triggered by schedule", zap.Any("alert", alertData))
+		scheduledRuns.WithLabelValues(run.Recipe).Inc()
+
+		if err := submitRaisedAlert(ctx, alertData, s.config); err != nil {
+			logger.Warn("Dropping alert triggered by schedule", zap.Error(err))
+			scheduledRunFailures.WithLabelValues(run.Recipe).Inc()
+		}
+	}
+}
+
+// Return the runs of the scheduled recipes that are due, planning their next runs. Recipes whose
+// schedule was added or changed are planned from now on, so that runs missed while no replica was
+// leading are skipped rather than caught up on.
+func (s *Scheduler) due(rc *RecipeCatalog, now time.Time) []ScheduledRun {
+	schedules := rc.Schedules()
+	for recipeName := range s.next {
+		if _, ok := schedules[recipeName]; !ok {
+			delete(s.next, recipeName)
+		}
+	}
+	recipeNames := make([]string, 0, len(schedules))
+	for recipeName := range schedules {
+		recipeNames = append(recipeNames, recipeName)
+	}
+	sort.Strings(recipeNames)
+
+	var runs []ScheduledRun
+	for _, recipeName := range recipeNames {
+		spec := schedules[recipeName]
+		// Schedules are validated along with the catalog
+		schedule, err := ParseCronSchedule(spec)
+		if err != nil {
+			continue
+		}
+		planned, ok := s.next[recipeName]
+		if ok && planned.schedule == spec {
+			if planned.at.After(now) {
+				continue
+			}
+			runs = append(runs, ScheduledRun{
+				Recipe: recipeName, Schedule: spec, ScheduledAt: planned.at,
+			})
+		}
+		s.next[recipeName] = plannedRun{schedule: spec, at: schedule.Next(now)}
+	}
+	return runs
+}
+
+// Return the schedules of the debugging recipes, by recipe.
+func (rc *RecipeCatalog) Schedules() map[string]string {
+	schedules := make(map[string]string)
+	for recipeName, recipeConfig := range rc.Debugging {
+		if recipeConfig.Schedule != "" {
+			schedules[recipeName] = recipeConfig.Schedule
+		}
+	}
+	return schedules
+}
+
+// Check that the schedules of the debugging recipes are valid cron expressions. Action recipes
+// only run once their actions are requested, so they cannot be scheduled.
+func validateRecipeSchedules(rc *RecipeCatalog) error {
+	for recipeName, recipeConfig := range rc.Debugging {
+		if recipeConfig.Schedule == "" {
+			continue
+		}
+		if _, err := ParseCronSchedule(recipeConfig.Schedule); err != nil {
+			return fmt.Errorf("Recipe '%s': %w", recipeName, err)
+		}
+	}
+	for recipeName, recipeConfig := range rc.Actions {
+		if recipeConfig.Schedule != "" {
+			return fmt.Errorf("Action recipe '%s' cannot be scheduled", recipeName)
+		}
+	}
+	return nil
+}
+
+// Build the alert synthesised for a scheduled run, in the Alertmanager format. Runs of the same
+// recipe share a fingerprint, so that a run is skipped while the previous one is still active.
+func scheduledRunAlertData(run ScheduledRun) AlertmanagerPayload {
+	labels := map[string]string{
+		"alertname": scheduledRunAlertname,
+		"recipe":    run.Recipe,
+	}
+	annotations := map[string]string{
+		"summary": fmt.Sprintf("Scheduled run of recipe '%s' (%s)", run.Recipe, run.Schedule),
+	}
+	alert := AlertmanagerAlert{
+		Status:      "firing",
+		Labels:      labels,
+		Annotations: annotations,
+		StartsAt:    run.ScheduledAt,
+		Fingerprint: seriesKey(scheduledRunAlertname, labels),
+	}
+	return AlertmanagerPayload{
+		Version:           "4",
+		Status:            "firing",
+		Receiver:          "euphrosyne-scheduler",
+		GroupLabels:       map[string]string{"alertname": scheduledRunAlertname},
+		CommonLabels:      labels,
+		CommonAnnotations: annotations,
+		Alerts:            []AlertmanagerAlert{alert},
+	}
+}
+
+// Extract the scheduled run an execution was triggered for, if any.
+func parseScheduledRun(data map[string]interface{}) (*ScheduledRun, bool) {
+	value, ok := data[scheduledRunField]
+	if !ok {
+		return nil, false
+	}
+	if run, ok := value.(ScheduledRun); ok {
+		return &run, true
+	}
+
+	// Executions restored from Redis hold the scheduled run as a generic JSON object
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, false
+	}
+	var run ScheduledRun
+	if err := json.Unmarshal(encoded, &run); err != nil || run.Recipe == "" {
+		return nil, false
+	}
+	return &run, true
+}
+
+// Restrict the debugging recipes of a scheduled run to the scheduled recipe. Recipes scheduled by
+// the scheduler run even if they are disabled, i.e. not run for alerts, while runs that were not
+// set by the scheduler may only select among the enabled recipes.
+func scheduledRecipes(
+	rc *RecipeCatalog, recipes map[string]Recipe, data map[string]interface{},
+) map[string]Recipe {
+	run, ok := parseScheduledRun(data)
+	if !ok {
+		return recipes
+	}
+	candidates := recipes
+	if _, scheduled := data[scheduledRunField].(ScheduledRun); scheduled {
+		candidates = rc.Recipes(Alert, false)
+	}
+	restricted := make(map[string]Recipe, 1)
+	if recipe, ok := candidates[run.Recipe]; ok {
+		restricted[run.Recipe] = recipe
+	}
+	return restricted
+}
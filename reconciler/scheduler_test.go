@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that scheduled recipes are planned from now on, run once due, and replanned when their
+// schedule changes.
+func TestSchedulerDue(t *testing.T) {
+	rc := &RecipeCatalog{Debugging: map[string]RecipeConfig{
+		"capacity": {Schedule: "0 2 * * *"},
+		"logs":     {Enabled: true},
+	}}
+	s := NewScheduler(&Config{})
+	start := time.Date(2024, 5, 15, 1, 59, 50, 0, time.UTC)
+
+	// Runs that were due before the scheduler started are skipped
+	assert.Empty(t, s.due(rc, start))
+	assert.Empty(t, s.due(rc, start.Add(5*time.Second)))
+
+	runs := s.due(rc, start.Add(15*time.Second))
+	assert.Equal(t, []ScheduledRun{{
+		Recipe:      "capacity",
+		Schedule:    "0 2 * * *",
+		ScheduledAt: time.Date(2024, 5, 15, 2, 0, 0, 0, time.UTC),
+	}}, runs)
+	assert.Empty(t, s.due(rc, start.Add(30*time.Second)))
+	assert.Equal(t, time.Date(2024, 5, 16, 2, 0, 0, 0, time.UTC), s.next["capacity"].at)
+
+	rc.Debugging["capacity"] = RecipeConfig{Schedule: "@hourly"}
+	assert.Empty(t, s.due(rc, start.Add(time.Minute)))
+	assert.Equal(t, time.Date(2024, 5, 15, 3, 0, 0, 0, time.UTC), s.next["capacity"].at)
+
+	delete(rc.Debugging, "capacity")
+	assert.Empty(t, s.due(rc, start.Add(2*time.Hour)))
+	assert.Empty(t, s.next)
+}
+
+// Test that scheduled runs only run the scheduled recipe, even if it is disabled, unless they were
+// not set by the scheduler.
+func TestScheduledRecipes(t *testing.T) {
+	rc := &RecipeCatalog{Debugging: map[string]RecipeConfig{
+		"capacity": {Schedule: "0 2 * * *"},
+		"logs":     {Enabled: true},
+	}}
+	recipes := rc.Recipes(Alert, true)
+
+	assert.Equal(t, recipes, scheduledRecipes(rc, recipes, map[string]interface{}{}))
+
+	alertData, err := toMap(scheduledRunAlertData(ScheduledRun{Recipe: "capacity"}))
+	assert.Nil(t, err)
+	assert.Equal(t, scheduledRunAlertname, alertLabels(alertData)["alertname"])
+
+	alertData[scheduledRunField] = ScheduledRun{Recipe: "capacity"}
+	restricted := scheduledRecipes(rc, recipes, alertData)
+	assert.Len(t, restricted, 1)
+	assert.Contains(t, restricted, "capacity")
+
+	// Runs decoded from JSON rather than set by the scheduler cannot select disabled recipes
+	alertData[scheduledRunField] = map[string]interface{}{"recipe": "capacity"}
+	assert.Empty(t, scheduledRecipes(rc, recipes, alertData))
+	alertData[scheduledRunField] = map[string]interface{}{"recipe": "logs"}
+	restricted = scheduledRecipes(rc, recipes, alertData)
+	assert.Len(t, restricted, 1)
+	assert.Contains(t, restricted, "logs")
+}
+
+// Test that only debugging recipes can be scheduled, with valid schedules.
+func TestValidateRecipeSchedules(t *testing.T) {
+	assert.Nil(t, validateRecipeSchedules(&RecipeCatalog{Debugging: map[string]RecipeConfig{
+		"capacity": {Schedule: "@daily"},
+	}}))
+	assert.ErrorContains(t, validateRecipeSchedules(&RecipeCatalog{
+		Debugging: map[string]RecipeConfig{"capacity": {Schedule: "daily"}},
+	}), "Recipe 'capacity': Invalid schedule 'daily', expected 5 fields")
+	assert.ErrorContains(t, validateRecipeSchedules(&RecipeCatalog{
+		Actions: map[string]RecipeConfig{"restart": {Schedule: "@daily"}},
+	}), "Action recipe 'restart' cannot be scheduled")
+}
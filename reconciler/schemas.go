@@ -0,0 +1,391 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"text/template/parse"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	// Source of the alerts received on the default webhook, rather than through a route
+	webhookAlertSource = "webhook"
+	// Frequency above which a field is considered part of the typical schema of a source
+	typicalFieldFrequency = 0.9
+	// Weight of each alert in the frequencies of the fields once the profile is learned, so that
+	// they follow roughly the last 50 alerts
+	schemaDecay = 0.02
+	// Frequency below which rare fields are forgotten
+	minFieldFrequency = 0.01
+	// Bounds of the fields tracked for each source
+	maxSchemaDepth  = 6
+	maxSchemaFields = 500
+)
+
+// Fields added to the alerts by the reconciler, which are not part of their schema.
+var internalAlertFields = []string{"uuid", routeField, inlineRecipeField, overridesField}
+
+// SchemaField is a field of the alerts of a source, along with how often it is present.
+type SchemaField struct {
+	Path      string  `json:"path"`
+	Frequency float64 `json:"frequency"`
+}
+
+// SchemaDrift is a typical field of a source that is missing from its latest alerts.
+type SchemaDrift struct {
+	Field string `json:"field"`
+	// Recipes whose parameters depend on the field, which fail while it is missing
+	Recipes []string  `json:"recipes,omitempty"`
+	Since   time.Time `json:"since"`
+	// Number of consecutive alerts missing the field
+	Missing int `json:"missing"`
+}
+
+// SchemaProfile is the typical structure of the alerts of a source, as learned from its alerts.
+type SchemaProfile struct {
+	Source   string    `json:"source"`
+	Samples  int       `json:"samples"`
+	Learning bool      `json:"learning"`
+	LastSeen time.Time `json:"lastSeen"`
+	// Fields of the typical schema of the source
+	Fields []SchemaField  `json:"fields"`
+	Drifts []*SchemaDrift `json:"drifts"`
+}
+
+// schemaProfile tracks the frequency of the fields of the alerts of a source.
+type schemaProfile struct {
+	samples     int
+	lastSeen    time.Time
+	frequencies map[string]float64
+	drifts      map[string]*SchemaDrift
+}
+
+// AlertSchemas learns the typical structure of the alerts of each source, i.e. of each route and
+// of the default webhook, and detects when a sender drops typical fields, before the recipes
+// depending on them fail.
+type AlertSchemas struct {
+	mutex sync.Mutex
+	// Number of alerts of a source learned before drift is detected
+	minSamples int
+	profiles   map[string]*schemaProfile
+}
+
+// Schemas of the received alerts, nil unless drift detection is enabled.
+var alertSchemas *AlertSchemas
+
+// Initialise the schemas of the alert sources, detecting drift once a source sent enough alerts.
+func NewAlertSchemas(minSamples int) *AlertSchemas {
+	return &AlertSchemas{minSamples: minSamples, profiles: make(map[string]*schemaProfile)}
+}
+
+// Return the source of an alert, i.e. the route it was received through, if any.
+func alertSource(data map[string]interface{}) string {
+	if route, ok := data[routeField].(RouteMatch); ok {
+		return route.Name
+	}
+	return webhookAlertSource
+}
+
+// Collect the paths of the fields of an alert, e.g. `commonLabels.namespace`, with the elements
+// of arrays merged as `alerts[].labels.pod`.
+func alertFields(data map[string]interface{}) map[string]bool {
+	fields := make(map[string]bool)
+	var walk func(path string, value interface{}, depth int)
+	walk = func(path string, value interface{}, depth int) {
+		fields[path] = true
+		if depth >= maxSchemaDepth {
+			return
+		}
+		switch value := value.(type) {
+		case map[string]interface{}:
+			for key, child := range value {
+				walk(path+"."+key, child, depth+1)
+			}
+		case []interface{}:
+			for _, child := range value {
+				walk(path+"[]", child, depth+1)
+			}
+		}
+	}
+	for key, value := range data {
+		if !slices.Contains(internalAlertFields, key) {
+			walk(key, value, 1)
+		}
+	}
+	return fields
+}
+
+// Check whether two fields are related, i.e. whether one is missing if the other is.
+func relatedFields(a string, b string) bool {
+	if len(a) < len(b) {
+		a, b = b, a
+	}
+	return a == b || strings.HasPrefix(a, b+".") || strings.HasPrefix(a, b+"[]")
+}
+
+// Collect the fields of the alerts referenced by the parameters of the recipes as `.alert`, along
+// with the recipes referencing them.
+func recipeFieldDependencies(recipes map[string]Recipe) map[string][]string {
+	dependencies := make(map[string][]string)
+	for recipeName, recipe := range recipes {
+		if recipe.Config == nil {
+			continue
+		}
+		for name, text := range recipe.Config.Params {
+			tmpl, err := parseRecipeParam(name, text)
+			if err != nil {
+				continue
+			}
+			for _, field := range templateAlertFields(tmpl.Tree.Root) {
+				if !slices.Contains(dependencies[field], recipeName) {
+					dependencies[field] = append(dependencies[field], recipeName)
+				}
+			}
+		}
+	}
+	for _, recipes := range dependencies {
+		sort.Strings(recipes)
+	}
+	return dependencies
+}
+
+// Collect the fields of the alert referenced by a template, e.g. `commonLabels.namespace` for
+// `{{ .alert.commonLabels.namespace }}`.
+func templateAlertFields(node parse.Node) []string {
+	var fields []string
+	switch node := node.(type) {
+	case *parse.FieldNode:
+		if len(node.Ident) > 1 && node.Ident[0] == "alert" {
+			fields = append(fields, strings.Join(node.Ident[1:], "."))
+		}
+	case *parse.ListNode:
+		if node != nil {
+			for _, child := range node.Nodes {
+				fields = append(fields, templateAlertFields(child)...)
+			}
+		}
+	case *parse.ActionNode:
+		fields = templateAlertFields(node.Pipe)
+	case *parse.PipeNode:
+		if node != nil {
+			for _, cmd := range node.Cmds {
+				fields = append(fields, templateAlertFields(cmd)...)
+			}
+		}
+	case *parse.CommandNode:
+		for _, arg := range node.Args {
+			fields = append(fields, templateAlertFields(arg)...)
+		}
+	case *parse.IfNode:
+		fields = templateAlertFields(&node.BranchNode)
+	case *parse.RangeNode:
+		fields = templateAlertFields(&node.BranchNode)
+	case *parse.WithNode:
+		fields = templateAlertFields(&node.BranchNode)
+	case *parse.BranchNode:
+		fields = append(fields, templateAlertFields(node.Pipe)...)
+		fields = append(fields, templateAlertFields(node.List)...)
+		fields = append(fields, templateAlertFields(node.ElseList)...)
+	}
+	return fields
+}
+
+// Learn the fields of an alert of a source, recording the typical fields it is missing as drift.
+// The dependencies of the recipes are only looked up once a field goes missing.
+func (as *AlertSchemas) Observe(
+	source string, data map[string]interface{}, dependencies func() map[string][]string,
+	now time.Time,
+) {
+	fields := alertFields(data)
+
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+	profile, ok := as.profiles[source]
+	if !ok {
+		profile = &schemaProfile{
+			frequencies: make(map[string]float64),
+			drifts:      make(map[string]*SchemaDrift),
+		}
+		as.profiles[source] = profile
+	}
+
+	// Drift is only detected once the typical schema of the source is learned
+	var missing []string
+	if profile.samples >= as.minSamples {
+		for field, frequency := range profile.frequencies {
+			_, drifting := profile.drifts[field]
+			if !fields[field] && (frequency >= typicalFieldFrequency || drifting) {
+				missing = append(missing, field)
+			}
+		}
+	}
+	for field, drift := range profile.drifts {
+		if fields[field] {
+			logger.Info(
+				"Alert schema drift resolved",
+				zap.String("source", source),
+				zap.String("field", field),
+				zap.Int("missing", drift.Missing),
+			)
+			delete(profile.drifts, field)
+		}
+	}
+	if len(missing) > 0 {
+		as.recordDrift(source, profile, missing, dependencies, now)
+	}
+
+	// Fields are averaged over every alert at first, and then over the latest ones
+	profile.samples++
+	profile.lastSeen = now
+	weight := max(1/float64(profile.samples), schemaDecay)
+	for field, frequency := range profile.frequencies {
+		frequency -= weight * frequency
+		if fields[field] {
+			frequency += weight
+		}
+		profile.frequencies[field] = frequency
+		if frequency < minFieldFrequency && profile.drifts[field] == nil {
+			delete(profile.frequencies, field)
+		}
+	}
+	for field := range fields {
+		if _, ok := profile.frequencies[field]; !ok && len(profile.frequencies) < maxSchemaFields {
+			profile.frequencies[field] = weight
+		}
+	}
+	as.updateMetrics(source, profile)
+}
+
+// Record the typical fields missing from an alert of a source as drift.
+func (as *AlertSchemas) recordDrift(
+	source string, profile *schemaProfile, missing []string,
+	dependencies func() map[string][]string, now time.Time,
+) {
+	deps := dependencies()
+	for _, field := range missing {
+		drift, ok := profile.drifts[field]
+		if !ok {
+			drift = &SchemaDrift{Field: field, Since: now}
+			for dependency, recipes := range deps {
+				if relatedFields(field, dependency) {
+					drift.Recipes = append(drift.Recipes, recipes...)
+				}
+			}
+			slices.Sort(drift.Recipes)
+			drift.Recipes = slices.Compact(drift.Recipes)
+			profile.drifts[field] = drift
+			logger.Warn(
+				"Alert schema drift detected",
+				zap.String("source", source),
+				zap.String("field", field),
+				zap.Strings("recipes", drift.Recipes),
+			)
+		}
+		drift.Missing++
+	}
+	alertsSchemaDrifted.WithLabelValues(source).Inc()
+}
+
+// Report the number of drifted fields of a source, by whether recipes depend on them.
+func (as *AlertSchemas) updateMetrics(source string, profile *schemaProfile) {
+	breaking := 0
+	for _, drift := range profile.drifts {
+		if len(drift.Recipes) > 0 {
+			breaking++
+		}
+	}
+	alertSchemaDrifts.WithLabelValues(source, "true").Set(float64(breaking))
+	alertSchemaDrifts.WithLabelValues(source, "false").Set(float64(len(profile.drifts) - breaking))
+}
+
+// Return the learned schema of every source, along with its drift, sorted by source.
+func (as *AlertSchemas) Profiles() []SchemaProfile {
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+	profiles := make([]SchemaProfile, 0, len(as.profiles))
+	for source, profile := range as.profiles {
+		report := SchemaProfile{
+			Source:   source,
+			Samples:  profile.samples,
+			Learning: profile.samples < as.minSamples,
+			LastSeen: profile.lastSeen,
+			Fields:   []SchemaField{},
+			Drifts:   []*SchemaDrift{},
+		}
+		for field, frequency := range profile.frequencies {
+			if frequency >= typicalFieldFrequency {
+				field := SchemaField{Path: field, Frequency: frequency}
+				report.Fields = append(report.Fields, field)
+			}
+		}
+		sort.Slice(report.Fields, func(i, j int) bool {
+			return report.Fields[i].Path < report.Fields[j].Path
+		})
+		for _, drift := range profile.drifts {
+			copied := *drift
+			report.Drifts = append(report.Drifts, &copied)
+		}
+		sort.Slice(report.Drifts, func(i, j int) bool {
+			return report.Drifts[i].Field < report.Drifts[j].Field
+		})
+		profiles = append(profiles, report)
+	}
+	sort.Slice(profiles, func(i, j int) bool { return profiles[i].Source < profiles[j].Source })
+	return profiles
+}
+
+// Forget the learned schema of a source, e.g. once a drift is expected, so that its new schema is
+// learned from scratch.
+func (as *AlertSchemas) Reset(source string) bool {
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+	if _, ok := as.profiles[source]; !ok {
+		return false
+	}
+	delete(as.profiles, source)
+	alertSchemaDrifts.DeleteLabelValues(source, "true")
+	alertSchemaDrifts.DeleteLabelValues(source, "false")
+	return true
+}
+
+// Learn the schema of an admitted alert, if drift detection is enabled.
+func observeAlertSchema(data map[string]interface{}, config *Config) {
+	if alertSchemas == nil {
+		return
+	}
+	alertSchemas.Observe(alertSource(data), data, func() map[string][]string {
+		rc, err := getRecipeCatalog(config.ReconcilerNamespace)
+		if err != nil {
+			return nil
+		}
+		return recipeFieldDependencies(rc.Recipes(Alert, true))
+	}, time.Now().UTC())
+}
+
+// Handle request to list the learned schemas of the alert sources, along with their drift.
+func handleListAlertSchemasRequest(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"minSamples": alertSchemas.minSamples,
+		"schemas":    alertSchemas.Profiles(),
+	})
+}
+
+// Handle request to forget the learned schema of an alert source.
+func handleResetAlertSchemaRequest(c *gin.Context) {
+	source := c.Param("source")
+	if !alertSchemas.Reset(source) {
+		respondProblem(
+			c, http.StatusNotFound, SchemaNotFoundProblem,
+			fmt.Sprintf("No schema learned for source '%s'", source),
+		)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"source": source, "reset": true})
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that the fields of alerts are collected as paths, leaving out the ones of the reconciler.
+func TestAlertFields(t *testing.T) {
+	data := map[string]interface{}{
+		"uuid":         "01HQ3Z5N2E8Y6V4C1X0W9T7R5P",
+		"route":        RouteMatch{Name: "grafana"},
+		"status":       "firing",
+		"commonLabels": map[string]interface{}{"namespace": "orders"},
+		"alerts": []interface{}{
+			map[string]interface{}{"labels": map[string]interface{}{"pod": "orders-0"}},
+			map[string]interface{}{"labels": map[string]interface{}{"node": "node-1"}},
+		},
+	}
+
+	assert.Equal(t, map[string]bool{
+		"status":                 true,
+		"commonLabels":           true,
+		"commonLabels.namespace": true,
+		"alerts":                 true,
+		"alerts[]":               true,
+		"alerts[].labels":        true,
+		"alerts[].labels.pod":    true,
+		"alerts[].labels.node":   true,
+	}, alertFields(data))
+	assert.Equal(t, "grafana", alertSource(data))
+	assert.Equal(t, webhookAlertSource, alertSource(map[string]interface{}{}))
+}
+
+// Test that the fields of the alerts the recipes depend on are found in their parameters.
+func TestRecipeFieldDependencies(t *testing.T) {
+	recipes := map[string]Recipe{
+		"logs": {Config: &RecipeConfig{Params: map[string]string{
+			"namespace": "{{ .alert.commonLabels.namespace }}",
+			"since":     `{{ if .alert.startsAt }}{{ .alert.startsAt | quote }}{{ end }}`,
+		}}},
+		"pods": {Config: &RecipeConfig{Params: map[string]string{
+			"namespace": "{{ .alert.commonLabels.namespace | lower }}",
+			"pod":       "{{ .labels.pod }}",
+		}}},
+		"dummy": {Config: &RecipeConfig{}},
+	}
+
+	assert.Equal(t, map[string][]string{
+		"commonLabels.namespace": {"logs", "pods"},
+		"startsAt":               {"logs"},
+	}, recipeFieldDependencies(recipes))
+}
+
+// Test that typical fields missing from the alerts of a source are reported as drift, along with
+// the recipes depending on them, until they are sent again.
+func TestAlertSchemasDrift(t *testing.T) {
+	as := NewAlertSchemas(5)
+	now := time.Now()
+	dependencies := func() map[string][]string {
+		return map[string][]string{"commonLabels.namespace": {"logs"}}
+	}
+	alert := func(fields ...string) map[string]interface{} {
+		data := map[string]interface{}{"status": "firing"}
+		labels := map[string]interface{}{}
+		for _, field := range fields {
+			labels[field] = "value"
+		}
+		data["commonLabels"] = labels
+		return data
+	}
+
+	for i := 0; i < 5; i++ {
+		as.Observe("grafana", alert("namespace", "severity"), dependencies, now)
+	}
+	// Fields are only typical if they are present in most alerts
+	as.Observe("grafana", alert("namespace", "severity", "pod"), dependencies, now)
+	profiles := as.Profiles()
+	assert.Len(t, profiles, 1)
+	assert.False(t, profiles[0].Learning)
+	assert.Equal(t, 6, profiles[0].Samples)
+	assert.Empty(t, profiles[0].Drifts)
+	paths := []string{}
+	for _, field := range profiles[0].Fields {
+		paths = append(paths, field.Path)
+	}
+	assert.Equal(t, []string{
+		"commonLabels", "commonLabels.namespace", "commonLabels.severity", "status",
+	}, paths)
+
+	as.Observe("grafana", alert("severity"), dependencies, now)
+	as.Observe("grafana", alert("severity"), dependencies, now.Add(time.Minute))
+	profiles = as.Profiles()
+	assert.Equal(t, []*SchemaDrift{
+		{Field: "commonLabels.namespace", Recipes: []string{"logs"}, Since: now, Missing: 2},
+	}, profiles[0].Drifts)
+
+	as.Observe("grafana", alert("namespace", "severity"), dependencies, now)
+	assert.Empty(t, as.Profiles()[0].Drifts)
+
+	assert.True(t, as.Reset("grafana"))
+	assert.False(t, as.Reset("grafana"))
+	assert.Empty(t, as.Profiles())
+}
+
+// Test that drift is not detected while the schema of a source is being learned.
+func TestAlertSchemasLearning(t *testing.T) {
+	as := NewAlertSchemas(5)
+	dependencies := func() map[string][]string { return nil }
+	as.Observe("webhook", map[string]interface{}{"status": "firing"}, dependencies, time.Now())
+	as.Observe("webhook", map[string]interface{}{}, dependencies, time.Now())
+
+	profiles := as.Profiles()
+	assert.True(t, profiles[0].Learning)
+	assert.Empty(t, profiles[0].Drifts)
+}
+
+// Test that the learned schemas are listed and reset through the admin API.
+func TestAlertSchemasRequest(t *testing.T) {
+	schemas := alertSchemas
+	defer func() { alertSchemas = schemas }()
+	alertSchemas = NewAlertSchemas(5)
+	alertSchemas.Observe(
+		"webhook", map[string]interface{}{"status": "firing"},
+		func() map[string][]string { return nil }, time.Now(),
+	)
+
+	router := gin.New()
+	router.GET("/schemas", handleListAlertSchemasRequest)
+	router.DELETE("/schemas/:source", handleResetAlertSchemaRequest)
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/schemas", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `"source":"webhook"`)
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodDelete, "/schemas/webhook", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodDelete, "/schemas/webhook", nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
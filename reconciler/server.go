@@ -3,14 +3,15 @@ package main
 import (
 	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	batchv1 "k8s.io/api/batch/v1"
 )
 
 type JobStatus struct {
@@ -23,9 +24,84 @@ type JobStatus struct {
 
 func StartServer(config *Config) {
 	router := gin.Default()
-	router.POST("/api/status", func(ctx *gin.Context) { handleStatusRequest(ctx, config) })
-	router.POST("/api/actions", func(ctx *gin.Context) { handleActionsRequest(ctx, config) })
-	if err := router.Run(":8081"); err != nil {
+	router.Use(traceRequests())
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	router.GET("/healthz", handleHealthRequest)
+	router.GET("/readyz", handleReadinessRequest)
+
+	api := router.Group("/", authenticate(config, "api", config.APIAuth))
+	api.POST("/api/status", requireLeader(), func(ctx *gin.Context) {
+		handleStatusRequest(ctx, config)
+	})
+	api.POST("/api/actions", requireLeader(), checkDraining(), func(ctx *gin.Context) {
+		handleActionsRequest(ctx, config)
+	})
+	api.GET("/incidents", handleListIncidentsRequest)
+	api.GET("/incidents/:uuid", handleGetIncidentRequest)
+	api.GET("/incidents/:uuid/stream", handleIncidentStreamRequest)
+	api.POST("/incidents/:uuid/approve", requireLeader(), func(ctx *gin.Context) {
+		handleApprovalDecision(ctx, ApprovalStateApproved)
+	})
+	api.POST("/incidents/:uuid/deny", requireLeader(), func(ctx *gin.Context) {
+		handleApprovalDecision(ctx, ApprovalStateDenied)
+	})
+	api.POST("/incidents/:uuid/cancel", requireLeader(), func(ctx *gin.Context) {
+		handleCancelIncidentRequest(ctx, config)
+	})
+	api.PUT("/incidents/:uuid/hold", requireLeader(), handlePlaceLegalHoldRequest)
+	api.DELETE("/incidents/:uuid/hold", requireLeader(), handleReleaseLegalHoldRequest)
+	api.PUT("/incidents/:uuid/ack", requireLeader(), handleAckRequest)
+	api.GET("/api/v1/config/effective", func(ctx *gin.Context) {
+		handleEffectiveConfigRequest(ctx, config)
+	})
+	api.GET("/api/v1/config/status", handleConfigStatusRequest)
+	api.POST("/api/v1/config/reload", requireAdminToken(config), func(ctx *gin.Context) {
+		handleReloadConfigRequest(ctx, config)
+	})
+	api.GET("/api/v1/recipes", func(ctx *gin.Context) {
+		handleListRecipesRequest(ctx, config)
+	})
+	api.GET("/api/v1/stats", func(ctx *gin.Context) {
+		handleStatsRequest(ctx, config)
+	})
+	api.POST("/api/v1/templates/preview", handleTemplatePreviewRequest)
+
+	admin := router.Group("/api/v1/admin", requireAdminToken(config))
+	admin.GET("/pause", handleIntakeStateRequest)
+	admin.POST("/pause", requireLeader(), func(ctx *gin.Context) {
+		handlePauseRequest(ctx, config)
+	})
+	admin.POST("/resume", requireLeader(), func(ctx *gin.Context) {
+		handleResumeRequest(ctx, config)
+	})
+	admin.POST("/cleanup", requireLeader(), func(ctx *gin.Context) {
+		handleBatchCleanupRequest(ctx, config)
+	})
+	if alertSchemas != nil {
+		admin.GET("/schemas", handleListAlertSchemasRequest)
+		admin.DELETE("/schemas/:source", handleResetAlertSchemaRequest)
+	}
+
+	federation := router.Group("/federation", requireFederationToken(config))
+	federation.POST("/executions", requireLeader(), checkDraining(), func(ctx *gin.Context) {
+		handleFederatedExecutionRequest(ctx, config)
+	})
+	federation.GET("/executions/:uuid", handleGetIncidentRequest)
+
+	if config.DebugSessions {
+		api.POST("/incidents/:uuid/debug", requireLeader(), handleCreateDebugSessionRequest)
+		api.GET("/incidents/:uuid/debug", handleListDebugSessionsRequest)
+		api.DELETE("/incidents/:uuid/debug/:name", requireLeader(), handleDeleteDebugSessionRequest)
+	}
+
+	// ChatOps callbacks are verified with the signing secret of the provider
+	if config.ChatOpsSigningSecret != "" {
+		router.POST("/chatops/callback", requireLeader(), func(ctx *gin.Context) {
+			handleChatOpsCallback(ctx, config)
+		})
+	}
+
+	if err := runRouter(router, ":8081", config); err != nil {
 		logger.Error("Failed to start server", zap.Error(err))
 	}
 }
@@ -35,9 +111,11 @@ func handleStatusRequest(c *gin.Context, config *Config) {
 
 	var data map[string]interface{}
 
-	if err := c.BindJSON(&data); err != nil {
+	if err := c.ShouldBindJSON(&data); err != nil {
 		logger.Error("Failed to parse JSON", zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON for Action response"})
+		respondProblem(
+			c, http.StatusBadRequest, InvalidRequestProblem, "Invalid JSON for status request",
+		)
 		return
 	}
 
@@ -45,11 +123,12 @@ func handleStatusRequest(c *gin.Context, config *Config) {
 	logger.Info("Status Request received", zap.Any("request", data))
 
 	var jobStatuses []JobStatus
-	jobStatuses, err := getJobStatus(&data, config.RecipeNamespace)
+	jobStatuses, err := getJobStatus(c.Request.Context(), &data, catalogTargets(config))
 	if err != nil {
 		logger.Error("Error Getting Job Status", zap.Error(err))
 	}
-	err = postStatusToWebexBot(jobStatuses, config.WebexBotAddress)
+	uuid, _ := data["uuid"].(string)
+	err = postStatusToWebexBot(jobStatuses, uuid, config.WebexBotAddress)
 	if err != nil {
 		logger.Error("Failed to send status to Bot", zap.Error(err))
 	}
@@ -57,23 +136,27 @@ func handleStatusRequest(c *gin.Context, config *Config) {
 	c.JSON(http.StatusOK, gin.H{"message": "Status Request received and processed"})
 }
 
-// Get the list of Job statuses for a specific UUID.
-func getJobStatus(message *map[string]interface{}, namespace string) ([]JobStatus, error) {
-	listOptions := metav1.ListOptions{
-		LabelSelector: "app=euphrosyne",
-	}
+// Get the list of Job statuses for a specific UUID, across the targets of the recipes.
+func getJobStatus(
+	ctx context.Context, message *map[string]interface{}, targets []RecipeTarget,
+) ([]JobStatus, error) {
+	labelSelector := "app=euphrosyne"
 	if _, ok := (*message)["uuid"]; ok {
-		listOptions.LabelSelector += fmt.Sprintf(",uuid=%s", (*message)["uuid"])
+		labelSelector += fmt.Sprintf(",uuid=%s", (*message)["uuid"])
 	}
-	jobList, err := clientset.BatchV1().Jobs(namespace).List(context.TODO(), listOptions)
-	if err != nil {
-		logger.Error("Failed to list K8s Jobs", zap.Error(err))
-		return nil, err
+	var jobs []batchv1.Job
+	for _, target := range targets {
+		jobList, err := listTargetJobs(ctx, target, labelSelector)
+		if err != nil {
+			logger.Error("Failed to list K8s Jobs", zap.Error(err))
+			return nil, err
+		}
+		jobs = append(jobs, jobList.Items...)
 	}
 
 	jobStatuses := []JobStatus{}
 
-	for _, job := range jobList.Items {
+	for _, job := range jobs {
 		jobStatus := JobStatus{
 			Name:        job.Name,
 			StartTime:   job.CreationTimestamp.Time.Format(time.RFC3339),
@@ -96,9 +179,12 @@ func getJobStatus(message *map[string]interface{}, namespace string) ([]JobStatu
 }
 
 // Post status message to Webex Bot.
-func postStatusToWebexBot(message []JobStatus, webexBotAddress string) error {
-	// Convert the messages to JSON
-	jsonData, err := json.Marshal(message)
+func postStatusToWebexBot(message []JobStatus, uuid string, webexBotAddress string) error {
+	incidentRegistry.RecordMessage(uuid, WebexStatusDestination, message)
+	incident, _ := incidentRegistry.Get(uuid)
+
+	// Render the message using the configured template
+	jsonData, err := renderMessage(WebexStatusDestination, message, incident)
 	if err != nil {
 		return err
 	}
@@ -125,14 +211,284 @@ func handleActionsRequest(c *gin.Context, config *Config) {
 
 	var data map[string]interface{}
 
-	if err := c.BindJSON(&data); err != nil {
+	if err := c.ShouldBindJSON(&data); err != nil {
 		logger.Error("Failed to parse JSON", zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON for Action response"})
+		respondProblem(
+			c, http.StatusBadRequest, InvalidRequestProblem, "Invalid JSON for Action response",
+		)
 		return
 	}
 
 	logger.Info("Action response received", zap.Any("request", data))
-	go StartRecipeExecutor(c, config, &data, Actions)
+	if problem, ok := validateActionRequest(data, config); !ok {
+		respondWithProblem(c, problem)
+		return
+	}
+	if !checkRouteActions(c, data) {
+		return
+	}
+	authModes := requestAuthModes(c, config.APIAuth)
+	if !checkInlineRecipe(c, data, config, authModes, Actions) {
+		return
+	}
+	if !checkOverrides(c, data, config, authModes) {
+		return
+	}
+	if isDryRun(c, data, config) {
+		plan, err := planActionRecipes(config, &data)
+		if errors.Is(err, errInvalidRecipeParams) {
+			respondProblem(c, http.StatusBadRequest, InvalidRequestProblem, err.Error())
+			return
+		}
+		if err != nil {
+			logger.Error("Failed to plan action recipes", zap.Error(err))
+			respondProblem(c, http.StatusInternalServerError, InternalErrorProblem, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Dry run, no resources were created",
+			"dryRun":  true,
+			"actions": plan,
+		})
+		return
+	}
+	if err := executionQueue.Submit(c.Request.Context(), &data, Actions); err != nil {
+		logger.Warn("Rejecting Action response", zap.Error(err))
+		respondProblem(c, http.StatusTooManyRequests, QueueFullProblem, err.Error())
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Response Request received and processed"})
 }
+
+// Validate the actions of a request against the recipe catalog, so that unknown recipes are
+// rejected instead of being silently skipped.
+func validateActionRequest(data map[string]interface{}, config *Config) (Problem, bool) {
+	if _, ok := data["actions"].([]interface{}); !ok && data["actions"] != nil {
+		return newProblem(
+			http.StatusBadRequest, InvalidRequestProblem, "Expected 'actions' to be a list",
+		), false
+	}
+	actions, err := parseActionData(&data)
+	if err != nil {
+		return newProblem(http.StatusBadRequest, InvalidRequestProblem, err.Error()), false
+	}
+	rc, err := getRecipeCatalog(config.ReconcilerNamespace)
+	if err != nil {
+		return newProblem(
+			http.StatusServiceUnavailable, CatalogUnavailableProblem, "Recipe catalog not loaded",
+		), false
+	}
+	recipes := rc.Recipes(Actions, true)
+	for _, action := range actions {
+		if _, ok := recipes[action.Name]; !ok {
+			return newProblem(
+				http.StatusNotFound, RecipeNotFoundProblem,
+				fmt.Sprintf("Action recipe '%s' is not enabled", action.Name),
+			), false
+		}
+	}
+	return Problem{}, true
+}
+
+// Handle request for the recipe catalog currently used by new executions.
+func handleEffectiveConfigRequest(c *gin.Context, config *Config) {
+	rc, err := getRecipeCatalog(config.ReconcilerNamespace)
+	if err != nil {
+		logger.Error("Failed to retrieve recipe catalog", zap.Error(err))
+		respondProblem(
+			c, http.StatusServiceUnavailable, CatalogUnavailableProblem,
+			"Recipe catalog not loaded",
+		)
+		return
+	}
+
+	// Compare against the latest version of the ConfigMap to detect a stale catalog
+	response := gin.H{"catalog": rc}
+	latest, err := loadRecipeCatalog(config.ReconcilerNamespace)
+	if err != nil {
+		logger.Warn("Failed to retrieve latest recipe catalog", zap.Error(err))
+		response["latest"] = gin.H{"error": err.Error()}
+	} else {
+		response["stale"] = latest.Hash != rc.Hash
+		response["latest"] = gin.H{
+			"hash":            latest.Hash,
+			"resourceVersion": latest.ResourceVersion,
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// Handle request to reload the recipe catalog from the recipes ConfigMap.
+func handleReloadConfigRequest(c *gin.Context, config *Config) {
+	rc, err := ReloadRecipeCatalog(config.ReconcilerNamespace)
+	if err != nil {
+		logger.Error("Failed to reload recipe catalog", zap.Error(err))
+		respondProblem(
+			c, http.StatusInternalServerError, InternalErrorProblem,
+			fmt.Sprintf("Failed to reload recipe catalog: %s", err),
+		)
+		return
+	}
+	if err := LoadMessageTemplates(config.ReconcilerNamespace); err != nil {
+		logger.Error("Failed to reload message templates", zap.Error(err))
+		respondProblem(
+			c, http.StatusInternalServerError, InternalErrorProblem,
+			fmt.Sprintf("Failed to reload message templates: %s", err),
+		)
+		return
+	}
+	if err := LoadRoutes(config); err != nil {
+		logger.Error("Failed to reload routes", zap.Error(err))
+		respondProblem(
+			c, http.StatusInternalServerError, InternalErrorProblem,
+			fmt.Sprintf("Failed to reload routes: %s", err),
+		)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Recipe catalog reloaded", "catalog": rc})
+}
+
+// Handle request for the status of the configuration sources, reporting any invalid changes.
+func handleConfigStatusRequest(c *gin.Context) {
+	sources, valid := configStatus.Snapshot()
+	c.JSON(http.StatusOK, gin.H{"valid": valid, "sources": sources})
+}
+
+// Handle request for the list of known incidents.
+func handleListIncidentsRequest(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"incidents": incidentRegistry.List()})
+}
+
+// Handle request for the status of a specific incident.
+func handleGetIncidentRequest(c *gin.Context) {
+	incident, ok := incidentRegistry.Get(c.Param("uuid"))
+	if !ok {
+		respondProblem(c, http.StatusNotFound, IncidentNotFoundProblem, "")
+		return
+	}
+	c.JSON(http.StatusOK, incident)
+}
+
+// Handle request to cancel the execution of an incident, deleting its recipe Jobs.
+func handleCancelIncidentRequest(c *gin.Context, config *Config) {
+	incident, err := CancelIncident(c.Request.Context(), c.Param("uuid"), config)
+	switch {
+	case errors.Is(err, errIncidentNotFound):
+		respondProblem(c, http.StatusNotFound, IncidentNotFoundProblem, "")
+	case errors.Is(err, errIncidentNotActive):
+		problem := newProblem(
+			http.StatusConflict, IncidentNotActiveProblem,
+			fmt.Sprintf("Incident is already %s", incident.State),
+		)
+		problem.Extensions = map[string]interface{}{"incident": incident}
+		respondWithProblem(c, problem)
+	case err != nil:
+		logger.Error("Failed to delete the resources of cancelled incident", zap.Error(err))
+		problem := newProblem(
+			http.StatusInternalServerError, InternalErrorProblem,
+			"Incident cancelled, but its resources could not be deleted",
+		)
+		problem.Extensions = map[string]interface{}{"incident": incident}
+		respondWithProblem(c, problem)
+	default:
+		c.JSON(http.StatusOK, incident)
+	}
+}
+
+// Handle request to approve or deny the pending actions of an incident.
+func handleApprovalDecision(c *gin.Context, state string) {
+	var request struct {
+		User   string `json:"user"`
+		Reason string `json:"reason"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			logger.Error("Failed to parse JSON", zap.Error(err))
+			respondProblem(
+				c, http.StatusBadRequest, InvalidRequestProblem,
+				"Invalid JSON for approval decision",
+			)
+			return
+		}
+	}
+
+	approval, err := decideApproval(
+		c.Request.Context(), c.Param("uuid"), state, request.User, request.Reason,
+	)
+	switch {
+	case errors.Is(err, errApprovalNotFound):
+		respondProblem(
+			c, http.StatusNotFound, ApprovalNotFoundProblem, "No approval requested for incident",
+		)
+	case errors.Is(err, errApprovalDecided):
+		problem := newProblem(http.StatusConflict, ApprovalDecidedProblem, err.Error())
+		problem.Extensions = map[string]interface{}{"approval": approval}
+		respondWithProblem(c, problem)
+	case err != nil:
+		logger.Error("Failed to record approval decision", zap.Error(err))
+		respondProblem(
+			c, http.StatusInternalServerError, InternalErrorProblem, "Failed to record decision",
+		)
+	default:
+		c.JSON(http.StatusOK, approval)
+	}
+}
+
+// Handle request to preview a message template against the messages of a past incident.
+func handleTemplatePreviewRequest(c *gin.Context) {
+	var request struct {
+		Destination string  `json:"destination" binding:"required"`
+		UUID        string  `json:"uuid" binding:"required"`
+		Template    *string `json:"template"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		logger.Error("Failed to parse JSON", zap.Error(err))
+		respondProblem(
+			c, http.StatusBadRequest, InvalidRequestProblem, "Invalid JSON for template preview",
+		)
+		return
+	}
+
+	incident, ok := incidentRegistry.Get(request.UUID)
+	if !ok {
+		respondProblem(c, http.StatusNotFound, IncidentNotFoundProblem, "")
+		return
+	}
+	message, ok := incident.Messages[request.Destination]
+	if !ok {
+		respondProblem(
+			c, http.StatusNotFound, MessageNotFoundProblem,
+			fmt.Sprintf("No message recorded for '%s'", request.Destination),
+		)
+		return
+	}
+
+	// Use the provided template, falling back to the one currently loaded
+	var rendered []byte
+	var err error
+	if request.Template != nil {
+		tmpl, parseErr := parseMessageTemplate(request.Destination, *request.Template)
+		if parseErr != nil {
+			respondProblem(
+				c, http.StatusBadRequest, InvalidTemplateProblem,
+				fmt.Sprintf("Invalid template: %s", parseErr),
+			)
+			return
+		}
+		rendered, err = renderTemplate(tmpl, TemplateContext{Message: message, Incident: incident})
+	} else {
+		rendered, err = renderMessage(request.Destination, message, incident)
+	}
+	if err != nil {
+		respondProblem(
+			c, http.StatusBadRequest, InvalidTemplateProblem,
+			fmt.Sprintf("Failed to render template: %s", err),
+		)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rendered": string(rendered)})
+}
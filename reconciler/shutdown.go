@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	// Interval for checking whether the in-flight executions have stopped during shutdown
+	drainPollInterval = 250 * time.Millisecond
+	// Time suspended executions are given to checkpoint their state and stop
+	suspendTimeout = 5 * time.Second
+)
+
+var (
+	errShuttingDown       = errors.New("Reconciler is shutting down")
+	errExecutionSuspended = errors.New("Execution suspended on shutdown")
+)
+
+// Drain keeps track of the graceful shutdown of the reconciler. Once draining, no new execution is
+// accepted, while the in-flight ones are given time to complete. The executions still running
+// past that time are suspended, i.e. checkpointed and stopped, so that they are resumed by the
+// next leader or once the reconciler restarts.
+type Drain struct {
+	draining atomic.Bool
+	suspend  chan struct{}
+	once     sync.Once
+}
+
+// Shutdown state of the reconciler.
+var drain = NewDrain()
+
+// Initialise the shutdown state of a running reconciler.
+func NewDrain() *Drain {
+	return &Drain{suspend: make(chan struct{})}
+}
+
+// Stop accepting new executions.
+func (d *Drain) Start() {
+	d.draining.Store(true)
+	shuttingDown.Set(1)
+}
+
+// Check whether the reconciler is shutting down.
+func (d *Drain) Draining() bool {
+	return d.draining.Load()
+}
+
+// Suspend the running executions.
+func (d *Drain) Suspend() {
+	d.once.Do(func() { close(d.suspend) })
+}
+
+// Return a channel that is closed once the running executions have to be suspended.
+func (d *Drain) Suspended() <-chan struct{} {
+	return d.suspend
+}
+
+// Check whether the running executions are being suspended.
+func (d *Drain) Suspending() bool {
+	select {
+	case <-d.suspend:
+		return true
+	default:
+		return false
+	}
+}
+
+// Shut down gracefully, giving the in-flight executions up to the shutdown timeout to complete
+// before suspending the rest. Executions that are still queued or awaiting approval are lost, as
+// well as running ones if their state is not persisted.
+func Shutdown(config *Config) {
+	drain.Start()
+	logger.Info(
+		"Draining in-flight executions",
+		zap.Int("running", activeExecutions.Len()),
+		zap.Int("queued", executionQueue.Pending()),
+		zap.Duration("timeout", config.ShutdownTimeout),
+	)
+	if waitForExecutions(config.ShutdownTimeout) {
+		logger.Info("All in-flight executions completed")
+		return
+	}
+
+	if durableExecutions(config) {
+		logger.Warn(
+			"Suspending in-flight executions, to be resumed by another replica",
+			zap.Int("running", activeExecutions.Len()),
+		)
+	} else {
+		logger.Warn(
+			"Interrupting in-flight executions, which cannot be resumed without the Redis store",
+			zap.Int("running", activeExecutions.Len()),
+		)
+	}
+	drain.Suspend()
+	if !waitForExecutions(suspendTimeout) {
+		logger.Warn(
+			"Executions failed to stop in time",
+			zap.Int("running", activeExecutions.Len()),
+			zap.Int("queued", executionQueue.Pending()),
+		)
+	}
+}
+
+// Wait for the running and queued executions to stop, returning whether they did in time. Queued
+// executions are not started once suspended, and are not waited for.
+func waitForExecutions(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for activeExecutions.Len() > 0 || (executionQueue.Pending() > 0 && !drain.Suspending()) {
+		if !time.Now().Before(deadline) {
+			return false
+		}
+		time.Sleep(drainPollInterval)
+	}
+	return true
+}
+
+// Middleware rejecting requests that would start executions once the reconciler is shutting down,
+// so that their senders retry them against another replica.
+func checkDraining() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !drain.Draining() {
+			c.Next()
+			return
+		}
+		respondProblem(
+			c, http.StatusServiceUnavailable, ShuttingDownProblem,
+			"The reconciler is shutting down, retry later",
+		)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// Replace the shutdown state for the duration of a test.
+func useTestDrain(t *testing.T) *Drain {
+	previous := drain
+	t.Cleanup(func() { drain = previous })
+	drain = NewDrain()
+	return drain
+}
+
+// Test that no execution is accepted once draining, and that queued executions are no longer
+// started once the running ones are suspended.
+func TestExecutionQueueDraining(t *testing.T) {
+	d := useTestDrain(t)
+	q, started, release := newTestQueue(&Config{Workers: 1})
+	defer close(release)
+
+	assert.Nil(t, q.Submit(context.Background(), &map[string]interface{}{"uuid": "drain-1"}, Alert))
+	assert.Equal(t, "drain-1", nextStarted(t, started))
+	assert.Nil(t, q.Submit(context.Background(), &map[string]interface{}{"uuid": "drain-2"}, Alert))
+	assert.Equal(t, 1, q.Pending())
+
+	d.Start()
+	err := q.Submit(context.Background(), &map[string]interface{}{"uuid": "drain-3"}, Actions)
+	assert.ErrorIs(t, err, errShuttingDown)
+
+	d.Suspend()
+	assert.True(t, d.Suspending())
+	release <- struct{}{}
+	select {
+	case uuid := <-started:
+		t.Fatalf("Execution '%s' started while suspending", uuid)
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.Equal(t, 1, q.Pending())
+}
+
+// Test that requests starting executions are rejected once the reconciler is shutting down.
+func TestCheckDraining(t *testing.T) {
+	d := useTestDrain(t)
+	router := gin.New()
+	router.POST("/webhook", checkDraining(), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/webhook", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	d.Start()
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/webhook", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	var problem map[string]interface{}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Equal(t, ShuttingDownProblem, problem["code"])
+}
+
+// Test that suspended executions are checkpointed and their claim released, so that another
+// replica resumes them right away.
+func TestSuspendExecution(t *testing.T) {
+	ctx := context.Background()
+	uuid := "suspended-1"
+	data := map[string]interface{}{"uuid": uuid}
+	r := &Reconciler{
+		uuid:        uuid,
+		config:      &Config{IncidentStore: RedisIncidentStore},
+		data:        &data,
+		recipes:     map[string]Recipe{"test-1-recipe": {}},
+		requestType: Alert,
+		deadline:    time.Now().Add(time.Minute),
+		jobs: map[string]*recipeJob{
+			"test-1-recipe": {jobName: "test-1-recipe-abcde", cmName: "cm", attempts: 1},
+		},
+		finished:  map[string]bool{},
+		completed: map[string]bool{},
+	}
+	defer r.deleteExecution()
+
+	r.suspend()
+	assert.True(t, r.suspended)
+	assert.Equal(t, int64(1), rdb.Exists(ctx, executionKeyPrefix+uuid).Val())
+	assert.Equal(t, int64(0), rdb.Exists(ctx, executionLockKeyPrefix+uuid).Val())
+
+	claimed, err := claimExecution(ctx, uuid)
+	assert.Nil(t, err)
+	assert.True(t, claimed)
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Window of the statistics, unless the request selects another one.
+const defaultStatsWindow = 24 * time.Hour
+
+// Stats are the execution statistics of the recipes over a window, computed from the incident
+// records kept by the result store.
+type Stats struct {
+	Window Duration  `json:"window"`
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	// Whether the window exceeds the retention of incident records, covering only part of it
+	Partial   bool          `json:"partial"`
+	Incidents int           `json:"incidents"`
+	Recipes   []RecipeStats `json:"recipes"`
+}
+
+// RecipeStats are the execution statistics of a single recipe. Reused results are not counted as
+// runs, while runs that are still in progress, skipped or cancelled are left out.
+type RecipeStats struct {
+	Recipe      string     `json:"recipe"`
+	Runs        int        `json:"runs"`
+	Succeeded   int        `json:"succeeded"`
+	Failed      int        `json:"failed"`
+	TimedOut    int        `json:"timedOut"`
+	Reused      int        `json:"reused"`
+	SuccessRate float64    `json:"successRate"`
+	TimeoutRate float64    `json:"timeoutRate"`
+	P50Duration *Duration  `json:"p50Duration,omitempty"`
+	P95Duration *Duration  `json:"p95Duration,omitempty"`
+	LastRunAt   *time.Time `json:"lastRunAt,omitempty"`
+	LastStatus  string     `json:"lastStatus,omitempty"`
+}
+
+// Parse the window of a statistics request, either a duration (e.g. "90m") or a number of days
+// (e.g. "7d").
+func parseStatsWindow(text string) (time.Duration, error) {
+	if text == "" {
+		return defaultStatsWindow, nil
+	}
+	var window time.Duration
+	var err error
+	if days, ok := strings.CutSuffix(text, "d"); ok {
+		var n int
+		n, err = strconv.Atoi(days)
+		window = time.Duration(n) * 24 * time.Hour
+	} else {
+		window, err = time.ParseDuration(text)
+	}
+	if err != nil || window <= 0 {
+		return 0, fmt.Errorf(
+			"Invalid window '%s', expected a positive duration, e.g. '24h' or '7d'", text,
+		)
+	}
+	return window, nil
+}
+
+// Compute the execution statistics of the recipes of the incidents created within a window.
+func computeStats(records []IncidentRecord, window time.Duration, now time.Time) Stats {
+	stats := Stats{Window: Duration{window}, From: now.Add(-window), To: now}
+	durations := make(map[string][]time.Duration)
+	byRecipe := make(map[string]*RecipeStats)
+
+	for _, record := range records {
+		if record.CreatedAt.Before(stats.From) || record.CreatedAt.After(now) {
+			continue
+		}
+		stats.Incidents++
+		for recipeName, state := range record.States {
+			recipeStats, ok := byRecipe[recipeName]
+			if !ok {
+				recipeStats = &RecipeStats{Recipe: recipeName}
+				byRecipe[recipeName] = recipeStats
+			}
+			if state.Cached {
+				recipeStats.Reused++
+				continue
+			}
+			status, ok := recipeRunStatus(state)
+			if !ok {
+				continue
+			}
+			recipeStats.Runs++
+			switch status {
+			case RecipeStatusSuccessful:
+				recipeStats.Succeeded++
+			case RecipeStateTimedOut:
+				recipeStats.TimedOut++
+			default:
+				recipeStats.Failed++
+			}
+			if state.CompletedAt != nil && state.State == RecipeStateCompleted {
+				durations[recipeName] = append(
+					durations[recipeName], state.CompletedAt.Sub(state.StartedAt),
+				)
+			}
+			if recipeStats.LastRunAt == nil || state.StartedAt.After(*recipeStats.LastRunAt) {
+				startedAt := state.StartedAt
+				recipeStats.LastRunAt = &startedAt
+				recipeStats.LastStatus = status
+			}
+		}
+	}
+
+	stats.Recipes = make([]RecipeStats, 0, len(byRecipe))
+	for recipeName, recipeStats := range byRecipe {
+		if recipeStats.Runs > 0 {
+			recipeStats.SuccessRate = float64(recipeStats.Succeeded) / float64(recipeStats.Runs)
+			recipeStats.TimeoutRate = float64(recipeStats.TimedOut) / float64(recipeStats.Runs)
+		}
+		recipeStats.P50Duration = percentile(durations[recipeName], 0.5)
+		recipeStats.P95Duration = percentile(durations[recipeName], 0.95)
+		stats.Recipes = append(stats.Recipes, *recipeStats)
+	}
+	sort.Slice(stats.Recipes, func(i, j int) bool {
+		return stats.Recipes[i].Recipe < stats.Recipes[j].Recipe
+	})
+	return stats
+}
+
+// Return the outcome of a finished recipe run, i.e. the status it reported, a timeout or a
+// failure.
+func recipeRunStatus(state *RecipeState) (string, bool) {
+	switch state.State {
+	case RecipeStateCompleted:
+		if state.Status == "" {
+			return RecipeStatusFailed, true
+		}
+		return state.Status, true
+	case RecipeStateTimedOut:
+		return RecipeStateTimedOut, true
+	case RecipeStateFailed:
+		return RecipeStatusFailed, true
+	}
+	return "", false
+}
+
+// Return the percentile of a set of durations, using the nearest-rank method, rounded to the
+// millisecond.
+func percentile(durations []time.Duration, p float64) *Duration {
+	if len(durations) == 0 {
+		return nil
+	}
+	sorted := append([]time.Duration{}, durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return &Duration{sorted[rank].Round(time.Millisecond)}
+}
+
+// Handle a request for the execution statistics of the recipes over a window, which are read from
+// the result store, so that they cover incidents handled before the reconciler restarted.
+func handleStatsRequest(c *gin.Context, config *Config) {
+	if resultStore == nil {
+		respondProblem(
+			c, http.StatusNotImplemented, ResultStoreDisabledProblem,
+			"Statistics are computed from the incident records, enable the result store",
+		)
+		return
+	}
+	window, err := parseStatsWindow(c.Query("window"))
+	if err != nil {
+		respondProblem(c, http.StatusBadRequest, InvalidRequestProblem, err.Error())
+		return
+	}
+
+	now := time.Now().UTC()
+	ctx, cancel := context.WithTimeout(c.Request.Context(), resultStoreTimeout)
+	defer cancel()
+	records, err := resultStore.List(ctx, now.Add(-window))
+	if err != nil {
+		logger.Error("Failed to read incident records", zap.Error(err))
+		respondProblem(c, http.StatusInternalServerError, InternalErrorProblem, err.Error())
+		return
+	}
+	stats := computeStats(records, window, now)
+	retention := shortestRetention(config.ResultStoreRetention, config.DataRetention)
+	stats.Partial = retention > 0 && window > retention
+	c.JSON(http.StatusOK, stats)
+}
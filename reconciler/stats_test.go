@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// Build the state of a finished recipe run that started some time before now.
+func finishedRun(now time.Time, ago, took time.Duration, state, status string) *RecipeState {
+	startedAt := now.Add(-ago)
+	completedAt := startedAt.Add(took)
+	return &RecipeState{
+		State: state, Status: status, StartedAt: startedAt, CompletedAt: &completedAt,
+	}
+}
+
+// Test the parsing of the window of statistics requests.
+func TestParseStatsWindow(t *testing.T) {
+	for text, expected := range map[string]time.Duration{
+		"":    24 * time.Hour,
+		"90m": 90 * time.Minute,
+		"7d":  7 * 24 * time.Hour,
+	} {
+		window, err := parseStatsWindow(text)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, window)
+	}
+	for _, text := range []string{"0d", "-1h", "week"} {
+		_, err := parseStatsWindow(text)
+		assert.ErrorContains(t, err, "Invalid window")
+	}
+}
+
+// Test that the statistics of each recipe only cover the finished runs within the window.
+func TestComputeStats(t *testing.T) {
+	now := time.Date(2024, 5, 15, 12, 0, 0, 0, time.UTC)
+	records := []IncidentRecord{
+		{CreatedAt: now.Add(-time.Hour), States: map[string]*RecipeState{
+			"logs": finishedRun(
+				now, time.Hour, 10*time.Second, RecipeStateCompleted, RecipeStatusSuccessful,
+			),
+			"heap-dump": finishedRun(now, time.Hour, time.Minute, RecipeStateTimedOut, ""),
+		}},
+		{CreatedAt: now.Add(-2 * time.Hour), States: map[string]*RecipeState{
+			"logs": finishedRun(
+				now, 2*time.Hour, 30*time.Second, RecipeStateCompleted, RecipeStatusFailed,
+			),
+			"heap-dump": {
+				State: RecipeStateCompleted, Status: RecipeStatusSuccessful, Cached: true,
+			},
+		}},
+		{CreatedAt: now.Add(-3 * time.Hour), States: map[string]*RecipeState{
+			"logs": finishedRun(
+				now, 3*time.Hour, 20*time.Second, RecipeStateCompleted, RecipeStatusSuccessful,
+			),
+			"heap-dump": {State: RecipeStateRunning, StartedAt: now.Add(-3 * time.Hour)},
+		}},
+		// Outside of the window
+		{CreatedAt: now.Add(-48 * time.Hour), States: map[string]*RecipeState{
+			"logs": finishedRun(
+				now, 48*time.Hour, time.Second, RecipeStateCompleted, RecipeStatusFailed,
+			),
+		}},
+	}
+
+	stats := computeStats(records, 24*time.Hour, now)
+	assert.Equal(t, 3, stats.Incidents)
+	assert.Equal(t, now.Add(-24*time.Hour), stats.From)
+
+	lastLogsRun := now.Add(-time.Hour)
+	lastHeapDumpRun := now.Add(-time.Hour)
+	assert.Equal(t, []RecipeStats{
+		{
+			Recipe:      "heap-dump",
+			Runs:        1,
+			TimedOut:    1,
+			Reused:      1,
+			TimeoutRate: 1,
+			LastRunAt:   &lastHeapDumpRun,
+			LastStatus:  RecipeStateTimedOut,
+		},
+		{
+			Recipe:      "logs",
+			Runs:        3,
+			Succeeded:   2,
+			Failed:      1,
+			SuccessRate: 2.0 / 3,
+			P50Duration: &Duration{20 * time.Second},
+			P95Duration: &Duration{30 * time.Second},
+			LastRunAt:   &lastLogsRun,
+			LastStatus:  RecipeStatusSuccessful,
+		},
+	}, stats.Recipes)
+}
+
+// Test that statistics are computed from the result store, reporting windows beyond the retention
+// of the records as partial.
+func TestHandleStatsRequest(t *testing.T) {
+	config := &Config{ResultStoreRetention: 7 * 24 * time.Hour}
+	router := gin.New()
+	router.GET("/api/v1/stats", func(ctx *gin.Context) {
+		handleStatsRequest(ctx, config)
+	})
+
+	// Statistics are not available without a result store
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/stats", nil))
+	assert.Equal(t, http.StatusNotImplemented, w.Code)
+	assert.Contains(t, w.Body.String(), ResultStoreDisabledProblem)
+
+	store, err := NewResultStore(context.Background(), "file://"+t.TempDir(), "")
+	assert.Nil(t, err)
+	defer func() { resultStore = nil }()
+	resultStore = store
+	now := time.Now().UTC()
+	for uuid, createdAt := range map[string]time.Time{
+		"stats-1": now.Add(-time.Hour),
+		"stats-2": now.Add(-3 * 24 * time.Hour),
+	} {
+		assert.Nil(t, store.Save(context.Background(), IncidentRecord{
+			UUID:        uuid,
+			CreatedAt:   createdAt,
+			CompletedAt: createdAt.Add(time.Minute),
+			States: map[string]*RecipeState{
+				"logs": finishedRun(
+					now, now.Sub(createdAt), time.Second,
+					RecipeStateCompleted, RecipeStatusSuccessful,
+				),
+			},
+		}))
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/stats", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var stats Stats
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Equal(t, 1, stats.Incidents)
+	assert.False(t, stats.Partial)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/stats?window=30d", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Equal(t, "720h0m0s", stats.Window.String())
+	assert.Equal(t, 2, stats.Incidents)
+	assert.Equal(t, 2, stats.Recipes[0].Runs)
+	assert.True(t, stats.Partial)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/stats?window=soon", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
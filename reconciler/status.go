@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// Number of the most recent executions listed in the status ConfigMap
+	statusRecentExecutions = 20
+	statusComponent        = "status"
+	statusReportKey        = "status.json"
+)
+
+// ExecutionDigest summarises an execution in the status of the Reconciler.
+type ExecutionDigest struct {
+	UUID        string     `json:"uuid"`
+	RequestType string     `json:"requestType"`
+	State       string     `json:"state"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+	// Recipes of the execution that failed or timed out
+	FailedRecipes []string `json:"failedRecipes,omitempty"`
+}
+
+// ReconcilerStatus summarises the health of the Reconciler for the executions known to the
+// incident registry, along with the configuration in use.
+type ReconcilerStatus struct {
+	UpdatedAt   time.Time `json:"updatedAt"`
+	Leader      string    `json:"leader,omitempty"`
+	CatalogHash string    `json:"catalogHash,omitempty"`
+	ConfigValid bool      `json:"configValid"`
+	Paused      bool      `json:"paused"`
+	// Number of executions by state
+	Executions map[string]int `json:"executions"`
+	// Number of executions with failed or timed out recipes, and the number of failures by recipe
+	FailedExecutions int               `json:"failedExecutions"`
+	FailedRecipes    map[string]int    `json:"failedRecipes,omitempty"`
+	Recent           []ExecutionDigest `json:"recent"`
+}
+
+// StatusReporter keeps a ConfigMap updated with the status of the Reconciler, so that it can be
+// read through the Kubernetes API, e.g. by GitOps dashboards, rather than through the HTTP API.
+type StatusReporter struct {
+	client    kubernetes.Interface
+	namespace string
+	name      string
+}
+
+// Reporter of the status of the Reconciler, nil unless enabled.
+var statusReporter *StatusReporter
+
+// Initialise a reporter of the status of the Reconciler to the configured ConfigMap.
+func NewStatusReporter(client kubernetes.Interface, config *Config) *StatusReporter {
+	return &StatusReporter{
+		client:    client,
+		namespace: config.ReconcilerNamespace,
+		name:      config.StatusConfigMap,
+	}
+}
+
+// Update the status ConfigMap periodically, until the context is done.
+func (sr *StatusReporter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := sr.Sync(ctx, time.Now().UTC()); err != nil {
+			logger.Warn("Failed to update the status ConfigMap", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Create or update the status ConfigMap with the current status of the Reconciler.
+func (sr *StatusReporter) Sync(ctx context.Context, now time.Time) error {
+	status := newReconcilerStatus(incidentRegistry.List(), now)
+	data, err := statusData(status)
+	if err != nil {
+		statusSyncs.WithLabelValues("failed").Inc()
+		return err
+	}
+
+	configMaps := sr.client.CoreV1().ConfigMaps(sr.namespace)
+	configMap, err := configMaps.Get(ctx, sr.name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		_, err = configMaps.Create(ctx, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      sr.name,
+				Namespace: sr.namespace,
+				Labels:    map[string]string{"app": "euphrosyne", "component": statusComponent},
+			},
+			Data: data,
+		}, metav1.CreateOptions{})
+	} else if err == nil {
+		configMap.Data = data
+		_, err = configMaps.Update(ctx, configMap, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		statusSyncs.WithLabelValues("failed").Inc()
+		return err
+	}
+	statusSyncs.WithLabelValues("updated").Inc()
+	return nil
+}
+
+// Summarise the status of the Reconciler from the incidents of the incident registry.
+func newReconcilerStatus(incidents []*Incident, now time.Time) ReconcilerStatus {
+	status := ReconcilerStatus{
+		UpdatedAt:  now,
+		Leader:     leadership.Leader(),
+		Paused:     intake.State().Paused,
+		Executions: map[string]int{},
+		Recent:     []ExecutionDigest{},
+	}
+	_, status.ConfigValid = configStatus.Snapshot()
+	catalogMutex.RLock()
+	if catalog != nil {
+		status.CatalogHash = catalog.Hash
+	}
+	catalogMutex.RUnlock()
+
+	sort.Slice(incidents, func(i, j int) bool {
+		return incidents[i].CreatedAt.After(incidents[j].CreatedAt)
+	})
+	for _, incident := range incidents {
+		status.Executions[incident.State]++
+		digest := ExecutionDigest{
+			UUID:        incident.UUID,
+			RequestType: incident.RequestType,
+			State:       incident.State,
+			CreatedAt:   incident.CreatedAt,
+			CompletedAt: incident.CompletedAt,
+		}
+		for recipeName, recipe := range incident.Recipes {
+			if recipe.State == RecipeStateFailed || recipe.State == RecipeStateTimedOut {
+				digest.FailedRecipes = append(digest.FailedRecipes, recipeName)
+			}
+		}
+		if incident.State == IncidentStateFailed {
+			status.FailedExecutions++
+		}
+		if len(digest.FailedRecipes) > 0 {
+			sort.Strings(digest.FailedRecipes)
+			if incident.State != IncidentStateFailed {
+				status.FailedExecutions++
+			}
+			if status.FailedRecipes == nil {
+				status.FailedRecipes = make(map[string]int)
+			}
+			for _, recipeName := range digest.FailedRecipes {
+				status.FailedRecipes[recipeName]++
+			}
+		}
+		if len(status.Recent) < statusRecentExecutions {
+			status.Recent = append(status.Recent, digest)
+		}
+	}
+	return status
+}
+
+// Build the data of the status ConfigMap, i.e. the figures that can be read at a glance, e.g.
+// through custom columns, along with the full status as JSON.
+func statusData(status ReconcilerStatus) (map[string]string, error) {
+	report, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	total := 0
+	for _, count := range status.Executions {
+		total += count
+	}
+	data := map[string]string{
+		"updatedAt":        status.UpdatedAt.Format(time.RFC3339),
+		"catalogHash":      status.CatalogHash,
+		"configValid":      strconv.FormatBool(status.ConfigValid),
+		"paused":           strconv.FormatBool(status.Paused),
+		"executions":       strconv.Itoa(total),
+		"running":          strconv.Itoa(status.Executions[IncidentStateRunning]),
+		"queued":           strconv.Itoa(status.Executions[IncidentStateQueued]),
+		"failedExecutions": strconv.Itoa(status.FailedExecutions),
+		"summary":          statusSummary(status, total),
+		statusReportKey:    string(report),
+	}
+	if status.Leader != "" {
+		data["leader"] = status.Leader
+	}
+	return data, nil
+}
+
+// Summarise the status of the Reconciler in a line, e.g. "2 running, 1 queued, 40 completed,
+// 3 with failures".
+func statusSummary(status ReconcilerStatus, total int) string {
+	if total == 0 {
+		return "No executions"
+	}
+	var parts []string
+	for _, state := range []string{
+		IncidentStateRunning, IncidentStateQueued, IncidentStatePendingApproval,
+		IncidentStateCompleted, IncidentStateCancelled, IncidentStateFailed,
+	} {
+		if count := status.Executions[state]; count > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", count, state))
+		}
+	}
+	parts = append(parts, fmt.Sprintf("%d with failures", status.FailedExecutions))
+	return strings.Join(parts, ", ")
+}
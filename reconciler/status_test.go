@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// Test that the status of the Reconciler counts the executions by state and the failed recipes,
+// listing the most recent executions first.
+func TestReconcilerStatus(t *testing.T) {
+	createdAt := time.Date(2024, 2, 20, 10, 0, 0, 0, time.UTC)
+	completedAt := createdAt.Add(time.Minute)
+	incidents := []*Incident{
+		{
+			UUID: "older", RequestType: "alert", State: IncidentStateCompleted,
+			CreatedAt: createdAt, CompletedAt: &completedAt,
+			Recipes: map[string]*RecipeState{
+				"logs": {State: RecipeStateCompleted},
+				"pods": {State: RecipeStateTimedOut},
+			},
+		},
+		{
+			UUID: "newer", RequestType: "alert", State: IncidentStateRunning,
+			CreatedAt: createdAt.Add(time.Hour),
+			Recipes: map[string]*RecipeState{
+				"pods":    {State: RecipeStateFailed},
+				"metrics": {State: RecipeStateFailed},
+			},
+		},
+		{
+			UUID: "queued", RequestType: "actions", State: IncidentStateQueued,
+			CreatedAt: createdAt.Add(30 * time.Minute),
+		},
+	}
+
+	now := createdAt.Add(2 * time.Hour)
+	status := newReconcilerStatus(incidents, now)
+	assert.Equal(t, now, status.UpdatedAt)
+	assert.Equal(t, map[string]int{
+		IncidentStateCompleted: 1, IncidentStateRunning: 1, IncidentStateQueued: 1,
+	}, status.Executions)
+	assert.Equal(t, 2, status.FailedExecutions)
+	assert.Equal(t, map[string]int{"metrics": 1, "pods": 2}, status.FailedRecipes)
+	assert.Equal(t, []ExecutionDigest{
+		{
+			UUID: "newer", RequestType: "alert", State: IncidentStateRunning,
+			CreatedAt: createdAt.Add(time.Hour), FailedRecipes: []string{"metrics", "pods"},
+		},
+		{
+			UUID: "queued", RequestType: "actions", State: IncidentStateQueued,
+			CreatedAt: createdAt.Add(30 * time.Minute),
+		},
+		{
+			UUID: "older", RequestType: "alert", State: IncidentStateCompleted,
+			CreatedAt: createdAt, CompletedAt: &completedAt, FailedRecipes: []string{"pods"},
+		},
+	}, status.Recent)
+
+	data, err := statusData(status)
+	assert.Nil(t, err)
+	assert.Equal(t, "3", data["executions"])
+	assert.Equal(t, "1", data["running"])
+	assert.Equal(t, "2", data["failedExecutions"])
+	assert.Equal(t, "1 running, 1 queued, 1 completed, 2 with failures", data["summary"])
+
+	empty, _ := statusData(newReconcilerStatus(nil, now))
+	assert.Equal(t, "No executions", empty["summary"])
+}
+
+// Test that the status ConfigMap is created, and then kept updated with the status of the
+// Reconciler.
+func TestStatusReporterSync(t *testing.T) {
+	registry := incidentRegistry
+	defer func() { incidentRegistry = registry }()
+	incidentRegistry = NewIncidentRegistry(MemoryIncidentStore, time.Hour)
+
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+	reporter := NewStatusReporter(
+		client, &Config{ReconcilerNamespace: "euphrosyne", StatusConfigMap: "euphrosyne-status"},
+	)
+
+	now := time.Date(2024, 2, 20, 10, 0, 0, 0, time.UTC)
+	assert.Nil(t, reporter.Sync(ctx, now))
+	configMap, err := client.CoreV1().ConfigMaps("euphrosyne").Get(
+		ctx, "euphrosyne-status", metav1.GetOptions{},
+	)
+	assert.Nil(t, err)
+	assert.Equal(t, statusComponent, configMap.Labels["component"])
+	assert.Equal(t, "0", configMap.Data["executions"])
+	assert.Equal(t, "2024-02-20T10:00:00Z", configMap.Data["updatedAt"])
+
+	incidentRegistry.Register("status-incident", Alert)
+	incidentRegistry.RecipeFailed("status-incident", "logs", errors.New("forbidden"))
+	assert.Nil(t, reporter.Sync(ctx, now.Add(StatusInterval)))
+	configMap, _ = client.CoreV1().ConfigMaps("euphrosyne").Get(
+		ctx, "euphrosyne-status", metav1.GetOptions{},
+	)
+	assert.Equal(t, "1", configMap.Data["executions"])
+	assert.Equal(t, "1", configMap.Data["failedExecutions"])
+
+	var status ReconcilerStatus
+	assert.Nil(t, json.Unmarshal([]byte(configMap.Data[statusReportKey]), &status))
+	assert.Equal(t, map[string]int{"logs": 1}, status.FailedRecipes)
+	assert.Equal(t, "status-incident", status.Recent[0].UUID)
+}
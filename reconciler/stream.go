@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// Number of events buffered for each stream, before a slow client is disconnected
+	streamBufferSize = 64
+	// Interval of the comments keeping idle streams from being closed by proxies
+	streamHeartbeatInterval = 15 * time.Second
+)
+
+// IncidentStreams fans out the events of incidents to the clients streaming their progress.
+type IncidentStreams struct {
+	mutex       sync.Mutex
+	subscribers map[string]map[chan AuditEvent]struct{}
+}
+
+var incidentStreams = NewIncidentStreams()
+
+// Create an empty set of incident streams.
+func NewIncidentStreams() *IncidentStreams {
+	return &IncidentStreams{subscribers: make(map[string]map[chan AuditEvent]struct{})}
+}
+
+// Subscribe to the events of an incident. The returned function must be called once the
+// subscriber is done with the stream.
+func (is *IncidentStreams) Subscribe(uuid string) (<-chan AuditEvent, func()) {
+	events := make(chan AuditEvent, streamBufferSize)
+	is.mutex.Lock()
+	if is.subscribers[uuid] == nil {
+		is.subscribers[uuid] = make(map[chan AuditEvent]struct{})
+	}
+	is.subscribers[uuid][events] = struct{}{}
+	is.mutex.Unlock()
+
+	return events, func() {
+		is.mutex.Lock()
+		defer is.mutex.Unlock()
+		is.removeLocked(uuid, events)
+	}
+}
+
+// Publish an event to the subscribers of its incident. Subscribers that fall behind have their
+// stream closed rather than blocking the reconciler, so that they can reconnect and catch up.
+func (is *IncidentStreams) Publish(event AuditEvent) {
+	is.mutex.Lock()
+	defer is.mutex.Unlock()
+	for events := range is.subscribers[event.Incident] {
+		select {
+		case events <- event:
+		default:
+			is.removeLocked(event.Incident, events)
+		}
+	}
+}
+
+// Remove a subscriber, closing its stream. The caller must hold the lock.
+func (is *IncidentStreams) removeLocked(uuid string, events chan AuditEvent) {
+	if _, ok := is.subscribers[uuid][events]; !ok {
+		return
+	}
+	delete(is.subscribers[uuid], events)
+	if len(is.subscribers[uuid]) == 0 {
+		delete(is.subscribers, uuid)
+	}
+	close(events)
+}
+
+// Check whether an incident has ended, so that no further events are streamed for it.
+func incidentEnded(state string) bool {
+	return state == IncidentStateCompleted || state == IncidentStateCancelled ||
+		state == IncidentStateFailed
+}
+
+// Handle a request to stream the progress of an incident as server-sent events. The stream
+// starts with a snapshot of the incident, followed by an event for each of its updates, and
+// ends once the incident is over.
+func handleIncidentStreamRequest(c *gin.Context) {
+	uuid := c.Param("uuid")
+	// Subscribe before taking the snapshot, so that no update is missed in between
+	events, unsubscribe := incidentStreams.Subscribe(uuid)
+	defer unsubscribe()
+
+	incident, ok := incidentRegistry.Get(uuid)
+	if !ok {
+		respondProblem(c, http.StatusNotFound, IncidentNotFoundProblem, "")
+		return
+	}
+	incidentStreamClients.Inc()
+	defer incidentStreamClients.Dec()
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.SSEvent("snapshot", incident)
+	c.Writer.Flush()
+	if incidentEnded(incident.State) {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return false
+			}
+			c.SSEvent(event.Action, event)
+			return event.Action != AuditIncidentCompleted &&
+				event.Action != AuditIncidentCancelled &&
+				event.Action != AuditIncidentFailed
+		case <-heartbeat.C:
+			_, err := fmt.Fprint(w, ": heartbeat\n\n")
+			return err == nil
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
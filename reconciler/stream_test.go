@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that events are delivered to the subscribers of their incident, and that subscribers
+// falling behind are disconnected.
+func TestIncidentStreams(t *testing.T) {
+	is := NewIncidentStreams()
+	events, unsubscribe := is.Subscribe("incident-1")
+	other, unsubscribeOther := is.Subscribe("incident-2")
+	defer unsubscribeOther()
+
+	is.Publish(AuditEvent{Action: AuditRecipeLaunched, Incident: "incident-1"})
+	assert.Equal(t, AuditRecipeLaunched, (<-events).Action)
+	assert.Empty(t, other)
+
+	for i := 0; i <= streamBufferSize; i++ {
+		is.Publish(AuditEvent{Action: AuditRecipeFinished, Incident: "incident-1"})
+	}
+	received := 0
+	for range events {
+		received++
+	}
+	assert.Equal(t, streamBufferSize, received)
+	// Unsubscribing from a closed stream is a no-op
+	unsubscribe()
+}
+
+// Read the names of the server-sent events of a stream until it ends.
+func readEventNames(t *testing.T, url string) []string {
+	resp, err := http.Get(url)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	var names []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if name, ok := strings.CutPrefix(scanner.Text(), "event:"); ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Test that the progress of an incident is streamed until it completes.
+func TestHandleIncidentStreamRequest(t *testing.T) {
+	registry := incidentRegistry
+	defer func() { incidentRegistry = registry }()
+	incidentRegistry = NewIncidentRegistry(MemoryIncidentStore, time.Hour)
+
+	router := gin.New()
+	router.GET("/incidents/:uuid/stream", handleIncidentStreamRequest)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/incidents/unknown/stream")
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	incidentRegistry.Register("incident-1", Alert)
+	streamed := make(chan []string)
+	go func() {
+		streamed <- readEventNames(t, server.URL+"/incidents/incident-1/stream")
+	}()
+	assert.Eventually(t, func() bool {
+		incidentStreams.mutex.Lock()
+		defer incidentStreams.mutex.Unlock()
+		return len(incidentStreams.subscribers["incident-1"]) > 0
+	}, time.Second, 10*time.Millisecond)
+
+	incidentRegistry.RecipeLaunched("incident-1", "test-recipe", "test-recipe-abcde", 1)
+	incidentRegistry.RecipeCompleted("incident-1", NewCompletedRecipe(NewRecipeExecution(
+		"test-recipe", "incident-1", RecipeStatusSuccessful, RecipeResults{},
+	)))
+	incidentRegistry.Complete("incident-1")
+	assert.Equal(t, []string{
+		"snapshot", AuditRecipeLaunched, AuditRecipeFinished, AuditIncidentCompleted,
+	}, <-streamed)
+
+	// Streams of completed incidents end after the snapshot
+	assert.Equal(
+		t, []string{"snapshot"}, readEventNames(t, server.URL+"/incidents/incident-1/stream"),
+	)
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// Time a subscription is kept open past the deadline of its execution, before it is torn down
+	subscriptionGrace = 5 * time.Minute
+	// Interval between the checks for stale subscriptions
+	subscriptionReapInterval = time.Minute
+)
+
+var errTooManySubscriptions = errors.New("Too many open result subscriptions")
+
+// SubscriptionRegistry keeps track of the open result subscriptions, capping their number and
+// tearing down the ones that outlive their execution, so that they cannot leak.
+type SubscriptionRegistry struct {
+	mutex         sync.Mutex
+	subscriptions map[*trackedSubscription]struct{}
+	// Maximum number of open subscriptions, 0 for no limit
+	limit int
+}
+
+// trackedSubscription is a result subscription registered with the subscription registry.
+type trackedSubscription struct {
+	ResultSubscription
+	registry *SubscriptionRegistry
+	uuid     string
+	openedAt time.Time
+	deadline time.Time
+	once     sync.Once
+	closed   chan struct{}
+	err      error
+}
+
+var subscriptionRegistry = NewSubscriptionRegistry(0)
+
+// Create a subscription registry allowing up to the given number of open subscriptions.
+func NewSubscriptionRegistry(limit int) *SubscriptionRegistry {
+	return &SubscriptionRegistry{
+		subscriptions: make(map[*trackedSubscription]struct{}),
+		limit:         limit,
+	}
+}
+
+// Subscribe to the results of an execution, which is expected to complete by the given deadline.
+// The subscription is torn down once the execution context is done, or once the deadline and its
+// grace period have passed, even if the execution never closes it.
+func (sr *SubscriptionRegistry) Subscribe(
+	ctx context.Context, uuid string, deadline time.Time,
+) (ResultSubscription, error) {
+	sr.mutex.Lock()
+	if sr.limit > 0 && len(sr.subscriptions) >= sr.limit {
+		sr.mutex.Unlock()
+		subscriptionsRejected.Inc()
+		return nil, errTooManySubscriptions
+	}
+	ts := &trackedSubscription{
+		registry: sr,
+		uuid:     uuid,
+		openedAt: time.Now(),
+		deadline: deadline,
+		closed:   make(chan struct{}),
+	}
+	// Reserve the slot before subscribing, so that concurrent subscriptions respect the limit
+	sr.subscriptions[ts] = struct{}{}
+	sr.mutex.Unlock()
+
+	sub, err := resultBroker.Subscribe(ctx, uuid)
+	if err != nil {
+		sr.remove(ts)
+		return nil, err
+	}
+	sr.mutex.Lock()
+	ts.ResultSubscription = sub
+	sr.mutex.Unlock()
+	openSubscriptions.Inc()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			ts.teardown("Execution ended")
+		case <-ts.closed:
+		}
+	}()
+	return ts, nil
+}
+
+// Remove a subscription from the registry.
+func (sr *SubscriptionRegistry) remove(ts *trackedSubscription) {
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+	delete(sr.subscriptions, ts)
+}
+
+// Return the number of open subscriptions.
+func (sr *SubscriptionRegistry) Len() int {
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+	return len(sr.subscriptions)
+}
+
+// Tear down the subscriptions that outlived the deadline of their execution, returning how many
+// were torn down, and record the age of the oldest subscription still open.
+func (sr *SubscriptionRegistry) Reap(now time.Time) int {
+	var stale []*trackedSubscription
+	var oldest time.Duration
+	sr.mutex.Lock()
+	for ts := range sr.subscriptions {
+		// Subscriptions that are still being opened are skipped
+		if ts.ResultSubscription == nil {
+			continue
+		}
+		if now.After(ts.deadline.Add(subscriptionGrace)) {
+			stale = append(stale, ts)
+		} else if age := now.Sub(ts.openedAt); age > oldest {
+			oldest = age
+		}
+	}
+	sr.mutex.Unlock()
+
+	for _, ts := range stale {
+		ts.teardown("Subscription outlived its execution")
+		subscriptionsReaped.Inc()
+	}
+	oldestSubscriptionAge.Set(oldest.Seconds())
+	return len(stale)
+}
+
+// Periodically tear down stale subscriptions, until the context is done.
+func (sr *SubscriptionRegistry) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			sr.Reap(now)
+		}
+	}
+}
+
+// Close the subscription, removing it from the registry. Closing it more than once is a no-op.
+func (ts *trackedSubscription) Close() error {
+	ts.once.Do(func() {
+		ts.err = ts.ResultSubscription.Close()
+		ts.registry.remove(ts)
+		openSubscriptions.Dec()
+		close(ts.closed)
+	})
+	return ts.err
+}
+
+// Force the subscription to close, if the execution has not closed it already.
+func (ts *trackedSubscription) teardown(reason string) {
+	select {
+	case <-ts.closed:
+		return
+	default:
+	}
+	logger.Warn(
+		"Tearing down result subscription",
+		zap.String("uuid", ts.uuid),
+		zap.String("reason", reason),
+		zap.Duration("age", time.Since(ts.openedAt)),
+	)
+	if err := ts.Close(); err != nil {
+		logger.Error("Failed to close result subscription", zap.Error(err))
+	}
+}
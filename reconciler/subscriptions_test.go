@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeBroker hands out subscriptions counting how many times they are closed.
+type fakeBroker struct {
+	closed map[string]int
+}
+
+type fakeSubscription struct {
+	broker *fakeBroker
+	uuid   string
+}
+
+func (b *fakeBroker) Subscribe(ctx context.Context, uuid string) (ResultSubscription, error) {
+	return &fakeSubscription{broker: b, uuid: uuid}, nil
+}
+
+func (b *fakeBroker) Topic(uuid string) string { return uuid }
+
+func (b *fakeBroker) Close() error { return nil }
+
+func (s *fakeSubscription) Messages() <-chan string { return nil }
+
+func (s *fakeSubscription) Close() error {
+	s.broker.closed[s.uuid]++
+	return nil
+}
+
+// Replace the result broker with a fake one for the duration of a test.
+func useFakeBroker(t *testing.T) *fakeBroker {
+	previous := resultBroker
+	t.Cleanup(func() { resultBroker = previous })
+	broker := &fakeBroker{closed: make(map[string]int)}
+	resultBroker = broker
+	return broker
+}
+
+// Test that the number of open subscriptions is capped, and that subscriptions are closed once.
+func TestSubscriptionRegistryLimit(t *testing.T) {
+	broker := useFakeBroker(t)
+	sr := NewSubscriptionRegistry(2)
+	deadline := time.Now().Add(time.Minute)
+
+	first, err := sr.Subscribe(context.Background(), "incident-1", deadline)
+	assert.Nil(t, err)
+	_, err = sr.Subscribe(context.Background(), "incident-2", deadline)
+	assert.Nil(t, err)
+	_, err = sr.Subscribe(context.Background(), "incident-3", deadline)
+	assert.ErrorIs(t, err, errTooManySubscriptions)
+
+	assert.Nil(t, first.Close())
+	assert.Nil(t, first.Close())
+	assert.Equal(t, 1, broker.closed["incident-1"])
+	assert.Equal(t, 1, sr.Len())
+	_, err = sr.Subscribe(context.Background(), "incident-3", deadline)
+	assert.Nil(t, err)
+}
+
+// Test that subscriptions are torn down once their execution ends, even if left open.
+func TestSubscriptionRegistryCancel(t *testing.T) {
+	broker := useFakeBroker(t)
+	sr := NewSubscriptionRegistry(0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err := sr.Subscribe(ctx, "incident-1", time.Now().Add(time.Minute))
+	assert.Nil(t, err)
+	cancel()
+	assert.Eventually(t, func() bool { return sr.Len() == 0 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1, broker.closed["incident-1"])
+}
+
+// Test that subscriptions outliving the deadline of their execution are reaped.
+func TestSubscriptionRegistryReap(t *testing.T) {
+	broker := useFakeBroker(t)
+	sr := NewSubscriptionRegistry(0)
+	now := time.Now()
+
+	_, err := sr.Subscribe(context.Background(), "stale", now.Add(-time.Hour))
+	assert.Nil(t, err)
+	_, err = sr.Subscribe(context.Background(), "active", now.Add(time.Minute))
+	assert.Nil(t, err)
+
+	// Subscriptions are only reaped once the grace period has passed
+	assert.Equal(t, 0, sr.Reap(now.Add(-time.Hour+subscriptionGrace)))
+	assert.Equal(t, 1, sr.Reap(now))
+	assert.Equal(t, map[string]int{"stale": 1}, broker.closed)
+	assert.Equal(t, 1, sr.Len())
+}
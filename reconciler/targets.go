@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// RecipeTarget is the cluster and namespace the Jobs of a recipe run in.
+type RecipeTarget struct {
+	// Name of the cluster, empty for the cluster of the reconciler
+	Cluster   string `json:"cluster,omitempty"`
+	Namespace string `json:"namespace"`
+}
+
+func (t RecipeTarget) String() string {
+	if t.Cluster == "" {
+		return t.Namespace
+	}
+	return t.Cluster + "/" + t.Namespace
+}
+
+// Clients of the additional clusters recipes can run in, by cluster name.
+var clusterClients = make(map[string]kubernetes.Interface)
+
+// Parse a comma-separated list of clusters into the kubeconfig context of each cluster.
+func parseClusters(clusters string) (map[string]string, error) {
+	contexts := make(map[string]string)
+	for _, cluster := range strings.Split(clusters, ",") {
+		cluster = strings.TrimSpace(cluster)
+		if cluster == "" {
+			continue
+		}
+		name, kubeContext, ok := strings.Cut(cluster, "=")
+		if !ok || name == "" || kubeContext == "" {
+			return nil, fmt.Errorf("Invalid cluster '%s', expected <name>=<context>", cluster)
+		}
+		contexts[name] = kubeContext
+	}
+	return contexts, nil
+}
+
+// Initialise a client for each of the configured clusters, from the contexts of the kubeconfig.
+func InitialiseClusterClients(config *Config) error {
+	clusters, err := parseClusters(config.Clusters)
+	if err != nil {
+		return err
+	}
+	kubeconfig := config.Kubeconfig
+	if kubeconfig == "" {
+		kubeconfig = getKubeconfigPath()
+	}
+	for name, kubeContext := range clusters {
+		restConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+			&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeconfig},
+			&clientcmd.ConfigOverrides{CurrentContext: kubeContext},
+		).ClientConfig()
+		if err != nil {
+			return fmt.Errorf("Cluster '%s': %w", name, err)
+		}
+		client, err := kubernetes.NewForConfig(restConfig)
+		if err != nil {
+			return fmt.Errorf("Cluster '%s': %w", name, err)
+		}
+		clusterClients[name] = client
+		logger.Info(
+			"Initialised client for recipe cluster",
+			zap.String("cluster", name),
+			zap.String("context", kubeContext),
+		)
+	}
+	return nil
+}
+
+// Return the client of a cluster, the cluster of the reconciler being the unnamed one.
+func clientsetFor(cluster string) (kubernetes.Interface, error) {
+	if cluster == "" {
+		return clientset, nil
+	}
+	client, ok := clusterClients[cluster]
+	if !ok {
+		return nil, fmt.Errorf("Unknown cluster '%s'", cluster)
+	}
+	return client, nil
+}
+
+// Check that the namespaces of the recipes are valid namespace names.
+func validateRecipeTargets(recipes map[string]RecipeConfig) error {
+	for recipeName, recipeConfig := range recipes {
+		if recipeConfig.Namespace == "" {
+			continue
+		}
+		if errs := validation.IsDNS1123Label(recipeConfig.Namespace); len(errs) > 0 {
+			return fmt.Errorf(
+				"Recipe '%s' has an invalid namespace '%s': %s",
+				recipeName, recipeConfig.Namespace, strings.Join(errs, ", "),
+			)
+		}
+	}
+	return nil
+}
+
+// Return the target of a recipe, which defaults to the recipe namespace of the local cluster.
+func recipeTarget(recipeConfig *RecipeConfig, config *Config) RecipeTarget {
+	target := RecipeTarget{Namespace: config.RecipeNamespace}
+	if recipeConfig == nil {
+		return target
+	}
+	target.Cluster = recipeConfig.Cluster
+	if recipeConfig.Namespace != "" {
+		target.Namespace = recipeConfig.Namespace
+	}
+	return target
+}
+
+// Return the distinct targets of a set of recipes, including the default target, in a stable
+// order.
+func recipeTargets(recipes map[string]Recipe, config *Config) []RecipeTarget {
+	seen := map[RecipeTarget]bool{recipeTarget(nil, config): true}
+	targets := []RecipeTarget{recipeTarget(nil, config)}
+	for _, recipe := range recipes {
+		target := recipeTarget(recipe.Config, config)
+		if !seen[target] {
+			seen[target] = true
+			targets = append(targets, target)
+		}
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		return targets[i].String() < targets[j].String()
+	})
+	return targets
+}
+
+// Return the targets of all the recipes of the loaded catalog, for the operations that are not
+// tied to a running execution, e.g. cancelling an incident.
+func catalogTargets(config *Config) []RecipeTarget {
+	catalogMutex.RLock()
+	rc := catalog
+	catalogMutex.RUnlock()
+
+	recipes := make(map[string]Recipe)
+	if rc != nil {
+		recipes = rc.Recipes(Alert, false)
+		for recipeName, recipe := range rc.Recipes(Actions, false) {
+			recipes["actions/"+recipeName] = recipe
+		}
+	}
+	// Requests may override the namespace of the recipes that do not set their own
+	for _, namespace := range overrideNamespaces(config) {
+		recipes["overrides/"+namespace] = Recipe{Config: &RecipeConfig{Namespace: namespace}}
+	}
+	return recipeTargets(recipes, config)
+}
+
+// Return the target of a recipe of the execution.
+func (r *Reconciler) recipeTarget(recipeName string) RecipeTarget {
+	return recipeTarget(r.recipes[recipeName].Config, r.config)
+}
+
+// Return the targets of the recipes of the execution.
+func (r *Reconciler) targets() []RecipeTarget {
+	return recipeTargets(r.recipes, r.config)
+}
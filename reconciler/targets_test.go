@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test the parsing of the additional clusters recipes can run in.
+func TestParseClusters(t *testing.T) {
+	clusters, err := parseClusters("eu-west=prod-eu, us-east=prod-us,")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"eu-west": "prod-eu", "us-east": "prod-us"}, clusters)
+
+	_, err = parseClusters("eu-west")
+	assert.ErrorContains(t, err, "Invalid cluster 'eu-west', expected <name>=<context>")
+}
+
+// Test that recipes run in their own target, defaulting to the recipe namespace of the local
+// cluster.
+func TestRecipeTarget(t *testing.T) {
+	config := &Config{RecipeNamespace: "euphrosyne"}
+	testCases := []struct {
+		name     string
+		recipe   *RecipeConfig
+		expected RecipeTarget
+	}{
+		{"Default", &RecipeConfig{}, RecipeTarget{Namespace: "euphrosyne"}},
+		{"Namespace", &RecipeConfig{Namespace: "payments"}, RecipeTarget{Namespace: "payments"}},
+		{
+			"Cluster",
+			&RecipeConfig{Cluster: "eu-west"},
+			RecipeTarget{Cluster: "eu-west", Namespace: "euphrosyne"},
+		},
+		{
+			"ClusterNamespace",
+			&RecipeConfig{Cluster: "eu-west", Namespace: "payments"},
+			RecipeTarget{Cluster: "eu-west", Namespace: "payments"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, recipeTarget(tc.recipe, config))
+		})
+	}
+}
+
+// Test that the targets of an execution are listed once each, along with the default target.
+func TestRecipeTargets(t *testing.T) {
+	config := &Config{RecipeNamespace: "euphrosyne"}
+	targets := recipeTargets(map[string]Recipe{
+		"logs":      {Config: &RecipeConfig{}},
+		"heap-dump": {Config: &RecipeConfig{Namespace: "payments"}},
+		"traces":    {Config: &RecipeConfig{Namespace: "payments"}},
+		"pods":      {Config: &RecipeConfig{Cluster: "eu-west", Namespace: "payments"}},
+	}, config)
+	assert.Equal(t, []RecipeTarget{
+		{Cluster: "eu-west", Namespace: "payments"},
+		{Namespace: "euphrosyne"},
+		{Namespace: "payments"},
+	}, targets)
+	assert.Equal(t, "eu-west/payments", targets[0].String())
+	assert.Equal(t, []RecipeTarget{{Namespace: "euphrosyne"}}, recipeTargets(nil, config))
+}
+
+// Test the validation of the namespaces of recipes.
+func TestValidateRecipeTargets(t *testing.T) {
+	assert.Nil(t, validateRecipeTargets(map[string]RecipeConfig{
+		"logs":      {},
+		"heap-dump": {Namespace: "payments"},
+	}))
+	assert.ErrorContains(t, validateRecipeTargets(map[string]RecipeConfig{
+		"heap-dump": {Namespace: "Payments_Prod"},
+	}), "Recipe 'heap-dump' has an invalid namespace 'Payments_Prod'")
+}
+
+// Test that recipes targeting an unknown cluster cannot be launched.
+func TestClientsetForUnknownCluster(t *testing.T) {
+	_, err := clientsetFor("eu-west")
+	assert.ErrorContains(t, err, "Unknown cluster 'eu-west'")
+}
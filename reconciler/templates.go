@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"text/template"
+
+	"github.com/Masterminds/sprig/v3"
+	"go.uber.org/zap"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	templatesConfigMapName = "euphrosyne-templates"
+)
+
+// Destinations of outbound messages that support templating.
+const (
+	WebexAnalysisDestination = "webex-analysis"
+	WebexStatusDestination   = "webex-status"
+	ApprovalDestination      = "approval"
+)
+
+// Sample messages for each supported destination, used to validate templates when loaded.
+var messageDestinations = map[string]func() interface{}{
+	WebexAnalysisDestination: func() interface{} { return IncidentBotMessage{} },
+	WebexStatusDestination:   func() interface{} { return []JobStatus{} },
+	ApprovalDestination:      func() interface{} { return &Approval{} },
+	SlackSinkDestination:     func() interface{} { return IncidentBotMessage{} },
+	JiraSinkDestination:      func() interface{} { return IncidentBotMessage{} },
+	WebhookSinkDestination:   func() interface{} { return IncidentBotMessage{} },
+}
+
+// TemplateContext is the data available to message templates.
+type TemplateContext struct {
+	Message  interface{}
+	Incident *Incident
+}
+
+// MessageTemplates holds the per-destination templates for outbound messages.
+type MessageTemplates struct {
+	mutex     sync.RWMutex
+	templates map[string]*template.Template
+}
+
+var messageTemplates = &MessageTemplates{templates: make(map[string]*template.Template)}
+
+// Return the functions available to templates, i.e. the sprig functions besides the ones reaching
+// outside of the process. Templates may be supplied by API callers, so they must not read the
+// environment of the Reconciler, which holds its secrets, nor resolve hosts.
+func templateFuncs() template.FuncMap {
+	funcs := sprig.TxtFuncMap()
+	for _, name := range []string{"env", "expandenv", "getHostByName"} {
+		delete(funcs, name)
+	}
+	return funcs
+}
+
+// Parse and validate a template for the specified destination.
+func parseMessageTemplate(destination string, text string) (*template.Template, error) {
+	sample, ok := messageDestinations[destination]
+	if !ok {
+		return nil, fmt.Errorf("Unknown message destination '%s'", destination)
+	}
+
+	tmpl, err := template.New(destination).
+		Option("missingkey=error").
+		Funcs(templateFuncs()).
+		Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	// Render the template against an empty message to catch references to unknown fields
+	_, err = renderTemplate(tmpl, TemplateContext{Message: sample(), Incident: &Incident{}})
+	if err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// Parse and validate the templates for all destinations, reporting every invalid template.
+func parseMessageTemplates(data map[string]string) (map[string]*template.Template, error) {
+	destinations := make([]string, 0, len(data))
+	for destination := range data {
+		destinations = append(destinations, destination)
+	}
+	sort.Strings(destinations)
+
+	templates := make(map[string]*template.Template)
+	var errs []error
+	for _, destination := range destinations {
+		tmpl, err := parseMessageTemplate(destination, data[destination])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("Invalid template for '%s': %w", destination, err))
+			continue
+		}
+		templates[destination] = tmpl
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return templates, nil
+}
+
+// Load the message templates from the templates ConfigMap in the specified namespace. The
+// ConfigMap is optional; if it doesn't exist, messages are sent in their default JSON format.
+func LoadMessageTemplates(namespace string) error {
+	data := map[string]string{}
+	configMap, err := clientset.CoreV1().ConfigMaps(namespace).Get(
+		context.TODO(), templatesConfigMapName, metav1.GetOptions{},
+	)
+	if err == nil {
+		data = configMap.Data
+	} else if !k8serrors.IsNotFound(err) {
+		return err
+	}
+
+	templates, err := parseMessageTemplates(data)
+	configStatus.Record(TemplatesConfigSource, err)
+	if err != nil {
+		return err
+	}
+
+	messageTemplates.mutex.Lock()
+	messageTemplates.templates = templates
+	messageTemplates.mutex.Unlock()
+
+	logger.Info("Message templates loaded", zap.Int("count", len(templates)))
+	return nil
+}
+
+// Return the template configured for a destination, if any.
+func (mt *MessageTemplates) Get(destination string) (*template.Template, bool) {
+	mt.mutex.RLock()
+	defer mt.mutex.RUnlock()
+	tmpl, ok := mt.templates[destination]
+	return tmpl, ok
+}
+
+// Render a template, ensuring that the output is valid JSON.
+func renderTemplate(tmpl *template.Template, ctx TemplateContext) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, ctx); err != nil {
+		return nil, err
+	}
+	if buf.Len() > 0 && !json.Valid(buf.Bytes()) {
+		return nil, fmt.Errorf("Template output is not valid JSON")
+	}
+	return buf.Bytes(), nil
+}
+
+// Render an outbound message for a destination, using the configured template if one exists or
+// the default JSON representation of the message otherwise.
+func renderMessage(destination string, message interface{}, incident *Incident) ([]byte, error) {
+	tmpl, ok := messageTemplates.Get(destination)
+	if !ok {
+		return json.Marshal(message)
+	}
+	if incident == nil {
+		incident = &Incident{}
+	}
+	return renderTemplate(tmpl, TemplateContext{Message: message, Incident: incident})
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that message templates are validated when loaded.
+func TestParseMessageTemplates(t *testing.T) {
+	testCases := []struct {
+		name        string
+		data        map[string]string
+		expectError bool
+	}{
+		{
+			name: "ValidTemplates",
+			data: map[string]string{
+				WebexAnalysisDestination: `{"text": {{ .Message.Analysis | toJson }}}`,
+				WebexStatusDestination:   `{"jobs": {{ len .Message }}}`,
+			},
+		},
+		{
+			name:        "UnknownDestination",
+			data:        map[string]string{"unknown": `{}`},
+			expectError: true,
+		},
+		{
+			name:        "InvalidSyntax",
+			data:        map[string]string{WebexAnalysisDestination: `{{ .Message.Analysis `},
+			expectError: true,
+		},
+		{
+			name:        "UnknownField",
+			data:        map[string]string{WebexAnalysisDestination: `{{ .Message.Unknown }}`},
+			expectError: true,
+		},
+		{
+			name: "EnvironmentFunction",
+			data: map[string]string{
+				WebexAnalysisDestination: `{"text": {{ env "ADMIN_TOKEN" | toJson }}}`,
+			},
+			expectError: true,
+		},
+		{
+			name:        "InvalidJSON",
+			data:        map[string]string{WebexAnalysisDestination: `{"text": }`},
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			templates, err := parseMessageTemplates(tc.data)
+			if tc.expectError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, len(tc.data), len(templates))
+		})
+	}
+
+	// Templates may be previewed by API callers, so they cannot read the environment
+	_, err := parseMessageTemplate(WebexAnalysisDestination, `{{ env "ADMIN_TOKEN" }}`)
+	assert.ErrorContains(t, err, `function "env" not defined`)
+}
+
+// Test that messages are rendered with the configured template, or as plain JSON otherwise.
+func TestRenderMessage(t *testing.T) {
+	message := IncidentBotMessage{
+		UUID: "123", Analysis: "All good", Actions: []string{"jira"}, Actionable: true,
+	}
+
+	messageTemplates.templates = nil
+	rendered, err := renderMessage(WebexAnalysisDestination, message, nil)
+	assert.NoError(t, err)
+	assert.JSONEq(
+		t, `{"uuid": "123", "analysis": "All good", "actions": ["jira"], "actionable": true}`,
+		string(rendered),
+	)
+
+	templates, err := parseMessageTemplates(map[string]string{
+		WebexAnalysisDestination: `{"text": "{{ .Message.Analysis | upper }}", ` +
+			`"actions": {{ .Message.Actions | join "," | quote }}}`,
+	})
+	assert.NoError(t, err)
+	messageTemplates.templates = templates
+	defer func() { messageTemplates.templates = nil }()
+
+	rendered, err = renderMessage(WebexAnalysisDestination, message, nil)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"text": "ALL GOOD", "actions": "jira"}`, string(rendered))
+}
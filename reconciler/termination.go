@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Time to wait for the results of a completed recipe Job to arrive through the result broker,
+// before falling back to its termination message.
+var resultGracePeriod = 10 * time.Second
+
+// Collect the results of a recipe whose Job completed without its results being received through
+// the result broker, e.g. because Redis was unavailable. The recipe SDK also writes the results to
+// the termination message of the recipe container, which is read instead.
+func (r *Reconciler) collectTerminationMessage(recipeName string, job *batchv1.Job) {
+	if job.Status.CompletionTime != nil &&
+		time.Since(job.Status.CompletionTime.Time) < resultGracePeriod {
+		return
+	}
+
+	ctx, cancel := r.requestContext()
+	message, err := getTerminationMessage(ctx, r.recipeTarget(recipeName).Cluster, job)
+	cancel()
+	if err != nil {
+		logger.Error(
+			"Failed to read recipe termination message",
+			zap.String("recipe", recipeName),
+			zap.String("jobName", job.Name),
+			zap.Error(err),
+		)
+		return
+	}
+	if message == "" {
+		r.finished[recipeName] = true
+		incidentRegistry.RecipeJobFinished(
+			r.uuid, recipeName, RecipeStateCompleted,
+			"Recipe Job completed but its results were not received",
+		)
+		return
+	}
+
+	recipe, err := r.parseRecipeResults(message)
+	if err == nil && recipe.Execution.Name != recipeName {
+		err = &RecipeResultsError{
+			Recipe: recipeName,
+			Err:    fmt.Errorf("Results published for recipe '%s'", recipe.Execution.Name),
+		}
+	}
+	if err != nil {
+		logger.Error(
+			"Failed to parse recipe termination message",
+			zap.String("recipe", recipeName),
+			zap.String("message", message),
+			zap.Error(err),
+		)
+		observeRejectedResults(err)
+		r.finished[recipeName] = true
+		incidentRegistry.RecipeJobFinished(
+			r.uuid, recipeName, RecipeStateFailed,
+			fmt.Sprintf("Recipe Job completed but its results are invalid: %s", err),
+		)
+		return
+	}
+
+	logger.Warn(
+		"Recipe results not received through the result broker, using termination message",
+		zap.String("uuid", r.uuid),
+		zap.String("recipe", recipeName),
+	)
+	recipeResultFallbacks.WithLabelValues(recipeLabel(recipeName)).Inc()
+	r.completeRecipe(recipe)
+}
+
+// Read the termination message of the recipe container from the successful Pod of a Job.
+func getTerminationMessage(
+	ctx context.Context, cluster string, job *batchv1.Job,
+) (string, error) {
+	client, err := clientsetFor(cluster)
+	if err != nil {
+		return "", err
+	}
+	labelSelector := metav1.FormatLabelSelector(&metav1.LabelSelector{
+		MatchLabels: map[string]string{"job-name": job.Name},
+	})
+	podList, err := client.CoreV1().Pods(job.Namespace).List(
+		ctx, metav1.ListOptions{LabelSelector: labelSelector},
+	)
+	if err != nil {
+		return "", err
+	}
+
+	for _, pod := range podList.Items {
+		if pod.Status.Phase != corev1.PodSucceeded {
+			continue
+		}
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.State.Terminated != nil && status.State.Terminated.Message != "" {
+				return status.State.Terminated.Message, nil
+			}
+		}
+	}
+	return "", nil
+}
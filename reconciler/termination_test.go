@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const terminationNamespace = "termination-test"
+
+// closedSubscription is a result subscription whose broker went away.
+type closedSubscription struct {
+	messages chan string
+}
+
+func newClosedSubscription() *closedSubscription {
+	s := &closedSubscription{messages: make(chan string)}
+	close(s.messages)
+	return s
+}
+
+func (s *closedSubscription) Messages() <-chan string { return s.messages }
+
+func (s *closedSubscription) Close() error { return nil }
+
+// Replace the Kubernetes client with a fake one serving a completed recipe Job, whose Pod wrote the
+// provided termination message.
+func useTerminatedJob(
+	t *testing.T, uuid string, message string, completedAt time.Time,
+) *batchv1.Job {
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-1-recipe-abcde",
+			Namespace: terminationNamespace,
+			Labels:    map[string]string{"app": "euphrosyne", "uuid": uuid},
+		},
+		Status: batchv1.JobStatus{
+			Succeeded:      1,
+			CompletionTime: &metav1.Time{Time: completedAt},
+		},
+	}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-1-recipe-abcde-xyz",
+			Namespace: terminationNamespace,
+			Labels:    map[string]string{"job-name": job.Name},
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodSucceeded,
+			ContainerStatuses: []corev1.ContainerStatus{{
+				State: corev1.ContainerState{
+					Terminated: &corev1.ContainerStateTerminated{Message: message},
+				},
+			}},
+		},
+	}
+
+	previous := clientset
+	t.Cleanup(func() { clientset = previous })
+	clientset = fake.NewSimpleClientset(job, pod)
+	return job
+}
+
+func newTerminationReconciler(uuid string) *Reconciler {
+	incidentRegistry.Register(uuid, Alert)
+	data := map[string]interface{}{"uuid": uuid}
+	return &Reconciler{
+		uuid:        uuid,
+		config:      &Config{RecipeNamespace: terminationNamespace},
+		data:        &data,
+		requestType: Alert,
+		recipes:     map[string]Recipe{"test-1-recipe": {}},
+		jobs: map[string]*recipeJob{
+			"test-1-recipe": {jobName: "test-1-recipe-abcde", attempts: 1},
+		},
+		finished:  map[string]bool{},
+		completed: map[string]bool{},
+		waiting:   map[string]map[string]interface{}{},
+		remote:    map[string]*remoteExecution{},
+	}
+}
+
+// Test that the results of a completed recipe are read from its termination message.
+func TestCollectTerminationMessage(t *testing.T) {
+	uuid := "termination-1"
+	job := useTerminatedJob(
+		t, uuid,
+		`{"name": "test-1-recipe", "status": "successful", "results": {"analysis": "ok"}}`,
+		time.Now().Add(-time.Minute),
+	)
+	message, err := getTerminationMessage(context.Background(), "", job)
+	assert.Nil(t, err)
+	assert.Contains(t, message, "test-1-recipe")
+
+	r := newTerminationReconciler(uuid)
+	r.collectTerminationMessage("test-1-recipe", job)
+	assert.True(t, r.completed["test-1-recipe"])
+	assert.Equal(t, "ok", r.recipes["test-1-recipe"].Execution.Results.Analysis)
+	assert.Equal(t, 1, r.recipes["test-1-recipe"].Attempts)
+}
+
+// Test that results are awaited from the result broker for a while after the Job completes.
+func TestCollectTerminationMessageGracePeriod(t *testing.T) {
+	uuid := "termination-2"
+	job := useTerminatedJob(
+		t, uuid,
+		`{"name": "test-1-recipe", "status": "successful", "results": {"analysis": "ok"}}`,
+		time.Now(),
+	)
+
+	r := newTerminationReconciler(uuid)
+	r.collectTerminationMessage("test-1-recipe", job)
+	assert.Empty(t, r.completed)
+	assert.Empty(t, r.finished)
+
+	previous := resultGracePeriod
+	defer func() { resultGracePeriod = previous }()
+	resultGracePeriod = 0
+	r.collectTerminationMessage("test-1-recipe", job)
+	assert.True(t, r.completed["test-1-recipe"])
+}
+
+// Test that recipes whose results were neither published nor written on termination are finished.
+func TestCollectMissingTerminationMessage(t *testing.T) {
+	uuid := "termination-3"
+	job := useTerminatedJob(t, uuid, "", time.Now().Add(-time.Minute))
+
+	r := newTerminationReconciler(uuid)
+	r.collectTerminationMessage("test-1-recipe", job)
+	assert.Empty(t, r.completed)
+	assert.True(t, r.finished["test-1-recipe"])
+	incident, _ := incidentRegistry.Get(uuid)
+	assert.Equal(t, RecipeStateCompleted, incident.Recipes["test-1-recipe"].State)
+}
+
+// Test that results are still collected from the recipe Jobs once the result subscription closes.
+func TestCollectRecipeResultSubscriptionClosed(t *testing.T) {
+	uuid := "termination-4"
+	useTerminatedJob(
+		t, uuid,
+		`{"name": "test-1-recipe", "status": "successful", "results": {"analysis": "ok"}}`,
+		time.Now().Add(-time.Minute),
+	)
+	previous := jobPollInterval
+	defer func() { jobPollInterval = previous }()
+	jobPollInterval = 10 * time.Millisecond
+
+	r := newTerminationReconciler(uuid)
+	r.results = newClosedSubscription()
+	r.deadline = time.Now().Add(5 * time.Second)
+	completedRecipes, err := collectRecipeResult(r)
+	assert.Nil(t, err)
+	assert.Len(t, completedRecipes, 1)
+	assert.Equal(t, "ok", completedRecipes[0].Execution.Results.Analysis)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Name of the service and instrumentation scope of the reconciler's spans.
+const tracingServiceName = "euphrosyne-reconciler"
+
+// Tracer of the reconciler, a no-op until tracing is initialised.
+var tracer = otel.Tracer(tracingServiceName)
+
+// Initialise tracing, exporting spans to the configured OTLP endpoint. The returned function
+// flushes the pending spans on shutdown. Trace context is propagated even if tracing is disabled,
+// so that recipe Jobs can continue the traces of their callers.
+func initTracing(config *Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{},
+	))
+	if config.OTelEndpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(
+		context.Background(), otlptracehttp.WithEndpointURL(config.OTelEndpoint),
+	)
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(
+			resource.NewSchemaless(semconv.ServiceName(tracingServiceName)),
+		),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Validate the endpoint traces are exported to.
+func validateOTelEndpoint(endpoint string) error {
+	if endpoint == "" {
+		return nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("Invalid OpenTelemetry endpoint '%s'", endpoint)
+	}
+	return nil
+}
+
+// Middleware starting a span for each request, continuing the trace of the caller, if any.
+func traceRequests() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := otel.GetTextMapPropagator().Extract(
+			c.Request.Context(), propagation.HeaderCarrier(c.Request.Header),
+		)
+		ctx, span := tracer.Start(
+			ctx, c.Request.Method+" "+c.FullPath(),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(c.Request.Method),
+				semconv.HTTPRoute(c.FullPath()),
+			),
+		)
+		defer span.End()
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+		if status >= 500 {
+			span.SetStatus(codes.Error, fmt.Sprintf("Request failed with status %d", status))
+		}
+	}
+}
+
+// Record an error on a span, marking it as failed.
+func recordSpanError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// Pass the trace context to a recipe container through the TRACEPARENT and TRACESTATE
+// environment variables, so that the recipe can continue the trace.
+func injectTraceContext(ctx context.Context, container *corev1.Container) {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	for _, key := range []string{"traceparent", "tracestate"} {
+		if value := carrier.Get(key); value != "" {
+			container.Env = append(
+				container.Env, corev1.EnvVar{Name: strings.ToUpper(key), Value: value},
+			)
+		}
+	}
+}
+
+// Attributes identifying the recipe of a span.
+func recipeSpanAttributes(uuid string, recipeName string) trace.SpanStartOption {
+	return trace.WithAttributes(
+		attribute.String("euphrosyne.incident", uuid),
+		attribute.String("euphrosyne.recipe", recipeName),
+	)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const testTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+// Record the spans of the reconciler for the duration of a test.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previousTracer := tracer
+	tracer = provider.Tracer(tracingServiceName)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { tracer = previousTracer })
+	return recorder
+}
+
+// Test that the endpoint traces are exported to is validated.
+func TestValidateOTelEndpoint(t *testing.T) {
+	testCases := []struct {
+		endpoint string
+		valid    bool
+	}{
+		{endpoint: "", valid: true},
+		{endpoint: "http://otel-collector:4318", valid: true},
+		{endpoint: "https://otel.example.com/v1/traces", valid: true},
+		{endpoint: "otel-collector:4318"},
+		{endpoint: "grpc://otel-collector:4317"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.endpoint, func(t *testing.T) {
+			err := validateOTelEndpoint(tc.endpoint)
+			if tc.valid {
+				assert.Nil(t, err)
+			} else {
+				assert.NotNil(t, err)
+			}
+		})
+	}
+}
+
+// Test that requests are traced, continuing the trace of the caller.
+func TestTraceRequests(t *testing.T) {
+	recorder := recordSpans(t)
+
+	router := gin.New()
+	router.Use(traceRequests())
+	router.POST("/webhook", func(c *gin.Context) {
+		assert.True(t, trace.SpanContextFromContext(c.Request.Context()).IsValid())
+		c.Status(http.StatusOK)
+	})
+	req := httptest.NewRequest(http.MethodPost, "/webhook", nil)
+	req.Header.Set("traceparent", testTraceparent)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "POST /webhook", spans[0].Name())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].Parent().TraceID().String())
+	assert.Contains(t, spans[0].Attributes(), semconv.HTTPResponseStatusCode(http.StatusOK))
+}
+
+// Test that the trace context is passed to recipe containers through environment variables.
+func TestInjectTraceContext(t *testing.T) {
+	recordSpans(t)
+	ctx := otel.GetTextMapPropagator().Extract(
+		context.Background(), propagation.MapCarrier{"traceparent": testTraceparent},
+	)
+
+	container := corev1.Container{}
+	injectTraceContext(ctx, &container)
+	assert.Equal(
+		t, []corev1.EnvVar{{Name: "TRACEPARENT", Value: testTraceparent}}, container.Env,
+	)
+
+	// Nothing is passed without a trace
+	container = corev1.Container{}
+	injectTraceContext(context.Background(), &container)
+	assert.Empty(t, container.Env)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"text/template"
+
+	"go.uber.org/zap"
+	"sigs.k8s.io/yaml"
+)
+
+// transformedResults are the results rendered by the transformation of a recipe. Fields left out
+// keep the value reported by the recipe.
+type transformedResults struct {
+	Analysis *string  `json:"analysis"`
+	Actions  []string `json:"actions"`
+	Links    []string `json:"links"`
+	// Whether the results call for action, overriding the flag reported by the recipe
+	Actionable *bool `json:"actionable"`
+	// Free-form results, replacing the ones encoded by the recipe
+	JSON json.RawMessage `json:"json"`
+}
+
+// Parse the transformation of the results of a recipe. Like parameters, transformations are
+// rendered in strict mode, so that a reference to a missing field leaves the results untouched.
+func parseRecipeTransform(name string, text string) (*template.Template, error) {
+	return template.New(name).
+		Option("missingkey=error").
+		Funcs(templateFuncs()).
+		Parse(text)
+}
+
+// Check that the transformations of the recipes are valid templates.
+func validateRecipeTransforms(recipes map[string]RecipeConfig) error {
+	for recipeName, recipeConfig := range recipes {
+		if recipeConfig.Transform == "" {
+			continue
+		}
+		if _, err := parseRecipeTransform(recipeName, recipeConfig.Transform); err != nil {
+			return fmt.Errorf("Recipe '%s' has an invalid transform: %w", recipeName, err)
+		}
+	}
+	return nil
+}
+
+// Render the transformation of a recipe against its results, returning the transformed results.
+// The template renders a YAML or JSON document holding any of the `analysis`, `actions`, `links`,
+// `actionable` and `json` fields. The results are available to the template as `.analysis`,
+// `.actions`, `.links` and `.actionable`, along with the decoded free-form results as `.json` and
+// their raw encoding as `.raw`, the status of the recipe as `.status`, and the alert, its labels
+// and the execution ID as for the parameters of the recipe.
+func transformRecipeResults(
+	transform string, execution *RecipeExecution, data map[string]interface{},
+) (RecipeResults, error) {
+	results := execution.Results
+	tmpl, err := parseRecipeTransform(execution.Name, transform)
+	if err != nil {
+		return results, err
+	}
+
+	var decoded interface{}
+	if results.JSON != "" {
+		if err := json.Unmarshal([]byte(results.JSON), &decoded); err != nil {
+			return results, fmt.Errorf("Failed to decode the results: %w", err)
+		}
+	}
+	context := map[string]interface{}{
+		"recipe":     execution.Name,
+		"status":     execution.Status,
+		"analysis":   results.Analysis,
+		"actions":    results.Actions,
+		"links":      results.Links,
+		"actionable": results.IsActionable(),
+		"json":       decoded,
+		"raw":        results.JSON,
+		"alert":      data,
+		"labels":     alertLabels(data),
+		"uuid":       data["uuid"],
+	}
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, context); err != nil {
+		return results, err
+	}
+
+	var transformed transformedResults
+	if err := yaml.Unmarshal(rendered.Bytes(), &transformed); err != nil {
+		return results, fmt.Errorf("Invalid transformed results: %w", err)
+	}
+	if transformed.Analysis != nil {
+		results.Analysis = *transformed.Analysis
+	}
+	if transformed.Actions != nil {
+		results.Actions = transformed.Actions
+	}
+	if transformed.Links != nil {
+		results.Links = transformed.Links
+	}
+	if transformed.Actionable != nil {
+		results.Actionable = transformed.Actionable
+	}
+	if len(transformed.JSON) > 0 && string(transformed.JSON) != "null" {
+		results.JSON = string(transformed.JSON)
+	}
+	return results, nil
+}
+
+// Apply the transformation of a recipe to its results, if it has one. The results are kept as
+// reported by the recipe if the transformation fails.
+func (r *Reconciler) transformResults(recipe Recipe) Recipe {
+	if recipe.Config == nil || recipe.Config.Transform == "" || recipe.Execution == nil {
+		return recipe
+	}
+	var data map[string]interface{}
+	if r.data != nil {
+		data = *r.data
+	}
+	results, err := transformRecipeResults(recipe.Config.Transform, recipe.Execution, data)
+	if err != nil {
+		logger.Warn(
+			"Failed to transform recipe results, keeping them as reported",
+			zap.String("uuid", r.uuid),
+			zap.String("recipe", recipe.Execution.Name),
+			zap.Error(err),
+		)
+		resultTransformFailures.WithLabelValues(recipeLabel(recipe.Execution.Name)).Inc()
+		return recipe
+	}
+	execution := *recipe.Execution
+	execution.Results = results
+	recipe.Execution = &execution
+	return recipe
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that invalid transformations are rejected when the catalog is loaded.
+func TestValidateRecipeTransforms(t *testing.T) {
+	valid := map[string]RecipeConfig{
+		"disk-usage": {Transform: `json: {"used": {{ .json.used }}}`},
+		"pod-logs":   {},
+	}
+	assert.Nil(t, validateRecipeTransforms(valid))
+
+	invalid := map[string]RecipeConfig{"disk-usage": {Transform: "json: {{ .json.used"}}
+	err := validateRecipeTransforms(invalid)
+	assert.ErrorContains(t, err, "Recipe 'disk-usage' has an invalid transform")
+
+	// The environment of the Reconciler holds its secrets
+	_, err = parseRecipeTransform("disk-usage", `{{ expandenv "$ADMIN_TOKEN" }}`)
+	assert.ErrorContains(t, err, `function "expandenv" not defined`)
+}
+
+// Test the transformation of the results of a recipe, keeping the fields left out as reported.
+func TestTransformRecipeResults(t *testing.T) {
+	execution := &RecipeExecution{
+		Name:   "disk-usage",
+		Status: "successful",
+		Results: RecipeResults{
+			Actions:  []string{"Expand the volume"},
+			Analysis: "Volume usage at 97%",
+			JSON:     `{"volume": "data-0", "used": 97, "samples": [95, 96, 97]}`,
+			Links:    []string{"https://grafana.example.com/d/volumes"},
+		},
+	}
+	data := map[string]interface{}{
+		"uuid":   "transform-1",
+		"labels": map[string]interface{}{"namespace": "orders"},
+	}
+
+	testCases := []struct {
+		name      string
+		transform string
+		expected  RecipeResults
+		err       string
+	}{
+		{
+			name: "ExtractFields",
+			transform: `json: {"volume": {{ .json.volume | quote }},` +
+				` "severity": {{ if ge .json.used 95.0 }}"critical"{{ else }}"warning"{{ end }}}`,
+			expected: RecipeResults{
+				Actions:  []string{"Expand the volume"},
+				Analysis: "Volume usage at 97%",
+				JSON:     `{"severity":"critical","volume":"data-0"}`,
+				Links:    []string{"https://grafana.example.com/d/volumes"},
+			},
+		},
+		{
+			name: "Analysis",
+			transform: "analysis: \"[{{ .labels.namespace }}] {{ .analysis }}\"\n" +
+				"actions: []\n",
+			expected: RecipeResults{
+				Actions:  []string{},
+				Analysis: "[orders] Volume usage at 97%",
+				JSON:     execution.Results.JSON,
+				Links:    []string{"https://grafana.example.com/d/volumes"},
+			},
+		},
+		{
+			name:      "Actionable",
+			transform: `actionable: {{ ge .json.used 95.0 | not }}`,
+			expected: RecipeResults{
+				Actions:    []string{"Expand the volume"},
+				Analysis:   "Volume usage at 97%",
+				JSON:       execution.Results.JSON,
+				Links:      []string{"https://grafana.example.com/d/volumes"},
+				Actionable: new(bool),
+			},
+		},
+		{
+			name:      "MissingField",
+			transform: `json: {"inodes": {{ .json.inodes }}}`,
+			expected:  execution.Results,
+			err:       "map has no entry for key",
+		},
+		{
+			name:      "InvalidOutput",
+			transform: `json: {{ .json.volume`,
+			expected:  execution.Results,
+			err:       "unclosed action",
+		},
+		{
+			name:      "NotAnObject",
+			transform: `{{ .json.used }}`,
+			expected:  execution.Results,
+			err:       "Invalid transformed results",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			results, err := transformRecipeResults(tc.transform, execution, data)
+			if tc.err != "" {
+				assert.ErrorContains(t, err, tc.err)
+			} else {
+				assert.Nil(t, err)
+			}
+			assert.Equal(t, tc.expected, results)
+		})
+	}
+}
+
+// Test that the results of a recipe are kept as reported if its transformation fails.
+func TestReconcilerTransformResults(t *testing.T) {
+	execution := &RecipeExecution{
+		Name: "disk-usage", Status: "successful", Results: RecipeResults{JSON: `{"used": 97}`},
+	}
+	r := &Reconciler{uuid: "transform-2"}
+
+	recipe := r.transformResults(Recipe{
+		Config:    &RecipeConfig{Transform: `json: {"percent": "{{ .json.used }}%"}`},
+		Execution: execution,
+	})
+	assert.Equal(t, `{"percent":"97%"}`, recipe.Execution.Results.JSON)
+	// The results received from the recipe are left untouched
+	assert.Equal(t, `{"used": 97}`, execution.Results.JSON)
+
+	recipe = r.transformResults(Recipe{
+		Config:    &RecipeConfig{Transform: `json: {"percent": {{ .json.percent }}}`},
+		Execution: execution,
+	})
+	assert.Same(t, execution, recipe.Execution)
+}
@@ -1,43 +1,255 @@
 package main
 
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
 type Config struct {
 	AggregatorAddress   string
 	RedisAddress        string
 	WebexBotAddress     string
-	RecipeTimeout       int
+	RecipeTimeout       time.Duration
 	ReconcilerNamespace string
 	RecipeNamespace     string
+	PayloadSchema       string
+	PayloadAlertsField  string
+	IncidentStore       string
+	IncidentRetention   time.Duration
+	ExportInterval      time.Duration
+	ExportDestination   string
+	ExportEndpoint      string
+	ExportFormat        string
+	ExportRetention     time.Duration
+	ApprovalTimeout     time.Duration
+	ApprovalWebhook     string
+	ResultBroker        string
+	ResultBrokerAddress string
+	ResultTopic         string
+	PrometheusURL       string
+	PollInterval        time.Duration
+	FederationPeers     string
+	FederationToken     string
+	WebhookAuth         string
+	APIAuth             string
+	AuthToken           string
+	HMACSecret          string
+	TLSCert             string
+	TLSKey              string
+	TLSClientCA         string
+	AdminToken          string
+	DedupWindow         time.Duration
+	DedupFields         string
+	// Concurrency limits of recipe executions
+	MaxConcurrentExecutions int
+	Workers                 int
+	QueueSize               int
+	QueueOverflow           string
+	MaxBatchSize            int
+	DryRun                  bool
+	// Policy for recipes defined inline in requests
+	InlineRecipes         bool
+	InlineRecipeImages    string
+	InlineRecipeMaxCPU    string
+	InlineRecipeMaxMemory string
+	// Endpoint traces are exported to, if tracing is enabled
+	OTelEndpoint string
+	// Watcher of the problems reported on nodes
+	NodeProblems     bool
+	NodeProblemLabel string
+	// Leader election among replicas, only the leader launching recipes
+	LeaderElection      bool
+	LeaderElectionLease string
+	// Format of the IDs identifying executions
+	IDFormat string
+	IDPrefix string
+	// Whether to reload the configuration ConfigMaps when they change
+	WatchConfig bool
+	// Path of the configuration file the configuration was read from, if any
+	ConfigFile string
+	// Whether to record the milestones of incidents as Kubernetes Events
+	Events bool
+	// Persistent store of the records of completed incidents
+	ResultStore          string
+	ResultStoreEndpoint  string
+	ResultStoreRetention time.Duration
+	// Retention of all execution data, enforced by the janitor, besides the incidents under hold
+	DataRetention   time.Duration
+	JanitorInterval time.Duration
+	// Cleanup of the recipe Jobs once executions complete
+	CleanupPolicy  string
+	CleanupTTL     time.Duration
+	KeepFailedJobs time.Duration
+	SnapshotLogs   bool
+	// ChatOps threads following the progress of incidents
+	ChatOpsProvider string
+	ChatOpsEndpoint string
+	ChatOpsChannel  string
+	ChatOpsToken    string
+	// Secret verifying the callbacks of the ChatOps provider, which acknowledge incidents
+	ChatOpsSigningSecret string
+	// Whether to hold back the notifications of alerts whose incident is acknowledged
+	SuppressAckedNotifications bool
+	// Additional clusters recipes can run in, as contexts of the kubeconfig
+	Clusters   string
+	Kubeconfig string
+	// Maximum number of open result subscriptions
+	MaxSubscriptions int
+	// Time in-flight executions are given to complete on shutdown
+	ShutdownTimeout time.Duration
+	// Self-test running a no-op recipe end-to-end on startup, and then on the provided interval
+	Canary         bool
+	CanaryImage    string
+	CanaryInterval time.Duration
+	// Interactive debugging Pods spawned from executions, and their default and maximum TTL
+	DebugSessions       bool
+	DebugImage          string
+	DebugSessionTTL     time.Duration
+	DebugSessionMaxTTL  time.Duration
+	DebugServiceAccount string
+	// Number of alerts of a source learned before detecting the drift of its schema, 0 to disable
+	SchemaDriftSamples int
+	// Sink the lifecycle transitions of executions are emitted to as CloudEvents, if set
+	CloudEventsSink string
+	// Bounds of the recipe timeout requests can override, and the namespaces they can use
+	MinRecipeTimeout   time.Duration
+	MaxRecipeTimeout   time.Duration
+	OverrideNamespaces string
+	// Topology, authentication and TLS of the Redis connection
+	RedisMode             string
+	RedisMasterName       string
+	RedisUsername         string
+	RedisPassword         string
+	RedisSentinelPassword string
+	RedisDB               int
+	RedisTLS              bool
+	RedisTLSCA            string
+	// Sinks the analysis of incidents is delivered to, along with their delivery policy
+	Sinks                string
+	HTTPSinkURL          string
+	SlackWebhookURL      string
+	JiraURL              string
+	JiraProject          string
+	JiraIssueType        string
+	JiraUser             string
+	JiraToken            string
+	WebhookSinkURL       string
+	SinkRetries          int
+	SinkFailureThreshold int
+	SinkCooldown         time.Duration
+	// Sinks only delivered to when the analysis calls for action
+	ActionableSinks string
+	// ConfigMap the leader keeps updated with the status of the Reconciler, if set, and how often
+	StatusConfigMap string
+	StatusInterval  time.Duration
 }
 
 type IncidentBotMessage struct {
-	UUID     string   `json:"uuid"`
-	Actions  []string `json:"actions"`
-	Analysis string   `json:"analysis"`
-}
-
-type Recipe struct {
-	Config    *RecipeConfig `json:"config,omitempty"`
-	Execution *struct {
-		Name     string `json:"name"`
-		Incident string `json:"incident"`
-		Status   string `json:"status"`
-		Results  struct {
-			Actions  []string `json:"actions"`
-			Analysis string   `json:"analysis"`
-			JSON     string   `json:"json"`
-			Links    []string `json:"links"`
-		} `json:"results"`
-	} `json:"execution,omitempty"`
+	UUID        string   `json:"uuid"`
+	Actions     []string `json:"actions"`
+	Analysis    string   `json:"analysis"`
+	Occurrences int      `json:"occurrences,omitempty"`
+	// Recipes suggesting each action, as actions reported by several recipes are listed once
+	Findings []Finding `json:"findings,omitempty"`
+	// Whether any of the recipes calls for action, as opposed to only informational analyses
+	Actionable bool `json:"actionable"`
+	// Analyses of the recipes whose results are informational, left out of the analysis
+	Informational []InformationalAnalysis `json:"informational,omitempty"`
+	// UUID of the incident whose resolved alert the message verifies, if any
+	Verifies string `json:"verifies,omitempty"`
+	// Acknowledgement of the incident when the message was delivered
+	Ack *Acknowledgement `json:"ack,omitempty"`
+	// Compliance of the execution with the recipes required for its alert, if any
+	Compliance *Compliance `json:"compliance,omitempty"`
+	// Documentation, owners and runbooks of the recipes that reported results, by recipe
+	Docs map[string]RecipeDocs `json:"docs,omitempty"`
 }
 
 type RecipeConfig struct {
-	Enabled     bool   `yaml:"enabled"`
-	Image       string `yaml:"image"`
-	Entrypoint  string `yaml:"entrypoint"`
-	Description string `yaml:"description"`
+	Enabled     bool      `json:"enabled" yaml:"enabled"`
+	Image       string    `json:"image" yaml:"image"`
+	Entrypoint  string    `json:"entrypoint" yaml:"entrypoint"`
+	Description string    `json:"description" yaml:"description"`
+	Retries     int       `json:"retries,omitempty" yaml:"retries"`
+	Backoff     *Duration `json:"backoff,omitempty" yaml:"backoff"`
+	DependsOn   []string  `json:"dependsOn,omitempty" yaml:"dependsOn"`
+	Concurrency int       `json:"concurrency,omitempty" yaml:"concurrency"`
+	// How long the results of the recipe can be reused for the same alert
+	Freshness Duration `json:"freshness,omitempty" yaml:"freshness"`
+	// Overrides applied to the Job running the recipe
+	Timeout   Duration                     `json:"timeout,omitempty" yaml:"timeout"`
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty" yaml:"resources"`
+
+	NodeSelector   map[string]string   `json:"nodeSelector,omitempty" yaml:"nodeSelector"`
+	Tolerations    []corev1.Toleration `json:"tolerations,omitempty" yaml:"tolerations"`
+	ServiceAccount string              `json:"serviceAccount,omitempty" yaml:"serviceAccount"`
+	// Peer reconciler the recipe is forwarded to, instead of running locally
+	Peer string `json:"peer,omitempty" yaml:"peer"`
+	// Parameters passed to the recipe, as templates rendered against the alert
+	Params map[string]string `json:"params,omitempty" yaml:"params"`
+	// Set to "never" to keep the Jobs of the recipe after the execution
+	Cleanup string `json:"cleanup,omitempty" yaml:"cleanup"`
+	// How long the finished Jobs of the recipe are kept for, overriding the configured TTL
+	TTL Duration `json:"ttl,omitempty" yaml:"ttl"`
+	// Namespace and cluster the recipe runs in, e.g. next to the workload it inspects
+	Namespace string `json:"namespace,omitempty" yaml:"namespace"`
+	Cluster   string `json:"cluster,omitempty" yaml:"cluster"`
+	// Cron expression the recipe is run on, besides alerts, e.g. "0 2 * * *"
+	Schedule string `json:"schedule,omitempty" yaml:"schedule"`
+	// Template shaping the results of the recipe before they are aggregated
+	Transform string `json:"transform,omitempty" yaml:"transform"`
+	// Documentation of the recipe, team owning it and runbook to follow up on its results
+	DocsURL string `json:"docsUrl,omitempty" yaml:"docsUrl"`
+	Owner   string `json:"owner,omitempty" yaml:"owner"`
+	Runbook string `json:"runbook,omitempty" yaml:"runbook"`
+}
+
+// RoutingRule configures how alerts with a specific name are handled.
+type RoutingRule struct {
+	Alertname  string   `json:"alertname"`
+	Cooldown   Duration `json:"cooldown"`
+	CooldownBy []string `json:"cooldownBy"`
+	// Debugging recipes confirming the system is healthy once the alert resolves
+	Verification []string `json:"verification"`
 }
 
 type Action struct {
 	Name string                 `json:"name"`
 	Data map[string]interface{} `json:"data"`
 }
+
+// Duration wraps time.Duration so that human-readable values (e.g. "10m") can be used in the
+// recipes ConfigMap. Plain numbers are interpreted as seconds.
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(b, &value); err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case float64:
+		d.Duration = time.Duration(v * float64(time.Second))
+	case string:
+		duration, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		d.Duration = duration
+	default:
+		return fmt.Errorf("Invalid duration: %s", string(b))
+	}
+	if d.Duration < 0 {
+		return fmt.Errorf("Invalid negative duration: %s", string(b))
+	}
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
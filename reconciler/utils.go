@@ -44,18 +44,23 @@ func InitialiseKubernetesClient() (*kubernetes.Clientset, error) {
 }
 
 // Check if the reconciler has the necessary permissions in the specified namespace.
-func CheckNamespaceAccess(clientset *kubernetes.Clientset, namespace string) error {
+func CheckNamespaceAccess(clientset kubernetes.Interface, namespace string) error {
 	rules := []Rule{
 		{
 			APIGroups: []string{""},
 			Resources: []string{"configmaps"},
-			Verbs:     []string{"create", "deletecollection"},
+			Verbs:     []string{"list", "create", "patch", "deletecollection"},
 		},
 		{
 			APIGroups: []string{"batch"},
 			Resources: []string{"jobs"},
 			Verbs:     []string{"get", "list", "create", "deletecollection"},
 		},
+		{
+			APIGroups: []string{""},
+			Resources: []string{"pods", "persistentvolumeclaims"},
+			Verbs:     []string{"list"},
+		},
 	}
 
 	err := checkAccessForRules(clientset, rules, namespace)
@@ -72,22 +77,144 @@ func CheckNamespaceAccess(clientset *kubernetes.Clientset, namespace string) err
 	return nil
 }
 
+// Check if the reconciler has the necessary permissions to watch the problems of the nodes.
+func CheckNodeAccess(clientset kubernetes.Interface) error {
+	rules := []Rule{
+		{
+			APIGroups: []string{""},
+			Resources: []string{"nodes", "events"},
+			Verbs:     []string{"list", "watch"},
+		},
+	}
+	return checkAccessForRules(clientset, rules, "")
+}
+
+// Check if the reconciler has the necessary permissions to watch its configuration ConfigMaps.
+func CheckConfigWatchAccess(clientset kubernetes.Interface, namespace string) error {
+	rules := []Rule{
+		{
+			APIGroups: []string{""},
+			Resources: []string{"configmaps"},
+			Verbs:     []string{"watch"},
+		},
+	}
+	return checkAccessForRules(clientset, rules, namespace)
+}
+
+// Check if the reconciler has the necessary permissions to take part in the leader election.
+func CheckLeaseAccess(clientset kubernetes.Interface, namespace string) error {
+	rules := []Rule{
+		{
+			APIGroups: []string{"coordination.k8s.io"},
+			Resources: []string{"leases"},
+			Verbs:     []string{"get", "create", "update"},
+		},
+	}
+	return checkAccessForRules(clientset, rules, namespace)
+}
+
+// Check if the reconciler has the necessary permissions to record the Events of incidents, along
+// with the ConfigMaps reporting their status.
+func CheckEventsAccess(clientset kubernetes.Interface, config *Config) error {
+	rules := []Rule{
+		{
+			APIGroups: []string{""},
+			Resources: []string{"events"},
+			Verbs:     []string{"create", "patch"},
+		},
+		{
+			APIGroups: []string{""},
+			Resources: []string{"configmaps"},
+			Verbs:     []string{"get", "list", "create", "update", "delete"},
+		},
+	}
+	if err := checkAccessForRules(clientset, rules, config.ReconcilerNamespace); err != nil {
+		return err
+	}
+	return checkAccessForRules(clientset, rules[:1], config.RecipeNamespace)
+}
+
+// Check if the reconciler has the necessary permissions to manage debugging sessions.
+func CheckDebugSessionAccess(clientset kubernetes.Interface, config *Config) error {
+	rules := []Rule{
+		{
+			APIGroups: []string{""},
+			Resources: []string{"pods"},
+			Verbs:     []string{"get", "list", "create", "delete"},
+		},
+		{
+			APIGroups: []string{""},
+			Resources: []string{"configmaps"},
+			Verbs:     []string{"create"},
+		},
+	}
+	return checkAccessForRules(clientset, rules, config.RecipeNamespace)
+}
+
+// Check if the reconciler has the necessary permissions to keep its status ConfigMap updated.
+func CheckStatusAccess(clientset kubernetes.Interface, namespace string) error {
+	rules := []Rule{
+		{
+			APIGroups: []string{""},
+			Resources: []string{"configmaps"},
+			Verbs:     []string{"get", "create", "update"},
+		},
+	}
+	return checkAccessForRules(clientset, rules, namespace)
+}
+
+// Check if the reconciler has the necessary permissions to persist the state of the alert intake.
+func CheckIntakeAccess(clientset kubernetes.Interface, namespace string) error {
+	rules := []Rule{
+		{
+			APIGroups: []string{""},
+			Resources: []string{"configmaps"},
+			Verbs:     []string{"get", "create", "update"},
+		},
+	}
+	return checkAccessForRules(clientset, rules, namespace)
+}
+
+// Check if the reconciler has the necessary permissions to keep failed recipe Jobs and to snapshot
+// the logs of recipe Pods, if configured.
+func CheckCleanupAccess(clientset kubernetes.Interface, config *Config) error {
+	var rules []Rule
+	if config.KeepFailedJobs > 0 {
+		rules = append(rules, Rule{
+			APIGroups: []string{"batch"},
+			Resources: []string{"jobs"},
+			Verbs:     []string{"patch"},
+		})
+	}
+	if config.SnapshotLogs {
+		rules = append(rules, Rule{
+			APIGroups: []string{""},
+			Resources: []string{"pods/log"},
+			Verbs:     []string{"get"},
+		})
+	}
+	return checkAccessForRules(clientset, rules, config.RecipeNamespace)
+}
+
 // Check if the Reconciler has permissions for a list of rules in the specified namespace.
 // Returns false and an error message if at least one of the conditions is not met.
-func checkAccessForRules(clientset *kubernetes.Clientset, rules []Rule, namespace string) error {
+func checkAccessForRules(clientset kubernetes.Interface, rules []Rule, namespace string) error {
 	var errorMessages []string
 
 	for _, rule := range rules {
 		for _, group := range rule.APIGroups {
 			for _, resource := range rule.Resources {
+				// Subresources are given along with their resource, e.g. "pods/log"
+				name, subresource, _ := strings.Cut(resource, "/")
 				for _, verb := range rule.Verbs {
 					sar := &authorizationv1.SelfSubjectAccessReview{
 						Spec: authorizationv1.SelfSubjectAccessReviewSpec{
 							ResourceAttributes: &authorizationv1.ResourceAttributes{
-								Namespace: namespace,
-								Verb:      verb,
-								Group:     group,
-								Resource:  resource,
+								Namespace:   namespace,
+								Verb:        verb,
+								Group:       group,
+								Resource:    name,
+								Subresource: subresource,
 							},
 						},
 					}
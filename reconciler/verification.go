@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Field of the alert data identifying the incident a verification execution follows up on.
+const verificationField = "verification"
+
+// Outcomes of the verification of a resolved alert.
+const (
+	VerificationPassed = "passed"
+	VerificationFailed = "failed"
+)
+
+// Verification identifies the incident of a resolved alert, along with the recipes confirming that
+// the system is healthy again.
+type Verification struct {
+	Incident string   `json:"incident"`
+	Recipes  []string `json:"recipes"`
+}
+
+// ClosureReport is appended to an incident once the verification of its resolved alert completes.
+type ClosureReport struct {
+	// UUID of the verification execution
+	Verification string    `json:"verification"`
+	Status       string    `json:"status"`
+	Analysis     string    `json:"analysis"`
+	CompletedAt  time.Time `json:"completedAt"`
+}
+
+// FiringIncidents keeps track of the incident of each firing alert, by fingerprint, so that the
+// incident can be found once the alert resolves.
+type FiringIncidents struct {
+	mutex     sync.Mutex
+	incidents map[string]firingIncident
+}
+
+type firingIncident struct {
+	uuid    string
+	firedAt time.Time
+}
+
+var firingIncidents = NewFiringIncidents()
+
+// Initialise an empty set of firing incidents.
+func NewFiringIncidents() *FiringIncidents {
+	return &FiringIncidents{incidents: make(map[string]firingIncident)}
+}
+
+// Record the incident of a firing alert, dropping the alerts that fired longer than the retention
+// ago without resolving.
+func (fi *FiringIncidents) Track(fingerprint string, uuid string, retention time.Duration) {
+	fi.mutex.Lock()
+	defer fi.mutex.Unlock()
+
+	now := time.Now()
+	for k, incident := range fi.incidents {
+		if now.Sub(incident.firedAt) > retention {
+			delete(fi.incidents, k)
+		}
+	}
+	fi.incidents[fingerprint] = firingIncident{uuid: uuid, firedAt: now}
+}
+
+// Stop tracking a resolved alert, returning the UUID of its incident, if known.
+func (fi *FiringIncidents) Resolve(fingerprint string) (string, bool) {
+	fi.mutex.Lock()
+	defer fi.mutex.Unlock()
+	incident, ok := fi.incidents[fingerprint]
+	delete(fi.incidents, fingerprint)
+	return incident.uuid, ok
+}
+
+// Record the incident of a firing alert received on the webhook.
+func trackFiringAlert(alertData map[string]interface{}, config *Config) {
+	firingIncidents.Track(
+		alertFingerprint(alertData, config.DedupFields), alertData["uuid"].(string),
+		config.IncidentRetention,
+	)
+}
+
+// Submit the verification of a resolved alert, if the routing rule of the alert lists verification
+// recipes and the incident of the alert is known. The UUID of the verification is returned.
+func submitVerification(
+	ctx context.Context, alertData map[string]interface{}, config *Config,
+) (string, bool) {
+	incident, ok := firingIncidents.Resolve(alertFingerprint(alertData, config.DedupFields))
+	if !ok {
+		return "", false
+	}
+	rc, err := getRecipeCatalog(config.ReconcilerNamespace)
+	if err != nil {
+		return "", false
+	}
+	rule, ok := rc.RoutingRule(alertLabels(alertData)["alertname"])
+	if !ok || len(rule.Verification) == 0 {
+		return "", false
+	}
+
+	alertData["uuid"] = newExecutionID(ctx)
+	alertData[verificationField] = Verification{Incident: incident, Recipes: rule.Verification}
+	logger.Info(
+		"Verifying resolved alert",
+		zap.String("uuid", alertData["uuid"].(string)),
+		zap.String("incident", incident),
+	)
+	if err := executionQueue.Submit(ctx, &alertData, Alert); err != nil {
+		logger.Warn("Dropping verification of resolved alert", zap.Error(err))
+		return "", false
+	}
+	return alertData["uuid"].(string), true
+}
+
+// Extract the verification an execution is running, if any.
+func parseVerification(data map[string]interface{}) (*Verification, bool) {
+	value, ok := data[verificationField]
+	if !ok {
+		return nil, false
+	}
+	if verification, ok := value.(Verification); ok {
+		return &verification, true
+	}
+
+	// Executions restored from Redis hold the verification as a generic JSON object
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, false
+	}
+	var verification Verification
+	if err := json.Unmarshal(encoded, &verification); err != nil || verification.Incident == "" {
+		return nil, false
+	}
+	return &verification, true
+}
+
+// Restrict the debugging recipes of a verification execution to its verification recipes.
+func verificationRecipes(
+	recipes map[string]Recipe, data map[string]interface{},
+) map[string]Recipe {
+	verification, ok := parseVerification(data)
+	if !ok {
+		return recipes
+	}
+	restricted := make(map[string]Recipe, len(verification.Recipes))
+	for _, name := range verification.Recipes {
+		if recipe, ok := recipes[name]; ok {
+			restricted[name] = recipe
+		}
+	}
+	return restricted
+}
+
+// Append the closure report of a verification execution to the incident of the resolved alert.
+// The verification passes if every verification recipe completed successfully.
+func (r *Reconciler) recordClosure(completedRecipes []Recipe, analysis string) {
+	verification, ok := parseVerification(*r.data)
+	if !ok {
+		return
+	}
+
+	status := VerificationPassed
+	successful := 0
+	for _, recipe := range completedRecipes {
+		if recipe.Execution.Succeeded() {
+			successful++
+		}
+	}
+	if successful < len(r.recipes) {
+		status = VerificationFailed
+	}
+
+	report := &ClosureReport{
+		Verification: r.uuid,
+		Status:       status,
+		Analysis:     analysis,
+		CompletedAt:  time.Now().UTC(),
+	}
+	incidentRegistry.RecordClosure(verification.Incident, report)
+	verificationsCompleted.WithLabelValues(status).Inc()
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that the incidents of firing alerts are found once they resolve, unless they expired.
+func TestFiringIncidents(t *testing.T) {
+	fi := NewFiringIncidents()
+	firedAt := time.Now().Add(-2 * time.Hour)
+	fi.incidents["stale"] = firingIncident{uuid: "incident-1", firedAt: firedAt}
+	fi.Track("fresh", "incident-2", time.Hour)
+
+	_, ok := fi.Resolve("stale")
+	assert.False(t, ok)
+	uuid, ok := fi.Resolve("fresh")
+	assert.True(t, ok)
+	assert.Equal(t, "incident-2", uuid)
+
+	// Alerts only resolve once
+	_, ok = fi.Resolve("fresh")
+	assert.False(t, ok)
+}
+
+// Test that verifications are parsed both as submitted and as restored from Redis.
+func TestParseVerification(t *testing.T) {
+	expected := Verification{Incident: "incident-1", Recipes: []string{"health-check"}}
+	testCases := []struct {
+		name string
+		data map[string]interface{}
+		ok   bool
+	}{
+		{"Submitted", map[string]interface{}{verificationField: expected}, true},
+		{
+			"Restored",
+			map[string]interface{}{verificationField: map[string]interface{}{
+				"incident": "incident-1", "recipes": []interface{}{"health-check"},
+			}},
+			true,
+		},
+		{"Missing", map[string]interface{}{}, false},
+		{"Invalid", map[string]interface{}{verificationField: "incident-1"}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			verification, ok := parseVerification(tc.data)
+			assert.Equal(t, tc.ok, ok)
+			if tc.ok {
+				assert.Equal(t, expected, *verification)
+			}
+		})
+	}
+}
+
+// Test that verification executions only run their verification recipes.
+func TestVerificationRecipes(t *testing.T) {
+	recipes := map[string]Recipe{"diagnose": {}, "health-check": {}}
+	assert.Equal(t, recipes, verificationRecipes(recipes, map[string]interface{}{}))
+
+	data := map[string]interface{}{
+		verificationField: Verification{Incident: "incident-1", Recipes: []string{"health-check"}},
+	}
+	assert.Equal(
+		t, map[string]Recipe{"health-check": {}}, verificationRecipes(recipes, data),
+	)
+}
+
+// Test that closure reports pass only if every verification recipe succeeded.
+func TestRecordClosure(t *testing.T) {
+	testCases := []struct {
+		name     string
+		statuses []string
+		expected string
+	}{
+		{"Passed", []string{"successful", "successful"}, VerificationPassed},
+		{"Failed", []string{"successful", "failed"}, VerificationFailed},
+		{"Missing", []string{"successful"}, VerificationFailed},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			incident := "closure-" + tc.name
+			incidentRegistry.Register(incident, Alert)
+			r := &Reconciler{
+				uuid: "verification-" + tc.name,
+				data: &map[string]interface{}{
+					verificationField: Verification{Incident: incident},
+				},
+				recipes: map[string]Recipe{"health-check": {}, "smoke-test": {}},
+			}
+
+			var completed []Recipe
+			for _, status := range tc.statuses {
+				recipe, err := r.parseRecipeResults(`{"status": "` + status + `"}`)
+				assert.Nil(t, err)
+				completed = append(completed, recipe)
+			}
+			r.recordClosure(completed, "All clear")
+
+			closed, ok := incidentRegistry.Get(incident)
+			assert.True(t, ok)
+			assert.Equal(t, tc.expected, closed.Closure.Status)
+			assert.Equal(t, r.uuid, closed.Closure.Verification)
+			assert.Equal(t, "All clear", closed.Closure.Analysis)
+		})
+	}
+}